@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/farovictor/bifrost/config"
+	"github.com/farovictor/bifrost/pkg/audit"
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/export"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditExportFormat string
+	auditExportOutput string
+	auditExportSince  string
+	auditExportUntil  string
+	auditExportOrg    string
+	auditExportActor  string
+	auditExportAction string
+)
+
+var auditExportCmd = &cobra.Command{
+	Use:   "audit-export",
+	Short: "Export audit log entries as CSV, JSON lines or Parquet",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format := outputFormat(auditExportFormat, auditExportOutput)
+		q := audit.Query{OrgID: auditExportOrg, ActorID: auditExportActor, Action: auditExportAction}
+		for _, f := range []struct {
+			name, value string
+			dst         *time.Time
+		}{{"since", auditExportSince, &q.Since}, {"until", auditExportUntil, &q.Until}} {
+			if f.value == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, f.value)
+			if err != nil {
+				return fmt.Errorf("invalid --%s %q: use RFC3339", f.name, f.value)
+			}
+			*f.dst = t
+		}
+		if err := export.Check(format); err != nil {
+			return err
+		}
+
+		dbType := config.DBType()
+		dsn := config.PostgresDSN()
+		if dbType == "postgres" && dsn == "" {
+			return fmt.Errorf("POSTGRES_DSN is not set")
+		}
+		db, err := database.Connect(dbType, dsn)
+		if err != nil {
+			return err
+		}
+		sqlDB, _ := db.DB()
+		defer sqlDB.Close()
+
+		var out io.Writer = cmd.OutOrStdout()
+		if auditExportOutput != "-" {
+			f, err := os.Create(auditExportOutput)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		bw := bufio.NewWriter(out)
+		if err := audit.Export(audit.NewSQLStore(db), q, format, bw); err != nil {
+			return err
+		}
+		return bw.Flush()
+	},
+}
+
+func init() {
+	auditExportCmd.Flags().StringVar(&auditExportFormat, "format", "", "csv, jsonl or parquet (default from the --output extension, else csv)")
+	auditExportCmd.Flags().StringVarP(&auditExportOutput, "output", "o", "", "file to write, or - for stdout")
+	auditExportCmd.Flags().StringVar(&auditExportSince, "since", "", "start time (RFC3339, inclusive)")
+	auditExportCmd.Flags().StringVar(&auditExportUntil, "until", "", "end time (RFC3339, exclusive)")
+	auditExportCmd.Flags().StringVar(&auditExportOrg, "org", "", "only entries of this organization")
+	auditExportCmd.Flags().StringVar(&auditExportActor, "actor", "", "only entries by this actor ID")
+	auditExportCmd.Flags().StringVar(&auditExportAction, "action", "", "only this action, e.g. service.update")
+	auditExportCmd.MarkFlagRequired("output") //nolint:errcheck
+	rootCmd.AddCommand(auditExportCmd)
+}
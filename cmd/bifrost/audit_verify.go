@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/farovictor/bifrost/config"
+	"github.com/farovictor/bifrost/pkg/audit"
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "audit-verify",
+	Short: "Check that no audit log entry was edited or removed",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dbType := config.DBType()
+		dsn := config.PostgresDSN()
+		if dbType == "postgres" && dsn == "" {
+			return fmt.Errorf("POSTGRES_DSN is not set")
+		}
+		db, err := database.Connect(dbType, dsn)
+		if err != nil {
+			return err
+		}
+		sqlDB, _ := db.DB()
+		defer sqlDB.Close()
+
+		n, err := audit.VerifyStore(audit.NewSQLStore(db))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "audit log ok: %d entries\n", n)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditVerifyCmd)
+}
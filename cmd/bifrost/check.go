@@ -5,7 +5,7 @@ import (
 
 	"github.com/farovictor/bifrost/config"
 	"github.com/farovictor/bifrost/pkg/database"
-	redis "github.com/redis/go-redis/v9"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
 	"github.com/spf13/cobra"
 )
 
@@ -31,14 +31,23 @@ var checkCmd = &cobra.Command{
 		}
 		sqlDB.Close()
 
-		rdb := redis.NewClient(&redis.Options{
-			Addr:     config.RedisAddr(),
-			Password: config.RedisPassword(),
-			DB:       config.RedisDB(),
-			Protocol: config.RedisProtocol(),
-		})
-		if err := rdb.Ping(cmd.Context()).Err(); err != nil {
-			return err
+		if config.RateLimitBackend() == "redis" {
+			rdb, err := ratelimit.NewRedisClient(ratelimit.RedisOptions{
+				Mode:             config.RedisMode(),
+				Addrs:            config.RedisAddrs(),
+				MasterName:       config.RedisMasterName(),
+				Password:         config.RedisPassword(),
+				SentinelPassword: config.RedisSentinelPassword(),
+				DB:               config.RedisDB(),
+				Protocol:         config.RedisProtocol(),
+			})
+			if err != nil {
+				return err
+			}
+			defer rdb.Close()
+			if err := rdb.Ping(cmd.Context()).Err(); err != nil {
+				return err
+			}
 		}
 
 		fmt.Println("connections ok")
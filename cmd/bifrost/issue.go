@@ -19,6 +19,8 @@ var (
 	issueTarget    string
 	issueTTL       time.Duration
 	issueRateLimit int
+	issueWindow    string
+	issueBurst     int
 )
 
 var issueCmd = &cobra.Command{
@@ -26,11 +28,13 @@ var issueCmd = &cobra.Command{
 	Short: "Issue a virtual key",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		k := keys.VirtualKey{
-			ID:        issueID,
-			Scope:     issueScope,
-			Target:    issueTarget,
-			ExpiresAt: time.Now().Add(issueTTL),
-			RateLimit: issueRateLimit,
+			ID:              issueID,
+			Scope:           issueScope,
+			Target:          issueTarget,
+			ExpiresAt:       time.Now().Add(issueTTL),
+			RateLimit:       issueRateLimit,
+			RateLimitWindow: issueWindow,
+			RateLimitBurst:  issueBurst,
 		}
 		body, err := json.Marshal(k)
 		if err != nil {
@@ -55,7 +59,9 @@ func init() {
 	issueCmd.Flags().StringVar(&issueScope, "scope", "", "scope for the key")
 	issueCmd.Flags().StringVar(&issueTarget, "target", "", "target service")
 	issueCmd.Flags().DurationVar(&issueTTL, "ttl", time.Hour, "time to live")
-	issueCmd.Flags().IntVar(&issueRateLimit, "rate-limit", 0, "requests per minute allowed")
+	issueCmd.Flags().IntVar(&issueRateLimit, "rate-limit", 0, "requests allowed per window")
+	issueCmd.Flags().StringVar(&issueWindow, "window", "", "rate limit window: second, minute, hour or day (default minute)")
+	issueCmd.Flags().IntVar(&issueBurst, "burst", 0, "max requests sent back-to-back (default rate-limit)")
 	issueCmd.MarkFlagRequired("id")
 	issueCmd.MarkFlagRequired("scope")
 	issueCmd.MarkFlagRequired("target")
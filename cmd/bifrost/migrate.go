@@ -9,8 +9,11 @@ import (
 	"github.com/farovictor/bifrost/config"
 	"github.com/farovictor/bifrost/pkg/database"
 	"github.com/spf13/cobra"
+	"gorm.io/gorm"
 )
 
+var migrateDefaultOrg string
+
 var migrateCmd = &cobra.Command{
 	Use:   "migrate",
 	Short: "Apply database migrations",
@@ -35,14 +38,27 @@ var migrateCmd = &cobra.Command{
 			return err
 		}
 		sort.Strings(files)
-		for _, f := range files {
-			b, err := os.ReadFile(f)
-			if err != nil {
-				return err
+		// Run on one connection so the default org setting is seen by
+		// every migration.
+		err = db.Connection(func(tx *gorm.DB) error {
+			if migrateDefaultOrg != "" {
+				if err := tx.Exec("SELECT set_config('bifrost.default_org', ?, false)", migrateDefaultOrg).Error; err != nil {
+					return err
+				}
 			}
-			if err := db.Exec(string(b)).Error; err != nil {
-				return fmt.Errorf("%s: %w", f, err)
+			for _, f := range files {
+				b, err := os.ReadFile(f)
+				if err != nil {
+					return err
+				}
+				if err := tx.Exec(string(b)).Error; err != nil {
+					return fmt.Errorf("%s: %w", f, err)
+				}
 			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 		fmt.Fprintf(cmd.OutOrStdout(), "applied %d migrations\n", len(files))
 		return nil
@@ -50,5 +66,6 @@ var migrateCmd = &cobra.Command{
 }
 
 func init() {
+	migrateCmd.Flags().StringVar(&migrateDefaultOrg, "default-org", config.DefaultOrg(), "organization given keys, services, root keys and service accounts without one")
 	rootCmd.AddCommand(migrateCmd)
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/farovictor/bifrost/config"
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/reports"
+	"github.com/farovictor/bifrost/pkg/usage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportOrg    string
+	reportPeriod string
+	reportFormat string
+	reportOutput string
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Print an organization's chargeback report for a month",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		now := time.Now().UTC()
+		period := reportPeriod
+		if period == "" {
+			period = lastPeriod(now)
+		}
+		if _, _, err := reports.ParsePeriod(period); err != nil {
+			return fmt.Errorf("invalid --period %q: use YYYY-MM", period)
+		}
+		if reportFormat != "json" && reportFormat != "csv" {
+			return fmt.Errorf("invalid --format %q: use json or csv", reportFormat)
+		}
+
+		dbType := config.DBType()
+		dsn := config.PostgresDSN()
+		if dbType == "postgres" && dsn == "" {
+			return fmt.Errorf("POSTGRES_DSN is not set")
+		}
+		db, err := database.Connect(dbType, dsn)
+		if err != nil {
+			return err
+		}
+		sqlDB, _ := db.DB()
+		defer sqlDB.Close()
+
+		rep, err := reports.Generate(usage.NewSQLStore(db), keys.NewSQLStore(db), reportOrg, period, now)
+		if err != nil {
+			return err
+		}
+
+		var out io.Writer = cmd.OutOrStdout()
+		if reportOutput != "" && reportOutput != "-" {
+			f, err := os.Create(reportOutput)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		if reportFormat == "csv" {
+			return reports.WriteCSV(out, rep)
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	},
+}
+
+// lastPeriod returns the last billing period that ended before now.
+func lastPeriod(now time.Time) string {
+	from, _, _ := reports.ParsePeriod(reports.PeriodOf(now))
+	return reports.PeriodOf(from.AddDate(0, -1, 0))
+}
+
+func init() {
+	reportCmd.Flags().StringVar(&reportOrg, "org", "", "organization to report on")
+	reportCmd.Flags().StringVar(&reportPeriod, "period", "", "billing period as YYYY-MM (default last month)")
+	reportCmd.Flags().StringVar(&reportFormat, "format", "json", "json or csv")
+	reportCmd.Flags().StringVarP(&reportOutput, "output", "o", "", "file to write (default stdout)")
+	reportCmd.MarkFlagRequired("org") //nolint:errcheck
+	rootCmd.AddCommand(reportCmd)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/farovictor/bifrost/config"
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/export"
+	"github.com/farovictor/bifrost/pkg/usage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneOlderThan string
+	pruneBatchSize int
+
+	exportFormat  string
+	exportOutput  string
+	exportFrom    string
+	exportTo      string
+	exportOrg     string
+	exportService string
+)
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Manage recorded usage events",
+}
+
+var usagePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete usage events older than the retention window",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		age := time.Duration(config.UsageDBRetentionDays()) * 24 * time.Hour
+		if pruneOlderThan != "" {
+			d, err := parseAge(pruneOlderThan)
+			if err != nil {
+				return err
+			}
+			age = d
+		}
+
+		dbType := config.DBType()
+		dsn := config.PostgresDSN()
+		if dbType == "postgres" && dsn == "" {
+			return fmt.Errorf("POSTGRES_DSN is not set")
+		}
+		db, err := database.Connect(dbType, dsn)
+		if err != nil {
+			return err
+		}
+		sqlDB, _ := db.DB()
+		defer sqlDB.Close()
+
+		var lock database.Locker = &database.LocalLock{}
+		var partitions *usage.Partitions
+		if dbType == "postgres" {
+			lock = database.NewAdvisoryLock(db, usage.RetentionLockKey)
+			partitions = usage.NewPartitions(db, config.UsagePartitionInterval(), config.UsagePartitionsAhead())
+		}
+		release, ok, err := lock.TryLock(cmd.Context())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("another instance is pruning usage events")
+		}
+		defer release()
+
+		// Events are rolled up before they are deleted, and events not yet
+		// rolled up are kept. Partitioned tables only lose whole partitions.
+		retention := &usage.Retention{
+			Store:       usage.NewSQLStore(db),
+			BatchSize:   pruneBatchSize,
+			RollupDelay: config.UsageRollupDelay(),
+			Partitions:  partitions,
+		}
+		cutoff := time.Now().Add(-age)
+		deleted, err := retention.PruneBefore(cmd.Context(), cutoff)
+		if err != nil {
+			return err
+		}
+		if partitions != nil {
+			if ok, _ := partitions.Enabled(); ok {
+				fmt.Fprintf(cmd.OutOrStdout(), "dropped usage partitions ending before %s\n", cutoff.UTC().Format(time.RFC3339))
+				return nil
+			}
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "deleted %d events recorded before %s\n", deleted, cutoff.UTC().Format(time.RFC3339))
+		return nil
+	},
+}
+
+var usageExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export usage events as CSV, JSON lines or Parquet",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format := outputFormat(exportFormat, exportOutput)
+		q := usage.ExportQuery{OrgID: exportOrg, Service: exportService}
+		for _, f := range []struct {
+			name, value string
+			dst         *time.Time
+		}{{"from", exportFrom, &q.From}, {"to", exportTo, &q.To}} {
+			if f.value == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, f.value)
+			if err != nil {
+				return fmt.Errorf("invalid --%s %q: use RFC3339", f.name, f.value)
+			}
+			*f.dst = t
+		}
+		if err := export.Check(format); err != nil {
+			return err
+		}
+
+		dbType := config.DBType()
+		dsn := config.PostgresDSN()
+		if dbType == "postgres" && dsn == "" {
+			return fmt.Errorf("POSTGRES_DSN is not set")
+		}
+		db, err := database.Connect(dbType, dsn)
+		if err != nil {
+			return err
+		}
+		sqlDB, _ := db.DB()
+		defer sqlDB.Close()
+
+		var out io.Writer = cmd.OutOrStdout()
+		if exportOutput != "-" {
+			f, err := os.Create(exportOutput)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		bw := bufio.NewWriter(out)
+		if err := usage.Export(usage.NewSQLStore(db), q, format, bw); err != nil {
+			return err
+		}
+		return bw.Flush()
+	},
+}
+
+// outputFormat returns format, or when it is empty the format named by the
+// extension of output, defaulting to CSV.
+func outputFormat(format, output string) string {
+	if format != "" {
+		return format
+	}
+	switch ext := strings.TrimPrefix(filepath.Ext(output), "."); ext {
+	case export.FormatJSONL, export.FormatParquet:
+		return ext
+	}
+	return export.FormatCSV
+}
+
+// parseAge parses a Go duration, also accepting a whole number of days such
+// as "30d".
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid --older-than %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid --older-than %q", s)
+	}
+	return d, nil
+}
+
+func init() {
+	usagePruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "", "age of the events to delete, e.g. 30d or 720h (default BIFROST_USAGE_DB_RETENTION_DAYS or BIFROST_USAGE_RETENTION_DAYS)")
+	usagePruneCmd.Flags().IntVar(&pruneBatchSize, "batch-size", config.UsagePruneBatchSize(), "events deleted per statement")
+	usageExportCmd.Flags().StringVar(&exportFormat, "format", "", "csv, jsonl or parquet (default from the --output extension, else csv)")
+	usageExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "file to write, or - for stdout")
+	usageExportCmd.Flags().StringVar(&exportFrom, "from", "", "start time (RFC3339, inclusive)")
+	usageExportCmd.Flags().StringVar(&exportTo, "to", "", "end time (RFC3339, exclusive)")
+	usageExportCmd.Flags().StringVar(&exportOrg, "org", "", "only events of this organization")
+	usageExportCmd.Flags().StringVar(&exportService, "service", "", "only events of this service")
+	usageExportCmd.MarkFlagRequired("output") //nolint:errcheck
+	usageCmd.AddCommand(usagePruneCmd)
+	usageCmd.AddCommand(usageExportCmd)
+	rootCmd.AddCommand(usageCmd)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	cases := map[string]time.Duration{
+		"30d":  30 * 24 * time.Hour,
+		"0d":   0,
+		"720h": 720 * time.Hour,
+		"90m":  90 * time.Minute,
+	}
+	for in, want := range cases {
+		got, err := parseAge(in)
+		if err != nil || got != want {
+			t.Fatalf("parseAge(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "d", "-1d", "xd", "soon"} {
+		if _, err := parseAge(in); err == nil {
+			t.Fatalf("parseAge(%q): expected error", in)
+		}
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	cases := []struct{ format, output, want string }{
+		{"", "usage.parquet", "parquet"},
+		{"", "out/usage.jsonl", "jsonl"},
+		{"", "usage.csv", "csv"},
+		{"", "-", "csv"},
+		{"", "usage.txt", "csv"},
+		{"jsonl", "usage.parquet", "jsonl"},
+	}
+	for _, c := range cases {
+		if got := outputFormat(c.format, c.output); got != c.want {
+			t.Fatalf("outputFormat(%q, %q) = %q; want %q", c.format, c.output, got, c.want)
+		}
+	}
+}
+
+func TestLastPeriod(t *testing.T) {
+	cases := map[time.Time]string{
+		time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC):   "2025-02",
+		time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC):    "2024-12",
+		time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC): "2025-11",
+	}
+	for now, want := range cases {
+		if got := lastPeriod(now); got != want {
+			t.Fatalf("lastPeriod(%s) = %q; want %q", now, got, want)
+		}
+	}
+}
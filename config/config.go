@@ -56,6 +56,56 @@ func RedisProtocol() int {
 	return 3
 }
 
+// RedisMode returns the Redis deployment topology: single (default),
+// sentinel or cluster. It reads REDIS_MODE.
+func RedisMode() string {
+	if v := os.Getenv("REDIS_MODE"); v != "" {
+		return strings.ToLower(v)
+	}
+	return "single"
+}
+
+// RedisAddrs returns the Redis addresses to connect to. It reads the
+// comma-separated REDIS_ADDRS (sentinel or cluster seed addresses) and falls
+// back to RedisAddr.
+func RedisAddrs() []string {
+	if v := os.Getenv("REDIS_ADDRS"); v != "" {
+		return splitTrim(v)
+	}
+	return []string{RedisAddr()}
+}
+
+// RedisMasterName returns the Sentinel master name from REDIS_MASTER_NAME.
+func RedisMasterName() string {
+	return os.Getenv("REDIS_MASTER_NAME")
+}
+
+// RedisSentinelPassword returns the password for the Sentinels themselves
+// from REDIS_SENTINEL_PASSWORD.
+func RedisSentinelPassword() string {
+	return os.Getenv("REDIS_SENTINEL_PASSWORD")
+}
+
+// RateLimitBackend returns where rate limiter state is kept: redis (default)
+// or memory. It reads BIFROST_RATELIMIT_BACKEND.
+func RateLimitBackend() string {
+	if v := os.Getenv("BIFROST_RATELIMIT_BACKEND"); v != "" {
+		return strings.ToLower(v)
+	}
+	return "redis"
+}
+
+// RateLimitFailurePolicy returns what the rate limiter does while Redis is
+// unavailable: open (admit everything), closed (reject everything) or local
+// (default; enforce limits per instance). It reads
+// BIFROST_RATELIMIT_FAILURE_POLICY.
+func RateLimitFailurePolicy() string {
+	if v := os.Getenv("BIFROST_RATELIMIT_FAILURE_POLICY"); v != "" {
+		return strings.ToLower(v)
+	}
+	return "local"
+}
+
 // MetricsEnabled determines whether Prometheus metrics should be exposed.
 // It checks the BIFROST_ENABLE_METRICS environment variable for a truthy value.
 func MetricsEnabled() bool {
@@ -142,6 +192,13 @@ func AdminRole() string {
 	return role
 }
 
+// DefaultOrg returns the organization given keys, services, root keys and
+// service accounts that predate org ownership when migrating.
+// It reads BIFROST_DEFAULT_ORG; when unset the only organization is used.
+func DefaultOrg() string {
+	return os.Getenv("BIFROST_DEFAULT_ORG")
+}
+
 // DBType returns the database backend to use.
 // It reads the BIFROST_DB environment variable and defaults to "postgres".
 func DBType() string {
@@ -245,3 +302,646 @@ func EncryptionKey() []byte {
 	}
 	return b
 }
+
+// ConcurrencyQueueSize returns how many requests over a max_concurrent limit
+// may wait for a slot on each instance. Reads BIFROST_CONCURRENCY_QUEUE_SIZE
+// and defaults to 0, which rejects excess requests immediately.
+func ConcurrencyQueueSize() int {
+	if v := os.Getenv("BIFROST_CONCURRENCY_QUEUE_SIZE"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// ConcurrencyMaxWait returns how long a queued request waits for a slot
+// before it is rejected. Reads BIFROST_CONCURRENCY_MAX_WAIT (any Go duration
+// string) and defaults to 5s.
+func ConcurrencyMaxWait() time.Duration {
+	if v := os.Getenv("BIFROST_CONCURRENCY_MAX_WAIT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return 5 * time.Second
+}
+
+// ConcurrencyLeaseTTL returns how long a concurrency slot held in Redis
+// survives without being renewed, so slots held by a crashed instance are
+// reclaimed. Reads BIFROST_CONCURRENCY_LEASE_TTL and defaults to 30s.
+func ConcurrencyLeaseTTL() time.Duration {
+	if v := os.Getenv("BIFROST_CONCURRENCY_LEASE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 30 * time.Second
+}
+
+// AdaptiveLimiting reports whether admission to an upstream is lowered while
+// it returns 429s. Enabled unless BIFROST_ADAPTIVE_LIMITING is set to a falsy
+// value.
+func AdaptiveLimiting() bool {
+	switch os.Getenv("BIFROST_ADAPTIVE_LIMITING") {
+	case "0", "false", "FALSE", "False", "no", "NO":
+		return false
+	default:
+		return true
+	}
+}
+
+// AdaptiveMaxBackoff caps how long an upstream is blocked after a 429 that
+// carries no Retry-After. Reads BIFROST_ADAPTIVE_MAX_BACKOFF and defaults to 60s.
+func AdaptiveMaxBackoff() time.Duration {
+	if v := os.Getenv("BIFROST_ADAPTIVE_MAX_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return time.Minute
+}
+
+// ProxyMaxBodyBytes returns the largest request body the proxy reads to
+// estimate its token cost. Reads BIFROST_PROXY_MAX_BODY_BYTES and defaults
+// to 10 MiB.
+func ProxyMaxBodyBytes() int64 {
+	if v := os.Getenv("BIFROST_PROXY_MAX_BODY_BYTES"); v != "" {
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 10 << 20
+}
+
+// UsageBufferSize returns how many usage events may be queued for writing.
+// Reads BIFROST_USAGE_BUFFER_SIZE and defaults to 1000.
+func UsageBufferSize() int {
+	if v := os.Getenv("BIFROST_USAGE_BUFFER_SIZE"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 1000
+}
+
+// UsageBatchSize returns the most usage events written in one insert.
+// Reads BIFROST_USAGE_BATCH_SIZE and defaults to 100.
+func UsageBatchSize() int {
+	if v := os.Getenv("BIFROST_USAGE_BATCH_SIZE"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 100
+}
+
+// UsageFlushInterval returns the longest a queued usage event waits before
+// it is written. Reads BIFROST_USAGE_FLUSH_INTERVAL and defaults to 1s.
+func UsageFlushInterval() time.Duration {
+	if v := os.Getenv("BIFROST_USAGE_FLUSH_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return time.Second
+}
+
+// ShutdownTimeout returns how long a graceful shutdown may take to drain
+// in-flight requests and buffered usage events. Reads
+// BIFROST_SHUTDOWN_TIMEOUT and defaults to 30s.
+func ShutdownTimeout() time.Duration {
+	if v := os.Getenv("BIFROST_SHUTDOWN_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 30 * time.Second
+}
+
+// UsageRetentionInterval returns how often the retention job prunes old usage
+// events. Reads BIFROST_USAGE_RETENTION_INTERVAL and defaults to 1h.
+func UsageRetentionInterval() time.Duration {
+	if v := os.Getenv("BIFROST_USAGE_RETENTION_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return time.Hour
+}
+
+// UsageRollupRetentionDays returns the number of days hourly and daily usage
+// rollups are retained. Reads BIFROST_USAGE_ROLLUP_RETENTION_DAYS and
+// defaults to 400.
+func UsageRollupRetentionDays() int {
+	if v := os.Getenv("BIFROST_USAGE_ROLLUP_RETENTION_DAYS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 400
+}
+
+// UsageRollupDelay returns how long after an hour ends its usage events are
+// rolled up. Reads BIFROST_USAGE_ROLLUP_DELAY and defaults to 5m.
+func UsageRollupDelay() time.Duration {
+	if v := os.Getenv("BIFROST_USAGE_ROLLUP_DELAY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return 5 * time.Minute
+}
+
+// UsagePartitionInterval returns the range of new usage_events partitions on
+// PostgreSQL: month (default) or day. Reads BIFROST_USAGE_PARTITION_INTERVAL.
+func UsagePartitionInterval() string {
+	if v := strings.ToLower(os.Getenv("BIFROST_USAGE_PARTITION_INTERVAL")); v == "day" {
+		return v
+	}
+	return "month"
+}
+
+// UsagePartitionsAhead returns how many usage_events partitions are created
+// ahead of the current one. Reads BIFROST_USAGE_PARTITIONS_AHEAD and defaults
+// to 3.
+func UsagePartitionsAhead() int {
+	if v := os.Getenv("BIFROST_USAGE_PARTITIONS_AHEAD"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 3
+}
+
+// UsagePruneBatchSize returns how many usage events are deleted per
+// statement when pruning. Reads BIFROST_USAGE_PRUNE_BATCH_SIZE and defaults
+// to 5000.
+func UsagePruneBatchSize() int {
+	if v := os.Getenv("BIFROST_USAGE_PRUNE_BATCH_SIZE"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 5000
+}
+
+// LogSink returns where usage and audit logs are archived besides the
+// database: bucket (S3-compatible object storage), filesystem, or empty for
+// none. Reads BIFROST_LOG_SINK.
+func LogSink() string {
+	return strings.ToLower(os.Getenv("BIFROST_LOG_SINK"))
+}
+
+// UsageDBRetentionDays returns the number of days usage events are kept in
+// the database. While a log sink is configured it reads
+// BIFROST_USAGE_DB_RETENTION_DAYS, so the database can keep less than the
+// archive; otherwise, or when unset, it is UsageRetentionDays.
+func UsageDBRetentionDays() int {
+	if LogSink() != "" {
+		if v := os.Getenv("BIFROST_USAGE_DB_RETENTION_DAYS"); v != "" {
+			if i, err := strconv.Atoi(v); err == nil && i > 0 {
+				return i
+			}
+		}
+	}
+	return UsageRetentionDays()
+}
+
+// SinkDir returns the directory of the filesystem log sink. Reads
+// BIFROST_SINK_DIR and defaults to ./archive.
+func SinkDir() string {
+	if v := os.Getenv("BIFROST_SINK_DIR"); v != "" {
+		return v
+	}
+	return "./archive"
+}
+
+// SinkPrefix returns the prefix of archive object keys from
+// BIFROST_SINK_PREFIX.
+func SinkPrefix() string {
+	return os.Getenv("BIFROST_SINK_PREFIX")
+}
+
+// SinkS3Endpoint returns the base URL of the S3-compatible service from
+// BIFROST_SINK_S3_ENDPOINT. Empty means AWS S3.
+func SinkS3Endpoint() string {
+	return os.Getenv("BIFROST_SINK_S3_ENDPOINT")
+}
+
+// SinkS3Region returns the bucket region. Reads BIFROST_SINK_S3_REGION, then
+// AWS_REGION, and defaults to us-east-1.
+func SinkS3Region() string {
+	if v := os.Getenv("BIFROST_SINK_S3_REGION"); v != "" {
+		return v
+	}
+	if v := os.Getenv("AWS_REGION"); v != "" {
+		return v
+	}
+	return "us-east-1"
+}
+
+// SinkS3Bucket returns the archive bucket from BIFROST_SINK_S3_BUCKET.
+func SinkS3Bucket() string {
+	return os.Getenv("BIFROST_SINK_S3_BUCKET")
+}
+
+// SinkS3PathStyle reports whether the bucket is addressed in the URL path
+// rather than the host name, as MinIO needs. Reads BIFROST_SINK_S3_PATH_STYLE.
+func SinkS3PathStyle() bool {
+	b, _ := strconv.ParseBool(os.Getenv("BIFROST_SINK_S3_PATH_STYLE"))
+	return b
+}
+
+// SinkS3Credentials returns the access key ID, secret access key and
+// session token for the bucket. Reads BIFROST_SINK_S3_ACCESS_KEY_ID and
+// BIFROST_SINK_S3_SECRET_ACCESS_KEY, falling back to the standard
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+func SinkS3Credentials() (id, secret, token string) {
+	id = os.Getenv("BIFROST_SINK_S3_ACCESS_KEY_ID")
+	secret = os.Getenv("BIFROST_SINK_S3_SECRET_ACCESS_KEY")
+	if id == "" && secret == "" {
+		return os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")
+	}
+	return id, secret, ""
+}
+
+// SinkBatchSize returns the most records written to one archive object.
+// Reads BIFROST_SINK_BATCH_SIZE and defaults to 1000.
+func SinkBatchSize() int {
+	if v := os.Getenv("BIFROST_SINK_BATCH_SIZE"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 1000
+}
+
+// SinkFlushInterval returns the longest a record waits before its archive
+// object is written. Reads BIFROST_SINK_FLUSH_INTERVAL and defaults to 1m.
+func SinkFlushInterval() time.Duration {
+	if v := os.Getenv("BIFROST_SINK_FLUSH_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return time.Minute
+}
+
+// SinkMaxRetries returns how many times a failed archive write is retried
+// before its records are dropped. Reads BIFROST_SINK_MAX_RETRIES and
+// defaults to 5.
+func SinkMaxRetries() int {
+	if v := os.Getenv("BIFROST_SINK_MAX_RETRIES"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i >= 0 {
+			return i
+		}
+	}
+	return 5
+}
+
+// AnomalyDetection reports whether usage is watched for anomalies on virtual
+// keys. Enabled unless BIFROST_ANOMALY_DETECTION is set to a falsy value.
+func AnomalyDetection() bool {
+	switch os.Getenv("BIFROST_ANOMALY_DETECTION") {
+	case "0", "false", "FALSE", "False", "no", "NO":
+		return false
+	default:
+		return true
+	}
+}
+
+// AnomalyWindow returns the period the anomaly detector counts usage over.
+// Reads BIFROST_ANOMALY_WINDOW and defaults to 1m.
+func AnomalyWindow() time.Duration {
+	if v := os.Getenv("BIFROST_ANOMALY_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return time.Minute
+}
+
+// AnomalyWarmup returns how many windows with traffic a key needs before it
+// can be flagged. Reads BIFROST_ANOMALY_WARMUP and defaults to 10.
+func AnomalyWarmup() int {
+	if v := os.Getenv("BIFROST_ANOMALY_WARMUP"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 10
+}
+
+// AnomalyFactor returns how many times its baseline a key's window must
+// reach to be flagged as a spike. Reads BIFROST_ANOMALY_FACTOR and defaults
+// to 5.
+func AnomalyFactor() float64 {
+	if v := os.Getenv("BIFROST_ANOMALY_FACTOR"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 1 {
+			return f
+		}
+	}
+	return 5
+}
+
+// AnomalyMinRequests returns the fewest requests in a window that can be
+// flagged as a request or error spike. Reads BIFROST_ANOMALY_MIN_REQUESTS and
+// defaults to 20.
+func AnomalyMinRequests() int {
+	if v := os.Getenv("BIFROST_ANOMALY_MIN_REQUESTS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 20
+}
+
+// AnomalyMinTokens returns the fewest tokens in a window that can be flagged
+// as a token spike. Reads BIFROST_ANOMALY_MIN_TOKENS and defaults to 5000.
+func AnomalyMinTokens() int {
+	if v := os.Getenv("BIFROST_ANOMALY_MIN_TOKENS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 5000
+}
+
+// ReportInterval returns how often the report scheduler checks for ended
+// periods without a final report. Reads BIFROST_REPORT_INTERVAL and defaults
+// to 1h.
+func ReportInterval() time.Duration {
+	if v := os.Getenv("BIFROST_REPORT_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return time.Hour
+}
+
+// ReportDelay returns how long after a billing period ends its final reports
+// are generated. Reads BIFROST_REPORT_DELAY and defaults to 1h.
+func ReportDelay() time.Duration {
+	if v := os.Getenv("BIFROST_REPORT_DELAY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return time.Hour
+}
+
+// WebhookMaxAttempts returns how many times a webhook delivery is tried
+// before it is marked failed. Reads BIFROST_WEBHOOK_MAX_ATTEMPTS and
+// defaults to 4, the first attempt and 3 retries.
+func WebhookMaxAttempts() int {
+	if v := os.Getenv("BIFROST_WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 4
+}
+
+// WebhookBackoff returns the wait before the first retry of a webhook
+// delivery, doubling for each retry after it. Reads BIFROST_WEBHOOK_BACKOFF
+// and defaults to 10s.
+func WebhookBackoff() time.Duration {
+	if v := os.Getenv("BIFROST_WEBHOOK_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 10 * time.Second
+}
+
+// WebhookTimeout returns how long a webhook has to answer a delivery. Reads
+// BIFROST_WEBHOOK_TIMEOUT and defaults to 10s.
+func WebhookTimeout() time.Duration {
+	if v := os.Getenv("BIFROST_WEBHOOK_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 10 * time.Second
+}
+
+// WebhookRetentionDays returns the number of days webhook deliveries are
+// kept. Reads BIFROST_WEBHOOK_RETENTION_DAYS and defaults to 30.
+func WebhookRetentionDays() int {
+	if v := os.Getenv("BIFROST_WEBHOOK_RETENTION_DAYS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 30
+}
+
+// NotifyBudgetThresholds returns the shares of a key's token or cost budget,
+// in percent, at which it is notified. Reads BIFROST_NOTIFY_BUDGET_THRESHOLDS
+// (comma-separated) and defaults to 50, 80 and 100.
+func NotifyBudgetThresholds() []int {
+	var out []int
+	for _, p := range splitTrim(os.Getenv("BIFROST_NOTIFY_BUDGET_THRESHOLDS")) {
+		if i, err := strconv.Atoi(strings.TrimSuffix(p, "%")); err == nil && i > 0 {
+			out = append(out, i)
+		}
+	}
+	if len(out) == 0 {
+		return []int{50, 80, 100}
+	}
+	return out
+}
+
+// NotifyExpiryLeads returns how long before expiry keys are notified. Reads
+// BIFROST_NOTIFY_EXPIRY_LEADS (comma-separated durations) and defaults to
+// 24h.
+func NotifyExpiryLeads() []time.Duration {
+	var out []time.Duration
+	for _, p := range splitTrim(os.Getenv("BIFROST_NOTIFY_EXPIRY_LEADS")) {
+		if d, err := time.ParseDuration(p); err == nil && d > 0 {
+			out = append(out, d)
+		}
+	}
+	if len(out) == 0 {
+		return []time.Duration{24 * time.Hour}
+	}
+	return out
+}
+
+// NotifyInterval returns how often keys are checked for notifications and
+// expiry. Reads BIFROST_NOTIFY_INTERVAL and defaults to 1m.
+func NotifyInterval() time.Duration {
+	if v := os.Getenv("BIFROST_NOTIFY_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return time.Minute
+}
+
+// NotifyMaxAttempts returns how many times a notification is tried, once
+// per check, before it is marked failed. Reads BIFROST_NOTIFY_MAX_ATTEMPTS
+// and defaults to 5.
+func NotifyMaxAttempts() int {
+	if v := os.Getenv("BIFROST_NOTIFY_MAX_ATTEMPTS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 5
+}
+
+// NotifyWebhookURL returns the URL key notifications are posted to as JSON
+// from BIFROST_NOTIFY_WEBHOOK_URL. Empty disables the webhook notifier.
+func NotifyWebhookURL() string {
+	return os.Getenv("BIFROST_NOTIFY_WEBHOOK_URL")
+}
+
+// NotifyWebhookSecret returns the secret signing notification webhook
+// requests from BIFROST_NOTIFY_WEBHOOK_SECRET. Empty leaves them unsigned.
+func NotifyWebhookSecret() string {
+	return os.Getenv("BIFROST_NOTIFY_WEBHOOK_SECRET")
+}
+
+// NotifySlackURL returns the Slack-compatible incoming webhook key
+// notifications are posted to from BIFROST_NOTIFY_SLACK_URL. Empty disables
+// the Slack notifier.
+func NotifySlackURL() string {
+	return os.Getenv("BIFROST_NOTIFY_SLACK_URL")
+}
+
+// NotifySMTPAddr returns the host:port of the SMTP server key notifications
+// are emailed through from BIFROST_NOTIFY_SMTP_ADDR. Empty disables email.
+func NotifySMTPAddr() string {
+	return os.Getenv("BIFROST_NOTIFY_SMTP_ADDR")
+}
+
+// NotifySMTPFrom returns the sender of notification emails. Reads
+// BIFROST_NOTIFY_SMTP_FROM and defaults to bifrost@localhost.
+func NotifySMTPFrom() string {
+	if v := os.Getenv("BIFROST_NOTIFY_SMTP_FROM"); v != "" {
+		return v
+	}
+	return "bifrost@localhost"
+}
+
+// NotifySMTPTo returns the recipients of notification emails from
+// BIFROST_NOTIFY_SMTP_TO (comma-separated).
+func NotifySMTPTo() []string {
+	var out []string
+	for _, p := range splitTrim(os.Getenv("BIFROST_NOTIFY_SMTP_TO")) {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// NotifySMTPCredentials returns the username and password authenticating to
+// the SMTP server from BIFROST_NOTIFY_SMTP_USERNAME and
+// BIFROST_NOTIFY_SMTP_PASSWORD. An empty username skips authentication.
+func NotifySMTPCredentials() (username, password string) {
+	return os.Getenv("BIFROST_NOTIFY_SMTP_USERNAME"), os.Getenv("BIFROST_NOTIFY_SMTP_PASSWORD")
+}
+
+// EventOutbox reports whether domain events are written to the event_outbox
+// table before asynchronous subscribers see them, so they survive restarts.
+// Enabled via BIFROST_EVENT_OUTBOX=true; only used with a SQL database.
+func EventOutbox() bool {
+	switch os.Getenv("BIFROST_EVENT_OUTBOX") {
+	case "1", "true", "TRUE", "True", "yes", "YES":
+		return true
+	default:
+		return false
+	}
+}
+
+// AuditRetentionDays returns the number of days audit log entries are kept.
+// Reads BIFROST_AUDIT_RETENTION_DAYS and defaults to 365.
+func AuditRetentionDays() int {
+	if v := os.Getenv("BIFROST_AUDIT_RETENTION_DAYS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 365
+}
+
+// AuditSyslogAddr returns the host:port of the syslog server audit entries
+// are forwarded to from BIFROST_AUDIT_SYSLOG_ADDR. Empty disables syslog
+// forwarding.
+func AuditSyslogAddr() string {
+	return os.Getenv("BIFROST_AUDIT_SYSLOG_ADDR")
+}
+
+// AuditSyslogNetwork returns how audit entries reach the syslog server:
+// udp, tcp or tls. Reads BIFROST_AUDIT_SYSLOG_NETWORK and defaults to udp.
+func AuditSyslogNetwork() string {
+	if v := os.Getenv("BIFROST_AUDIT_SYSLOG_NETWORK"); v != "" {
+		return strings.ToLower(v)
+	}
+	return "udp"
+}
+
+// AuditSyslogFormat returns the format of syslog message bodies, json or
+// cef. Reads BIFROST_AUDIT_SYSLOG_FORMAT and defaults to json.
+func AuditSyslogFormat() string {
+	if v := os.Getenv("BIFROST_AUDIT_SYSLOG_FORMAT"); v != "" {
+		return strings.ToLower(v)
+	}
+	return "json"
+}
+
+// AuditSyslogCAFile returns the PEM file of CA certificates trusted for the
+// syslog server over TLS from BIFROST_AUDIT_SYSLOG_CA_FILE. Empty uses the
+// system roots.
+func AuditSyslogCAFile() string {
+	return os.Getenv("BIFROST_AUDIT_SYSLOG_CA_FILE")
+}
+
+// AuditHTTPURL returns the URL batches of audit entries are posted to from
+// BIFROST_AUDIT_HTTP_URL. Empty disables HTTP forwarding.
+func AuditHTTPURL() string {
+	return os.Getenv("BIFROST_AUDIT_HTTP_URL")
+}
+
+// AuditHTTPFormat returns the format of audit batches posted to
+// AuditHTTPURL: json, splunk or elastic. Reads BIFROST_AUDIT_HTTP_FORMAT and
+// defaults to json.
+func AuditHTTPFormat() string {
+	if v := os.Getenv("BIFROST_AUDIT_HTTP_FORMAT"); v != "" {
+		return strings.ToLower(v)
+	}
+	return "json"
+}
+
+// AuditHTTPAuthorization returns the Authorization header sent with audit
+// batches from BIFROST_AUDIT_HTTP_AUTHORIZATION, e.g. "Splunk <token>".
+func AuditHTTPAuthorization() string {
+	return os.Getenv("BIFROST_AUDIT_HTTP_AUTHORIZATION")
+}
+
+// AuditForwardBufferSize returns how many audit entries may wait for each
+// forwarder before new ones are dropped. Reads
+// BIFROST_AUDIT_FORWARD_BUFFER_SIZE and defaults to 10000.
+func AuditForwardBufferSize() int {
+	if v := os.Getenv("BIFROST_AUDIT_FORWARD_BUFFER_SIZE"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i > 0 {
+			return i
+		}
+	}
+	return 10000
+}
+
+// AuditForwardMaxRetries returns how many times a batch a forwarder failed
+// to send is retried before it is dropped. Reads
+// BIFROST_AUDIT_FORWARD_MAX_RETRIES and defaults to 5.
+func AuditForwardMaxRetries() int {
+	if v := os.Getenv("BIFROST_AUDIT_FORWARD_MAX_RETRIES"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil && i >= 0 {
+			return i
+		}
+	}
+	return 5
+}
@@ -77,6 +77,31 @@ const docTemplate = `{
                 }
             }
         },
+        "/healthz/ratelimit": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Rate limiter health",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/ratelimit.HealthStatus"
+                        }
+                    },
+                    "503": {
+                        "description": "backend unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/ratelimit.HealthStatus"
+                        }
+                    }
+                }
+            }
+        },
         "/mcp": {
             "post": {
                 "security": [
@@ -122,7 +147,7 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/keys": {
+        "/v1/anomalies": {
             "get": {
                 "security": [
                     {
@@ -132,23 +157,62 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
+                "description": "Anomalies flagged on virtual keys by the usage anomaly detector, newest first.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "virtual-keys"
+                    "anomalies"
+                ],
+                "summary": "List anomaly flags",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only flags of this virtual key",
+                        "name": "key",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only flags of this organization; must be the caller's",
+                        "name": "org",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "open (default), resolved or all",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum flags returned (default 100)",
+                        "name": "limit",
+                        "in": "query"
+                    }
                 ],
-                "summary": "List virtual keys",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/keys.VirtualKey"
+                                "$ref": "#/definitions/anomaly.Flag"
                             }
                         }
                     },
+                    "400": {
+                        "description": "invalid status or limit",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -156,7 +220,9 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
+            }
+        },
+        "/v1/anomalies/{id}/resolve": {
             "post": {
                 "security": [
                     {
@@ -166,48 +232,38 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Mark an anomaly flag as handled. If the flag suspended its key and the key is still suspended for that reason, the key is reinstated.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "virtual-keys"
+                    "anomalies"
                 ],
-                "summary": "Create virtual key",
+                "summary": "Resolve anomaly flag",
                 "parameters": [
                     {
-                        "description": "Virtual key to create",
-                        "name": "body",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/keys.VirtualKey"
-                        }
+                        "type": "string",
+                        "description": "Flag ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/keys.VirtualKey"
+                            "$ref": "#/definitions/anomaly.Flag"
                         }
                     },
-                    "400": {
-                        "description": "invalid scope, rate_limit, or expires_at",
+                    "403": {
+                        "description": "missing permission",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
                     "404": {
-                        "description": "service not found",
-                        "schema": {
-                            "$ref": "#/definitions/routes.ErrorResponse"
-                        }
-                    },
-                    "409": {
-                        "description": "key already exists",
+                        "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
@@ -221,8 +277,8 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/keys/{id}": {
-            "delete": {
+        "/v1/audit": {
+            "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
@@ -231,25 +287,82 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
+                "description": "Management actions, newest first, with the fields each changed. Secrets are redacted. Entries are hash-chained: each hash covers the entry and the previous entry's hash.",
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "virtual-keys"
+                    "audit"
                 ],
-                "summary": "Revoke virtual key",
+                "summary": "List audit log",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Virtual key ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Only entries of this organization; must be the caller's",
+                        "name": "org",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries by this actor ID",
+                        "name": "actor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only this action, e.g. service.update",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries about this kind of target, e.g. service",
+                        "name": "target_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries about this target",
+                        "name": "target_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries at or after this time (RFC 3339)",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries before this time (RFC 3339)",
+                        "name": "until",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum entries returned (default 100, at most 1000)",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/audit.Entry"
+                            }
+                        }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "invalid since, until or limit",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
@@ -263,7 +376,7 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/keys/{id}/usage": {
+        "/v1/audit/export": {
             "get": {
                 "security": [
                     {
@@ -273,43 +386,63 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
+                "description": "Streams audit log entries, oldest first, as CSV, JSON lines or Parquet. Every format has the same columns in the same order; see the API documentation for the schema. Callers only receive entries of their own organization.",
                 "produces": [
-                    "application/json"
+                    "text/csv",
+                    "application/x-ndjson",
+                    "application/vnd.apache.parquet"
                 ],
                 "tags": [
-                    "virtual-keys"
+                    "audit"
                 ],
-                "summary": "List usage events for a virtual key",
+                "summary": "Export audit log",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Virtual key ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "csv (default), jsonl or parquet",
+                        "name": "format",
+                        "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "Start time (RFC3339)",
-                        "name": "from",
+                        "description": "Only entries of this organization; must be the caller's",
+                        "name": "org",
                         "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "End time (RFC3339)",
-                        "name": "to",
+                        "description": "Only entries by this actor ID",
+                        "name": "actor",
                         "in": "query"
                     },
                     {
-                        "type": "integer",
-                        "description": "Page number (default 1)",
-                        "name": "page",
+                        "type": "string",
+                        "description": "Only this action, e.g. service.update",
+                        "name": "action",
                         "in": "query"
                     },
                     {
-                        "type": "integer",
-                        "description": "Page size (default 20)",
-                        "name": "per_page",
+                        "type": "string",
+                        "description": "Only entries about this kind of target, e.g. service",
+                        "name": "target_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries about this target",
+                        "name": "target_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries at or after this time (RFC 3339)",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries before this time (RFC 3339)",
+                        "name": "until",
                         "in": "query"
                     }
                 ],
@@ -317,11 +450,17 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/routes.usageListResponse"
+                            "type": "file"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "invalid format, since or until",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
@@ -335,7 +474,7 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/orgs": {
+        "/v1/keys": {
             "get": {
                 "security": [
                     {
@@ -349,19 +488,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "organizations"
+                    "virtual-keys"
                 ],
-                "summary": "List organizations",
+                "summary": "List virtual keys",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/orgs.Organization"
+                                "$ref": "#/definitions/keys.VirtualKey"
                             }
                         }
                     },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -386,17 +531,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "organizations"
+                    "virtual-keys"
                 ],
-                "summary": "Create organization",
+                "summary": "Create virtual key",
                 "parameters": [
                     {
-                        "description": "Organization to create",
+                        "description": "Virtual key to create",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/orgs.Organization"
+                            "$ref": "#/definitions/keys.VirtualKey"
                         }
                     }
                 ],
@@ -404,17 +549,29 @@ const docTemplate = `{
                     "201": {
                         "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/orgs.Organization"
+                            "$ref": "#/definitions/keys.VirtualKey"
                         }
                     },
                     "400": {
-                        "description": "missing name",
+                        "description": "invalid scope, rate_limit, rate_limit_window, rate_limit_burst, tokens_per_minute, max_concurrent, token_budget, budget_usd, labels or expires_at",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "service not found",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
                     "409": {
-                        "description": "organization already exists",
+                        "description": "key already exists",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
@@ -428,8 +585,8 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/orgs/{id}": {
-            "get": {
+        "/v1/keys/{id}": {
+            "delete": {
                 "security": [
                     {
                         "ApiKeyAuth": []
@@ -438,27 +595,27 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
-                "produces": [
-                    "application/json"
-                ],
                 "tags": [
-                    "organizations"
+                    "virtual-keys"
                 ],
-                "summary": "Get organization",
+                "summary": "Revoke virtual key",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Organization ID",
+                        "description": "Virtual key ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "missing permission",
                         "schema": {
-                            "$ref": "#/definitions/orgs.Organization"
+                            "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
                     "404": {
@@ -474,8 +631,10 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
+            }
+        },
+        "/v1/keys/{id}/usage": {
+            "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
@@ -484,22 +643,58 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "organizations"
+                    "virtual-keys"
                 ],
-                "summary": "Delete organization",
+                "summary": "List usage events for a virtual key",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Organization ID",
+                        "description": "Virtual key ID",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start time (RFC3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End time (RFC3339)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number (default 1)",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 20)",
+                        "name": "per_page",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/routes.usageListResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
                     },
                     "404": {
                         "description": "Not Found",
@@ -516,7 +711,7 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/orgs/{id}/members": {
+        "/v1/orgs": {
             "get": {
                 "security": [
                     {
@@ -532,28 +727,19 @@ const docTemplate = `{
                 "tags": [
                     "organizations"
                 ],
-                "summary": "List organization members",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Organization ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    }
-                ],
+                "summary": "List organizations",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/orgs.Membership"
+                                "$ref": "#/definitions/orgs.Organization"
                             }
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "403": {
+                        "description": "missing permission",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
@@ -584,22 +770,15 @@ const docTemplate = `{
                 "tags": [
                     "organizations"
                 ],
-                "summary": "Add member to organization",
+                "summary": "Create organization",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Organization ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Membership to create",
+                        "description": "Organization to create",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/orgs.Membership"
+                            "$ref": "#/definitions/orgs.Organization"
                         }
                     }
                 ],
@@ -607,23 +786,23 @@ const docTemplate = `{
                     "201": {
                         "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/orgs.Membership"
+                            "$ref": "#/definitions/orgs.Organization"
                         }
                     },
                     "400": {
-                        "description": "missing user_id or invalid role",
+                        "description": "missing name",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "organization not found",
+                    "403": {
+                        "description": "missing permission",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
                     "409": {
-                        "description": "membership already exists",
+                        "description": "organization already exists",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
@@ -637,8 +816,8 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/orgs/{id}/members/{userID}": {
-            "delete": {
+        "/v1/orgs/{id}": {
+            "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
@@ -647,10 +826,13 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
                     "organizations"
                 ],
-                "summary": "Remove member from organization",
+                "summary": "Get organization",
                 "parameters": [
                     {
                         "type": "string",
@@ -658,18 +840,20 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "User ID",
-                        "name": "userID",
-                        "in": "path",
-                        "required": true
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/orgs.Organization"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
                     },
                     "404": {
                         "description": "Not Found",
@@ -684,10 +868,8 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/v1/rootkeys": {
-            "get": {
+            },
+            "delete": {
                 "security": [
                     {
                         "ApiKeyAuth": []
@@ -696,21 +878,33 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
-                "produces": [
-                    "application/json"
-                ],
                 "tags": [
-                    "root-keys"
+                    "organizations"
+                ],
+                "summary": "Delete organization",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "List root keys",
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/rootkeys.RootKey"
-                            }
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
                     "500": {
@@ -720,8 +914,10 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "post": {
+            }
+        },
+        "/v1/orgs/{id}/anomaly-policy": {
+            "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
@@ -730,42 +926,38 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "How the organization responds to anomalies on its keys. Without a policy, keys are only flagged.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "root-keys"
+                    "anomalies"
                 ],
-                "summary": "Create root key",
+                "summary": "Get anomaly policy",
                 "parameters": [
                     {
-                        "description": "Root key to create",
-                        "name": "body",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/rootkeys.RootKey"
-                        }
+                        "type": "string",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/rootkeys.RootKey"
+                            "$ref": "#/definitions/anomaly.Policy"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
-                    "409": {
-                        "description": "root key already exists",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
@@ -777,9 +969,7 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/v1/rootkeys/{id}": {
+            },
             "put": {
                 "security": [
                     {
@@ -789,6 +979,7 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
+                "description": "Replace the organization's anomaly policy. With auto_suspend, a flagged key is suspended at once; suspend_on limits this to some kinds of anomaly (request_spike, token_spike, error_spike, new_ip).",
                 "consumes": [
                     "application/json"
                 ],
@@ -796,24 +987,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "root-keys"
+                    "anomalies"
                 ],
-                "summary": "Update root key",
+                "summary": "Set anomaly policy",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Root key ID",
+                        "description": "Organization ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Updated root key",
+                        "description": "Policy",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/rootkeys.RootKey"
+                            "$ref": "#/definitions/anomaly.Policy"
                         }
                     }
                 ],
@@ -821,11 +1012,17 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/rootkeys.RootKey"
+                            "$ref": "#/definitions/anomaly.Policy"
                         }
                     },
                     "400": {
-                        "description": "invalid request or id mismatch",
+                        "description": "invalid suspend_on",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
@@ -843,8 +1040,10 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
+            }
+        },
+        "/v1/orgs/{id}/members": {
+            "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
@@ -853,22 +1052,37 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "root-keys"
+                    "organizations"
                 ],
-                "summary": "Delete root key",
+                "summary": "List organization members",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Root key ID",
+                        "description": "Organization ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/orgs.Membership"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
                     },
                     "404": {
                         "description": "Not Found",
@@ -883,10 +1097,16 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/v1/service-token": {
+            },
             "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "consumes": [
                     "application/json"
                 ],
@@ -894,54 +1114,54 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "service-accounts"
+                    "organizations"
                 ],
-                "summary": "Request a virtual key as a service account",
+                "summary": "Add member to organization",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Service account API key",
-                        "name": "X-Service-Key",
-                        "in": "header",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Token request",
+                        "description": "Membership to create",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/routes.servicetokenRequest"
+                            "$ref": "#/definitions/orgs.Membership"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/routes.servicetokenResponse"
+                            "$ref": "#/definitions/orgs.Membership"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "missing user_id or invalid role",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
-                    "401": {
-                        "description": "missing or invalid X-Service-Key",
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
-                    "403": {
-                        "description": "service not in allowed list",
+                    "404": {
+                        "description": "organization not found",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "service not found",
+                    "409": {
+                        "description": "membership already exists",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
@@ -955,8 +1175,8 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/serviceaccounts": {
-            "get": {
+        "/v1/orgs/{id}/members/{userID}": {
+            "delete": {
                 "security": [
                     {
                         "ApiKeyAuth": []
@@ -965,76 +1185,38 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
-                "produces": [
-                    "application/json"
-                ],
                 "tags": [
-                    "service-accounts"
+                    "organizations"
                 ],
-                "summary": "List service accounts",
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/serviceaccounts.ServiceAccount"
-                            }
-                        }
-                    },
-                    "500": {
-                        "description": "Internal Server Error",
-                        "schema": {
-                            "$ref": "#/definitions/routes.ErrorResponse"
-                        }
-                    }
-                }
-            },
-            "post": {
-                "security": [
+                "summary": "Remove member from organization",
+                "parameters": [
                     {
-                        "ApiKeyAuth": []
+                        "type": "string",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     },
                     {
-                        "BearerAuth": []
-                    }
-                ],
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "service-accounts"
-                ],
-                "summary": "Create service account",
-                "parameters": [
-                    {
-                        "description": "Service account to create",
-                        "name": "body",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/serviceaccounts.ServiceAccount"
-                        }
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
-                        "schema": {
-                            "$ref": "#/definitions/serviceaccounts.ServiceAccount"
-                        }
+                    "204": {
+                        "description": "No Content"
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
-                    "409": {
-                        "description": "service account already exists",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
@@ -1048,8 +1230,8 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/serviceaccounts/{id}": {
-            "delete": {
+        "/v1/orgs/{id}/reports/{period}": {
+            "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
@@ -1058,22 +1240,55 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
+                "description": "The organization's usage for a calendar month (UTC), totalled by service, model, key owner, key label and key, with costs from service token prices. Keys are charged to their owner, or their service account, or (unassigned).",
+                "produces": [
+                    "application/json",
+                    "text/csv"
+                ],
                 "tags": [
-                    "service-accounts"
+                    "reports"
                 ],
-                "summary": "Delete service account",
+                "summary": "Get chargeback report",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Service account ID",
+                        "description": "Organization ID",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Billing period (YYYY-MM)",
+                        "name": "period",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "json (default) or csv",
+                        "name": "format",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/reports.Report"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid period or format, or period not started",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
                     },
                     "404": {
                         "description": "Not Found",
@@ -1090,7 +1305,7 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/services": {
+        "/v1/orgs/{id}/webhooks": {
             "get": {
                 "security": [
                     {
@@ -1100,23 +1315,45 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
+                "description": "The organization's webhooks. Secrets are not returned.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "services"
+                    "webhooks"
+                ],
+                "summary": "List webhooks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "List services",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/services.Service"
+                                "$ref": "#/definitions/webhooks.Webhook"
                             }
                         }
                     },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -1134,6 +1371,7 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
+                "description": "Subscribe a URL to events of the organization's keys: key.created, key.revoked, key.expired, key.rate_limited, key.budget_exceeded and key.used. Deliveries are signed with the returned secret; it is not shown again.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1141,17 +1379,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "services"
+                    "webhooks"
                 ],
-                "summary": "Create service",
+                "summary": "Create webhook",
                 "parameters": [
                     {
-                        "description": "Service to create",
+                        "type": "string",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Webhook",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/services.Service"
+                            "$ref": "#/definitions/routes.webhookRequest"
                         }
                     }
                 ],
@@ -1159,23 +1404,23 @@ const docTemplate = `{
                     "201": {
                         "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/services.Service"
+                            "$ref": "#/definitions/webhooks.Webhook"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "invalid url or events",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "root key not found",
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
-                    "409": {
-                        "description": "service already exists",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
@@ -1189,8 +1434,8 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/services/{id}": {
-            "put": {
+        "/v1/orgs/{id}/webhooks/{webhookID}": {
+            "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
@@ -1199,49 +1444,44 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
-                "consumes": [
-                    "application/json"
-                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "services"
+                    "webhooks"
                 ],
-                "summary": "Update service",
+                "summary": "Get webhook",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Service ID",
+                        "description": "Organization ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Updated service",
-                        "name": "body",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/services.Service"
-                        }
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "webhookID",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/services.Service"
+                            "$ref": "#/definitions/webhooks.Webhook"
                         }
                     },
-                    "400": {
-                        "description": "invalid request or id mismatch",
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
                     "404": {
-                        "description": "service or root key not found",
+                        "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
@@ -1254,7 +1494,7 @@ const docTemplate = `{
                     }
                 }
             },
-            "delete": {
+            "put": {
                 "security": [
                     {
                         "ApiKeyAuth": []
@@ -1263,83 +1503,1484 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
+                "description": "Replace the webhook's URL, events and active flag. The secret is kept unless a new one is given, in which case it is returned.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "services"
+                    "webhooks"
                 ],
-                "summary": "Delete service",
+                "summary": "Update webhook",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Service ID",
+                        "description": "Organization ID",
                         "name": "id",
                         "in": "path",
                         "required": true
-                    }
-                ],
-                "responses": {
-                    "204": {
-                        "description": "No Content"
                     },
-                    "404": {
-                        "description": "Not Found",
-                        "schema": {
-                            "$ref": "#/definitions/routes.ErrorResponse"
-                        }
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "webhookID",
+                        "in": "path",
+                        "required": true
                     },
-                    "500": {
-                        "description": "Internal Server Error",
-                        "schema": {
-                            "$ref": "#/definitions/routes.ErrorResponse"
-                        }
-                    }
-                }
-            }
-        },
-        "/v1/setup": {
-            "post": {
-                "description": "Creates the first admin user and organization. Returns 409 if the system is already initialized. No authentication required.",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "setup"
-                ],
-                "summary": "Bootstrap Bifrost",
-                "parameters": [
                     {
-                        "description": "Bootstrap request",
+                        "description": "Webhook",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/routes.SetupRequest"
+                            "$ref": "#/definitions/routes.webhookRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/routes.SetupResponse"
+                            "$ref": "#/definitions/webhooks.Webhook"
                         }
                     },
                     "400": {
-                        "description": "missing required fields",
+                        "description": "invalid url or events",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
-                    "409": {
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Delete webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "webhookID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/orgs/{id}/webhooks/{webhookID}/deliveries": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deliveries to the webhook, newest first, with their payload, attempts and last response. Deliveries are kept for BIFROST_WEBHOOK_RETENTION_DAYS.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "webhookID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "pending, delivered or failed",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum deliveries returned (default 100)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/webhooks.Delivery"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid status or limit",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/orgs/{id}/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Send the delivery's event again, as a new delivery with its own attempts. The original delivery is left as it is.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Redeliver webhook event",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Organization ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "webhookID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Delivery ID",
+                        "name": "deliveryID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/webhooks.Delivery"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "webhook delivery disabled",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/quotas": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "quotas"
+                ],
+                "summary": "List quotas",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/routes.quotaStatus"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Attach a request or token limit to an org, service or service account. Quotas are enforced together with each key's own rate limit; the most restrictive wins. Org-scoped callers can only attach quotas to their own org and its services and service accounts.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "quotas"
+                ],
+                "summary": "Create quota",
+                "parameters": [
+                    {
+                        "description": "Quota to create",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/quotas.Quota"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/quotas.Quota"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid scope, scope_id, service, metric, period or limit",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "service or service account not found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "quota already exists",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/quotas/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "quotas"
+                ],
+                "summary": "Get quota",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Quota ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/routes.quotaStatus"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "tags": [
+                    "quotas"
+                ],
+                "summary": "Delete quota",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Quota ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/rootkeys": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "root-keys"
+                ],
+                "summary": "List root keys",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/rootkeys.RootKey"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "root-keys"
+                ],
+                "summary": "Create root key",
+                "parameters": [
+                    {
+                        "description": "Root key to create",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/rootkeys.RootKey"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/rootkeys.RootKey"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "root key already exists",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/rootkeys/{id}": {
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "root-keys"
+                ],
+                "summary": "Update root key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Root key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updated root key",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/rootkeys.RootKey"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/rootkeys.RootKey"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid request or id mismatch",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "tags": [
+                    "root-keys"
+                ],
+                "summary": "Delete root key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Root key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/service-token": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-accounts"
+                ],
+                "summary": "Request a virtual key as a service account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Service account API key",
+                        "name": "X-Service-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Token request",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/routes.servicetokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/routes.servicetokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "missing or invalid X-Service-Key",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "service not in allowed list",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "service not found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/serviceaccounts": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-accounts"
+                ],
+                "summary": "List service accounts",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/serviceaccounts.ServiceAccount"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-accounts"
+                ],
+                "summary": "Create service account",
+                "parameters": [
+                    {
+                        "description": "Service account to create",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/serviceaccounts.ServiceAccount"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/serviceaccounts.ServiceAccount"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "service account already exists",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/serviceaccounts/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "tags": [
+                    "service-accounts"
+                ],
+                "summary": "Delete service account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Service account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/services": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "services"
+                ],
+                "summary": "List services",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/services.Service"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "services"
+                ],
+                "summary": "Create service",
+                "parameters": [
+                    {
+                        "description": "Service to create",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/services.Service"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/services.Service"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid request, tokens_per_minute, max_concurrent, or token price",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "root key not found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "service already exists",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/services/{id}": {
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "services"
+                ],
+                "summary": "Update service",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Service ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updated service",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/services.Service"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/services.Service"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid request, id mismatch, tokens_per_minute, max_concurrent, or token price",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "service or root key not found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "tags": [
+                    "services"
+                ],
+                "summary": "Delete service",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Service ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/services/{id}/adaptive": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "services"
+                ],
+                "summary": "Get adaptive limiting state",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Service ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/ratelimit.AdaptiveState"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "not found",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/setup": {
+            "post": {
+                "description": "Creates the first admin user and organization. Returns 409 if the system is already initialized. No authentication required.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "setup"
+                ],
+                "summary": "Bootstrap Bifrost",
+                "parameters": [
+                    {
+                        "description": "Bootstrap request",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/routes.SetupRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/routes.SetupResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "missing required fields",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "409": {
                         "description": "already initialized",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/token/refresh": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Accepts a valid bearer token and returns a new one. An optional JSON body may specify a \"ttl\" field (e.g. \"1h\"); falls back to BIFROST_TOKEN_TTL or 24h.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Refresh bearer token",
+                "parameters": [
+                    {
+                        "description": "Optional TTL override: {\\",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "New token: {\\\"token\\\":\\\"...\\\"}",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid ttl",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "invalid or expired token",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/usage/export": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Streams usage events, oldest first, as CSV, JSON lines or Parquet. Every format has the same columns in the same order; see the API documentation for the schema. Callers only receive events of their own organization.",
+                "produces": [
+                    "text/csv",
+                    "application/x-ndjson",
+                    "application/vnd.apache.parquet"
+                ],
+                "tags": [
+                    "usage"
+                ],
+                "summary": "Export usage events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "csv (default), jsonl or parquet",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start time (RFC3339, inclusive)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End time (RFC3339, exclusive)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only events of this organization; must be the caller's",
+                        "name": "org",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only events of this service",
+                        "name": "service",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid format, from or to",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/usage/stream": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Server-Sent Events stream of usage events as they are recorded. Each \"usage\" event carries one usage event as JSON; a \"dropped\" event reports how many events were skipped because the client fell behind. Callers only receive events of their own organization.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "usage"
+                ],
+                "summary": "Stream usage events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only events of this virtual key",
+                        "name": "key",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only events of this organization; must be the caller's",
+                        "name": "org",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only events of this service",
+                        "name": "service",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only this status code (429) or class (5xx)",
+                        "name": "status",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/usage.Event"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid status",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "usage stream unavailable",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
@@ -1347,49 +2988,83 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/token/refresh": {
-            "post": {
+        "/v1/usage/summary": {
+            "get": {
                 "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Accepts a valid bearer token and returns a new one. An optional JSON body may specify a \"ttl\" field (e.g. \"1h\"); falls back to BIFROST_TOKEN_TTL or 24h.",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Groups usage events by any of org, service, key, source, model, status_class and time, returning request counts, error rates, latency percentiles and token and cost sums. Setting bucket groups by time. Callers only see events of their own organization.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "usage"
                 ],
-                "summary": "Refresh bearer token",
+                "summary": "Summarise usage",
                 "parameters": [
                     {
-                        "description": "Optional TTL override: {\\",
-                        "name": "body",
-                        "in": "body",
-                        "schema": {
-                            "type": "object"
-                        }
+                        "type": "string",
+                        "description": "Comma-separated dimensions: org, service, key, source, model, status_class, time",
+                        "name": "group_by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Time bucket: hour, day or month",
+                        "name": "bucket",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start time (RFC3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End time (RFC3339)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only events of this organization; must be the caller's",
+                        "name": "org_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only events of this service",
+                        "name": "service",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only events of this virtual key",
+                        "name": "key_id",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "New token: {\\\"token\\\":\\\"...\\\"}",
+                        "description": "OK",
                         "schema": {
-                            "type": "object"
+                            "$ref": "#/definitions/routes.usageSummaryResponse"
                         }
                     },
                     "400": {
-                        "description": "invalid ttl",
+                        "description": "invalid group_by, bucket, from or to",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
-                    "401": {
-                        "description": "invalid or expired token",
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
                         "schema": {
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
@@ -1487,6 +3162,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/routes.ErrorResponse"
                         }
                     },
+                    "403": {
+                        "description": "missing permission, or org is not the caller's",
+                        "schema": {
+                            "$ref": "#/definitions/routes.ErrorResponse"
+                        }
+                    },
                     "404": {
                         "description": "organization not found",
                         "schema": {
@@ -1532,66 +3213,413 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "anomaly.Flag": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "description": "Action is flagged, or suspended when the org policy suspended the key.",
+                    "type": "string"
+                },
+                "baseline": {
+                    "description": "Baseline is the key's usual value for the same measure.",
+                    "type": "number"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "key_id": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "observed": {
+                    "description": "Observed is the value that tripped the detector in the current window:\nrequests, tokens or error ratio. Zero for new_ip.",
+                    "type": "number"
+                },
+                "org_id": {
+                    "type": "string"
+                },
+                "resolved_at": {
+                    "type": "string"
+                },
+                "window_start": {
+                    "description": "WindowStart is the start of the detection window the anomaly fell in.",
+                    "type": "string"
+                }
+            }
+        },
+        "anomaly.Policy": {
+            "type": "object",
+            "properties": {
+                "auto_suspend": {
+                    "description": "AutoSuspend suspends a key as soon as it is flagged.",
+                    "type": "boolean"
+                },
+                "org_id": {
+                    "type": "string"
+                },
+                "suspend_on": {
+                    "description": "SuspendOn limits auto-suspension to these kinds. Empty means every\nkind.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "audit.Change": {
+            "type": "object",
+            "properties": {
+                "after": {},
+                "before": {}
+            }
+        },
+        "audit.Entry": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "description": "Action names what was done, e.g. \"service.update\".",
+                    "type": "string",
+                    "example": "service.update"
+                },
+                "actor_id": {
+                    "type": "string"
+                },
+                "actor_type": {
+                    "description": "ActorType is user, service_account or mcp.",
+                    "type": "string",
+                    "example": "user"
+                },
+                "changes": {
+                    "description": "Changes holds the fields that changed, with secrets redacted.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/audit.Change"
+                    }
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "org_id": {
+                    "type": "string"
+                },
+                "prev_hash": {
+                    "description": "PrevHash is the Hash of the previous entry; empty for the first.",
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "seq": {
+                    "description": "Seq orders entries in the chain, starting at 1.",
+                    "type": "integer"
+                },
+                "source_ip": {
+                    "type": "string"
+                },
+                "target_id": {
+                    "type": "string"
+                },
+                "target_type": {
+                    "type": "string",
+                    "example": "service"
+                }
+            }
+        },
         "keys.VirtualKey": {
             "type": "object",
             "properties": {
+                "budget_usd": {
+                    "description": "BudgetUSD caps the key's spend, priced from its service's token\nprices; the proxy refuses requests once it is spent. Zero means\nunlimited.",
+                    "type": "number"
+                },
                 "expires_at": {
                     "type": "string"
                 },
                 "id": {
                     "type": "string"
                 },
+                "labels": {
+                    "description": "Labels are free-form attributes such as team or cost center, used to\nbreak down chargeback reports.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "max_concurrent": {
+                    "description": "MaxConcurrent caps the number of requests in flight at once. Zero\nmeans unlimited.",
+                    "type": "integer"
+                },
                 "one_shot": {
                     "type": "boolean"
                 },
-                "rate_limit": {
+                "org_id": {
+                    "description": "OrgID is the organization that owns the key. The proxy only forwards\nit to services owned by the same organization.",
+                    "type": "string"
+                },
+                "owner": {
+                    "description": "Owner is who the key's usage is charged to: the user who created it,\nor whoever it was issued for.",
+                    "type": "string"
+                },
+                "rate_limit": {
+                    "type": "integer"
+                },
+                "rate_limit_burst": {
+                    "description": "RateLimitBurst is the token bucket capacity. Zero means RateLimit.",
+                    "type": "integer"
+                },
+                "rate_limit_window": {
+                    "description": "RateLimitWindow is the period RateLimit applies to: second, minute\n(default), hour or day.",
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "service_account_id": {
+                    "description": "ServiceAccountID is the service account that minted the key via\nPOST /v1/service-token, if any.",
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "suspended": {
+                    "description": "Suspended keys are refused by the proxy until reinstated, e.g. after\nthe anomaly detector quarantined them.",
+                    "type": "boolean"
+                },
+                "suspended_reason": {
+                    "description": "SuspendedReason says why the key was suspended.",
+                    "type": "string"
+                },
+                "target": {
+                    "type": "string"
+                },
+                "token_budget": {
+                    "type": "integer"
+                },
+                "tokens_per_minute": {
+                    "description": "TokensPerMinute caps LLM tokens (prompt + completion) per minute.\nZero means unlimited.",
+                    "type": "integer"
+                },
+                "used": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "orgs.Membership": {
+            "type": "object",
+            "properties": {
+                "org_id": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "orgs.Organization": {
+            "type": "object",
+            "properties": {
+                "domain": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "quotas.Quota": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "limit": {
+                    "type": "integer"
+                },
+                "metric": {
+                    "type": "string"
+                },
+                "period": {
+                    "type": "string"
+                },
+                "scope": {
+                    "description": "Scope is the level the quota is attached to: org, service or service_account.",
+                    "type": "string"
+                },
+                "scope_id": {
+                    "description": "ScopeID is the ID of the org, service or service account.",
+                    "type": "string"
+                },
+                "service": {
+                    "description": "Service optionally narrows an org or service account quota to traffic\nfor one service.",
+                    "type": "string"
+                }
+            }
+        },
+        "ratelimit.AdaptiveState": {
+            "type": "object",
+            "properties": {
+                "admission": {
+                    "description": "Admission is the fraction of requests currently forwarded, from 0.05\nup to 1.",
+                    "type": "number",
+                    "example": 0.5
+                },
+                "blocked_until": {
+                    "description": "BlockedUntil is set while every request is rejected locally, e.g.\nuntil an upstream Retry-After elapses.",
+                    "type": "string"
+                },
+                "remaining_requests": {
+                    "description": "RemainingRequests and RemainingTokens are the last values reported in\nthe upstream's x-ratelimit-remaining-* headers.",
+                    "type": "integer"
+                },
+                "remaining_tokens": {
                     "type": "integer"
                 },
-                "scope": {
-                    "type": "string"
+                "root_key_id": {
+                    "type": "string",
+                    "example": "rk-openai"
                 },
-                "source": {
-                    "type": "string"
+                "service": {
+                    "type": "string",
+                    "example": "openai"
                 },
-                "target": {
+                "updated_at": {
                     "type": "string"
                 },
-                "token_budget": {
+                "upstream_throttled": {
+                    "description": "Throttled counts upstream 429s since admission was last fully restored.",
                     "type": "integer"
-                },
-                "used": {
-                    "type": "boolean"
                 }
             }
         },
-        "orgs.Membership": {
+        "ratelimit.HealthStatus": {
             "type": "object",
             "properties": {
-                "org_id": {
-                    "type": "string"
+                "backend": {
+                    "type": "string",
+                    "example": "redis"
                 },
-                "role": {
+                "degraded": {
+                    "type": "boolean"
+                },
+                "degraded_since": {
+                    "description": "DegradedSince is when the backend started failing.",
                     "type": "string"
                 },
-                "user_id": {
+                "last_error": {
                     "type": "string"
+                },
+                "policy": {
+                    "description": "Policy is the failure policy applied while Degraded.",
+                    "type": "string",
+                    "example": "local"
                 }
             }
         },
-        "orgs.Organization": {
+        "reports.Line": {
             "type": "object",
             "properties": {
-                "domain": {
+                "completion_tokens": {
+                    "type": "integer"
+                },
+                "cost_usd": {
+                    "type": "number",
+                    "example": 12.5
+                },
+                "name": {
+                    "type": "string",
+                    "example": "openai"
+                },
+                "prompt_tokens": {
+                    "type": "integer"
+                },
+                "requests": {
+                    "type": "integer",
+                    "example": 1200
+                },
+                "total_tokens": {
+                    "type": "integer"
+                }
+            }
+        },
+        "reports.Report": {
+            "type": "object",
+            "properties": {
+                "final": {
+                    "description": "Final is set once the period had ended when the report was generated.",
+                    "type": "boolean"
+                },
+                "from": {
                     "type": "string"
                 },
-                "email": {
+                "generated_at": {
                     "type": "string"
                 },
-                "id": {
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/reports.Line"
+                    }
+                },
+                "labels": {
+                    "description": "Labels are named name=value, e.g. team=search.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/reports.Line"
+                    }
+                },
+                "models": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/reports.Line"
+                    }
+                },
+                "org_id": {
                     "type": "string"
                 },
-                "name": {
+                "owners": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/reports.Line"
+                    }
+                },
+                "period": {
+                    "type": "string",
+                    "example": "2025-03"
+                },
+                "services": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/reports.Line"
+                    }
+                },
+                "to": {
                     "type": "string"
+                },
+                "total": {
+                    "$ref": "#/definitions/reports.Line"
                 }
             }
         },
@@ -1606,6 +3634,10 @@ const docTemplate = `{
                 },
                 "key_hint": {
                     "type": "string"
+                },
+                "org_id": {
+                    "description": "OrgID is the organization that owns the credential.",
+                    "type": "string"
                 }
             }
         },
@@ -1746,6 +3778,47 @@ const docTemplate = `{
                 "result": {}
             }
         },
+        "routes.quotaStatus": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "limit": {
+                    "type": "integer"
+                },
+                "metric": {
+                    "type": "string"
+                },
+                "period": {
+                    "type": "string"
+                },
+                "remaining": {
+                    "description": "Remaining is how much can be consumed right now.",
+                    "type": "integer"
+                },
+                "reset_seconds": {
+                    "description": "ResetSeconds is how long until the quota is fully available again.",
+                    "type": "integer"
+                },
+                "scope": {
+                    "description": "Scope is the level the quota is attached to: org, service or service_account.",
+                    "type": "string"
+                },
+                "scope_id": {
+                    "description": "ScopeID is the ID of the org, service or service account.",
+                    "type": "string"
+                },
+                "service": {
+                    "description": "Service optionally narrows an org or service account quota to traffic\nfor one service.",
+                    "type": "string"
+                },
+                "used": {
+                    "description": "Used is how much of the limit has been consumed over the last period.",
+                    "type": "integer"
+                }
+            }
+        },
         "routes.servicetokenRequest": {
             "type": "object",
             "properties": {
@@ -1785,6 +3858,53 @@ const docTemplate = `{
                 }
             }
         },
+        "routes.usageSummaryResponse": {
+            "type": "object",
+            "properties": {
+                "bucket": {
+                    "type": "string"
+                },
+                "group_by": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "rows": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/usage.SummaryRow"
+                    }
+                }
+            }
+        },
+        "routes.webhookRequest": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "description": "Active defaults to true.",
+                    "type": "boolean"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "key.created",
+                        "key.rate_limited"
+                    ]
+                },
+                "secret": {
+                    "description": "Secret replaces the signing secret. A new webhook without one gets a\nrandom secret.",
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://hooks.example.com/bifrost"
+                }
+            }
+        },
         "serviceaccounts.ServiceAccount": {
             "type": "object",
             "properties": {
@@ -1802,12 +3922,18 @@ const docTemplate = `{
                 },
                 "name": {
                     "type": "string"
+                },
+                "org_id": {
+                    "type": "string"
                 }
             }
         },
         "services.Service": {
             "type": "object",
             "properties": {
+                "completion_token_price": {
+                    "type": "number"
+                },
                 "credential_header": {
                     "type": "string"
                 },
@@ -1817,17 +3943,44 @@ const docTemplate = `{
                 "id": {
                     "type": "string"
                 },
+                "max_concurrent": {
+                    "description": "MaxConcurrent caps the requests in flight to the service across every\nkey. Zero means unlimited.",
+                    "type": "integer"
+                },
+                "org_id": {
+                    "description": "OrgID is the organization that owns the service. Only its keys may\nreach it, and its root key must belong to the same organization.",
+                    "type": "string"
+                },
+                "prompt_token_price": {
+                    "description": "PromptTokenPrice and CompletionTokenPrice are the upstream's prices in\nUSD per million tokens, used to cost usage events.",
+                    "type": "number"
+                },
                 "root_key_id": {
                     "type": "string"
+                },
+                "tokens_per_minute": {
+                    "description": "TokensPerMinute caps LLM tokens per minute across every key targeting\nthe service. Zero means unlimited.",
+                    "type": "integer"
                 }
             }
         },
         "usage.Event": {
             "type": "object",
             "properties": {
+                "category": {
+                    "description": "Category classifies failed and rejected requests; it is empty on\nsuccess.",
+                    "type": "string"
+                },
+                "client_ip": {
+                    "type": "string"
+                },
                 "completion_tokens": {
                     "type": "integer"
                 },
+                "cost_usd": {
+                    "description": "CostUSD is priced from the service's per-token prices.",
+                    "type": "number"
+                },
                 "id": {
                     "type": "integer"
                 },
@@ -1837,12 +3990,32 @@ const docTemplate = `{
                 "latency_ms": {
                     "type": "integer"
                 },
+                "model": {
+                    "description": "Model is the model reported by the upstream, or else the one named in\nthe request, when known.",
+                    "type": "string"
+                },
+                "org_id": {
+                    "type": "string"
+                },
                 "prompt_tokens": {
                     "type": "integer"
                 },
+                "request_bytes": {
+                    "type": "integer"
+                },
+                "request_id": {
+                    "description": "RequestID is the X-Request-Id assigned by the router.",
+                    "type": "string"
+                },
+                "response_bytes": {
+                    "type": "integer"
+                },
                 "service": {
                     "type": "string"
                 },
+                "source": {
+                    "type": "string"
+                },
                 "status_code": {
                     "type": "integer"
                 },
@@ -1851,6 +4024,152 @@ const docTemplate = `{
                 },
                 "total_tokens": {
                     "type": "integer"
+                },
+                "ttfb_ms": {
+                    "description": "TTFBMS is the time until the upstream's response headers arrived.",
+                    "type": "integer"
+                },
+                "upstream_endpoint": {
+                    "description": "UpstreamEndpoint is the upstream URL without its query string. It is\nempty for requests rejected before forwarding.",
+                    "type": "string"
+                },
+                "user_agent": {
+                    "type": "string"
+                }
+            }
+        },
+        "usage.SummaryRow": {
+            "type": "object",
+            "properties": {
+                "completion_tokens": {
+                    "type": "integer"
+                },
+                "cost_usd": {
+                    "type": "number"
+                },
+                "error_rate": {
+                    "type": "number",
+                    "example": 0.025
+                },
+                "errors": {
+                    "description": "Errors counts responses with status 400 or above.",
+                    "type": "integer",
+                    "example": 3
+                },
+                "group": {
+                    "description": "Group maps each grouping dimension to its value. Time buckets are\ngiven as the RFC 3339 UTC start of the bucket.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "latency_p50_ms": {
+                    "description": "Latency percentiles are estimated from a fixed histogram, so they are\naccurate to within one histogram bucket.",
+                    "type": "number",
+                    "example": 180
+                },
+                "latency_p90_ms": {
+                    "type": "number",
+                    "example": 420
+                },
+                "latency_p99_ms": {
+                    "type": "number",
+                    "example": 950
+                },
+                "prompt_tokens": {
+                    "type": "integer"
+                },
+                "requests": {
+                    "type": "integer",
+                    "example": 120
+                },
+                "total_tokens": {
+                    "type": "integer"
+                }
+            }
+        },
+        "webhooks.Delivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "description": "Attempts is how many times delivery was tried.",
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "delivered_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Error describes why the last attempt failed.",
+                    "type": "string"
+                },
+                "event": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "org_id": {
+                    "type": "string"
+                },
+                "payload": {
+                    "description": "Payload is the JSON body sent to the webhook.",
+                    "type": "string"
+                },
+                "redelivery_of": {
+                    "description": "RedeliveryOf is the delivery this one repeats, if it was redelivered.",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Status is pending until the webhook accepts the delivery or it runs\nout of attempts.",
+                    "type": "string"
+                },
+                "status_code": {
+                    "description": "StatusCode is the webhook's response to the last attempt, if any.",
+                    "type": "integer"
+                },
+                "webhook_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "webhooks.Webhook": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "events": {
+                    "description": "Events are the event types delivered to URL.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "org_id": {
+                    "type": "string"
+                },
+                "secret": {
+                    "description": "Secret signs deliveries. It is only returned when the webhook is\ncreated or its secret replaced.",
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://hooks.example.com/bifrost"
                 }
             }
         }
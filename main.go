@@ -2,23 +2,40 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"flag"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	_ "github.com/farovictor/bifrost/docs/swagger"
 	"github.com/farovictor/bifrost/config"
 	rl "github.com/farovictor/bifrost/middlewares"
+	"github.com/farovictor/bifrost/pkg/anomaly"
+	"github.com/farovictor/bifrost/pkg/audit"
 	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/events"
 	"github.com/farovictor/bifrost/pkg/keys"
 	"github.com/farovictor/bifrost/pkg/logging"
 	"github.com/farovictor/bifrost/pkg/metrics"
 	"github.com/farovictor/bifrost/pkg/orgs"
+	"github.com/farovictor/bifrost/pkg/notify"
+	"github.com/farovictor/bifrost/pkg/quotas"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+	"github.com/farovictor/bifrost/pkg/reports"
 	"github.com/farovictor/bifrost/pkg/rootkeys"
 	"github.com/farovictor/bifrost/pkg/serviceaccounts"
 	"github.com/farovictor/bifrost/pkg/services"
+	"github.com/farovictor/bifrost/pkg/sink"
 	"github.com/farovictor/bifrost/pkg/usage"
 	"github.com/farovictor/bifrost/pkg/users"
+	"github.com/farovictor/bifrost/pkg/webhooks"
 	routes "github.com/farovictor/bifrost/routes"
 	v1 "github.com/farovictor/bifrost/routes/v1"
 	"github.com/go-chi/chi/v5"
@@ -68,11 +85,34 @@ func main() {
 			&services.Service{},
 			&orgs.Organization{},
 			&orgs.Membership{},
-			&usage.Event{},
 			&serviceaccounts.ServiceAccount{},
+			&quotas.Quota{},
+			&anomaly.Flag{},
+			&anomaly.Policy{},
+			&webhooks.Webhook{},
+			&webhooks.Delivery{},
+			&notify.Notification{},
+			&events.OutboxEntry{},
+			&audit.Entry{},
+			&audit.Anchor{},
 		); err != nil {
 			logging.Logger.Fatal().Err(err).Msg("auto migrate")
 		}
+		if err := usage.Migrate(db); err != nil {
+			logging.Logger.Fatal().Err(err).Msg("auto migrate usage")
+		}
+		if err := reports.Migrate(db); err != nil {
+			logging.Logger.Fatal().Err(err).Msg("auto migrate reports")
+		}
+		n, err := orgs.AssignUnowned(db, config.DefaultOrg())
+		switch {
+		case err == orgs.ErrNoDefaultOrg:
+			logging.Logger.Warn().Err(err).Msg("assign default org")
+		case err != nil:
+			logging.Logger.Fatal().Err(err).Msg("assign default org")
+		case n > 0:
+			logging.Logger.Info().Int64("rows", n).Msg("assigned unowned rows to default org")
+		}
 		logging.Logger.Info().Msg("migrations complete")
 		return
 	}
@@ -91,6 +131,20 @@ func main() {
 	}
 
 	var srv *routes.Server
+	// pruneLock coordinates usage retention between instances sharing a
+	// database; only Postgres deployments can have more than one.
+	var pruneLock database.Locker = &database.LocalLock{}
+	// reportLock does the same for the report scheduler.
+	var reportLock database.Locker = &database.LocalLock{}
+	// notifyLock and notifyStore back the key notification checker.
+	var notifyLock database.Locker = &database.LocalLock{}
+	var notifyStore notify.Store = notify.NewMemoryStore()
+	// auditLock coordinates audit log retention.
+	var auditLock database.Locker = &database.LocalLock{}
+	// outbox persists domain events when enabled on a SQL database.
+	var outbox *events.Outbox
+	// partitions manages usage_events partitions on Postgres.
+	var partitions *usage.Partitions
 
 	switch dbType {
 	case "sqlite", "postgres":
@@ -104,6 +158,11 @@ func main() {
 				MembershipStore:     orgs.NewMemoryMembershipStore(),
 				UsageStore:          usage.NewMemoryStore(),
 				ServiceAccountStore: serviceaccounts.NewMemoryStore(),
+				QuotaStore:          quotas.NewMemoryStore(),
+				AnomalyStore:        anomaly.NewMemoryStore(),
+				ReportStore:         reports.NewMemoryStore(),
+				WebhookStore:        webhooks.NewMemoryStore(),
+				AuditStore:          audit.NewMemoryStore(),
 			}
 			logging.Logger.Info().Msg("In-Memory Store set")
 		} else {
@@ -111,6 +170,18 @@ func main() {
 			if err != nil {
 				logging.Logger.Fatal().Err(err).Msg("connect " + dbType)
 			}
+			if dbType == "postgres" {
+				pruneLock = database.NewAdvisoryLock(db, usage.RetentionLockKey)
+				reportLock = database.NewAdvisoryLock(db, reports.LockKey)
+				notifyLock = database.NewAdvisoryLock(db, notify.LockKey)
+				auditLock = database.NewAdvisoryLock(db, audit.LockKey)
+				partitions = usage.NewPartitions(db, config.UsagePartitionInterval(), config.UsagePartitionsAhead())
+				// Make sure current events have a partition before serving;
+				// the retention worker keeps creating them afterwards.
+				if _, err := partitions.Ensure(time.Now()); err != nil {
+					logging.Logger.Error().Err(err).Msg("create usage partitions")
+				}
+			}
 			srv = &routes.Server{
 				UserStore:           users.NewSQLStore(db),
 				KeyStore:            keys.NewSQLStore(db),
@@ -120,6 +191,15 @@ func main() {
 				MembershipStore:     orgs.NewSQLMembershipStore(db),
 				UsageStore:          usage.NewSQLStore(db),
 				ServiceAccountStore: serviceaccounts.NewSQLStore(db),
+				QuotaStore:          quotas.NewSQLStore(db),
+				AnomalyStore:        anomaly.NewSQLStore(db),
+				ReportStore:         reports.NewSQLStore(db),
+				WebhookStore:        webhooks.NewSQLStore(db),
+				AuditStore:          audit.NewSQLStore(db),
+			}
+			notifyStore = notify.NewSQLStore(db)
+			if config.EventOutbox() {
+				outbox = events.NewOutbox(db)
 			}
 			logging.Logger.Info().Str("db", dbType).Msg("Store set")
 		}
@@ -133,15 +213,187 @@ func main() {
 			MembershipStore:     orgs.NewMemoryMembershipStore(),
 			UsageStore:          usage.NewMemoryStore(),
 			ServiceAccountStore: serviceaccounts.NewMemoryStore(),
+			QuotaStore:          quotas.NewMemoryStore(),
+			AnomalyStore:        anomaly.NewMemoryStore(),
+			ReportStore:         reports.NewMemoryStore(),
+			WebhookStore:        webhooks.NewMemoryStore(),
+			AuditStore:          audit.NewMemoryStore(),
 		}
 		logging.Logger.Info().Msg("In-Memory Store set")
 	}
 
+	rlb, err := rl.NewRateLimitBackend()
+	if err != nil {
+		logging.Logger.Fatal().Err(err).Msg("rate limit backend")
+	}
+	srv.Limiter = rlb.Limiter
+	srv.RateLimitHealthCheck = rlb.Health
+	if config.AdaptiveLimiting() {
+		srv.Adaptive = ratelimit.NewAdaptive(config.AdaptiveMaxBackoff())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	retention := &usage.Retention{
+		Store:     srv.UsageStore,
+		Lock:      pruneLock,
+		Days:      config.UsageDBRetentionDays(),
+		BatchSize: config.UsagePruneBatchSize(),
+		Interval:  config.UsageRetentionInterval(),
+		// Rollups outlive raw events so summaries and budgets reach further
+		// back.
+		RollupDays:  config.UsageRollupRetentionDays(),
+		RollupDelay: config.UsageRollupDelay(),
+		Partitions:  partitions,
+	}
+	go retention.Run(ctx)
+
+	scheduler := &reports.Scheduler{
+		Usage:    srv.UsageStore,
+		Keys:     srv.KeyStore,
+		Orgs:     srv.OrgStore,
+		Store:    srv.ReportStore,
+		Lock:     reportLock,
+		Interval: config.ReportInterval(),
+		Delay:    config.ReportDelay(),
+	}
+	go scheduler.Run(ctx)
+
+	// With a log sink, recorded usage is also archived to object storage or
+	// the filesystem.
+	archiver, err := newLogArchiver()
+	if err != nil {
+		logging.Logger.Fatal().Err(err).Msg("log sink")
+	}
+	var usageSink usage.Store = srv.UsageStore
+	if archiver != nil {
+		usageSink = &usage.ArchivingStore{Store: srv.UsageStore, Archive: archiver}
+		srv.AuditStore = &audit.ArchivingStore{Store: srv.AuditStore, Archive: archiver}
+	}
+
+	// Audit entries are also forwarded to syslog and SIEM endpoints through
+	// buffers, so an unreachable forwarder never holds up requests.
+	auditForwarders, err := newAuditForwarders()
+	if err != nil {
+		logging.Logger.Fatal().Err(err).Msg("audit forwarders")
+	}
+	auditRetries := config.AuditForwardMaxRetries()
+	if auditRetries == 0 {
+		auditRetries = -1
+	}
+	var auditQueues []*audit.Queue
+	for _, f := range auditForwarders {
+		auditQueues = append(auditQueues, audit.NewQueue(f, audit.QueueOptions{
+			BufferSize: config.AuditForwardBufferSize(),
+			MaxRetries: auditRetries,
+		}))
+	}
+	if len(auditQueues) > 0 {
+		srv.AuditStore = &audit.ForwardingStore{Store: srv.AuditStore, Queues: auditQueues}
+	}
+
+	auditRetention := &audit.Retention{
+		Store:    srv.AuditStore,
+		Lock:     auditLock,
+		Days:     config.AuditRetentionDays(),
+		Interval: 24 * time.Hour,
+	}
+	go auditRetention.Run(ctx)
+
+	// The proxy records usage through a buffered recorder so database
+	// writes stay off the request path.
+	recorder := usage.NewRecorder(usageSink, usage.RecorderOptions{
+		BufferSize:    config.UsageBufferSize(),
+		BatchSize:     config.UsageBatchSize(),
+		FlushInterval: config.UsageFlushInterval(),
+	})
+
+	// Recorded events are also published to live usage streams, on every
+	// instance when rate limits are shared through Redis.
+	srv.UsageStream = usage.NewBroadcaster()
+	var publisher usage.Publisher = srv.UsageStream
+	if rlb.Client != nil {
+		relay := usage.NewRedisRelay(rlb.Client, srv.UsageStream)
+		go relay.Run(ctx)
+		publisher = relay
+	}
+	tail := &usage.PublishingStore{Store: recorder, Publisher: publisher}
+
+	// The anomaly detector watches the same stream, so with Redis every
+	// instance keeps baselines of all traffic; flags are raised only once.
+	if config.AnomalyDetection() {
+		detector := anomaly.NewDetector(srv.AnomalyStore, srv.KeyStore, anomaly.DetectorOptions{
+			Window:      config.AnomalyWindow(),
+			Warmup:      config.AnomalyWarmup(),
+			Factor:      config.AnomalyFactor(),
+			MinRequests: config.AnomalyMinRequests(),
+			MinTokens:   config.AnomalyMinTokens(),
+		})
+		events := srv.UsageStream.Subscribe(usage.StreamFilter{}, config.UsageBufferSize())
+		go detector.Run(ctx, events.C)
+	}
+
+	// Webhook deliveries are queued in the store and sent by whichever
+	// instance claims them. Events raised from usage are deduplicated, so
+	// every instance can watch the relayed stream.
+	srv.Webhooks = webhooks.NewDispatcher(srv.WebhookStore, webhooks.DispatcherOptions{
+		Client:      &http.Client{Timeout: config.WebhookTimeout()},
+		MaxAttempts: config.WebhookMaxAttempts(),
+		Backoff:     config.WebhookBackoff(),
+		Retention:   time.Duration(config.WebhookRetentionDays()) * 24 * time.Hour,
+	})
+	go srv.Webhooks.Run(ctx)
+
+	// Stores publish domain events in the transaction making the change.
+	// With the outbox each reaches asynchronous subscribers once, relayed
+	// by one instance; broadcast subscribers see it on every instance when
+	// Redis is shared.
+	busOpts := events.Options{Outbox: outbox}
+	if rlb.Client != nil {
+		busOpts.Fanout = events.NewRedisFanout(rlb.Client)
+	}
+	srv.Events = events.New(busOpts)
+	srv.AttachEvents()
+	srv.Webhooks.Subscribe(srv.Events)
+	if srv.AuditStore != nil {
+		audit.Subscribe(srv.Events, srv.AuditStore)
+	}
+	if srv.Adaptive != nil {
+		srv.Adaptive.Subscribe(srv.Events)
+	}
+	go srv.Events.Run(ctx)
+
+	// Keys are checked for budget thresholds and nearing expiry, which are
+	// sent through the configured notifiers, and for expiry, which is
+	// published as a key.expired event.
+	events.Attach(srv.Events, notifyStore)
+	checker := &notify.Checker{
+		Keys:        srv.KeyStore,
+		Usage:       srv.UsageStore,
+		Store:       notifyStore,
+		Notifiers:   newNotifiers(),
+		Lock:        notifyLock,
+		Thresholds:  config.NotifyBudgetThresholds(),
+		ExpiryLeads: config.NotifyExpiryLeads(),
+		MaxAttempts: config.NotifyMaxAttempts(),
+		Interval:    config.NotifyInterval(),
+	}
+	go checker.Run(ctx)
+
+	webhookEvents := srv.UsageStream.Subscribe(usage.StreamFilter{}, config.UsageBufferSize())
+	go srv.Webhooks.Watch(ctx, webhookEvents.C)
+
 	v1h := &v1.Handler{
 		KeyStore:     srv.KeyStore,
 		ServiceStore: srv.ServiceStore,
 		RootKeyStore: srv.RootKeyStore,
-		UsageStore:   srv.UsageStore,
+		UsageStore:   tail,
+		QuotaStore:   srv.QuotaStore,
+		Limiter:      srv.Limiter,
+		Concurrency:  rlb.Concurrency,
+		Adaptive:     srv.Adaptive,
+		MaxBodyBytes: config.ProxyMaxBodyBytes(),
 	}
 
 	if config.MetricsEnabled() {
@@ -151,9 +403,17 @@ func main() {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   config.CORSAllowedOrigins(),
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-API-Key"},
+		AllowedOrigins: config.CORSAllowedOrigins(),
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-API-Key"},
+		ExposedHeaders: []string{
+			ratelimit.HeaderLimit,
+			ratelimit.HeaderRemaining,
+			ratelimit.HeaderReset,
+			ratelimit.HeaderRetryAfter,
+			ratelimit.HeaderTokenBudget,
+			ratelimit.HeaderTokenBudgetRemaining,
+		},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
@@ -162,6 +422,7 @@ func main() {
 	r.Use(middleware.Recoverer)
 
 	r.Get("/healthz", routes.Healthz)
+	r.Get("/healthz/ratelimit", srv.RateLimitHealth)
 	r.Get("/version", routes.Version)
 	r.Get("/docs/openapi.json", routes.OpenAPISpec)
 	r.Get("/docs/openapi.yaml", routes.OpenAPISpecYAML)
@@ -174,16 +435,16 @@ func main() {
 		r.Post("/setup", srv.Setup)
 
 		// Endpoints that only require the auth token
-		r.With(rl.OrgCtxMiddleware(srv.MembershipStore)).Post("/users", srv.CreateUser)
+		r.With(rl.OrgCtxMiddleware(srv.MembershipStore), rl.RequirePermission(orgs.PermMembersWrite)).Post("/users", srv.CreateUser)
 		r.With(rl.OrgCtxMiddleware(srv.MembershipStore)).Get("/user", srv.GetUserInfo)
-		r.With(rl.OrgCtxMiddleware(srv.MembershipStore)).Post("/user/rootkeys", srv.CreateRootKey)
+		r.With(rl.OrgCtxMiddleware(srv.MembershipStore), rl.RequirePermission(orgs.PermRootKeysWrite)).Post("/user/rootkeys", srv.CreateRootKey)
 		r.Post("/token/refresh", srv.RefreshToken)
 
 		// Service-account token endpoint — authenticated by X-Service-Key, no user session required
 		r.Post("/service-token", srv.ServiceToken)
 
 		// Proxy - authenticated by the virtual key; no API key or token required
-		r.With(rl.RateLimitMiddleware(srv.KeyStore)).Handle("/proxy/*", http.HandlerFunc(v1h.Proxy))
+		r.With(rl.RateLimitMiddleware(srv.Limiter, srv.KeyStore, srv.QuotaStore, tail)).Handle("/proxy/*", http.HandlerFunc(v1h.Proxy))
 
 		// Endpoints requiring API key and auth token
 		r.Group(func(r chi.Router) {
@@ -192,34 +453,57 @@ func main() {
 
 			r.Get("/hello", v1.SayHello)
 
-			r.Get("/keys", srv.ListKeys)
-			r.Post("/keys", srv.CreateKey)
-			r.Delete("/keys/{id}", srv.DeleteKey)
-			r.Get("/keys/{id}/usage", srv.ListKeyUsage)
-
-			r.Get("/rootkeys", srv.ListRootKeys)
-			r.Post("/rootkeys", srv.CreateRootKey)
-			r.Put("/rootkeys/{id}", srv.UpdateRootKey)
-			r.Delete("/rootkeys/{id}", srv.DeleteRootKey)
-
-			r.Get("/services", srv.ListServices)
-			r.Post("/services", srv.CreateService)
-			r.Put("/services/{id}", srv.UpdateService)
-			r.Delete("/services/{id}", srv.DeleteService)
-
-			r.Get("/serviceaccounts", srv.ListServiceAccounts)
-			r.Post("/serviceaccounts", srv.CreateServiceAccount)
-			r.Delete("/serviceaccounts/{id}", srv.DeleteServiceAccount)
-
-			r.Get("/orgs", srv.ListOrgs)
-			r.Post("/orgs", srv.CreateOrg)
-			r.Get("/orgs/{id}", srv.GetOrg)
-			r.Delete("/orgs/{id}", srv.DeleteOrg)
-			r.Get("/orgs/{id}/members", srv.ListOrgMembers)
-			r.Post("/orgs/{id}/members", srv.AddOrgMember)
-			r.Delete("/orgs/{id}/members/{userID}", srv.RemoveOrgMember)
-
-			r.With(rl.RateLimitMiddleware(srv.KeyStore)).Post("/rate", v1.SayHello)
+			r.With(rl.RequirePermission(orgs.PermKeysRead)).Get("/keys", srv.ListKeys)
+			r.With(rl.RequirePermission(orgs.PermKeysWrite)).Post("/keys", srv.CreateKey)
+			r.With(rl.RequirePermission(orgs.PermKeysWrite)).Delete("/keys/{id}", srv.DeleteKey)
+			r.With(rl.RequirePermission(orgs.PermUsageRead)).Get("/keys/{id}/usage", srv.ListKeyUsage)
+			r.With(rl.RequirePermission(orgs.PermUsageRead)).Get("/usage/summary", srv.GetUsageSummary)
+			r.With(rl.RequirePermission(orgs.PermUsageRead)).Get("/usage/export", srv.ExportUsage)
+			r.With(rl.RequirePermission(orgs.PermUsageRead)).Get("/usage/stream", srv.StreamUsage)
+			r.With(rl.RequirePermission(orgs.PermAnomaliesRead)).Get("/anomalies", srv.ListAnomalies)
+			r.With(rl.RequirePermission(orgs.PermAnomaliesWrite)).Post("/anomalies/{id}/resolve", srv.ResolveAnomaly)
+			r.With(rl.RequirePermission(orgs.PermAuditRead)).Get("/audit", srv.ListAudit)
+			r.With(rl.RequirePermission(orgs.PermAuditRead)).Get("/audit/export", srv.ExportAudit)
+
+			r.With(rl.RequirePermission(orgs.PermRootKeysRead)).Get("/rootkeys", srv.ListRootKeys)
+			r.With(rl.RequirePermission(orgs.PermRootKeysWrite)).Post("/rootkeys", srv.CreateRootKey)
+			r.With(rl.RequirePermission(orgs.PermRootKeysWrite)).Put("/rootkeys/{id}", srv.UpdateRootKey)
+			r.With(rl.RequirePermission(orgs.PermRootKeysWrite)).Delete("/rootkeys/{id}", srv.DeleteRootKey)
+
+			r.With(rl.RequirePermission(orgs.PermServicesRead)).Get("/services", srv.ListServices)
+			r.With(rl.RequirePermission(orgs.PermServicesWrite)).Post("/services", srv.CreateService)
+			r.With(rl.RequirePermission(orgs.PermServicesWrite)).Put("/services/{id}", srv.UpdateService)
+			r.With(rl.RequirePermission(orgs.PermServicesWrite)).Delete("/services/{id}", srv.DeleteService)
+			r.With(rl.RequirePermission(orgs.PermServicesRead)).Get("/services/{id}/adaptive", srv.GetServiceAdaptive)
+
+			r.With(rl.RequirePermission(orgs.PermQuotasRead)).Get("/quotas", srv.ListQuotas)
+			r.With(rl.RequirePermission(orgs.PermQuotasWrite)).Post("/quotas", srv.CreateQuota)
+			r.With(rl.RequirePermission(orgs.PermQuotasRead)).Get("/quotas/{id}", srv.GetQuota)
+			r.With(rl.RequirePermission(orgs.PermQuotasWrite)).Delete("/quotas/{id}", srv.DeleteQuota)
+
+			r.With(rl.RequirePermission(orgs.PermServiceAccountsRead)).Get("/serviceaccounts", srv.ListServiceAccounts)
+			r.With(rl.RequirePermission(orgs.PermServiceAccountsWrite)).Post("/serviceaccounts", srv.CreateServiceAccount)
+			r.With(rl.RequirePermission(orgs.PermServiceAccountsWrite)).Delete("/serviceaccounts/{id}", srv.DeleteServiceAccount)
+
+			r.With(rl.RequirePermission(orgs.PermOrgsRead)).Get("/orgs", srv.ListOrgs)
+			r.With(rl.RequirePermission(orgs.PermOrgsWrite)).Post("/orgs", srv.CreateOrg)
+			r.With(rl.RequirePermission(orgs.PermOrgsRead)).Get("/orgs/{id}", srv.GetOrg)
+			r.With(rl.RequirePermission(orgs.PermAnomaliesRead)).Get("/orgs/{id}/anomaly-policy", srv.GetAnomalyPolicy)
+			r.With(rl.RequirePermission(orgs.PermAnomaliesWrite)).Put("/orgs/{id}/anomaly-policy", srv.PutAnomalyPolicy)
+			r.With(rl.RequirePermission(orgs.PermUsageRead)).Get("/orgs/{id}/reports/{period}", srv.GetOrgReport)
+			r.With(rl.RequirePermission(orgs.PermWebhooksRead)).Get("/orgs/{id}/webhooks", srv.ListWebhooks)
+			r.With(rl.RequirePermission(orgs.PermWebhooksWrite)).Post("/orgs/{id}/webhooks", srv.CreateWebhook)
+			r.With(rl.RequirePermission(orgs.PermWebhooksRead)).Get("/orgs/{id}/webhooks/{webhookID}", srv.GetWebhook)
+			r.With(rl.RequirePermission(orgs.PermWebhooksWrite)).Put("/orgs/{id}/webhooks/{webhookID}", srv.UpdateWebhook)
+			r.With(rl.RequirePermission(orgs.PermWebhooksWrite)).Delete("/orgs/{id}/webhooks/{webhookID}", srv.DeleteWebhook)
+			r.With(rl.RequirePermission(orgs.PermWebhooksRead)).Get("/orgs/{id}/webhooks/{webhookID}/deliveries", srv.ListWebhookDeliveries)
+			r.With(rl.RequirePermission(orgs.PermWebhooksWrite)).Post("/orgs/{id}/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", srv.RedeliverWebhook)
+			r.With(rl.RequirePermission(orgs.PermOrgsDelete)).Delete("/orgs/{id}", srv.DeleteOrg)
+			r.With(rl.RequirePermission(orgs.PermMembersRead)).Get("/orgs/{id}/members", srv.ListOrgMembers)
+			r.With(rl.RequirePermission(orgs.PermMembersWrite)).Post("/orgs/{id}/members", srv.AddOrgMember)
+			r.With(rl.RequirePermission(orgs.PermMembersWrite)).Delete("/orgs/{id}/members/{userID}", srv.RemoveOrgMember)
+
+			r.With(rl.RateLimitMiddleware(srv.Limiter, srv.KeyStore, srv.QuotaStore, nil)).Post("/rate", v1.SayHello)
 		})
 	})
 
@@ -229,9 +513,135 @@ func main() {
 
 	logging.Logger.Info().Msg("Initializing Server ...")
 
-	if err := http.ListenAndServe(config.ServerPort(), r); err != nil {
-		logging.Logger.Fatal().Err(err).Msg("listen and serve")
+	httpSrv := &http.Server{Addr: config.ServerPort(), Handler: r}
+	go func() {
+		if err := httpSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Logger.Fatal().Err(err).Msg("listen and serve")
+		}
+	}()
+
+	<-ctx.Done()
+	logging.Logger.Info().Msg("Shutting down ...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout())
+	defer cancel()
+	if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+		logging.Logger.Error().Err(err).Msg("shutdown http server")
+	}
+	// Requests are drained, so no more domain or usage events will be
+	// queued.
+	srv.Events.Flush(shutdownCtx)
+	if err := recorder.Close(shutdownCtx); err != nil {
+		logging.Logger.Error().Err(err).Msg("flush usage events")
+	}
+	if archiver != nil {
+		if err := archiver.Close(shutdownCtx); err != nil {
+			logging.Logger.Error().Err(err).Msg("flush log sink")
+		}
+	}
+	for _, q := range auditQueues {
+		if err := q.Close(shutdownCtx); err != nil {
+			logging.Logger.Error().Err(err).Msg("flush audit forwarder")
+		}
+	}
+}
+
+// newLogArchiver builds the archiver of BIFROST_LOG_SINK, or returns nil
+// when no log sink is configured.
+func newLogArchiver() (*sink.Archiver, error) {
+	var s sink.Sink
+	switch kind := config.LogSink(); kind {
+	case "":
+		return nil, nil
+	case "bucket":
+		id, secret, token := config.SinkS3Credentials()
+		s3, err := sink.NewS3(sink.S3Config{
+			Endpoint:        config.SinkS3Endpoint(),
+			Region:          config.SinkS3Region(),
+			Bucket:          config.SinkS3Bucket(),
+			PathStyle:       config.SinkS3PathStyle(),
+			AccessKeyID:     id,
+			SecretAccessKey: secret,
+			SessionToken:    token,
+		})
+		if err != nil {
+			return nil, err
+		}
+		s = s3
+	case "filesystem":
+		s = sink.NewFilesystem(config.SinkDir())
+	default:
+		return nil, fmt.Errorf("unknown log sink %q", kind)
+	}
+	retries := config.SinkMaxRetries()
+	if retries == 0 {
+		retries = -1
+	}
+	return sink.NewArchiver(s, sink.ArchiverOptions{
+		Prefix:        config.SinkPrefix(),
+		BatchSize:     config.SinkBatchSize(),
+		FlushInterval: config.SinkFlushInterval(),
+		MaxRetries:    retries,
+	}), nil
+}
+
+// newAuditForwarders returns the audit forwarders configured through the
+// environment.
+func newAuditForwarders() ([]audit.Forwarder, error) {
+	var out []audit.Forwarder
+	if addr := config.AuditSyslogAddr(); addr != "" {
+		s := &audit.Syslog{Network: config.AuditSyslogNetwork(), Addr: addr, Format: config.AuditSyslogFormat()}
+		switch s.Network {
+		case "udp", "tcp", "tls":
+		default:
+			return nil, fmt.Errorf("unknown syslog network %q", s.Network)
+		}
+		if s.Format != audit.FormatJSON && s.Format != audit.FormatCEF {
+			return nil, fmt.Errorf("unknown syslog format %q", s.Format)
+		}
+		if file := config.AuditSyslogCAFile(); file != "" {
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in %s", file)
+			}
+			host, _, _ := net.SplitHostPort(addr)
+			s.TLSConfig = &tls.Config{RootCAs: roots, ServerName: host}
+		}
+		out = append(out, s)
+	}
+	if url := config.AuditHTTPURL(); url != "" {
+		h := &audit.HTTP{URL: url, Format: config.AuditHTTPFormat(), Authorization: config.AuditHTTPAuthorization()}
+		switch h.Format {
+		case audit.FormatJSON, audit.FormatSplunk, audit.FormatElastic:
+		default:
+			return nil, fmt.Errorf("unknown audit HTTP format %q", h.Format)
+		}
+		out = append(out, h)
+	}
+	return out, nil
+}
+
+// newNotifiers returns the key notifiers configured through the environment.
+func newNotifiers() []notify.Notifier {
+	var out []notify.Notifier
+	if url := config.NotifyWebhookURL(); url != "" {
+		out = append(out, &notify.Webhook{URL: url, Secret: config.NotifyWebhookSecret()})
+	}
+	if url := config.NotifySlackURL(); url != "" {
+		out = append(out, &notify.Slack{URL: url})
+	}
+	if addr := config.NotifySMTPAddr(); addr != "" {
+		if to := config.NotifySMTPTo(); len(to) > 0 {
+			user, pass := config.NotifySMTPCredentials()
+			out = append(out, &notify.SMTP{Addr: addr, From: config.NotifySMTPFrom(), To: to, Username: user, Password: pass})
+		} else {
+			logging.Logger.Warn().Msg("BIFROST_NOTIFY_SMTP_TO not set — email notifications disabled")
+		}
 	}
+	return out
 }
 
 func apiVersionCtx(version string) func(next http.Handler) http.Handler {
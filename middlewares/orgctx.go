@@ -20,6 +20,20 @@ type OrgContext struct {
 	Role   string
 }
 
+// AllOrgs reports whether the requester sees every organization rather than
+// one: a verified user whose token names no org and who owns or administers
+// the empty org, like a single-tenant admin, or in test or sqlite modes the
+// static API key with a token that failed verification.
+func (oc OrgContext) AllOrgs() bool {
+	if oc.OrgID != "" {
+		return false
+	}
+	if oc.UserID == "" {
+		return config.Mode() == "test" || config.DBType() == "sqlite"
+	}
+	return oc.Role == orgs.RoleOwner || oc.Role == orgs.RoleAdmin
+}
+
 // OrgFromContext extracts organization context from ctx.
 func OrgFromContext(ctx context.Context) OrgContext {
 	v, _ := ctx.Value(orgCtxKey{}).(OrgContext)
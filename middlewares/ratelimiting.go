@@ -3,51 +3,141 @@ package middlewares
 import (
 	"fmt"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/farovictor/bifrost/config"
 	"github.com/farovictor/bifrost/pkg/keys"
-	redis "github.com/redis/go-redis/v9"
+	"github.com/farovictor/bifrost/pkg/quotas"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+	"github.com/farovictor/bifrost/pkg/usage"
+	"github.com/redis/go-redis/v9"
 )
 
-// Redis connector to manage rate limiting using configuration values.
-var rdb = redis.NewClient(&redis.Options{
-	Addr:     config.RedisAddr(),
-	Password: config.RedisPassword(),
-	DB:       config.RedisDB(),
-	Protocol: config.RedisProtocol(),
-})
+// RateLimitBackend bundles the limiter, concurrency gate and health report
+// built from the configured rate limiting backend.
+type RateLimitBackend struct {
+	Limiter     ratelimit.Limiter
+	Concurrency *ratelimit.Concurrency
+	Health      *ratelimit.Health
+	// Client is the Redis client of the redis backend, shared with other
+	// cross-instance features. It is nil for the memory backend.
+	Client redis.UniversalClient
+}
+
+// NewRateLimitBackend builds the rate limiting backend from configuration:
+// in-process state when BIFROST_RATELIMIT_BACKEND is memory, otherwise a
+// single, Sentinel or Cluster Redis deployment guarded by the configured
+// failure policy.
+func NewRateLimitBackend() (*RateLimitBackend, error) {
+	queue, wait := config.ConcurrencyQueueSize(), config.ConcurrencyMaxWait()
 
-type localCounter struct {
-	mu   sync.Mutex
-	data map[string]struct {
-		count int
-		ts    time.Time
+	switch backend := config.RateLimitBackend(); backend {
+	case "memory":
+		return &RateLimitBackend{
+			Limiter:     ratelimit.NewLocal(),
+			Concurrency: ratelimit.NewConcurrency(ratelimit.NewLocalSemaphore(), queue, wait, 0),
+			Health:      ratelimit.NewHealth(backend, ""),
+		}, nil
+	case "redis":
+		// Configured below.
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", backend)
+	}
+
+	policy := config.RateLimitFailurePolicy()
+	if !ratelimit.ValidatePolicy(policy) {
+		return nil, fmt.Errorf("unknown rate limit failure policy %q", policy)
+	}
+	client, err := ratelimit.NewRedisClient(ratelimit.RedisOptions{
+		Mode:             config.RedisMode(),
+		Addrs:            config.RedisAddrs(),
+		MasterName:       config.RedisMasterName(),
+		Password:         config.RedisPassword(),
+		SentinelPassword: config.RedisSentinelPassword(),
+		DB:               config.RedisDB(),
+		Protocol:         config.RedisProtocol(),
+	})
+	if err != nil {
+		return nil, err
 	}
+	health := ratelimit.NewHealth("redis "+config.RedisMode(), policy)
+	ttl := config.ConcurrencyLeaseTTL()
+	sem := ratelimit.NewGuardSemaphore(ratelimit.NewRedisSemaphore(client, ttl), policy, health)
+	return &RateLimitBackend{
+		Limiter:     ratelimit.NewGuard(ratelimit.NewRedis(client), policy, health),
+		Concurrency: ratelimit.NewConcurrency(sem, queue, wait, ttl/3),
+		Health:      health,
+		Client:      client,
+	}, nil
 }
 
-var localRL = &localCounter{data: make(map[string]struct {
-	count int
-	ts    time.Time
-})}
+// keyLimit converts the rate limit settings of a virtual key into a token bucket.
+func keyLimit(vk keys.VirtualKey) ratelimit.Limit {
+	return ratelimit.Limit{
+		Rate:  vk.RateLimit,
+		Per:   vk.WindowDuration(),
+		Burst: vk.Burst(),
+	}
+}
+
+// requestLimit is one bucket a request must fit in to be admitted.
+type requestLimit struct {
+	bucket string
+	lim    ratelimit.Limit
+	// rejection is the 429 body written when this bucket is empty.
+	rejection ratelimit.ErrorResponse
+}
 
-func (l *localCounter) incr(key string) int {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	e := l.data[key]
-	if time.Since(e.ts) >= time.Minute {
-		e.count = 0
-		e.ts = time.Now()
+// requestLimits returns the key's own limit followed by every request quota
+// covering the key's org, service and service account.
+func requestLimits(vk keys.VirtualKey, qs quotas.Store) []requestLimit {
+	out := []requestLimit{{
+		bucket: vk.ID,
+		lim:    keyLimit(vk),
+		rejection: ratelimit.ErrorResponse{
+			Error:  "rate limit exceeded",
+			Reason: ratelimit.ReasonRateLimited,
+			Level:  ratelimit.LevelKey,
+		},
+	}}
+	if qs == nil {
+		return out
 	}
-	e.count++
-	l.data[key] = e
-	return e.count
+	applicable, err := qs.Applicable(quotas.Subject{
+		OrgID:            vk.OrgID,
+		ServiceID:        vk.Target,
+		ServiceAccountID: vk.ServiceAccountID,
+	}, quotas.MetricRequests)
+	if err != nil {
+		return out
+	}
+	for _, q := range applicable {
+		bucket, lim := q.Bucket()
+		out = append(out, requestLimit{
+			bucket: bucket,
+			lim:    lim,
+			rejection: ratelimit.ErrorResponse{
+				Error:   q.Scope + " quota exceeded",
+				Reason:  ratelimit.ReasonQuotaExceeded,
+				Level:   q.Scope,
+				QuotaID: q.ID,
+			},
+		})
+	}
+	return out
 }
 
-func RateLimitMiddleware(ks keys.Store) func(http.Handler) http.Handler {
+// RateLimitMiddleware enforces each virtual key's rate limit with a token
+// bucket: the key may send up to its burst at once and is then refilled at
+// RateLimit requests per window. Request quotas from qs (which may be nil)
+// covering the key's org, service and service account are checked alongside
+// it, and the most restrictive one decides. The remaining quota is reported
+// in RateLimit-* headers on every response for a known key. Buckets are kept
+// in limiter. Rejected requests are recorded in us, which may be nil.
+func RateLimitMiddleware(limiter ratelimit.Limiter, ks keys.Store, qs quotas.Store, us usage.Store) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
 
 			keyID := r.Header.Get("X-Virtual-Key")
 			if keyID == "" {
@@ -64,20 +154,31 @@ func RateLimitMiddleware(ks keys.Store) func(http.Handler) http.Handler {
 				return
 			}
 
-			redisKey := fmt.Sprintf("ratelimit:%s:%d", keyID, time.Now().Unix()/60)
-			count, err := rdb.Incr(r.Context(), redisKey).Result()
-			if err != nil {
-				// fallback to local counter when redis is unavailable
-				count = int64(localRL.incr(redisKey))
-			} else {
-				if count == 1 {
-					rdb.Expire(r.Context(), redisKey, time.Minute)
+			var tightest ratelimit.Result
+			limits := requestLimits(vk, qs)
+			for i, l := range limits {
+				res, err := limiter.Allow(r.Context(), l.bucket, l.lim, 1)
+				if err != nil {
+					continue
+				}
+				if !res.Allowed {
+					// Give back what the request already took from the
+					// buckets that admitted it.
+					for _, prev := range limits[:i] {
+						limiter.Debit(r.Context(), prev.bucket, prev.lim, -1) //nolint:errcheck
+					}
+					ratelimit.SetHeaders(w.Header(), res)
+					ratelimit.WriteTooManyRequests(w, l.rejection, res.RetryAfter)
+					if us != nil {
+						us.Record(usage.Rejected(r, vk, start, http.StatusTooManyRequests, l.rejection.Reason)) //nolint:errcheck
+					}
+					return
+				}
+				if tightest.Limit == 0 || res.Remaining < tightest.Remaining {
+					tightest = res
 				}
 			}
-			if int(count) > vk.RateLimit {
-				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-				return
-			}
+			ratelimit.SetHeaders(w.Header(), tightest)
 
 			next.ServeHTTP(w, r)
 		})
@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/farovictor/bifrost/config"
+	"github.com/farovictor/bifrost/pkg/orgs"
+)
+
+// HasPermission reports whether the requester's role in their token's
+// organization grants perm. In test or sqlite modes a token that failed
+// verification carries no user and is not restricted; a verified user
+// without a membership is denied like in any other mode.
+func HasPermission(r *http.Request, perm string) bool {
+	oc := OrgFromContext(r.Context())
+	if oc.UserID == "" && (config.Mode() == "test" || config.DBType() == "sqlite") {
+		return true
+	}
+	return orgs.Can(oc.Role, perm)
+}
+
+// RequirePermission rejects requests whose role lacks perm with 403 and an
+// error naming the missing permission. It must run after OrgCtxMiddleware.
+func RequirePermission(perm string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasPermission(r, perm) {
+				WriteForbidden(w, perm)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WriteForbidden writes a 403 JSON error naming the missing permission.
+func WriteForbidden(w http.ResponseWriter, perm string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(struct {
+		Error      string `json:"error"`
+		Permission string `json:"permission"`
+	}{Error: "missing permission: " + perm, Permission: perm})
+}
@@ -0,0 +1,2 @@
+ALTER TABLE virtual_keys ADD COLUMN IF NOT EXISTS rate_limit_window VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE virtual_keys ADD COLUMN IF NOT EXISTS rate_limit_burst INTEGER NOT NULL DEFAULT 0;
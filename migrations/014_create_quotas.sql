@@ -0,0 +1,16 @@
+ALTER TABLE virtual_keys ADD COLUMN IF NOT EXISTS org_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE virtual_keys ADD COLUMN IF NOT EXISTS service_account_id VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_virtual_keys_org_id ON virtual_keys (org_id);
+
+CREATE TABLE IF NOT EXISTS quotas (
+    id       VARCHAR(255) PRIMARY KEY,
+    scope    VARCHAR(32)  NOT NULL,
+    scope_id VARCHAR(255) NOT NULL,
+    service  VARCHAR(255) NOT NULL DEFAULT '',
+    metric   VARCHAR(16)  NOT NULL,
+    period   VARCHAR(16)  NOT NULL,
+    "limit"  INTEGER      NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_quotas_scope ON quotas (scope, scope_id);
@@ -0,0 +1,2 @@
+ALTER TABLE virtual_keys ADD COLUMN IF NOT EXISTS max_concurrent INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE services ADD COLUMN IF NOT EXISTS max_concurrent INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS org_id   VARCHAR(255)     NOT NULL DEFAULT '';
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS source   VARCHAR(16)      NOT NULL DEFAULT '';
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS model    VARCHAR(255)     NOT NULL DEFAULT '';
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS cost_usd DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_usage_events_org_id ON usage_events (org_id);
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS prompt_token_price     DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE services ADD COLUMN IF NOT EXISTS completion_token_price DOUBLE PRECISION NOT NULL DEFAULT 0;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS usage_rollups (
+    id                BIGSERIAL PRIMARY KEY,
+    granularity       VARCHAR(8)       NOT NULL,
+    bucket_start      TIMESTAMPTZ      NOT NULL,
+    key_id            VARCHAR(255)     NOT NULL,
+    org_id            VARCHAR(255)     NOT NULL DEFAULT '',
+    service           VARCHAR(255)     NOT NULL DEFAULT '',
+    source            VARCHAR(16)      NOT NULL DEFAULT '',
+    model             VARCHAR(255)     NOT NULL DEFAULT '',
+    status_class      VARCHAR(3)       NOT NULL,
+    latency_bucket    INTEGER          NOT NULL,
+    requests          BIGINT           NOT NULL,
+    errors            BIGINT           NOT NULL,
+    prompt_tokens     BIGINT           NOT NULL,
+    completion_tokens BIGINT           NOT NULL,
+    total_tokens      BIGINT           NOT NULL,
+    cost_usd          DOUBLE PRECISION NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_rollups_bucket ON usage_rollups (granularity, bucket_start);
+CREATE INDEX IF NOT EXISTS idx_usage_rollups_key_id ON usage_rollups (key_id);
+
+CREATE TABLE IF NOT EXISTS usage_rollup_state (
+    granularity  VARCHAR(8)  PRIMARY KEY,
+    rolled_until TIMESTAMPTZ NOT NULL
+);
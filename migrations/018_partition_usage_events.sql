@@ -0,0 +1,78 @@
+-- Convert usage_events into a table range-partitioned by month on timestamp.
+-- Partitions are created for the existing rows and the next three months;
+-- after that Bifrost creates future partitions and drops expired ones itself.
+-- Partition names encode their range: usage_events_y2025m03 for a month,
+-- usage_events_y2025m03d14 for a day. Rows outside every range, such as
+-- events with skewed clocks or written before a partition was created, go to
+-- usage_events_default instead of failing; Bifrost moves them into the right
+-- partition when it creates it. Running this again on a partitioned table
+-- only adds the default partition if it is missing.
+DO $$
+DECLARE
+    first_month DATE;
+    last_month  DATE := date_trunc('month', now() AT TIME ZONE 'UTC') + INTERVAL '3 months';
+    m           DATE;
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM pg_partitioned_table pt
+        JOIN pg_class c ON c.oid = pt.partrelid
+        WHERE c.relname = 'usage_events'
+    ) THEN
+        CREATE TABLE IF NOT EXISTS usage_events_default PARTITION OF usage_events DEFAULT;
+        RETURN;
+    END IF;
+
+    ALTER TABLE usage_events RENAME TO usage_events_unpartitioned;
+    ALTER TABLE usage_events_unpartitioned RENAME CONSTRAINT usage_events_pkey TO usage_events_unpartitioned_pkey;
+    DROP INDEX IF EXISTS idx_usage_events_key_id;
+    DROP INDEX IF EXISTS idx_usage_events_timestamp;
+    DROP INDEX IF EXISTS idx_usage_events_org_id;
+    ALTER SEQUENCE usage_events_id_seq OWNED BY NONE;
+
+    CREATE TABLE usage_events (
+        id                BIGINT           NOT NULL DEFAULT nextval('usage_events_id_seq'),
+        key_id            VARCHAR(255)     NOT NULL,
+        "timestamp"       TIMESTAMPTZ      NOT NULL,
+        status_code       INTEGER          NOT NULL,
+        service           VARCHAR(255)     NOT NULL,
+        latency_ms        BIGINT           NOT NULL,
+        prompt_tokens     INTEGER          NOT NULL DEFAULT 0,
+        completion_tokens INTEGER          NOT NULL DEFAULT 0,
+        total_tokens      INTEGER          NOT NULL DEFAULT 0,
+        org_id            VARCHAR(255)     NOT NULL DEFAULT '',
+        source            VARCHAR(16)      NOT NULL DEFAULT '',
+        model             VARCHAR(255)     NOT NULL DEFAULT '',
+        cost_usd          DOUBLE PRECISION NOT NULL DEFAULT 0,
+        PRIMARY KEY (id, "timestamp")
+    ) PARTITION BY RANGE ("timestamp");
+
+    SELECT date_trunc('month', MIN("timestamp") AT TIME ZONE 'UTC')::date
+      INTO first_month FROM usage_events_unpartitioned;
+    m := COALESCE(first_month, date_trunc('month', now() AT TIME ZONE 'UTC')::date);
+    WHILE m <= last_month LOOP
+        EXECUTE format(
+            'CREATE TABLE IF NOT EXISTS %I PARTITION OF usage_events FOR VALUES FROM (%L) TO (%L)',
+            'usage_events_y' || to_char(m, 'YYYY') || 'm' || to_char(m, 'MM'),
+            m::text || ' 00:00:00+00',
+            (m + INTERVAL '1 month')::date::text || ' 00:00:00+00'
+        );
+        m := (m + INTERVAL '1 month')::date;
+    END LOOP;
+    CREATE TABLE usage_events_default PARTITION OF usage_events DEFAULT;
+
+    INSERT INTO usage_events (id, key_id, "timestamp", status_code, service, latency_ms,
+                              prompt_tokens, completion_tokens, total_tokens,
+                              org_id, source, model, cost_usd)
+    SELECT id, key_id, "timestamp", status_code, service, latency_ms,
+           prompt_tokens, completion_tokens, total_tokens,
+           org_id, source, model, cost_usd
+      FROM usage_events_unpartitioned;
+
+    DROP TABLE usage_events_unpartitioned;
+    ALTER SEQUENCE usage_events_id_seq OWNED BY usage_events.id;
+
+    CREATE INDEX idx_usage_events_key_id   ON usage_events (key_id);
+    CREATE INDEX idx_usage_events_timestamp ON usage_events ("timestamp");
+    CREATE INDEX idx_usage_events_org_id   ON usage_events (org_id);
+END
+$$;
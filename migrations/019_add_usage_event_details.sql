@@ -0,0 +1,11 @@
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS request_bytes     BIGINT        NOT NULL DEFAULT 0;
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS response_bytes    BIGINT        NOT NULL DEFAULT 0;
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS client_ip         VARCHAR(64)   NOT NULL DEFAULT '';
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS user_agent        VARCHAR(512)  NOT NULL DEFAULT '';
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS request_id        VARCHAR(64)   NOT NULL DEFAULT '';
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS upstream_endpoint VARCHAR(1024) NOT NULL DEFAULT '';
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS ttfb_ms           BIGINT        NOT NULL DEFAULT 0;
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS category          VARCHAR(32)   NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_usage_events_request_id ON usage_events (request_id);
+CREATE INDEX IF NOT EXISTS idx_usage_events_category   ON usage_events (category);
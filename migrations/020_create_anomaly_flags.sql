@@ -0,0 +1,26 @@
+ALTER TABLE virtual_keys ADD COLUMN IF NOT EXISTS suspended        BOOLEAN       NOT NULL DEFAULT FALSE;
+ALTER TABLE virtual_keys ADD COLUMN IF NOT EXISTS suspended_reason VARCHAR(1024) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS anomaly_flags (
+    id           VARCHAR(64)      PRIMARY KEY,
+    key_id       VARCHAR(255)     NOT NULL,
+    org_id       VARCHAR(255)     NOT NULL DEFAULT '',
+    kind         VARCHAR(32)      NOT NULL,
+    observed     DOUBLE PRECISION NOT NULL DEFAULT 0,
+    baseline     DOUBLE PRECISION NOT NULL DEFAULT 0,
+    detail       VARCHAR(1024)    NOT NULL DEFAULT '',
+    action       VARCHAR(16)      NOT NULL,
+    window_start TIMESTAMPTZ      NOT NULL,
+    created_at   TIMESTAMPTZ      NOT NULL,
+    resolved_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_anomaly_flags_key_id     ON anomaly_flags (key_id);
+CREATE INDEX IF NOT EXISTS idx_anomaly_flags_org_id     ON anomaly_flags (org_id);
+CREATE INDEX IF NOT EXISTS idx_anomaly_flags_created_at ON anomaly_flags (created_at);
+
+CREATE TABLE IF NOT EXISTS anomaly_policies (
+    org_id       VARCHAR(255) PRIMARY KEY,
+    auto_suspend BOOLEAN      NOT NULL DEFAULT FALSE,
+    suspend_on   TEXT
+);
@@ -0,0 +1,11 @@
+ALTER TABLE virtual_keys ADD COLUMN IF NOT EXISTS owner  VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE virtual_keys ADD COLUMN IF NOT EXISTS labels TEXT;
+
+CREATE TABLE IF NOT EXISTS chargeback_reports (
+    org_id       VARCHAR(255) NOT NULL,
+    period       VARCHAR(7)   NOT NULL,
+    final        BOOLEAN      NOT NULL DEFAULT FALSE,
+    generated_at TIMESTAMPTZ  NOT NULL,
+    body         TEXT         NOT NULL,
+    PRIMARY KEY (org_id, period)
+);
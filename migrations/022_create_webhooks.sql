@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+    id         VARCHAR(255)  PRIMARY KEY,
+    org_id     VARCHAR(255)  NOT NULL,
+    url        VARCHAR(2048) NOT NULL,
+    events     TEXT,
+    secret     VARCHAR(255)  NOT NULL,
+    active     BOOLEAN       NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ   NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_org_id ON webhooks (org_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id              VARCHAR(64)   PRIMARY KEY,
+    webhook_id      VARCHAR(255)  NOT NULL,
+    org_id          VARCHAR(255)  NOT NULL DEFAULT '',
+    event_id        VARCHAR(64)   NOT NULL,
+    event           VARCHAR(64)   NOT NULL,
+    payload         TEXT          NOT NULL,
+    status          VARCHAR(16)   NOT NULL,
+    attempts        INTEGER       NOT NULL DEFAULT 0,
+    status_code     INTEGER       NOT NULL DEFAULT 0,
+    error           VARCHAR(1024) NOT NULL DEFAULT '',
+    redelivery_of   VARCHAR(64)   NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ   NOT NULL,
+    created_at      TIMESTAMPTZ   NOT NULL,
+    delivered_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due        ON webhook_deliveries (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_created_at ON webhook_deliveries (created_at);
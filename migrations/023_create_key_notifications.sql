@@ -0,0 +1,20 @@
+ALTER TABLE virtual_keys ADD COLUMN IF NOT EXISTS budget_usd DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS key_notifications (
+    id         VARCHAR(64)   PRIMARY KEY,
+    channel    VARCHAR(16)   NOT NULL,
+    key_id     VARCHAR(255)  NOT NULL,
+    org_id     VARCHAR(255)  NOT NULL DEFAULT '',
+    kind       VARCHAR(32)   NOT NULL,
+    threshold  VARCHAR(32)   NOT NULL,
+    subject    VARCHAR(255)  NOT NULL,
+    message    TEXT          NOT NULL,
+    status     VARCHAR(16)   NOT NULL,
+    attempts   INTEGER       NOT NULL DEFAULT 0,
+    error      VARCHAR(1024) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ   NOT NULL,
+    sent_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_key_notifications_key_id ON key_notifications (key_id);
+CREATE INDEX IF NOT EXISTS idx_key_notifications_status ON key_notifications (status, created_at);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS event_outbox (
+    id              VARCHAR(64)   PRIMARY KEY,
+    name            VARCHAR(64)   NOT NULL,
+    payload         TEXT          NOT NULL,
+    origin          VARCHAR(64)   NOT NULL DEFAULT '',
+    occurred_at     TIMESTAMPTZ   NOT NULL,
+    status          VARCHAR(16)   NOT NULL,
+    attempts        INTEGER       NOT NULL DEFAULT 0,
+    error           VARCHAR(1024) NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ   NOT NULL,
+    published_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_outbox_due         ON event_outbox (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_event_outbox_occurred_at ON event_outbox (occurred_at);
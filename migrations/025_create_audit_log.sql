@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          VARCHAR(64)  PRIMARY KEY,
+    seq         BIGINT       NOT NULL,
+    created_at  TIMESTAMPTZ  NOT NULL,
+    actor_type  VARCHAR(32)  NOT NULL,
+    actor_id    VARCHAR(255) NOT NULL DEFAULT '',
+    org_id      VARCHAR(255) NOT NULL DEFAULT '',
+    action      VARCHAR(64)  NOT NULL,
+    target_type VARCHAR(32)  NOT NULL,
+    target_id   VARCHAR(255) NOT NULL DEFAULT '',
+    changes     TEXT,
+    request_id  VARCHAR(255) NOT NULL DEFAULT '',
+    source_ip   VARCHAR(64)  NOT NULL DEFAULT '',
+    prev_hash   VARCHAR(64)  NOT NULL DEFAULT '',
+    hash        VARCHAR(64)  NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_log_seq        ON audit_log (seq);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id   ON audit_log (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_org_id     ON audit_log (org_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_action     ON audit_log (action);
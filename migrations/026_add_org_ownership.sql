@@ -0,0 +1,29 @@
+-- Keys, services, root keys and service accounts belong to an organization.
+-- Rows created before ownership existed are assigned to a default org: the
+-- bifrost.default_org setting (bifrost migrate --default-org), or the only
+-- organization when there is exactly one. Otherwise they stay unowned and
+-- only callers whose token names no org can see them.
+ALTER TABLE services         ADD COLUMN IF NOT EXISTS org_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE root_keys        ADD COLUMN IF NOT EXISTS org_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE service_accounts ADD COLUMN IF NOT EXISTS org_id VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_services_org_id         ON services (org_id);
+CREATE INDEX IF NOT EXISTS idx_root_keys_org_id        ON root_keys (org_id);
+CREATE INDEX IF NOT EXISTS idx_service_accounts_org_id ON service_accounts (org_id);
+
+DO $$
+DECLARE
+    default_org VARCHAR(255) := COALESCE(current_setting('bifrost.default_org', true), '');
+BEGIN
+    IF default_org = '' AND (SELECT count(*) FROM organizations) = 1 THEN
+        SELECT id INTO default_org FROM organizations;
+    END IF;
+    IF default_org = '' THEN
+        RAISE NOTICE 'no default org set; unowned keys, services, root keys and service accounts are left as they are';
+        RETURN;
+    END IF;
+    UPDATE virtual_keys     SET org_id = default_org WHERE org_id = '';
+    UPDATE services         SET org_id = default_org WHERE org_id = '';
+    UPDATE root_keys        SET org_id = default_org WHERE org_id = '';
+    UPDATE service_accounts SET org_id = default_org WHERE org_id = '';
+END $$;
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS audit_anchor (
+    id   BIGINT      PRIMARY KEY,
+    seq  BIGINT      NOT NULL,
+    hash VARCHAR(64) NOT NULL
+);
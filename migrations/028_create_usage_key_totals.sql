@@ -0,0 +1,25 @@
+-- Lifetime tokens and cost per key, checked against budgets. Updated with
+-- every recorded event and never pruned. When the table is created it is
+-- filled from the hourly rollups and the raw events not rolled up yet.
+DO $$
+BEGIN
+    IF to_regclass('usage_key_totals') IS NOT NULL THEN
+        RETURN;
+    END IF;
+    CREATE TABLE usage_key_totals (
+        key_id       VARCHAR(255)     PRIMARY KEY,
+        total_tokens BIGINT           NOT NULL DEFAULT 0,
+        cost_usd     DOUBLE PRECISION NOT NULL DEFAULT 0
+    );
+    INSERT INTO usage_key_totals (key_id, total_tokens, cost_usd)
+    SELECT key_id, COALESCE(SUM(total_tokens), 0), COALESCE(SUM(cost_usd), 0)
+    FROM (
+        SELECT key_id, total_tokens, cost_usd FROM usage_rollups
+        WHERE granularity = 'hour'
+          AND bucket_start < (SELECT rolled_until FROM usage_rollup_state WHERE granularity = 'hour')
+        UNION ALL
+        SELECT key_id, total_tokens, cost_usd FROM usage_events
+        WHERE timestamp >= COALESCE((SELECT rolled_until FROM usage_rollup_state WHERE granularity = 'hour'), '-infinity')
+    ) AS totals
+    GROUP BY key_id;
+END $$;
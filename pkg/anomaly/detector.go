@@ -0,0 +1,325 @@
+package anomaly
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/metrics"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+// DetectorOptions tunes a Detector. Zero fields take the defaults.
+type DetectorOptions struct {
+	// Window is the period requests, tokens and errors are counted over.
+	// Defaults to 1m.
+	Window time.Duration
+	// Warmup is how many windows with traffic a key needs before it can be
+	// flagged. Defaults to 10.
+	Warmup int
+	// Factor is how many times its baseline a window must reach to be a
+	// spike. Defaults to 5.
+	Factor float64
+	// MinRequests is the fewest requests in a window that can be a request
+	// or error spike. Defaults to 20.
+	MinRequests int
+	// MinTokens is the fewest tokens in a window that can be a token spike.
+	// Defaults to 5000.
+	MinTokens int
+	// MinErrorRatio is the lowest share of upstream errors in a window that
+	// can be an error spike. Defaults to 0.5.
+	MinErrorRatio float64
+	// MaxIPs is how many client IPs are remembered per key. Defaults to 256.
+	MaxIPs int
+	// IdleTTL is how long a key's baseline is kept without traffic.
+	// Defaults to 7 days.
+	IdleTTL time.Duration
+}
+
+func (o *DetectorOptions) defaults() {
+	if o.Window <= 0 {
+		o.Window = time.Minute
+	}
+	if o.Warmup <= 0 {
+		o.Warmup = 10
+	}
+	if o.Factor <= 1 {
+		o.Factor = 5
+	}
+	if o.MinRequests <= 0 {
+		o.MinRequests = 20
+	}
+	if o.MinTokens <= 0 {
+		o.MinTokens = 5000
+	}
+	if o.MinErrorRatio <= 0 {
+		o.MinErrorRatio = 0.5
+	}
+	if o.MaxIPs <= 0 {
+		o.MaxIPs = 256
+	}
+	if o.IdleTTL <= 0 {
+		o.IdleTTL = 7 * 24 * time.Hour
+	}
+}
+
+// smoothing is the weight of the latest window in a warmed-up baseline.
+const smoothing = 0.1
+
+// keyState is the baseline and current window of one key.
+type keyState struct {
+	lastSeen time.Time
+
+	// Baselines: moving averages over the windows with traffic.
+	windows    int
+	requests   float64
+	tokens     float64
+	errorRatio float64
+	// known maps the client IPs seen with the key to when they were last
+	// seen.
+	known map[string]time.Time
+
+	// The current window.
+	start   time.Time
+	count   int
+	used    int
+	errors  int
+	flagged map[string]bool
+}
+
+// fold adds the current window to the baselines, leaving out measures that
+// were flagged so an ongoing attack doesn't become the norm.
+func (st *keyState) fold() {
+	if st.count == 0 {
+		return
+	}
+	w := max(1/float64(st.windows+1), smoothing)
+	avg := func(mean *float64, v float64, kind string) {
+		if !st.flagged[kind] {
+			*mean += w * (v - *mean)
+		}
+	}
+	avg(&st.requests, float64(st.count), KindRequestSpike)
+	avg(&st.tokens, float64(st.used), KindTokenSpike)
+	avg(&st.errorRatio, float64(st.errors)/float64(st.count), KindErrorSpike)
+	st.windows++
+}
+
+// Detector keeps per-key baselines of request rate, tokens, upstream error
+// ratio and client IPs from the usage stream, flags keys that stray from
+// them and suspends flagged keys when their org's policy says so.
+type Detector struct {
+	store Store
+	keys  keys.Store
+	opts  DetectorOptions
+
+	mu     sync.Mutex
+	states map[string]*keyState
+}
+
+// NewDetector returns a Detector recording flags in store and suspending
+// keys in ks.
+func NewDetector(store Store, ks keys.Store, opts DetectorOptions) *Detector {
+	opts.defaults()
+	return &Detector{store: store, keys: ks, opts: opts, states: make(map[string]*keyState)}
+}
+
+// Run observes events until ctx is done or events is closed, forgetting
+// keys idle for longer than IdleTTL along the way.
+func (d *Detector) Run(ctx context.Context, events <-chan usage.Event) {
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			d.Observe(e)
+		case now := <-prune.C:
+			d.prune(now)
+		}
+	}
+}
+
+// Observe adds e to its key's window and raises a flag for every anomaly it
+// reveals.
+func (d *Detector) Observe(e usage.Event) {
+	// Refused suspended keys would only repeat the flag that suspended them.
+	if e.KeyID == "" || e.Category == usage.CategorySuspended {
+		return
+	}
+	ts := e.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	d.mu.Lock()
+	st, ok := d.states[e.KeyID]
+	if !ok {
+		st = &keyState{known: make(map[string]time.Time), flagged: make(map[string]bool)}
+		d.states[e.KeyID] = st
+		metrics.AnomalyTrackedKeys.Set(float64(len(d.states)))
+	}
+	// Late events, e.g. relayed from another instance, count in the
+	// current window.
+	if start := ts.Truncate(d.opts.Window); start.After(st.start) {
+		st.fold()
+		st.start, st.count, st.used, st.errors = start, 0, 0, 0
+		clear(st.flagged)
+	}
+	st.lastSeen = ts
+	st.count++
+	st.used += e.TotalTokens
+	if upstreamError(e) {
+		st.errors++
+	}
+	flags := d.check(e, st)
+	d.remember(st, e.ClientIP, ts)
+	d.mu.Unlock()
+
+	for _, f := range flags {
+		d.raise(f)
+	}
+}
+
+// upstreamError reports whether the upstream refused the request, which is
+// what a revoked or abused credential looks like. Upstream 429s and 5xx are
+// the upstream's problem, not the key's.
+func upstreamError(e usage.Event) bool {
+	return e.Category == usage.CategoryUpstreamClientError
+}
+
+// check returns the anomalies the current window of st shows, once per kind
+// and window.
+func (d *Detector) check(e usage.Event, st *keyState) []Flag {
+	if st.windows < d.opts.Warmup {
+		return nil
+	}
+	var out []Flag
+	flag := func(kind string, observed, baseline float64, detail string) {
+		if st.flagged[kind] {
+			return
+		}
+		st.flagged[kind] = true
+		out = append(out, d.newFlag(e, st, kind, observed, baseline, detail))
+	}
+	o := d.opts
+	if st.count >= o.MinRequests && float64(st.count) > o.Factor*st.requests {
+		flag(KindRequestSpike, float64(st.count), st.requests,
+			fmt.Sprintf("%d requests in %s, usually %.1f", st.count, o.Window, st.requests))
+	}
+	if st.used >= o.MinTokens && float64(st.used) > o.Factor*st.tokens {
+		flag(KindTokenSpike, float64(st.used), st.tokens,
+			fmt.Sprintf("%d tokens in %s, usually %.0f", st.used, o.Window, st.tokens))
+	}
+	if st.count >= o.MinRequests {
+		ratio := float64(st.errors) / float64(st.count)
+		if ratio >= o.MinErrorRatio && ratio > o.Factor*st.errorRatio {
+			flag(KindErrorSpike, ratio, st.errorRatio,
+				fmt.Sprintf("%d of %d requests refused upstream in %s, usually %.0f%%", st.errors, st.count, o.Window, 100*st.errorRatio))
+		}
+	}
+	if _, seen := st.known[e.ClientIP]; e.ClientIP != "" && !seen && len(st.known) > 0 {
+		flag(KindNewIP, 0, float64(len(st.known)),
+			fmt.Sprintf("first request from %s, %d known addresses", e.ClientIP, len(st.known)))
+	}
+	return out
+}
+
+// remember records ip as known to st, forgetting the least recently seen
+// address when there are too many.
+func (d *Detector) remember(st *keyState, ip string, ts time.Time) {
+	if ip == "" {
+		return
+	}
+	if _, ok := st.known[ip]; !ok && len(st.known) >= d.opts.MaxIPs {
+		var oldest string
+		for k, t := range st.known {
+			if oldest == "" || t.Before(st.known[oldest]) {
+				oldest = k
+			}
+		}
+		delete(st.known, oldest)
+	}
+	st.known[ip] = ts
+}
+
+// newFlag builds a flag whose ID is derived from the key, kind and window,
+// so instances that see the same events raise it only once.
+func (d *Detector) newFlag(e usage.Event, st *keyState, kind string, observed, baseline float64, detail string) Flag {
+	sum := sha256.Sum256([]byte(e.KeyID + "\x00" + kind + "\x00" + strconv.FormatInt(st.start.Unix(), 10)))
+	return Flag{
+		ID:          hex.EncodeToString(sum[:16]),
+		KeyID:       e.KeyID,
+		OrgID:       e.OrgID,
+		Kind:        kind,
+		Observed:    observed,
+		Baseline:    baseline,
+		Detail:      detail,
+		Action:      ActionFlagged,
+		WindowStart: st.start,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// raise stores f and applies the org's policy to its key.
+func (d *Detector) raise(f Flag) {
+	var policy Policy
+	if f.OrgID != "" {
+		p, err := d.store.Policy(f.OrgID)
+		if err != nil {
+			logging.Logger.Error().Err(err).Str("org_id", f.OrgID).Msg("read anomaly policy")
+		}
+		policy = p
+	}
+	if policy.Suspends(f.Kind) {
+		f.Action = ActionSuspended
+	}
+	if err := d.store.CreateFlag(f); err != nil {
+		if !errors.Is(err, ErrFlagExists) {
+			logging.Logger.Error().Err(err).Str("key_id", f.KeyID).Msg("record anomaly flag")
+		}
+		return
+	}
+	metrics.AnomalyFlagsTotal.WithLabelValues(f.Kind, f.Action).Inc()
+	logging.Logger.Warn().Str("key_id", f.KeyID).Str("org_id", f.OrgID).Str("kind", f.Kind).
+		Str("action", f.Action).Msg(f.Detail)
+	if f.Action == ActionSuspended {
+		if err := d.suspend(f); err != nil {
+			logging.Logger.Error().Err(err).Str("key_id", f.KeyID).Msg("suspend key")
+		}
+	}
+}
+
+// suspend suspends the key flagged by f.
+func (d *Detector) suspend(f Flag) error {
+	k, err := d.keys.Get(f.KeyID)
+	if err != nil || k.Suspended {
+		return err
+	}
+	k.Suspended = true
+	k.SuspendedReason = f.SuspendReason()
+	return d.keys.Update(k.ID, k)
+}
+
+// prune forgets keys without traffic since IdleTTL before now.
+func (d *Detector) prune(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, st := range d.states {
+		if now.Sub(st.lastSeen) > d.opts.IdleTTL {
+			delete(d.states, id)
+		}
+	}
+	metrics.AnomalyTrackedKeys.Set(float64(len(d.states)))
+}
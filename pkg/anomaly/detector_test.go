@@ -0,0 +1,161 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+var epoch = time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)
+
+// warm feeds the detector ten windows of steady traffic for key vk: five
+// requests a minute from one address, using 100 tokens each.
+func warm(d *Detector) {
+	for w := 0; w < 10; w++ {
+		for i := 0; i < 5; i++ {
+			d.Observe(usage.Event{
+				KeyID: "vk", OrgID: "o1", ClientIP: "10.0.0.1", StatusCode: 200, TotalTokens: 100,
+				Timestamp: epoch.Add(time.Duration(w)*time.Minute + time.Duration(i)*time.Second),
+			})
+		}
+	}
+}
+
+func newTestDetector() (*Detector, *MemoryStore, *keys.MemoryStore) {
+	store := NewMemoryStore()
+	ks := keys.NewMemoryStore()
+	ks.Create(keys.VirtualKey{ID: "vk", OrgID: "o1", Scope: keys.ScopeWrite})
+	return NewDetector(store, ks, DetectorOptions{}), store, ks
+}
+
+func listFlags(t *testing.T, s Store) []Flag {
+	t.Helper()
+	flags, err := s.ListFlags(FlagQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return flags
+}
+
+func TestDetectorBaselineNoFlags(t *testing.T) {
+	d, store, _ := newTestDetector()
+	warm(d)
+	st := d.states["vk"]
+	if st.windows != 9 || st.requests != 5 || st.tokens != 500 || st.errorRatio != 0 {
+		t.Fatalf("unexpected baseline %+v", st)
+	}
+	if flags := listFlags(t, store); len(flags) != 0 {
+		t.Fatalf("steady traffic flagged: %+v", flags)
+	}
+}
+
+func TestDetectorWarmupDoesNotFlag(t *testing.T) {
+	d, store, _ := newTestDetector()
+	for i := 0; i < 100; i++ {
+		d.Observe(usage.Event{KeyID: "vk", OrgID: "o1", ClientIP: "10.0.0.1", StatusCode: 200, Timestamp: epoch})
+	}
+	if flags := listFlags(t, store); len(flags) != 0 {
+		t.Fatalf("flagged during warmup: %+v", flags)
+	}
+}
+
+func TestDetectorFlagsAnomalies(t *testing.T) {
+	at := epoch.Add(10 * time.Minute)
+	for _, tc := range []struct {
+		name  string
+		event usage.Event
+		n     int
+		kind  string
+	}{
+		{"requests", usage.Event{ClientIP: "10.0.0.1", StatusCode: 200}, 30, KindRequestSpike},
+		{"tokens", usage.Event{ClientIP: "10.0.0.1", StatusCode: 200, TotalTokens: 3000}, 2, KindTokenSpike},
+		{"errors", usage.Event{ClientIP: "10.0.0.1", StatusCode: 401, Category: usage.CategoryUpstreamClientError}, 20, KindErrorSpike},
+		{"new ip", usage.Event{ClientIP: "203.0.113.9", StatusCode: 200}, 1, KindNewIP},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, store, ks := newTestDetector()
+			warm(d)
+			for i := 0; i < tc.n; i++ {
+				e := tc.event
+				e.KeyID, e.OrgID, e.Timestamp = "vk", "o1", at
+				d.Observe(e)
+			}
+			flags := listFlags(t, store)
+			if len(flags) != 1 || flags[0].Kind != tc.kind || flags[0].Action != ActionFlagged {
+				t.Fatalf("expected one %s flag, got %+v", tc.kind, flags)
+			}
+			if !flags[0].WindowStart.Equal(at) || flags[0].KeyID != "vk" || flags[0].OrgID != "o1" {
+				t.Fatalf("unexpected flag %+v", flags[0])
+			}
+			if k, _ := ks.Get("vk"); k.Suspended {
+				t.Fatal("key suspended without a policy")
+			}
+		})
+	}
+}
+
+func TestDetectorSuspendsPerPolicy(t *testing.T) {
+	d, store, ks := newTestDetector()
+	store.PutPolicy(Policy{OrgID: "o1", AutoSuspend: true, SuspendOn: []string{KindRequestSpike}})
+	warm(d)
+	at := epoch.Add(10 * time.Minute)
+
+	d.Observe(usage.Event{KeyID: "vk", OrgID: "o1", ClientIP: "203.0.113.9", StatusCode: 200, Timestamp: at})
+	if k, _ := ks.Get("vk"); k.Suspended {
+		t.Fatal("new_ip is not in suspend_on")
+	}
+	for i := 0; i < 30; i++ {
+		d.Observe(usage.Event{KeyID: "vk", OrgID: "o1", ClientIP: "10.0.0.1", StatusCode: 200, Timestamp: at})
+	}
+	k, _ := ks.Get("vk")
+	if !k.Suspended || k.SuspendedReason == "" {
+		t.Fatalf("expected key suspended, got %+v", k)
+	}
+	flags, _ := store.ListFlags(FlagQuery{Status: StatusOpen})
+	if len(flags) != 2 {
+		t.Fatalf("expected 2 flags, got %+v", flags)
+	}
+	for _, f := range flags {
+		want := ActionFlagged
+		if f.Kind == KindRequestSpike {
+			want = ActionSuspended
+		}
+		if f.Action != want {
+			t.Fatalf("unexpected action for %s: %s", f.Kind, f.Action)
+		}
+	}
+}
+
+func TestDetectorRaisesFlagOnce(t *testing.T) {
+	store := NewMemoryStore()
+	ks := keys.NewMemoryStore()
+	// Two instances seeing the same relayed events share one flag.
+	a := NewDetector(store, ks, DetectorOptions{})
+	b := NewDetector(store, ks, DetectorOptions{})
+	warm(a)
+	warm(b)
+	at := epoch.Add(10 * time.Minute)
+	for i := 0; i < 60; i++ {
+		e := usage.Event{KeyID: "vk", OrgID: "o1", ClientIP: "10.0.0.1", StatusCode: 200, Timestamp: at}
+		a.Observe(e)
+		b.Observe(e)
+	}
+	if flags := listFlags(t, store); len(flags) != 1 {
+		t.Fatalf("expected one flag, got %+v", flags)
+	}
+}
+
+func TestDetectorPrune(t *testing.T) {
+	d, _, _ := newTestDetector()
+	warm(d)
+	d.prune(epoch.Add(24 * time.Hour))
+	if len(d.states) != 1 {
+		t.Fatal("pruned a recently seen key")
+	}
+	d.prune(epoch.Add(8 * 24 * time.Hour))
+	if len(d.states) != 0 {
+		t.Fatal("idle key not pruned")
+	}
+}
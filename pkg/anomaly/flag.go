@@ -0,0 +1,99 @@
+package anomaly
+
+import (
+	"slices"
+	"time"
+)
+
+// Kinds of anomaly.
+const (
+	// KindRequestSpike is a key sending far more requests than usual.
+	KindRequestSpike = "request_spike"
+	// KindTokenSpike is a key consuming far more tokens than usual.
+	KindTokenSpike = "token_spike"
+	// KindErrorSpike is a key whose upstream rejects far more requests than
+	// usual, such as a burst of 401s and 403s.
+	KindErrorSpike = "error_spike"
+	// KindNewIP is a key used from a client IP it was not seen with before.
+	KindNewIP = "new_ip"
+)
+
+// Kinds lists every kind of anomaly.
+var Kinds = []string{KindRequestSpike, KindTokenSpike, KindErrorSpike, KindNewIP}
+
+// Actions taken on a flagged key.
+const (
+	ActionFlagged   = "flagged"
+	ActionSuspended = "suspended"
+)
+
+// Flag records an anomaly observed on a virtual key.
+type Flag struct {
+	ID    string `json:"id" gorm:"primaryKey;size:64"`
+	KeyID string `json:"key_id" gorm:"size:255;not null;index"`
+	OrgID string `json:"org_id" gorm:"size:255;not null;default:'';index"`
+	Kind  string `json:"kind" gorm:"size:32;not null"`
+	// Observed is the value that tripped the detector in the current window:
+	// requests, tokens or error ratio. Zero for new_ip.
+	Observed float64 `json:"observed"`
+	// Baseline is the key's usual value for the same measure.
+	Baseline float64 `json:"baseline"`
+	Detail   string  `json:"detail" gorm:"size:1024;not null;default:''"`
+	// Action is flagged, or suspended when the org policy suspended the key.
+	Action string `json:"action" gorm:"size:16;not null"`
+	// WindowStart is the start of the detection window the anomaly fell in.
+	WindowStart time.Time  `json:"window_start" gorm:"not null"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"not null;index"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+}
+
+func (Flag) TableName() string { return "anomaly_flags" }
+
+// Open reports whether the flag has not been resolved.
+func (f Flag) Open() bool { return f.ResolvedAt == nil }
+
+// SuspendReason is the reason recorded on a key suspended because of f.
+func (f Flag) SuspendReason() string { return "anomaly " + f.ID + ": " + f.Detail }
+
+// Policy is an organization's response to anomalies on its keys.
+type Policy struct {
+	OrgID string `json:"org_id" gorm:"primaryKey;size:255"`
+	// AutoSuspend suspends a key as soon as it is flagged.
+	AutoSuspend bool `json:"auto_suspend" gorm:"not null;default:false"`
+	// SuspendOn limits auto-suspension to these kinds. Empty means every
+	// kind.
+	SuspendOn []string `json:"suspend_on,omitempty" gorm:"serializer:json;type:text"`
+}
+
+func (Policy) TableName() string { return "anomaly_policies" }
+
+// Suspends reports whether p suspends keys flagged with kind.
+func (p Policy) Suspends(kind string) bool {
+	return p.AutoSuspend && (len(p.SuspendOn) == 0 || slices.Contains(p.SuspendOn, kind))
+}
+
+// Validate returns the name of the first invalid field, or "" if p is valid.
+func (p Policy) Validate() string {
+	for _, k := range p.SuspendOn {
+		if !slices.Contains(Kinds, k) {
+			return "suspend_on"
+		}
+	}
+	return ""
+}
+
+// FlagQuery selects flags. Empty fields match everything.
+type FlagQuery struct {
+	OrgID string
+	KeyID string
+	// Status is open, resolved or empty for both.
+	Status string
+	// Limit caps the number of flags returned, newest first. Zero means 100.
+	Limit int
+}
+
+// Flag statuses accepted by FlagQuery.
+const (
+	StatusOpen     = "open"
+	StatusResolved = "resolved"
+)
@@ -0,0 +1,239 @@
+package anomaly
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/events"
+)
+
+// Store defines persistence behavior for anomaly flags and org policies.
+type Store interface {
+	// CreateFlag stores a new flag. It returns ErrFlagExists if a flag with
+	// the same ID exists, e.g. raised by another instance.
+	CreateFlag(Flag) error
+	GetFlag(id string) (Flag, error)
+	// ListFlags returns the flags matching q, newest first.
+	ListFlags(q FlagQuery) ([]Flag, error)
+	// ResolveFlag marks a flag resolved at the given time and publishes the
+	// given events.
+	ResolveFlag(id string, at time.Time, es ...events.Event) error
+	// Policy returns the org's policy, or the default policy (flag only) if
+	// it has none.
+	Policy(orgID string) (Policy, error)
+	// PutPolicy creates or replaces an org's policy and publishes the given
+	// events.
+	PutPolicy(p Policy, es ...events.Event) error
+}
+
+// defaultLimit is the number of flags listed when FlagQuery.Limit is zero.
+const defaultLimit = 100
+
+// MemoryStore keeps flags and policies in memory with concurrency safety.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	flags    map[string]Flag
+	policies map[string]Policy
+	bus      *events.Bus
+}
+
+// NewMemoryStore creates an initialized MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{flags: make(map[string]Flag), policies: make(map[string]Policy)}
+}
+
+// CreateFlag inserts a new Flag.
+func (s *MemoryStore) CreateFlag(f Flag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.flags[f.ID]; ok {
+		return ErrFlagExists
+	}
+	s.flags[f.ID] = f
+	return nil
+}
+
+// GetFlag retrieves a Flag by ID.
+func (s *MemoryStore) GetFlag(id string) (Flag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.flags[id]
+	if !ok {
+		return Flag{}, ErrFlagNotFound
+	}
+	return f, nil
+}
+
+// ListFlags returns the flags matching q, newest first.
+func (s *MemoryStore) ListFlags(q FlagQuery) ([]Flag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Flag{}
+	for _, f := range s.flags {
+		if (q.OrgID != "" && f.OrgID != q.OrgID) ||
+			(q.KeyID != "" && f.KeyID != q.KeyID) ||
+			(q.Status == StatusOpen && !f.Open()) ||
+			(q.Status == StatusResolved && f.Open()) {
+			continue
+		}
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if limit := q.limit(); len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// ResolveFlag marks a flag resolved.
+func (s *MemoryStore) ResolveFlag(id string, at time.Time, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.flags[id]
+	if !ok {
+		return ErrFlagNotFound
+	}
+	f.ResolvedAt = &at
+	s.flags[id] = f
+	return nil
+}
+
+// Policy returns the org's policy.
+func (s *MemoryStore) Policy(orgID string) (Policy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.policies[orgID]; ok {
+		return p, nil
+	}
+	return Policy{OrgID: orgID}, nil
+}
+
+// PutPolicy creates or replaces an org's policy.
+func (s *MemoryStore) PutPolicy(p Policy, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policies[p.OrgID] = p
+	return nil
+}
+
+// SQLStore persists flags and policies in a SQL database.
+type SQLStore struct {
+	db  *gorm.DB
+	bus *events.Bus
+}
+
+// SetBus makes the store publish events on b.
+func (s *MemoryStore) SetBus(b *events.Bus) { s.bus = b }
+
+// SetBus makes the store publish events on b, in the transaction making the
+// change.
+func (s *SQLStore) SetBus(b *events.Bus) { s.bus = b }
+
+// NewSQLStore creates a SQL-backed store.
+func NewSQLStore(db *gorm.DB) *SQLStore {
+	db.AutoMigrate(&Flag{}, &Policy{})
+	return &SQLStore{db: db}
+}
+
+// CreateFlag inserts a flag into the database.
+func (s *SQLStore) CreateFlag(f Flag) error {
+	if err := s.db.Create(&f).Error; err != nil {
+		if database.IsDuplicateError(err) {
+			return ErrFlagExists
+		}
+		return err
+	}
+	return nil
+}
+
+// GetFlag retrieves a flag by ID.
+func (s *SQLStore) GetFlag(id string) (Flag, error) {
+	var f Flag
+	if err := s.db.First(&f, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Flag{}, ErrFlagNotFound
+		}
+		return Flag{}, err
+	}
+	return f, nil
+}
+
+// ListFlags returns the flags matching q, newest first.
+func (s *SQLStore) ListFlags(q FlagQuery) ([]Flag, error) {
+	tx := s.db.Model(&Flag{})
+	if q.OrgID != "" {
+		tx = tx.Where("org_id = ?", q.OrgID)
+	}
+	if q.KeyID != "" {
+		tx = tx.Where("key_id = ?", q.KeyID)
+	}
+	switch q.Status {
+	case StatusOpen:
+		tx = tx.Where("resolved_at IS NULL")
+	case StatusResolved:
+		tx = tx.Where("resolved_at IS NOT NULL")
+	}
+	out := []Flag{}
+	if err := tx.Order("created_at desc").Limit(q.limit()).Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ResolveFlag marks a flag resolved.
+func (s *SQLStore) ResolveFlag(id string, at time.Time, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		res := tx.Model(&Flag{}).Where("id = ?", id).Update("resolved_at", at)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrFlagNotFound
+		}
+		return nil
+	}, es...)
+}
+
+// Policy returns the org's policy.
+func (s *SQLStore) Policy(orgID string) (Policy, error) {
+	var p Policy
+	if err := s.db.First(&p, "org_id = ?", orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Policy{OrgID: orgID}, nil
+		}
+		return Policy{}, err
+	}
+	return p, nil
+}
+
+// PutPolicy creates or replaces an org's policy.
+func (s *SQLStore) PutPolicy(p Policy, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "org_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"auto_suspend", "suspend_on"}),
+		}).Create(&p).Error
+	}, es...)
+}
+
+func (q FlagQuery) limit() int {
+	if q.Limit <= 0 {
+		return defaultLimit
+	}
+	return q.Limit
+}
+
+// Error values returned by Store operations.
+var (
+	ErrFlagNotFound = errors.New("anomaly flag not found")
+	ErrFlagExists   = errors.New("anomaly flag already exists")
+)
@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ArchiveStream is the archive stream audit entries are written to.
+const ArchiveStream = "audit"
+
+// Archiver receives records to keep outside the database, such as a
+// sink.Archiver writing to object storage.
+type Archiver interface {
+	Add(stream string, ts time.Time, record any) error
+}
+
+// ArchivingStore is a Store that also archives every entry it appends, once
+// chained, so archived copies can be checked against the database.
+type ArchivingStore struct {
+	Store
+	Archive Archiver
+}
+
+// Append implements Store.
+func (s *ArchivingStore) Append(e Entry) (Entry, error) {
+	return s.AppendTx(nil, e)
+}
+
+// AppendTx implements Store. The entry is archived once appended, before tx
+// commits.
+func (s *ArchivingStore) AppendTx(tx *gorm.DB, e Entry) (Entry, error) {
+	e, err := s.Store.AppendTx(tx, e)
+	if err == nil {
+		s.Archive.Add(ArchiveStream, e.CreatedAt, e) //nolint:errcheck
+	}
+	return e, err
+}
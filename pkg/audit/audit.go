@@ -0,0 +1,239 @@
+// Package audit records who changed what through the management API. Entries
+// are hash-chained: each carries the hash of the one before it, so editing or
+// deleting an entry breaks the chain and is detected by Verify.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Actor types.
+const (
+	ActorUser           = "user"
+	ActorServiceAccount = "service_account"
+	ActorMCP            = "mcp"
+)
+
+// Entry is one audited action.
+type Entry struct {
+	ID string `json:"id" gorm:"primaryKey;size:64"`
+	// Seq orders entries in the chain, starting at 1.
+	Seq       int64     `json:"seq" gorm:"not null;uniqueIndex"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null;index"`
+	// ActorType is user, service_account or mcp.
+	ActorType string `json:"actor_type" gorm:"size:32;not null" example:"user"`
+	ActorID   string `json:"actor_id,omitempty" gorm:"size:255;not null;default:'';index"`
+	OrgID     string `json:"org_id,omitempty" gorm:"size:255;not null;default:'';index"`
+	// Action names what was done, e.g. "service.update".
+	Action     string `json:"action" gorm:"size:64;not null;index" example:"service.update"`
+	TargetType string `json:"target_type" gorm:"size:32;not null" example:"service"`
+	TargetID   string `json:"target_id,omitempty" gorm:"size:255;not null;default:''"`
+	// Changes holds the fields that changed, with secrets redacted.
+	Changes   map[string]Change `json:"changes,omitempty" gorm:"serializer:json;type:text"`
+	RequestID string            `json:"request_id,omitempty" gorm:"size:255;not null;default:''"`
+	SourceIP  string            `json:"source_ip,omitempty" gorm:"size:64;not null;default:''"`
+	// PrevHash is the Hash of the previous entry; empty for the first.
+	PrevHash string `json:"prev_hash" gorm:"size:64;not null;default:''"`
+	Hash     string `json:"hash" gorm:"size:64;not null"`
+}
+
+func (Entry) TableName() string { return "audit_log" }
+
+// Change is a field's value before and after an action. Before is absent
+// for created fields and After for deleted ones.
+type Change struct {
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+}
+
+// Redacted replaces the values of secret fields.
+const Redacted = "[REDACTED]"
+
+// secretFields are JSON fields never recorded in the clear.
+var secretFields = map[string]bool{
+	"api_key":  true,
+	"secret":   true,
+	"password": true,
+	"token":    true,
+}
+
+// Diff returns the top-level JSON fields that differ between before and
+// after, either of which may be nil. Secret fields are reported as changed
+// without their values.
+func Diff(before, after any) map[string]Change {
+	b, a := fields(before), fields(after)
+	out := map[string]Change{}
+	for k, bv := range b {
+		if av, ok := a[k]; !ok || !reflect.DeepEqual(av, bv) {
+			out[k] = Change{Before: bv, After: a[k]}
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			out[k] = Change{After: av}
+		}
+	}
+	for k, c := range out {
+		if secretFields[k] {
+			if c.Before != nil {
+				c.Before = Redacted
+			}
+			if c.After != nil {
+				c.After = Redacted
+			}
+		} else {
+			c = Change{Before: redact(c.Before), After: redact(c.After)}
+		}
+		out[k] = c
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// fields decodes v's JSON object form. Values that are not objects yield no
+// fields.
+func fields(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	if json.Unmarshal(raw, &m) != nil {
+		return nil
+	}
+	return m
+}
+
+// redact replaces secret fields nested in v.
+func redact(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, x := range t {
+			if secretFields[k] {
+				out[k] = Redacted
+				continue
+			}
+			out[k] = redact(x)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, x := range t {
+			out[i] = redact(x)
+		}
+		return out
+	}
+	return v
+}
+
+// ComputeHash returns the hash of e, covering every field but Hash and
+// chaining it to e.PrevHash.
+func ComputeHash(e Entry) string {
+	changes, _ := json.Marshal(e.Changes)
+	h := sha256.New()
+	for _, f := range []string{
+		e.ID, strconv.FormatInt(e.Seq, 10), e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		e.ActorType, e.ActorID, e.OrgID, e.Action, e.TargetType, e.TargetID,
+		string(changes), e.RequestID, e.SourceIP, e.PrevHash,
+	} {
+		h.Write([]byte(f))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// chain sets e's place after prev (nil for the first entry) and its hash.
+// CreatedAt is truncated to microseconds, the precision databases keep, so the
+// hash still matches once the entry is read back.
+func chain(e Entry, prev *Entry) Entry {
+	e.CreatedAt = e.CreatedAt.UTC().Truncate(time.Microsecond)
+	e.Seq, e.PrevHash = 1, ""
+	if prev != nil {
+		e.Seq, e.PrevHash = prev.Seq+1, prev.Hash
+	}
+	e.Hash = ComputeHash(e)
+	return e
+}
+
+// ErrChainBroken is returned by Verify when entries were edited, removed or
+// reordered.
+var ErrChainBroken = errors.New("audit chain broken")
+
+// Verify checks that entries, in Seq order, form an unbroken chain. The
+// first entry is trusted as the start, since retention removes older ones.
+func Verify(entries []Entry) error {
+	for i, e := range entries {
+		if ComputeHash(e) != e.Hash {
+			return fmt.Errorf("%w: entry %d was modified", ErrChainBroken, e.Seq)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := entries[i-1]
+		if e.Seq != prev.Seq+1 {
+			return fmt.Errorf("%w: entries between %d and %d missing", ErrChainBroken, prev.Seq, e.Seq)
+		}
+		if e.PrevHash != prev.Hash {
+			return fmt.Errorf("%w: entry %d does not follow entry %d", ErrChainBroken, e.Seq, prev.Seq)
+		}
+	}
+	return nil
+}
+
+// VerifyStore walks the whole chain in s, returning how many entries were
+// checked and ErrChainBroken if any was edited or removed. Once retention
+// has pruned the log, the oldest entry must follow its Anchor.
+func VerifyStore(s Store) (int, error) {
+	const page = 1000
+	anchor, err := s.Anchor()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		after   = anchor.Seq
+		checked int
+		last    *Entry
+	)
+	for {
+		entries, err := s.Range(after, page)
+		if err != nil {
+			return checked, err
+		}
+		if len(entries) == 0 {
+			return checked, nil
+		}
+		if first := entries[0]; last == nil && anchor.Seq > 0 {
+			if first.Seq != anchor.Seq+1 {
+				return checked, fmt.Errorf("%w: entries between %d and %d missing", ErrChainBroken, anchor.Seq, first.Seq)
+			}
+			if first.PrevHash != anchor.Hash {
+				return checked, fmt.Errorf("%w: entry %d does not follow entry %d", ErrChainBroken, first.Seq, anchor.Seq)
+			}
+		}
+		if last != nil {
+			entries = append([]Entry{*last}, entries...)
+		}
+		if err := Verify(entries); err != nil {
+			return checked, err
+		}
+		if last != nil {
+			entries = entries[1:]
+		}
+		checked += len(entries)
+		last = &entries[len(entries)-1]
+		after = last.Seq
+	}
+}
@@ -0,0 +1,192 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/events"
+)
+
+func TestDiffRedactsSecrets(t *testing.T) {
+	type rootKey struct {
+		ID     string `json:"id"`
+		APIKey string `json:"api_key"`
+	}
+	changes := Diff(rootKey{ID: "rk1", APIKey: "sk-old"}, rootKey{ID: "rk1", APIKey: "sk-new"})
+	if len(changes) != 1 {
+		t.Fatalf("expected only api_key to change, got %+v", changes)
+	}
+	if c := changes["api_key"]; c.Before != Redacted || c.After != Redacted {
+		t.Fatalf("expected redacted change, got %+v", c)
+	}
+
+	// Secrets nested in other fields are redacted too.
+	changes = Diff(nil, map[string]any{"user": map[string]any{"id": "u1", "api_key": "secret"}})
+	user := changes["user"].After.(map[string]any)
+	if user["id"] != "u1" || user["api_key"] != Redacted {
+		t.Fatalf("unexpected nested change %+v", user)
+	}
+
+	if changes := Diff(rootKey{ID: "rk1"}, rootKey{ID: "rk1"}); changes != nil {
+		t.Fatalf("expected no changes, got %+v", changes)
+	}
+	if c := Diff(rootKey{ID: "rk1"}, nil)["id"]; c.Before != "rk1" || c.After != nil {
+		t.Fatalf("unexpected deletion %+v", c)
+	}
+}
+
+func seed(t *testing.T, s Store, n int, start time.Time) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		_, err := s.Append(Entry{
+			CreatedAt:  start.Add(time.Duration(i) * 24 * time.Hour),
+			ActorType:  ActorUser,
+			ActorID:    "u1",
+			Action:     "service.update",
+			TargetType: "service",
+			TargetID:   "s1",
+			Changes:    Diff(map[string]int{"max_concurrent": i}, map[string]int{"max_concurrent": i + 1}),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	s := NewMemoryStore()
+	seed(t, s, 5, time.Now().Add(-time.Hour))
+	if n, err := VerifyStore(s); err != nil || n != 5 {
+		t.Fatalf("verify: n=%d err=%v", n, err)
+	}
+
+	entries, _ := s.Range(0, 10)
+	edited := append([]Entry(nil), entries...)
+	edited[2].ActorID = "u2"
+	if err := Verify(edited); !errors.Is(err, ErrChainBroken) {
+		t.Fatalf("edit: expected ErrChainBroken, got %v", err)
+	}
+	// Rehashing the edited entry does not help: the next one no longer
+	// follows it.
+	edited[2].Hash = ComputeHash(edited[2])
+	if err := Verify(edited); !errors.Is(err, ErrChainBroken) {
+		t.Fatalf("rehash: expected ErrChainBroken, got %v", err)
+	}
+
+	removed := append(append([]Entry(nil), entries[:2]...), entries[3:]...)
+	if err := Verify(removed); !errors.Is(err, ErrChainBroken) {
+		t.Fatalf("delete: expected ErrChainBroken, got %v", err)
+	}
+	if err := Verify(entries[2:]); err != nil {
+		t.Fatalf("expected a suffix of the chain to verify, got %v", err)
+	}
+}
+
+func TestRetentionPrunesOldEntries(t *testing.T) {
+	now := time.Now().UTC()
+	s := NewMemoryStore()
+	seed(t, s, 4, now.AddDate(0, 0, -3))
+
+	r := &Retention{Store: s, Lock: &database.LocalLock{}, Days: 2}
+	n, err := r.RunOnce(context.Background(), now)
+	if err != nil || n != 2 {
+		t.Fatalf("prune: n=%d err=%v", n, err)
+	}
+	if n, err := VerifyStore(s); err != nil || n != 2 {
+		t.Fatalf("verify after prune: n=%d err=%v", n, err)
+	}
+	if e, _ := s.Append(Entry{ActorType: ActorUser, Action: "org.create", TargetType: "org", CreatedAt: now}); e.Seq != 5 {
+		t.Fatalf("expected the chain to continue at 5, got %d", e.Seq)
+	}
+}
+
+func TestRetentionPrunesASeqPrefix(t *testing.T) {
+	now := time.Now().UTC()
+	s := NewMemoryStore()
+	// Late delivery appends an old entry after a newer one.
+	for _, at := range []time.Time{now.AddDate(0, 0, -3), now, now.AddDate(0, 0, -3), now} {
+		if _, err := s.Append(Entry{ActorType: ActorUser, Action: "org.create", TargetType: "org", CreatedAt: at}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := s.DeleteBefore(now.AddDate(0, 0, -2)); err != nil || n != 3 {
+		t.Fatalf("prune: n=%d err=%v", n, err)
+	}
+	if a, _ := s.Anchor(); a.Seq != 3 {
+		t.Fatalf("expected the anchor at 3, got %+v", a)
+	}
+	if n, err := VerifyStore(s); err != nil || n != 1 {
+		t.Fatalf("verify after prune: n=%d err=%v", n, err)
+	}
+
+	// Removing the oldest retained entry is still detected.
+	if _, err := s.Append(Entry{ActorType: ActorUser, Action: "org.create", TargetType: "org", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	s.entries = s.entries[1:]
+	if _, err := VerifyStore(s); !errors.Is(err, ErrChainBroken) {
+		t.Fatalf("expected ErrChainBroken, got %v", err)
+	}
+}
+
+type recordingArchiver struct{ streams []string }
+
+func (a *recordingArchiver) Add(stream string, _ time.Time, record any) error {
+	if e, ok := record.(Entry); !ok || e.Hash == "" {
+		return errors.New("unchained entry")
+	}
+	a.streams = append(a.streams, stream)
+	return nil
+}
+
+func TestArchivingStoreArchivesChainedEntries(t *testing.T) {
+	a := &recordingArchiver{}
+	s := &ArchivingStore{Store: NewMemoryStore(), Archive: a}
+	seed(t, s, 2, time.Now())
+	if len(a.streams) != 2 || a.streams[0] != ArchiveStream {
+		t.Fatalf("unexpected archived streams %v", a.streams)
+	}
+}
+
+func TestSubscribeRecordsEvents(t *testing.T) {
+	s := NewMemoryStore()
+	b := events.New(events.Options{})
+	Subscribe(b, s)
+
+	changes, _ := json.Marshal(Diff(nil, map[string]string{"id": "k1"}))
+	b.Emit(context.Background(),
+		events.KeyCreated{KeyID: "k1", OrgID: "o1", Meta: events.Meta{Actor: "u1", RequestID: "req-1", SourceIP: "192.0.2.1", Changes: changes}},
+		events.KeyUsed{KeyID: "k1"},
+	)
+	b.Flush(context.Background())
+
+	entries, _ := s.Range(0, 10)
+	if len(entries) != 1 {
+		t.Fatalf("expected one entry, got %+v", entries)
+	}
+	e := entries[0]
+	if e.Action != "key.create" || e.TargetID != "k1" || e.OrgID != "o1" || e.ActorType != ActorUser || e.ActorID != "u1" ||
+		e.RequestID != "req-1" || e.SourceIP != "192.0.2.1" || e.Changes["id"].After != "k1" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+}
+
+func TestAppendRejectsRepeatedID(t *testing.T) {
+	a := &recordingArchiver{}
+	s := &ArchivingStore{Store: NewMemoryStore(), Archive: a}
+	e := Entry{ID: "e1", ActorType: ActorUser, Action: "org.create", TargetType: "org", CreatedAt: time.Now()}
+	if _, err := s.Append(e); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Append(e); !errors.Is(err, ErrEntryExists) {
+		t.Fatalf("expected ErrEntryExists, got %v", err)
+	}
+	if n, err := VerifyStore(s); err != nil || n != 1 || len(a.streams) != 1 {
+		t.Fatalf("expected one entry recorded and archived: n=%d err=%v archived=%d", n, err, len(a.streams))
+	}
+}
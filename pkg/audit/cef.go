@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/farovictor/bifrost/pkg/version"
+)
+
+// Message formats.
+const (
+	FormatJSON = "json"
+	FormatCEF  = "cef"
+)
+
+// Format returns e as a single-line message in format, FormatJSON or
+// FormatCEF.
+func Format(e Entry, format string) (string, error) {
+	if format == FormatCEF {
+		return CEF(e), nil
+	}
+	b, err := json.Marshal(e)
+	return string(b), err
+}
+
+// destructive reports whether action deletes or removes something.
+func destructive(action string) bool {
+	return strings.HasSuffix(action, ".delete") || strings.HasSuffix(action, ".remove")
+}
+
+// CEF returns e in ArcSight Common Event Format. The device event class is
+// the action; targets, org and chain fields go to custom string fields
+// labelled in the extension.
+func CEF(e Entry) string {
+	severity := "3"
+	if destructive(e.Action) {
+		severity = "7"
+	} else if strings.HasSuffix(e.Action, ".update") {
+		severity = "5"
+	}
+	var b strings.Builder
+	for _, h := range []string{"CEF:0", "Bifrost", "Bifrost", version.Version, e.Action, e.Action, severity} {
+		if b.Len() > 0 {
+			b.WriteByte('|')
+		}
+		b.WriteString(cefHeaderEscaper.Replace(h))
+	}
+	b.WriteByte('|')
+
+	var changes string
+	if len(e.Changes) > 0 {
+		raw, _ := json.Marshal(e.Changes)
+		changes = string(raw)
+	}
+	first := true
+	for _, f := range []struct{ key, label, value string }{
+		{"rt", "", strconv.FormatInt(e.CreatedAt.UnixMilli(), 10)},
+		{"externalId", "", e.ID},
+		{"act", "", e.Action},
+		{"suser", "", e.ActorID},
+		{"src", "", e.SourceIP},
+		{"cs1", "actorType", e.ActorType},
+		{"cs2", "orgId", e.OrgID},
+		{"cs3", "targetType", e.TargetType},
+		{"cs4", "targetId", e.TargetID},
+		{"cs5", "requestId", e.RequestID},
+		{"cs6", "hash", e.Hash},
+		{"cn1", "seq", strconv.FormatInt(e.Seq, 10)},
+		{"msg", "", changes},
+	} {
+		if f.value == "" {
+			continue
+		}
+		if f.label != "" {
+			writeCEFField(&b, &first, f.key+"Label", f.label)
+		}
+		writeCEFField(&b, &first, f.key, f.value)
+	}
+	return b.String()
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+func writeCEFField(b *strings.Builder, first *bool, key, value string) {
+	if !*first {
+		b.WriteByte(' ')
+	}
+	*first = false
+	b.WriteString(key)
+	b.WriteByte('=')
+	b.WriteString(cefExtensionEscaper.Replace(value))
+}
@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/farovictor/bifrost/pkg/events"
+	"github.com/farovictor/bifrost/pkg/logging"
+)
+
+// Subscribe records an entry in s for every management event published on
+// b, in the transaction making the change, so no committed change goes
+// unaudited and a failed append rolls the change back. Entries take the ID
+// of their event, so an event recorded twice is kept once.
+func Subscribe(b *events.Bus, s Store) {
+	b.SubscribeTx(func(_ context.Context, tx *gorm.DB, m events.Message) error {
+		e, ok := entryOf(m.Event)
+		if !ok {
+			return nil
+		}
+		e.ID, e.CreatedAt = m.ID, m.OccurredAt
+		if d, ok := m.Event.(events.Described); ok {
+			meta := d.EventMeta()
+			e.ActorType, e.ActorID = meta.ActorType, meta.Actor
+			e.RequestID, e.SourceIP = meta.RequestID, meta.SourceIP
+			if len(meta.Changes) > 0 {
+				if err := json.Unmarshal(meta.Changes, &e.Changes); err != nil {
+					logging.Logger.Warn().Err(err).Str("event_id", m.ID).Msg("decode audit changes")
+				}
+			}
+		}
+		if e.ActorType == "" {
+			e.ActorType = ActorUser
+		}
+		if _, err := s.AppendTx(tx, e); err != nil && !errors.Is(err, ErrEntryExists) {
+			return err
+		}
+		return nil
+	})
+}
+
+// entryOf returns the entry recording e, without the fields taken from its
+// Meta, and false for events that are not audited.
+func entryOf(e events.Event) (Entry, bool) {
+	switch e := e.(type) {
+	case events.KeyCreated:
+		return Entry{OrgID: e.OrgID, Action: "key.create", TargetType: "key", TargetID: e.KeyID}, true
+	case events.KeyRevoked:
+		return Entry{OrgID: e.OrgID, Action: "key.delete", TargetType: "key", TargetID: e.KeyID}, true
+	case events.RootKeyCreated:
+		return Entry{OrgID: e.OrgID, Action: "root_key.create", TargetType: "root_key", TargetID: e.RootKeyID}, true
+	case events.RootKeyRotated:
+		return Entry{OrgID: e.OrgID, Action: "root_key.update", TargetType: "root_key", TargetID: e.RootKeyID}, true
+	case events.RootKeyDeleted:
+		return Entry{OrgID: e.OrgID, Action: "root_key.delete", TargetType: "root_key", TargetID: e.RootKeyID}, true
+	case events.ServiceCreated:
+		return Entry{OrgID: e.OrgID, Action: "service.create", TargetType: "service", TargetID: e.ServiceID}, true
+	case events.ServiceUpdated:
+		return Entry{OrgID: e.OrgID, Action: "service.update", TargetType: "service", TargetID: e.ServiceID}, true
+	case events.ServiceDeleted:
+		return Entry{OrgID: e.OrgID, Action: "service.delete", TargetType: "service", TargetID: e.ServiceID}, true
+	case events.OrgCreated:
+		return Entry{OrgID: e.OrgID, Action: "org.create", TargetType: "org", TargetID: e.OrgID}, true
+	case events.OrgDeleted:
+		return Entry{OrgID: e.OrgID, Action: "org.delete", TargetType: "org", TargetID: e.OrgID}, true
+	case events.MemberAdded:
+		return Entry{OrgID: e.OrgID, Action: "member.add", TargetType: "member", TargetID: e.UserID}, true
+	case events.MemberRemoved:
+		return Entry{OrgID: e.OrgID, Action: "member.remove", TargetType: "member", TargetID: e.UserID}, true
+	case events.ServiceAccountCreated:
+		return Entry{OrgID: e.OrgID, Action: "service_account.create", TargetType: "service_account", TargetID: e.ServiceAccountID}, true
+	case events.ServiceAccountDeleted:
+		return Entry{OrgID: e.OrgID, Action: "service_account.delete", TargetType: "service_account", TargetID: e.ServiceAccountID}, true
+	case events.UserCreated:
+		return Entry{OrgID: e.OrgID, Action: "user.create", TargetType: "user", TargetID: e.UserID}, true
+	case events.QuotaCreated:
+		return Entry{OrgID: e.OrgID, Action: "quota.create", TargetType: "quota", TargetID: e.QuotaID}, true
+	case events.QuotaDeleted:
+		return Entry{OrgID: e.OrgID, Action: "quota.delete", TargetType: "quota", TargetID: e.QuotaID}, true
+	case events.WebhookCreated:
+		return Entry{OrgID: e.OrgID, Action: "webhook.create", TargetType: "webhook", TargetID: e.WebhookID}, true
+	case events.WebhookUpdated:
+		return Entry{OrgID: e.OrgID, Action: "webhook.update", TargetType: "webhook", TargetID: e.WebhookID}, true
+	case events.WebhookDeleted:
+		return Entry{OrgID: e.OrgID, Action: "webhook.delete", TargetType: "webhook", TargetID: e.WebhookID}, true
+	case events.WebhookRedelivered:
+		return Entry{OrgID: e.OrgID, Action: "webhook.redeliver", TargetType: "webhook_delivery", TargetID: e.DeliveryID}, true
+	case events.AnomalyResolved:
+		return Entry{OrgID: e.OrgID, Action: "anomaly.resolve", TargetType: "anomaly", TargetID: e.FlagID}, true
+	case events.AnomalyPolicyUpdated:
+		return Entry{OrgID: e.OrgID, Action: "anomaly_policy.update", TargetType: "anomaly_policy", TargetID: e.OrgID}, true
+	case events.SetupCompleted:
+		return Entry{OrgID: e.OrgID, Action: "setup", TargetType: "org", TargetID: e.OrgID}, true
+	}
+	return Entry{}, false
+}
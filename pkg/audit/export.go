@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/farovictor/bifrost/pkg/export"
+	"github.com/farovictor/bifrost/pkg/parquet"
+)
+
+// exportColumn is one column of an export, in every format.
+type exportColumn struct {
+	name  string
+	typ   parquet.Type
+	value func(Entry) any
+}
+
+// exportColumns is the export schema. Columns are only ever appended, so
+// files written by older versions remain readable with the same schema.
+var exportColumns = []exportColumn{
+	{"id", parquet.String, func(e Entry) any { return e.ID }},
+	{"seq", parquet.Int64, func(e Entry) any { return e.Seq }},
+	{"created_at", parquet.Timestamp, func(e Entry) any { return e.CreatedAt.UTC() }},
+	{"org_id", parquet.String, func(e Entry) any { return e.OrgID }},
+	{"actor_type", parquet.String, func(e Entry) any { return e.ActorType }},
+	{"actor_id", parquet.String, func(e Entry) any { return e.ActorID }},
+	{"action", parquet.String, func(e Entry) any { return e.Action }},
+	{"target_type", parquet.String, func(e Entry) any { return e.TargetType }},
+	{"target_id", parquet.String, func(e Entry) any { return e.TargetID }},
+	{"changes", parquet.String, changesJSON},
+	{"request_id", parquet.String, func(e Entry) any { return e.RequestID }},
+	{"source_ip", parquet.String, func(e Entry) any { return e.SourceIP }},
+	{"prev_hash", parquet.String, func(e Entry) any { return e.PrevHash }},
+	{"hash", parquet.String, func(e Entry) any { return e.Hash }},
+}
+
+// changesJSON returns the changes of e as a JSON object, or "" when there
+// are none.
+func changesJSON(e Entry) any {
+	if len(e.Changes) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(e.Changes)
+	return string(b)
+}
+
+// Export streams the entries matching q from store to w in format, one of
+// the export formats. q.Limit is ignored.
+func Export(store Store, q Query, format string, w io.Writer) error {
+	columns := make([]export.Column, len(exportColumns))
+	for i, c := range exportColumns {
+		columns[i] = export.Column{Name: c.name, Type: c.typ}
+	}
+	ew, err := export.NewWriter(format, w, columns)
+	if err != nil {
+		return err
+	}
+	row := make([]any, len(exportColumns))
+	err = store.Export(q, func(e Entry) error {
+		for i, c := range exportColumns {
+			row[i] = c.value(e)
+		}
+		return ew.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// Export implements Store. Matching entries are copied first so a slow
+// reader does not hold up Append.
+func (s *MemoryStore) Export(q Query, fn func(Entry) error) error {
+	s.mu.RLock()
+	var entries []Entry
+	for _, e := range s.entries {
+		if q.matches(e) {
+			entries = append(entries, e)
+		}
+	}
+	s.mu.RUnlock()
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Export implements Store, reading entries from a database cursor one row
+// at a time.
+func (s *SQLStore) Export(q Query, fn func(Entry) error) error {
+	rows, err := s.where(q).Order("seq").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e Entry
+		if err := s.db.ScanRows(rows, &e); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,197 @@
+package audit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/metrics"
+)
+
+// Forwarder sends audit entries to an external system, such as a syslog
+// server or a SIEM.
+type Forwarder interface {
+	// Name identifies the forwarder in logs and metrics.
+	Name() string
+	// Forward sends entries in order. An error means some may not have
+	// arrived; they are sent again, so receivers should dedupe on ID.
+	Forward(ctx context.Context, entries []Entry) error
+}
+
+// QueueOptions tunes a Queue. Zero values take the defaults below.
+type QueueOptions struct {
+	// BatchSize is the most entries passed to one Forward call.
+	BatchSize int
+	// FlushInterval is the longest an entry waits before it is forwarded.
+	FlushInterval time.Duration
+	// BufferSize is how many entries may wait to be forwarded. Entries added
+	// while the buffer is full are dropped.
+	BufferSize int
+	// MaxRetries is how many times a failed batch is retried, with
+	// exponential backoff from RetryBackoff, before it is dropped. A
+	// negative value disables retries.
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+// Queue defaults.
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+	DefaultBufferSize    = 10000
+	DefaultMaxRetries    = 5
+	DefaultRetryBackoff  = time.Second
+)
+
+// Queue buffers entries for a Forwarder and forwards them in batches from a
+// background worker, so an unreachable forwarder never blocks API calls.
+type Queue struct {
+	fwd  Forwarder
+	opts QueueOptions
+
+	entries chan Entry
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewQueue starts a Queue forwarding to f.
+func NewQueue(f Forwarder, opts QueueOptions) *Queue {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = DefaultMaxRetries
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultRetryBackoff
+	}
+	q := &Queue{
+		fwd:     f,
+		opts:    opts,
+		entries: make(chan Entry, opts.BufferSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Add queues e to be forwarded. It never blocks.
+func (q *Queue) Add(e Entry) {
+	select {
+	case q.entries <- e:
+	default:
+		metrics.AuditForwardDroppedTotal.WithLabelValues(q.fwd.Name()).Inc()
+	}
+}
+
+// Close forwards the entries still queued and waits until they are sent, or
+// dropped after their retries, or ctx is done. Forwarders holding
+// connections are closed afterwards.
+func (q *Queue) Close(ctx context.Context) error {
+	q.once.Do(func() { close(q.stop) })
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if c, ok := q.fwd.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	ticker := time.NewTicker(q.opts.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]Entry, 0, q.opts.BatchSize)
+	add := func(e Entry) {
+		batch = append(batch, e)
+		if len(batch) >= q.opts.BatchSize {
+			q.send(batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case e := <-q.entries:
+			add(e)
+		case <-ticker.C:
+			if len(batch) > 0 {
+				q.send(batch)
+				batch = batch[:0]
+			}
+		case <-q.stop:
+			for {
+				select {
+				case e := <-q.entries:
+					add(e)
+				default:
+					if len(batch) > 0 {
+						q.send(batch)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// send forwards batch, retrying failures.
+func (q *Queue) send(batch []Entry) {
+	name := q.fwd.Name()
+	backoff := q.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := q.fwd.Forward(context.Background(), batch)
+		if err == nil {
+			metrics.AuditForwardedTotal.WithLabelValues(name).Add(float64(len(batch)))
+			return
+		}
+		metrics.AuditForwardErrorsTotal.WithLabelValues(name).Inc()
+		if attempt >= q.opts.MaxRetries {
+			metrics.AuditForwardDroppedTotal.WithLabelValues(name).Add(float64(len(batch)))
+			logging.Logger.Error().Err(err).Str("forwarder", name).Int("entries", len(batch)).Msg("forward audit entries")
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// ForwardingStore is a Store that also queues every entry it appends, once
+// chained, to forwarders.
+type ForwardingStore struct {
+	Store
+	Queues []*Queue
+}
+
+// Append implements Store.
+func (s *ForwardingStore) Append(e Entry) (Entry, error) {
+	return s.AppendTx(nil, e)
+}
+
+// AppendTx implements Store. The entry is queued for forwarding once
+// appended, before tx commits.
+func (s *ForwardingStore) AppendTx(tx *gorm.DB, e Entry) (Entry, error) {
+	e, err := s.Store.AppendTx(tx, e)
+	if err == nil {
+		for _, q := range s.Queues {
+			q.Add(e)
+		}
+	}
+	return e, err
+}
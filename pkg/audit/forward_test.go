@@ -0,0 +1,366 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testEntry(seq int64, action string) Entry {
+	return chain(Entry{
+		ID:         "e" + strconv.FormatInt(seq, 10),
+		CreatedAt:  time.Date(2025, 3, 14, 9, 41, 22, 123456000, time.UTC),
+		ActorType:  ActorUser,
+		ActorID:    "u1",
+		OrgID:      "o1",
+		Action:     action,
+		TargetType: "service",
+		TargetID:   "svc|1",
+		Changes:    Diff(map[string]string{"endpoint": "http://a"}, map[string]string{"endpoint": "http://b=c"}),
+		SourceIP:   "203.0.113.7",
+	}, nil)
+}
+
+func TestCEF(t *testing.T) {
+	got := CEF(testEntry(1, "service.delete"))
+	for _, want := range []string{
+		"CEF:0|Bifrost|Bifrost|dev|service.delete|service.delete|7|",
+		"rt=1741945282123",
+		"act=service.delete",
+		"suser=u1",
+		"src=203.0.113.7",
+		"cs1Label=actorType cs1=user",
+		// Pipes need no escaping in the extension, equals signs do.
+		"cs4Label=targetId cs4=svc|1",
+		`msg={"endpoint":{"before":"http://a","after":"http://b\=c"}}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in %s", want, got)
+		}
+	}
+	if strings.Contains(got, "cs5") {
+		t.Errorf("empty fields should be left out: %s", got)
+	}
+}
+
+// readSyslog reads one octet-counted message from r.
+func readSyslog(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	n, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatalf("read length: %v", err)
+	}
+	size, _ := strconv.Atoi(strings.TrimSpace(n))
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatalf("read message: %v", err)
+	}
+	return string(buf)
+}
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	s := &Syslog{Network: "udp", Addr: pc.LocalAddr().String(), Format: FormatCEF, Hostname: "gw 1"}
+	defer s.Close()
+	if err := s.Forward(context.Background(), []Entry{testEntry(1, "service.delete")}); err != nil {
+		t.Fatalf("forward: %v", err)
+	}
+
+	buf := make([]byte, 4096)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	// Facility 13 (log audit), severity 4 (warning) for a deletion.
+	want := "<108>1 2025-03-14T09:41:22.123456Z gw_1 bifrost "
+	if !strings.HasPrefix(msg, want) || !strings.Contains(msg, " service.delete - CEF:0|") {
+		t.Fatalf("unexpected message %q", msg)
+	}
+}
+
+func TestSyslogTCPReconnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	s := &Syslog{Network: "tcp", Addr: ln.Addr().String(), Format: FormatJSON}
+	defer s.Close()
+
+	if err := s.Forward(context.Background(), []Entry{testEntry(1, "service.create"), testEntry(2, "service.update")}); err != nil {
+		t.Fatalf("forward: %v", err)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	for _, id := range []string{"e1", "e2"} {
+		msg := readSyslog(t, r)
+		body := msg[strings.Index(msg, " - ")+3:]
+		var e Entry
+		if err := json.Unmarshal([]byte(body), &e); err != nil || e.ID != id {
+			t.Fatalf("unexpected body %q: %v", body, err)
+		}
+	}
+
+	// A write to a connection the server closed fails, and the next
+	// forward connects again.
+	conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Forward(context.Background(), []Entry{testEntry(3, "service.update")}) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("write to closed connection kept succeeding")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := s.Forward(context.Background(), []Entry{testEntry(4, "service.update")}); err != nil {
+		t.Fatalf("forward after reconnect: %v", err)
+	}
+	conn, err = ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if msg := readSyslog(t, bufio.NewReader(conn)); !strings.Contains(msg, `"id":"e4"`) {
+		t.Fatalf("unexpected message %q", msg)
+	}
+}
+
+func TestSyslogTLS(t *testing.T) {
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: ts.TLS.Certificates})
+	ts.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// Every connection is read to the end, so failed handshakes end too.
+	got := make(chan []byte, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				raw, _ := io.ReadAll(conn)
+				got <- raw
+			}()
+		}
+	}()
+	s := &Syslog{Network: "tls", Addr: ln.Addr().String(), TLSConfig: &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}}
+	if err := s.Forward(context.Background(), []Entry{testEntry(1, "root_key.update")}); err != nil {
+		t.Fatalf("forward: %v", err)
+	}
+	s.Close()
+	select {
+	case raw := <-got:
+		msg := readSyslog(t, bufio.NewReader(bytes.NewReader(raw)))
+		if !strings.HasPrefix(msg, "<109>1 ") || !strings.Contains(msg, `"action":"root_key.update"`) {
+			t.Fatalf("unexpected message %q", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+	}
+
+	untrusted := &Syslog{Network: "tls", Addr: ln.Addr().String()}
+	if err := untrusted.Forward(context.Background(), []Entry{testEntry(2, "root_key.update")}); err == nil {
+		t.Fatal("expected an untrusted certificate to fail")
+	}
+}
+
+func TestHTTPFormats(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+		auth   []string
+	)
+	elasticStatus := http.StatusConflict
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, r.Header.Get("Content-Type")+"\n"+string(raw))
+		auth = append(auth, r.Header.Get("Authorization"))
+		status := elasticStatus
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/_bulk":
+			json.NewEncoder(w).Encode(map[string]any{
+				"errors": true,
+				"items": []map[string]any{
+					{"create": map[string]any{"status": http.StatusCreated}},
+					{"create": map[string]any{"status": status, "error": map[string]string{"type": "mapper_parsing_exception", "reason": "bad"}}},
+				},
+			})
+		}
+	}))
+	defer srv.Close()
+	entries := []Entry{testEntry(1, "service.create"), testEntry(2, "service.update")}
+	ctx := context.Background()
+
+	if err := (&HTTP{URL: srv.URL, Authorization: "Bearer t"}).Forward(ctx, entries); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if err := (&HTTP{URL: srv.URL + "/services/collector", Format: FormatSplunk, Authorization: "Splunk hec"}).Forward(ctx, entries); err != nil {
+		t.Fatalf("splunk: %v", err)
+	}
+	// Documents that already exist were sent before; the batch succeeds.
+	elastic := &HTTP{URL: srv.URL + "/_bulk", Format: FormatElastic}
+	if err := elastic.Forward(ctx, entries); err != nil {
+		t.Fatalf("elastic: %v", err)
+	}
+	mu.Lock()
+	elasticStatus = http.StatusBadRequest
+	mu.Unlock()
+	if err := elastic.Forward(ctx, entries); err == nil || !strings.Contains(err.Error(), "mapper_parsing_exception") {
+		t.Fatalf("expected bulk item error, got %v", err)
+	}
+
+	var arr []Entry
+	if body := strings.SplitN(bodies[0], "\n", 2); body[0] != "application/json" || json.Unmarshal([]byte(body[1]), &arr) != nil || len(arr) != 2 {
+		t.Fatalf("unexpected json batch %q", bodies[0])
+	}
+	if auth[0] != "Bearer t" || auth[1] != "Splunk hec" || auth[2] != "" {
+		t.Fatalf("unexpected authorization headers %q", auth)
+	}
+	lines := strings.Split(strings.TrimSpace(bodies[1]), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 2 HEC events, got %q", bodies[1])
+	}
+	var hec struct {
+		Time       float64 `json:"time"`
+		Sourcetype string  `json:"sourcetype"`
+		Event      Entry   `json:"event"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &hec); err != nil || hec.Sourcetype != "bifrost:audit" || hec.Event.ID != "e1" || hec.Time != 1741945282.123456 {
+		t.Fatalf("unexpected HEC event %q: %v", lines[1], err)
+	}
+	lines = strings.Split(strings.TrimSpace(bodies[2]), "\n")
+	if lines[0] != "application/x-ndjson" || lines[1] != `{"create":{"_id":"e1"}}` || len(lines) != 5 {
+		t.Fatalf("unexpected bulk request %q", bodies[2])
+	}
+
+	if err := (&HTTP{URL: srv.URL + "/missing"}).Forward(ctx, entries); err == nil {
+		t.Fatal("expected an error for a 404")
+	}
+}
+
+// flakyForwarder fails its first failures calls.
+type flakyForwarder struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	got      []string
+	block    chan struct{}
+}
+
+func (*flakyForwarder) Name() string { return "flaky" }
+
+func (f *flakyForwarder) Forward(_ context.Context, entries []Entry) error {
+	if f.block != nil {
+		<-f.block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("unavailable")
+	}
+	for _, e := range entries {
+		f.got = append(f.got, e.ID)
+	}
+	return nil
+}
+
+func (f *flakyForwarder) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.got...)
+}
+
+func TestQueueRetriesAndFlushesOnClose(t *testing.T) {
+	f := &flakyForwarder{failures: 2}
+	q := NewQueue(f, QueueOptions{BatchSize: 2, FlushInterval: time.Hour, RetryBackoff: time.Millisecond})
+	for i := int64(1); i <= 3; i++ {
+		q.Add(testEntry(i, "service.update"))
+	}
+	// The first batch is sent once full, after two failures; the last
+	// entry waits for Close.
+	deadline := time.Now().Add(2 * time.Second)
+	for len(f.received()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("batch not forwarded: %v", f.received())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := q.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if got := strings.Join(f.received(), ","); got != "e1,e2,e3" {
+		t.Fatalf("unexpected forwarded entries %s", got)
+	}
+}
+
+func TestQueueDropsWhenFullOrRetriesRunOut(t *testing.T) {
+	f := &flakyForwarder{failures: 1, block: make(chan struct{})}
+	q := NewQueue(f, QueueOptions{BatchSize: 1, BufferSize: 1, MaxRetries: -1, FlushInterval: time.Hour})
+	// The worker holds e1 in a blocked Forward, e2 fills the buffer and e3
+	// is dropped without blocking.
+	q.Add(testEntry(1, "key.create"))
+	deadline := time.Now().Add(2 * time.Second)
+	for len(q.entries) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("worker did not take the first entry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	q.Add(testEntry(2, "key.create"))
+	q.Add(testEntry(3, "key.create"))
+	close(f.block)
+	q.Close(context.Background())
+	// e1 failed without retries.
+	if got := strings.Join(f.received(), ","); got != "e2" {
+		t.Fatalf("unexpected forwarded entries %s", got)
+	}
+}
+
+func TestForwardingStoreQueuesChainedEntries(t *testing.T) {
+	f := &flakyForwarder{}
+	q := NewQueue(f, QueueOptions{})
+	s := &ForwardingStore{Store: NewMemoryStore(), Queues: []*Queue{q}}
+	e, err := s.Append(Entry{ID: "a1", ActorType: ActorUser, Action: "org.create", TargetType: "org", CreatedAt: time.Now()})
+	if err != nil || e.Hash == "" {
+		t.Fatalf("append: %+v, %v", e, err)
+	}
+	q.Close(context.Background())
+	if got := f.received(); len(got) != 1 || got[0] != "a1" {
+		t.Fatalf("unexpected forwarded entries %v", got)
+	}
+}
@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTP batch formats.
+const (
+	// FormatSplunk sends Splunk HTTP Event Collector events.
+	FormatSplunk = "splunk"
+	// FormatElastic sends an Elasticsearch bulk request creating one
+	// document per entry.
+	FormatElastic = "elastic"
+)
+
+// HTTP forwards batches of entries in one POST each: a JSON array with
+// FormatJSON, HEC events with FormatSplunk, or a bulk request with
+// FormatElastic.
+type HTTP struct {
+	URL    string
+	Format string
+	// Authorization is sent as the Authorization header when set, e.g.
+	// "Splunk <token>" or "ApiKey <key>".
+	Authorization string
+	// Client sends the requests. Defaults to a client with a 10s timeout.
+	Client *http.Client
+}
+
+// Name returns "http".
+func (*HTTP) Name() string { return "http" }
+
+// Forward implements Forwarder.
+func (h *HTTP) Forward(ctx context.Context, entries []Entry) error {
+	body, contentType, err := h.body(entries)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if h.Authorization != "" {
+		req.Header.Set("Authorization", h.Authorization)
+	}
+	client := h.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit: %s answered %s", h.URL, resp.Status)
+	}
+	if h.Format == FormatElastic {
+		return bulkErrors(resp.Body)
+	}
+	return nil
+}
+
+func (h *HTTP) body(entries []Entry) ([]byte, string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	switch h.Format {
+	case FormatSplunk:
+		for _, e := range entries {
+			err := enc.Encode(map[string]any{
+				"time":       float64(e.CreatedAt.UnixMicro()) / 1e6,
+				"source":     "bifrost",
+				"sourcetype": "bifrost:audit",
+				"event":      e,
+			})
+			if err != nil {
+				return nil, "", err
+			}
+		}
+		return buf.Bytes(), "application/json", nil
+	case FormatElastic:
+		// Creating documents by entry ID keeps retried batches from
+		// duplicating them.
+		for _, e := range entries {
+			if err := enc.Encode(map[string]any{"create": map[string]string{"_id": e.ID}}); err != nil {
+				return nil, "", err
+			}
+			if err := enc.Encode(e); err != nil {
+				return nil, "", err
+			}
+		}
+		return buf.Bytes(), "application/x-ndjson", nil
+	}
+	if err := enc.Encode(entries); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "application/json", nil
+}
+
+// bulkErrors returns an error if an Elasticsearch bulk response reports
+// items that failed for reasons other than already existing.
+func bulkErrors(r io.Reader) error {
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(r).Decode(&resp); err != nil || !resp.Errors {
+		return nil
+	}
+	for _, item := range resp.Items {
+		for _, res := range item {
+			if res.Status >= 300 && res.Status != http.StatusConflict {
+				return fmt.Errorf("audit: bulk item failed: %s: %s", res.Error.Type, res.Error.Reason)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/metrics"
+)
+
+// LockKey is the Postgres advisory lock key held while pruning, so only one
+// instance prunes at a time.
+const LockKey int64 = 0x6266_6175_6469_7401
+
+// Retention deletes entries older than Days every Interval. It prunes the
+// chain up to the last such entry in Seq order, see Store.DeleteBefore.
+type Retention struct {
+	Store Store
+	// Lock keeps instances from pruning concurrently.
+	Lock     database.Locker
+	Days     int
+	Interval time.Duration
+}
+
+// RunOnce deletes the entries older than Days at now, if no other instance
+// is doing so. It returns the number deleted.
+func (r *Retention) RunOnce(ctx context.Context, now time.Time) (int64, error) {
+	release, ok, err := r.Lock.TryLock(ctx)
+	if err != nil || !ok {
+		return 0, err
+	}
+	defer release()
+	n, err := r.Store.DeleteBefore(now.AddDate(0, 0, -r.Days))
+	metrics.AuditPrunedTotal.Add(float64(n))
+	return n, err
+}
+
+// Run calls RunOnce immediately and then every Interval until ctx is done.
+func (r *Retention) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		n, err := r.RunOnce(ctx, time.Now().UTC())
+		switch {
+		case err != nil && ctx.Err() == nil:
+			logging.Logger.Error().Err(err).Msg("prune audit log")
+		case n > 0:
+			logging.Logger.Info().Int64("deleted", n).Msg("pruned audit log")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package audit
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/metrics"
+)
+
+// Query selects entries. Empty fields match everything.
+type Query struct {
+	OrgID      string
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	// Since and Until bound CreatedAt, inclusive and exclusive.
+	Since time.Time
+	Until time.Time
+	// Limit caps the entries returned. Defaults to 100.
+	Limit int
+}
+
+func (q Query) matches(e Entry) bool {
+	return (q.OrgID == "" || e.OrgID == q.OrgID) &&
+		(q.ActorID == "" || e.ActorID == q.ActorID) &&
+		(q.Action == "" || e.Action == q.Action) &&
+		(q.TargetType == "" || e.TargetType == q.TargetType) &&
+		(q.TargetID == "" || e.TargetID == q.TargetID) &&
+		(q.Since.IsZero() || !e.CreatedAt.Before(q.Since)) &&
+		(q.Until.IsZero() || e.CreatedAt.Before(q.Until))
+}
+
+func (q Query) limit() int {
+	if q.Limit <= 0 {
+		return 100
+	}
+	return q.Limit
+}
+
+// Store defines persistence behavior for audit entries.
+type Store interface {
+	// Append adds e to the end of the chain, setting its Seq, PrevHash and
+	// Hash, and an ID when it has none. It returns ErrEntryExists if an
+	// entry with e's ID was already appended.
+	Append(e Entry) (Entry, error)
+	// AppendTx is Append within tx, a transaction of the store's database,
+	// so the entry commits or rolls back with it. A nil tx, or a store
+	// without a database, appends as Append.
+	AppendTx(tx *gorm.DB, e Entry) (Entry, error)
+	// List returns the entries matching q, newest first.
+	List(q Query) ([]Entry, error)
+	// Export calls fn with every entry matching q, oldest first, stopping
+	// at the first error. q.Limit is ignored.
+	Export(q Query, fn func(Entry) error) error
+	// Range returns up to limit entries with Seq above after, in Seq order.
+	Range(after int64, limit int) ([]Entry, error)
+	// DeleteBefore deletes the entries up to the last one recorded before
+	// cutoff, in Seq order, so the chain loses a prefix and never a gap.
+	// The last deleted entry is kept as the Anchor.
+	DeleteBefore(cutoff time.Time) (int64, error)
+	// Anchor returns the last entry deleted by DeleteBefore, or a zero
+	// Anchor if none was.
+	Anchor() (Anchor, error)
+}
+
+// Anchor is the last entry removed by retention. The oldest retained entry
+// must follow it, so removing that entry too is still detected.
+type Anchor struct {
+	ID   int    `json:"-" gorm:"primaryKey"`
+	Seq  int64  `json:"seq" gorm:"not null"`
+	Hash string `json:"hash" gorm:"size:64;not null"`
+}
+
+func (Anchor) TableName() string { return "audit_anchor" }
+
+// entry returns the entry an emptied log continues from, or nil if nothing
+// was pruned.
+func (a Anchor) entry() *Entry {
+	if a.Seq == 0 {
+		return nil
+	}
+	return &Entry{Seq: a.Seq, Hash: a.Hash}
+}
+
+// ErrEntryExists is returned by Append for an entry already in the log.
+var ErrEntryExists = errors.New("audit entry already exists")
+
+// MemoryStore keeps the audit log in memory with concurrency safety.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries []Entry
+	ids     map[string]bool
+	anchor  Anchor
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{ids: make(map[string]bool)}
+}
+
+// Append implements Store.
+func (s *MemoryStore) Append(e Entry) (Entry, error) {
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ids[e.ID] {
+		return Entry{}, ErrEntryExists
+	}
+	prev := s.anchor.entry()
+	if n := len(s.entries); n > 0 {
+		prev = &s.entries[n-1]
+	}
+	e = chain(e, prev)
+	s.entries = append(s.entries, e)
+	s.ids[e.ID] = true
+	metrics.AuditEntriesTotal.WithLabelValues(e.Action).Inc()
+	return e, nil
+}
+
+// AppendTx implements Store. The memory store has no transactions.
+func (s *MemoryStore) AppendTx(_ *gorm.DB, e Entry) (Entry, error) {
+	return s.Append(e)
+}
+
+// List implements Store.
+func (s *MemoryStore) List(q Query) ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Entry{}
+	for i := len(s.entries) - 1; i >= 0 && len(out) < q.limit(); i-- {
+		if q.matches(s.entries[i]) {
+			out = append(out, s.entries[i])
+		}
+	}
+	return out, nil
+}
+
+// Range implements Store.
+func (s *MemoryStore) Range(after int64, limit int) ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := sort.Search(len(s.entries), func(i int) bool { return s.entries[i].Seq > after })
+	out := []Entry{}
+	for ; i < len(s.entries) && len(out) < limit; i++ {
+		out = append(out, s.entries[i])
+	}
+	return out, nil
+}
+
+// DeleteBefore implements Store.
+func (s *MemoryStore) DeleteBefore(cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for i, e := range s.entries {
+		if e.CreatedAt.Before(cutoff) {
+			n = i + 1
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	for _, e := range s.entries[:n] {
+		delete(s.ids, e.ID)
+	}
+	last := s.entries[n-1]
+	s.anchor = Anchor{ID: 1, Seq: last.Seq, Hash: last.Hash}
+	s.entries = append([]Entry(nil), s.entries[n:]...)
+	return int64(n), nil
+}
+
+// Anchor implements Store.
+func (s *MemoryStore) Anchor() (Anchor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.anchor, nil
+}
+
+// SQLStore persists the audit log in a SQL database.
+type SQLStore struct {
+	db *gorm.DB
+}
+
+// NewSQLStore creates a SQL-backed store.
+func NewSQLStore(db *gorm.DB) *SQLStore {
+	db.AutoMigrate(&Entry{}, &Anchor{})
+	return &SQLStore{db: db}
+}
+
+// appendAttempts is how often Append retries when another instance appended
+// the same Seq first.
+const appendAttempts = 10
+
+// Append implements Store. The unique Seq keeps instances appending at once
+// from forking the chain: the loser retries after the winner's entry.
+func (s *SQLStore) Append(e Entry) (Entry, error) {
+	return s.AppendTx(nil, e)
+}
+
+// AppendTx implements Store. Each attempt runs in a savepoint of tx, so a
+// lost race for the next Seq leaves tx usable for the retry.
+func (s *SQLStore) AppendTx(tx *gorm.DB, e Entry) (Entry, error) {
+	db := s.db
+	if tx != nil {
+		db = tx
+	}
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	for attempt := 0; ; attempt++ {
+		var chained Entry
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var last []Entry
+			if err := tx.Order("seq DESC").Limit(1).Find(&last).Error; err != nil {
+				return err
+			}
+			var prev *Entry
+			if len(last) == 1 {
+				prev = &last[0]
+			} else {
+				var a Anchor
+				if err := tx.Limit(1).Find(&a, 1).Error; err != nil {
+					return err
+				}
+				prev = a.entry()
+			}
+			chained = chain(e, prev)
+			return tx.Create(&chained).Error
+		})
+		if err == nil {
+			metrics.AuditEntriesTotal.WithLabelValues(e.Action).Inc()
+			return chained, nil
+		}
+		if !database.IsDuplicateError(err) {
+			return Entry{}, err
+		}
+		var n int64
+		if err := db.Model(&Entry{}).Where("id = ?", e.ID).Count(&n).Error; err != nil {
+			return Entry{}, err
+		}
+		if n > 0 {
+			return Entry{}, ErrEntryExists
+		}
+		if attempt == appendAttempts-1 {
+			return Entry{}, err
+		}
+	}
+}
+
+// List implements Store.
+func (s *SQLStore) List(q Query) ([]Entry, error) {
+	out := []Entry{}
+	if err := s.where(q).Order("seq DESC").Limit(q.limit()).Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// where selects the entries matching q, whatever its Limit.
+func (s *SQLStore) where(q Query) *gorm.DB {
+	tx := s.db.Model(&Entry{})
+	for col, v := range map[string]string{
+		"org_id": q.OrgID, "actor_id": q.ActorID, "action": q.Action,
+		"target_type": q.TargetType, "target_id": q.TargetID,
+	} {
+		if v != "" {
+			tx = tx.Where(col+" = ?", v)
+		}
+	}
+	if !q.Since.IsZero() {
+		tx = tx.Where("created_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		tx = tx.Where("created_at < ?", q.Until)
+	}
+	return tx
+}
+
+// Range implements Store.
+func (s *SQLStore) Range(after int64, limit int) ([]Entry, error) {
+	out := []Entry{}
+	if err := s.db.Where("seq > ?", after).Order("seq").Limit(limit).Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteBefore implements Store.
+func (s *SQLStore) DeleteBefore(cutoff time.Time) (int64, error) {
+	var n int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var last Entry
+		res := tx.Where("created_at < ?", cutoff).Order("seq DESC").Limit(1).Find(&last)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		del := tx.Where("seq <= ?", last.Seq).Delete(&Entry{})
+		if del.Error != nil {
+			return del.Error
+		}
+		n = del.RowsAffected
+		return tx.Save(&Anchor{ID: 1, Seq: last.Seq, Hash: last.Hash}).Error
+	})
+	return n, err
+}
+
+// Anchor implements Store.
+func (s *SQLStore) Anchor() (Anchor, error) {
+	var a Anchor
+	if err := s.db.Limit(1).Find(&a, 1).Error; err != nil {
+		return Anchor{}, err
+	}
+	return a, nil
+}
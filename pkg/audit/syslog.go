@@ -0,0 +1,153 @@
+package audit
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Syslog forwards entries as RFC 5424 syslog messages over UDP, TCP or TLS.
+// Over TCP and TLS messages are framed by octet counting (RFC 6587, RFC
+// 5425); over UDP each message is one datagram.
+type Syslog struct {
+	// Network is "udp", "tcp" or "tls".
+	Network string
+	Addr    string
+	// TLSConfig configures "tls" connections. Defaults to the system roots
+	// verifying Addr's host.
+	TLSConfig *tls.Config
+	// Format is FormatJSON or FormatCEF.
+	Format string
+	// Facility defaults to 13, log audit.
+	Facility int
+	// Hostname defaults to the machine's host name and AppName to bifrost.
+	Hostname string
+	AppName  string
+	// Timeout bounds connecting and each write. Defaults to 10s.
+	Timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// Name returns "syslog".
+func (*Syslog) Name() string { return "syslog" }
+
+// Forward implements Forwarder, connecting on first use and again after a
+// failed write.
+func (s *Syslog) Forward(ctx context.Context, entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range entries {
+		msg, err := s.Message(e)
+		if err != nil {
+			return err
+		}
+		if s.Network != "udp" {
+			msg = strconv.Itoa(len(msg)) + " " + msg
+		}
+		if s.conn == nil {
+			if s.conn, err = s.dial(ctx); err != nil {
+				return err
+			}
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(s.timeout())) //nolint:errcheck
+		if _, err := s.conn.Write([]byte(msg)); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection, if any.
+func (s *Syslog) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *Syslog) timeout() time.Duration {
+	if s.Timeout <= 0 {
+		return 10 * time.Second
+	}
+	return s.Timeout
+}
+
+func (s *Syslog) dial(ctx context.Context) (net.Conn, error) {
+	d := &net.Dialer{Timeout: s.timeout()}
+	switch s.Network {
+	case "udp", "tcp":
+		return d.DialContext(ctx, s.Network, s.Addr)
+	case "tls":
+		cfg := s.TLSConfig
+		if cfg == nil {
+			host, _, _ := net.SplitHostPort(s.Addr)
+			cfg = &tls.Config{ServerName: host}
+		}
+		return (&tls.Dialer{NetDialer: d, Config: cfg}).DialContext(ctx, "tcp", s.Addr)
+	}
+	return nil, fmt.Errorf("audit: unknown syslog network %q", s.Network)
+}
+
+// Message returns e as an RFC 5424 message without framing. The message ID
+// is the action and the body is e in s.Format. Deletions are logged as
+// warnings, other actions as notices.
+func (s *Syslog) Message(e Entry) (string, error) {
+	body, err := Format(e, s.Format)
+	if err != nil {
+		return "", err
+	}
+	facility := s.Facility
+	if facility == 0 {
+		facility = 13
+	}
+	severity := 5
+	if destructive(e.Action) {
+		severity = 4
+	}
+	hostname := s.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	app := s.AppName
+	if app == "" {
+		app = "bifrost"
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		facility*8+severity,
+		e.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		headerField(hostname, 255), headerField(app, 48), os.Getpid(), headerField(e.Action, 32),
+		body,
+	), nil
+}
+
+// headerField returns v as a syslog header field: printable ASCII without
+// spaces, at most max characters, or "-" when empty.
+func headerField(v string, max int) string {
+	v = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, v)
+	if len(v) > max {
+		v = v[:max]
+	}
+	if v == "" {
+		return "-"
+	}
+	return v
+}
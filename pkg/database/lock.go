@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Locker lets one of several instances run a job at a time.
+type Locker interface {
+	// TryLock takes the lock without waiting. When ok is true the caller
+	// holds the lock until it calls release.
+	TryLock(ctx context.Context) (release func(), ok bool, err error)
+}
+
+// AdvisoryLock is a Locker backed by a Postgres session-level advisory lock,
+// shared by every instance connected to the same database.
+type AdvisoryLock struct {
+	db  *gorm.DB
+	key int64
+}
+
+// NewAdvisoryLock returns a lock on the advisory lock key.
+func NewAdvisoryLock(db *gorm.DB, key int64) *AdvisoryLock {
+	return &AdvisoryLock{db: db, key: key}
+}
+
+// TryLock implements Locker. Advisory locks belong to a database session, so
+// a connection is pinned from the pool until release.
+func (l *AdvisoryLock) TryLock(ctx context.Context) (func(), bool, error) {
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return nil, false, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", l.key) //nolint:errcheck
+		conn.Close()
+	}, true, nil
+}
+
+// LocalLock is a Locker for single-instance deployments, such as SQLite or
+// in-memory mode.
+type LocalLock struct {
+	mu sync.Mutex
+}
+
+// TryLock implements Locker. It never returns an error.
+func (l *LocalLock) TryLock(context.Context) (func(), bool, error) {
+	if !l.mu.TryLock() {
+		return nil, false, nil
+	}
+	return l.mu.Unlock, true, nil
+}
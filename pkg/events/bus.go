@@ -0,0 +1,526 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/metrics"
+	"github.com/farovictor/bifrost/pkg/utils"
+)
+
+// Options tunes a Bus. Zero fields take the defaults.
+type Options struct {
+	// Outbox, when set, persists events before asynchronous subscribers
+	// see them, so they are delivered at least once. Without it events
+	// are queued in memory and lost if the instance stops.
+	Outbox *Outbox
+	// Fanout, when set, delivers events to the broadcast subscribers of
+	// every instance.
+	Fanout Fanout
+	// Buffer is how many events wait for asynchronous subscribers before
+	// new ones are dropped. Unused with an outbox. Defaults to 1024.
+	Buffer int
+	// MaxAttempts is how many times an outbox event is delivered before it
+	// fails. Defaults to 10.
+	MaxAttempts int
+	// Backoff is the wait before an outbox event is retried, doubling for
+	// each retry after it. Defaults to 1s.
+	Backoff time.Duration
+	// PollInterval is how often the outbox is looked at for events
+	// appended by other instances or due for retry. Defaults to 1s.
+	PollInterval time.Duration
+	// Lease is how long a claimed outbox event is kept from other
+	// instances. Defaults to 1m.
+	Lease time.Duration
+	// Retention is how long delivered and failed outbox events are kept.
+	// Defaults to 7 days.
+	Retention time.Duration
+}
+
+func (o *Options) defaults() {
+	if o.Buffer <= 0 {
+		o.Buffer = 1024
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 10
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = time.Second
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Second
+	}
+	if o.Lease <= 0 {
+		o.Lease = time.Minute
+	}
+	if o.Retention <= 0 {
+		o.Retention = 7 * 24 * time.Hour
+	}
+}
+
+// claimBatch is how many due outbox events are claimed at a time.
+const claimBatch = 100
+
+type subscription struct {
+	names map[string]bool
+	fn    Handler
+	txFn  TxHandler
+}
+
+// TxHandler handles an event within the transaction making the change it
+// describes. tx is nil for changes made without a transaction.
+type TxHandler func(ctx context.Context, tx *gorm.DB, m Message) error
+
+func (s subscription) wants(name string) bool {
+	return len(s.names) == 0 || s.names[name]
+}
+
+// Bus delivers published events to subscribers.
+//
+// Transactional subscribers run in the publishing store's transaction, so
+// what they record commits or rolls back with the change. Synchronous
+// subscribers run in the publisher's goroutine before Publish returns, on
+// the publishing instance only. Asynchronous subscribers run in
+// the background once Run is started, once per event: on the instance
+// relaying it from the outbox, or the publishing instance without one.
+// Broadcast subscribers run in the background on every instance when a
+// Fanout is set. A nil *Bus discards events, so publishers need not check
+// for one.
+type Bus struct {
+	opts    Options
+	origin  string
+	pending chan Envelope
+	wake    chan struct{}
+
+	mu        sync.RWMutex
+	tx        []subscription
+	sync      []subscription
+	async     []subscription
+	broadcast []subscription
+}
+
+// Kinds of subscription.
+const (
+	kindTx = iota
+	kindSync
+	kindAsync
+	kindBroadcast
+)
+
+// New returns a Bus. Start delivery to asynchronous subscribers with Run.
+func New(opts Options) *Bus {
+	opts.defaults()
+	return &Bus{
+		opts:    opts,
+		origin:  uuid.NewString(),
+		pending: make(chan Envelope, opts.Buffer),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Subscribe calls fn for the named events, or all events when no names are
+// given, before Publish returns. Its errors are returned by Publish.
+func (b *Bus) Subscribe(fn Handler, names ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sync = append(b.sync, newSubscription(fn, names))
+}
+
+// SubscribeTx calls fn for the named events, or all events when no names
+// are given, with the transaction of the store publishing them after the
+// change and before the commit; an error rolls the change back. Stores
+// without transactions publish once their change is made, so fn is then
+// called with a nil tx before Publish returns and its errors are returned
+// by Publish.
+func (b *Bus) SubscribeTx(fn TxHandler, names ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := newSubscription(nil, names)
+	s.txFn = fn
+	b.tx = append(b.tx, s)
+}
+
+// SubscribeAsync calls fn for the named events, or all events when no names
+// are given, in the background on one instance. fn may be called more than
+// once for the same event when an outbox retries it.
+func (b *Bus) SubscribeAsync(fn Handler, names ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.async = append(b.async, newSubscription(fn, names))
+}
+
+// SubscribeBroadcast calls fn for the named events, or all events when no
+// names are given, in the background on every instance, e.g. to drop state
+// each instance keeps about what the event changed. fn may be called more
+// than once for the same event.
+func (b *Bus) SubscribeBroadcast(fn Handler, names ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.broadcast = append(b.broadcast, newSubscription(fn, names))
+}
+
+func newSubscription(fn Handler, names []string) subscription {
+	s := subscription{fn: fn}
+	if len(names) > 0 {
+		s.names = make(map[string]bool, len(names))
+		for _, n := range names {
+			s.names[n] = true
+		}
+	}
+	return s
+}
+
+// Publish delivers e to synchronous subscribers and queues it for
+// asynchronous ones, returning the subscribers' errors and any error
+// appending e to the outbox.
+func (b *Bus) Publish(ctx context.Context, e Event) error {
+	if b == nil || e == nil {
+		return nil
+	}
+	env, err := b.envelope(e)
+	if err != nil {
+		return err
+	}
+	if err := b.dispatchTx(ctx, nil, env, e); err != nil {
+		return err
+	}
+	var errs []error
+	if b.opts.Outbox != nil {
+		if err := b.opts.Outbox.Append(nil, env); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(append(errs, b.published(ctx, env, e)...)...)
+}
+
+// Emit publishes es, which describe a change already made, logging rather
+// than returning errors. Stores without transactions call it once their
+// change is made.
+func (b *Bus) Emit(ctx context.Context, es ...Event) {
+	for _, e := range es {
+		if err := b.Publish(ctx, e); err != nil {
+			logging.Logger.Error().Err(err).Str("event", e.EventName()).Msg("publish event")
+		}
+	}
+}
+
+// EmitOnSuccess publishes es, as by Emit, unless *err is set. Stores without
+// transactions defer it before taking their lock, so it runs once the change
+// is made and the lock released:
+//
+//	defer s.bus.EmitOnSuccess(&err, es...)
+func (b *Bus) EmitOnSuccess(err *error, es ...Event) {
+	if *err == nil {
+		b.Emit(context.Background(), es...)
+	}
+}
+
+// Transaction runs fn in a transaction of db that publishes es.
+// Transactional subscribers are called in the transaction once fn succeeds,
+// and their errors roll it back. With an outbox es are appended in the
+// transaction, so asynchronous subscribers see
+// them if and only if it commits; without one they are queued once it has
+// committed. Synchronous subscribers are called after the commit, and their
+// errors logged rather than returned, since the change is made by then.
+// With nothing to publish fn is run on db directly.
+func (b *Bus) Transaction(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error, es ...Event) error {
+	if b == nil || len(es) == 0 {
+		return fn(db)
+	}
+	envs := make([]Envelope, len(es))
+	for i, e := range es {
+		env, err := b.envelope(e)
+		if err != nil {
+			return err
+		}
+		envs[i] = env
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if b.opts.Outbox != nil {
+			if err := b.opts.Outbox.Append(tx, envs...); err != nil {
+				return err
+			}
+		}
+		for i, env := range envs {
+			if err := b.dispatchTx(ctx, tx, env, es[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, env := range envs {
+		if err := errors.Join(b.published(ctx, env, es[i])...); err != nil {
+			logging.Logger.Error().Err(err).Str("event", env.Name).Msg("publish event")
+		}
+	}
+	return nil
+}
+
+// published delivers env, the envelope of e, to synchronous subscribers
+// once it is stored, and hands it to asynchronous ones: by waking the
+// outbox relay, or queueing it in memory without an outbox.
+func (b *Bus) published(ctx context.Context, env Envelope, e Event) []error {
+	metrics.EventsPublishedTotal.WithLabelValues(env.Name).Inc()
+	errs := b.dispatch(ctx, b.subscriptions(kindSync), Message{ID: env.ID, OccurredAt: env.OccurredAt, Event: e}, env.Name)
+	if b.opts.Outbox != nil {
+		b.notify()
+		return errs
+	}
+	select {
+	case b.pending <- env:
+	default:
+		metrics.EventsDroppedTotal.Inc()
+		logging.Logger.Warn().Str("event", env.Name).Str("event_id", env.ID).Msg("event queue full, dropping event")
+	}
+	return errs
+}
+
+// Attach makes every store that publishes events, by having a SetBus
+// method, publish them on b.
+func Attach(b *Bus, stores ...any) {
+	for _, s := range stores {
+		if st, ok := s.(interface{ SetBus(*Bus) }); ok {
+			st.SetBus(b)
+		}
+	}
+}
+
+func (b *Bus) envelope(e Event) (Envelope, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		ID:         uuid.NewString(),
+		Name:       e.EventName(),
+		OccurredAt: time.Now().UTC(),
+		Origin:     b.origin,
+		Payload:    payload,
+	}, nil
+}
+
+func (b *Bus) notify() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (b *Bus) subscriptions(kinds ...int) []subscription {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var out []subscription
+	for _, k := range kinds {
+		switch k {
+		case kindTx:
+			out = append(out, b.tx...)
+		case kindSync:
+			out = append(out, b.sync...)
+		case kindAsync:
+			out = append(out, b.async...)
+		case kindBroadcast:
+			out = append(out, b.broadcast...)
+		}
+	}
+	return out
+}
+
+// dispatch calls every subscription in subs wanting m, returning their
+// errors.
+func (b *Bus) dispatch(ctx context.Context, subs []subscription, m Message, name string) []error {
+	var errs []error
+	for _, s := range subs {
+		if !s.wants(name) {
+			continue
+		}
+		if err := s.fn(ctx, m); err != nil {
+			metrics.EventHandlerErrorsTotal.WithLabelValues(name).Inc()
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// dispatchTx calls the transactional subscribers wanting env, the envelope
+// of e, with tx, returning their errors.
+func (b *Bus) dispatchTx(ctx context.Context, tx *gorm.DB, env Envelope, e Event) error {
+	m := Message{ID: env.ID, OccurredAt: env.OccurredAt, Event: e}
+	var errs []error
+	for _, s := range b.subscriptions(kindTx) {
+		if !s.wants(env.Name) {
+			continue
+		}
+		if err := s.txFn(ctx, tx, m); err != nil {
+			metrics.EventHandlerErrorsTotal.WithLabelValues(env.Name).Inc()
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deliver calls the subscribers of kinds with env.
+func (b *Bus) deliver(ctx context.Context, env Envelope, kinds ...int) error {
+	e, err := env.decode()
+	if err != nil {
+		return err
+	}
+	return errors.Join(b.dispatch(ctx, b.subscriptions(kinds...), Message{ID: env.ID, OccurredAt: env.OccurredAt, Event: e}, env.Name)...)
+}
+
+// Run delivers events to asynchronous and broadcast subscribers until ctx is
+// done: those queued in memory or claimed from the outbox, and, to
+// broadcast subscribers only, those broadcast by other instances.
+func (b *Bus) Run(ctx context.Context) {
+	if b.opts.Fanout != nil {
+		go func() {
+			err := b.opts.Fanout.Listen(ctx, func(env Envelope) {
+				// This instance's events were delivered before they were
+				// broadcast.
+				if env.Origin == b.origin {
+					return
+				}
+				if err := b.deliver(ctx, env, kindBroadcast); err != nil {
+					logging.Logger.Warn().Err(err).Str("event", env.Name).Str("event_id", env.ID).Msg("deliver remote event")
+				}
+			})
+			if err != nil && ctx.Err() == nil {
+				logging.Logger.Error().Err(err).Msg("listen for remote events")
+			}
+		}()
+	}
+	ticker := time.NewTicker(b.opts.PollInterval)
+	defer ticker.Stop()
+	var pruned time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case env := <-b.pending:
+			b.deliverPending(ctx, env)
+		case <-b.wake:
+		case <-ticker.C:
+		}
+		if b.opts.Outbox == nil {
+			continue
+		}
+		now := time.Now().UTC()
+		if _, err := b.RelayDue(ctx, now); err != nil && ctx.Err() == nil {
+			logging.Logger.Error().Err(err).Msg("relay outbox events")
+		}
+		if now.Sub(pruned) >= time.Hour {
+			if n, err := b.opts.Outbox.Prune(now.Add(-b.opts.Retention)); err != nil {
+				logging.Logger.Error().Err(err).Msg("prune event outbox")
+			} else if n > 0 {
+				logging.Logger.Info().Int64("deleted", n).Msg("pruned event outbox")
+			}
+			pruned = now
+		}
+	}
+}
+
+// deliverPending delivers env, queued in memory, to this instance's
+// asynchronous and broadcast subscribers and shares it with other instances.
+func (b *Bus) deliverPending(ctx context.Context, env Envelope) {
+	if err := b.deliver(ctx, env, kindAsync, kindBroadcast); err != nil {
+		logging.Logger.Warn().Err(err).Str("event", env.Name).Str("event_id", env.ID).Msg("deliver event")
+	}
+	b.share(ctx, env)
+}
+
+// Flush delivers the events queued in memory and those due in the outbox,
+// returning once subscribers have handled them. Call it after Run has
+// stopped, e.g. on shutdown, so queued events are not lost.
+func (b *Bus) Flush(ctx context.Context) {
+	if b == nil {
+		return
+	}
+	for {
+		select {
+		case env := <-b.pending:
+			b.deliverPending(ctx, env)
+			continue
+		default:
+		}
+		break
+	}
+	if _, err := b.RelayDue(ctx, time.Now().UTC()); err != nil && ctx.Err() == nil {
+		logging.Logger.Error().Err(err).Msg("relay outbox events")
+	}
+}
+
+// share sends env to other instances as delivered by this one.
+func (b *Bus) share(ctx context.Context, env Envelope) error {
+	if b.opts.Fanout == nil {
+		return nil
+	}
+	env.Origin = b.origin
+	err := b.opts.Fanout.Broadcast(ctx, env)
+	if err != nil && ctx.Err() == nil {
+		logging.Logger.Warn().Err(err).Str("event", env.Name).Str("event_id", env.ID).Msg("broadcast event")
+	}
+	return err
+}
+
+// RelayDue delivers the outbox events due at now to asynchronous
+// subscribers and broadcasts them, retrying those that fail later. An event
+// is published once this instance's subscribers have handled it; a failed
+// broadcast is only logged, as other instances' broadcast subscribers must
+// not hold back or repeat delivery here. It reports how many were delivered.
+func (b *Bus) RelayDue(ctx context.Context, now time.Time) (int, error) {
+	if b.opts.Outbox == nil {
+		return 0, nil
+	}
+	due, err := b.opts.Outbox.ClaimDue(now, now.Add(b.opts.Lease), claimBatch)
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for _, entry := range due {
+		if err := ctx.Err(); err != nil {
+			return delivered, err
+		}
+		env := entry.envelope()
+		err := b.deliver(ctx, env, kindAsync, kindBroadcast)
+		if err == nil {
+			b.share(ctx, env)
+		}
+		entry.Attempts++
+		switch {
+		case err == nil:
+			entry.Status, entry.Error, entry.PublishedAt = StatusPublished, "", &now
+			delivered++
+		case entry.Attempts >= b.opts.MaxAttempts || errors.Is(err, ErrUnknownEvent):
+			entry.Status, entry.Error = StatusFailed, utils.Truncate(err.Error(), maxError)
+		default:
+			entry.Error = utils.Truncate(err.Error(), maxError)
+			entry.NextAttemptAt = now.Add(b.opts.Backoff << (entry.Attempts - 1))
+		}
+		if err != nil {
+			logging.Logger.Warn().Err(err).Str("event", entry.Name).Str("event_id", entry.ID).
+				Int("attempts", entry.Attempts).Msg("relay outbox event")
+		}
+		if err := b.opts.Outbox.Update(entry); err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+// ErrUnknownEvent is returned for events whose name was not registered.
+var ErrUnknownEvent = errors.New("unknown event")
+
+// maxError is the size of OutboxEntry.Error.
+const maxError = 1024
@@ -0,0 +1,362 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestOutbox(t *testing.T) *Outbox {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	return NewOutbox(db)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNilBusDiscards(t *testing.T) {
+	var b *Bus
+	if err := b.Publish(context.Background(), KeyRevoked{KeyID: "k1"}); err != nil {
+		t.Fatalf("publish on nil bus: %v", err)
+	}
+}
+
+func TestSyncSubscribers(t *testing.T) {
+	b := New(Options{})
+	var got []string
+	b.Subscribe(Typed(func(_ context.Context, m Message, e KeyCreated) error {
+		if m.ID == "" || m.OccurredAt.IsZero() {
+			t.Errorf("message not stamped: %+v", m)
+		}
+		got = append(got, "typed:"+e.KeyID)
+		return nil
+	}), NameKeyCreated)
+	b.Subscribe(func(_ context.Context, m Message) error {
+		got = append(got, "all:"+m.Event.EventName())
+		return nil
+	})
+	failure := errors.New("boom")
+	b.Subscribe(func(context.Context, Message) error { return failure }, NameServiceUpdated)
+
+	ctx := context.Background()
+	if err := b.Publish(ctx, KeyCreated{KeyID: "k1"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if err := b.Publish(ctx, ServiceUpdated{ServiceID: "s1"}); !errors.Is(err, failure) {
+		t.Fatalf("expected subscriber error, got %v", err)
+	}
+	want := []string{"typed:k1", "all:key.created", "all:service.updated"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestAsyncSubscribers(t *testing.T) {
+	b := New(Options{})
+	got := make(chan Message, 4)
+	b.SubscribeAsync(func(_ context.Context, m Message) error {
+		got <- m
+		return nil
+	}, NameMemberAdded)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	b.Publish(ctx, OrgCreated{OrgID: "o1"})
+	b.Publish(ctx, MemberAdded{OrgID: "o1", UserID: "u1", Role: "admin"})
+	select {
+	case m := <-got:
+		if e, ok := m.Event.(MemberAdded); !ok || e.UserID != "u1" || e.Role != "admin" {
+			t.Fatalf("unexpected event %+v", m.Event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event not delivered")
+	}
+	select {
+	case m := <-got:
+		t.Fatalf("unsubscribed event delivered: %+v", m.Event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestOutboxRetriesFailedDelivery(t *testing.T) {
+	outbox := newTestOutbox(t)
+	b := New(Options{Outbox: outbox, Backoff: time.Minute, MaxAttempts: 3})
+	calls := 0
+	b.SubscribeAsync(Typed(func(_ context.Context, _ Message, e RootKeyRotated) error {
+		calls++
+		if calls == 1 {
+			return errors.New("unavailable")
+		}
+		return nil
+	}), NameRootKeyRotated)
+
+	ctx := context.Background()
+	var id string
+	b.Subscribe(func(_ context.Context, m Message) error { id = m.ID; return nil })
+	if err := b.Publish(ctx, RootKeyRotated{RootKeyID: "rk1"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	now := time.Now().UTC()
+	if n, err := b.RelayDue(ctx, now); err != nil || n != 0 {
+		t.Fatalf("first relay: n=%d err=%v", n, err)
+	}
+	entry, err := outbox.Get(id)
+	if err != nil {
+		t.Fatalf("get entry: %v", err)
+	}
+	if entry.Status != StatusPending || entry.Attempts != 1 || entry.Error != "unavailable" {
+		t.Fatalf("unexpected entry after failure: %+v", entry)
+	}
+	// Not due again until the backoff has passed.
+	if n, _ := b.RelayDue(ctx, now.Add(30*time.Second)); n != 0 || calls != 1 {
+		t.Fatalf("retried early: n=%d calls=%d", n, calls)
+	}
+	if n, err := b.RelayDue(ctx, now.Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("retry: n=%d err=%v", n, err)
+	}
+	entry, _ = outbox.Get(id)
+	if entry.Status != StatusPublished || entry.Attempts != 2 || entry.PublishedAt == nil {
+		t.Fatalf("unexpected entry after retry: %+v", entry)
+	}
+
+	if n, err := outbox.Prune(now.Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("prune: n=%d err=%v", n, err)
+	}
+}
+
+func TestOutboxFailsAfterMaxAttempts(t *testing.T) {
+	outbox := newTestOutbox(t)
+	b := New(Options{Outbox: outbox, Backoff: time.Second, MaxAttempts: 2})
+	b.SubscribeAsync(func(context.Context, Message) error { return errors.New("down") })
+	ctx := context.Background()
+	b.Publish(ctx, ServiceDeleted{ServiceID: "s1"})
+	// Events of unknown names fail at once.
+	outbox.Append(nil, Envelope{ID: "unknown", Name: "thing.happened", OccurredAt: time.Now().UTC(), Payload: []byte("{}")})
+
+	now := time.Now().UTC().Add(time.Second)
+	b.RelayDue(ctx, now)
+	b.RelayDue(ctx, now.Add(time.Hour))
+	var entries []OutboxEntry
+	outbox.db.Find(&entries)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	for _, e := range entries {
+		want := 2
+		if e.ID == "unknown" {
+			want = 1
+		}
+		if e.Status != StatusFailed || e.Attempts != want {
+			t.Fatalf("unexpected entry %+v", e)
+		}
+	}
+}
+
+type failingFanout struct{}
+
+func (failingFanout) Broadcast(context.Context, Envelope) error { return errors.New("redis down") }
+
+func (failingFanout) Listen(ctx context.Context, _ func(Envelope)) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestOutboxPublishesDespiteFailedBroadcast(t *testing.T) {
+	outbox := newTestOutbox(t)
+	b := New(Options{Outbox: outbox, Fanout: failingFanout{}, Backoff: time.Second, MaxAttempts: 1})
+	calls := 0
+	b.SubscribeAsync(func(context.Context, Message) error { calls++; return nil })
+	var id string
+	b.Subscribe(func(_ context.Context, m Message) error { id = m.ID; return nil })
+
+	ctx := context.Background()
+	if err := b.Publish(ctx, ServiceDeleted{ServiceID: "s1"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	now := time.Now().UTC()
+	if n, err := b.RelayDue(ctx, now); err != nil || n != 1 {
+		t.Fatalf("relay: n=%d err=%v", n, err)
+	}
+	b.RelayDue(ctx, now.Add(time.Hour))
+	entry, err := outbox.Get(id)
+	if err != nil {
+		t.Fatalf("get entry: %v", err)
+	}
+	if entry.Status != StatusPublished || entry.Attempts != 1 || calls != 1 {
+		t.Fatalf("expected one delivery and a published entry, got calls=%d %+v", calls, entry)
+	}
+}
+
+func TestRedisFanout(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var async []string
+	var mu sync.Mutex
+	newInstance := func(name string) (*Bus, chan Message) {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		b := New(Options{Fanout: NewRedisFanout(client)})
+		got := make(chan Message, 4)
+		b.SubscribeBroadcast(func(_ context.Context, m Message) error {
+			got <- m
+			return nil
+		})
+		b.SubscribeAsync(func(context.Context, Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			async = append(async, name)
+			return nil
+		})
+		go b.Run(ctx)
+		return b, got
+	}
+	local, mine := newInstance("local")
+	_, theirs := newInstance("remote")
+	waitFor(t, func() bool { return mr.PubSubNumSub(Channel)[Channel] == 2 })
+
+	local.Publish(ctx, KeyUsed{KeyID: "k1", OrgID: "o1", Service: "svc"})
+	for name, c := range map[string]chan Message{"local": mine, "remote": theirs} {
+		select {
+		case m := <-c:
+			if e, ok := m.Event.(KeyUsed); !ok || e.KeyID != "k1" || e.Service != "svc" {
+				t.Fatalf("%s: unexpected event %+v", name, m.Event)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: event not delivered", name)
+		}
+	}
+	// The publishing instance must not deliver its own event again.
+	select {
+	case m := <-mine:
+		t.Fatalf("event delivered twice: %+v", m)
+	case <-time.After(100 * time.Millisecond):
+	}
+	// Asynchronous subscribers see the event on one instance only.
+	mu.Lock()
+	defer mu.Unlock()
+	if len(async) != 1 || async[0] != "local" {
+		t.Fatalf("async deliveries = %v, want [local]", async)
+	}
+}
+
+func TestTransactionPublishesOnCommit(t *testing.T) {
+	outbox := newTestOutbox(t)
+	db := outbox.db
+	b := New(Options{Outbox: outbox})
+	var synced, delivered []string
+	b.Subscribe(func(_ context.Context, m Message) error {
+		synced = append(synced, m.Event.(KeyRevoked).KeyID)
+		return nil
+	})
+	b.SubscribeAsync(func(_ context.Context, m Message) error {
+		delivered = append(delivered, m.Event.(KeyRevoked).KeyID)
+		return nil
+	})
+	ctx := context.Background()
+
+	failure := errors.New("boom")
+	err := b.Transaction(ctx, db, func(*gorm.DB) error { return failure }, KeyRevoked{KeyID: "k1"})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected fn error, got %v", err)
+	}
+	if err := b.Transaction(ctx, db, func(*gorm.DB) error { return nil }, KeyRevoked{KeyID: "k2"}); err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+	var entries []OutboxEntry
+	db.Find(&entries)
+	if len(entries) != 1 || len(synced) != 1 || synced[0] != "k2" {
+		t.Fatalf("rolled back event published: entries=%d synced=%v", len(entries), synced)
+	}
+	if len(delivered) != 0 {
+		t.Fatalf("async subscriber called before relay: %v", delivered)
+	}
+	b.Flush(ctx)
+	if len(delivered) != 1 || delivered[0] != "k2" {
+		t.Fatalf("delivered = %v, want [k2]", delivered)
+	}
+}
+
+func TestTxSubscribersShareTheTransaction(t *testing.T) {
+	db := newTestOutbox(t).db
+	type row struct{ ID string }
+	if err := db.AutoMigrate(&row{}); err != nil {
+		t.Fatal(err)
+	}
+	b := New(Options{})
+	failure := errors.New("boom")
+	b.SubscribeTx(func(_ context.Context, tx *gorm.DB, m Message) error {
+		id := m.Event.(KeyRevoked).KeyID
+		if id == "k2" {
+			return failure
+		}
+		return tx.Create(&row{ID: "audit-" + id}).Error
+	})
+	ctx := context.Background()
+
+	change := func(id string) func(*gorm.DB) error {
+		return func(tx *gorm.DB) error { return tx.Create(&row{ID: id}).Error }
+	}
+	if err := b.Transaction(ctx, db, change("k1"), KeyRevoked{KeyID: "k1"}); err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+	if err := b.Transaction(ctx, db, change("k2"), KeyRevoked{KeyID: "k2"}); !errors.Is(err, failure) {
+		t.Fatalf("expected subscriber error, got %v", err)
+	}
+	var ids []string
+	db.Model(&row{}).Order("id").Pluck("id", &ids)
+	if len(ids) != 2 || ids[0] != "audit-k1" || ids[1] != "k1" {
+		t.Fatalf("rows = %v, want the first change and its record only", ids)
+	}
+
+	// Without a transaction the subscriber runs in Publish with a nil tx.
+	var gotTx *gorm.DB = db
+	b = New(Options{})
+	b.SubscribeTx(func(_ context.Context, tx *gorm.DB, _ Message) error {
+		gotTx = tx
+		return failure
+	})
+	if err := b.Publish(ctx, KeyRevoked{KeyID: "k3"}); !errors.Is(err, failure) || gotTx != nil {
+		t.Fatalf("publish: err=%v tx=%v", err, gotTx)
+	}
+}
+
+func TestFlushDeliversQueuedEvents(t *testing.T) {
+	b := New(Options{})
+	var delivered []string
+	b.SubscribeAsync(func(_ context.Context, m Message) error {
+		delivered = append(delivered, m.Event.EventName())
+		return nil
+	})
+	b.Emit(context.Background(), KeyRevoked{KeyID: "k1"}, ServiceDeleted{ServiceID: "s1"})
+	b.Flush(context.Background())
+	if len(delivered) != 2 || delivered[0] != NameKeyRevoked || delivered[1] != NameServiceDeleted {
+		t.Fatalf("delivered = %v", delivered)
+	}
+}
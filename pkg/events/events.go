@@ -0,0 +1,389 @@
+// Package events is an in-process bus for domain events such as a key being
+// created or a service being updated. Handlers and stores publish events;
+// subscribers react to them without the publisher knowing about them.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Event names.
+const (
+	NameKeyCreated            = "key.created"
+	NameKeyRevoked            = "key.revoked"
+	NameKeyExpired            = "key.expired"
+	NameKeyUsed               = "key.used"
+	NameRootKeyCreated        = "root_key.created"
+	NameRootKeyRotated        = "root_key.rotated"
+	NameRootKeyDeleted        = "root_key.deleted"
+	NameServiceCreated        = "service.created"
+	NameServiceUpdated        = "service.updated"
+	NameServiceDeleted        = "service.deleted"
+	NameOrgCreated            = "org.created"
+	NameOrgDeleted            = "org.deleted"
+	NameMemberAdded           = "member.added"
+	NameMemberRemoved         = "member.removed"
+	NameServiceAccountCreated = "service_account.created"
+	NameServiceAccountDeleted = "service_account.deleted"
+	NameUserCreated           = "user.created"
+	NameQuotaCreated          = "quota.created"
+	NameQuotaDeleted          = "quota.deleted"
+	NameWebhookCreated        = "webhook.created"
+	NameWebhookUpdated        = "webhook.updated"
+	NameWebhookDeleted        = "webhook.deleted"
+	NameWebhookRedelivered    = "webhook.redelivered"
+	NameAnomalyResolved       = "anomaly.resolved"
+	NameAnomalyPolicyUpdated  = "anomaly_policy.updated"
+	NameSetupCompleted        = "setup.completed"
+)
+
+// Event is a domain event. Events carry IDs and plain values rather than the
+// records they describe, so they stay small, serialize to JSON and never
+// hold secrets.
+type Event interface {
+	// EventName returns the event's name, e.g. "key.created".
+	EventName() string
+}
+
+// Meta describes what caused an event, for subscribers such as the audit
+// log. Every event of this package embeds it.
+type Meta struct {
+	// ActorType is user, service_account or mcp, and Actor the ID of the
+	// one that caused the event, when known.
+	ActorType string `json:"actor_type,omitempty"`
+	Actor     string `json:"actor,omitempty"`
+	// RequestID and SourceIP identify the API request that caused it.
+	RequestID string `json:"request_id,omitempty"`
+	SourceIP  string `json:"source_ip,omitempty"`
+	// Changes holds the fields of the record that changed, as reported by
+	// audit.Diff with secrets redacted.
+	Changes json.RawMessage `json:"changes,omitempty"`
+}
+
+// EventMeta returns m, so the Meta of any event embedding it can be read
+// through the Described interface.
+func (m Meta) EventMeta() Meta { return m }
+
+// Described is implemented by events embedding a Meta.
+type Described interface {
+	Event
+	EventMeta() Meta
+}
+
+// KeyCreated is published when a virtual key is created.
+type KeyCreated struct {
+	KeyID     string    `json:"key_id"`
+	OrgID     string    `json:"org_id,omitempty"`
+	Target    string    `json:"target"`
+	Scope     string    `json:"scope,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Meta
+}
+
+// KeyRevoked is published when a virtual key is deleted.
+type KeyRevoked struct {
+	KeyID string `json:"key_id"`
+	OrgID string `json:"org_id,omitempty"`
+	Meta
+}
+
+// KeyExpired is published once a virtual key has passed its ExpiresAt.
+type KeyExpired struct {
+	KeyID     string    `json:"key_id"`
+	OrgID     string    `json:"org_id,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Meta
+}
+
+// KeyUsed is published when a one-shot key is spent.
+type KeyUsed struct {
+	KeyID   string `json:"key_id"`
+	OrgID   string `json:"org_id,omitempty"`
+	Service string `json:"service"`
+	Meta
+}
+
+// RootKeyCreated is published when a root key is stored.
+type RootKeyCreated struct {
+	RootKeyID string `json:"root_key_id"`
+	OrgID     string `json:"org_id,omitempty"`
+	Meta
+}
+
+// RootKeyRotated is published when a root key is replaced.
+type RootKeyRotated struct {
+	RootKeyID string `json:"root_key_id"`
+	OrgID     string `json:"org_id,omitempty"`
+	Meta
+}
+
+// RootKeyDeleted is published when a root key is deleted.
+type RootKeyDeleted struct {
+	RootKeyID string `json:"root_key_id"`
+	OrgID     string `json:"org_id,omitempty"`
+	Meta
+}
+
+// ServiceCreated is published when a service is created.
+type ServiceCreated struct {
+	ServiceID string `json:"service_id"`
+	OrgID     string `json:"org_id,omitempty"`
+	RootKeyID string `json:"root_key_id"`
+	Meta
+}
+
+// ServiceUpdated is published when a service is replaced.
+type ServiceUpdated struct {
+	ServiceID string `json:"service_id"`
+	OrgID     string `json:"org_id,omitempty"`
+	RootKeyID string `json:"root_key_id"`
+	Meta
+}
+
+// ServiceDeleted is published when a service is deleted.
+type ServiceDeleted struct {
+	ServiceID string `json:"service_id"`
+	OrgID     string `json:"org_id,omitempty"`
+	Meta
+}
+
+// OrgCreated is published when an organization is created.
+type OrgCreated struct {
+	OrgID string `json:"org_id"`
+	Name  string `json:"name"`
+	Meta
+}
+
+// OrgDeleted is published when an organization is deleted.
+type OrgDeleted struct {
+	OrgID string `json:"org_id"`
+	Meta
+}
+
+// MemberAdded is published when a user joins an organization.
+type MemberAdded struct {
+	OrgID  string `json:"org_id"`
+	UserID string `json:"user_id"`
+	Role   string `json:"role"`
+	Meta
+}
+
+// MemberRemoved is published when a user leaves an organization.
+type MemberRemoved struct {
+	OrgID  string `json:"org_id"`
+	UserID string `json:"user_id"`
+	Meta
+}
+
+// ServiceAccountCreated is published when a service account is created.
+type ServiceAccountCreated struct {
+	ServiceAccountID string `json:"service_account_id"`
+	OrgID            string `json:"org_id,omitempty"`
+	Meta
+}
+
+// ServiceAccountDeleted is published when a service account is deleted.
+type ServiceAccountDeleted struct {
+	ServiceAccountID string `json:"service_account_id"`
+	OrgID            string `json:"org_id,omitempty"`
+	Meta
+}
+
+// UserCreated is published when a user is created.
+type UserCreated struct {
+	UserID string `json:"user_id"`
+	// OrgID is the org of the user who created them, if any.
+	OrgID string `json:"org_id,omitempty"`
+	Meta
+}
+
+// QuotaCreated is published when a quota is created. OrgID is the org
+// whose requests it limits, if any.
+type QuotaCreated struct {
+	QuotaID string `json:"quota_id"`
+	OrgID   string `json:"org_id,omitempty"`
+	Meta
+}
+
+// QuotaDeleted is published when a quota is deleted.
+type QuotaDeleted struct {
+	QuotaID string `json:"quota_id"`
+	OrgID   string `json:"org_id,omitempty"`
+	Meta
+}
+
+// WebhookCreated is published when a webhook is registered.
+type WebhookCreated struct {
+	WebhookID string `json:"webhook_id"`
+	OrgID     string `json:"org_id"`
+	Meta
+}
+
+// WebhookUpdated is published when a webhook is replaced.
+type WebhookUpdated struct {
+	WebhookID string `json:"webhook_id"`
+	OrgID     string `json:"org_id"`
+	Meta
+}
+
+// WebhookDeleted is published when a webhook is deleted.
+type WebhookDeleted struct {
+	WebhookID string `json:"webhook_id"`
+	OrgID     string `json:"org_id"`
+	Meta
+}
+
+// WebhookRedelivered is published when a delivery is queued again.
+type WebhookRedelivered struct {
+	DeliveryID string `json:"delivery_id"`
+	WebhookID  string `json:"webhook_id"`
+	OrgID      string `json:"org_id"`
+	Meta
+}
+
+// AnomalyResolved is published when an anomaly flag is resolved.
+type AnomalyResolved struct {
+	FlagID string `json:"flag_id"`
+	KeyID  string `json:"key_id"`
+	OrgID  string `json:"org_id,omitempty"`
+	Meta
+}
+
+// AnomalyPolicyUpdated is published when an org's anomaly policy is set.
+type AnomalyPolicyUpdated struct {
+	OrgID string `json:"org_id"`
+	Meta
+}
+
+// SetupCompleted is published when the first user and org are created.
+type SetupCompleted struct {
+	UserID string `json:"user_id"`
+	OrgID  string `json:"org_id"`
+	Meta
+}
+
+func (KeyCreated) EventName() string            { return NameKeyCreated }
+func (KeyRevoked) EventName() string            { return NameKeyRevoked }
+func (KeyExpired) EventName() string            { return NameKeyExpired }
+func (KeyUsed) EventName() string               { return NameKeyUsed }
+func (RootKeyCreated) EventName() string        { return NameRootKeyCreated }
+func (RootKeyRotated) EventName() string        { return NameRootKeyRotated }
+func (RootKeyDeleted) EventName() string        { return NameRootKeyDeleted }
+func (ServiceCreated) EventName() string        { return NameServiceCreated }
+func (ServiceUpdated) EventName() string        { return NameServiceUpdated }
+func (ServiceDeleted) EventName() string        { return NameServiceDeleted }
+func (OrgCreated) EventName() string            { return NameOrgCreated }
+func (OrgDeleted) EventName() string            { return NameOrgDeleted }
+func (MemberAdded) EventName() string           { return NameMemberAdded }
+func (MemberRemoved) EventName() string         { return NameMemberRemoved }
+func (ServiceAccountCreated) EventName() string { return NameServiceAccountCreated }
+func (ServiceAccountDeleted) EventName() string { return NameServiceAccountDeleted }
+func (UserCreated) EventName() string           { return NameUserCreated }
+func (QuotaCreated) EventName() string          { return NameQuotaCreated }
+func (QuotaDeleted) EventName() string          { return NameQuotaDeleted }
+func (WebhookCreated) EventName() string        { return NameWebhookCreated }
+func (WebhookUpdated) EventName() string        { return NameWebhookUpdated }
+func (WebhookDeleted) EventName() string        { return NameWebhookDeleted }
+func (WebhookRedelivered) EventName() string    { return NameWebhookRedelivered }
+func (AnomalyResolved) EventName() string       { return NameAnomalyResolved }
+func (AnomalyPolicyUpdated) EventName() string  { return NameAnomalyPolicyUpdated }
+func (SetupCompleted) EventName() string        { return NameSetupCompleted }
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]func(json.RawMessage) (Event, error){}
+)
+
+// Register makes events of type E decodable when they arrive from the
+// outbox or another instance. The events of this package are registered.
+func Register[E Event]() {
+	var zero E
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders[zero.EventName()] = func(raw json.RawMessage) (Event, error) {
+		var e E
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+}
+
+func init() {
+	Register[KeyCreated]()
+	Register[KeyRevoked]()
+	Register[KeyExpired]()
+	Register[KeyUsed]()
+	Register[RootKeyCreated]()
+	Register[RootKeyRotated]()
+	Register[RootKeyDeleted]()
+	Register[ServiceCreated]()
+	Register[ServiceUpdated]()
+	Register[ServiceDeleted]()
+	Register[OrgCreated]()
+	Register[OrgDeleted]()
+	Register[MemberAdded]()
+	Register[MemberRemoved]()
+	Register[ServiceAccountCreated]()
+	Register[ServiceAccountDeleted]()
+	Register[UserCreated]()
+	Register[QuotaCreated]()
+	Register[QuotaDeleted]()
+	Register[WebhookCreated]()
+	Register[WebhookUpdated]()
+	Register[WebhookDeleted]()
+	Register[WebhookRedelivered]()
+	Register[AnomalyResolved]()
+	Register[AnomalyPolicyUpdated]()
+	Register[SetupCompleted]()
+}
+
+// Envelope is the serialized form of an event, as stored in the outbox and
+// sent between instances.
+type Envelope struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Origin     string          `json:"origin"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// decode returns the typed event carried by env. It fails for names not
+// registered.
+func (env Envelope) decode() (Event, error) {
+	decodersMu.RLock()
+	dec, ok := decoders[env.Name]
+	decodersMu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownEvent
+	}
+	return dec(env.Payload)
+}
+
+// Message is an event as delivered to subscribers.
+type Message struct {
+	// ID identifies the event. An event delivered more than once, e.g.
+	// retried from the outbox, keeps its ID, so subscribers can use it to
+	// ignore repeats.
+	ID         string
+	OccurredAt time.Time
+	Event      Event
+}
+
+// Handler reacts to an event.
+type Handler func(ctx context.Context, m Message) error
+
+// Typed adapts fn to a Handler called only for events of type E.
+func Typed[E Event](fn func(ctx context.Context, m Message, e E) error) Handler {
+	return func(ctx context.Context, m Message) error {
+		e, ok := m.Event.(E)
+		if !ok {
+			return nil
+		}
+		return fn(ctx, m, e)
+	}
+}
@@ -0,0 +1,66 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Fanout shares events between instances.
+type Fanout interface {
+	// Broadcast sends env to every instance.
+	Broadcast(ctx context.Context, env Envelope) error
+	// Listen calls fn for every envelope broadcast, including this
+	// instance's own, until ctx is done.
+	Listen(ctx context.Context, fn func(Envelope)) error
+}
+
+// Channel is the Redis pub/sub channel events are shared on.
+const Channel = "bifrost:events"
+
+// RedisFanout shares events over Redis pub/sub. Instances that are not
+// subscribed when an event is broadcast miss it.
+type RedisFanout struct {
+	client redis.UniversalClient
+}
+
+// NewRedisFanout returns a fan-out over client.
+func NewRedisFanout(client redis.UniversalClient) *RedisFanout {
+	return &RedisFanout{client: client}
+}
+
+// Broadcast implements Fanout.
+func (f *RedisFanout) Broadcast(ctx context.Context, env Envelope) error {
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return f.client.Publish(ctx, Channel, payload).Err()
+}
+
+// Listen implements Fanout.
+func (f *RedisFanout) Listen(ctx context.Context, fn func(Envelope)) error {
+	sub := f.client.Subscribe(ctx, Channel)
+	defer sub.Close()
+	// Surface a failed subscription instead of listening on nothing.
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case m, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			var env Envelope
+			if err := json.Unmarshal([]byte(m.Payload), &env); err != nil {
+				continue
+			}
+			fn(env)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package events
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/farovictor/bifrost/pkg/database"
+)
+
+// Outbox entry statuses.
+const (
+	StatusPending   = "pending"
+	StatusPublished = "published"
+	StatusFailed    = "failed"
+)
+
+// OutboxEntry is an event waiting in the outbox to be delivered to
+// asynchronous subscribers.
+type OutboxEntry struct {
+	ID         string    `gorm:"primaryKey;size:64"`
+	Name       string    `gorm:"size:64;not null"`
+	Payload    string    `gorm:"type:text;not null"`
+	Origin     string    `gorm:"size:64;not null;default:''"`
+	OccurredAt time.Time `gorm:"not null;index"`
+	Status     string    `gorm:"size:16;not null;index"`
+	Attempts   int       `gorm:"not null;default:0"`
+	// Error describes why the last attempt failed.
+	Error         string    `gorm:"size:1024;not null;default:''"`
+	NextAttemptAt time.Time `gorm:"not null;index"`
+	PublishedAt   *time.Time
+}
+
+func (OutboxEntry) TableName() string { return "event_outbox" }
+
+func (o OutboxEntry) envelope() Envelope {
+	return Envelope{ID: o.ID, Name: o.Name, OccurredAt: o.OccurredAt, Origin: o.Origin, Payload: []byte(o.Payload)}
+}
+
+// Outbox persists events in a SQL table so they are delivered at least once,
+// even if the instance publishing them stops. Writing events in the same
+// transaction as the change they describe makes them exactly as durable as
+// the change.
+type Outbox struct {
+	db *gorm.DB
+}
+
+// NewOutbox returns an outbox stored in db.
+func NewOutbox(db *gorm.DB) *Outbox {
+	db.AutoMigrate(&OutboxEntry{})
+	return &Outbox{db: db}
+}
+
+// Append stores envs as pending using tx, or the outbox's database when tx
+// is nil. Events already in the outbox are ignored.
+func (o *Outbox) Append(tx *gorm.DB, envs ...Envelope) error {
+	if tx == nil {
+		tx = o.db
+	}
+	for _, env := range envs {
+		err := tx.Create(&OutboxEntry{
+			ID:            env.ID,
+			Name:          env.Name,
+			Payload:       string(env.Payload),
+			Origin:        env.Origin,
+			OccurredAt:    env.OccurredAt,
+			Status:        StatusPending,
+			NextAttemptAt: env.OccurredAt,
+		}).Error
+		if err != nil && !database.IsDuplicateError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the entry with id.
+func (o *Outbox) Get(id string) (OutboxEntry, error) {
+	var e OutboxEntry
+	err := o.db.First(&e, "id = ?", id).Error
+	return e, err
+}
+
+// ClaimDue returns up to limit pending entries due at now, keeping them
+// from other instances until until.
+func (o *Outbox) ClaimDue(now, until time.Time, limit int) ([]OutboxEntry, error) {
+	var due []OutboxEntry
+	if err := o.db.Where("status = ? AND next_attempt_at <= ?", StatusPending, now).
+		Order("next_attempt_at").Limit(limit).Find(&due).Error; err != nil {
+		return nil, err
+	}
+	claimed := due[:0]
+	for _, e := range due {
+		res := o.db.Model(&OutboxEntry{}).
+			Where("id = ? AND status = ? AND next_attempt_at = ?", e.ID, StatusPending, e.NextAttemptAt).
+			Update("next_attempt_at", until)
+		if res.Error != nil {
+			return claimed, res.Error
+		}
+		if res.RowsAffected == 1 {
+			e.NextAttemptAt = until
+			claimed = append(claimed, e)
+		}
+	}
+	return claimed, nil
+}
+
+// Update replaces an existing entry.
+func (o *Outbox) Update(e OutboxEntry) error {
+	return o.db.Model(&OutboxEntry{}).Where("id = ?", e.ID).Select("*").Updates(e).Error
+}
+
+// Prune deletes published and failed entries that occurred before cutoff.
+func (o *Outbox) Prune(cutoff time.Time) (int64, error) {
+	res := o.db.Where("status <> ? AND occurred_at < ?", StatusPending, cutoff).Delete(&OutboxEntry{})
+	return res.RowsAffected, res.Error
+}
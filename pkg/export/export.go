@@ -0,0 +1,143 @@
+// Package export writes rows of a fixed schema as CSV, JSON lines or
+// Parquet. Every format has the same columns in the same order, and rows are
+// written as they come so exports of any size use bounded memory.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/parquet"
+)
+
+// Formats.
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+// ErrInvalidFormat is returned for an unknown format.
+var ErrInvalidFormat = errors.New("invalid format: use csv, jsonl or parquet")
+
+// Column is one column of an export. Values are string, int32, int64,
+// float64 or time.Time, as given by Type.
+type Column struct {
+	Name string
+	Type parquet.Type
+}
+
+// Writer writes rows in one format.
+type Writer interface {
+	// Write writes a row holding one value per column.
+	Write(row []any) error
+	// Close flushes buffered output and writes any trailer. It does not
+	// close the underlying writer.
+	Close() error
+}
+
+// Check returns ErrInvalidFormat unless format is a known format.
+func Check(format string) error {
+	switch format {
+	case FormatCSV, FormatJSONL, FormatParquet:
+		return nil
+	}
+	return ErrInvalidFormat
+}
+
+// ContentType returns the media type of a format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatJSONL:
+		return "application/x-ndjson"
+	}
+	return "application/vnd.apache.parquet"
+}
+
+// NewWriter returns a Writer writing rows of columns to w in format.
+func NewWriter(format string, w io.Writer, columns []Column) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		header := make([]string, len(columns))
+		for i, c := range columns {
+			header[i] = c.Name
+		}
+		if err := cw.Write(header); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: cw, record: make([]string, len(columns))}, nil
+	case FormatJSONL:
+		return &jsonlWriter{w: w, columns: columns}, nil
+	case FormatParquet:
+		schema := make([]parquet.Column, len(columns))
+		for i, c := range columns {
+			schema[i] = parquet.Column{Name: c.Name, Type: c.Type}
+		}
+		return parquet.NewWriter(w, schema), nil
+	}
+	return nil, ErrInvalidFormat
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (x *csvWriter) Write(row []any) error {
+	for i, v := range row {
+		switch v := v.(type) {
+		case string:
+			x.record[i] = v
+		case int32:
+			x.record[i] = strconv.FormatInt(int64(v), 10)
+		case int64:
+			x.record[i] = strconv.FormatInt(v, 10)
+		case float64:
+			x.record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case time.Time:
+			x.record[i] = v.Format(time.RFC3339Nano)
+		}
+	}
+	return x.w.Write(x.record)
+}
+
+func (x *csvWriter) Close() error {
+	x.w.Flush()
+	return x.w.Error()
+}
+
+type jsonlWriter struct {
+	w       io.Writer
+	columns []Column
+	buf     []byte
+}
+
+// Write encodes row as one JSON object with the columns in order.
+func (x *jsonlWriter) Write(row []any) error {
+	x.buf = append(x.buf[:0], '{')
+	for i, c := range x.columns {
+		if i > 0 {
+			x.buf = append(x.buf, ',')
+		}
+		x.buf = strconv.AppendQuote(x.buf, c.Name)
+		x.buf = append(x.buf, ':')
+		v, err := json.Marshal(row[i])
+		if err != nil {
+			return fmt.Errorf("export %s: %w", c.Name, err)
+		}
+		x.buf = append(x.buf, v...)
+	}
+	x.buf = append(x.buf, '}', '\n')
+	_, err := x.w.Write(x.buf)
+	return err
+}
+
+func (x *jsonlWriter) Close() error { return nil }
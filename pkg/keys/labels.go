@@ -0,0 +1,25 @@
+package keys
+
+import "strings"
+
+// Limits on virtual key labels.
+const (
+	MaxLabels        = 20
+	maxLabelNameLen  = 63
+	maxLabelValueLen = 255
+)
+
+// ValidateLabels returns true if labels has at most MaxLabels entries, each
+// with a non-empty name of up to 63 characters without "=" and a value of
+// up to 255 characters.
+func ValidateLabels(labels map[string]string) bool {
+	if len(labels) > MaxLabels {
+		return false
+	}
+	for name, value := range labels {
+		if name == "" || len(name) > maxLabelNameLen || strings.Contains(name, "=") || len(value) > maxLabelValueLen {
+			return false
+		}
+	}
+	return true
+}
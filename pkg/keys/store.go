@@ -1,27 +1,33 @@
 package keys
 
 import (
+	"context"
 	"errors"
 	"sync"
 
 	"gorm.io/gorm"
 
 	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/events"
 )
 
-// Store defines persistence behavior for VirtualKey objects.
+// Store defines persistence behavior for VirtualKey objects. Mutating
+// methods publish the given events once the change is made.
 type Store interface {
-	Create(VirtualKey) error
+	Create(k VirtualKey, es ...events.Event) error
 	Get(id string) (VirtualKey, error)
-	Update(id string, k VirtualKey) error
-	Delete(id string) error
+	Update(id string, k VirtualKey, es ...events.Event) error
+	Delete(id string, es ...events.Event) error
 	List() []VirtualKey
+	// ListByOrg returns the keys owned by orgID.
+	ListByOrg(orgID string) []VirtualKey
 }
 
 // MemoryStore is an in-memory repository for VirtualKey objects.
 type MemoryStore struct {
 	mu   sync.RWMutex
 	keys map[string]VirtualKey
+	bus  *events.Bus
 }
 
 // NewMemoryStore creates an initialized MemoryStore.
@@ -37,11 +43,20 @@ func NewSQLStore(db *gorm.DB) *SQLStore {
 
 // SQLStore persists VirtualKeys in a SQL database.
 type SQLStore struct {
-	db *gorm.DB
+	db  *gorm.DB
+	bus *events.Bus
 }
 
+// SetBus makes the store publish events on b.
+func (s *MemoryStore) SetBus(b *events.Bus) { s.bus = b }
+
+// SetBus makes the store publish events on b, in the transaction making the
+// change.
+func (s *SQLStore) SetBus(b *events.Bus) { s.bus = b }
+
 // Create inserts a new VirtualKey. Returns an error if the key ID already exists.
-func (s *MemoryStore) Create(k VirtualKey) error {
+func (s *MemoryStore) Create(k VirtualKey, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.keys[k.ID]; ok {
@@ -63,7 +78,8 @@ func (s *MemoryStore) Get(id string) (VirtualKey, error) {
 }
 
 // Update replaces the VirtualKey stored under the given ID.
-func (s *MemoryStore) Update(id string, k VirtualKey) error {
+func (s *MemoryStore) Update(id string, k VirtualKey, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.keys[id]; !ok {
@@ -74,7 +90,8 @@ func (s *MemoryStore) Update(id string, k VirtualKey) error {
 }
 
 // Delete removes a VirtualKey from the store.
-func (s *MemoryStore) Delete(id string) error {
+func (s *MemoryStore) Delete(id string, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.keys[id]; !ok {
@@ -95,15 +112,30 @@ func (s *MemoryStore) List() []VirtualKey {
 	return out
 }
 
-// Create inserts a virtual key into the database.
-func (s *SQLStore) Create(k VirtualKey) error {
-	if err := s.db.Create(&k).Error; err != nil {
-		if database.IsDuplicateError(err) {
-			return ErrKeyExists
+// ListByOrg returns the VirtualKeys owned by orgID.
+func (s *MemoryStore) ListByOrg(orgID string) []VirtualKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]VirtualKey, 0)
+	for _, v := range s.keys {
+		if v.OrgID == orgID {
+			out = append(out, v)
 		}
-		return err
 	}
-	return nil
+	return out
+}
+
+// Create inserts a virtual key into the database.
+func (s *SQLStore) Create(k VirtualKey, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		if err := tx.Create(&k).Error; err != nil {
+			if database.IsDuplicateError(err) {
+				return ErrKeyExists
+			}
+			return err
+		}
+		return nil
+	}, es...)
 }
 
 // Get retrieves a virtual key by ID.
@@ -118,28 +150,33 @@ func (s *SQLStore) Get(id string) (VirtualKey, error) {
 	return v, nil
 }
 
-// Update replaces an existing virtual key.
-func (s *SQLStore) Update(id string, k VirtualKey) error {
-	res := s.db.Model(&VirtualKey{}).Where("id = ?", id).Updates(k)
-	if res.Error != nil {
-		return res.Error
-	}
-	if res.RowsAffected == 0 {
-		return ErrKeyNotFound
-	}
-	return nil
+// Update replaces an existing virtual key, including fields reset to their
+// zero value.
+func (s *SQLStore) Update(id string, k VirtualKey, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		res := tx.Model(&VirtualKey{}).Where("id = ?", id).Select("*").Updates(k)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrKeyNotFound
+		}
+		return nil
+	}, es...)
 }
 
 // Delete removes a virtual key by ID.
-func (s *SQLStore) Delete(id string) error {
-	res := s.db.Delete(&VirtualKey{}, "id = ?", id)
-	if res.Error != nil {
-		return res.Error
-	}
-	if res.RowsAffected == 0 {
-		return ErrKeyNotFound
-	}
-	return nil
+func (s *SQLStore) Delete(id string, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		res := tx.Delete(&VirtualKey{}, "id = ?", id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrKeyNotFound
+		}
+		return nil
+	}, es...)
 }
 
 // List returns all virtual keys from the database.
@@ -151,6 +188,15 @@ func (s *SQLStore) List() []VirtualKey {
 	return out
 }
 
+// ListByOrg returns the virtual keys owned by orgID.
+func (s *SQLStore) ListByOrg(orgID string) []VirtualKey {
+	var out []VirtualKey
+	if err := s.db.Where("org_id = ?", orgID).Find(&out).Error; err != nil {
+		return nil
+	}
+	return out
+}
+
 // Error values returned by Store operations.
 var (
 	ErrKeyNotFound = errors.New("key not found")
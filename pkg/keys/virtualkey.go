@@ -10,10 +10,42 @@ type VirtualKey struct {
 	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
 	Target    string    `json:"target" gorm:"not null"`
 	RateLimit int       `json:"rate_limit" gorm:"not null"`
-	Source      string `json:"source,omitempty" gorm:"size:16;default:''"`
-	OneShot     bool   `json:"one_shot,omitempty" gorm:"default:false"`
-	Used        bool   `json:"used,omitempty" gorm:"default:false"`
-	TokenBudget int    `json:"token_budget,omitempty" gorm:"default:0"`
+	// RateLimitWindow is the period RateLimit applies to: second, minute
+	// (default), hour or day.
+	RateLimitWindow string `json:"rate_limit_window,omitempty" gorm:"size:16;default:''"`
+	// RateLimitBurst is the token bucket capacity. Zero means RateLimit.
+	RateLimitBurst int    `json:"rate_limit_burst,omitempty" gorm:"default:0"`
+	Source         string `json:"source,omitempty" gorm:"size:16;default:''"`
+	OneShot        bool   `json:"one_shot,omitempty" gorm:"default:false"`
+	Used           bool   `json:"used,omitempty" gorm:"default:false"`
+	TokenBudget    int    `json:"token_budget,omitempty" gorm:"default:0"`
+	// BudgetUSD caps the key's spend, priced from its service's token
+	// prices; the proxy refuses requests once it is spent. Zero means
+	// unlimited.
+	BudgetUSD float64 `json:"budget_usd,omitempty" gorm:"default:0"`
+	// TokensPerMinute caps LLM tokens (prompt + completion) per minute.
+	// Zero means unlimited.
+	TokensPerMinute int `json:"tokens_per_minute,omitempty" gorm:"default:0"`
+	// MaxConcurrent caps the number of requests in flight at once. Zero
+	// means unlimited.
+	MaxConcurrent int `json:"max_concurrent,omitempty" gorm:"default:0"`
+	// OrgID is the organization that owns the key. The proxy only forwards
+	// it to services owned by the same organization.
+	OrgID string `json:"org_id,omitempty" gorm:"size:255;default:'';index"`
+	// ServiceAccountID is the service account that minted the key via
+	// POST /v1/service-token, if any.
+	ServiceAccountID string `json:"service_account_id,omitempty" gorm:"size:255;default:''"`
+	// Owner is who the key's usage is charged to: the user who created it,
+	// or whoever it was issued for.
+	Owner string `json:"owner,omitempty" gorm:"size:255;default:''"`
+	// Labels are free-form attributes such as team or cost center, used to
+	// break down chargeback reports.
+	Labels map[string]string `json:"labels,omitempty" gorm:"serializer:json;type:text"`
+	// Suspended keys are refused by the proxy until reinstated, e.g. after
+	// the anomaly detector quarantined them.
+	Suspended bool `json:"suspended,omitempty" gorm:"default:false"`
+	// SuspendedReason says why the key was suspended.
+	SuspendedReason string `json:"suspended_reason,omitempty" gorm:"size:1024;default:''"`
 }
 
 // SourceMCP is the source label for keys issued via the MCP tool.
@@ -0,0 +1,45 @@
+package keys
+
+import "time"
+
+// Allowed rate limit windows for virtual keys. An empty window is treated as
+// WindowMinute so keys created before windows existed keep their meaning.
+const (
+	WindowSecond = "second"
+	WindowMinute = "minute"
+	WindowHour   = "hour"
+	WindowDay    = "day"
+)
+
+var windowDurations = map[string]time.Duration{
+	WindowSecond: time.Second,
+	WindowMinute: time.Minute,
+	WindowHour:   time.Hour,
+	WindowDay:    24 * time.Hour,
+}
+
+// ValidateWindow returns true if w is empty or matches one of the allowed windows.
+func ValidateWindow(w string) bool {
+	if w == "" {
+		return true
+	}
+	_, ok := windowDurations[w]
+	return ok
+}
+
+// WindowDuration returns the length of the key's rate limit window.
+func (k VirtualKey) WindowDuration() time.Duration {
+	if d, ok := windowDurations[k.RateLimitWindow]; ok {
+		return d
+	}
+	return time.Minute
+}
+
+// Burst returns the number of requests the key may send back-to-back before
+// being throttled to its steady rate. Defaults to RateLimit.
+func (k VirtualKey) Burst() int {
+	if k.RateLimitBurst > 0 {
+		return k.RateLimitBurst
+	}
+	return k.RateLimit
+}
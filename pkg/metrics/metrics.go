@@ -27,9 +27,271 @@ var (
 		},
 		[]string{"key"},
 	)
+
+	InFlightRequests = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "inflight_requests",
+			Help: "Proxied requests currently holding a max_concurrent slot on this instance.",
+		},
+		[]string{"level"},
+	)
+
+	QueuedRequests = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "queued_requests",
+			Help: "Proxied requests waiting for a max_concurrent slot on this instance.",
+		},
+		[]string{"level"},
+	)
+
+	ConcurrencyRejectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "concurrency_rejected_total",
+			Help: "Requests rejected because a max_concurrent limit was full.",
+		},
+		[]string{"level"},
+	)
+
+	RateLimitDegraded = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ratelimit_backend_degraded",
+			Help: "1 while the shared rate limiting backend is unavailable and the failure policy applies.",
+		},
+	)
+
+	RateLimitBackendErrorsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ratelimit_backend_errors_total",
+			Help: "Rate limiting backend calls that failed.",
+		},
+	)
+
+	AdaptiveAdmission = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "adaptive_admission_ratio",
+			Help: "Fraction of requests forwarded to an upstream after it throttled this instance.",
+		},
+		[]string{"service", "root_key"},
+	)
+
+	UpstreamThrottledTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "upstream_throttled_total",
+			Help: "429 responses received from upstream services.",
+		},
+		[]string{"service"},
+	)
+
+	AdaptiveRejectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "adaptive_rejected_total",
+			Help: "Requests rejected locally because their upstream is throttling.",
+		},
+		[]string{"service"},
+	)
+
+	UsageEventsDroppedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "usage_events_dropped_total",
+			Help: "Usage events dropped because the recording buffer was full.",
+		},
+	)
+
+	UsageFlushErrorsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "usage_flush_errors_total",
+			Help: "Batches of usage events that failed to be written.",
+		},
+	)
+
+	UsagePrunedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "usage_events_pruned_total",
+			Help: "Usage events deleted by the retention job.",
+		},
+	)
+
+	UsageRetentionLastSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "usage_retention_last_success_timestamp_seconds",
+			Help: "Unix time of the last retention run that completed without error.",
+		},
+	)
+
+	UsagePartitionsDroppedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "usage_partitions_dropped_total",
+			Help: "Expired usage_events partitions dropped by the retention job.",
+		},
+	)
+
+	UsageRollupWatermark = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "usage_rollup_watermark_timestamp_seconds",
+			Help: "Unix time up to which usage events have been rolled up.",
+		},
+	)
+
+	SinkObjectsWrittenTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sink_objects_written_total",
+			Help: "Archive objects written to the log sink, by stream.",
+		},
+		[]string{"stream"},
+	)
+
+	SinkWriteErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sink_write_errors_total",
+			Help: "Failed attempts to write an archive object to the log sink, by stream.",
+		},
+		[]string{"stream"},
+	)
+
+	SinkRecordsDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sink_records_dropped_total",
+			Help: "Records not archived because the sink buffer was full or every retry failed, by stream.",
+		},
+		[]string{"stream"},
+	)
+
+	AnomalyFlagsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "anomaly_flags_total",
+			Help: "Anomalies flagged on virtual keys, by kind and action taken (flagged or suspended).",
+		},
+		[]string{"kind", "action"},
+	)
+
+	AnomalyTrackedKeys = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "anomaly_tracked_keys",
+			Help: "Virtual keys with a usage baseline kept by the anomaly detector on this instance.",
+		},
+	)
+
+	ReportsGeneratedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "reports_generated_total",
+			Help: "Final chargeback reports generated by the report scheduler.",
+		},
+	)
+
+	WebhookDeliveriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "webhook_deliveries_total",
+			Help: "Webhook delivery attempts, by event and outcome (delivered, retried or failed).",
+		},
+		[]string{"event", "outcome"},
+	)
+
+	NotificationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notifications_total",
+			Help: "Key notification send attempts, by channel, kind and outcome (sent, retried or failed).",
+		},
+		[]string{"channel", "kind", "outcome"},
+	)
+
+	EventsPublishedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_published_total",
+			Help: "Domain events published on the event bus, by event.",
+		},
+		[]string{"event"},
+	)
+
+	EventHandlerErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "event_handler_errors_total",
+			Help: "Event subscriber calls that returned an error, by event.",
+		},
+		[]string{"event"},
+	)
+
+	EventsDroppedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "events_dropped_total",
+			Help: "Events not delivered to asynchronous subscribers because the queue was full.",
+		},
+	)
+
+	AuditEntriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "audit_entries_total",
+			Help: "Entries appended to the audit log, by action.",
+		},
+		[]string{"action"},
+	)
+
+	AuditPrunedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "audit_entries_pruned_total",
+			Help: "Audit log entries deleted by the retention job.",
+		},
+	)
+
+	AuditForwardedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "audit_entries_forwarded_total",
+			Help: "Audit log entries sent to a forwarder, by forwarder.",
+		},
+		[]string{"forwarder"},
+	)
+
+	AuditForwardErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "audit_forward_errors_total",
+			Help: "Failed attempts to send audit log entries to a forwarder, by forwarder.",
+		},
+		[]string{"forwarder"},
+	)
+
+	AuditForwardDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "audit_forward_dropped_total",
+			Help: "Audit log entries not forwarded because the buffer was full or retries ran out, by forwarder.",
+		},
+		[]string{"forwarder"},
+	)
 )
 
 // Register registers the metrics with the provided Prometheus registerer.
 func Register(r prometheus.Registerer) {
-	r.MustRegister(RequestTotal, RequestDuration, KeyUsageTotal)
+	r.MustRegister(
+		RequestTotal,
+		RequestDuration,
+		KeyUsageTotal,
+		InFlightRequests,
+		QueuedRequests,
+		ConcurrencyRejectedTotal,
+		RateLimitDegraded,
+		RateLimitBackendErrorsTotal,
+		AdaptiveAdmission,
+		UpstreamThrottledTotal,
+		AdaptiveRejectedTotal,
+		UsageEventsDroppedTotal,
+		UsageFlushErrorsTotal,
+		UsagePrunedTotal,
+		UsageRetentionLastSuccess,
+		UsageRollupWatermark,
+		UsagePartitionsDroppedTotal,
+		SinkObjectsWrittenTotal,
+		SinkWriteErrorsTotal,
+		SinkRecordsDroppedTotal,
+		AnomalyFlagsTotal,
+		AnomalyTrackedKeys,
+		ReportsGeneratedTotal,
+		WebhookDeliveriesTotal,
+		NotificationsTotal,
+		EventsPublishedTotal,
+		EventHandlerErrorsTotal,
+		EventsDroppedTotal,
+		AuditEntriesTotal,
+		AuditPrunedTotal,
+		AuditForwardedTotal,
+		AuditForwardErrorsTotal,
+		AuditForwardDroppedTotal,
+	)
 }
@@ -0,0 +1,316 @@
+package notify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/events"
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/metrics"
+	"github.com/farovictor/bifrost/pkg/usage"
+	"github.com/farovictor/bifrost/pkg/utils"
+)
+
+// LockKey is the Postgres advisory lock key held while checking keys, so
+// only one instance raises and sends notifications.
+const LockKey int64 = 0x6266_6e6f_7469_6601
+
+// sendBatch is how many pending notifications are sent per run.
+const sendBatch = 100
+
+// expiredWindow is how long after its expiry a key is still announced, so
+// keys that expired long before the checker first ran are not.
+const expiredWindow = 24 * time.Hour
+
+// Checker raises notifications when keys pass budget thresholds or near
+// their expiry, and sends them through every notifier. It also publishes a
+// KeyExpired event once for each key that expires, through Store.
+type Checker struct {
+	Keys      keys.Store
+	Usage     usage.Store
+	Store     Store
+	Notifiers []Notifier
+	// Lock keeps instances from checking keys concurrently.
+	Lock database.Locker
+	// Thresholds are the shares of a budget notified, in percent.
+	Thresholds []int
+	// ExpiryLeads are how long before expiry keys are notified.
+	ExpiryLeads []time.Duration
+	// MaxAttempts is how many runs try to send a notification before it
+	// fails. Defaults to 5.
+	MaxAttempts int
+	Interval    time.Duration
+}
+
+// alert is a threshold reached by a key. Period identifies what was
+// reached, e.g. the budget or expiry time, so changing it rearms the alert.
+type alert struct {
+	kind, threshold, period string
+	subject, message        string
+	skip                    bool
+}
+
+// RunOnce raises the notifications due at now and sends those pending, if
+// no other instance is doing so. It reports how many were sent.
+func (c *Checker) RunOnce(ctx context.Context, now time.Time) (int, error) {
+	release, ok, err := c.Lock.TryLock(ctx)
+	if err != nil || !ok {
+		return 0, err
+	}
+	defer release()
+
+	for _, k := range c.Keys.List() {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		if err := c.expire(k, now); err != nil {
+			return 0, err
+		}
+		if len(c.Notifiers) == 0 {
+			continue
+		}
+		alerts, err := c.alerts(k, now)
+		if err != nil {
+			return 0, err
+		}
+		for _, a := range alerts {
+			if err := c.raise(k, a, now); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return c.send(ctx, now)
+}
+
+// Run calls RunOnce immediately and then every Interval until ctx is done.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		n, err := c.RunOnce(ctx, time.Now().UTC())
+		switch {
+		case err != nil && ctx.Err() == nil:
+			logging.Logger.Error().Err(err).Int("sent", n).Msg("send key notifications")
+		case n > 0:
+			logging.Logger.Info().Int("sent", n).Msg("sent key notifications")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// alerts returns the thresholds k has reached at now. Only the highest
+// budget share and the nearest expiry lead are sent; lower ones passed with
+// them are recorded as skipped so they are not sent later.
+func (c *Checker) alerts(k keys.VirtualKey, now time.Time) ([]alert, error) {
+	var out []alert
+	if k.TokenBudget > 0 || k.BudgetUSD > 0 {
+		used, err := c.Usage.Totals(k.ID)
+		if err != nil {
+			return nil, err
+		}
+		tokens, cost := used.Tokens, used.CostUSD
+		if k.TokenBudget > 0 {
+			out = append(out, c.budgetAlerts(k, KindTokenBudget, "token budget", strconv.Itoa(k.TokenBudget),
+				float64(tokens)/float64(k.TokenBudget), fmt.Sprintf("%d of %d tokens", tokens, k.TokenBudget))...)
+		}
+		if k.BudgetUSD > 0 {
+			out = append(out, c.budgetAlerts(k, KindCostBudget, "cost budget", strconv.FormatFloat(k.BudgetUSD, 'f', -1, 64),
+				cost/k.BudgetUSD, fmt.Sprintf("$%.2f of $%.2f", cost, k.BudgetUSD))...)
+		}
+	}
+	// Keys minted by MCP and service accounts are short-lived by design;
+	// they would be notified as soon as they are issued.
+	if k.Source == "" && now.Before(k.ExpiresAt) {
+		leads := append([]time.Duration(nil), c.ExpiryLeads...)
+		sort.Slice(leads, func(i, j int) bool { return leads[i] < leads[j] })
+		sent := false
+		for _, lead := range leads {
+			if now.Before(k.ExpiresAt.Add(-lead)) {
+				continue
+			}
+			left := k.ExpiresAt.Sub(now).Truncate(time.Minute)
+			out = append(out, alert{
+				kind:      KindExpiry,
+				threshold: formatLead(lead),
+				period:    k.ExpiresAt.UTC().Format(time.RFC3339),
+				subject:   fmt.Sprintf("Bifrost: key %s expires in %s", k.ID, formatLead(lead)),
+				message:   fmt.Sprintf("Key %s%s expires at %s, in %s.", k.ID, describe(k), k.ExpiresAt.UTC().Format(time.RFC3339), formatLead(left)),
+				skip:      sent,
+			})
+			sent = true
+		}
+	}
+	return out, nil
+}
+
+// budgetAlerts returns an alert for every threshold share has reached,
+// skipping all but the highest.
+func (c *Checker) budgetAlerts(k keys.VirtualKey, kind, name, period string, share float64, detail string) []alert {
+	thresholds := append([]int(nil), c.Thresholds...)
+	sort.Sort(sort.Reverse(sort.IntSlice(thresholds)))
+	var out []alert
+	for _, t := range thresholds {
+		if share*100 < float64(t) {
+			continue
+		}
+		out = append(out, alert{
+			kind:      kind,
+			threshold: strconv.Itoa(t) + "%",
+			period:    period,
+			subject:   fmt.Sprintf("Bifrost: key %s reached %d%% of its %s", k.ID, t, name),
+			message:   fmt.Sprintf("Key %s%s has used %d%% of its %s (%s).", k.ID, describe(k), t, name, detail),
+			skip:      len(out) > 0,
+		})
+	}
+	return out
+}
+
+// describe names the org and owner of k for messages.
+func describe(k keys.VirtualKey) string {
+	var parts []string
+	if k.OrgID != "" {
+		parts = append(parts, "org "+k.OrgID)
+	}
+	if k.Owner != "" {
+		parts = append(parts, "owner "+k.Owner)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+// formatLead formats d without zero minutes and seconds, e.g. "24h".
+func formatLead(d time.Duration) string {
+	s := d.String()
+	s = strings.TrimSuffix(s, "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	if s == "" {
+		return "0s"
+	}
+	return s
+}
+
+// expire publishes KeyExpired for k if it expired within expiredWindow of
+// now and was not announced before. The announcement is recorded as a
+// KindExpired notification, which is created and published together.
+func (c *Checker) expire(k keys.VirtualKey, now time.Time) error {
+	if k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt) || now.Sub(k.ExpiresAt) > expiredWindow {
+		return nil
+	}
+	period := k.ExpiresAt.UTC().Format(time.RFC3339)
+	sum := sha256.Sum256([]byte(strings.Join([]string{ChannelEvents, k.ID, KindExpired, period}, "\x00")))
+	err := c.Store.Create(Notification{
+		ID:        hex.EncodeToString(sum[:16]),
+		Channel:   ChannelEvents,
+		KeyID:     k.ID,
+		OrgID:     k.OrgID,
+		Kind:      KindExpired,
+		Threshold: "0s",
+		Subject:   fmt.Sprintf("Bifrost: key %s expired", k.ID),
+		Message:   fmt.Sprintf("Key %s%s expired at %s.", k.ID, describe(k), period),
+		Status:    StatusSent,
+		CreatedAt: now,
+		SentAt:    &now,
+	}, events.KeyExpired{KeyID: k.ID, OrgID: k.OrgID, ExpiresAt: k.ExpiresAt})
+	if err != nil && !errors.Is(err, ErrNotificationExists) {
+		return err
+	}
+	return nil
+}
+
+// raise stores a for every notifier, ignoring those raised before.
+func (c *Checker) raise(k keys.VirtualKey, a alert, now time.Time) error {
+	for _, n := range c.Notifiers {
+		sum := sha256.Sum256([]byte(strings.Join([]string{n.Channel(), k.ID, a.kind, a.period, a.threshold}, "\x00")))
+		status := StatusPending
+		if a.skip {
+			status = StatusSkipped
+		}
+		err := c.Store.Create(Notification{
+			ID:        hex.EncodeToString(sum[:16]),
+			Channel:   n.Channel(),
+			KeyID:     k.ID,
+			OrgID:     k.OrgID,
+			Kind:      a.kind,
+			Threshold: a.threshold,
+			Subject:   a.subject,
+			Message:   a.message,
+			Status:    status,
+			CreatedAt: now,
+		})
+		if err != nil && !errors.Is(err, ErrNotificationExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+// send tries each pending notification once.
+func (c *Checker) send(ctx context.Context, now time.Time) (int, error) {
+	pending, err := c.Store.ListPending(sendBatch)
+	if err != nil {
+		return 0, err
+	}
+	maxAttempts := c.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	sent := 0
+	for _, n := range pending {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+		n.Attempts++
+		err := ErrNotifierNotConfigured
+		for _, nf := range c.Notifiers {
+			if nf.Channel() == n.Channel {
+				err = nf.Notify(ctx, n)
+				break
+			}
+		}
+		outcome := StatusSent
+		switch {
+		case err == nil:
+			n.Status, n.Error, n.SentAt = StatusSent, "", &now
+			sent++
+		case n.Attempts >= maxAttempts || errors.Is(err, ErrNotifierNotConfigured):
+			n.Status, n.Error = StatusFailed, utils.Truncate(err.Error(), maxError)
+			outcome = StatusFailed
+		default:
+			n.Error = utils.Truncate(err.Error(), maxError)
+			outcome = "retried"
+		}
+		metrics.NotificationsTotal.WithLabelValues(n.Channel, n.Kind, outcome).Inc()
+		if err != nil {
+			logging.Logger.Warn().Err(err).Str("notification_id", n.ID).Str("channel", n.Channel).
+				Int("attempts", n.Attempts).Msg("key notification failed")
+		}
+		if err := c.Store.Update(n); err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// ErrNotifierNotConfigured fails notifications of a channel no longer
+// configured.
+var ErrNotifierNotConfigured = errors.New("notifier not configured")
+
+// maxError is the size of Notification.Error.
+const maxError = 1024
@@ -0,0 +1,184 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/webhooks"
+)
+
+// Webhook posts notifications as JSON to a URL, signed like org webhook
+// deliveries when Secret is set.
+type Webhook struct {
+	URL    string
+	Secret string
+	// Client sends the requests. Defaults to a client with a 10s timeout.
+	Client *http.Client
+}
+
+// Channel returns "webhook".
+func (*Webhook) Channel() string { return "webhook" }
+
+// Notify posts n to the webhook.
+func (wh *Webhook) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(map[string]any{
+		"id":        n.ID,
+		"event":     n.Kind,
+		"key_id":    n.KeyID,
+		"org_id":    n.OrgID,
+		"threshold": n.Threshold,
+		"subject":   n.Subject,
+		"message":   n.Message,
+		"timestamp": n.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	header := http.Header{webhooks.EventHeader: {n.Kind}, webhooks.DeliveryHeader: {n.ID}}
+	if wh.Secret != "" {
+		header.Set(webhooks.SignatureHeader, webhooks.Sign(wh.Secret, time.Now(), body))
+	}
+	return post(ctx, wh.Client, wh.URL, header, body)
+}
+
+// Slack posts notifications to a Slack-compatible incoming webhook.
+type Slack struct {
+	URL string
+	// Client sends the requests. Defaults to a client with a 10s timeout.
+	Client *http.Client
+}
+
+// Channel returns "slack".
+func (*Slack) Channel() string { return "slack" }
+
+// Notify posts n as a message to the incoming webhook.
+func (s *Slack) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(map[string]string{"text": "*" + n.Subject + "*\n" + n.Message})
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.Client, s.URL, nil, body)
+}
+
+// post sends a JSON body, returning an error unless answered 2xx.
+func post(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) error {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Bifrost-Notify/1")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) //nolint:errcheck
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s responded %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+// SMTP emails notifications. The connection is upgraded with STARTTLS when
+// the server offers it, and authenticated with PLAIN when Username is set.
+type SMTP struct {
+	// Addr is the server's host:port.
+	Addr     string
+	From     string
+	To       []string
+	Username string
+	Password string
+	// Timeout bounds the whole exchange. Defaults to 30s.
+	Timeout time.Duration
+}
+
+// Channel returns "email".
+func (*SMTP) Channel() string { return "email" }
+
+// Notify emails n to every recipient.
+func (s *SMTP) Notify(ctx context.Context, n Notification) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline) //nolint:errcheck
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	for _, to := range s.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(s.message(n)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// headerValue keeps values from breaking out of their header line.
+var headerValue = strings.NewReplacer("\r", " ", "\n", " ")
+
+func (s *SMTP) message(n Notification) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue.Replace(s.From))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue.Replace(strings.Join(s.To, ", ")))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue.Replace(n.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "X-Bifrost-Event: %s\r\n", n.Kind)
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(n.Message, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"time"
+)
+
+// Notification kinds. They double as the event names sent to webhooks.
+const (
+	// KindTokenBudget is raised when a key has used a share of its
+	// TokenBudget.
+	KindTokenBudget = "key.token_budget"
+	// KindCostBudget is raised when a key has spent a share of its
+	// BudgetUSD.
+	KindCostBudget = "key.cost_budget"
+	// KindExpiry is raised when a key is about to expire.
+	KindExpiry = "key.expiring"
+	// KindExpired records that a key's expiry was published as a
+	// KeyExpired event. It is not sent through notifiers.
+	KindExpired = "key.expired"
+)
+
+// ChannelEvents is the channel of KindExpired notifications, which are
+// published on the event bus rather than sent.
+const ChannelEvents = "events"
+
+// Notification statuses.
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+	// StatusSkipped marks a threshold passed together with a higher one,
+	// which is notified instead.
+	StatusSkipped = "skipped"
+)
+
+// Notification is a message about a key sent through one channel. Its ID is
+// derived from channel, key, kind, threshold and period, so it is raised
+// once however often the key is checked.
+type Notification struct {
+	ID      string `json:"id" gorm:"primaryKey;size:64"`
+	Channel string `json:"channel" gorm:"size:16;not null"`
+	KeyID   string `json:"key_id" gorm:"size:255;not null;index"`
+	OrgID   string `json:"org_id,omitempty" gorm:"size:255;not null;default:''"`
+	Kind    string `json:"kind" gorm:"size:32;not null" example:"key.token_budget"`
+	// Threshold is the budget share or expiry lead time reached, e.g. "80%"
+	// or "24h".
+	Threshold string `json:"threshold" gorm:"size:32;not null" example:"80%"`
+	Subject   string `json:"subject" gorm:"size:255;not null"`
+	Message   string `json:"message" gorm:"type:text;not null"`
+	Status    string `json:"status" gorm:"size:16;not null;index"`
+	// Attempts is how many times sending was tried.
+	Attempts int `json:"attempts" gorm:"not null;default:0"`
+	// Error describes why the last attempt failed.
+	Error     string     `json:"error,omitempty" gorm:"size:1024;not null;default:''"`
+	CreatedAt time.Time  `json:"created_at" gorm:"not null"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+}
+
+func (Notification) TableName() string { return "key_notifications" }
+
+// Notifier sends notifications through one channel.
+type Notifier interface {
+	// Channel names the notifier, e.g. "slack". Each channel is sent every
+	// notification once.
+	Channel() string
+	Notify(ctx context.Context, n Notification) error
+}
@@ -0,0 +1,347 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/events"
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/usage"
+	"github.com/farovictor/bifrost/pkg/webhooks"
+)
+
+// recorder is a Notifier keeping what it is sent, failing while fail is set.
+type recorder struct {
+	mu   sync.Mutex
+	sent []Notification
+	fail error
+}
+
+func (*recorder) Channel() string { return "test" }
+
+func (r *recorder) Notify(_ context.Context, n Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail != nil {
+		return r.fail
+	}
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func (r *recorder) thresholds() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for _, n := range r.sent {
+		out = append(out, n.Kind+" "+n.Threshold)
+	}
+	return out
+}
+
+func newTestChecker(ks keys.Store, us usage.Store, store Store, rec *recorder) *Checker {
+	return &Checker{
+		Keys:        ks,
+		Usage:       us,
+		Store:       store,
+		Notifiers:   []Notifier{rec},
+		Lock:        &database.LocalLock{},
+		Thresholds:  []int{50, 80, 100},
+		ExpiryLeads: []time.Duration{24 * time.Hour, time.Hour},
+		MaxAttempts: 2,
+	}
+}
+
+func equal(a, b []string) bool {
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
+
+func TestBudgetThresholdsNotifiedOnce(t *testing.T) {
+	ks, us, rec := keys.NewMemoryStore(), usage.NewMemoryStore(), &recorder{}
+	now := time.Now()
+	ks.Create(keys.VirtualKey{ID: "k1", OrgID: "o1", TokenBudget: 1000, BudgetUSD: 10, ExpiresAt: now.AddDate(0, 1, 0)})
+	us.Record(usage.Event{KeyID: "k1", Timestamp: now, TotalTokens: 850, CostUSD: 2})
+	store := NewMemoryStore()
+	c := newTestChecker(ks, us, store, rec)
+	// A second instance sharing the store.
+	other := newTestChecker(ks, us, store, rec)
+
+	for _, ch := range []*Checker{c, other, c} {
+		if _, err := ch.RunOnce(context.Background(), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 50% was passed together with 80%, so only 80% is sent.
+	if got := rec.thresholds(); !equal(got, []string{KindTokenBudget + " 80%"}) {
+		t.Fatalf("unexpected notifications %v", got)
+	}
+	if n := rec.sent[0]; n.KeyID != "k1" || n.OrgID != "o1" || !strings.Contains(n.Message, "850 of 1000 tokens") {
+		t.Fatalf("unexpected notification %+v", n)
+	}
+
+	us.Record(usage.Event{KeyID: "k1", Timestamp: now, TotalTokens: 150, CostUSD: 3.5})
+	c.RunOnce(context.Background(), now)
+	c.RunOnce(context.Background(), now)
+	want := []string{KindTokenBudget + " 80%", KindTokenBudget + " 100%", KindCostBudget + " 50%"}
+	if got := rec.thresholds(); !equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// Raising the budget rearms its thresholds.
+	k, _ := ks.Get("k1")
+	k.TokenBudget = 1800
+	ks.Update(k.ID, k)
+	c.RunOnce(context.Background(), now)
+	if got := rec.thresholds(); len(got) != 4 || got[3] != KindTokenBudget+" 50%" {
+		t.Fatalf("expected the raised budget notified at 50%%, got %v", got)
+	}
+}
+
+func TestExpiryNotified(t *testing.T) {
+	ks, us, rec := keys.NewMemoryStore(), usage.NewMemoryStore(), &recorder{}
+	now := time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)
+	ks.Create(keys.VirtualKey{ID: "k1", ExpiresAt: now.Add(30 * time.Hour)})
+	ks.Create(keys.VirtualKey{ID: "mcp", Source: keys.SourceMCP, ExpiresAt: now.Add(time.Minute)})
+	c := newTestChecker(ks, us, NewMemoryStore(), rec)
+
+	c.RunOnce(context.Background(), now)
+	if len(rec.sent) != 0 {
+		t.Fatalf("notified too early: %v", rec.thresholds())
+	}
+	c.RunOnce(context.Background(), now.Add(7*time.Hour))
+	c.RunOnce(context.Background(), now.Add(8*time.Hour))
+	if got := rec.thresholds(); !equal(got, []string{KindExpiry + " 24h"}) {
+		t.Fatalf("unexpected notifications %v", got)
+	}
+	if n := rec.sent[0]; n.Subject != "Bifrost: key k1 expires in 24h" || !strings.Contains(n.Message, "in 23h.") {
+		t.Fatalf("unexpected notification %+v", n)
+	}
+	c.RunOnce(context.Background(), now.Add(29*time.Hour+30*time.Minute))
+	c.RunOnce(context.Background(), now.Add(31*time.Hour))
+	if got := rec.thresholds(); !equal(got, []string{KindExpiry + " 24h", KindExpiry + " 1h"}) {
+		t.Fatalf("unexpected notifications %v", got)
+	}
+
+	// Extending the key rearms its expiry notifications.
+	k, _ := ks.Get("k1")
+	k.ExpiresAt = now.Add(40 * time.Hour)
+	ks.Update(k.ID, k)
+	c.RunOnce(context.Background(), now.Add(39*time.Hour+50*time.Minute))
+	if got := rec.thresholds(); len(got) != 3 || got[2] != KindExpiry+" 1h" {
+		t.Fatalf("expected only the nearest lead notified, got %v", got)
+	}
+}
+
+func TestExpiredKeysPublishedOnce(t *testing.T) {
+	ks, us := keys.NewMemoryStore(), usage.NewMemoryStore()
+	now := time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)
+	ks.Create(keys.VirtualKey{ID: "k1", OrgID: "o1", ExpiresAt: now.Add(time.Hour)})
+	ks.Create(keys.VirtualKey{ID: "old", OrgID: "o1", ExpiresAt: now.Add(-48 * time.Hour)})
+	store := NewMemoryStore()
+	b := events.New(events.Options{})
+	store.SetBus(b)
+	var got []events.KeyExpired
+	b.Subscribe(events.Typed(func(_ context.Context, _ events.Message, e events.KeyExpired) error {
+		got = append(got, e)
+		return nil
+	}), events.NameKeyExpired)
+	// Without notifiers, expiry is still published.
+	c := &Checker{Keys: ks, Usage: us, Store: store, Lock: &database.LocalLock{}}
+	other := &Checker{Keys: ks, Usage: us, Store: store, Lock: &database.LocalLock{}}
+
+	c.RunOnce(context.Background(), now)
+	if len(got) != 0 {
+		t.Fatalf("published before expiry or for a long expired key: %+v", got)
+	}
+	for _, ch := range []*Checker{c, other, c} {
+		if _, err := ch.RunOnce(context.Background(), now.Add(2*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(got) != 1 || got[0].KeyID != "k1" || got[0].OrgID != "o1" || !got[0].ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("expected k1 published once, got %+v", got)
+	}
+
+	// Extending and expiring the key again publishes it again.
+	k, _ := ks.Get("k1")
+	k.ExpiresAt = now.Add(3 * time.Hour)
+	ks.Update(k.ID, k)
+	c.RunOnce(context.Background(), now.Add(4*time.Hour))
+	if len(got) != 2 {
+		t.Fatalf("expected the new expiry published, got %+v", got)
+	}
+}
+
+func TestFailedNotificationsRetried(t *testing.T) {
+	ks, us, rec := keys.NewMemoryStore(), usage.NewMemoryStore(), &recorder{fail: errors.New("down")}
+	now := time.Now()
+	ks.Create(keys.VirtualKey{ID: "k1", TokenBudget: 10, ExpiresAt: now.AddDate(0, 1, 0)})
+	ks.Create(keys.VirtualKey{ID: "k2", TokenBudget: 10, ExpiresAt: now.AddDate(0, 1, 0)})
+	us.Record(usage.Event{KeyID: "k1", Timestamp: now, TotalTokens: 10})
+	store := NewMemoryStore()
+	c := newTestChecker(ks, us, store, rec)
+
+	c.RunOnce(context.Background(), now)
+	pending, _ := store.ListPending(10)
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].Error != "down" {
+		t.Fatalf("expected a pending notification, got %+v", pending)
+	}
+	rec.fail = nil
+	if n, _ := c.RunOnce(context.Background(), now); n != 1 || len(rec.sent) != 1 {
+		t.Fatalf("expected the retry sent, got %d", n)
+	}
+	got, _ := store.Get(pending[0].ID)
+	if got.Status != StatusSent || got.Attempts != 2 || got.Error != "" || got.SentAt == nil {
+		t.Fatalf("unexpected notification %+v", got)
+	}
+
+	// Notifications fail after MaxAttempts.
+	rec.fail = errors.New("down")
+	us.Record(usage.Event{KeyID: "k2", Timestamp: now, TotalTokens: 10})
+	c.RunOnce(context.Background(), now)
+	c.RunOnce(context.Background(), now)
+	if pending, _ := store.ListPending(10); len(pending) != 0 {
+		t.Fatalf("expected no pending notifications, got %+v", pending)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var header http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+	n := Notification{ID: "n1", KeyID: "k1", Kind: KindExpiry, Threshold: "24h", Subject: "s", Message: "m"}
+
+	if err := (&Webhook{URL: srv.URL, Secret: "s3cret"}).Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if err := webhooks.Verify("s3cret", header.Get(webhooks.SignatureHeader), body, time.Minute, time.Now()); err != nil {
+		t.Fatalf("bad signature: %v", err)
+	}
+	var got map[string]any
+	json.Unmarshal(body, &got)
+	if got["event"] != KindExpiry || got["key_id"] != "k1" || got["threshold"] != "24h" || header.Get(webhooks.EventHeader) != KindExpiry {
+		t.Fatalf("unexpected payload %s", body)
+	}
+
+	if err := (&Slack{URL: srv.URL}).Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	var slack map[string]string
+	json.Unmarshal(body, &slack)
+	if slack["text"] != "*s*\nm" {
+		t.Fatalf("unexpected Slack payload %s", body)
+	}
+
+	fail := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer fail.Close()
+	if err := (&Slack{URL: fail.URL}).Notify(context.Background(), n); err == nil {
+		t.Fatal("expected an error for a 502")
+	}
+}
+
+// smtpServer is a minimal SMTP stand-in accepting one message per
+// connection and recording its envelope and data.
+type smtpServer struct {
+	net.Listener
+	mu   sync.Mutex
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{Listener: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		s.mu.Lock()
+		switch cmd {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 localhost")
+		case "MAIL":
+			s.from = line
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			s.to = append(s.to, line)
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			b, _ := io.ReadAll(tp.DotReader())
+			s.data = string(b)
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			s.mu.Unlock()
+			return
+		default:
+			tp.PrintfLine("502 unsupported")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	srv := newSMTPServer(t)
+	n := Notification{ID: "n1", KeyID: "k1", Kind: KindTokenBudget, Subject: "Bifrost: key k1\r\nBcc: x@y reached 80%", Message: "Key k1 has used 80%."}
+	mail := &SMTP{Addr: srv.Addr().String(), From: "bifrost@example.com", To: []string{"ops@example.com", "fin@example.com"}}
+	if err := mail.Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if !strings.Contains(srv.from, "<bifrost@example.com>") || len(srv.to) != 2 {
+		t.Fatalf("unexpected envelope %q %q", srv.from, srv.to)
+	}
+	msg, err := textproto.NewReader(bufio.NewReader(strings.NewReader(srv.data))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Get("Subject") != "Bifrost: key k1  Bcc: x@y reached 80%" || msg.Get("Bcc") != "" || msg.Get("X-Bifrost-Event") != KindTokenBudget {
+		t.Fatalf("unexpected headers %v", msg)
+	}
+	if !strings.HasSuffix(srv.data, "Key k1 has used 80%.\n") {
+		t.Fatalf("unexpected body %q", srv.data)
+	}
+}
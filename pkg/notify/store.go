@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/events"
+)
+
+// Store defines persistence behavior for notifications.
+type Store interface {
+	// Create stores a new notification and publishes es once it is stored.
+	// It returns ErrNotificationExists if it was raised before.
+	Create(n Notification, es ...events.Event) error
+	Get(id string) (Notification, error)
+	Update(Notification) error
+	// ListPending returns up to limit pending notifications, oldest first.
+	ListPending(limit int) ([]Notification, error)
+}
+
+// MemoryStore keeps notifications in memory with concurrency safety.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	notifications map[string]Notification
+	bus           *events.Bus
+}
+
+// NewMemoryStore creates an initialized MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{notifications: make(map[string]Notification)}
+}
+
+// Create inserts a new Notification.
+func (s *MemoryStore) Create(n Notification, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.notifications[n.ID]; ok {
+		return ErrNotificationExists
+	}
+	s.notifications[n.ID] = n
+	return nil
+}
+
+// Get retrieves a Notification by ID.
+func (s *MemoryStore) Get(id string) (Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n, ok := s.notifications[id]
+	if !ok {
+		return Notification{}, ErrNotificationNotFound
+	}
+	return n, nil
+}
+
+// Update replaces an existing Notification.
+func (s *MemoryStore) Update(n Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.notifications[n.ID]; !ok {
+		return ErrNotificationNotFound
+	}
+	s.notifications[n.ID] = n
+	return nil
+}
+
+// ListPending returns pending notifications, oldest first.
+func (s *MemoryStore) ListPending(limit int) ([]Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Notification
+	for _, n := range s.notifications {
+		if n.Status == StatusPending {
+			out = append(out, n)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// SQLStore persists notifications in a SQL database.
+type SQLStore struct {
+	db  *gorm.DB
+	bus *events.Bus
+}
+
+// SetBus makes the store publish events on b.
+func (s *MemoryStore) SetBus(b *events.Bus) { s.bus = b }
+
+// SetBus makes the store publish events on b, in the transaction making the
+// change.
+func (s *SQLStore) SetBus(b *events.Bus) { s.bus = b }
+
+// NewSQLStore creates a SQL-backed store.
+func NewSQLStore(db *gorm.DB) *SQLStore {
+	db.AutoMigrate(&Notification{})
+	return &SQLStore{db: db}
+}
+
+// Create inserts a notification into the database.
+func (s *SQLStore) Create(n Notification, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		if err := tx.Create(&n).Error; err != nil {
+			if database.IsDuplicateError(err) {
+				return ErrNotificationExists
+			}
+			return err
+		}
+		return nil
+	}, es...)
+}
+
+// Get retrieves a notification by ID.
+func (s *SQLStore) Get(id string) (Notification, error) {
+	var n Notification
+	if err := s.db.First(&n, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Notification{}, ErrNotificationNotFound
+		}
+		return Notification{}, err
+	}
+	return n, nil
+}
+
+// Update replaces an existing notification.
+func (s *SQLStore) Update(n Notification) error {
+	res := s.db.Model(&Notification{}).Where("id = ?", n.ID).Select("*").Updates(n)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// ListPending returns pending notifications, oldest first.
+func (s *SQLStore) ListPending(limit int) ([]Notification, error) {
+	out := []Notification{}
+	if err := s.db.Where("status = ?", StatusPending).Order("created_at, id").Limit(limit).Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Error values returned by Store operations.
+var (
+	ErrNotificationNotFound = errors.New("notification not found")
+	ErrNotificationExists   = errors.New("notification already exists")
+)
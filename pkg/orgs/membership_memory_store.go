@@ -1,11 +1,16 @@
 package orgs
 
-import "sync"
+import (
+	"sync"
+
+	"github.com/farovictor/bifrost/pkg/events"
+)
 
 // MemoryMembershipStore keeps memberships in memory with concurrency safety.
 type MemoryMembershipStore struct {
 	mu          sync.RWMutex
 	memberships map[string]Membership
+	bus         *events.Bus
 }
 
 // NewMemoryMembershipStore creates an initialized MemoryMembershipStore.
@@ -13,12 +18,16 @@ func NewMemoryMembershipStore() *MemoryMembershipStore {
 	return &MemoryMembershipStore{memberships: make(map[string]Membership)}
 }
 
+// SetBus makes the store publish events on b.
+func (s *MemoryMembershipStore) SetBus(b *events.Bus) { s.bus = b }
+
 func membershipKey(userID, orgID string) string {
 	return userID + ":" + orgID
 }
 
 // Create inserts a new Membership. Returns error if the user/org pair already exists.
-func (s *MemoryMembershipStore) Create(m Membership) error {
+func (s *MemoryMembershipStore) Create(m Membership, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	k := membershipKey(m.UserID, m.OrgID)
@@ -42,7 +51,8 @@ func (s *MemoryMembershipStore) Get(userID, orgID string) (Membership, error) {
 }
 
 // Delete removes a Membership from the store.
-func (s *MemoryMembershipStore) Delete(userID, orgID string) error {
+func (s *MemoryMembershipStore) Delete(userID, orgID string, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	k := membershipKey(userID, orgID)
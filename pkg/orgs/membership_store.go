@@ -1,17 +1,21 @@
 package orgs
 
 import (
+	"context"
 	"errors"
 	"strings"
 
 	"gorm.io/gorm"
+
+	"github.com/farovictor/bifrost/pkg/events"
 )
 
 // MembershipStore defines persistence behavior for Membership objects.
+// Create and Delete publish the given events once the change is made.
 type MembershipStore interface {
-	Create(Membership) error
+	Create(m Membership, es ...events.Event) error
 	Get(userID, orgID string) (Membership, error)
-	Delete(userID, orgID string) error
+	Delete(userID, orgID string, es ...events.Event) error
 	Update(Membership) error
 	List() []Membership
 	ListByUser(userID string) []Membership
@@ -21,9 +25,14 @@ type MembershipStore interface {
 // SQLMembershipStore persists memberships in a SQL database and implements MembershipStore.
 // It mirrors the in-memory MemoryMembershipStore behavior.
 type SQLMembershipStore struct {
-	db *gorm.DB
+	db  *gorm.DB
+	bus *events.Bus
 }
 
+// SetBus makes the store publish events on b, in the transaction making the
+// change.
+func (s *SQLMembershipStore) SetBus(b *events.Bus) { s.bus = b }
+
 // NewSQLMembershipStore creates a SQL-backed store and auto-migrates the Membership model.
 func NewSQLMembershipStore(db *gorm.DB) *SQLMembershipStore {
 	db.AutoMigrate(&Membership{})
@@ -31,14 +40,16 @@ func NewSQLMembershipStore(db *gorm.DB) *SQLMembershipStore {
 }
 
 // Create inserts a new membership. Returns error if the pair already exists.
-func (s *SQLMembershipStore) Create(m Membership) error {
-	if err := s.db.Create(&m).Error; err != nil {
-		if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			return ErrMembershipExists
+func (s *SQLMembershipStore) Create(m Membership, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		if err := tx.Create(&m).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "UNIQUE constraint failed") {
+				return ErrMembershipExists
+			}
+			return err
 		}
-		return err
-	}
-	return nil
+		return nil
+	}, es...)
 }
 
 // Get retrieves a membership by user and organization IDs.
@@ -54,15 +65,17 @@ func (s *SQLMembershipStore) Get(userID, orgID string) (Membership, error) {
 }
 
 // Delete removes a membership.
-func (s *SQLMembershipStore) Delete(userID, orgID string) error {
-	res := s.db.Delete(&Membership{}, "user_id = ? AND org_id = ?", userID, orgID)
-	if res.Error != nil {
-		return res.Error
-	}
-	if res.RowsAffected == 0 {
-		return ErrMembershipNotFound
-	}
-	return nil
+func (s *SQLMembershipStore) Delete(userID, orgID string, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		res := tx.Delete(&Membership{}, "user_id = ? AND org_id = ?", userID, orgID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrMembershipNotFound
+		}
+		return nil
+	}, es...)
 }
 
 // Update replaces an existing membership.
@@ -0,0 +1,57 @@
+package orgs
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// OwnedTables are the tables whose rows belong to an organization through
+// their org_id column.
+var OwnedTables = []string{"virtual_keys", "services", "root_keys", "service_accounts"}
+
+// ErrNoDefaultOrg is returned by AssignUnowned when rows need an org but
+// none was given and there is not exactly one to choose.
+var ErrNoDefaultOrg = errors.New("no default org: set one to own existing keys, services, root keys and service accounts")
+
+// AssignUnowned gives the rows of OwnedTables without an org to orgID, or to
+// the only organization when orgID is empty. It returns how many rows it
+// assigned.
+func AssignUnowned(db *gorm.DB, orgID string) (int64, error) {
+	var unowned int64
+	for _, table := range OwnedTables {
+		var n int64
+		if err := db.Table(table).Where("org_id = ''").Count(&n).Error; err != nil {
+			return 0, err
+		}
+		unowned += n
+	}
+	if unowned == 0 {
+		return 0, nil
+	}
+	if orgID == "" {
+		var ids []string
+		if err := db.Model(&Organization{}).Limit(2).Pluck("id", &ids).Error; err != nil {
+			return 0, err
+		}
+		if len(ids) != 1 {
+			return 0, ErrNoDefaultOrg
+		}
+		orgID = ids[0]
+	}
+	var assigned int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range OwnedTables {
+			res := tx.Table(table).Where("org_id = ''").Update("org_id", orgID)
+			if res.Error != nil {
+				return res.Error
+			}
+			assigned += res.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return assigned, nil
+}
@@ -0,0 +1,80 @@
+package orgs
+
+// Permissions name the actions a role may take on the management API.
+const (
+	PermKeysRead             = "keys:read"
+	PermKeysWrite            = "keys:write"
+	PermRootKeysRead         = "rootkeys:read"
+	PermRootKeysWrite        = "rootkeys:write"
+	PermServicesRead         = "services:read"
+	PermServicesWrite        = "services:write"
+	PermQuotasRead           = "quotas:read"
+	PermQuotasWrite          = "quotas:write"
+	PermServiceAccountsRead  = "serviceaccounts:read"
+	PermServiceAccountsWrite = "serviceaccounts:write"
+	PermUsageRead            = "usage:read"
+	PermAnomaliesRead        = "anomalies:read"
+	PermAnomaliesWrite       = "anomalies:write"
+	PermAuditRead            = "audit:read"
+	PermWebhooksRead         = "webhooks:read"
+	PermWebhooksWrite        = "webhooks:write"
+	PermOrgsRead             = "orgs:read"
+	PermOrgsWrite            = "orgs:write"
+	PermOrgsDelete           = "orgs:delete"
+	PermMembersRead          = "members:read"
+	PermMembersWrite         = "members:write"
+	// PermMembersOwners allows adding and removing owners.
+	PermMembersOwners = "members:owners"
+)
+
+var memberPermissions = []string{
+	PermKeysRead,
+	PermKeysWrite,
+	PermServicesRead,
+	PermQuotasRead,
+	PermUsageRead,
+	PermAnomaliesRead,
+	PermOrgsRead,
+	PermMembersRead,
+}
+
+var adminPermissions = append([]string{
+	PermRootKeysRead,
+	PermRootKeysWrite,
+	PermServicesWrite,
+	PermQuotasWrite,
+	PermServiceAccountsRead,
+	PermServiceAccountsWrite,
+	PermAnomaliesWrite,
+	PermAuditRead,
+	PermWebhooksRead,
+	PermWebhooksWrite,
+	PermOrgsWrite,
+	PermMembersWrite,
+}, memberPermissions...)
+
+var ownerPermissions = append([]string{
+	PermOrgsDelete,
+	PermMembersOwners,
+}, adminPermissions...)
+
+var rolePermissions = map[string]map[string]struct{}{
+	RoleOwner:  permissionSet(ownerPermissions),
+	RoleAdmin:  permissionSet(adminPermissions),
+	RoleMember: permissionSet(memberPermissions),
+}
+
+func permissionSet(perms []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(perms))
+	for _, p := range perms {
+		set[p] = struct{}{}
+	}
+	return set
+}
+
+// Can reports whether role grants perm. Unknown roles, including the empty
+// role of non-members, grant nothing.
+func Can(role, perm string) bool {
+	_, ok := rolePermissions[role][perm]
+	return ok
+}
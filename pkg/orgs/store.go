@@ -1,6 +1,7 @@
 package orgs
 
 import (
+	"context"
 	"errors"
 	"sync"
 
@@ -8,13 +9,15 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/events"
 )
 
-// Store defines persistence behavior for Organization objects.
+// Store defines persistence behavior for Organization objects. Create and
+// Delete publish the given events once the change is made.
 type Store interface {
-	Create(Organization) error
+	Create(o Organization, es ...events.Event) error
 	Get(id string) (Organization, error)
-	Delete(id string) error
+	Delete(id string, es ...events.Event) error
 	Update(Organization) error
 	List() []Organization
 }
@@ -24,6 +27,7 @@ type MemoryStore struct {
 	mu    sync.RWMutex
 	orgs  map[string]Organization
 	names map[string]string
+	bus   *events.Bus
 }
 
 // NewMemoryStore creates an initialized MemoryStore.
@@ -39,11 +43,20 @@ func NewSQLStore(db *gorm.DB) *SQLStore {
 
 // SQLStore persists organizations in a SQL database.
 type SQLStore struct {
-	db *gorm.DB
+	db  *gorm.DB
+	bus *events.Bus
 }
 
+// SetBus makes the store publish events on b.
+func (s *MemoryStore) SetBus(b *events.Bus) { s.bus = b }
+
+// SetBus makes the store publish events on b, in the transaction making the
+// change.
+func (s *SQLStore) SetBus(b *events.Bus) { s.bus = b }
+
 // Create inserts a new Organization. Returns error if ID already exists.
-func (s *MemoryStore) Create(o Organization) error {
+func (s *MemoryStore) Create(o Organization, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if o.ID == "" {
@@ -72,7 +85,8 @@ func (s *MemoryStore) Get(id string) (Organization, error) {
 }
 
 // Delete removes an Organization from the store.
-func (s *MemoryStore) Delete(id string) error {
+func (s *MemoryStore) Delete(id string, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	o, ok := s.orgs[id]
@@ -115,17 +129,19 @@ func (s *MemoryStore) List() []Organization {
 }
 
 // Create inserts an organization into the database.
-func (s *SQLStore) Create(o Organization) error {
-	if o.ID == "" {
-		o.ID = utils.GenerateID()
-	}
-	if err := s.db.Create(&o).Error; err != nil {
-		if database.IsDuplicateError(err) {
-			return ErrOrgExists
+func (s *SQLStore) Create(o Organization, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		if o.ID == "" {
+			o.ID = utils.GenerateID()
 		}
-		return err
-	}
-	return nil
+		if err := tx.Create(&o).Error; err != nil {
+			if database.IsDuplicateError(err) {
+				return ErrOrgExists
+			}
+			return err
+		}
+		return nil
+	}, es...)
 }
 
 // Get retrieves an organization by ID.
@@ -141,15 +157,17 @@ func (s *SQLStore) Get(id string) (Organization, error) {
 }
 
 // Delete removes an organization.
-func (s *SQLStore) Delete(id string) error {
-	res := s.db.Delete(&Organization{}, "id = ?", id)
-	if res.Error != nil {
-		return res.Error
-	}
-	if res.RowsAffected == 0 {
-		return ErrOrgNotFound
-	}
-	return nil
+func (s *SQLStore) Delete(id string, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		res := tx.Delete(&Organization{}, "id = ?", id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrOrgNotFound
+		}
+		return nil
+	}, es...)
 }
 
 // Update replaces an organization.
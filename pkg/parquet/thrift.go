@@ -0,0 +1,78 @@
+package parquet
+
+import "encoding/binary"
+
+// Thrift compact protocol type ids.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// compact encodes the Thrift compact protocol, which the Parquet footer and
+// page headers are written in. It only supports what the writer needs.
+type compact struct {
+	b []byte
+	// last holds the id of the previous field of each open struct.
+	last []int16
+}
+
+func (c *compact) structBegin() { c.last = append(c.last, 0) }
+
+func (c *compact) structEnd() {
+	c.b = append(c.b, 0)
+	c.last = c.last[:len(c.last)-1]
+}
+
+func (c *compact) field(id int16, typ byte) {
+	top := len(c.last) - 1
+	if d := id - c.last[top]; d > 0 && d <= 15 {
+		c.b = append(c.b, byte(d)<<4|typ)
+	} else {
+		c.b = append(c.b, typ)
+		c.b = binary.AppendVarint(c.b, int64(id))
+	}
+	c.last[top] = id
+}
+
+func (c *compact) i32(id int16, v int32) {
+	c.field(id, thriftI32)
+	c.rawInt(int64(v))
+}
+
+func (c *compact) i64(id int16, v int64) {
+	c.field(id, thriftI64)
+	c.rawInt(v)
+}
+
+func (c *compact) binary(id int16, s string) {
+	c.field(id, thriftBinary)
+	c.rawBinary(s)
+}
+
+// structField opens a nested struct in field id; close it with structEnd.
+func (c *compact) structField(id int16) {
+	c.field(id, thriftStruct)
+	c.structBegin()
+}
+
+// list starts a list of n elements, which follow as raw values or structs.
+func (c *compact) list(id int16, elem byte, n int) {
+	c.field(id, thriftList)
+	if n < 15 {
+		c.b = append(c.b, byte(n)<<4|elem)
+		return
+	}
+	c.b = append(c.b, 0xf0|elem)
+	c.b = binary.AppendUvarint(c.b, uint64(n))
+}
+
+// rawInt writes a zigzag varint, the encoding of i16, i32 and i64.
+func (c *compact) rawInt(v int64) { c.b = binary.AppendVarint(c.b, v) }
+
+func (c *compact) rawBinary(s string) {
+	c.b = binary.AppendUvarint(c.b, uint64(len(s)))
+	c.b = append(c.b, s...)
+}
@@ -0,0 +1,315 @@
+// Package parquet writes flat Apache Parquet files. Every column is
+// required, PLAIN encoded and gzip compressed, with one data page per column
+// chunk. Rows are buffered one row group at a time, so memory is bounded by
+// the row group size however large the file grows.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Type is the type of a column.
+type Type int
+
+const (
+	// Int32 columns hold int32 values.
+	Int32 Type = iota
+	// Int64 columns hold int64 values.
+	Int64
+	// Double columns hold float64 values.
+	Double
+	// String columns hold UTF-8 string values.
+	String
+	// Timestamp columns hold time.Time values, stored as UTC milliseconds
+	// since the Unix epoch.
+	Timestamp
+)
+
+// Parquet physical types, converted types and enums used by the writer.
+const (
+	physicalInt32     = 1
+	physicalInt64     = 2
+	physicalDouble    = 5
+	physicalByteArray = 6
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	repetitionRequired = 0
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecGzip          = 2
+	pageData           = 0
+)
+
+var magic = []byte("PAR1")
+
+// DefaultRowGroupSize is the number of rows buffered per row group.
+const DefaultRowGroupSize = 10000
+
+// Column describes one column of the schema.
+type Column struct {
+	Name string
+	Type Type
+}
+
+func (c Column) physical() int32 {
+	switch c.Type {
+	case Int32:
+		return physicalInt32
+	case Double:
+		return physicalDouble
+	case String:
+		return physicalByteArray
+	}
+	return physicalInt64
+}
+
+// columnChunk is the footer metadata of one column of a row group.
+type columnChunk struct {
+	offset            int64
+	compressed, plain int64
+}
+
+type rowGroup struct {
+	columns []columnChunk
+	rows    int64
+	size    int64
+}
+
+// Writer writes rows to a Parquet file. Close must be called to write the
+// footer.
+type Writer struct {
+	// RowGroupSize is the number of rows per row group.
+	RowGroupSize int
+
+	w      io.Writer
+	offset int64
+	schema []Column
+	values []bytes.Buffer
+	rows   int
+	groups []rowGroup
+	err    error
+}
+
+// NewWriter starts a Parquet file with the given schema on w.
+func NewWriter(w io.Writer, schema []Column) *Writer {
+	pw := &Writer{
+		RowGroupSize: DefaultRowGroupSize,
+		w:            w,
+		schema:       schema,
+		values:       make([]bytes.Buffer, len(schema)),
+	}
+	pw.write(magic)
+	return pw
+}
+
+// Write appends a row holding one value per column, of the column's type.
+func (w *Writer) Write(row []any) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(row) != len(w.schema) {
+		return fmt.Errorf("parquet: row has %d values, schema has %d columns", len(row), len(w.schema))
+	}
+	for i, col := range w.schema {
+		if err := appendValue(&w.values[i], col, row[i]); err != nil {
+			// Drop the values of the row appended so far.
+			for j := range i {
+				w.values[j].Truncate(w.values[j].Len() - valueSize(w.schema[j], row[j]))
+			}
+			return err
+		}
+	}
+	w.rows++
+	if w.rows >= w.RowGroupSize {
+		w.flush()
+	}
+	return w.err
+}
+
+// Close writes the last row group and the footer. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.rows > 0 {
+		w.flush()
+	}
+	if w.err != nil {
+		return w.err
+	}
+	footer := w.footer()
+	w.write(footer)
+	w.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))))
+	w.write(magic)
+	return w.err
+}
+
+func appendValue(buf *bytes.Buffer, col Column, v any) error {
+	var b [8]byte
+	switch col.Type {
+	case Int32:
+		n, ok := v.(int32)
+		if !ok {
+			return typeError(col, v)
+		}
+		buf.Write(binary.LittleEndian.AppendUint32(b[:0], uint32(n)))
+	case Int64:
+		n, ok := v.(int64)
+		if !ok {
+			return typeError(col, v)
+		}
+		buf.Write(binary.LittleEndian.AppendUint64(b[:0], uint64(n)))
+	case Double:
+		f, ok := v.(float64)
+		if !ok {
+			return typeError(col, v)
+		}
+		buf.Write(binary.LittleEndian.AppendUint64(b[:0], math.Float64bits(f)))
+	case String:
+		s, ok := v.(string)
+		if !ok {
+			return typeError(col, v)
+		}
+		buf.Write(binary.LittleEndian.AppendUint32(b[:0], uint32(len(s))))
+		buf.WriteString(s)
+	case Timestamp:
+		t, ok := v.(time.Time)
+		if !ok {
+			return typeError(col, v)
+		}
+		buf.Write(binary.LittleEndian.AppendUint64(b[:0], uint64(t.UnixMilli())))
+	}
+	return nil
+}
+
+// valueSize is the encoded size of a value appended by appendValue.
+func valueSize(col Column, v any) int {
+	switch col.Type {
+	case Int32:
+		return 4
+	case String:
+		return 4 + len(v.(string))
+	}
+	return 8
+}
+
+func typeError(col Column, v any) error {
+	return fmt.Errorf("parquet: column %s: unexpected value of type %T", col.Name, v)
+}
+
+// flush writes the buffered rows as a row group.
+func (w *Writer) flush() {
+	g := rowGroup{rows: int64(w.rows)}
+	for i := range w.schema {
+		plain := w.values[i].Bytes()
+		var data bytes.Buffer
+		zw := gzip.NewWriter(&data)
+		zw.Write(plain) //nolint:errcheck
+		if err := zw.Close(); err != nil {
+			w.err = err
+			return
+		}
+
+		var h compact
+		h.structBegin()
+		h.i32(1, pageData)
+		h.i32(2, int32(len(plain)))
+		h.i32(3, int32(data.Len()))
+		h.structField(5)
+		h.i32(1, int32(w.rows))
+		h.i32(2, encodingPlain)
+		h.i32(3, encodingRLE)
+		h.i32(4, encodingRLE)
+		h.structEnd()
+		h.structEnd()
+
+		chunk := columnChunk{
+			offset:     w.offset,
+			compressed: int64(len(h.b) + data.Len()),
+			plain:      int64(len(h.b) + len(plain)),
+		}
+		w.write(h.b)
+		w.write(data.Bytes())
+		g.columns = append(g.columns, chunk)
+		g.size += chunk.plain
+		w.values[i].Reset()
+	}
+	w.groups = append(w.groups, g)
+	w.rows = 0
+}
+
+// footer encodes the FileMetaData.
+func (w *Writer) footer() []byte {
+	var numRows int64
+	for _, g := range w.groups {
+		numRows += g.rows
+	}
+
+	var c compact
+	c.structBegin()
+	c.i32(1, 1)
+	c.list(2, thriftStruct, len(w.schema)+1)
+	c.structBegin()
+	c.binary(4, "schema")
+	c.i32(5, int32(len(w.schema)))
+	c.structEnd()
+	for _, col := range w.schema {
+		c.structBegin()
+		c.i32(1, col.physical())
+		c.i32(3, repetitionRequired)
+		c.binary(4, col.Name)
+		switch col.Type {
+		case String:
+			c.i32(6, convertedUTF8)
+		case Timestamp:
+			c.i32(6, convertedTimestampMillis)
+		}
+		c.structEnd()
+	}
+	c.i64(3, numRows)
+	c.list(4, thriftStruct, len(w.groups))
+	for _, g := range w.groups {
+		c.structBegin()
+		c.list(1, thriftStruct, len(g.columns))
+		for i, chunk := range g.columns {
+			col := w.schema[i]
+			c.structBegin()
+			c.i64(2, chunk.offset)
+			c.structField(3)
+			c.i32(1, col.physical())
+			c.list(2, thriftI32, 2)
+			c.rawInt(encodingPlain)
+			c.rawInt(encodingRLE)
+			c.list(3, thriftBinary, 1)
+			c.rawBinary(col.Name)
+			c.i32(4, codecGzip)
+			c.i64(5, g.rows)
+			c.i64(6, chunk.plain)
+			c.i64(7, chunk.compressed)
+			c.i64(9, chunk.offset)
+			c.structEnd()
+			c.structEnd()
+		}
+		c.i64(2, g.size)
+		c.i64(3, g.rows)
+		c.structEnd()
+	}
+	c.binary(6, "bifrost")
+	c.structEnd()
+	return c.b
+}
+
+func (w *Writer) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(b)
+	w.offset += int64(n)
+	w.err = err
+}
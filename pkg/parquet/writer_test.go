@@ -0,0 +1,230 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	pq "github.com/parquet-go/parquet-go"
+)
+
+// thriftReader decodes the compact protocol into maps of field id to value,
+// with lists as []any.
+type thriftReader struct {
+	b []byte
+}
+
+func (r *thriftReader) varint() int64 {
+	v, n := binary.Varint(r.b)
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := r.uvarint()
+		s := string(r.b[:n])
+		r.b = r.b[n:]
+		return s
+	case thriftList:
+		h := r.b[0]
+		r.b = r.b[1:]
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		out := make([]any, n)
+		for i := range out {
+			out[i] = r.value(h & 0x0f)
+		}
+		return out
+	case thriftStruct:
+		return r.readStruct()
+	}
+	panic("unsupported thrift type")
+}
+
+func (r *thriftReader) readStruct() map[int16]any {
+	out := map[int16]any{}
+	var last int16
+	for {
+		h := r.b[0]
+		r.b = r.b[1:]
+		if h == 0 {
+			return out
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			id = int16(r.varint())
+		}
+		out[id] = r.value(h & 0x0f)
+		last = id
+	}
+}
+
+func TestWriter(t *testing.T) {
+	schema := []Column{
+		{Name: "id", Type: Int64},
+		{Name: "status", Type: Int32},
+		{Name: "name", Type: String},
+		{Name: "cost", Type: Double},
+		{Name: "at", Type: Timestamp},
+	}
+	at := time.Date(2025, 3, 14, 9, 26, 53, 589e6, time.UTC)
+	var buf bytes.Buffer
+	w := NewWriter(&buf, schema)
+	w.RowGroupSize = 2
+	for i := 0; i < 5; i++ {
+		if err := w.Write([]any{int64(i), int32(200 + i), "row", 0.5 * float64(i), at.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Write([]any{int64(9), int32(0), "partial", "wrong", at}); err == nil {
+		t.Fatal("expected a type error")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := buf.Bytes()
+	if !bytes.HasPrefix(file, magic) || !bytes.HasSuffix(file, magic) {
+		t.Fatal("missing PAR1 magic")
+	}
+	n := binary.LittleEndian.Uint32(file[len(file)-8:])
+	meta := (&thriftReader{b: file[len(file)-8-int(n) : len(file)-8]}).readStruct()
+
+	if meta[3].(int64) != 5 {
+		t.Fatalf("expected 5 rows, got %v", meta[3])
+	}
+	elems := meta[2].([]any)
+	if len(elems) != len(schema)+1 || elems[0].(map[int16]any)[5].(int64) != int64(len(schema)) {
+		t.Fatalf("unexpected schema: %v", elems)
+	}
+	for i, col := range schema {
+		el := elems[i+1].(map[int16]any)
+		if el[4] != col.Name || el[1].(int64) != int64(col.physical()) {
+			t.Fatalf("unexpected schema element %d: %v", i, el)
+		}
+	}
+	groups := meta[4].([]any)
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 row groups, got %d", len(groups))
+	}
+
+	// Read back every column of the last row group, which holds row 4.
+	last := groups[2].(map[int16]any)
+	if last[3].(int64) != 1 {
+		t.Fatalf("expected 1 row in the last group, got %v", last[3])
+	}
+	var values [][]byte
+	for _, cc := range last[1].([]any) {
+		md := cc.(map[int16]any)[3].(map[int16]any)
+		r := &thriftReader{b: file[md[9].(int64):]}
+		page := r.readStruct()
+		zr, err := gzip.NewReader(bytes.NewReader(r.b[:page[3].(int64)]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain, _ := io.ReadAll(zr)
+		if int64(len(plain)) != page[2].(int64) {
+			t.Fatalf("page size %d, header says %v", len(plain), page[2])
+		}
+		values = append(values, plain)
+	}
+	if got := int64(binary.LittleEndian.Uint64(values[0])); got != 4 {
+		t.Errorf("id = %d", got)
+	}
+	if got := int32(binary.LittleEndian.Uint32(values[1])); got != 204 {
+		t.Errorf("status = %d", got)
+	}
+	if got := string(values[2][4:]); got != "row" || binary.LittleEndian.Uint32(values[2]) != 3 {
+		t.Errorf("name = %q", got)
+	}
+	if got := math.Float64frombits(binary.LittleEndian.Uint64(values[3])); got != 2 {
+		t.Errorf("cost = %v", got)
+	}
+	if got := int64(binary.LittleEndian.Uint64(values[4])); got != at.Add(4*time.Second).UnixMilli() {
+		t.Errorf("at = %d", got)
+	}
+}
+
+// TestWriterReadBack reads a written file with an independent Parquet
+// implementation, so the format is checked against a real reader rather
+// than against the writer's own idea of it.
+func TestWriterReadBack(t *testing.T) {
+	schema := []Column{
+		{Name: "id", Type: Int64},
+		{Name: "status", Type: Int32},
+		{Name: "name", Type: String},
+		{Name: "cost", Type: Double},
+		{Name: "at", Type: Timestamp},
+	}
+	at := time.Date(2025, 3, 14, 9, 26, 53, 589e6, time.UTC)
+	var buf bytes.Buffer
+	w := NewWriter(&buf, schema)
+	w.RowGroupSize = 2
+	for i := 0; i < 5; i++ {
+		name := string(rune('a' + i))
+		if err := w.Write([]any{int64(i), int32(200 + i), name, 0.5 * float64(i), at.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := pq.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if f.NumRows() != 5 || len(f.RowGroups()) != 3 {
+		t.Fatalf("expected 5 rows in 3 groups, got %d in %d", f.NumRows(), len(f.RowGroups()))
+	}
+	fields := f.Schema().Fields()
+	for i, col := range schema {
+		if fields[i].Name() != col.Name || fields[i].Optional() {
+			t.Fatalf("unexpected field %d: %s", i, fields[i].Name())
+		}
+	}
+	if lt := fields[4].Type().LogicalType(); lt == nil || lt.Timestamp == nil {
+		t.Fatalf("expected a timestamp logical type for at, got %v", lt)
+	}
+
+	var got []pq.Row
+	for _, rg := range f.RowGroups() {
+		rows := rg.Rows()
+		batch := make([]pq.Row, rg.NumRows())
+		n, err := rows.ReadRows(batch)
+		if err != nil && err != io.EOF {
+			t.Fatalf("read rows: %v", err)
+		}
+		got = append(got, batch[:n]...)
+		rows.Close()
+	}
+	if len(got) != 5 {
+		t.Fatalf("read %d rows", len(got))
+	}
+	for i, row := range got {
+		if row[0].Int64() != int64(i) || row[1].Int32() != int32(200+i) || string(row[2].ByteArray()) != string(rune('a'+i)) ||
+			row[3].Double() != 0.5*float64(i) || row[4].Int64() != at.Add(time.Duration(i)*time.Second).UnixMilli() {
+			t.Fatalf("row %d: %v", i, row)
+		}
+	}
+}
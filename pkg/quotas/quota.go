@@ -0,0 +1,117 @@
+package quotas
+
+import (
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+)
+
+// Scopes a quota can be attached to.
+const (
+	ScopeOrg            = "org"
+	ScopeService        = "service"
+	ScopeServiceAccount = "service_account"
+)
+
+// Metrics a quota can limit.
+const (
+	MetricRequests = "requests"
+	MetricTokens   = "tokens"
+)
+
+// Periods a quota limit applies to. A month is treated as 30 days.
+const (
+	PeriodMinute = "minute"
+	PeriodHour   = "hour"
+	PeriodDay    = "day"
+	PeriodMonth  = "month"
+)
+
+var allowedScopes = map[string]struct{}{
+	ScopeOrg:            {},
+	ScopeService:        {},
+	ScopeServiceAccount: {},
+}
+
+var allowedMetrics = map[string]struct{}{
+	MetricRequests: {},
+	MetricTokens:   {},
+}
+
+var periodDurations = map[string]time.Duration{
+	PeriodMinute: time.Minute,
+	PeriodHour:   time.Hour,
+	PeriodDay:    24 * time.Hour,
+	PeriodMonth:  30 * 24 * time.Hour,
+}
+
+// Quota caps the requests or tokens consumed by every virtual key belonging
+// to an org, targeting a service, or minted by a service account.
+type Quota struct {
+	ID string `json:"id" gorm:"primaryKey;size:255"`
+	// Scope is the level the quota is attached to: org, service or service_account.
+	Scope string `json:"scope" gorm:"not null;size:32;index:idx_quotas_scope"`
+	// ScopeID is the ID of the org, service or service account.
+	ScopeID string `json:"scope_id" gorm:"not null;size:255;index:idx_quotas_scope"`
+	// Service optionally narrows an org or service account quota to traffic
+	// for one service.
+	Service string `json:"service,omitempty" gorm:"size:255;default:''"`
+	Metric  string `json:"metric" gorm:"not null;size:16"`
+	Period  string `json:"period" gorm:"not null;size:16"`
+	Limit   int    `json:"limit" gorm:"not null"`
+}
+
+func (Quota) TableName() string { return "quotas" }
+
+// Validate reports the first invalid field of q, or "" when q is valid.
+func (q Quota) Validate() string {
+	if _, ok := allowedScopes[q.Scope]; !ok {
+		return "scope"
+	}
+	if q.ScopeID == "" {
+		return "scope_id"
+	}
+	if q.Scope == ScopeService && q.Service != "" && q.Service != q.ScopeID {
+		return "service"
+	}
+	if _, ok := allowedMetrics[q.Metric]; !ok {
+		return "metric"
+	}
+	if _, ok := periodDurations[q.Period]; !ok {
+		return "period"
+	}
+	if q.Limit <= 0 {
+		return "limit"
+	}
+	return ""
+}
+
+// Bucket returns the rate limiter bucket name and limit enforcing q. The
+// bucket refills continuously, so a daily quota of N admits N requests over
+// any rolling 24 hours rather than resetting at midnight.
+func (q Quota) Bucket() (string, ratelimit.Limit) {
+	return "quota:" + q.ID, ratelimit.Limit{Rate: q.Limit, Per: periodDurations[q.Period]}
+}
+
+// Subject identifies who a proxied request is attributed to.
+type Subject struct {
+	OrgID            string
+	ServiceID        string
+	ServiceAccountID string
+}
+
+// Applies reports whether q covers requests made by s.
+func (q Quota) Applies(s Subject) bool {
+	if q.Service != "" && q.Service != s.ServiceID {
+		return false
+	}
+	switch q.Scope {
+	case ScopeOrg:
+		return s.OrgID != "" && q.ScopeID == s.OrgID
+	case ScopeService:
+		return q.ScopeID == s.ServiceID
+	case ScopeServiceAccount:
+		return s.ServiceAccountID != "" && q.ScopeID == s.ServiceAccountID
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package quotas
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/events"
+)
+
+// Store defines persistence behavior for Quota objects. Create and Delete
+// publish the given events once the change is made.
+type Store interface {
+	Create(q Quota, es ...events.Event) error
+	Get(id string) (Quota, error)
+	Delete(id string, es ...events.Event) error
+	List() []Quota
+	// Applicable returns the quotas covering requests made by s for metric.
+	Applicable(s Subject, metric string) ([]Quota, error)
+}
+
+// MemoryStore keeps quotas in memory with concurrency safety.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	quotas map[string]Quota
+	bus    *events.Bus
+}
+
+// NewMemoryStore creates an initialized MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{quotas: make(map[string]Quota)}
+}
+
+// Create inserts a new Quota. Returns an error if the ID already exists.
+func (s *MemoryStore) Create(q Quota, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.quotas[q.ID]; ok {
+		return ErrQuotaExists
+	}
+	s.quotas[q.ID] = q
+	return nil
+}
+
+// Get retrieves a Quota by ID.
+func (s *MemoryStore) Get(id string) (Quota, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	q, ok := s.quotas[id]
+	if !ok {
+		return Quota{}, ErrQuotaNotFound
+	}
+	return q, nil
+}
+
+// Delete removes a Quota.
+func (s *MemoryStore) Delete(id string, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.quotas[id]; !ok {
+		return ErrQuotaNotFound
+	}
+	delete(s.quotas, id)
+	return nil
+}
+
+// List returns all quotas currently in the store.
+func (s *MemoryStore) List() []Quota {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Quota, 0, len(s.quotas))
+	for _, q := range s.quotas {
+		out = append(out, q)
+	}
+	return out
+}
+
+// Applicable returns the quotas covering requests made by sub for metric.
+func (s *MemoryStore) Applicable(sub Subject, metric string) ([]Quota, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Quota
+	for _, q := range s.quotas {
+		if q.Metric == metric && q.Applies(sub) {
+			out = append(out, q)
+		}
+	}
+	return out, nil
+}
+
+// SQLStore persists quotas in a SQL database.
+type SQLStore struct {
+	db  *gorm.DB
+	bus *events.Bus
+}
+
+// SetBus makes the store publish events on b.
+func (s *MemoryStore) SetBus(b *events.Bus) { s.bus = b }
+
+// SetBus makes the store publish events on b, in the transaction making the
+// change.
+func (s *SQLStore) SetBus(b *events.Bus) { s.bus = b }
+
+// NewSQLStore creates a SQL-backed store.
+func NewSQLStore(db *gorm.DB) *SQLStore {
+	db.AutoMigrate(&Quota{})
+	return &SQLStore{db: db}
+}
+
+// Create inserts a quota into the database.
+func (s *SQLStore) Create(q Quota, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		if err := tx.Create(&q).Error; err != nil {
+			if database.IsDuplicateError(err) {
+				return ErrQuotaExists
+			}
+			return err
+		}
+		return nil
+	}, es...)
+}
+
+// Get retrieves a quota by ID.
+func (s *SQLStore) Get(id string) (Quota, error) {
+	var q Quota
+	if err := s.db.First(&q, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Quota{}, ErrQuotaNotFound
+		}
+		return Quota{}, err
+	}
+	return q, nil
+}
+
+// Delete removes a quota by ID.
+func (s *SQLStore) Delete(id string, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		res := tx.Delete(&Quota{}, "id = ?", id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrQuotaNotFound
+		}
+		return nil
+	}, es...)
+}
+
+// List returns all quotas from the database.
+func (s *SQLStore) List() []Quota {
+	var out []Quota
+	if err := s.db.Find(&out).Error; err != nil {
+		return nil
+	}
+	return out
+}
+
+// Applicable returns the quotas covering requests made by sub for metric.
+func (s *SQLStore) Applicable(sub Subject, metric string) ([]Quota, error) {
+	var rows []Quota
+	err := s.db.Where("metric = ?", metric).
+		Where(s.db.Where("scope = ? AND scope_id = ?", ScopeOrg, sub.OrgID).
+			Or("scope = ? AND scope_id = ?", ScopeService, sub.ServiceID).
+			Or("scope = ? AND scope_id = ?", ScopeServiceAccount, sub.ServiceAccountID)).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	out := rows[:0]
+	for _, q := range rows {
+		if q.Applies(sub) {
+			out = append(out, q)
+		}
+	}
+	return out, nil
+}
+
+// Error values returned by Store operations.
+var (
+	ErrQuotaNotFound = errors.New("quota not found")
+	ErrQuotaExists   = errors.New("quota already exists")
+)
@@ -0,0 +1,289 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/events"
+	"github.com/farovictor/bifrost/pkg/metrics"
+)
+
+// Upstream response headers read by Adaptive. The x-ratelimit-* names are the
+// ones used by OpenAI and most compatible providers.
+const (
+	HeaderUpstreamRemainingRequests = "X-Ratelimit-Remaining-Requests"
+	HeaderUpstreamRemainingTokens   = "X-Ratelimit-Remaining-Tokens"
+	HeaderUpstreamResetRequests     = "X-Ratelimit-Reset-Requests"
+	HeaderUpstreamResetTokens       = "X-Ratelimit-Reset-Tokens"
+)
+
+// Tuning of the additive-increase/multiplicative-decrease admission ratio.
+const (
+	minAdmission      = 0.05
+	admissionIncrease = 0.1
+	initialBackoff    = time.Second
+	// throttledRetry is the Retry-After given to requests shed while the
+	// admission ratio is reduced but the upstream is not blocked.
+	throttledRetry = time.Second
+)
+
+// AdaptiveState describes how admission to one service and root key pair is
+// currently reduced in response to upstream throttling.
+type AdaptiveState struct {
+	Service   string `json:"service" example:"openai"`
+	RootKeyID string `json:"root_key_id" example:"rk-openai"`
+	// Admission is the fraction of requests currently forwarded, from 0.05
+	// up to 1.
+	Admission float64 `json:"admission" example:"0.5"`
+	// BlockedUntil is set while every request is rejected locally, e.g.
+	// until an upstream Retry-After elapses.
+	BlockedUntil *time.Time `json:"blocked_until,omitempty"`
+	// RemainingRequests and RemainingTokens are the last values reported in
+	// the upstream's x-ratelimit-remaining-* headers.
+	RemainingRequests *int `json:"remaining_requests,omitempty"`
+	RemainingTokens   *int `json:"remaining_tokens,omitempty"`
+	// Throttled counts upstream 429s since admission was last fully restored.
+	Throttled int       `json:"upstream_throttled"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type adaptiveKey struct{ service, rootKey string }
+
+type adaptiveState struct {
+	AdaptiveState
+	blockedUntil time.Time
+	backoff      time.Duration
+	// credit accumulates Admission per request; a request is forwarded
+	// whenever a whole credit is available.
+	credit float64
+}
+
+// Adaptive lowers admission to an upstream while it is throttling Bifrost, so
+// clients get fast local 429s instead of spending provider quota. Upstream
+// 429s halve the admission ratio and block all traffic for the Retry-After
+// period (or an exponential backoff); every successful response raises the
+// ratio again until it is back to 1. State is kept per instance, since each
+// instance observes the upstream's responses itself.
+type Adaptive struct {
+	// MaxBackoff caps the block applied after a 429 without Retry-After.
+	MaxBackoff time.Duration
+
+	mu     sync.Mutex
+	states map[adaptiveKey]*adaptiveState
+	now    func() time.Time
+}
+
+// NewAdaptive returns an Adaptive with no upstream under pressure.
+func NewAdaptive(maxBackoff time.Duration) *Adaptive {
+	return &Adaptive{MaxBackoff: maxBackoff, states: make(map[adaptiveKey]*adaptiveState), now: time.Now}
+}
+
+// Admit reports whether a request to service using rootKey should be
+// forwarded. When it should not, it returns how long the caller should wait.
+func (a *Adaptive) Admit(service, rootKey string) (bool, time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st, ok := a.states[adaptiveKey{service, rootKey}]
+	if !ok {
+		return true, 0
+	}
+	now := a.now()
+	if now.Before(st.blockedUntil) {
+		metrics.AdaptiveRejectedTotal.WithLabelValues(service).Inc()
+		return false, st.blockedUntil.Sub(now)
+	}
+	st.credit += st.Admission
+	if st.credit >= 1 {
+		st.credit--
+		return true, 0
+	}
+	metrics.AdaptiveRejectedTotal.WithLabelValues(service).Inc()
+	return false, throttledRetry
+}
+
+// Observe feeds the status and headers of an upstream response back into the
+// admission state of service and rootKey.
+func (a *Adaptive) Observe(service, rootKey string, status int, h http.Header) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	k := adaptiveKey{service, rootKey}
+	now := a.now()
+	st, ok := a.states[k]
+
+	remainingReq, hasReq := headerInt(h, HeaderUpstreamRemainingRequests)
+	remainingTok, hasTok := headerInt(h, HeaderUpstreamRemainingTokens)
+	exhausted := hasReq && remainingReq == 0 || hasTok && remainingTok == 0
+
+	if !ok {
+		if status != http.StatusTooManyRequests && !exhausted {
+			return
+		}
+		st = &adaptiveState{AdaptiveState: AdaptiveState{Service: service, RootKeyID: rootKey, Admission: 1}}
+		a.states[k] = st
+	}
+	st.UpdatedAt = now
+	if hasReq {
+		st.RemainingRequests = &remainingReq
+	}
+	if hasTok {
+		st.RemainingTokens = &remainingTok
+	}
+
+	switch {
+	case status == http.StatusTooManyRequests:
+		metrics.UpstreamThrottledTotal.WithLabelValues(service).Inc()
+		st.Throttled++
+		st.Admission = max(minAdmission, st.Admission/2)
+		wait := retryAfter(h, now)
+		if wait <= 0 {
+			wait = resetAfter(h)
+		}
+		if wait <= 0 {
+			st.backoff = min(max(initialBackoff, 2*st.backoff), a.MaxBackoff)
+			wait = st.backoff
+		}
+		st.block(now.Add(wait))
+	case status < http.StatusInternalServerError:
+		st.backoff = 0
+		st.Admission = min(1, st.Admission+admissionIncrease)
+		if 1-st.Admission < 1e-9 {
+			// Absorb floating point drift from repeated increments.
+			st.Admission = 1
+		}
+		if exhausted {
+			// The upstream is about to start rejecting; hold off until its
+			// window resets rather than waiting for the 429.
+			if wait := resetAfter(h); wait > 0 {
+				st.block(now.Add(wait))
+			}
+		}
+	}
+
+	if st.Admission >= 1 && !now.Before(st.blockedUntil) {
+		delete(a.states, k)
+		metrics.AdaptiveAdmission.WithLabelValues(service, rootKey).Set(1)
+		return
+	}
+	metrics.AdaptiveAdmission.WithLabelValues(service, rootKey).Set(st.Admission)
+}
+
+// Forget drops the admission state of service and rootKey, where an empty
+// value matches any, e.g. once a root key is rotated and the throttling
+// observed with the old one no longer applies.
+func (a *Adaptive) Forget(service, rootKey string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k := range a.states {
+		if (service == "" || k.service == service) && (rootKey == "" || k.rootKey == rootKey) {
+			delete(a.states, k)
+			metrics.AdaptiveAdmission.DeleteLabelValues(k.service, k.rootKey)
+		}
+	}
+}
+
+// Subscribe forgets the admission state of root keys rotated or deleted and
+// of services updated or deleted through b, on every instance.
+func (a *Adaptive) Subscribe(b *events.Bus) {
+	b.SubscribeBroadcast(events.Typed(func(_ context.Context, _ events.Message, e events.RootKeyRotated) error {
+		a.Forget("", e.RootKeyID)
+		return nil
+	}), events.NameRootKeyRotated)
+	b.SubscribeBroadcast(events.Typed(func(_ context.Context, _ events.Message, e events.RootKeyDeleted) error {
+		a.Forget("", e.RootKeyID)
+		return nil
+	}), events.NameRootKeyDeleted)
+	b.SubscribeBroadcast(events.Typed(func(_ context.Context, _ events.Message, e events.ServiceUpdated) error {
+		a.Forget(e.ServiceID, "")
+		return nil
+	}), events.NameServiceUpdated)
+	b.SubscribeBroadcast(events.Typed(func(_ context.Context, _ events.Message, e events.ServiceDeleted) error {
+		a.Forget(e.ServiceID, "")
+		return nil
+	}), events.NameServiceDeleted)
+}
+
+// States returns the reduced-admission state of every root key used by
+// service, or of every service when service is empty. Upstreams that are not
+// throttled have no state.
+func (a *Adaptive) States(service string) []AdaptiveState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	out := []AdaptiveState{}
+	for k, st := range a.states {
+		if service != "" && k.service != service {
+			continue
+		}
+		s := st.AdaptiveState
+		if now.Before(st.blockedUntil) {
+			until := st.blockedUntil
+			s.BlockedUntil = &until
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Service != out[j].Service {
+			return out[i].Service < out[j].Service
+		}
+		return out[i].RootKeyID < out[j].RootKeyID
+	})
+	return out
+}
+
+// block extends the period in which every request is rejected to until.
+func (st *adaptiveState) block(until time.Time) {
+	if until.After(st.blockedUntil) {
+		st.blockedUntil = until
+	}
+}
+
+// retryAfter parses a Retry-After header given either in seconds or as an
+// HTTP date.
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	v := h.Get(HeaderRetryAfter)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// resetAfter returns the longest of the upstream's x-ratelimit-reset-*
+// headers, which hold Go-style durations such as "1s" or "6m0s".
+func resetAfter(h http.Header) time.Duration {
+	var longest time.Duration
+	for _, name := range []string{HeaderUpstreamResetRequests, HeaderUpstreamResetTokens} {
+		v := h.Get(name)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			secs, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			d = time.Duration(secs * float64(time.Second))
+		}
+		longest = max(longest, d)
+	}
+	return longest
+}
+
+func headerInt(h http.Header, name string) (int, bool) {
+	v := h.Get(name)
+	if v == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/events"
+)
+
+func newTestAdaptive(now *time.Time) *Adaptive {
+	a := NewAdaptive(time.Minute)
+	a.now = func() time.Time { return *now }
+	return a
+}
+
+func TestAdaptiveBlocksForRetryAfterThenRecovers(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	a := newTestAdaptive(&now)
+
+	a.Observe("svc", "rk", http.StatusTooManyRequests, http.Header{"Retry-After": {"2"}})
+	if ok, wait := a.Admit("svc", "rk"); ok || wait != 2*time.Second {
+		t.Fatalf("expected block for 2s, got ok=%v wait=%s", ok, wait)
+	}
+	// Other root keys of the same service are unaffected.
+	if ok, _ := a.Admit("svc", "other"); !ok {
+		t.Fatalf("unrelated root key blocked")
+	}
+
+	// After the block, admission is halved: every other request goes through.
+	now = now.Add(2 * time.Second)
+	admitted := 0
+	for i := 0; i < 4; i++ {
+		if ok, _ := a.Admit("svc", "rk"); ok {
+			admitted++
+		}
+	}
+	if admitted != 2 {
+		t.Fatalf("expected 2 of 4 requests admitted at half admission, got %d", admitted)
+	}
+
+	for i := 0; i < 5; i++ {
+		a.Observe("svc", "rk", http.StatusOK, nil)
+	}
+	if states := a.States("svc"); len(states) != 0 {
+		t.Fatalf("expected state to be cleared after recovery, got %+v", states)
+	}
+}
+
+func TestAdaptiveBackoffWithoutRetryAfter(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	a := newTestAdaptive(&now)
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		a.Observe("svc", "rk", http.StatusTooManyRequests, nil)
+		if _, wait := a.Admit("svc", "rk"); wait != want {
+			t.Fatalf("expected backoff %s, got %s", want, wait)
+		}
+		now = now.Add(want)
+	}
+	states := a.States("")
+	if len(states) != 1 || states[0].Throttled != 3 || states[0].Admission != 0.125 {
+		t.Fatalf("unexpected state: %+v", states)
+	}
+}
+
+func TestAdaptiveHoldsOffWhenRemainingIsZero(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	a := newTestAdaptive(&now)
+
+	a.Observe("svc", "rk", http.StatusOK, http.Header{
+		"X-Ratelimit-Remaining-Requests": {"0"},
+		"X-Ratelimit-Reset-Requests":     {"1.5s"},
+	})
+	if ok, wait := a.Admit("svc", "rk"); ok || wait != 1500*time.Millisecond {
+		t.Fatalf("expected block until reset, got ok=%v wait=%s", ok, wait)
+	}
+	states := a.States("svc")
+	if len(states) != 1 || states[0].RemainingRequests == nil || *states[0].RemainingRequests != 0 || states[0].BlockedUntil == nil {
+		t.Fatalf("unexpected state: %+v", states)
+	}
+}
+
+func TestAdaptiveForgetsRotatedRootKey(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	a := newTestAdaptive(&now)
+	b := events.New(events.Options{})
+	a.Subscribe(b)
+
+	a.Observe("svc", "rk", http.StatusTooManyRequests, nil)
+	a.Observe("svc", "other", http.StatusTooManyRequests, nil)
+	a.Observe("svc2", "rk2", http.StatusTooManyRequests, nil)
+	b.Emit(context.Background(), events.RootKeyRotated{RootKeyID: "rk"})
+	b.Flush(context.Background())
+	if states := a.States(""); len(states) != 2 || states[0].RootKeyID != "other" {
+		t.Fatalf("expected rk forgotten, got %+v", states)
+	}
+	b.Emit(context.Background(), events.ServiceDeleted{ServiceID: "svc2"})
+	b.Flush(context.Background())
+	if states := a.States(""); len(states) != 1 || states[0].Service != "svc" {
+		t.Fatalf("expected svc2 forgotten, got %+v", states)
+	}
+}
@@ -0,0 +1,80 @@
+// Package ratelimit implements a token bucket limiter backed by Redis, with an
+// in-process implementation of the same algorithm used as a fallback.
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Limit describes a token bucket. Rate tokens are added every Per, and the
+// bucket never holds more than Burst tokens. A zero Burst means Rate.
+type Limit struct {
+	Rate  int
+	Per   time.Duration
+	Burst int
+}
+
+// capacity returns the maximum number of tokens the bucket can hold.
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Rate)
+}
+
+// perMilli returns the refill rate in tokens per millisecond.
+func (l Limit) perMilli() float64 {
+	per := l.Per
+	if per <= 0 {
+		per = time.Minute
+	}
+	return float64(l.Rate) / float64(per.Milliseconds())
+}
+
+// Result is the outcome of a single Allow call.
+type Result struct {
+	Allowed bool
+	// Limit is the bucket capacity.
+	Limit int
+	// Remaining is the number of whole tokens left after this call.
+	Remaining int
+	// RetryAfter is how long to wait before the request would be admitted.
+	// Zero when Allowed is true.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// refill returns the token count after elapsedMS milliseconds of refilling,
+// clamped to the bucket capacity.
+func refill(l Limit, tokens float64, elapsedMS int64) float64 {
+	if elapsedMS > 0 {
+		tokens += float64(elapsedMS) * l.perMilli()
+	}
+	return math.Min(l.capacity(), tokens)
+}
+
+// result builds a Result from the bucket state left after a take of cost tokens.
+func result(l Limit, tokens, cost float64, allowed bool) Result {
+	rate := l.perMilli()
+	res := Result{
+		Allowed:   allowed,
+		Limit:     int(l.capacity()),
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+	}
+	if rate > 0 {
+		res.ResetAfter = millis((l.capacity() - tokens) / rate)
+		if !allowed {
+			res.RetryAfter = millis((cost - tokens) / rate)
+		}
+	}
+	return res
+}
+
+func millis(ms float64) time.Duration {
+	if ms <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(ms)) * time.Millisecond
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"fmt"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// Redis deployment topologies supported by NewRedisClient.
+const (
+	RedisSingle   = "single"
+	RedisSentinel = "sentinel"
+	RedisCluster  = "cluster"
+)
+
+// RedisOptions describes how to reach the Redis deployment holding limiter
+// state.
+type RedisOptions struct {
+	// Mode is single (default), sentinel or cluster.
+	Mode string
+	// Addrs is the server address for single, the sentinel addresses for
+	// sentinel, or the seed node addresses for cluster.
+	Addrs      []string
+	MasterName string
+	Password   string
+	// SentinelPassword authenticates against the sentinels themselves.
+	SentinelPassword string
+	// DB is ignored in cluster mode, which only has database 0.
+	DB       int
+	Protocol int
+}
+
+// NewRedisClient returns a client for the deployment described by o.
+func NewRedisClient(o RedisOptions) (redis.UniversalClient, error) {
+	if len(o.Addrs) == 0 {
+		return nil, fmt.Errorf("redis: no addresses configured")
+	}
+	switch o.Mode {
+	case "", RedisSingle:
+		return redis.NewClient(&redis.Options{
+			Addr:     o.Addrs[0],
+			Password: o.Password,
+			DB:       o.DB,
+			Protocol: o.Protocol,
+		}), nil
+	case RedisSentinel:
+		if o.MasterName == "" {
+			return nil, fmt.Errorf("redis: sentinel mode requires a master name")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       o.MasterName,
+			SentinelAddrs:    o.Addrs,
+			SentinelPassword: o.SentinelPassword,
+			Password:         o.Password,
+			DB:               o.DB,
+			Protocol:         o.Protocol,
+		}), nil
+	case RedisCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:    o.Addrs,
+			Password: o.Password,
+			Protocol: o.Protocol,
+		}), nil
+	default:
+		return nil, fmt.Errorf("redis: unknown mode %q", o.Mode)
+	}
+}
@@ -0,0 +1,175 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/utils"
+)
+
+// ErrConcurrencyLimited is returned by Concurrency.Acquire when no slot
+// became free in time.
+var ErrConcurrencyLimited = errors.New("too many concurrent requests")
+
+// Queue polling backs off from minPoll to maxPoll between attempts. Releases
+// on the same instance wake waiters immediately.
+const (
+	minPoll = 10 * time.Millisecond
+	maxPoll = 250 * time.Millisecond
+)
+
+// Concurrency caps requests in flight per key on top of a Semaphore. Requests
+// over the limit may wait in a bounded per-key queue for up to MaxWait.
+type Concurrency struct {
+	sem Semaphore
+	// QueueSize is how many requests per key may wait for a slot on this
+	// instance. Zero rejects excess requests immediately.
+	QueueSize int
+	// MaxWait is how long a queued request waits before it is rejected.
+	MaxWait time.Duration
+	// RenewEvery is how often held slots are renewed. Zero disables
+	// renewal, which is fine for semaphores whose slots never expire.
+	RenewEvery time.Duration
+
+	mu      sync.Mutex
+	waiting map[string]int
+	wake    map[string]chan struct{}
+}
+
+// NewConcurrency returns a Concurrency using sem.
+func NewConcurrency(sem Semaphore, queueSize int, maxWait, renewEvery time.Duration) *Concurrency {
+	return &Concurrency{
+		sem:        sem,
+		QueueSize:  queueSize,
+		MaxWait:    maxWait,
+		RenewEvery: renewEvery,
+		waiting:    make(map[string]int),
+		wake:       make(map[string]chan struct{}),
+	}
+}
+
+// Acquire takes one of limit slots for key, waiting in the queue if allowed.
+// The returned function releases the slot and must be called exactly once.
+// It returns ErrConcurrencyLimited when the queue is full or the wait times
+// out, the context's error if ctx ends first, or the semaphore's error.
+// When queued is not nil it is called with 1 when the request starts waiting
+// in the queue and with -1 once it stops.
+func (c *Concurrency) Acquire(ctx context.Context, key string, limit int, queued func(delta int)) (func(), error) {
+	lease := utils.GenerateID()
+	ok, err := c.sem.Acquire(ctx, key, lease, limit)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return c.hold(key, lease), nil
+	}
+	if c.QueueSize <= 0 || c.MaxWait <= 0 {
+		return nil, ErrConcurrencyLimited
+	}
+
+	c.mu.Lock()
+	if c.waiting[key] >= c.QueueSize {
+		c.mu.Unlock()
+		return nil, ErrConcurrencyLimited
+	}
+	c.waiting[key]++
+	c.mu.Unlock()
+	if queued != nil {
+		queued(1)
+	}
+	defer func() {
+		c.mu.Lock()
+		if c.waiting[key]--; c.waiting[key] <= 0 {
+			delete(c.waiting, key)
+		}
+		c.mu.Unlock()
+		if queued != nil {
+			queued(-1)
+		}
+	}()
+
+	deadline := time.NewTimer(c.MaxWait)
+	defer deadline.Stop()
+	poll := minPoll
+	for {
+		wait := time.NewTimer(poll)
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			return nil, ctx.Err()
+		case <-deadline.C:
+			wait.Stop()
+			return nil, ErrConcurrencyLimited
+		case <-c.wakeup(key):
+			wait.Stop()
+		case <-wait.C:
+			poll = min(2*poll, maxPoll)
+		}
+		ok, err := c.sem.Acquire(ctx, key, lease, limit)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return c.hold(key, lease), nil
+		}
+	}
+}
+
+// Waiting returns the number of requests queued for key on this instance.
+func (c *Concurrency) Waiting(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.waiting[key]
+}
+
+// hold renews lease in the background until the returned release function
+// is called.
+func (c *Concurrency) hold(key, lease string) func() {
+	stop := make(chan struct{})
+	if c.RenewEvery > 0 {
+		go func() {
+			t := time.NewTicker(c.RenewEvery)
+			defer t.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-t.C:
+					c.sem.Renew(context.Background(), key, lease) //nolint:errcheck
+				}
+			}
+		}()
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			c.sem.Release(context.Background(), key, lease) //nolint:errcheck
+			c.notify(key)
+		})
+	}
+}
+
+// wakeup returns a channel closed the next time a slot of key is released
+// on this instance.
+func (c *Concurrency) wakeup(key string) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, ok := c.wake[key]
+	if !ok {
+		ch = make(chan struct{})
+		c.wake[key] = ch
+	}
+	return ch
+}
+
+func (c *Concurrency) notify(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ch, ok := c.wake[key]; ok {
+		close(ch)
+		delete(c.wake, key)
+	}
+}
@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/metrics"
+)
+
+// Health tracks whether the shared rate limiting backend is reachable. While
+// it is not, limits are enforced according to the failure policy rather than
+// exactly, and the limiter is reported as degraded.
+type Health struct {
+	backend string
+	policy  string
+
+	mu        sync.Mutex
+	degraded  bool
+	since     time.Time
+	lastError string
+}
+
+// HealthStatus is a snapshot of a Health.
+type HealthStatus struct {
+	Backend string `json:"backend" example:"redis"`
+	// Policy is the failure policy applied while Degraded.
+	Policy   string `json:"policy,omitempty" example:"local"`
+	Degraded bool   `json:"degraded"`
+	// DegradedSince is when the backend started failing.
+	DegradedSince *time.Time `json:"degraded_since,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// NewHealth returns a healthy Health for the named backend and policy.
+func NewHealth(backend, policy string) *Health {
+	metrics.RateLimitDegraded.Set(0)
+	return &Health{backend: backend, policy: policy}
+}
+
+// Status returns the current state.
+func (h *Health) Status() HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st := HealthStatus{Backend: h.backend, Policy: h.policy, Degraded: h.degraded, LastError: h.lastError}
+	if h.degraded {
+		since := h.since
+		st.DegradedSince = &since
+	}
+	return st
+}
+
+func (h *Health) failed(err error) {
+	if h == nil {
+		return
+	}
+	metrics.RateLimitBackendErrorsTotal.Inc()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastError = err.Error()
+	if h.degraded {
+		return
+	}
+	h.degraded = true
+	h.since = time.Now()
+	metrics.RateLimitDegraded.Set(1)
+	logging.Logger.Warn().Err(err).Str("backend", h.backend).Str("policy", h.policy).
+		Msg("rate limit backend unavailable, limits degraded")
+}
+
+func (h *Health) succeeded() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.degraded {
+		return
+	}
+	h.degraded = false
+	h.lastError = ""
+	metrics.RateLimitDegraded.Set(0)
+	logging.Logger.Info().Str("backend", h.backend).
+		Msg("rate limit backend recovered after " + time.Since(h.since).Round(time.Second).String())
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Machine-readable reasons returned in the body of 429 responses.
+const (
+	ReasonRateLimited        = "rate_limited"
+	ReasonBudgetExceeded     = "budget_exceeded"
+	ReasonConcurrencyLimited = "concurrency_limited"
+	ReasonQuotaExceeded      = "quota_exceeded"
+	ReasonUpstreamThrottled  = "upstream_throttled"
+)
+
+// Levels a limit can be attached to, reported with every 429.
+const (
+	LevelKey            = "key"
+	LevelService        = "service"
+	LevelOrg            = "org"
+	LevelServiceAccount = "service_account"
+)
+
+// Response headers describing the caller's remaining quota. The RateLimit-*
+// names follow the IETF httpapi ratelimit-headers draft.
+const (
+	HeaderLimit                = "RateLimit-Limit"
+	HeaderRemaining            = "RateLimit-Remaining"
+	HeaderReset                = "RateLimit-Reset"
+	HeaderRetryAfter           = "Retry-After"
+	HeaderTokenBudget          = "X-Bifrost-Token-Budget"
+	HeaderTokenBudgetRemaining = "X-Bifrost-Token-Budget-Remaining"
+)
+
+// ErrorResponse is the JSON body written with every 429.
+type ErrorResponse struct {
+	Error  string `json:"error" example:"rate limit exceeded"`
+	Reason string `json:"reason" example:"rate_limited"`
+	// Level is where the limit that tripped is attached: key, service, org
+	// or service_account.
+	Level string `json:"level,omitempty" example:"key"`
+	// QuotaID identifies the quota that tripped when Reason is quota_exceeded.
+	QuotaID string `json:"quota_id,omitempty"`
+}
+
+// SetHeaders writes the RateLimit-* headers describing res to h.
+func SetHeaders(h http.Header, res Result) {
+	h.Set(HeaderLimit, strconv.Itoa(res.Limit))
+	h.Set(HeaderRemaining, strconv.Itoa(res.Remaining))
+	h.Set(HeaderReset, strconv.Itoa(seconds(res.ResetAfter)))
+}
+
+// SetBudgetHeaders writes the token budget headers to h. Remaining is
+// clamped at zero.
+func SetBudgetHeaders(h http.Header, budget, used int) {
+	remaining := budget - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	h.Set(HeaderTokenBudget, strconv.Itoa(budget))
+	h.Set(HeaderTokenBudgetRemaining, strconv.Itoa(remaining))
+}
+
+// WriteTooManyRequests writes body as a JSON 429. Retry-After is set when
+// retryAfter is positive and is never less than one second.
+func WriteTooManyRequests(w http.ResponseWriter, body ErrorResponse, retryAfter time.Duration) {
+	if retryAfter > 0 {
+		w.Header().Set(HeaderRetryAfter, strconv.Itoa(max(1, seconds(retryAfter))))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(body)
+}
+
+// seconds rounds d up to whole seconds.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
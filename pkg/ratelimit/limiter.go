@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limiter takes tokens from named token buckets.
+type Limiter interface {
+	// Allow takes cost tokens from the bucket if enough are available.
+	Allow(ctx context.Context, key string, lim Limit, cost int) (Result, error)
+	// Debit takes cost tokens unconditionally, letting the bucket go into
+	// debt. A negative cost refunds tokens, never beyond capacity.
+	Debit(ctx context.Context, key string, lim Limit, cost int) (Result, error)
+}
+
+// Failure policies deciding what a Guard does while its backend is failing.
+const (
+	// FailOpen admits every request, enforcing no limits.
+	FailOpen = "open"
+	// FailClosed rejects every request.
+	FailClosed = "closed"
+	// FailLocal enforces limits per instance, which multiplies them by the
+	// number of instances.
+	FailLocal = "local"
+)
+
+// ValidatePolicy reports whether p is a known failure policy.
+func ValidatePolicy(p string) bool {
+	switch p {
+	case FailOpen, FailClosed, FailLocal:
+		return true
+	default:
+		return false
+	}
+}
+
+// failClosedRetry is the Retry-After given to requests rejected because the
+// backend is down.
+const failClosedRetry = time.Second
+
+// Guard is a Limiter that applies a failure policy to calls its backend
+// fails, e.g. while Redis is unreachable, and reports them to a Health. A
+// Guard never returns an error.
+type Guard struct {
+	backend Limiter
+	local   *Local
+	policy  string
+	health  *Health
+}
+
+// NewGuard returns a Guard around backend. health may be nil.
+func NewGuard(backend Limiter, policy string, health *Health) *Guard {
+	return &Guard{backend: backend, local: NewLocal(), policy: policy, health: health}
+}
+
+// Allow implements Limiter.
+func (g *Guard) Allow(ctx context.Context, key string, lim Limit, cost int) (Result, error) {
+	res, err := g.backend.Allow(ctx, key, lim, cost)
+	if err == nil {
+		g.health.succeeded()
+		return res, nil
+	}
+	g.health.failed(err)
+	switch g.policy {
+	case FailOpen:
+		return Result{Allowed: true, Limit: int(lim.capacity()), Remaining: int(lim.capacity())}, nil
+	case FailClosed:
+		return Result{Limit: int(lim.capacity()), RetryAfter: failClosedRetry}, nil
+	default:
+		return g.local.Allow(ctx, key, lim, cost)
+	}
+}
+
+// Debit implements Limiter. Under the open and closed policies a failed
+// debit is dropped.
+func (g *Guard) Debit(ctx context.Context, key string, lim Limit, cost int) (Result, error) {
+	res, err := g.backend.Debit(ctx, key, lim, cost)
+	if err == nil {
+		g.health.succeeded()
+		return res, nil
+	}
+	g.health.failed(err)
+	if g.policy == FailOpen || g.policy == FailClosed {
+		return Result{}, nil
+	}
+	return g.local.Debit(ctx, key, lim, cost)
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often Local drops buckets that have refilled.
+const sweepInterval = time.Minute
+
+type localBucket struct {
+	tokens float64
+	ts     time.Time
+	// full is when the bucket will have refilled to capacity. From then on
+	// it is indistinguishable from a new bucket and can be dropped.
+	full time.Time
+}
+
+// Local is an in-process token bucket limiter. State is not shared between
+// Bifrost instances, so it is only exact for single-node deployments.
+// Buckets that have refilled completely are evicted periodically, so memory
+// stays proportional to the keys active within their refill period.
+type Local struct {
+	mu        sync.Mutex
+	buckets   map[string]*localBucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// NewLocal creates an empty Local limiter.
+func NewLocal() *Local {
+	return &Local{buckets: make(map[string]*localBucket), now: time.Now}
+}
+
+// Allow implements Limiter. It never returns an error.
+func (l *Local) Allow(_ context.Context, key string, lim Limit, cost int) (Result, error) {
+	return l.take(key, lim, cost, false), nil
+}
+
+// Debit implements Limiter. It never returns an error.
+func (l *Local) Debit(_ context.Context, key string, lim Limit, cost int) (Result, error) {
+	return l.take(key, lim, cost, true), nil
+}
+
+// Len returns the number of buckets currently held.
+func (l *Local) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+func (l *Local) take(key string, lim Limit, cost int, force bool) Result {
+	if lim.Rate <= 0 {
+		return Result{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &localBucket{tokens: lim.capacity(), ts: now}
+		l.buckets[key] = b
+	}
+	b.tokens = refill(lim, b.tokens, now.Sub(b.ts).Milliseconds())
+	b.ts = now
+
+	c := float64(cost)
+	allowed := force || b.tokens >= c
+	if allowed {
+		b.tokens = min(lim.capacity(), b.tokens-c)
+	}
+	res := result(lim, b.tokens, c, allowed)
+	b.full = now.Add(res.ResetAfter)
+	return res
+}
+
+// sweep drops every full bucket, at most once per sweepInterval. The caller
+// must hold l.mu.
+func (l *Local) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, key)
+		}
+	}
+}
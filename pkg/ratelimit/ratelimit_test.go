@@ -0,0 +1,346 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+)
+
+func TestLocalBurstThenRefill(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := NewLocal()
+	l.now = func() time.Time { return now }
+	lim := Limit{Rate: 60, Per: time.Minute, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		if res := allow(t, l, "k", lim, 1); !res.Allowed {
+			t.Fatalf("request %d within burst rejected", i+1)
+		}
+	}
+	res := allow(t, l, "k", lim, 1)
+	if res.Allowed {
+		t.Fatalf("request beyond burst allowed")
+	}
+	if res.RetryAfter != time.Second {
+		t.Fatalf("expected retry after 1s, got %s", res.RetryAfter)
+	}
+
+	now = now.Add(time.Second)
+	if res := allow(t, l, "k", lim, 1); !res.Allowed {
+		t.Fatalf("request after refill rejected")
+	}
+}
+
+// TestLocalNoBoundaryDoubling guards against the fixed-window problem where a
+// client could send twice its limit across a minute boundary.
+func TestLocalNoBoundaryDoubling(t *testing.T) {
+	now := time.Unix(1_700_000_059, 0)
+	l := NewLocal()
+	l.now = func() time.Time { return now }
+	lim := Limit{Rate: 10, Per: time.Minute}
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if allow(t, l, "k", lim, 1).Allowed {
+			allowed++
+		}
+	}
+	now = now.Add(2 * time.Second)
+	for i := 0; i < 10; i++ {
+		if allow(t, l, "k", lim, 1).Allowed {
+			allowed++
+		}
+	}
+	if allowed > 10 {
+		t.Fatalf("expected at most 10 requests across the boundary, got %d", allowed)
+	}
+}
+
+func allow(t *testing.T, l Limiter, key string, lim Limit, cost int) Result {
+	t.Helper()
+	res, err := l.Allow(context.Background(), key, lim, cost)
+	if err != nil {
+		t.Fatalf("allow: %v", err)
+	}
+	return res
+}
+
+func TestDebitGoesIntoDebtAndRefunds(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := NewLocal()
+	l.now = func() time.Time { return now }
+	lim := Limit{Rate: 100, Per: time.Minute}
+	ctx := context.Background()
+
+	if res := allow(t, l, "k", lim, 60); !res.Allowed || res.Remaining != 40 {
+		t.Fatalf("unexpected reservation: %+v", res)
+	}
+	// The response used more than was reserved.
+	l.Debit(ctx, "k", lim, 90)
+	if res := allow(t, l, "k", lim, 1); res.Allowed {
+		t.Fatalf("request allowed while bucket is in debt")
+	}
+	// Refunds never overfill the bucket.
+	l.Debit(ctx, "k", lim, -1000)
+	if res := allow(t, l, "k", lim, 0); res.Remaining != 100 {
+		t.Fatalf("expected full bucket after refund, got %+v", res)
+	}
+}
+
+func TestRedisSharedAcrossInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	b := NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	lim := Limit{Rate: 2, Per: time.Hour}
+	ctx := context.Background()
+
+	for i, rl := range []*Redis{a, b} {
+		res, err := rl.Allow(ctx, "k", lim, 1)
+		if err != nil {
+			t.Fatalf("allow: %v", err)
+		}
+		if !res.Allowed {
+			t.Fatalf("request %d rejected", i+1)
+		}
+	}
+	res, err := a.Allow(ctx, "k", lim, 1)
+	if err != nil {
+		t.Fatalf("allow: %v", err)
+	}
+	if res.Allowed {
+		t.Fatalf("third request allowed; instances are not sharing the bucket")
+	}
+	if res.Remaining != 0 || res.Limit != 2 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+func TestRedisSemaphoreLeaseExpires(t *testing.T) {
+	mr := miniredis.RunT(t)
+	now := time.Unix(1_700_000_000, 0)
+	mr.SetTime(now)
+	s := NewRedisSemaphore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), 10*time.Second)
+	ctx := context.Background()
+
+	if ok, err := s.Acquire(ctx, "k", "a", 1); err != nil || !ok {
+		t.Fatalf("first acquire: ok=%v err=%v", ok, err)
+	}
+	if ok, _ := s.Acquire(ctx, "k", "b", 1); ok {
+		t.Fatalf("second acquire succeeded while the slot is held")
+	}
+
+	// A renewed lease survives past its original expiry.
+	mr.SetTime(now.Add(8 * time.Second))
+	if err := s.Renew(ctx, "k", "a"); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	mr.SetTime(now.Add(15 * time.Second))
+	if ok, _ := s.Acquire(ctx, "k", "b", 1); ok {
+		t.Fatalf("renewed lease was reclaimed")
+	}
+
+	// An abandoned lease is reclaimed once it expires.
+	mr.SetTime(now.Add(19 * time.Second))
+	if ok, err := s.Acquire(ctx, "k", "b", 1); err != nil || !ok {
+		t.Fatalf("acquire after expiry: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestConcurrencyQueue(t *testing.T) {
+	c := NewConcurrency(NewLocalSemaphore(), 1, time.Second, 0)
+	ctx := context.Background()
+
+	release, err := c.Acquire(ctx, "k", 1, nil)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	got := make(chan error, 1)
+	go func() {
+		r, err := c.Acquire(ctx, "k", 1, nil)
+		if err == nil {
+			r()
+		}
+		got <- err
+	}()
+	for c.Waiting("k") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// The queue holds one request, so the next is rejected outright.
+	if _, err := c.Acquire(ctx, "k", 1, nil); err != ErrConcurrencyLimited {
+		t.Fatalf("expected ErrConcurrencyLimited with a full queue, got %v", err)
+	}
+
+	release()
+	if err := <-got; err != nil {
+		t.Fatalf("queued request: %v", err)
+	}
+}
+
+func TestConcurrencyMaxWait(t *testing.T) {
+	c := NewConcurrency(NewLocalSemaphore(), 1, 20*time.Millisecond, 0)
+	ctx := context.Background()
+
+	release, _ := c.Acquire(ctx, "k", 1, nil)
+	defer release()
+	start := time.Now()
+	if _, err := c.Acquire(ctx, "k", 1, nil); err != ErrConcurrencyLimited {
+		t.Fatalf("expected ErrConcurrencyLimited after waiting, got %v", err)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Fatalf("gave up after %s, before the max wait", waited)
+	}
+}
+
+func TestConcurrencyQueuedHook(t *testing.T) {
+	c := NewConcurrency(NewLocalSemaphore(), 1, 20*time.Millisecond, 0)
+	ctx := context.Background()
+	var calls []int
+	queued := func(delta int) { calls = append(calls, delta) }
+
+	release, err := c.Acquire(ctx, "k", 1, queued)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("a free slot reported a wait: %v", calls)
+	}
+	defer release()
+	if _, err := c.Acquire(ctx, "k", 1, queued); err != ErrConcurrencyLimited {
+		t.Fatalf("expected ErrConcurrencyLimited after waiting, got %v", err)
+	}
+	if len(calls) != 2 || calls[0] != 1 || calls[1] != -1 {
+		t.Fatalf("expected one wait reported and ended, got %v", calls)
+	}
+}
+
+func TestLocalEvictsRefilledBuckets(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := NewLocal()
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	l.Allow(ctx, "idle", Limit{Rate: 60, Per: time.Minute}, 1)
+	l.Allow(ctx, "busy", Limit{Rate: 1, Per: time.Hour}, 1)
+
+	now = now.Add(2 * time.Minute)
+	l.Allow(ctx, "other", Limit{Rate: 60, Per: time.Minute}, 0)
+	if l.Len() != 2 {
+		t.Fatalf("expected the refilled bucket to be evicted, have %d buckets", l.Len())
+	}
+	// The bucket still refilling keeps its state.
+	if res := allow(t, l, "busy", Limit{Rate: 1, Per: time.Hour}, 1); res.Allowed {
+		t.Fatalf("bucket state lost by eviction")
+	}
+}
+
+// downLimiter and downSemaphore stand in for an unreachable backend.
+type downLimiter struct{}
+
+func (downLimiter) Allow(context.Context, string, Limit, int) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func (downLimiter) Debit(context.Context, string, Limit, int) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+type downSemaphore struct{}
+
+func (downSemaphore) Acquire(context.Context, string, string, int) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func (downSemaphore) Renew(context.Context, string, string) error {
+	return errors.New("connection refused")
+}
+
+func (downSemaphore) Release(context.Context, string, string) error {
+	return errors.New("connection refused")
+}
+
+func TestGuardFailurePolicies(t *testing.T) {
+	lim := Limit{Rate: 1, Per: time.Hour}
+	cases := []struct {
+		policy string
+		want   []bool
+	}{
+		{FailOpen, []bool{true, true}},
+		{FailClosed, []bool{false, false}},
+		{FailLocal, []bool{true, false}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.policy, func(t *testing.T) {
+			h := NewHealth("redis", tc.policy)
+			g := NewGuard(downLimiter{}, tc.policy, h)
+			for i, want := range tc.want {
+				if res := allow(t, g, "k", lim, 1); res.Allowed != want {
+					t.Fatalf("request %d: allowed=%v, want %v", i+1, res.Allowed, want)
+				}
+			}
+			st := h.Status()
+			if !st.Degraded || st.DegradedSince == nil || st.LastError == "" {
+				t.Fatalf("expected degraded health, got %+v", st)
+			}
+		})
+	}
+}
+
+func TestHealthRecovers(t *testing.T) {
+	mr := miniredis.RunT(t)
+	h := NewHealth("redis", FailLocal)
+	g := NewGuard(NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()})), FailLocal, h)
+	lim := Limit{Rate: 10, Per: time.Minute}
+
+	mr.SetError("LOADING")
+	allow(t, g, "k", lim, 1)
+	if !h.Status().Degraded {
+		t.Fatalf("expected degraded while redis errors")
+	}
+	mr.SetError("")
+	allow(t, g, "k", lim, 1)
+	if st := h.Status(); st.Degraded || st.LastError != "" {
+		t.Fatalf("expected recovery, got %+v", st)
+	}
+}
+
+func TestGuardSemaphorePolicies(t *testing.T) {
+	ctx := context.Background()
+	for policy, want := range map[string][]bool{
+		FailOpen:   {true, true},
+		FailClosed: {false, false},
+		FailLocal:  {true, false},
+	} {
+		g := NewGuardSemaphore(downSemaphore{}, policy, nil)
+		for i, w := range want {
+			if ok, err := g.Acquire(ctx, "k", fmt.Sprint(i), 1); ok != w || err != nil {
+				t.Fatalf("%s: acquire %d = %v, %v; want %v", policy, i+1, ok, err, w)
+			}
+		}
+		// Releases of leases granted by the policy never reach the backend.
+		if err := g.Release(ctx, "k", "0"); policy != FailClosed && err != nil {
+			t.Fatalf("%s: release: %v", policy, err)
+		}
+	}
+}
+
+func TestNewRedisClient(t *testing.T) {
+	if _, err := NewRedisClient(RedisOptions{Mode: RedisSentinel, Addrs: []string{"s:26379"}}); err == nil {
+		t.Fatalf("sentinel without a master name accepted")
+	}
+	if _, err := NewRedisClient(RedisOptions{Mode: "ring", Addrs: []string{"r:6379"}}); err == nil {
+		t.Fatalf("unknown mode accepted")
+	}
+	for _, mode := range []string{RedisSingle, RedisSentinel, RedisCluster} {
+		c, err := NewRedisClient(RedisOptions{Mode: mode, Addrs: []string{"localhost:6379"}, MasterName: "mymaster"})
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		c.Close()
+	}
+}
@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript refills and takes from a bucket stored as a hash in a
+// single atomic step. It reads the clock from Redis so instances with skewed
+// clocks still agree on the refill rate.
+//
+// KEYS[1] bucket key
+// ARGV[1] refill rate in tokens per millisecond
+// ARGV[2] bucket capacity
+// ARGV[3] cost of this request
+// ARGV[4] "1" to take the cost even if the bucket goes negative
+//
+// Returns {allowed (0|1), tokens remaining as a string}.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local force = ARGV[4] == '1'
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+if now > ts then
+  tokens = tokens + (now - ts) * rate
+end
+if tokens > capacity then
+  tokens = capacity
+end
+
+local allowed = 0
+if force or tokens >= cost then
+  tokens = math.min(capacity, tokens - cost)
+  allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// Redis is a token bucket limiter whose state lives in Redis, so every
+// Bifrost instance sharing the server enforces the same budget.
+type Redis struct {
+	client redis.UniversalClient
+}
+
+// NewRedis returns a limiter using client.
+func NewRedis(client redis.UniversalClient) *Redis {
+	return &Redis{client: client}
+}
+
+// Allow implements Limiter.
+func (r *Redis) Allow(ctx context.Context, key string, lim Limit, cost int) (Result, error) {
+	return r.take(ctx, key, lim, cost, false)
+}
+
+// Debit implements Limiter.
+func (r *Redis) Debit(ctx context.Context, key string, lim Limit, cost int) (Result, error) {
+	return r.take(ctx, key, lim, cost, true)
+}
+
+func (r *Redis) take(ctx context.Context, key string, lim Limit, cost int, force bool) (Result, error) {
+	if lim.Rate <= 0 {
+		return Result{}, nil
+	}
+	mode := "0"
+	if force {
+		mode = "1"
+	}
+	vals, err := tokenBucketScript.Run(ctx, r.client, []string{bucketKey(key)},
+		strconv.FormatFloat(lim.perMilli(), 'g', -1, 64),
+		strconv.FormatFloat(lim.capacity(), 'g', -1, 64),
+		cost,
+		mode,
+	).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	allowed, _ := vals[0].(int64)
+	s, _ := vals[1].(string)
+	tokens, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Result{}, err
+	}
+	return result(lim, tokens, float64(cost), allowed == 1), nil
+}
+
+// bucketKey wraps key in a hash tag so a bucket always maps to one cluster slot.
+func bucketKey(key string) string {
+	return "ratelimit:{" + key + "}"
+}
@@ -0,0 +1,233 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// Semaphore hands out a bounded number of concurrent slots per key. Each slot
+// is identified by a lease chosen by the caller.
+type Semaphore interface {
+	// Acquire takes a slot for lease if fewer than limit slots of key are held.
+	Acquire(ctx context.Context, key, lease string, limit int) (bool, error)
+	// Renew keeps lease's slot from expiring while its request is running.
+	Renew(ctx context.Context, key, lease string) error
+	// Release frees lease's slot.
+	Release(ctx context.Context, key, lease string) error
+}
+
+// LocalSemaphore is an in-process Semaphore. Slots never expire since they
+// cannot outlive the process holding them.
+type LocalSemaphore struct {
+	mu    sync.Mutex
+	slots map[string]map[string]struct{}
+}
+
+// NewLocalSemaphore creates an empty LocalSemaphore.
+func NewLocalSemaphore() *LocalSemaphore {
+	return &LocalSemaphore{slots: make(map[string]map[string]struct{})}
+}
+
+// Acquire implements Semaphore. It never returns an error.
+func (s *LocalSemaphore) Acquire(_ context.Context, key, lease string, limit int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	held := s.slots[key]
+	if len(held) >= limit {
+		return false, nil
+	}
+	if held == nil {
+		held = make(map[string]struct{})
+		s.slots[key] = held
+	}
+	held[lease] = struct{}{}
+	return true, nil
+}
+
+// Renew implements Semaphore. Local slots do not expire, so it does nothing.
+func (s *LocalSemaphore) Renew(context.Context, string, string) error {
+	return nil
+}
+
+// Release implements Semaphore.
+func (s *LocalSemaphore) Release(_ context.Context, key, lease string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.slots[key], lease)
+	if len(s.slots[key]) == 0 {
+		delete(s.slots, key)
+	}
+	return nil
+}
+
+// semaphoreAcquireScript drops expired leases and adds a new one if there is
+// room. Leases live in a sorted set scored by their expiry time.
+//
+// KEYS[1] semaphore key
+// ARGV[1] lease
+// ARGV[2] limit
+// ARGV[3] lease TTL in milliseconds
+//
+// Returns 1 if the lease was added.
+var semaphoreAcquireScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local ttl = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+  return 0
+end
+redis.call('ZADD', KEYS[1], now + ttl, ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ttl)
+return 1
+`)
+
+// semaphoreRenewScript pushes back the expiry of an existing lease.
+//
+// KEYS[1] semaphore key
+// ARGV[1] lease
+// ARGV[2] lease TTL in milliseconds
+var semaphoreRenewScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local ttl = tonumber(ARGV[2])
+
+if redis.call('ZADD', KEYS[1], 'XX', 'CH', now + ttl, ARGV[1]) == 1 then
+  redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 0
+`)
+
+// RedisSemaphore is a Semaphore whose slots live in Redis, so every Bifrost
+// instance sharing the server enforces the same limit. Slots expire after a
+// lease TTL unless renewed, so slots held by a crashed instance are reclaimed.
+type RedisSemaphore struct {
+	client redis.UniversalClient
+	ttl    time.Duration
+}
+
+// NewRedisSemaphore returns a semaphore using client whose leases expire
+// after ttl without renewal.
+func NewRedisSemaphore(client redis.UniversalClient, ttl time.Duration) *RedisSemaphore {
+	return &RedisSemaphore{client: client, ttl: ttl}
+}
+
+// Acquire implements Semaphore.
+func (s *RedisSemaphore) Acquire(ctx context.Context, key, lease string, limit int) (bool, error) {
+	n, err := semaphoreAcquireScript.Run(ctx, s.client, []string{semaphoreKey(key)},
+		lease, limit, strconv.FormatInt(s.ttl.Milliseconds(), 10),
+	).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Renew implements Semaphore.
+func (s *RedisSemaphore) Renew(ctx context.Context, key, lease string) error {
+	return semaphoreRenewScript.Run(ctx, s.client, []string{semaphoreKey(key)},
+		lease, strconv.FormatInt(s.ttl.Milliseconds(), 10),
+	).Err()
+}
+
+// Release implements Semaphore.
+func (s *RedisSemaphore) Release(ctx context.Context, key, lease string) error {
+	return s.client.ZRem(ctx, semaphoreKey(key), lease).Err()
+}
+
+// semaphoreKey wraps key in a hash tag so a semaphore always maps to one
+// cluster slot.
+func semaphoreKey(key string) string {
+	return "semaphore:{" + key + "}"
+}
+
+// GuardSemaphore applies a failure policy to calls its backend fails, like
+// Guard does for limiters. It remembers how each lease was granted so that
+// renewals and releases go to the same place.
+type GuardSemaphore struct {
+	backend Semaphore
+	local   *LocalSemaphore
+	policy  string
+	health  *Health
+
+	mu sync.Mutex
+	// fallback maps leases granted while the backend was failing to the
+	// semaphore holding them, or nil if the lease was admitted by FailOpen.
+	fallback map[string]Semaphore
+}
+
+// NewGuardSemaphore returns a GuardSemaphore around backend. health may be nil.
+func NewGuardSemaphore(backend Semaphore, policy string, health *Health) *GuardSemaphore {
+	return &GuardSemaphore{
+		backend:  backend,
+		local:    NewLocalSemaphore(),
+		policy:   policy,
+		health:   health,
+		fallback: make(map[string]Semaphore),
+	}
+}
+
+// Acquire implements Semaphore. It never returns an error.
+func (g *GuardSemaphore) Acquire(ctx context.Context, key, lease string, limit int) (bool, error) {
+	ok, err := g.backend.Acquire(ctx, key, lease, limit)
+	if err == nil {
+		g.health.succeeded()
+		return ok, nil
+	}
+	g.health.failed(err)
+	var held Semaphore
+	switch g.policy {
+	case FailOpen:
+		ok = true
+	case FailClosed:
+		return false, nil
+	default:
+		ok, _ = g.local.Acquire(ctx, key, lease, limit)
+		held = g.local
+	}
+	if ok {
+		g.mu.Lock()
+		g.fallback[lease] = held
+		g.mu.Unlock()
+	}
+	return ok, nil
+}
+
+// Renew implements Semaphore.
+func (g *GuardSemaphore) Renew(ctx context.Context, key, lease string) error {
+	if sem, ok := g.lookup(lease, false); ok {
+		if sem == nil {
+			return nil
+		}
+		return sem.Renew(ctx, key, lease)
+	}
+	return g.backend.Renew(ctx, key, lease)
+}
+
+// Release implements Semaphore.
+func (g *GuardSemaphore) Release(ctx context.Context, key, lease string) error {
+	if sem, ok := g.lookup(lease, true); ok {
+		if sem == nil {
+			return nil
+		}
+		return sem.Release(ctx, key, lease)
+	}
+	return g.backend.Release(ctx, key, lease)
+}
+
+// lookup returns the fallback semaphore holding lease, if it was granted by
+// the failure policy, and optionally forgets it.
+func (g *GuardSemaphore) lookup(lease string, forget bool) (Semaphore, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	sem, ok := g.fallback[lease]
+	if ok && forget {
+		delete(g.fallback, lease)
+	}
+	return sem, ok
+}
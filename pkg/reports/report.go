@@ -0,0 +1,204 @@
+package reports
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+// periodLayout is how billing periods are written: a calendar month in UTC.
+const periodLayout = "2006-01"
+
+// ErrInvalidPeriod is returned for a period that is not a YYYY-MM month.
+var ErrInvalidPeriod = errors.New("invalid period: use YYYY-MM")
+
+// ParsePeriod returns the start and (exclusive) end of a YYYY-MM period.
+func ParsePeriod(period string) (from, to time.Time, err error) {
+	from, err = time.Parse(periodLayout, period)
+	if err != nil {
+		return time.Time{}, time.Time{}, ErrInvalidPeriod
+	}
+	return from, from.AddDate(0, 1, 0), nil
+}
+
+// PeriodOf returns the period t falls in.
+func PeriodOf(t time.Time) string {
+	return t.UTC().Format(periodLayout)
+}
+
+// Unassigned names usage of keys without an owner, including keys that no
+// longer exist.
+const Unassigned = "(unassigned)"
+
+// Line totals usage for one service, model, owner, label or key.
+type Line struct {
+	Name             string  `json:"name" example:"openai"`
+	Requests         int64   `json:"requests" example:"1200"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd" example:"12.5"`
+}
+
+func (l *Line) add(r usage.SummaryRow) {
+	l.Requests += r.Requests
+	l.PromptTokens += r.PromptTokens
+	l.CompletionTokens += r.CompletionTokens
+	l.TotalTokens += r.TotalTokens
+	l.CostUSD += r.CostUSD
+}
+
+// Report is an org's chargeback statement for one billing period. Each
+// breakdown adds up to Total, except Labels: a key with several labels
+// counts under each of them, and keys without labels under none.
+type Report struct {
+	OrgID  string    `json:"org_id"`
+	Period string    `json:"period" example:"2025-03"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Final is set once the period had ended when the report was generated.
+	Final       bool      `json:"final"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Total       Line      `json:"total"`
+	Services    []Line    `json:"services"`
+	Models      []Line    `json:"models"`
+	Owners      []Line    `json:"owners"`
+	// Labels are named name=value, e.g. team=search.
+	Labels []Line `json:"labels"`
+	Keys   []Line `json:"keys"`
+}
+
+// Generate builds the report of org for period from the usage in us. Key
+// owners and labels are read from ks as they are now. Costs are those
+// recorded with each request, from its service's token prices.
+func Generate(us usage.Store, ks keys.Store, orgID, period string, now time.Time) (Report, error) {
+	from, to, err := ParsePeriod(period)
+	if err != nil {
+		return Report{}, err
+	}
+	rows, err := us.Summary(usage.SummaryQuery{
+		From:        from,
+		To:          to,
+		ToExclusive: true,
+		OrgID:       orgID,
+		GroupBy:     []string{usage.GroupKey, usage.GroupService, usage.GroupModel},
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	services := map[string]*Line{}
+	models := map[string]*Line{}
+	owners := map[string]*Line{}
+	labels := map[string]*Line{}
+	byKey := map[string]*Line{}
+	found := map[string]keys.VirtualKey{}
+	rep := Report{OrgID: orgID, Period: period, From: from, To: to, Final: !now.Before(to), GeneratedAt: now}
+	for _, r := range rows {
+		keyID := r.Group[usage.GroupKey]
+		k, ok := found[keyID]
+		if !ok {
+			k, _ = ks.Get(keyID)
+			found[keyID] = k
+		}
+		rep.Total.add(r)
+		line(services, r.Group[usage.GroupService]).add(r)
+		line(models, r.Group[usage.GroupModel]).add(r)
+		line(owners, owner(k)).add(r)
+		line(byKey, keyID).add(r)
+		for name, value := range k.Labels {
+			line(labels, name+"="+value).add(r)
+		}
+	}
+	rep.Services = sorted(services)
+	rep.Models = sorted(models)
+	rep.Owners = sorted(owners)
+	rep.Labels = sorted(labels)
+	rep.Keys = sorted(byKey)
+	return rep, nil
+}
+
+// owner returns who k is charged to.
+func owner(k keys.VirtualKey) string {
+	switch {
+	case k.Owner != "":
+		return k.Owner
+	case k.ServiceAccountID != "":
+		return k.ServiceAccountID
+	}
+	return Unassigned
+}
+
+func line(m map[string]*Line, name string) *Line {
+	l, ok := m[name]
+	if !ok {
+		l = &Line{Name: name}
+		m[name] = l
+	}
+	return l
+}
+
+// sorted returns the lines of m, most expensive first.
+func sorted(m map[string]*Line) []Line {
+	out := make([]Line, 0, len(m))
+	for _, l := range m {
+		out = append(out, *l)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CostUSD != out[j].CostUSD {
+			return out[i].CostUSD > out[j].CostUSD
+		}
+		if out[i].Requests != out[j].Requests {
+			return out[i].Requests > out[j].Requests
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Sections of a CSV report, in the order they are written.
+const (
+	SectionTotal   = "total"
+	SectionService = "service"
+	SectionModel   = "model"
+	SectionOwner   = "owner"
+	SectionLabel   = "label"
+	SectionKey     = "key"
+)
+
+// WriteCSV writes r as CSV with one row per line, preceded by a header. The
+// first column names the breakdown the row belongs to.
+func WriteCSV(w io.Writer, r Report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"section", "name", "requests", "prompt_tokens", "completion_tokens", "total_tokens", "cost_usd"}) //nolint:errcheck
+	write := func(section string, lines ...Line) {
+		for _, l := range lines {
+			cw.Write([]string{ //nolint:errcheck
+				section,
+				l.Name,
+				strconv.FormatInt(l.Requests, 10),
+				strconv.FormatInt(l.PromptTokens, 10),
+				strconv.FormatInt(l.CompletionTokens, 10),
+				strconv.FormatInt(l.TotalTokens, 10),
+				strconv.FormatFloat(l.CostUSD, 'f', -1, 64),
+			})
+		}
+	}
+	total := r.Total
+	total.Name = fmt.Sprintf("%s %s", r.OrgID, r.Period)
+	write(SectionTotal, total)
+	write(SectionService, r.Services...)
+	write(SectionModel, r.Models...)
+	write(SectionOwner, r.Owners...)
+	write(SectionLabel, r.Labels...)
+	write(SectionKey, r.Keys...)
+	cw.Flush()
+	return cw.Error()
+}
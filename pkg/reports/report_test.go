@@ -0,0 +1,163 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/orgs"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+func TestParsePeriod(t *testing.T) {
+	from, to, err := ParsePeriod("2025-12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !from.Equal(time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected range %s - %s", from, to)
+	}
+	for _, p := range []string{"", "2025", "2025-13", "2025-3", "2025-03-01", "march"} {
+		if _, _, err := ParsePeriod(p); err != ErrInvalidPeriod {
+			t.Fatalf("ParsePeriod(%q): expected ErrInvalidPeriod, got %v", p, err)
+		}
+	}
+}
+
+// seed records March 2025 usage of org o1 across two keys and the usage of
+// other orgs and months that a March report of o1 must leave out.
+func seed(t *testing.T) (*usage.MemoryStore, *keys.MemoryStore) {
+	t.Helper()
+	ks := keys.NewMemoryStore()
+	ks.Create(keys.VirtualKey{ID: "k1", OrgID: "o1", Owner: "alice", Labels: map[string]string{"team": "search", "env": "prod"}})
+	ks.Create(keys.VirtualKey{ID: "k2", OrgID: "o1", ServiceAccountID: "sa1", Labels: map[string]string{"team": "ads"}})
+	us := usage.NewMemoryStore()
+	march := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, e := range []usage.Event{
+		{KeyID: "k1", OrgID: "o1", Service: "openai", Model: "gpt-4o", Timestamp: march, PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150, CostUSD: 1.5},
+		{KeyID: "k1", OrgID: "o1", Service: "openai", Model: "gpt-4o-mini", Timestamp: march.Add(time.Hour), TotalTokens: 10, CostUSD: 0.25},
+		{KeyID: "k2", OrgID: "o1", Service: "anthropic", Model: "claude", Timestamp: march.Add(24 * time.Hour), TotalTokens: 200, CostUSD: 2},
+		{KeyID: "gone", OrgID: "o1", Service: "anthropic", Model: "claude", Timestamp: march.Add(48 * time.Hour), TotalTokens: 20, CostUSD: 0.5},
+		// Outside the report: another org, the next month and the previous one.
+		{KeyID: "k3", OrgID: "o2", Service: "openai", Timestamp: march, CostUSD: 9},
+		{KeyID: "k1", OrgID: "o1", Service: "openai", Timestamp: march.AddDate(0, 1, 0), CostUSD: 9},
+		{KeyID: "k1", OrgID: "o1", Service: "openai", Timestamp: march.Add(-time.Second), CostUSD: 9},
+	} {
+		if err := us.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return us, ks
+}
+
+func names(lines []Line) []string {
+	var out []string
+	for _, l := range lines {
+		out = append(out, l.Name)
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGenerate(t *testing.T) {
+	us, ks := seed(t)
+	now := time.Date(2025, 4, 2, 0, 0, 0, 0, time.UTC)
+	r, err := Generate(us, ks, "o1", "2025-03", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Final || r.Total.Requests != 4 || r.Total.TotalTokens != 380 || r.Total.CostUSD != 4.25 {
+		t.Fatalf("unexpected total %+v (final %v)", r.Total, r.Final)
+	}
+	for _, tc := range []struct {
+		name  string
+		lines []Line
+		want  []string
+	}{
+		{"services", r.Services, []string{"anthropic", "openai"}},
+		{"models", r.Models, []string{"claude", "gpt-4o", "gpt-4o-mini"}},
+		{"owners", r.Owners, []string{"sa1", "alice", Unassigned}},
+		{"labels", r.Labels, []string{"team=ads", "env=prod", "team=search"}},
+		{"keys", r.Keys, []string{"k2", "k1", "gone"}},
+	} {
+		if got := names(tc.lines); !equal(got, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+	if r.Owners[1].CostUSD != 1.75 || r.Owners[1].Requests != 2 {
+		t.Fatalf("unexpected owner line %+v", r.Owners[1])
+	}
+
+	current, err := Generate(us, ks, "o1", "2025-03", time.Date(2025, 3, 20, 0, 0, 0, 0, time.UTC))
+	if err != nil || current.Final {
+		t.Fatalf("report of an ongoing period must not be final: %v", err)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	us, ks := seed(t)
+	r, _ := Generate(us, ks, "o1", "2025-03", time.Date(2025, 4, 2, 0, 0, 0, 0, time.UTC))
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Header, total, 2 services, 3 models, 3 owners, 3 labels, 3 keys.
+	if len(rows) != 16 {
+		t.Fatalf("expected 16 rows, got %d: %v", len(rows), rows)
+	}
+	if got := rows[1]; got[0] != SectionTotal || got[1] != "o1 2025-03" || got[2] != "4" || got[6] != "4.25" {
+		t.Fatalf("unexpected total row %v", got)
+	}
+	if got := rows[2]; got[0] != SectionService || got[1] != "anthropic" || got[6] != "2.5" {
+		t.Fatalf("unexpected service row %v", got)
+	}
+}
+
+func TestSchedulerRunOnce(t *testing.T) {
+	us, ks := seed(t)
+	orgStore := orgs.NewMemoryStore()
+	orgStore.Create(orgs.Organization{ID: "o1", Name: "one"})
+	orgStore.Create(orgs.Organization{ID: "o2", Name: "two"})
+	store := NewMemoryStore()
+	s := &Scheduler{Usage: us, Keys: ks, Orgs: orgStore, Store: store, Lock: &database.LocalLock{}, Delay: time.Hour}
+	ctx := context.Background()
+
+	// March is not over for another 30 minutes once the delay is counted.
+	if n, err := s.RunOnce(ctx, time.Date(2025, 4, 1, 0, 30, 0, 0, time.UTC)); err != nil || n != 2 {
+		t.Fatalf("expected February reports for both orgs, got %d, %v", n, err)
+	}
+	if _, err := store.Get("o1", "2025-03"); err != ErrReportNotFound {
+		t.Fatalf("March reported before the delay: %v", err)
+	}
+
+	at := time.Date(2025, 4, 1, 1, 30, 0, 0, time.UTC)
+	if n, err := s.RunOnce(ctx, at); err != nil || n != 2 {
+		t.Fatalf("expected March reports for both orgs, got %d, %v", n, err)
+	}
+	r, err := store.Get("o1", "2025-03")
+	if err != nil || !r.Final || r.Total.CostUSD != 4.25 {
+		t.Fatalf("unexpected stored report %+v, %v", r, err)
+	}
+	if n, err := s.RunOnce(ctx, at); err != nil || n != 0 {
+		t.Fatalf("final reports regenerated: %d, %v", n, err)
+	}
+}
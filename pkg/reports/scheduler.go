@@ -0,0 +1,86 @@
+package reports
+
+import (
+	"context"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/metrics"
+	"github.com/farovictor/bifrost/pkg/orgs"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+// LockKey is the Postgres advisory lock key held while generating reports,
+// so only one instance generates them.
+const LockKey int64 = 0x6266_7265_706f_7201
+
+// Scheduler generates the final report of every org once a period ends.
+type Scheduler struct {
+	Usage usage.Store
+	Keys  keys.Store
+	Orgs  orgs.Store
+	Store Store
+	// Lock keeps instances from generating reports concurrently.
+	Lock     database.Locker
+	Interval time.Duration
+	// Delay is how long after a period ends its reports are generated,
+	// leaving time for buffered events of the period to be written.
+	Delay time.Duration
+}
+
+// RunOnce generates the final report of the last complete period for every
+// org without one, if no other instance is doing so. It reports how many
+// reports were generated.
+func (s *Scheduler) RunOnce(ctx context.Context, now time.Time) (int, error) {
+	release, ok, err := s.Lock.TryLock(ctx)
+	if err != nil || !ok {
+		return 0, err
+	}
+	defer release()
+
+	from, _, _ := ParsePeriod(PeriodOf(now.Add(-s.Delay)))
+	period := PeriodOf(from.AddDate(0, -1, 0))
+	generated := 0
+	for _, o := range s.Orgs.List() {
+		if err := ctx.Err(); err != nil {
+			return generated, err
+		}
+		if r, err := s.Store.Get(o.ID, period); err == nil && r.Final {
+			continue
+		} else if err != nil && err != ErrReportNotFound {
+			return generated, err
+		}
+		r, err := Generate(s.Usage, s.Keys, o.ID, period, now)
+		if err != nil {
+			return generated, err
+		}
+		if err := s.Store.Put(r); err != nil {
+			return generated, err
+		}
+		metrics.ReportsGeneratedTotal.Inc()
+		generated++
+	}
+	return generated, nil
+}
+
+// Run calls RunOnce immediately and then every Interval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		n, err := s.RunOnce(ctx, time.Now().UTC())
+		switch {
+		case err != nil && ctx.Err() == nil:
+			logging.Logger.Error().Err(err).Int("generated", n).Msg("generate reports")
+		case n > 0:
+			logging.Logger.Info().Int("generated", n).Msg("generated reports")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package reports
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store defines persistence behavior for generated reports.
+type Store interface {
+	// Get returns the report of org for period, or ErrReportNotFound.
+	Get(orgID, period string) (Report, error)
+	// Put creates or replaces the report of its org and period.
+	Put(Report) error
+}
+
+// MemoryStore keeps reports in memory with concurrency safety.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	reports map[[2]string]Report
+}
+
+// NewMemoryStore creates an initialized MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{reports: make(map[[2]string]Report)}
+}
+
+// Get retrieves a report by org and period.
+func (s *MemoryStore) Get(orgID, period string) (Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.reports[[2]string{orgID, period}]
+	if !ok {
+		return Report{}, ErrReportNotFound
+	}
+	return r, nil
+}
+
+// Put creates or replaces a report.
+func (s *MemoryStore) Put(r Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports[[2]string{r.OrgID, r.Period}] = r
+	return nil
+}
+
+// record is how a report is stored: the report itself is kept as JSON, its
+// breakdowns being read and written whole.
+type record struct {
+	OrgID       string    `gorm:"primaryKey;size:255"`
+	Period      string    `gorm:"primaryKey;size:7"`
+	Final       bool      `gorm:"not null;default:false"`
+	GeneratedAt time.Time `gorm:"not null"`
+	Body        string    `gorm:"type:text;not null"`
+}
+
+func (record) TableName() string { return "chargeback_reports" }
+
+// SQLStore persists reports in a SQL database.
+type SQLStore struct {
+	db *gorm.DB
+}
+
+// NewSQLStore creates a SQL-backed store.
+func NewSQLStore(db *gorm.DB) *SQLStore {
+	Migrate(db)
+	return &SQLStore{db: db}
+}
+
+// Migrate creates or updates the reports table.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&record{})
+}
+
+// Get retrieves a report by org and period.
+func (s *SQLStore) Get(orgID, period string) (Report, error) {
+	var rec record
+	if err := s.db.First(&rec, "org_id = ? AND period = ?", orgID, period).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Report{}, ErrReportNotFound
+		}
+		return Report{}, err
+	}
+	var r Report
+	if err := json.Unmarshal([]byte(rec.Body), &r); err != nil {
+		return Report{}, err
+	}
+	return r, nil
+}
+
+// Put creates or replaces a report.
+func (s *SQLStore) Put(r Report) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	rec := record{OrgID: r.OrgID, Period: r.Period, Final: r.Final, GeneratedAt: r.GeneratedAt, Body: string(body)}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "org_id"}, {Name: "period"}},
+		DoUpdates: clause.AssignmentColumns([]string{"final", "generated_at", "body"}),
+	}).Create(&rec).Error
+}
+
+// ErrReportNotFound is returned when no report was stored for an org and
+// period.
+var ErrReportNotFound = errors.New("report not found")
@@ -11,6 +11,8 @@ type RootKey struct {
 	APIKey          string `json:"api_key,omitempty" gorm:"-"`
 	EncryptedAPIKey []byte `json:"-"                 gorm:"column:encrypted_api_key"`
 	KeyHint         string `json:"key_hint,omitempty" gorm:"column:key_hint;size:8"`
+	// OrgID is the organization that owns the credential.
+	OrgID string `json:"org_id,omitempty" gorm:"size:255;default:'';index"`
 }
 
 func (RootKey) TableName() string { return "root_keys" }
@@ -1,6 +1,7 @@
 package rootkeys
 
 import (
+	"context"
 	"errors"
 	"sync"
 
@@ -8,15 +9,19 @@ import (
 
 	"github.com/farovictor/bifrost/pkg/crypto"
 	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/events"
 )
 
-// Store defines persistence behavior for RootKey objects.
+// Store defines persistence behavior for RootKey objects. Mutating methods
+// publish the given events once the change is made.
 type Store interface {
-	Create(RootKey) error
+	Create(k RootKey, es ...events.Event) error
 	Get(id string) (RootKey, error)
-	Delete(id string) error
-	Update(RootKey) error
+	Delete(id string, es ...events.Event) error
+	Update(k RootKey, es ...events.Event) error
 	List() []RootKey
+	// ListByOrg returns the root keys owned by orgID, without APIKey.
+	ListByOrg(orgID string) []RootKey
 }
 
 // MemoryStore keeps RootKeys in memory with concurrency safety.
@@ -24,6 +29,7 @@ type MemoryStore struct {
 	mu     sync.RWMutex
 	keys   map[string]RootKey
 	encKey []byte // nil means encryption disabled
+	bus    *events.Bus
 }
 
 // NewMemoryStore creates an initialized MemoryStore without encryption.
@@ -40,8 +46,16 @@ func NewMemoryStoreWithKey(encKey []byte) *MemoryStore {
 type SQLStore struct {
 	db     *gorm.DB
 	encKey []byte // nil means encryption disabled
+	bus    *events.Bus
 }
 
+// SetBus makes the store publish events on b.
+func (s *MemoryStore) SetBus(b *events.Bus) { s.bus = b }
+
+// SetBus makes the store publish events on b, in the transaction making the
+// change.
+func (s *SQLStore) SetBus(b *events.Bus) { s.bus = b }
+
 // NewSQLStore creates a SQL-backed store without encryption.
 func NewSQLStore(db *gorm.DB) *SQLStore {
 	db.AutoMigrate(&RootKey{})
@@ -92,7 +106,8 @@ func decryptRootKey(k *RootKey, encKey []byte) error {
 
 // ── MemoryStore ──────────────────────────────────────────────────────────────
 
-func (s *MemoryStore) Create(k RootKey) error {
+func (s *MemoryStore) Create(k RootKey, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	if err := encryptRootKey(&k, s.encKey); err != nil {
 		return err
 	}
@@ -118,7 +133,8 @@ func (s *MemoryStore) Get(id string) (RootKey, error) {
 	return k, nil
 }
 
-func (s *MemoryStore) Delete(id string) error {
+func (s *MemoryStore) Delete(id string, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.keys[id]; !ok {
@@ -128,7 +144,8 @@ func (s *MemoryStore) Delete(id string) error {
 	return nil
 }
 
-func (s *MemoryStore) Update(k RootKey) error {
+func (s *MemoryStore) Update(k RootKey, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	if err := encryptRootKey(&k, s.encKey); err != nil {
 		return err
 	}
@@ -153,19 +170,35 @@ func (s *MemoryStore) List() []RootKey {
 	return out
 }
 
+// ListByOrg returns the RootKeys owned by orgID. APIKey is not populated.
+func (s *MemoryStore) ListByOrg(orgID string) []RootKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]RootKey, 0)
+	for _, k := range s.keys {
+		if k.OrgID == orgID {
+			k.APIKey = ""
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
 // ── SQLStore ─────────────────────────────────────────────────────────────────
 
-func (s *SQLStore) Create(k RootKey) error {
-	if err := encryptRootKey(&k, s.encKey); err != nil {
-		return err
-	}
-	if err := s.db.Create(&k).Error; err != nil {
-		if database.IsDuplicateError(err) {
-			return ErrKeyExists
+func (s *SQLStore) Create(k RootKey, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		if err := encryptRootKey(&k, s.encKey); err != nil {
+			return err
 		}
-		return err
-	}
-	return nil
+		if err := tx.Create(&k).Error; err != nil {
+			if database.IsDuplicateError(err) {
+				return ErrKeyExists
+			}
+			return err
+		}
+		return nil
+	}, es...)
 }
 
 func (s *SQLStore) Get(id string) (RootKey, error) {
@@ -182,32 +215,36 @@ func (s *SQLStore) Get(id string) (RootKey, error) {
 	return k, nil
 }
 
-func (s *SQLStore) Delete(id string) error {
-	res := s.db.Delete(&RootKey{}, "id = ?", id)
-	if res.Error != nil {
-		return res.Error
-	}
-	if res.RowsAffected == 0 {
-		return ErrKeyNotFound
-	}
-	return nil
+func (s *SQLStore) Delete(id string, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		res := tx.Delete(&RootKey{}, "id = ?", id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrKeyNotFound
+		}
+		return nil
+	}, es...)
 }
 
-func (s *SQLStore) Update(k RootKey) error {
-	if err := encryptRootKey(&k, s.encKey); err != nil {
-		return err
-	}
-	res := s.db.Model(&RootKey{}).Where("id = ?", k.ID).Updates(map[string]any{
-		"encrypted_api_key": k.EncryptedAPIKey,
-		"key_hint":          k.KeyHint,
-	})
-	if res.Error != nil {
-		return res.Error
-	}
-	if res.RowsAffected == 0 {
-		return ErrKeyNotFound
-	}
-	return nil
+func (s *SQLStore) Update(k RootKey, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		if err := encryptRootKey(&k, s.encKey); err != nil {
+			return err
+		}
+		res := tx.Model(&RootKey{}).Where("id = ?", k.ID).Updates(map[string]any{
+			"encrypted_api_key": k.EncryptedAPIKey,
+			"key_hint":          k.KeyHint,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrKeyNotFound
+		}
+		return nil
+	}, es...)
 }
 
 // List returns all root keys. APIKey is not populated — use Get for plaintext.
@@ -219,6 +256,15 @@ func (s *SQLStore) List() []RootKey {
 	return out
 }
 
+// ListByOrg returns the root keys owned by orgID. APIKey is not populated.
+func (s *SQLStore) ListByOrg(orgID string) []RootKey {
+	var out []RootKey
+	if err := s.db.Where("org_id = ?", orgID).Find(&out).Error; err != nil {
+		return nil
+	}
+	return out
+}
+
 var (
 	ErrKeyNotFound = errors.New("root key not found")
 	ErrKeyExists   = errors.New("root key already exists")
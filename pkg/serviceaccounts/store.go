@@ -1,29 +1,36 @@
 package serviceaccounts
 
 import (
+	"context"
 	"sync"
 
 	"gorm.io/gorm"
+
+	"github.com/farovictor/bifrost/pkg/events"
 )
 
-// Store defines persistence behaviour for service accounts.
+// Store defines persistence behaviour for service accounts. Mutating methods
+// publish the given events once the change is made.
 type Store interface {
-	Create(ServiceAccount) error
+	Create(sa ServiceAccount, es ...events.Event) error
 	Get(id string) (ServiceAccount, error)
 	GetByAPIKey(apiKey string) (ServiceAccount, error)
 	List() []ServiceAccount
-	Delete(id string) error
+	ListByOrg(orgID string) []ServiceAccount
+	Delete(id string, es ...events.Event) error
 }
 
 // MemoryStore is an in-memory Store used in tests and in-memory mode.
 type MemoryStore struct {
 	mu       sync.RWMutex
 	accounts []ServiceAccount
+	bus      *events.Bus
 }
 
 func NewMemoryStore() *MemoryStore { return &MemoryStore{} }
 
-func (s *MemoryStore) Create(sa ServiceAccount) error {
+func (s *MemoryStore) Create(sa ServiceAccount, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	for _, a := range s.accounts {
@@ -65,7 +72,20 @@ func (s *MemoryStore) List() []ServiceAccount {
 	return out
 }
 
-func (s *MemoryStore) Delete(id string) error {
+func (s *MemoryStore) ListByOrg(orgID string) []ServiceAccount {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]ServiceAccount, 0)
+	for _, a := range s.accounts {
+		if a.OrgID == orgID {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func (s *MemoryStore) Delete(id string, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	for i, a := range s.accounts {
@@ -79,23 +99,33 @@ func (s *MemoryStore) Delete(id string) error {
 
 // SQLStore persists service accounts in a SQL database via GORM.
 type SQLStore struct {
-	db *gorm.DB
+	db  *gorm.DB
+	bus *events.Bus
 }
 
+// SetBus makes the store publish events on b.
+func (s *MemoryStore) SetBus(b *events.Bus) { s.bus = b }
+
+// SetBus makes the store publish events on b, in the transaction making the
+// change.
+func (s *SQLStore) SetBus(b *events.Bus) { s.bus = b }
+
 func NewSQLStore(db *gorm.DB) *SQLStore {
 	db.AutoMigrate(&ServiceAccount{})
 	return &SQLStore{db: db}
 }
 
-func (s *SQLStore) Create(sa ServiceAccount) error {
-	result := s.db.Create(&sa)
-	if result.Error != nil {
-		if isUniqueViolation(result.Error) {
-			return ErrServiceAccountExists
+func (s *SQLStore) Create(sa ServiceAccount, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		result := tx.Create(&sa)
+		if result.Error != nil {
+			if isUniqueViolation(result.Error) {
+				return ErrServiceAccountExists
+			}
+			return result.Error
 		}
-		return result.Error
-	}
-	return nil
+		return nil
+	}, es...)
 }
 
 func (s *SQLStore) Get(id string) (ServiceAccount, error) {
@@ -126,15 +156,23 @@ func (s *SQLStore) List() []ServiceAccount {
 	return accounts
 }
 
-func (s *SQLStore) Delete(id string) error {
-	result := s.db.Delete(&ServiceAccount{}, "id = ?", id)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return ErrServiceAccountNotFound
-	}
-	return nil
+func (s *SQLStore) ListByOrg(orgID string) []ServiceAccount {
+	var accounts []ServiceAccount
+	s.db.Where("org_id = ?", orgID).Find(&accounts)
+	return accounts
+}
+
+func (s *SQLStore) Delete(id string, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		result := tx.Delete(&ServiceAccount{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrServiceAccountNotFound
+		}
+		return nil
+	}, es...)
 }
 
 // isUniqueViolation reports whether err looks like a unique-constraint violation
@@ -14,6 +14,24 @@ type Service struct {
 	Endpoint         string `json:"endpoint" gorm:"not null"`
 	RootKeyID        string `json:"root_key_id" gorm:"not null"`
 	CredentialHeader string `json:"credential_header,omitempty" gorm:"size:255"`
+	// OrgID is the organization that owns the service. Only its keys may
+	// reach it, and its root key must belong to the same organization.
+	OrgID string `json:"org_id,omitempty" gorm:"size:255;default:'';index"`
+	// TokensPerMinute caps LLM tokens per minute across every key targeting
+	// the service. Zero means unlimited.
+	TokensPerMinute int `json:"tokens_per_minute,omitempty" gorm:"default:0"`
+	// MaxConcurrent caps the requests in flight to the service across every
+	// key. Zero means unlimited.
+	MaxConcurrent int `json:"max_concurrent,omitempty" gorm:"default:0"`
+	// PromptTokenPrice and CompletionTokenPrice are the upstream's prices in
+	// USD per million tokens, used to cost usage events.
+	PromptTokenPrice     float64 `json:"prompt_token_price,omitempty" gorm:"default:0"`
+	CompletionTokenPrice float64 `json:"completion_token_price,omitempty" gorm:"default:0"`
 }
 
 func (Service) TableName() string { return "services" }
+
+// Cost returns the price in USD of a request using the given tokens.
+func (s Service) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*s.PromptTokenPrice + float64(completionTokens)*s.CompletionTokenPrice) / 1e6
+}
@@ -1,27 +1,33 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"sync"
 
 	"gorm.io/gorm"
 
 	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/events"
 )
 
-// Store defines persistence behavior for Service objects.
+// Store defines persistence behavior for Service objects. Mutating methods
+// publish the given events once the change is made.
 type Store interface {
-	Create(Service) error
+	Create(svc Service, es ...events.Event) error
 	Get(id string) (Service, error)
-	Update(Service) error
-	Delete(id string) error
+	Update(svc Service, es ...events.Event) error
+	Delete(id string, es ...events.Event) error
 	List() []Service
+	// ListByOrg returns the services owned by orgID.
+	ListByOrg(orgID string) []Service
 }
 
 // MemoryStore provides concurrency-safe storage for Service definitions.
 type MemoryStore struct {
 	mu       sync.RWMutex
 	services map[string]Service
+	bus      *events.Bus
 }
 
 // NewMemoryStore creates an initialized MemoryStore.
@@ -37,11 +43,20 @@ func NewSQLStore(db *gorm.DB) *SQLStore {
 
 // SQLStore persists services in a SQL database.
 type SQLStore struct {
-	db *gorm.DB
+	db  *gorm.DB
+	bus *events.Bus
 }
 
+// SetBus makes the store publish events on b.
+func (s *MemoryStore) SetBus(b *events.Bus) { s.bus = b }
+
+// SetBus makes the store publish events on b, in the transaction making the
+// change.
+func (s *SQLStore) SetBus(b *events.Bus) { s.bus = b }
+
 // Create inserts a new Service. Returns an error if the ID already exists.
-func (s *MemoryStore) Create(svc Service) error {
+func (s *MemoryStore) Create(svc Service, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.services[svc.ID]; ok {
@@ -63,7 +78,8 @@ func (s *MemoryStore) Get(id string) (Service, error) {
 }
 
 // Update replaces a Service.
-func (s *MemoryStore) Update(svc Service) error {
+func (s *MemoryStore) Update(svc Service, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.services[svc.ID]; !ok {
@@ -74,7 +90,8 @@ func (s *MemoryStore) Update(svc Service) error {
 }
 
 // Delete removes a Service.
-func (s *MemoryStore) Delete(id string) error {
+func (s *MemoryStore) Delete(id string, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.services[id]; !ok {
@@ -95,15 +112,30 @@ func (s *MemoryStore) List() []Service {
 	return out
 }
 
-// Create inserts a service into the database.
-func (s *SQLStore) Create(svc Service) error {
-	if err := s.db.Create(&svc).Error; err != nil {
-		if database.IsDuplicateError(err) {
-			return ErrServiceExists
+// ListByOrg returns the Services owned by orgID.
+func (s *MemoryStore) ListByOrg(orgID string) []Service {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Service, 0)
+	for _, svc := range s.services {
+		if svc.OrgID == orgID {
+			out = append(out, svc)
 		}
-		return err
 	}
-	return nil
+	return out
+}
+
+// Create inserts a service into the database.
+func (s *SQLStore) Create(svc Service, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		if err := tx.Create(&svc).Error; err != nil {
+			if database.IsDuplicateError(err) {
+				return ErrServiceExists
+			}
+			return err
+		}
+		return nil
+	}, es...)
 }
 
 // Get retrieves a service by ID.
@@ -119,27 +151,31 @@ func (s *SQLStore) Get(id string) (Service, error) {
 }
 
 // Update replaces a service.
-func (s *SQLStore) Update(svc Service) error {
-	res := s.db.Where("id = ?", svc.ID).Updates(&svc)
-	if res.Error != nil {
-		return res.Error
-	}
-	if res.RowsAffected == 0 {
-		return ErrServiceNotFound
-	}
-	return nil
+func (s *SQLStore) Update(svc Service, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		res := tx.Where("id = ?", svc.ID).Updates(&svc)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrServiceNotFound
+		}
+		return nil
+	}, es...)
 }
 
 // Delete removes a service.
-func (s *SQLStore) Delete(id string) error {
-	res := s.db.Delete(&Service{}, "id = ?", id)
-	if res.Error != nil {
-		return res.Error
-	}
-	if res.RowsAffected == 0 {
-		return ErrServiceNotFound
-	}
-	return nil
+func (s *SQLStore) Delete(id string, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		res := tx.Delete(&Service{}, "id = ?", id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrServiceNotFound
+		}
+		return nil
+	}, es...)
 }
 
 // List returns all services from the database.
@@ -151,6 +187,15 @@ func (s *SQLStore) List() []Service {
 	return out
 }
 
+// ListByOrg returns the services owned by orgID.
+func (s *SQLStore) ListByOrg(orgID string) []Service {
+	var out []Service
+	if err := s.db.Where("org_id = ?", orgID).Find(&out).Error; err != nil {
+		return nil
+	}
+	return out
+}
+
 // Error definitions for Store operations.
 var (
 	ErrServiceNotFound = errors.New("service not found")
@@ -0,0 +1,309 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/metrics"
+)
+
+// ArchiverOptions tunes an Archiver. Zero values take the defaults below.
+type ArchiverOptions struct {
+	// Prefix is prepended to every object key.
+	Prefix string
+	// BatchSize is the most records in one object.
+	BatchSize int
+	// FlushInterval is the longest a record waits before its object is
+	// written, however small.
+	FlushInterval time.Duration
+	// BufferSize is how many records may wait to be written, including those
+	// waiting for a retry. Records added while the buffer is full are dropped.
+	BufferSize int
+	// MaxRetries is how many times a failed write is retried, with
+	// exponential backoff from RetryBackoff, before its records are dropped.
+	// Retries wait on a timer, so other objects are written meanwhile. A
+	// negative value disables retries.
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+// Archiver defaults.
+const (
+	DefaultBatchSize     = 1000
+	DefaultFlushInterval = time.Minute
+	DefaultBufferSize    = 100000
+	DefaultMaxRetries    = 5
+	DefaultRetryBackoff  = time.Second
+)
+
+// batch collects the JSON lines of one stream and hour.
+type batch struct {
+	stream string
+	hour   time.Time
+	lines  bytes.Buffer
+	n      int
+}
+
+// object is a compressed batch waiting to be written, possibly again.
+type object struct {
+	stream  string
+	key     string
+	body    []byte
+	n       int
+	attempt int
+	due     time.Time
+}
+
+// Archiver batches records into gzip-compressed JSON lines objects and
+// writes them to a Sink from a background worker. Objects are keyed
+//
+//	<prefix>/<stream>/year=2025/month=03/day=14/hour=09/<unix nanos>-<id>.jsonl.gz
+//
+// by the hour of their records' timestamps, so warehouse tools can prune
+// partitions by time.
+type Archiver struct {
+	sink Sink
+	opts ArchiverOptions
+
+	mu      sync.Mutex
+	batches map[string]*batch
+	pending int
+	closed  bool
+
+	// retries is only used by the worker.
+	retries []*object
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewArchiver starts an Archiver writing to s.
+func NewArchiver(s Sink, opts ArchiverOptions) *Archiver {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = DefaultMaxRetries
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultRetryBackoff
+	}
+	a := &Archiver{
+		sink:    s,
+		opts:    opts,
+		batches: map[string]*batch{},
+		kick:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Add queues record, encoded as JSON, for the stream's object covering ts.
+// It never blocks on the sink.
+func (a *Archiver) Add(stream string, ts time.Time, record any) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	hour := ts.UTC().Truncate(time.Hour)
+	id := stream + "/" + hour.Format(time.RFC3339)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return fmt.Errorf("sink: archiver is closed")
+	}
+	if a.pending >= a.opts.BufferSize {
+		metrics.SinkRecordsDroppedTotal.WithLabelValues(stream).Inc()
+		return nil
+	}
+	b := a.batches[id]
+	if b == nil {
+		b = &batch{stream: stream, hour: hour}
+		a.batches[id] = b
+	}
+	b.lines.Write(line)
+	b.lines.WriteByte('\n')
+	b.n++
+	a.pending++
+	if b.n >= a.opts.BatchSize {
+		select {
+		case a.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close stops accepting records and waits until every queued record has
+// been written, or dropped after its retries, or ctx is done.
+func (a *Archiver) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.stop)
+	}
+	a.mu.Unlock()
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *Archiver) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.opts.FlushInterval)
+	defer ticker.Stop()
+	stop := a.stop
+	for stop != nil || len(a.retries) > 0 {
+		var retry <-chan time.Time
+		var timer *time.Timer
+		if len(a.retries) > 0 {
+			timer = time.NewTimer(time.Until(a.nextRetry()))
+			retry = timer.C
+		}
+		select {
+		case <-a.kick:
+			a.flush(false)
+		case <-ticker.C:
+			a.flush(true)
+		case now := <-retry:
+			a.retry(now)
+		case <-stop:
+			// Keep running until the remaining retries are done.
+			a.flush(true)
+			stop = nil
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// flush writes the full batches, or every batch if all is set.
+func (a *Archiver) flush(all bool) {
+	a.mu.Lock()
+	var ready []*batch
+	for id, b := range a.batches {
+		if all || b.n >= a.opts.BatchSize {
+			ready = append(ready, b)
+			delete(a.batches, id)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, b := range ready {
+		o, err := a.encode(b)
+		if err != nil {
+			a.drop(b.stream, b.n, err)
+			continue
+		}
+		a.put(o)
+	}
+}
+
+// encode compresses b into an object named for now.
+func (a *Archiver) encode(b *batch) (*object, error) {
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write(b.lines.Bytes()) //nolint:errcheck
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return &object{stream: b.stream, key: a.key(b, time.Now()), body: body.Bytes(), n: b.n}, nil
+}
+
+// put writes o to the sink once. A failed write is scheduled for a retry
+// after an exponential backoff, or dropped once its retries are used up.
+func (a *Archiver) put(o *object) {
+	err := a.sink.Put(context.Background(), o.key, o.body)
+	if err == nil {
+		metrics.SinkObjectsWrittenTotal.WithLabelValues(o.stream).Inc()
+		a.release(o.n)
+		return
+	}
+	metrics.SinkWriteErrorsTotal.WithLabelValues(o.stream).Inc()
+	if o.attempt >= a.opts.MaxRetries {
+		a.drop(o.stream, o.n, err)
+		return
+	}
+	o.due = time.Now().Add(a.opts.RetryBackoff << o.attempt)
+	o.attempt++
+	a.retries = append(a.retries, o)
+}
+
+// nextRetry returns when the earliest retry is due.
+func (a *Archiver) nextRetry() time.Time {
+	next := a.retries[0].due
+	for _, o := range a.retries[1:] {
+		if o.due.Before(next) {
+			next = o.due
+		}
+	}
+	return next
+}
+
+// retry writes the objects due at now again.
+func (a *Archiver) retry(now time.Time) {
+	var due []*object
+	waiting := a.retries[:0]
+	for _, o := range a.retries {
+		if o.due.After(now) {
+			waiting = append(waiting, o)
+		} else {
+			due = append(due, o)
+		}
+	}
+	a.retries = waiting
+	for _, o := range due {
+		a.put(o)
+	}
+}
+
+// drop gives up on n records of stream.
+func (a *Archiver) drop(stream string, n int, err error) {
+	metrics.SinkRecordsDroppedTotal.WithLabelValues(stream).Add(float64(n))
+	logging.Logger.Error().Err(err).Str("stream", stream).Int("records", n).Msg("archive records")
+	a.release(n)
+}
+
+// release frees the buffer space of n records that were written or dropped.
+func (a *Archiver) release(n int) {
+	a.mu.Lock()
+	a.pending -= n
+	a.mu.Unlock()
+}
+
+// key names the object of b written at now.
+func (a *Archiver) key(b *batch, now time.Time) string {
+	h := b.hour
+	return path.Join(a.opts.Prefix, b.stream,
+		fmt.Sprintf("year=%04d", h.Year()),
+		fmt.Sprintf("month=%02d", h.Month()),
+		fmt.Sprintf("day=%02d", h.Day()),
+		fmt.Sprintf("hour=%02d", h.Hour()),
+		fmt.Sprintf("%d-%s.jsonl.gz", now.UnixNano(), uuid.NewString()[:8]),
+	)
+}
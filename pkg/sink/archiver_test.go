@@ -0,0 +1,168 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySink keeps objects in memory and fails the first failures puts and
+// every put under the prefix fail.
+type memorySink struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	failures int
+	fail     string
+	attempts int
+}
+
+func (m *memorySink) Put(_ context.Context, key string, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts++
+	if m.failures > 0 || m.fail != "" && strings.HasPrefix(key, m.fail) {
+		m.failures--
+		return errors.New("unavailable")
+	}
+	if m.objects == nil {
+		m.objects = map[string][]byte{}
+	}
+	m.objects[key] = body
+	return nil
+}
+
+func (m *memorySink) putAttempts() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.attempts
+}
+
+func (m *memorySink) lines(t *testing.T) map[string][]string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := map[string][]string{}
+	for key, body := range m.objects {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+		plain, _ := io.ReadAll(zr)
+		out[key] = strings.Split(strings.TrimSpace(string(plain)), "\n")
+	}
+	return out
+}
+
+func TestArchiverPartitionsByStreamAndHour(t *testing.T) {
+	s := &memorySink{}
+	a := NewArchiver(s, ArchiverOptions{Prefix: "bifrost", FlushInterval: time.Hour})
+	at := time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC)
+	a.Add("usage", at, map[string]int{"n": 1})
+	a.Add("usage", at.Add(10*time.Minute), map[string]int{"n": 2})
+	a.Add("usage", at.Add(time.Hour), map[string]int{"n": 3})
+	a.Add("audit", at, map[string]int{"n": 4})
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Add("usage", at, 5); err == nil {
+		t.Fatal("expected Add after Close to fail")
+	}
+
+	objects := s.lines(t)
+	if len(objects) != 3 {
+		t.Fatalf("expected 3 objects, got %v", objects)
+	}
+	want := map[string]string{
+		"bifrost/usage/year=2025/month=03/day=14/hour=09/": `{"n":1} {"n":2}`,
+		"bifrost/usage/year=2025/month=03/day=14/hour=10/": `{"n":3}`,
+		"bifrost/audit/year=2025/month=03/day=14/hour=09/": `{"n":4}`,
+	}
+	for key, lines := range objects {
+		dir := key[:strings.LastIndex(key, "/")+1]
+		if !strings.HasSuffix(key, ".jsonl.gz") || want[dir] != strings.Join(lines, " ") {
+			t.Fatalf("unexpected object %s: %v", key, lines)
+		}
+	}
+}
+
+func TestArchiverFlushesFullBatches(t *testing.T) {
+	s := &memorySink{}
+	a := NewArchiver(s, ArchiverOptions{BatchSize: 2, FlushInterval: time.Hour})
+	defer a.Close(context.Background())
+	now := time.Now()
+	a.Add("usage", now, 1)
+	a.Add("usage", now, 2)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(s.lines(t)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("full batch was not written")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestArchiverRetries(t *testing.T) {
+	s := &memorySink{failures: 2}
+	a := NewArchiver(s, ArchiverOptions{FlushInterval: time.Hour, RetryBackoff: time.Millisecond})
+	a.Add("usage", time.Now(), 1)
+	a.Close(context.Background())
+	if len(s.lines(t)) != 1 || s.attempts != 3 {
+		t.Fatalf("expected 1 object after 3 attempts, got %d after %d", len(s.objects), s.attempts)
+	}
+
+	s = &memorySink{failures: 10}
+	a = NewArchiver(s, ArchiverOptions{FlushInterval: time.Hour, MaxRetries: 1, RetryBackoff: time.Millisecond})
+	a.Add("usage", time.Now(), 1)
+	a.Close(context.Background())
+	if len(s.objects) != 0 || s.attempts != 2 {
+		t.Fatalf("expected the batch dropped after 2 attempts, got %d objects after %d", len(s.objects), s.attempts)
+	}
+}
+
+func TestArchiverRetryDoesNotBlockWrites(t *testing.T) {
+	s := &memorySink{fail: "audit/"}
+	a := NewArchiver(s, ArchiverOptions{BatchSize: 1, FlushInterval: time.Hour, RetryBackoff: time.Hour})
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		a.Close(ctx) //nolint:errcheck
+	}()
+	a.Add("audit", time.Now(), 1)
+	deadline := time.Now().Add(2 * time.Second)
+	for s.putAttempts() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("failing batch was not written")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	a.Add("usage", time.Now(), 2)
+
+	for len(s.lines(t)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("write was held up by a pending retry")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestArchiverBufferFull(t *testing.T) {
+	s := &memorySink{}
+	a := NewArchiver(s, ArchiverOptions{BatchSize: 10, BufferSize: 2, FlushInterval: time.Hour})
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		a.Add("usage", now, i)
+	}
+	a.Close(context.Background())
+	for _, lines := range s.lines(t) {
+		if len(lines) != 2 {
+			t.Fatalf("expected 2 buffered records, got %v", lines)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package sink
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// Filesystem is a Sink writing objects as files below Dir, for installs
+// without object storage. Keys map to paths relative to Dir.
+type Filesystem struct {
+	Dir string
+}
+
+// NewFilesystem returns a Filesystem sink rooted at dir.
+func NewFilesystem(dir string) *Filesystem {
+	return &Filesystem{Dir: dir}
+}
+
+// Put implements Sink. The object is written to a temporary file first and
+// renamed into place, so readers never see a partial object.
+func (f *Filesystem) Put(_ context.Context, key string, body []byte) error {
+	path := filepath.Join(f.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
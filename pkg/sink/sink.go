@@ -0,0 +1,13 @@
+// Package sink archives usage and audit records to object storage. An
+// Archiver batches records into gzip-compressed JSON lines objects,
+// partitioned by stream and hour, and writes them to a Sink: S3-compatible
+// object storage or a local directory.
+package sink
+
+import "context"
+
+// Sink stores whole objects under a key. Put must be safe to retry: writing
+// the same key twice leaves one copy of the object.
+type Sink interface {
+	Put(ctx context.Context, key string, body []byte) error
+}
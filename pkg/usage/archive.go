@@ -0,0 +1,44 @@
+package usage
+
+import "time"
+
+// ArchiveStream is the archive stream usage events are written to.
+const ArchiveStream = "usage"
+
+// Archiver receives records to keep outside the database, such as a
+// sink.Archiver writing to object storage.
+type Archiver interface {
+	Add(stream string, ts time.Time, record any) error
+}
+
+// ArchivingStore is a Store that also archives every event it records. The
+// archive is independent of the database: events are archived after the
+// database write, so batches carry the IDs it assigned, but also when the
+// write fails, and database retention does not affect them.
+type ArchivingStore struct {
+	Store
+	Archive Archiver
+}
+
+// Record implements Store.
+func (s *ArchivingStore) Record(e Event) error {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	err := s.Store.Record(e)
+	s.archive(e)
+	return err
+}
+
+// RecordBatch implements Store.
+func (s *ArchivingStore) RecordBatch(events []Event) error {
+	err := s.Store.RecordBatch(events)
+	for _, e := range events {
+		s.archive(e)
+	}
+	return err
+}
+
+func (s *ArchivingStore) archive(e Event) {
+	s.Archive.Add(ArchiveStream, e.Timestamp, e) //nolint:errcheck
+}
@@ -1,11 +1,48 @@
 package usage
 
-import "time"
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/utils"
+)
+
+// Event categories classify requests that did not succeed. Requests turned
+// away before reaching the upstream use the rate limit reasons
+// (rate_limited, quota_exceeded, budget_exceeded, concurrency_limited,
+// upstream_throttled) or one of the Category* rejections below; forwarded
+// requests get an upstream category from their response.
+const (
+	CategoryExpired             = "expired"
+	CategoryKeyUsed             = "key_used"
+	CategorySuspended           = "suspended"
+	CategoryScope               = "scope"
+	CategoryMisconfigured       = "misconfigured"
+	CategoryTooLarge            = "too_large"
+	CategoryUpstreamClientError = "upstream_client_error"
+	CategoryUpstreamRateLimited = "upstream_rate_limited"
+	CategoryUpstreamError       = "upstream_error"
+	CategoryUpstreamUnreachable = "upstream_unreachable"
+	CategoryCanceled            = "canceled"
+)
+
+// Column sizes of the free-form request details.
+const (
+	maxUserAgent = 512
+	maxEndpoint  = 1024
+)
 
 // Event records a single proxied request for a virtual key.
 type Event struct {
 	ID               uint      `json:"id"                gorm:"primaryKey;autoIncrement"`
 	KeyID            string    `json:"key_id"            gorm:"not null;index"`
+	OrgID            string    `json:"org_id,omitempty"  gorm:"size:255;default:'';index"`
+	Source           string    `json:"source,omitempty"  gorm:"size:16;default:''"`
 	Timestamp        time.Time `json:"timestamp"         gorm:"not null;index"`
 	StatusCode       int       `json:"status_code"       gorm:"not null"`
 	Service          string    `json:"service"           gorm:"not null;size:255"`
@@ -13,6 +50,82 @@ type Event struct {
 	PromptTokens     int       `json:"prompt_tokens,omitempty"`
 	CompletionTokens int       `json:"completion_tokens,omitempty"`
 	TotalTokens      int       `json:"total_tokens,omitempty"`
+	// Model is the model reported by the upstream, or else the one named in
+	// the request, when known.
+	Model string `json:"model,omitempty" gorm:"size:255;default:''"`
+	// CostUSD is priced from the service's per-token prices.
+	CostUSD       float64 `json:"cost_usd,omitempty"       gorm:"default:0"`
+	RequestBytes  int64   `json:"request_bytes,omitempty"  gorm:"default:0"`
+	ResponseBytes int64   `json:"response_bytes,omitempty" gorm:"default:0"`
+	ClientIP      string  `json:"client_ip,omitempty"      gorm:"size:64;default:''"`
+	UserAgent     string  `json:"user_agent,omitempty"     gorm:"size:512;default:''"`
+	// RequestID is the X-Request-Id assigned by the router.
+	RequestID string `json:"request_id,omitempty" gorm:"size:64;default:'';index"`
+	// UpstreamEndpoint is the upstream URL without its query string. It is
+	// empty for requests rejected before forwarding.
+	UpstreamEndpoint string `json:"upstream_endpoint,omitempty" gorm:"size:1024;default:''"`
+	// TTFBMS is the time until the upstream's response headers arrived.
+	TTFBMS int64 `json:"ttfb_ms,omitempty" gorm:"column:ttfb_ms;default:0"`
+	// Category classifies failed and rejected requests; it is empty on
+	// success.
+	Category string `json:"category,omitempty" gorm:"size:32;default:'';index"`
 }
 
 func (Event) TableName() string { return "usage_events" }
+
+// FromRequest starts the event of a request made with k, filled in with the
+// key and client details. The caller sets the outcome.
+func FromRequest(r *http.Request, k keys.VirtualKey) Event {
+	ev := Event{
+		KeyID:     k.ID,
+		OrgID:     k.OrgID,
+		Source:    k.Source,
+		Timestamp: time.Now(),
+		Service:   k.Target,
+		ClientIP:  clientIP(r.RemoteAddr),
+		UserAgent: utils.Truncate(r.UserAgent(), maxUserAgent),
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+	if r.ContentLength > 0 {
+		ev.RequestBytes = r.ContentLength
+	}
+	return ev
+}
+
+// Rejected returns the event of a request made with k that was turned away
+// with status before reaching the upstream.
+func Rejected(r *http.Request, k keys.VirtualKey, start time.Time, status int, category string) Event {
+	ev := FromRequest(r, k)
+	ev.StatusCode = status
+	ev.LatencyMS = time.Since(start).Milliseconds()
+	ev.Category = category
+	return ev
+}
+
+// UpstreamCategory classifies a forwarded request by its upstream status.
+func UpstreamCategory(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return CategoryUpstreamRateLimited
+	case status >= http.StatusInternalServerError:
+		return CategoryUpstreamError
+	case status >= http.StatusBadRequest:
+		return CategoryUpstreamClientError
+	}
+	return ""
+}
+
+// SetEndpoint records u, minus its query string, as the upstream endpoint.
+func (e *Event) SetEndpoint(u *url.URL) {
+	endpoint := *u
+	endpoint.RawQuery, endpoint.Fragment, endpoint.User = "", "", nil
+	e.UpstreamEndpoint = utils.Truncate(endpoint.String(), maxEndpoint)
+}
+
+// clientIP strips the port from a remote address.
+func clientIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
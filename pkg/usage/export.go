@@ -0,0 +1,135 @@
+package usage
+
+import (
+	"io"
+	"sort"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/export"
+	"github.com/farovictor/bifrost/pkg/parquet"
+)
+
+// ExportQuery selects the events to export. Events are exported oldest
+// first within [From, To); a zero bound is unbounded.
+type ExportQuery struct {
+	From, To time.Time
+	OrgID    string
+	Service  string
+}
+
+func (q ExportQuery) matches(e Event) bool {
+	return (q.From.IsZero() || !e.Timestamp.Before(q.From)) &&
+		(q.To.IsZero() || e.Timestamp.Before(q.To)) &&
+		(q.OrgID == "" || e.OrgID == q.OrgID) &&
+		(q.Service == "" || e.Service == q.Service)
+}
+
+// exportColumn is one column of an export, in every format.
+type exportColumn struct {
+	name  string
+	typ   parquet.Type
+	value func(Event) any
+}
+
+// exportColumns is the export schema. Columns are only ever appended, so
+// files written by older versions remain readable with the same schema.
+var exportColumns = []exportColumn{
+	{"id", parquet.Int64, func(e Event) any { return int64(e.ID) }},
+	{"timestamp", parquet.Timestamp, func(e Event) any { return e.Timestamp.UTC() }},
+	{"key_id", parquet.String, func(e Event) any { return e.KeyID }},
+	{"org_id", parquet.String, func(e Event) any { return e.OrgID }},
+	{"service", parquet.String, func(e Event) any { return e.Service }},
+	{"source", parquet.String, func(e Event) any { return e.Source }},
+	{"model", parquet.String, func(e Event) any { return e.Model }},
+	{"status_code", parquet.Int32, func(e Event) any { return int32(e.StatusCode) }},
+	{"category", parquet.String, func(e Event) any { return e.Category }},
+	{"latency_ms", parquet.Int64, func(e Event) any { return e.LatencyMS }},
+	{"ttfb_ms", parquet.Int64, func(e Event) any { return e.TTFBMS }},
+	{"prompt_tokens", parquet.Int64, func(e Event) any { return int64(e.PromptTokens) }},
+	{"completion_tokens", parquet.Int64, func(e Event) any { return int64(e.CompletionTokens) }},
+	{"total_tokens", parquet.Int64, func(e Event) any { return int64(e.TotalTokens) }},
+	{"cost_usd", parquet.Double, func(e Event) any { return e.CostUSD }},
+	{"request_bytes", parquet.Int64, func(e Event) any { return e.RequestBytes }},
+	{"response_bytes", parquet.Int64, func(e Event) any { return e.ResponseBytes }},
+	{"client_ip", parquet.String, func(e Event) any { return e.ClientIP }},
+	{"user_agent", parquet.String, func(e Event) any { return e.UserAgent }},
+	{"request_id", parquet.String, func(e Event) any { return e.RequestID }},
+	{"upstream_endpoint", parquet.String, func(e Event) any { return e.UpstreamEndpoint }},
+}
+
+// Export streams the events matching q from store to w in format, one of
+// the export formats.
+func Export(store Store, q ExportQuery, format string, w io.Writer) error {
+	columns := make([]export.Column, len(exportColumns))
+	for i, c := range exportColumns {
+		columns[i] = export.Column{Name: c.name, Type: c.typ}
+	}
+	ew, err := export.NewWriter(format, w, columns)
+	if err != nil {
+		return err
+	}
+	row := make([]any, len(exportColumns))
+	err = store.Export(q, func(e Event) error {
+		for i, c := range exportColumns {
+			row[i] = c.value(e)
+		}
+		return ew.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// Export implements Store. Matching events are copied first so a slow reader
+// does not hold up Record.
+func (s *MemoryStore) Export(q ExportQuery, fn func(Event) error) error {
+	s.mu.RLock()
+	var events []Event
+	for _, e := range s.events {
+		if q.matches(e) {
+			events = append(events, e)
+		}
+	}
+	s.mu.RUnlock()
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+	for _, e := range events {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Export implements Store, reading events from a database cursor one row at
+// a time.
+func (s *SQLStore) Export(q ExportQuery, fn func(Event) error) error {
+	tx := s.db.Model(&Event{})
+	if !q.From.IsZero() {
+		tx = tx.Where("timestamp >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		tx = tx.Where("timestamp < ?", q.To)
+	}
+	if q.OrgID != "" {
+		tx = tx.Where("org_id = ?", q.OrgID)
+	}
+	if q.Service != "" {
+		tx = tx.Where("service = ?", q.Service)
+	}
+	rows, err := tx.Order("timestamp, id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e Event
+		if err := s.db.ScanRows(rows, &e); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,246 @@
+package usage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Partition intervals.
+const (
+	PartitionMonth = "month"
+	PartitionDay   = "day"
+)
+
+// Partition is one range partition of usage_events, holding the events
+// recorded in [From, To).
+type Partition struct {
+	Name     string
+	From, To time.Time
+}
+
+// Partitions manages the range partitions of usage_events on PostgreSQL. It
+// creates partitions ahead of time and drops expired ones, which retires old
+// events without the bloat of row deletes. On SQLite, or when usage_events
+// has not been partitioned by migration 018, it does nothing.
+type Partitions struct {
+	db *gorm.DB
+	// Interval is the range of new partitions: month or day.
+	Interval string
+	// Ahead is how many partitions are kept ready after the current one.
+	Ahead int
+}
+
+// NewPartitions returns a Partitions for db.
+func NewPartitions(db *gorm.DB, interval string, ahead int) *Partitions {
+	return &Partitions{db: db, Interval: interval, Ahead: ahead}
+}
+
+// Enabled reports whether usage_events is a partitioned table.
+func (p *Partitions) Enabled() (bool, error) {
+	if p.db.Dialector.Name() != "postgres" {
+		return false, nil
+	}
+	var n int64
+	err := p.db.Raw(`SELECT COUNT(*) FROM pg_partitioned_table pt
+		JOIN pg_class c ON c.oid = pt.partrelid
+		WHERE c.relname = ? AND c.relnamespace = to_regnamespace(current_schema())`, Event{}.TableName()).
+		Scan(&n).Error
+	return n > 0, err
+}
+
+// List returns the partitions of usage_events whose names Partitions
+// understands, oldest first.
+func (p *Partitions) List() ([]Partition, error) {
+	var names []string
+	err := p.db.Raw(`SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class parent ON parent.oid = i.inhparent
+		WHERE parent.relname = ? AND parent.relnamespace = to_regnamespace(current_schema())`, Event{}.TableName()).
+		Scan(&names).Error
+	if err != nil {
+		return nil, err
+	}
+	var out []Partition
+	for _, n := range names {
+		if part, ok := parsePartition(n); ok {
+			out = append(out, part)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].From.Before(out[j].From) })
+	return out, nil
+}
+
+// Ensure creates the partitions for now and the Ahead intervals after it
+// that are not covered yet. It returns the partitions created.
+func (p *Partitions) Ensure(now time.Time) ([]Partition, error) {
+	if ok, err := p.Enabled(); err != nil || !ok {
+		return nil, err
+	}
+	existing, err := p.List()
+	if err != nil {
+		return nil, err
+	}
+	hasDefault, err := p.hasDefault()
+	if err != nil {
+		return nil, err
+	}
+	missing := missingPartitions(existing, now, p.Interval, p.Ahead)
+	for i, part := range missing {
+		if err := p.create(part, hasDefault); err != nil {
+			return missing[:i], err
+		}
+	}
+	return missing, nil
+}
+
+// defaultPartition holds the events outside every range partition. Migration
+// 018 creates it so an event with a skewed clock, or one written before its
+// partition exists, is stored rather than rejected.
+var defaultPartition = Event{}.TableName() + "_default"
+
+// hasDefault reports whether usage_events has its default partition.
+func (p *Partitions) hasDefault() (bool, error) {
+	var ok bool
+	err := p.db.Raw(`SELECT to_regclass(?) IS NOT NULL`, defaultPartition).Scan(&ok).Error
+	return ok, err
+}
+
+// create adds part. Postgres refuses a new partition while the default
+// partition holds rows in its range, so with a default partition part is
+// built detached, those rows are moved into it and it is then attached, all
+// in one transaction.
+func (p *Partitions) create(part Partition, hasDefault bool) error {
+	from, to := part.From.Format(time.RFC3339), part.To.Format(time.RFC3339)
+	if !hasDefault {
+		return p.db.Exec(fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %q PARTITION OF %q FOR VALUES FROM ('%s') TO ('%s')`,
+			part.Name, Event{}.TableName(), from, to,
+		)).Error
+	}
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			fmt.Sprintf(`CREATE TABLE %q (LIKE %q INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`,
+				part.Name, Event{}.TableName()),
+			fmt.Sprintf(`WITH moved AS (DELETE FROM %q WHERE "timestamp" >= '%s' AND "timestamp" < '%s' RETURNING *)
+				INSERT INTO %q SELECT * FROM moved`, defaultPartition, from, to, part.Name),
+			fmt.Sprintf(`ALTER TABLE %q ATTACH PARTITION %q FOR VALUES FROM ('%s') TO ('%s')`,
+				Event{}.TableName(), part.Name, from, to),
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DropBefore drops every partition holding only events before cutoff and
+// returns the partitions dropped. Events before cutoff in the default
+// partition are deleted.
+func (p *Partitions) DropBefore(cutoff time.Time) ([]Partition, error) {
+	if ok, err := p.Enabled(); err != nil || !ok {
+		return nil, err
+	}
+	hasDefault, err := p.hasDefault()
+	if err != nil {
+		return nil, err
+	}
+	if hasDefault {
+		err := p.db.Exec(fmt.Sprintf(`DELETE FROM %q WHERE "timestamp" < ?`, defaultPartition), cutoff.UTC()).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	existing, err := p.List()
+	if err != nil {
+		return nil, err
+	}
+	var dropped []Partition
+	for _, part := range expiredPartitions(existing, cutoff) {
+		if err := p.db.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %q`, part.Name)).Error; err != nil {
+			return dropped, err
+		}
+		dropped = append(dropped, part)
+	}
+	return dropped, nil
+}
+
+// partitionFor returns the partition of the given interval containing t.
+func partitionFor(t time.Time, interval string) Partition {
+	t = t.UTC()
+	if interval == PartitionDay {
+		from := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return Partition{
+			Name: fmt.Sprintf("%s_y%04dm%02dd%02d", Event{}.TableName(), from.Year(), from.Month(), from.Day()),
+			From: from,
+			To:   from.AddDate(0, 0, 1),
+		}
+	}
+	from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return Partition{
+		Name: fmt.Sprintf("%s_y%04dm%02d", Event{}.TableName(), from.Year(), from.Month()),
+		From: from,
+		To:   from.AddDate(0, 1, 0),
+	}
+}
+
+// parsePartition recovers the range of a partition from its name.
+func parsePartition(name string) (Partition, bool) {
+	var y, m, d int
+	prefix := Event{}.TableName() + "_y"
+	if n, _ := fmt.Sscanf(name, prefix+"%4dm%2dd%2d", &y, &m, &d); n == 3 {
+		part := partitionFor(time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC), PartitionDay)
+		return part, part.Name == name
+	}
+	if n, _ := fmt.Sscanf(name, prefix+"%4dm%2d", &y, &m); n == 2 {
+		part := partitionFor(time.Date(y, time.Month(m), 1, 0, 0, 0, 0, time.UTC), PartitionMonth)
+		return part, part.Name == name
+	}
+	return Partition{}, false
+}
+
+// missingPartitions returns the partitions needed for now and the ahead
+// intervals after it that are not covered by existing partitions. A month
+// that is partly covered, e.g. after switching from daily partitions, gets
+// daily partitions for its uncovered days.
+func missingPartitions(existing []Partition, now time.Time, interval string, ahead int) []Partition {
+	var out []Partition
+	part := partitionFor(now, interval)
+	for i := 0; i <= ahead; i++ {
+		switch {
+		case !overlapsAny(existing, part):
+			out = append(out, part)
+		case interval == PartitionMonth:
+			for day := partitionFor(part.From, PartitionDay); day.From.Before(part.To); day = partitionFor(day.To, PartitionDay) {
+				if !overlapsAny(existing, day) {
+					out = append(out, day)
+				}
+			}
+		}
+		part = partitionFor(part.To, interval)
+	}
+	return out
+}
+
+func overlapsAny(existing []Partition, part Partition) bool {
+	for _, e := range existing {
+		if e.From.Before(part.To) && part.From.Before(e.To) {
+			return true
+		}
+	}
+	return false
+}
+
+// expiredPartitions returns the partitions ending at or before cutoff.
+func expiredPartitions(existing []Partition, cutoff time.Time) []Partition {
+	var out []Partition
+	for _, e := range existing {
+		if !e.To.After(cutoff) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package usage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPartitionNames(t *testing.T) {
+	at := time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC)
+	month := partitionFor(at, PartitionMonth)
+	if month.Name != "usage_events_y2025m12" || !month.To.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected month partition: %+v", month)
+	}
+	day := partitionFor(at, PartitionDay)
+	if day.Name != "usage_events_y2025m12d31" || !day.From.Equal(time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected day partition: %+v", day)
+	}
+	for _, want := range []Partition{month, day} {
+		got, ok := parsePartition(want.Name)
+		if !ok || got != want {
+			t.Fatalf("parsePartition(%q) = %+v, %v", want.Name, got, ok)
+		}
+	}
+	for _, name := range []string{"usage_events_default", "usage_events_y2025m1", "usage_events_y2025m13", "other_y2025m01"} {
+		if _, ok := parsePartition(name); ok {
+			t.Fatalf("parsePartition(%q): expected no match", name)
+		}
+	}
+}
+
+func TestMissingPartitions(t *testing.T) {
+	now := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+	existing := []Partition{
+		partitionFor(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), PartitionMonth),
+		partitionFor(now, PartitionMonth),
+	}
+	got := missingPartitions(existing, now, PartitionMonth, 2)
+	if len(got) != 2 || got[0].Name != "usage_events_y2025m04" || got[1].Name != "usage_events_y2025m05" {
+		t.Fatalf("unexpected missing partitions: %+v", got)
+	}
+
+	// After switching from daily partitions, the rest of a partly covered
+	// month is filled with days.
+	existing = []Partition{
+		partitionFor(time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC), PartitionDay),
+		partitionFor(time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC), PartitionDay),
+	}
+	got = missingPartitions(existing, now, PartitionMonth, 1)
+	if len(got) != 30 || got[0].Name != "usage_events_y2025m03d01" || got[13].Name != "usage_events_y2025m03d16" || got[29].Name != "usage_events_y2025m04" {
+		t.Fatalf("unexpected missing partitions: %d %+v", len(got), got)
+	}
+}
+
+func TestExpiredPartitions(t *testing.T) {
+	existing := []Partition{
+		partitionFor(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), PartitionMonth),
+		partitionFor(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), PartitionMonth),
+		partitionFor(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), PartitionMonth),
+	}
+	got := expiredPartitions(existing, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC))
+	if len(got) != 2 || got[1].Name != "usage_events_y2025m02" {
+		t.Fatalf("unexpected expired partitions: %+v", got)
+	}
+}
@@ -0,0 +1,142 @@
+package usage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/metrics"
+)
+
+// RecorderOptions tunes a Recorder. Zero values take the defaults below.
+type RecorderOptions struct {
+	// BufferSize is how many events may wait to be written. When the buffer
+	// is full the oldest event is dropped.
+	BufferSize int
+	// BatchSize is the most events written in one batch.
+	BatchSize int
+	// FlushInterval is the longest an event waits before its batch is
+	// written, however small.
+	FlushInterval time.Duration
+}
+
+// Recorder defaults.
+const (
+	DefaultBufferSize    = 1000
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+)
+
+// Recorder is a Store that buffers Record calls and writes them to the
+// underlying store in batches from a background worker, so a slow database
+// does not add latency to proxied requests. Reads go straight to the
+// underlying store and therefore lag by at most one flush interval.
+type Recorder struct {
+	Store
+
+	opts   RecorderOptions
+	events chan Event
+	done   chan struct{}
+
+	// mu guards closed so Record never sends on a closed channel.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewRecorder starts a Recorder writing to store.
+func NewRecorder(store Store, opts RecorderOptions) *Recorder {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	r := &Recorder{
+		Store:  store,
+		opts:   opts,
+		events: make(chan Event, opts.BufferSize),
+		done:   make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Record queues e without blocking. If the buffer is full the oldest queued
+// event is dropped to make room. Once the Recorder is closed events are
+// written synchronously.
+func (r *Recorder) Record(e Event) error {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return r.Store.Record(e)
+	}
+	for {
+		select {
+		case r.events <- e:
+			return nil
+		default:
+		}
+		select {
+		case <-r.events:
+			metrics.UsageEventsDroppedTotal.Inc()
+		default:
+		}
+	}
+}
+
+// Close stops accepting buffered events and waits until every queued event
+// has been written or ctx is done.
+func (r *Recorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.events)
+	}
+	r.mu.Unlock()
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, r.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := r.Store.RecordBatch(batch); err != nil {
+			metrics.UsageFlushErrorsTotal.Inc()
+			logging.Logger.Error().Err(err).Int("events", len(batch)).Msg("write usage events")
+		}
+		batch = make([]Event, 0, r.opts.BatchSize)
+	}
+	for {
+		select {
+		case e, ok := <-r.events:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= r.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package usage
+
+import (
+	"context"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/metrics"
+)
+
+// RetentionLockKey is the Postgres advisory lock key held while pruning, so
+// only one instance prunes at a time.
+const RetentionLockKey int64 = 0x6266_7573_6167_6501
+
+// DefaultPruneBatchSize is how many events Prune deletes per statement.
+const DefaultPruneBatchSize = 5000
+
+// Prune deletes every event recorded before cutoff in batches of batchSize,
+// stopping early if ctx is done. It returns the number of events deleted.
+func Prune(ctx context.Context, store Store, cutoff time.Time, batchSize int) (int64, error) {
+	n, err := pruneBatches(ctx, store.DeleteBefore, cutoff, batchSize)
+	metrics.UsagePrunedTotal.Add(float64(n))
+	return n, err
+}
+
+// pruneBatches calls del until it deletes less than a full batch.
+func pruneBatches(ctx context.Context, del func(time.Time, int) (int64, error), cutoff time.Time, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultPruneBatchSize
+	}
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n, err := del(cutoff, batchSize)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < int64(batchSize) {
+			return total, nil
+		}
+	}
+}
+
+// Retention periodically rolls up and prunes usage events. Raw events are
+// kept for Days and, when the store maintains rollups, rollups for
+// RollupDays, so summaries and budgets can reach further back than raw
+// events.
+type Retention struct {
+	Store Store
+	// Lock keeps instances from compacting and pruning concurrently.
+	Lock      database.Locker
+	Days      int
+	BatchSize int
+	Interval  time.Duration
+	// RollupDays is how long rollups are kept. Zero keeps them forever.
+	RollupDays int
+	// RollupDelay is how long after an hour ends it is rolled up, leaving
+	// time for buffered events of that hour to be written.
+	RollupDelay time.Duration
+	// Partitions, when set and usage_events is partitioned, retires
+	// expired events by dropping whole partitions instead of deleting rows.
+	Partitions *Partitions
+}
+
+// PruneBefore deletes events recorded before cutoff. If the store maintains
+// rollups, events are rolled up first and events not yet rolled up are
+// kept. If usage_events is partitioned only whole partitions are dropped, so
+// events are kept until their partition is entirely before cutoff and the
+// returned count is zero. The caller must hold Lock.
+func (r *Retention) PruneBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	if c, ok := r.Store.(Compactor); ok {
+		if err := c.Compact(ctx, time.Now().Add(-r.RollupDelay)); err != nil {
+			return 0, err
+		}
+		until, err := c.RolledUntil()
+		if err != nil {
+			return 0, err
+		}
+		if until.Before(cutoff) {
+			cutoff = until
+		}
+	}
+	if r.Partitions != nil {
+		ok, err := r.Partitions.Enabled()
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			dropped, err := r.Partitions.DropBefore(cutoff)
+			metrics.UsagePartitionsDroppedTotal.Add(float64(len(dropped)))
+			for _, part := range dropped {
+				logging.Logger.Info().Str("partition", part.Name).Msg("dropped usage partition")
+			}
+			return 0, err
+		}
+	}
+	return Prune(ctx, r.Store, cutoff, r.BatchSize)
+}
+
+// RunOnce compacts and prunes if no other instance is doing so. It reports
+// how many raw events were deleted and whether this instance held the lock.
+func (r *Retention) RunOnce(ctx context.Context) (deleted int64, ran bool, err error) {
+	release, ok, err := r.Lock.TryLock(ctx)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	defer release()
+
+	now := time.Now()
+	if r.Partitions != nil {
+		if _, err := r.Partitions.Ensure(now); err != nil {
+			return 0, true, err
+		}
+	}
+	deleted, err = r.PruneBefore(ctx, now.AddDate(0, 0, -r.Days))
+	if err != nil {
+		return deleted, true, err
+	}
+	if c, ok := r.Store.(Compactor); ok && r.RollupDays > 0 {
+		if _, err := pruneBatches(ctx, c.DeleteRollupsBefore, now.AddDate(0, 0, -r.RollupDays), r.BatchSize); err != nil {
+			return deleted, true, err
+		}
+	}
+	metrics.UsageRetentionLastSuccess.SetToCurrentTime()
+	return deleted, true, nil
+}
+
+// Run calls RunOnce immediately and then every Interval until ctx is done.
+func (r *Retention) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		deleted, ran, err := r.RunOnce(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			logging.Logger.Error().Err(err).Int64("deleted", deleted).Msg("prune usage events")
+		case ran && deleted > 0:
+			logging.Logger.Info().Int64("deleted", deleted).Int("retention_days", r.Days).Msg("pruned usage events")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
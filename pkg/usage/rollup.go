@@ -0,0 +1,410 @@
+package usage
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/farovictor/bifrost/pkg/metrics"
+)
+
+// Rollup granularities.
+const (
+	GranularityHour = "hour"
+	GranularityDay  = "day"
+)
+
+// Rollup pre-aggregates the events of one hour or day sharing a key, org,
+// service, source, model, status class and latency histogram bucket. Keeping
+// the histogram bucket in the rollup key lets percentiles be estimated from
+// rollups exactly as from raw events.
+type Rollup struct {
+	ID               uint      `gorm:"primaryKey;autoIncrement"`
+	Granularity      string    `gorm:"size:8;not null;index:idx_usage_rollups_bucket,priority:1"`
+	BucketStart      time.Time `gorm:"not null;index:idx_usage_rollups_bucket,priority:2"`
+	KeyID            string    `gorm:"size:255;not null;index"`
+	OrgID            string    `gorm:"size:255;not null;default:''"`
+	Service          string    `gorm:"size:255;not null;default:''"`
+	Source           string    `gorm:"size:16;not null;default:''"`
+	Model            string    `gorm:"size:255;not null;default:''"`
+	StatusClass      string    `gorm:"size:3;not null"`
+	LatencyBucket    int       `gorm:"not null"`
+	Requests         int64     `gorm:"not null"`
+	Errors           int64     `gorm:"not null"`
+	PromptTokens     int64     `gorm:"not null"`
+	CompletionTokens int64     `gorm:"not null"`
+	TotalTokens      int64     `gorm:"not null"`
+	CostUSD          float64   `gorm:"not null"`
+}
+
+func (Rollup) TableName() string { return "usage_rollups" }
+
+// RollupState records how far each granularity has been rolled up. Every
+// event before RolledUntil is covered by rollups of that granularity.
+type RollupState struct {
+	Granularity string    `gorm:"primaryKey;size:8"`
+	RolledUntil time.Time `gorm:"not null"`
+}
+
+func (RollupState) TableName() string { return "usage_rollup_state" }
+
+// Compactor is implemented by stores that maintain rollups. Compaction must
+// run on one instance at a time.
+type Compactor interface {
+	// Compact rolls up every complete hour and day before until.
+	Compact(ctx context.Context, until time.Time) error
+	// RolledUntil returns the end of the hourly rollups, or the zero time if
+	// nothing has been rolled up.
+	RolledUntil() (time.Time, error)
+	// DeleteRollupsBefore deletes up to limit rollups starting before cutoff.
+	DeleteRollupsBefore(cutoff time.Time, limit int) (int64, error)
+}
+
+// rollupColumns are the dimensions rollups are keyed by, besides time.
+const rollupColumns = "key_id, org_id, service, source, model"
+
+// watermarks returns the hourly and daily RolledUntil, zero when unset.
+func (s *SQLStore) watermarks() (hour, day time.Time, err error) {
+	var states []RollupState
+	if err := s.db.Find(&states).Error; err != nil {
+		return hour, day, err
+	}
+	for _, st := range states {
+		switch st.Granularity {
+		case GranularityHour:
+			hour = st.RolledUntil.UTC()
+		case GranularityDay:
+			day = st.RolledUntil.UTC()
+		}
+	}
+	return hour, day, nil
+}
+
+// RolledUntil implements Compactor.
+func (s *SQLStore) RolledUntil() (time.Time, error) {
+	hour, _, err := s.watermarks()
+	return hour, err
+}
+
+// Compact implements Compactor. Each hour and day is rolled up in its own
+// transaction together with its watermark, so an interrupted run resumes
+// where it stopped without counting anything twice.
+func (s *SQLStore) Compact(ctx context.Context, until time.Time) error {
+	until = until.UTC()
+	hour, day, err := s.watermarks()
+	if err != nil {
+		return err
+	}
+	if hour.IsZero() {
+		// Start at the oldest event, or now if there is none yet.
+		var oldest []Event
+		if err := s.db.Order("timestamp").Limit(1).Find(&oldest).Error; err != nil {
+			return err
+		}
+		hour = until
+		if len(oldest) > 0 && oldest[0].Timestamp.Before(until) {
+			hour = oldest[0].Timestamp.UTC()
+		}
+		hour = hour.Truncate(time.Hour)
+	}
+	if day.IsZero() {
+		day = bucketStart(hour, BucketDay)
+	}
+
+	for end := hour.Add(time.Hour); !end.After(until); end = end.Add(time.Hour) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.rollHour(hour); err != nil {
+			return err
+		}
+		hour = end
+	}
+	for end := day.AddDate(0, 0, 1); !end.After(hour); end = end.AddDate(0, 0, 1) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.rollDay(day); err != nil {
+			return err
+		}
+		day = end
+	}
+	if !hour.IsZero() {
+		metrics.UsageRollupWatermark.Set(float64(hour.Unix()))
+	}
+	return nil
+}
+
+// lockState locks the watermark row of granularity until the end of tx, so
+// events recorded meanwhile are either read by the rollup or folded into it
+// once it commits. It does nothing before the first rollup.
+func lockState(tx *gorm.DB, granularity string) error {
+	var states []RollupState
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("granularity = ?", granularity).Find(&states).Error
+}
+
+// rollHour aggregates the raw events of the hour starting at start.
+func (s *SQLStore) rollHour(start time.Time) error {
+	end := start.Add(time.Hour)
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockState(tx, GranularityHour); err != nil {
+			return err
+		}
+		var rollups []Rollup
+		err := tx.Model(&Event{}).
+			Select(rollupColumns+", "+
+				sqlStatusClass+" AS status_class, "+
+				sqlLatencyBucket()+" AS latency_bucket, "+
+				"COUNT(*) AS requests, "+
+				"CAST(SUM(CASE WHEN status_code >= 400 THEN 1 ELSE 0 END) AS BIGINT) AS errors, "+
+				"CAST(COALESCE(SUM(prompt_tokens), 0) AS BIGINT) AS prompt_tokens, "+
+				"CAST(COALESCE(SUM(completion_tokens), 0) AS BIGINT) AS completion_tokens, "+
+				"CAST(COALESCE(SUM(total_tokens), 0) AS BIGINT) AS total_tokens, "+
+				"COALESCE(SUM(cost_usd), 0) AS cost_usd").
+			Where("timestamp >= ? AND timestamp < ?", start, end).
+			Group(rollupColumns + ", " + sqlStatusClass + ", " + sqlLatencyBucket()).
+			Scan(&rollups).Error
+		if err != nil {
+			return err
+		}
+		return saveRollups(tx, rollups, GranularityHour, start, end)
+	})
+}
+
+// rollDay aggregates the hourly rollups of the day starting at start.
+func (s *SQLStore) rollDay(start time.Time) error {
+	end := start.AddDate(0, 0, 1)
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockState(tx, GranularityDay); err != nil {
+			return err
+		}
+		var rollups []Rollup
+		err := tx.Model(&Rollup{}).
+			Select(rollupColumns+", status_class, latency_bucket, "+
+				"CAST(SUM(requests) AS BIGINT) AS requests, "+
+				"CAST(SUM(errors) AS BIGINT) AS errors, "+
+				"CAST(SUM(prompt_tokens) AS BIGINT) AS prompt_tokens, "+
+				"CAST(SUM(completion_tokens) AS BIGINT) AS completion_tokens, "+
+				"CAST(SUM(total_tokens) AS BIGINT) AS total_tokens, "+
+				"SUM(cost_usd) AS cost_usd").
+			Where("granularity = ? AND bucket_start >= ? AND bucket_start < ?", GranularityHour, start, end).
+			Group(rollupColumns + ", status_class, latency_bucket").
+			Scan(&rollups).Error
+		if err != nil {
+			return err
+		}
+		return saveRollups(tx, rollups, GranularityDay, start, end)
+	})
+}
+
+// saveRollups stores rollups for the bucket starting at start and advances
+// the watermark of granularity to end.
+func saveRollups(tx *gorm.DB, rollups []Rollup, granularity string, start, end time.Time) error {
+	for i := range rollups {
+		rollups[i].ID = 0
+		rollups[i].Granularity = granularity
+		rollups[i].BucketStart = start
+	}
+	if len(rollups) > 0 {
+		if err := tx.CreateInBatches(rollups, sqlBatchSize).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&RollupState{Granularity: granularity, RolledUntil: end}).Error
+}
+
+// foldLate adds the events recorded after their hour, or day, was rolled up
+// to the rollups of that hour and day, so they are neither lost to summaries
+// nor counted twice. It holds the watermark rows shared until tx ends, which
+// keeps compaction from rolling up an hour while its events are written.
+func foldLate(tx *gorm.DB, events []Event) error {
+	var states []RollupState
+	if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Find(&states).Error; err != nil {
+		return err
+	}
+	marks := map[string]time.Time{}
+	for _, st := range states {
+		marks[st.Granularity] = st.RolledUntil.UTC()
+	}
+	type dims struct {
+		granularity string
+		start       time.Time
+		key, org    string
+		service     string
+		source      string
+		model       string
+		status      string
+		latency     int
+	}
+	late := map[dims]*Rollup{}
+	var order []dims
+	for _, e := range events {
+		for _, g := range []string{GranularityHour, GranularityDay} {
+			if mark := marks[g]; mark.IsZero() || !e.Timestamp.Before(mark) {
+				continue
+			}
+			start := e.Timestamp.UTC().Truncate(time.Hour)
+			if g == GranularityDay {
+				start = bucketStart(e.Timestamp, BucketDay)
+			}
+			d := dims{g, start, e.KeyID, e.OrgID, e.Service, e.Source, e.Model, statusClass(e.StatusCode), latencyBucket(e.LatencyMS)}
+			r, ok := late[d]
+			if !ok {
+				r = &Rollup{Granularity: g, BucketStart: start, KeyID: e.KeyID, OrgID: e.OrgID, Service: e.Service,
+					Source: e.Source, Model: e.Model, StatusClass: d.status, LatencyBucket: d.latency}
+				late[d] = r
+				order = append(order, d)
+			}
+			r.Requests++
+			if e.StatusCode >= 400 {
+				r.Errors++
+			}
+			r.PromptTokens += int64(e.PromptTokens)
+			r.CompletionTokens += int64(e.CompletionTokens)
+			r.TotalTokens += int64(e.TotalTokens)
+			r.CostUSD += e.CostUSD
+		}
+	}
+	for _, d := range order {
+		r := late[d]
+		var existing []Rollup
+		err := tx.Select("id").
+			Where("granularity = ? AND bucket_start = ? AND key_id = ? AND org_id = ? AND service = ? AND source = ? AND model = ? AND status_class = ? AND latency_bucket = ?",
+				r.Granularity, r.BucketStart, r.KeyID, r.OrgID, r.Service, r.Source, r.Model, r.StatusClass, r.LatencyBucket).
+			Limit(1).Find(&existing).Error
+		if err != nil {
+			return err
+		}
+		if len(existing) == 0 {
+			if err := tx.Create(r).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		err = tx.Model(&Rollup{}).Where("id = ?", existing[0].ID).Updates(map[string]any{
+			"requests":          gorm.Expr("requests + ?", r.Requests),
+			"errors":            gorm.Expr("errors + ?", r.Errors),
+			"prompt_tokens":     gorm.Expr("prompt_tokens + ?", r.PromptTokens),
+			"completion_tokens": gorm.Expr("completion_tokens + ?", r.CompletionTokens),
+			"total_tokens":      gorm.Expr("total_tokens + ?", r.TotalTokens),
+			"cost_usd":          gorm.Expr("cost_usd + ?", r.CostUSD),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteRollupsBefore implements Compactor.
+func (s *SQLStore) DeleteRollupsBefore(cutoff time.Time, limit int) (int64, error) {
+	oldest := s.db.Model(&Rollup{}).
+		Select("id").
+		Where("bucket_start < ?", cutoff.UTC()).
+		Order("id").
+		Limit(limit)
+	res := s.db.Where("id IN (?)", oldest).Delete(&Rollup{})
+	return res.RowsAffected, res.Error
+}
+
+// span is a half-open time range [from, to). A zero bound is unbounded.
+type span struct{ from, to time.Time }
+
+func (sp span) empty() bool {
+	return !sp.from.IsZero() && !sp.to.IsZero() && !sp.from.Before(sp.to)
+}
+
+// rollupPlan splits the range of q into the parts read from daily rollups,
+// hourly rollups and raw events, given the rollup watermarks. Only hours
+// wholly inside the range and before the hourly watermark come from
+// rollups; whole days among them come from daily rollups unless rows are
+// grouped by hour.
+func rollupPlan(q SummaryQuery, hourMark, dayMark time.Time) (days, hours, raw []span) {
+	if hourMark.IsZero() {
+		return nil, nil, []span{{q.From, q.To}}
+	}
+	// Rolled region [a, b), hour aligned.
+	a := ceilTo(q.From, time.Hour)
+	b := hourMark
+	if !q.To.IsZero() && q.To.Before(b) {
+		b = q.To.UTC().Truncate(time.Hour)
+	}
+	if !a.IsZero() && !a.Before(b) {
+		return nil, nil, []span{{q.From, q.To}}
+	}
+	if !q.From.IsZero() && q.From.Before(a) {
+		raw = append(raw, span{q.From, a})
+	}
+	raw = append(raw, span{b, q.To})
+
+	useDays := !dayMark.IsZero() && !(slices.Contains(q.GroupBy, GroupTime) && q.Bucket == BucketHour)
+	if !useDays {
+		return nil, []span{{a, b}}, raw
+	}
+	da := ceilTo(a, 24*time.Hour)
+	db := bucketStart(b, BucketDay)
+	if dayMark.Before(db) {
+		db = dayMark
+	}
+	if !da.IsZero() && !da.Before(db) {
+		return nil, []span{{a, b}}, raw
+	}
+	days = []span{{da, db}}
+	if !a.IsZero() && a.Before(da) {
+		hours = append(hours, span{a, da})
+	}
+	if db.Before(b) {
+		hours = append(hours, span{db, b})
+	}
+	return days, hours, raw
+}
+
+// ceilTo rounds t up to a multiple of d in UTC, keeping the zero time.
+func ceilTo(t time.Time, d time.Duration) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	t = t.UTC()
+	f := t.Truncate(d)
+	if f.Equal(t) {
+		return t
+	}
+	return f.Add(d)
+}
+
+// readRollups adds the rollups of granularity within sp to b.
+func (s *SQLStore) readRollups(b *summaryBuilder, q SummaryQuery, granularity string, sp span) error {
+	if sp.empty() {
+		return nil
+	}
+	cols := sqlGroupExprs(q, s.db.Dialector.Name(), true)
+	groups := strings.Join(append(cols, "latency_bucket"), ", ")
+	tx := s.db.Model(&Rollup{}).
+		Select(groups+", "+
+			"CAST(SUM(requests) AS BIGINT), "+
+			"CAST(SUM(errors) AS BIGINT), "+
+			"CAST(SUM(prompt_tokens) AS BIGINT), "+
+			"CAST(SUM(completion_tokens) AS BIGINT), "+
+			"CAST(SUM(total_tokens) AS BIGINT), "+
+			"SUM(cost_usd)").
+		Where("granularity = ?", granularity)
+	if !sp.from.IsZero() {
+		tx = tx.Where("bucket_start >= ?", sp.from)
+	}
+	if !sp.to.IsZero() {
+		tx = tx.Where("bucket_start < ?", sp.to)
+	}
+	tx = filterSummary(tx, q)
+	rows, err := tx.Group(groups).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return b.scan(rows)
+}
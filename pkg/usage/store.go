@@ -1,28 +1,61 @@
 package usage
 
 import (
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Store defines persistence behaviour for usage events.
 type Store interface {
 	Record(Event) error
+	// RecordBatch stores several events at once.
+	RecordBatch([]Event) error
 	List(keyID string, from, to time.Time, page, perPage int) ([]Event, int64, error)
-	TotalTokens(keyID string) int
+	// Totals sums the tokens and cost of every event ever recorded for a
+	// key, including events since pruned.
+	Totals(keyID string) (Totals, error)
+	// DeleteBefore deletes up to limit of the oldest events recorded before
+	// cutoff and returns how many were deleted.
+	DeleteBefore(cutoff time.Time, limit int) (int64, error)
+	// Summary aggregates the events matching q into one row per group.
+	Summary(q SummaryQuery) ([]SummaryRow, error)
+	// Export calls fn with each event matching q, oldest first, stopping at
+	// the first error.
+	Export(q ExportQuery, fn func(Event) error) error
 }
 
+// Totals is the lifetime usage of a key, as checked against its budgets.
+type Totals struct {
+	Tokens  int64
+	CostUSD float64
+}
+
+// KeyTotal is the running lifetime usage of a key. It is updated with every
+// recorded event and never pruned, so budgets do not reset as events and
+// rollups age out.
+type KeyTotal struct {
+	KeyID       string  `gorm:"primaryKey;size:255"`
+	TotalTokens int64   `gorm:"not null;default:0"`
+	CostUSD     float64 `gorm:"not null;default:0"`
+}
+
+func (KeyTotal) TableName() string { return "usage_key_totals" }
+
 // MemoryStore keeps events in memory — used in tests and in-memory mode.
 type MemoryStore struct {
 	mu     sync.RWMutex
 	events []Event
+	totals map[string]Totals
 	nextID uint
 }
 
 func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{}
+	return &MemoryStore{totals: make(map[string]Totals)}
 }
 
 func (s *MemoryStore) Record(e Event) error {
@@ -34,6 +67,17 @@ func (s *MemoryStore) Record(e Event) error {
 		e.Timestamp = time.Now()
 	}
 	s.events = append(s.events, e)
+	t := s.totals[e.KeyID]
+	t.Tokens += int64(e.TotalTokens)
+	t.CostUSD += e.CostUSD
+	s.totals[e.KeyID] = t
+	return nil
+}
+
+func (s *MemoryStore) RecordBatch(events []Event) error {
+	for _, e := range events {
+		s.Record(e) //nolint:errcheck
+	}
 	return nil
 }
 
@@ -73,33 +117,144 @@ func (s *MemoryStore) List(keyID string, from, to time.Time, page, perPage int)
 	return filtered[start:end], total, nil
 }
 
-func (s *MemoryStore) TotalTokens(keyID string) int {
+func (s *MemoryStore) Totals(keyID string) (Totals, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	total := 0
+	return s.totals[keyID], nil
+}
+
+func (s *MemoryStore) DeleteBefore(cutoff time.Time, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.events[:0]
+	var deleted int64
 	for _, e := range s.events {
-		if e.KeyID == keyID {
-			total += e.TotalTokens
+		if e.Timestamp.Before(cutoff) && deleted < int64(limit) {
+			deleted++
+			continue
 		}
+		kept = append(kept, e)
+	}
+	s.events = kept
+	return deleted, nil
+}
+
+func (s *MemoryStore) Summary(q SummaryQuery) ([]SummaryRow, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
 	}
-	return total
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return summarize(s.events, q), nil
 }
 
+// sqlBatchSize bounds the rows per INSERT, keeping statements under the
+// bind parameter limits of SQLite and Postgres.
+const sqlBatchSize = 500
+
 // SQLStore persists usage events in a SQL database.
 type SQLStore struct {
 	db *gorm.DB
 }
 
 func NewSQLStore(db *gorm.DB) *SQLStore {
-	db.AutoMigrate(&Event{})
+	Migrate(db)
 	return &SQLStore{db: db}
 }
 
+// Migrate creates or updates the usage tables. Once migration 018 has
+// partitioned usage_events it is left to the migrations and Partitions,
+// since AutoMigrate would try to recreate its indexes on the parent. When
+// usage_key_totals is created it is filled from the events and rollups
+// still kept.
+func Migrate(db *gorm.DB) error {
+	partitioned, err := NewPartitions(db, PartitionMonth, 0).Enabled()
+	if err != nil {
+		return err
+	}
+	models := []any{&Rollup{}, &RollupState{}, &KeyTotal{}}
+	if !partitioned {
+		models = append([]any{&Event{}}, models...)
+	}
+	backfill := !db.Migrator().HasTable(&KeyTotal{})
+	if err := db.AutoMigrate(models...); err != nil {
+		return err
+	}
+	if !backfill {
+		return nil
+	}
+	mark := db.Model(&RollupState{}).Select("rolled_until").Where("granularity = ?", GranularityHour)
+	rolled := db.Model(&Rollup{}).
+		Select("key_id, total_tokens, cost_usd").
+		Where("granularity = ? AND bucket_start < (?)", GranularityHour, mark)
+	tail := db.Model(&Event{}).
+		Select("key_id, total_tokens, cost_usd").
+		Where("timestamp >= COALESCE((?), ?)", mark, time.Time{})
+	return db.Exec("INSERT INTO usage_key_totals (key_id, total_tokens, cost_usd) "+
+		"SELECT key_id, CAST(COALESCE(SUM(total_tokens), 0) AS BIGINT), COALESCE(SUM(cost_usd), 0) "+
+		"FROM (? UNION ALL ?) AS totals GROUP BY key_id", rolled, tail).Error
+}
+
 func (s *SQLStore) Record(e Event) error {
-	if e.Timestamp.IsZero() {
-		e.Timestamp = time.Now()
+	return s.RecordBatch([]Event{e})
+}
+
+// RecordBatch inserts events with multi-row INSERT statements. In the same
+// transaction it adds them to the key totals and folds events older than
+// the rollup watermarks into the rollups already written for their hour
+// and day.
+func (s *SQLStore) RecordBatch(events []Event) error {
+	if len(events) == 0 {
+		return nil
 	}
-	return s.db.Create(&e).Error
+	now := time.Now()
+	for i := range events {
+		if events[i].Timestamp.IsZero() {
+			events[i].Timestamp = now
+		}
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(events, sqlBatchSize).Error; err != nil {
+			return err
+		}
+		if err := addTotals(tx, events); err != nil {
+			return err
+		}
+		return foldLate(tx, events)
+	})
+}
+
+// addTotals adds events to the totals of their keys, in key order so that
+// concurrent batches lock the rows in the same order.
+func addTotals(tx *gorm.DB, events []Event) error {
+	sums := map[string]*KeyTotal{}
+	for _, e := range events {
+		if e.TotalTokens == 0 && e.CostUSD == 0 {
+			continue
+		}
+		t, ok := sums[e.KeyID]
+		if !ok {
+			t = &KeyTotal{KeyID: e.KeyID}
+			sums[e.KeyID] = t
+		}
+		t.TotalTokens += int64(e.TotalTokens)
+		t.CostUSD += e.CostUSD
+	}
+	if len(sums) == 0 {
+		return nil
+	}
+	rows := make([]KeyTotal, 0, len(sums))
+	for _, t := range sums {
+		rows = append(rows, *t)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].KeyID < rows[j].KeyID })
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key_id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"total_tokens": gorm.Expr("usage_key_totals.total_tokens + excluded.total_tokens"),
+			"cost_usd":     gorm.Expr("usage_key_totals.cost_usd + excluded.cost_usd"),
+		}),
+	}).CreateInBatches(rows, sqlBatchSize).Error
 }
 
 func (s *SQLStore) List(keyID string, from, to time.Time, page, perPage int) ([]Event, int64, error) {
@@ -133,11 +288,106 @@ func (s *SQLStore) List(keyID string, from, to time.Time, page, perPage int) ([]
 	return events, total, nil
 }
 
-func (s *SQLStore) TotalTokens(keyID string) int {
-	var total int
-	s.db.Model(&Event{}).
-		Where("key_id = ?", keyID).
-		Select("COALESCE(SUM(total_tokens), 0)").
-		Scan(&total)
-	return total
+// Totals reads the key's running total, which pruning events, rollups or
+// partitions does not reduce.
+func (s *SQLStore) Totals(keyID string) (Totals, error) {
+	var rows []KeyTotal
+	if err := s.db.Where("key_id = ?", keyID).Limit(1).Find(&rows).Error; err != nil {
+		return Totals{}, err
+	}
+	if len(rows) == 0 {
+		return Totals{}, nil
+	}
+	return Totals{Tokens: rows[0].TotalTokens, CostUSD: rows[0].CostUSD}, nil
+}
+
+// DeleteBefore deletes the oldest events first, by primary key, so each call
+// touches a bounded number of rows and holds locks only briefly.
+func (s *SQLStore) DeleteBefore(cutoff time.Time, limit int) (int64, error) {
+	oldest := s.db.Model(&Event{}).
+		Select("id").
+		Where("timestamp < ?", cutoff).
+		Order("id").
+		Limit(limit)
+	res := s.db.Where("id IN (?)", oldest).Delete(&Event{})
+	return res.RowsAffected, res.Error
+}
+
+// Summary reads hours and days that have been rolled up from the rollup
+// tables and only the remaining edges and the recent tail from raw events.
+func (s *SQLStore) Summary(q SummaryQuery) ([]SummaryRow, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	hourMark, dayMark, err := s.watermarks()
+	if err != nil {
+		return nil, err
+	}
+	days, hours, raw := rollupPlan(q, hourMark, dayMark)
+	b := newSummaryBuilder(q.GroupBy)
+	for _, sp := range days {
+		if err := s.readRollups(b, q, GranularityDay, sp); err != nil {
+			return nil, err
+		}
+	}
+	for _, sp := range hours {
+		if err := s.readRollups(b, q, GranularityHour, sp); err != nil {
+			return nil, err
+		}
+	}
+	for _, sp := range raw {
+		if err := s.readEvents(b, q, sp); err != nil {
+			return nil, err
+		}
+	}
+	return b.rows(), nil
+}
+
+// readEvents adds the raw events within sp to b, grouping in the database
+// by the requested dimensions plus the latency histogram bucket. The end of
+// the query range is inclusive, like List, unless q.ToExclusive is set.
+func (s *SQLStore) readEvents(b *summaryBuilder, q SummaryQuery, sp span) error {
+	if sp.empty() {
+		return nil
+	}
+	cols := sqlGroupExprs(q, s.db.Dialector.Name(), false)
+	groups := strings.Join(append(cols, sqlLatencyBucket()), ", ")
+	tx := s.db.Model(&Event{}).
+		Select(groups + ", " +
+			"COUNT(*), " +
+			"CAST(SUM(CASE WHEN status_code >= 400 THEN 1 ELSE 0 END) AS BIGINT), " +
+			"CAST(COALESCE(SUM(prompt_tokens), 0) AS BIGINT), " +
+			"CAST(COALESCE(SUM(completion_tokens), 0) AS BIGINT), " +
+			"CAST(COALESCE(SUM(total_tokens), 0) AS BIGINT), " +
+			"COALESCE(SUM(cost_usd), 0)")
+	if !sp.from.IsZero() {
+		tx = tx.Where("timestamp >= ?", sp.from)
+	}
+	switch {
+	case sp.to.IsZero():
+	case sp.to.Equal(q.To) && !q.ToExclusive:
+		tx = tx.Where("timestamp <= ?", sp.to)
+	default:
+		tx = tx.Where("timestamp < ?", sp.to)
+	}
+	rows, err := filterSummary(tx, q).Group(groups).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return b.scan(rows)
+}
+
+// filterSummary applies the org, service and key filters of q to tx.
+func filterSummary(tx *gorm.DB, q SummaryQuery) *gorm.DB {
+	if q.OrgID != "" {
+		tx = tx.Where("org_id = ?", q.OrgID)
+	}
+	if q.Service != "" {
+		tx = tx.Where("service = ?", q.Service)
+	}
+	if q.KeyID != "" {
+		tx = tx.Where("key_id = ?", q.KeyID)
+	}
+	return tx
 }
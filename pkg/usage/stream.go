@@ -0,0 +1,238 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/farovictor/bifrost/pkg/logging"
+)
+
+// Publisher receives usage events as they are recorded.
+type Publisher interface {
+	Publish(Event)
+}
+
+// PublishingStore is a Store that publishes every event as it is recorded,
+// ahead of any buffering by the underlying store, so live subscribers see
+// events as they happen.
+type PublishingStore struct {
+	Store
+	Publisher Publisher
+}
+
+// Record implements Store.
+func (s *PublishingStore) Record(e Event) error {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	s.Publisher.Publish(e)
+	return s.Store.Record(e)
+}
+
+// RecordBatch implements Store.
+func (s *PublishingStore) RecordBatch(events []Event) error {
+	now := time.Now()
+	for i := range events {
+		if events[i].Timestamp.IsZero() {
+			events[i].Timestamp = now
+		}
+		s.Publisher.Publish(events[i])
+	}
+	return s.Store.RecordBatch(events)
+}
+
+// StreamFilter selects the events delivered to a subscription. Empty fields
+// match everything.
+type StreamFilter struct {
+	KeyID   string
+	OrgID   string
+	Service string
+	// Status is an exact status code such as 429, or a class such as 5xx.
+	Status string
+}
+
+// Matches reports whether e passes f.
+func (f StreamFilter) Matches(e Event) bool {
+	if (f.KeyID != "" && e.KeyID != f.KeyID) ||
+		(f.OrgID != "" && e.OrgID != f.OrgID) ||
+		(f.Service != "" && e.Service != f.Service) {
+		return false
+	}
+	switch {
+	case f.Status == "":
+		return true
+	case len(f.Status) == 3 && f.Status[1:] == "xx":
+		return strconv.Itoa(e.StatusCode/100) == f.Status[:1]
+	}
+	return strconv.Itoa(e.StatusCode) == f.Status
+}
+
+// ValidStatusFilter reports whether s is usable as StreamFilter.Status.
+func ValidStatusFilter(s string) bool {
+	if s == "" {
+		return true
+	}
+	if len(s) == 3 && s[1:] == "xx" {
+		return s[0] >= '1' && s[0] <= '5'
+	}
+	n, err := strconv.Atoi(s)
+	return err == nil && n >= 100 && n <= 599
+}
+
+// Subscription receives the events of a Broadcaster that match its filter.
+type Subscription struct {
+	// C delivers events. It is closed by Close.
+	C <-chan Event
+
+	c       chan Event
+	filter  StreamFilter
+	b       *Broadcaster
+	mu      sync.Mutex
+	dropped int64
+}
+
+// Dropped returns and resets the number of events not delivered since the
+// last call because the subscriber fell behind.
+func (s *Subscription) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.dropped
+	s.dropped = 0
+	return n
+}
+
+// Close unsubscribes and closes C.
+func (s *Subscription) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	if _, ok := s.b.subs[s]; ok {
+		delete(s.b.subs, s)
+		close(s.c)
+	}
+}
+
+// Broadcaster fans events out to in-process subscribers. Publishing never
+// blocks: a subscriber whose buffer is full misses the event.
+type Broadcaster struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// NewBroadcaster returns an empty Broadcaster.
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subs: map[*Subscription]struct{}{}}
+}
+
+// Subscribe returns a subscription to the events matching f, buffering up
+// to buffer events.
+func (b *Broadcaster) Subscribe(f StreamFilter, buffer int) *Subscription {
+	c := make(chan Event, buffer)
+	s := &Subscription{C: c, c: c, filter: f, b: b}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Publish implements Publisher.
+func (b *Broadcaster) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		if !s.filter.Matches(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			s.mu.Lock()
+			s.dropped++
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Subscribers returns the number of open subscriptions.
+func (b *Broadcaster) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+// StreamChannel is the Redis pub/sub channel usage events are relayed on.
+const StreamChannel = "bifrost:usage:events"
+
+// relayMessage is an event on StreamChannel, tagged with the instance that
+// recorded it.
+type relayMessage struct {
+	Origin string `json:"origin"`
+	Event  Event  `json:"event"`
+}
+
+// RedisRelay shares events between instances over Redis pub/sub. Events
+// recorded locally go to the local Broadcaster at once and are published to
+// Redis in the background; events published by other instances are
+// delivered to the local Broadcaster by Run.
+type RedisRelay struct {
+	client  redis.UniversalClient
+	local   *Broadcaster
+	origin  string
+	pending chan Event
+}
+
+// NewRedisRelay returns a relay between local and client. Start it with Run.
+func NewRedisRelay(client redis.UniversalClient, local *Broadcaster) *RedisRelay {
+	return &RedisRelay{
+		client:  client,
+		local:   local,
+		origin:  uuid.NewString(),
+		pending: make(chan Event, DefaultBufferSize),
+	}
+}
+
+// Publish implements Publisher. It never blocks; events are not relayed
+// while the background publisher is behind.
+func (r *RedisRelay) Publish(e Event) {
+	r.local.Publish(e)
+	select {
+	case r.pending <- e:
+	default:
+	}
+}
+
+// Run publishes local events to Redis and delivers remote ones until ctx is
+// done.
+func (r *RedisRelay) Run(ctx context.Context) {
+	sub := r.client.Subscribe(ctx, StreamChannel)
+	defer sub.Close()
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-r.pending:
+			payload, err := json.Marshal(relayMessage{Origin: r.origin, Event: e})
+			if err != nil {
+				continue
+			}
+			if err := r.client.Publish(ctx, StreamChannel, payload).Err(); err != nil && ctx.Err() == nil {
+				logging.Logger.Warn().Err(err).Msg("relay usage event")
+			}
+		case m, ok := <-messages:
+			if !ok {
+				return
+			}
+			var msg relayMessage
+			if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil || msg.Origin == r.origin {
+				continue
+			}
+			r.local.Publish(msg.Event)
+		}
+	}
+}
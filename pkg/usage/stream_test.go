@@ -0,0 +1,52 @@
+package usage
+
+import "testing"
+
+func TestStreamFilterStatus(t *testing.T) {
+	for _, tc := range []struct {
+		status string
+		code   int
+		want   bool
+	}{
+		{"", 200, true},
+		{"429", 429, true},
+		{"429", 430, false},
+		{"5xx", 502, true},
+		{"5xx", 499, false},
+		{"4xx", 404, true},
+	} {
+		if got := (StreamFilter{Status: tc.status}).Matches(Event{StatusCode: tc.code}); got != tc.want {
+			t.Errorf("status %q code %d: got %v", tc.status, tc.code, got)
+		}
+	}
+	for s, want := range map[string]bool{"": true, "200": true, "5xx": true, "6xx": false, "xx": false, "99": false, "abc": false} {
+		if got := ValidStatusFilter(s); got != want {
+			t.Errorf("ValidStatusFilter(%q) = %v", s, got)
+		}
+	}
+}
+
+func TestBroadcasterDropsForSlowSubscribers(t *testing.T) {
+	b := NewBroadcaster()
+	sub := b.Subscribe(StreamFilter{}, 1)
+	for i := 0; i < 3; i++ {
+		b.Publish(Event{StatusCode: 200})
+	}
+	if n := sub.Dropped(); n != 2 {
+		t.Fatalf("expected 2 dropped, got %d", n)
+	}
+	if n := sub.Dropped(); n != 0 {
+		t.Fatalf("expected dropped count to reset, got %d", n)
+	}
+	sub.Close()
+	sub.Close()
+	if b.Subscribers() != 0 {
+		t.Fatal("subscription not removed")
+	}
+	if _, ok := <-sub.C; !ok {
+		t.Fatal("expected buffered event before close")
+	}
+	if _, ok := <-sub.C; ok {
+		t.Fatal("expected closed channel")
+	}
+}
@@ -0,0 +1,350 @@
+package usage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Dimensions usage can be grouped by.
+const (
+	GroupOrg         = "org"
+	GroupService     = "service"
+	GroupKey         = "key"
+	GroupSource      = "source"
+	GroupModel       = "model"
+	GroupStatusClass = "status_class"
+	GroupTime        = "time"
+)
+
+// Time bucket sizes for GroupTime.
+const (
+	BucketHour  = "hour"
+	BucketDay   = "day"
+	BucketMonth = "month"
+)
+
+// ErrInvalidGroup is returned for an unknown grouping dimension or bucket.
+var ErrInvalidGroup = errors.New("invalid group")
+
+// SummaryQuery selects and groups the events summarised by Store.Summary.
+// Empty filters match every event.
+type SummaryQuery struct {
+	From, To time.Time
+	OrgID    string
+	Service  string
+	KeyID    string
+	// ToExclusive leaves events at To out, so adjacent ranges such as
+	// billing periods don't overlap.
+	ToExclusive bool
+	// GroupBy lists the dimensions rows are grouped by, in order.
+	GroupBy []string
+	// Bucket is the size of GroupTime buckets: hour, day or month.
+	Bucket string
+}
+
+// Validate checks the dimensions and bucket of q.
+func (q SummaryQuery) Validate() error {
+	for _, g := range q.GroupBy {
+		switch g {
+		case GroupOrg, GroupService, GroupKey, GroupSource, GroupModel, GroupStatusClass:
+		case GroupTime:
+			switch q.Bucket {
+			case BucketHour, BucketDay, BucketMonth:
+			default:
+				return fmt.Errorf("%w: bucket must be hour, day or month", ErrInvalidGroup)
+			}
+		default:
+			return fmt.Errorf("%w: %q", ErrInvalidGroup, g)
+		}
+	}
+	return nil
+}
+
+// SummaryRow aggregates the events sharing one combination of grouping values.
+type SummaryRow struct {
+	// Group maps each grouping dimension to its value. Time buckets are
+	// given as the RFC 3339 UTC start of the bucket.
+	Group    map[string]string `json:"group"`
+	Requests int64             `json:"requests" example:"120"`
+	// Errors counts responses with status 400 or above.
+	Errors    int64   `json:"errors" example:"3"`
+	ErrorRate float64 `json:"error_rate" example:"0.025"`
+	// Latency percentiles are estimated from a fixed histogram, so they are
+	// accurate to within one histogram bucket.
+	LatencyP50MS     float64 `json:"latency_p50_ms" example:"180"`
+	LatencyP90MS     float64 `json:"latency_p90_ms" example:"420"`
+	LatencyP99MS     float64 `json:"latency_p99_ms" example:"950"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// latencyBounds are the upper bounds, in milliseconds, of the latency
+// histogram percentiles are estimated from. A final bucket holds everything
+// slower.
+var latencyBounds = [...]int64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000}
+
+// latencyBucket returns the histogram bucket of a latency.
+func latencyBucket(ms int64) int {
+	return sort.Search(len(latencyBounds), func(i int) bool { return ms <= latencyBounds[i] })
+}
+
+// summary accumulates one SummaryRow.
+type summary struct {
+	row     SummaryRow
+	latency [len(latencyBounds) + 1]int64
+}
+
+func (s *summary) add(e Event) {
+	s.row.Requests++
+	if e.StatusCode >= 400 {
+		s.row.Errors++
+	}
+	s.latency[latencyBucket(e.LatencyMS)]++
+	s.row.PromptTokens += int64(e.PromptTokens)
+	s.row.CompletionTokens += int64(e.CompletionTokens)
+	s.row.TotalTokens += int64(e.TotalTokens)
+	s.row.CostUSD += e.CostUSD
+}
+
+// finish derives the rates and percentiles of the row.
+func (s *summary) finish() SummaryRow {
+	r := s.row
+	if r.Requests > 0 {
+		r.ErrorRate = float64(r.Errors) / float64(r.Requests)
+	}
+	r.LatencyP50MS = percentile(s.latency[:], r.Requests, 0.5)
+	r.LatencyP90MS = percentile(s.latency[:], r.Requests, 0.9)
+	r.LatencyP99MS = percentile(s.latency[:], r.Requests, 0.99)
+	r.CostUSD = math.Round(r.CostUSD*1e6) / 1e6
+	return r
+}
+
+// percentile estimates the q quantile of a latency histogram by linear
+// interpolation within the bucket it falls in.
+func percentile(hist []int64, total int64, q float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var seen int64
+	for i, n := range hist {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		if i == len(latencyBounds) {
+			return float64(latencyBounds[i-1])
+		}
+		var lower float64
+		if i > 0 {
+			lower = float64(latencyBounds[i-1])
+		}
+		upper := float64(latencyBounds[i])
+		return lower + (upper-lower)*(rank-float64(seen))/float64(n)
+	}
+	return float64(latencyBounds[len(latencyBounds)-1])
+}
+
+// statusClass returns the class of a status code, e.g. "2xx".
+func statusClass(code int) string {
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+// bucketStart truncates t to the start of its UTC time bucket.
+func bucketStart(t time.Time, bucket string) time.Time {
+	t = t.UTC()
+	switch bucket {
+	case BucketMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case BucketDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	default:
+		return t.Truncate(time.Hour)
+	}
+}
+
+// groupValue returns the value of dimension g for e.
+func groupValue(e Event, g, bucket string) string {
+	switch g {
+	case GroupOrg:
+		return e.OrgID
+	case GroupService:
+		return e.Service
+	case GroupKey:
+		return e.KeyID
+	case GroupSource:
+		return e.Source
+	case GroupModel:
+		return e.Model
+	case GroupStatusClass:
+		return statusClass(e.StatusCode)
+	case GroupTime:
+		return bucketStart(e.Timestamp, bucket).Format(time.RFC3339)
+	}
+	return ""
+}
+
+// matches reports whether e passes the filters of q.
+func (q SummaryQuery) matches(e Event) bool {
+	return (q.From.IsZero() || !e.Timestamp.Before(q.From)) &&
+		(q.To.IsZero() || e.Timestamp.Before(q.To) || (!q.ToExclusive && e.Timestamp.Equal(q.To))) &&
+		(q.OrgID == "" || e.OrgID == q.OrgID) &&
+		(q.Service == "" || e.Service == q.Service) &&
+		(q.KeyID == "" || e.KeyID == q.KeyID)
+}
+
+// summaryBuilder merges partial aggregates into one summary per group.
+type summaryBuilder struct {
+	groupBy []string
+	sums    map[string]*summary
+	order   []string
+}
+
+func newSummaryBuilder(groupBy []string) *summaryBuilder {
+	return &summaryBuilder{groupBy: groupBy, sums: make(map[string]*summary)}
+}
+
+// group returns the summary of the group with the given values.
+func (b *summaryBuilder) group(vals []string) *summary {
+	k := strings.Join(vals, "\x00")
+	s, ok := b.sums[k]
+	if !ok {
+		s = &summary{row: SummaryRow{Group: make(map[string]string, len(vals))}}
+		for i, g := range b.groupBy {
+			s.row.Group[g] = vals[i]
+		}
+		b.sums[k] = s
+		b.order = append(b.order, k)
+	}
+	return s
+}
+
+// scan adds SQL rows holding the grouping values, a latency histogram
+// bucket, then the request, error, token and cost sums of that bucket.
+func (b *summaryBuilder) scan(rows *sql.Rows) error {
+	for rows.Next() {
+		vals := make([]sql.NullString, len(b.groupBy))
+		var bucket int
+		var part SummaryRow
+		dest := make([]any, 0, len(vals)+7)
+		for i := range vals {
+			dest = append(dest, &vals[i])
+		}
+		dest = append(dest, &bucket, &part.Requests, &part.Errors,
+			&part.PromptTokens, &part.CompletionTokens, &part.TotalTokens, &part.CostUSD)
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		strs := make([]string, len(vals))
+		for i, v := range vals {
+			strs[i] = v.String
+		}
+		s := b.group(strs)
+		s.row.Requests += part.Requests
+		s.row.Errors += part.Errors
+		s.row.PromptTokens += part.PromptTokens
+		s.row.CompletionTokens += part.CompletionTokens
+		s.row.TotalTokens += part.TotalTokens
+		s.row.CostUSD += part.CostUSD
+		s.latency[bucket] += part.Requests
+	}
+	return rows.Err()
+}
+
+// rows returns the finished summaries ordered by their grouping values, in
+// GroupBy order.
+func (b *summaryBuilder) rows() []SummaryRow {
+	out := make([]SummaryRow, 0, len(b.order))
+	for _, k := range b.order {
+		out = append(out, b.sums[k].finish())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		for _, g := range b.groupBy {
+			if x, y := out[i].Group[g], out[j].Group[g]; x != y {
+				return x < y
+			}
+		}
+		return false
+	})
+	return out
+}
+
+// summarize groups events as described by q.
+func summarize(events []Event, q SummaryQuery) []SummaryRow {
+	b := newSummaryBuilder(q.GroupBy)
+	for _, e := range events {
+		if !q.matches(e) {
+			continue
+		}
+		vals := make([]string, len(q.GroupBy))
+		for i, g := range q.GroupBy {
+			vals[i] = groupValue(e, g, q.Bucket)
+		}
+		b.group(vals).add(e)
+	}
+	return b.rows()
+}
+
+// sqlStatusClass is a SQL expression for the statusClass of an event.
+const sqlStatusClass = "CAST(status_code / 100 AS TEXT) || 'xx'"
+
+// sqlGroupExprs returns the SQL expressions of the grouping dimensions of q,
+// over usage_rollups when rollup is set and usage_events otherwise.
+func sqlGroupExprs(q SummaryQuery, dialect string, rollup bool) []string {
+	statusExpr, timeCol := sqlStatusClass, "timestamp"
+	if rollup {
+		statusExpr, timeCol = "status_class", "bucket_start"
+	}
+	exprs := make([]string, 0, len(q.GroupBy))
+	for _, g := range q.GroupBy {
+		switch g {
+		case GroupOrg:
+			exprs = append(exprs, "org_id")
+		case GroupService:
+			exprs = append(exprs, "service")
+		case GroupKey:
+			exprs = append(exprs, "key_id")
+		case GroupSource:
+			exprs = append(exprs, "source")
+		case GroupModel:
+			exprs = append(exprs, "model")
+		case GroupStatusClass:
+			exprs = append(exprs, statusExpr)
+		case GroupTime:
+			exprs = append(exprs, sqlTimeBucket(timeCol, q.Bucket, dialect))
+		}
+	}
+	return exprs
+}
+
+// sqlTimeBucket is a SQL expression for the RFC 3339 UTC start of the time
+// bucket of col.
+func sqlTimeBucket(col, bucket, dialect string) string {
+	if dialect == "postgres" {
+		return fmt.Sprintf(`to_char(date_trunc('%s', "%s" AT TIME ZONE 'UTC'), 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`, bucket, col)
+	}
+	layout := map[string]string{
+		BucketHour:  "%Y-%m-%dT%H:00:00Z",
+		BucketDay:   "%Y-%m-%dT00:00:00Z",
+		BucketMonth: "%Y-%m-01T00:00:00Z",
+	}[bucket]
+	return fmt.Sprintf("strftime('%s', %s)", layout, col)
+}
+
+// sqlLatencyBucket is a SQL expression for the latencyBucket of an event.
+func sqlLatencyBucket() string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	for i, bound := range latencyBounds {
+		fmt.Fprintf(&b, " WHEN latency_ms <= %d THEN %d", bound, i)
+	}
+	fmt.Fprintf(&b, " ELSE %d END", len(latencyBounds))
+	return b.String()
+}
@@ -1,6 +1,7 @@
 package users
 
 import (
+	"context"
 	"errors"
 	"sync"
 
@@ -8,11 +9,13 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/events"
 )
 
-// Store defines the persistence behavior for User objects.
+// Store defines the persistence behavior for User objects. Create publishes
+// the given events once the user is stored.
 type Store interface {
-	Create(User) error
+	Create(u User, es ...events.Event) error
 	Get(id string) (User, error)
 	GetByAPIKey(key string) (User, error)
 	GetByEmail(email string) (User, error)
@@ -27,6 +30,7 @@ type MemoryStore struct {
 	users   map[string]User
 	byKey   map[string]User
 	byEmail map[string]User
+	bus     *events.Bus
 }
 
 // NewMemoryStore creates an initialized MemoryStore.
@@ -42,11 +46,20 @@ func NewSQLStore(db *gorm.DB) *SQLStore {
 
 // SQLStore persists users in a SQL database.
 type SQLStore struct {
-	db *gorm.DB
+	db  *gorm.DB
+	bus *events.Bus
 }
 
+// SetBus makes the store publish events on b.
+func (s *MemoryStore) SetBus(b *events.Bus) { s.bus = b }
+
+// SetBus makes the store publish events on b, in the transaction making the
+// change.
+func (s *SQLStore) SetBus(b *events.Bus) { s.bus = b }
+
 // Create inserts a new User. Returns error if ID already exists.
-func (s *MemoryStore) Create(u User) error {
+func (s *MemoryStore) Create(u User, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if u.ID == "" {
@@ -135,17 +148,19 @@ func (s *MemoryStore) Update(u User) error {
 }
 
 // Create inserts a new user into the database.
-func (s *SQLStore) Create(u User) error {
-	if u.ID == "" {
-		u.ID = utils.GenerateID()
-	}
-	if err := s.db.Create(&u).Error; err != nil {
-		if database.IsDuplicateError(err) {
-			return ErrUserExists
+func (s *SQLStore) Create(u User, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		if u.ID == "" {
+			u.ID = utils.GenerateID()
 		}
-		return err
-	}
-	return nil
+		if err := tx.Create(&u).Error; err != nil {
+			if database.IsDuplicateError(err) {
+				return ErrUserExists
+			}
+			return err
+		}
+		return nil
+	}, es...)
 }
 
 // Get retrieves a user by ID.
@@ -1,9 +1,25 @@
 // Package utils provides helper functions used across the project.
 package utils
 
-import "github.com/google/uuid"
+import (
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
 
 // GenerateID returns a new UUIDv4 string.
 func GenerateID() string {
 	return uuid.NewString()
 }
+
+// Truncate shortens s to at most n bytes, cutting before a partial UTF-8
+// sequence so the result stays valid text for the database.
+func Truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,376 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/farovictor/bifrost/pkg/events"
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/metrics"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+	"github.com/farovictor/bifrost/pkg/usage"
+	"github.com/farovictor/bifrost/pkg/utils"
+)
+
+// DispatcherOptions tunes a Dispatcher. Zero fields take the defaults.
+type DispatcherOptions struct {
+	// Client sends deliveries. Defaults to a client with a 10s timeout.
+	Client *http.Client
+	// MaxAttempts is how many times a delivery is tried before it fails.
+	// Defaults to 4: the first attempt and 3 retries.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubling for each retry
+	// after it. Defaults to 10s.
+	Backoff time.Duration
+	// PollInterval is how often due deliveries are looked for. Deliveries
+	// queued by this instance are sent at once. Defaults to 5s.
+	PollInterval time.Duration
+	// Lease is how long a claimed delivery is kept from other instances
+	// while it is attempted. Defaults to 1m.
+	Lease time.Duration
+	// Retention is how long deliveries are kept. Defaults to 30 days.
+	Retention time.Duration
+}
+
+func (o *DispatcherOptions) defaults() {
+	if o.Client == nil {
+		o.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 4
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 10 * time.Second
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = 5 * time.Second
+	}
+	if o.Lease <= 0 {
+		o.Lease = time.Minute
+	}
+	if o.Retention <= 0 {
+		o.Retention = 30 * 24 * time.Hour
+	}
+}
+
+// claimBatch is how many due deliveries are claimed at a time.
+const claimBatch = 100
+
+// Dispatcher queues events for the webhooks subscribed to them and delivers
+// them with signed, retried requests. Deliveries are persisted in the store,
+// so any instance sharing it can send them.
+type Dispatcher struct {
+	store Store
+	opts  DispatcherOptions
+	wake  chan struct{}
+
+	mu sync.Mutex
+	// fired remembers events raised from usage until they can no longer
+	// repeat, sparing the store a lookup for every refused request.
+	fired map[string]time.Time
+}
+
+// NewDispatcher returns a Dispatcher using store.
+func NewDispatcher(store Store, opts DispatcherOptions) *Dispatcher {
+	opts.defaults()
+	return &Dispatcher{store: store, opts: opts, wake: make(chan struct{}, 1), fired: make(map[string]time.Time)}
+}
+
+// Publish queues e for every active webhook of its org subscribed to its
+// type. Events without an ID are given one, and events without a timestamp
+// are stamped now.
+func (d *Dispatcher) Publish(e Event) error {
+	if e.OrgID == "" {
+		return nil
+	}
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+	hooks, err := d.store.ListWebhooks(e.OrgID)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	queued := false
+	for _, w := range hooks {
+		if !w.Subscribed(e.Type) {
+			continue
+		}
+		// The ID is derived from the event and webhook, so an event
+		// published by several instances is delivered once.
+		sum := sha256.Sum256([]byte(e.ID + "\x00" + w.ID))
+		now := time.Now()
+		err := d.store.CreateDelivery(Delivery{
+			ID:            hex.EncodeToString(sum[:16]),
+			WebhookID:     w.ID,
+			OrgID:         e.OrgID,
+			EventID:       e.ID,
+			Event:         e.Type,
+			Payload:       string(payload),
+			Status:        StatusPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+		switch {
+		case errors.Is(err, ErrDeliveryExists):
+		case err != nil:
+			return err
+		default:
+			queued = true
+		}
+	}
+	if queued {
+		d.notify()
+	}
+	return nil
+}
+
+// Subscribe queues webhook events for the key events published on b, from
+// b's outbox when it has one. Bus events keep their ID, so one delivered more
+// than once is queued once.
+func (d *Dispatcher) Subscribe(b *events.Bus) {
+	b.SubscribeAsync(events.Typed(func(_ context.Context, m events.Message, e events.KeyCreated) error {
+		return d.Publish(Event{ID: m.ID, Type: EventKeyCreated, OrgID: e.OrgID, KeyID: e.KeyID, Timestamp: m.OccurredAt,
+			Data: map[string]any{"target": e.Target, "scope": e.Scope, "expires_at": e.ExpiresAt}})
+	}), events.NameKeyCreated)
+	b.SubscribeAsync(events.Typed(func(_ context.Context, m events.Message, e events.KeyRevoked) error {
+		return d.Publish(Event{ID: m.ID, Type: EventKeyRevoked, OrgID: e.OrgID, KeyID: e.KeyID, Timestamp: m.OccurredAt})
+	}), events.NameKeyRevoked)
+	b.SubscribeAsync(events.Typed(func(_ context.Context, m events.Message, e events.KeyExpired) error {
+		return d.Publish(Event{ID: m.ID, Type: EventKeyExpired, OrgID: e.OrgID, KeyID: e.KeyID, Timestamp: m.OccurredAt,
+			Data: map[string]any{"expires_at": e.ExpiresAt}})
+	}), events.NameKeyExpired)
+	b.SubscribeAsync(events.Typed(func(_ context.Context, m events.Message, e events.KeyUsed) error {
+		return d.Publish(Event{ID: m.ID, Type: EventKeyUsed, OrgID: e.OrgID, KeyID: e.KeyID, Timestamp: m.OccurredAt,
+			Data: map[string]any{"service": e.Service}})
+	}), events.NameKeyUsed)
+}
+
+// Redeliver queues the event of delivery id for another round of attempts,
+// recorded as a new delivery, and publishes es once it is queued.
+func (d *Dispatcher) Redeliver(id string, es ...events.Event) (Delivery, error) {
+	orig, err := d.store.GetDelivery(id)
+	if err != nil {
+		return Delivery{}, err
+	}
+	now := time.Now()
+	red := Delivery{
+		ID:            uuid.NewString(),
+		WebhookID:     orig.WebhookID,
+		OrgID:         orig.OrgID,
+		EventID:       orig.EventID,
+		Event:         orig.Event,
+		Payload:       orig.Payload,
+		Status:        StatusPending,
+		RedeliveryOf:  orig.ID,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	if err := d.store.CreateDelivery(red, es...); err != nil {
+		return Delivery{}, err
+	}
+	d.notify()
+	return red, nil
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Observe publishes the event a usage event reveals, if any: refusals by
+// rate limits, quotas and token budgets. Each is raised once per key and
+// period, even by several instances seeing the same events.
+func (d *Dispatcher) Observe(e usage.Event) {
+	if e.KeyID == "" || e.OrgID == "" {
+		return
+	}
+	var (
+		typ    string
+		period time.Duration
+	)
+	switch e.Category {
+	case ratelimit.ReasonRateLimited, ratelimit.ReasonQuotaExceeded:
+		typ, period = EventKeyRateLimited, time.Minute
+	case ratelimit.ReasonBudgetExceeded:
+		typ, period = EventKeyBudgetExceeded, time.Hour
+	default:
+		return
+	}
+	ts := e.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	window := ts.Truncate(period).Unix()
+	sum := sha256.Sum256([]byte(typ + "\x00" + e.KeyID + "\x00" + strconv.FormatInt(window, 10)))
+	id := hex.EncodeToString(sum[:16])
+
+	d.mu.Lock()
+	_, seen := d.fired[id]
+	if !seen {
+		d.fired[id] = ts.Truncate(period).Add(period)
+	}
+	d.mu.Unlock()
+	if seen {
+		return
+	}
+
+	data := map[string]any{"service": e.Service, "status_code": e.StatusCode, "reason": e.Category}
+	if err := d.Publish(Event{ID: id, Type: typ, OrgID: e.OrgID, KeyID: e.KeyID, Timestamp: ts.UTC(), Data: data}); err != nil {
+		logging.Logger.Error().Err(err).Str("key_id", e.KeyID).Str("event", typ).Msg("queue webhook event")
+	}
+}
+
+// Watch observes usage events until ctx is done or events is closed.
+func (d *Dispatcher) Watch(ctx context.Context, events <-chan usage.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			d.Observe(e)
+		}
+	}
+}
+
+// Run delivers due deliveries until ctx is done: at once when this instance
+// queues one, and every PollInterval for those queued elsewhere or due for
+// a retry. Deliveries older than Retention are deleted hourly.
+func (d *Dispatcher) Run(ctx context.Context) {
+	poll := time.NewTicker(d.opts.PollInterval)
+	defer poll.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+	for {
+		if _, err := d.DeliverDue(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			logging.Logger.Error().Err(err).Msg("deliver webhooks")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-poll.C:
+		case now := <-prune.C:
+			d.prune(now)
+		}
+	}
+}
+
+// DeliverDue attempts every delivery due at now and returns how many were
+// attempted.
+func (d *Dispatcher) DeliverDue(ctx context.Context, now time.Time) (int, error) {
+	total := 0
+	for {
+		due, err := d.store.ClaimDue(now, now.Add(d.opts.Lease), claimBatch)
+		if err != nil {
+			return total, err
+		}
+		for _, del := range due {
+			d.attempt(ctx, del, now)
+		}
+		total += len(due)
+		if len(due) < claimBatch || ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+	}
+}
+
+// attempt sends del once and records the outcome, scheduling a retry
+// relative to now.
+func (d *Dispatcher) attempt(ctx context.Context, del Delivery, now time.Time) {
+	del.Attempts++
+	code, err := d.send(ctx, del)
+	del.StatusCode = code
+	outcome := StatusDelivered
+	switch {
+	case err == nil:
+		del.Status, del.Error, del.DeliveredAt = StatusDelivered, "", &now
+	case del.Attempts >= d.opts.MaxAttempts || errors.Is(err, ErrWebhookNotFound):
+		del.Status, del.Error = StatusFailed, utils.Truncate(err.Error(), maxError)
+		outcome = StatusFailed
+	default:
+		del.Error = utils.Truncate(err.Error(), maxError)
+		del.NextAttemptAt = now.Add(d.opts.Backoff << (del.Attempts - 1))
+		outcome = "retried"
+	}
+	metrics.WebhookDeliveriesTotal.WithLabelValues(del.Event, outcome).Inc()
+	if err != nil {
+		logging.Logger.Warn().Err(err).Str("delivery_id", del.ID).Str("webhook_id", del.WebhookID).
+			Int("attempts", del.Attempts).Str("status", del.Status).Msg("webhook delivery failed")
+	}
+	if err := d.store.UpdateDelivery(del); err != nil {
+		logging.Logger.Error().Err(err).Str("delivery_id", del.ID).Msg("record webhook delivery")
+	}
+}
+
+// send posts the delivery payload to its webhook, returning the response
+// status code and an error unless the webhook answered 2xx.
+func (d *Dispatcher) send(ctx context.Context, del Delivery) (int, error) {
+	w, err := d.store.GetWebhook(del.WebhookID)
+	if err != nil {
+		return 0, err
+	}
+	body := []byte(del.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Bifrost-Webhooks/1")
+	req.Header.Set(EventHeader, del.Event)
+	req.Header.Set(DeliveryHeader, del.ID)
+	req.Header.Set(SignatureHeader, Sign(w.Secret, time.Now(), body))
+	resp, err := d.opts.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) //nolint:errcheck
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// prune deletes expired deliveries and forgets events that can no longer
+// repeat.
+func (d *Dispatcher) prune(now time.Time) {
+	if n, err := d.store.DeleteDeliveriesBefore(now.Add(-d.opts.Retention)); err != nil {
+		logging.Logger.Error().Err(err).Msg("prune webhook deliveries")
+	} else if n > 0 {
+		logging.Logger.Info().Int64("deleted", n).Msg("pruned webhook deliveries")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, until := range d.fired {
+		if now.After(until) {
+			delete(d.fired, id)
+		}
+	}
+}
+
+// maxError is the size of Delivery.Error.
+const maxError = 1024
@@ -0,0 +1,235 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+// receiver records the requests of an httptest webhook receiver answering
+// with the codes in replies, then 200.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	replies  []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, replies ...int) *receiver {
+	rc := &receiver{replies: replies}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		rc.requests = append(rc.requests, r)
+		rc.bodies = append(rc.bodies, body)
+		code := http.StatusOK
+		if len(rc.replies) > 0 {
+			code, rc.replies = rc.replies[0], rc.replies[1:]
+		}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.requests)
+}
+
+func newTestDispatcher(t *testing.T, url string, events ...string) (*Dispatcher, *MemoryStore) {
+	t.Helper()
+	store := NewMemoryStore()
+	store.CreateWebhook(Webhook{ID: "wh1", OrgID: "o1", URL: url, Events: events, Secret: "s3cret", Active: true, CreatedAt: time.Now()})
+	return NewDispatcher(store, DispatcherOptions{Backoff: time.Second, MaxAttempts: 3}), store
+}
+
+func deliveries(t *testing.T, s Store) []Delivery {
+	t.Helper()
+	out, err := s.ListDeliveries(DeliveryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"event":"key.created"}`)
+	sig := Sign("s3cret", now, body)
+	if err := Verify("s3cret", sig, body, time.Minute, now.Add(30*time.Second)); err != nil {
+		t.Fatalf("valid signature refused: %v", err)
+	}
+	for name, check := range map[string]error{
+		"wrong secret": Verify("other", sig, body, time.Minute, now),
+		"changed body": Verify("s3cret", sig, []byte(`{}`), time.Minute, now),
+		"stale":        Verify("s3cret", sig, body, time.Minute, now.Add(2*time.Minute)),
+		"malformed":    Verify("s3cret", "v1=abc", body, time.Minute, now),
+	} {
+		if check != ErrInvalidSignature {
+			t.Fatalf("%s: expected ErrInvalidSignature, got %v", name, check)
+		}
+	}
+}
+
+func TestDeliverSigned(t *testing.T) {
+	rc := newReceiver(t)
+	d, store := newTestDispatcher(t, rc.URL, EventKeyCreated)
+	if err := d.Publish(Event{Type: EventKeyCreated, OrgID: "o1", KeyID: "k1"}); err != nil {
+		t.Fatal(err)
+	}
+	// Other orgs and unsubscribed events are not queued.
+	d.Publish(Event{Type: EventKeyCreated, OrgID: "o2", KeyID: "k2"})
+	d.Publish(Event{Type: EventKeyRevoked, OrgID: "o1", KeyID: "k1"})
+
+	if n, err := d.DeliverDue(context.Background(), time.Now()); err != nil || n != 1 {
+		t.Fatalf("expected 1 delivery attempted, got %d, %v", n, err)
+	}
+	if rc.count() != 1 {
+		t.Fatalf("expected 1 request, got %d", rc.count())
+	}
+	req, body := rc.requests[0], rc.bodies[0]
+	if err := Verify("s3cret", req.Header.Get(SignatureHeader), body, time.Minute, time.Now()); err != nil {
+		t.Fatalf("bad signature: %v", err)
+	}
+	var e Event
+	if err := json.Unmarshal(body, &e); err != nil || e.Type != EventKeyCreated || e.KeyID != "k1" || e.OrgID != "o1" || e.ID == "" {
+		t.Fatalf("unexpected payload %s", body)
+	}
+	del := deliveries(t, store)[0]
+	if req.Header.Get(EventHeader) != EventKeyCreated || req.Header.Get(DeliveryHeader) != del.ID {
+		t.Fatalf("unexpected headers %v", req.Header)
+	}
+	if del.Status != StatusDelivered || del.Attempts != 1 || del.StatusCode != 200 || del.DeliveredAt == nil {
+		t.Fatalf("unexpected delivery %+v", del)
+	}
+}
+
+func TestDeliverRetriesWithBackoff(t *testing.T) {
+	rc := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+	d, store := newTestDispatcher(t, rc.URL, EventKeyRevoked)
+	d.Publish(Event{Type: EventKeyRevoked, OrgID: "o1", KeyID: "k1"})
+	ctx := context.Background()
+	start := time.Now()
+
+	d.DeliverDue(ctx, start)
+	del := deliveries(t, store)[0]
+	if del.Status != StatusPending || del.Attempts != 1 || del.StatusCode != 500 || del.Error == "" {
+		t.Fatalf("unexpected delivery after first attempt %+v", del)
+	}
+	if wait := del.NextAttemptAt.Sub(start); wait < time.Second || wait > 2*time.Second {
+		t.Fatalf("expected first retry in 1s, got %s", wait)
+	}
+	// Not due yet.
+	if n, _ := d.DeliverDue(ctx, start); n != 0 {
+		t.Fatalf("retried before backoff: %d", n)
+	}
+	d.DeliverDue(ctx, start.Add(2*time.Second))
+	del = deliveries(t, store)[0]
+	if del.Attempts != 2 || del.NextAttemptAt.Sub(start) < 3*time.Second {
+		t.Fatalf("expected second retry after 2s more, got %+v", del)
+	}
+	d.DeliverDue(ctx, start.Add(10*time.Second))
+	del = deliveries(t, store)[0]
+	if del.Status != StatusDelivered || del.Attempts != 3 || del.Error != "" {
+		t.Fatalf("expected delivered on third attempt, got %+v", del)
+	}
+}
+
+func TestDeliverFailsAfterMaxAttempts(t *testing.T) {
+	rc := newReceiver(t, 500, 500, 500)
+	d, store := newTestDispatcher(t, rc.URL, EventKeyRevoked)
+	d.Publish(Event{Type: EventKeyRevoked, OrgID: "o1", KeyID: "k1"})
+	at := time.Now()
+	for i := 0; i < 5; i++ {
+		d.DeliverDue(context.Background(), at)
+		at = at.Add(time.Hour)
+	}
+	del := deliveries(t, store)[0]
+	if del.Status != StatusFailed || del.Attempts != 3 || rc.count() != 3 {
+		t.Fatalf("expected failed after 3 attempts, got %+v (%d requests)", del, rc.count())
+	}
+
+	red, err := d.Redeliver(del.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.DeliverDue(context.Background(), time.Now())
+	got, _ := store.GetDelivery(red.ID)
+	if got.Status != StatusDelivered || got.RedeliveryOf != del.ID || got.Payload != del.Payload {
+		t.Fatalf("unexpected redelivery %+v", got)
+	}
+	if orig, _ := store.GetDelivery(del.ID); orig.Status != StatusFailed {
+		t.Fatalf("original delivery changed: %+v", orig)
+	}
+}
+
+func TestClaimDueLeases(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.CreateDelivery(Delivery{ID: "d1", Status: StatusPending, NextAttemptAt: now, CreatedAt: now})
+	if got, _ := store.ClaimDue(now, now.Add(time.Minute), 10); len(got) != 1 {
+		t.Fatalf("expected to claim d1, got %+v", got)
+	}
+	if got, _ := store.ClaimDue(now, now.Add(time.Minute), 10); len(got) != 0 {
+		t.Fatalf("claimed d1 twice: %+v", got)
+	}
+	if got, _ := store.ClaimDue(now.Add(2*time.Minute), now.Add(3*time.Minute), 10); len(got) != 1 {
+		t.Fatal("lease did not expire")
+	}
+}
+
+func TestObserveRaisesOncePerPeriod(t *testing.T) {
+	rc := newReceiver(t)
+	d, store := newTestDispatcher(t, rc.URL, EventKeyRateLimited, EventKeyExpired, EventKeyBudgetExceeded)
+	// A second instance sharing the store sees the same relayed events.
+	other := NewDispatcher(store, DispatcherOptions{})
+	at := time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		for _, disp := range []*Dispatcher{d, other} {
+			disp.Observe(usage.Event{KeyID: "k1", OrgID: "o1", Category: ratelimit.ReasonRateLimited, StatusCode: 429, Timestamp: at.Add(time.Duration(i) * time.Second)})
+			disp.Observe(usage.Event{KeyID: "k1", OrgID: "o1", Category: usage.CategoryExpired, StatusCode: 401, Timestamp: at.Add(time.Duration(i) * time.Minute)})
+		}
+	}
+	d.Observe(usage.Event{KeyID: "k1", OrgID: "o1", Category: ratelimit.ReasonRateLimited, Timestamp: at.Add(time.Minute)})
+	d.Observe(usage.Event{KeyID: "k1", OrgID: "o1", Category: ratelimit.ReasonBudgetExceeded, Timestamp: at})
+	d.Observe(usage.Event{KeyID: "k1", OrgID: "o1", Category: usage.CategoryUpstreamError, Timestamp: at})
+
+	counts := map[string]int{}
+	for _, del := range deliveries(t, store) {
+		counts[del.Event]++
+	}
+	// Refusals of expired keys raise nothing: key.expired comes from the
+	// KeyExpired domain event.
+	want := map[string]int{EventKeyRateLimited: 2, EventKeyBudgetExceeded: 1}
+	if len(counts) != len(want) {
+		t.Fatalf("expected %v, got %v", want, counts)
+	}
+	for k, v := range want {
+		if counts[k] != v {
+			t.Fatalf("expected %v, got %v", want, counts)
+		}
+	}
+}
+
+func TestDeliveryToDeletedWebhookFails(t *testing.T) {
+	rc := newReceiver(t)
+	d, store := newTestDispatcher(t, rc.URL, EventKeyCreated)
+	d.Publish(Event{Type: EventKeyCreated, OrgID: "o1", KeyID: "k1"})
+	store.DeleteWebhook("wh1")
+	d.DeliverDue(context.Background(), time.Now())
+	if del := deliveries(t, store)[0]; del.Status != StatusFailed || rc.count() != 0 {
+		t.Fatalf("expected failed delivery without requests, got %+v", del)
+	}
+}
@@ -0,0 +1,386 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/events"
+)
+
+// Store defines persistence behavior for webhooks and their deliveries.
+// Methods taking events publish them once the change is made.
+type Store interface {
+	CreateWebhook(w Webhook, es ...events.Event) error
+	GetWebhook(id string) (Webhook, error)
+	// ListWebhooks returns the webhooks of an org.
+	ListWebhooks(orgID string) ([]Webhook, error)
+	UpdateWebhook(w Webhook, es ...events.Event) error
+	DeleteWebhook(id string, es ...events.Event) error
+
+	// CreateDelivery stores a new delivery. It returns ErrDeliveryExists if
+	// a delivery with the same ID exists, e.g. queued by another instance.
+	CreateDelivery(d Delivery, es ...events.Event) error
+	GetDelivery(id string) (Delivery, error)
+	UpdateDelivery(Delivery) error
+	// ListDeliveries returns the deliveries matching q, newest first.
+	ListDeliveries(q DeliveryQuery) ([]Delivery, error)
+	// ClaimDue returns up to limit pending deliveries due at now, moving
+	// their next attempt to until so no other dispatcher claims them
+	// meanwhile.
+	ClaimDue(now, until time.Time, limit int) ([]Delivery, error)
+	// DeleteDeliveriesBefore deletes deliveries created before cutoff and
+	// returns how many were deleted.
+	DeleteDeliveriesBefore(cutoff time.Time) (int64, error)
+}
+
+// defaultLimit is the number of deliveries listed when DeliveryQuery.Limit
+// is zero.
+const defaultLimit = 100
+
+func (q DeliveryQuery) limit() int {
+	if q.Limit <= 0 {
+		return defaultLimit
+	}
+	return q.Limit
+}
+
+// MemoryStore keeps webhooks and deliveries in memory with concurrency
+// safety.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	webhooks   map[string]Webhook
+	deliveries map[string]Delivery
+	bus        *events.Bus
+}
+
+// NewMemoryStore creates an initialized MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{webhooks: make(map[string]Webhook), deliveries: make(map[string]Delivery)}
+}
+
+// CreateWebhook inserts a new Webhook.
+func (s *MemoryStore) CreateWebhook(w Webhook, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.webhooks[w.ID]; ok {
+		return ErrWebhookExists
+	}
+	s.webhooks[w.ID] = w
+	return nil
+}
+
+// GetWebhook retrieves a Webhook by ID.
+func (s *MemoryStore) GetWebhook(id string) (Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	w, ok := s.webhooks[id]
+	if !ok {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	return w, nil
+}
+
+// ListWebhooks returns the webhooks of an org, oldest first.
+func (s *MemoryStore) ListWebhooks(orgID string) ([]Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Webhook{}
+	for _, w := range s.webhooks {
+		if w.OrgID == orgID {
+			out = append(out, w)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+// UpdateWebhook replaces an existing Webhook.
+func (s *MemoryStore) UpdateWebhook(w Webhook, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.webhooks[w.ID]; !ok {
+		return ErrWebhookNotFound
+	}
+	s.webhooks[w.ID] = w
+	return nil
+}
+
+// DeleteWebhook removes a Webhook.
+func (s *MemoryStore) DeleteWebhook(id string, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.webhooks[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(s.webhooks, id)
+	return nil
+}
+
+// CreateDelivery inserts a new Delivery.
+func (s *MemoryStore) CreateDelivery(d Delivery, es ...events.Event) (err error) {
+	defer s.bus.EmitOnSuccess(&err, es...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.deliveries[d.ID]; ok {
+		return ErrDeliveryExists
+	}
+	s.deliveries[d.ID] = d
+	return nil
+}
+
+// GetDelivery retrieves a Delivery by ID.
+func (s *MemoryStore) GetDelivery(id string) (Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, ok := s.deliveries[id]
+	if !ok {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	return d, nil
+}
+
+// UpdateDelivery replaces an existing Delivery.
+func (s *MemoryStore) UpdateDelivery(d Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.deliveries[d.ID]; !ok {
+		return ErrDeliveryNotFound
+	}
+	s.deliveries[d.ID] = d
+	return nil
+}
+
+// ListDeliveries returns the deliveries matching q, newest first.
+func (s *MemoryStore) ListDeliveries(q DeliveryQuery) ([]Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Delivery{}
+	for _, d := range s.deliveries {
+		if (q.WebhookID != "" && d.WebhookID != q.WebhookID) || (q.Status != "" && d.Status != q.Status) {
+			continue
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if limit := q.limit(); len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// ClaimDue returns pending deliveries due at now, earliest first.
+func (s *MemoryStore) ClaimDue(now, until time.Time, limit int) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []Delivery
+	for _, d := range s.deliveries {
+		if d.Status == StatusPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for i := range due {
+		due[i].NextAttemptAt = until
+		s.deliveries[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+// DeleteDeliveriesBefore deletes deliveries created before cutoff.
+func (s *MemoryStore) DeleteDeliveriesBefore(cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, d := range s.deliveries {
+		if d.CreatedAt.Before(cutoff) {
+			delete(s.deliveries, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// SQLStore persists webhooks and deliveries in a SQL database.
+type SQLStore struct {
+	db  *gorm.DB
+	bus *events.Bus
+}
+
+// SetBus makes the store publish events on b.
+func (s *MemoryStore) SetBus(b *events.Bus) { s.bus = b }
+
+// SetBus makes the store publish events on b, in the transaction making the
+// change.
+func (s *SQLStore) SetBus(b *events.Bus) { s.bus = b }
+
+// NewSQLStore creates a SQL-backed store.
+func NewSQLStore(db *gorm.DB) *SQLStore {
+	db.AutoMigrate(&Webhook{}, &Delivery{})
+	return &SQLStore{db: db}
+}
+
+// CreateWebhook inserts a webhook into the database.
+func (s *SQLStore) CreateWebhook(w Webhook, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		if err := tx.Create(&w).Error; err != nil {
+			if database.IsDuplicateError(err) {
+				return ErrWebhookExists
+			}
+			return err
+		}
+		return nil
+	}, es...)
+}
+
+// GetWebhook retrieves a webhook by ID.
+func (s *SQLStore) GetWebhook(id string) (Webhook, error) {
+	var w Webhook
+	if err := s.db.First(&w, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Webhook{}, ErrWebhookNotFound
+		}
+		return Webhook{}, err
+	}
+	return w, nil
+}
+
+// ListWebhooks returns the webhooks of an org, oldest first.
+func (s *SQLStore) ListWebhooks(orgID string) ([]Webhook, error) {
+	out := []Webhook{}
+	if err := s.db.Where("org_id = ?", orgID).Order("created_at").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateWebhook replaces an existing webhook.
+func (s *SQLStore) UpdateWebhook(w Webhook, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		res := tx.Model(&Webhook{}).Where("id = ?", w.ID).Select("*").Updates(w)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrWebhookNotFound
+		}
+		return nil
+	}, es...)
+}
+
+// DeleteWebhook removes a webhook.
+func (s *SQLStore) DeleteWebhook(id string, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		res := tx.Delete(&Webhook{}, "id = ?", id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrWebhookNotFound
+		}
+		return nil
+	}, es...)
+}
+
+// CreateDelivery inserts a delivery into the database.
+func (s *SQLStore) CreateDelivery(d Delivery, es ...events.Event) error {
+	return s.bus.Transaction(context.Background(), s.db, func(tx *gorm.DB) error {
+		if err := tx.Create(&d).Error; err != nil {
+			if database.IsDuplicateError(err) {
+				return ErrDeliveryExists
+			}
+			return err
+		}
+		return nil
+	}, es...)
+}
+
+// GetDelivery retrieves a delivery by ID.
+func (s *SQLStore) GetDelivery(id string) (Delivery, error) {
+	var d Delivery
+	if err := s.db.First(&d, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Delivery{}, ErrDeliveryNotFound
+		}
+		return Delivery{}, err
+	}
+	return d, nil
+}
+
+// UpdateDelivery replaces an existing delivery.
+func (s *SQLStore) UpdateDelivery(d Delivery) error {
+	res := s.db.Model(&Delivery{}).Where("id = ?", d.ID).Select("*").Updates(d)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrDeliveryNotFound
+	}
+	return nil
+}
+
+// ListDeliveries returns the deliveries matching q, newest first.
+func (s *SQLStore) ListDeliveries(q DeliveryQuery) ([]Delivery, error) {
+	tx := s.db.Model(&Delivery{})
+	if q.WebhookID != "" {
+		tx = tx.Where("webhook_id = ?", q.WebhookID)
+	}
+	if q.Status != "" {
+		tx = tx.Where("status = ?", q.Status)
+	}
+	out := []Delivery{}
+	if err := tx.Order("created_at desc").Limit(q.limit()).Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ClaimDue returns pending deliveries due at now, earliest first. Each is
+// claimed with a conditional update, so a delivery read by two instances
+// at once is only returned to one of them.
+func (s *SQLStore) ClaimDue(now, until time.Time, limit int) ([]Delivery, error) {
+	var due []Delivery
+	if err := s.db.Where("status = ? AND next_attempt_at <= ?", StatusPending, now).
+		Order("next_attempt_at").Limit(limit).Find(&due).Error; err != nil {
+		return nil, err
+	}
+	claimed := due[:0]
+	for _, d := range due {
+		res := s.db.Model(&Delivery{}).
+			Where("id = ? AND status = ? AND next_attempt_at = ?", d.ID, StatusPending, d.NextAttemptAt).
+			Update("next_attempt_at", until)
+		if res.Error != nil {
+			return claimed, res.Error
+		}
+		if res.RowsAffected == 1 {
+			d.NextAttemptAt = until
+			claimed = append(claimed, d)
+		}
+	}
+	return claimed, nil
+}
+
+// DeleteDeliveriesBefore deletes deliveries created before cutoff.
+func (s *SQLStore) DeleteDeliveriesBefore(cutoff time.Time) (int64, error) {
+	res := s.db.Where("created_at < ?", cutoff).Delete(&Delivery{})
+	return res.RowsAffected, res.Error
+}
+
+// Error values returned by Store operations.
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrWebhookExists    = errors.New("webhook already exists")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrDeliveryExists   = errors.New("webhook delivery already exists")
+)
@@ -0,0 +1,121 @@
+package webhooks
+
+import (
+	"net/url"
+	"slices"
+	"time"
+)
+
+// Event types a webhook can subscribe to.
+const (
+	// EventKeyCreated is sent when a virtual key is created.
+	EventKeyCreated = "key.created"
+	// EventKeyRevoked is sent when a virtual key is revoked.
+	EventKeyRevoked = "key.revoked"
+	// EventKeyExpired is sent once a key has passed its expiry time.
+	EventKeyExpired = "key.expired"
+	// EventKeyRateLimited is sent when a key's requests are refused by its
+	// rate limit or a quota, at most once a minute per key.
+	EventKeyRateLimited = "key.rate_limited"
+	// EventKeyBudgetExceeded is sent when a key's requests are refused by
+	// its token budget, at most once an hour per key.
+	EventKeyBudgetExceeded = "key.budget_exceeded"
+	// EventKeyUsed is sent when a one-shot key is used.
+	EventKeyUsed = "key.used"
+)
+
+// EventTypes lists every event type.
+var EventTypes = []string{EventKeyCreated, EventKeyRevoked, EventKeyExpired, EventKeyRateLimited, EventKeyBudgetExceeded, EventKeyUsed}
+
+// Webhook is an organization's subscription to events.
+type Webhook struct {
+	ID    string `json:"id" gorm:"primaryKey;size:255"`
+	OrgID string `json:"org_id" gorm:"size:255;not null;index"`
+	URL   string `json:"url" gorm:"size:2048;not null" example:"https://hooks.example.com/bifrost"`
+	// Events are the event types delivered to URL.
+	Events []string `json:"events" gorm:"serializer:json;type:text"`
+	// Secret signs deliveries. It is only returned when the webhook is
+	// created or its secret replaced.
+	Secret    string    `json:"secret,omitempty" gorm:"size:255;not null"`
+	Active    bool      `json:"active" gorm:"not null;default:true"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
+
+func (Webhook) TableName() string { return "webhooks" }
+
+// Subscribed reports whether w is active and delivers events of type event.
+func (w Webhook) Subscribed(event string) bool {
+	return w.Active && slices.Contains(w.Events, event)
+}
+
+// Validate returns the name of the first invalid field, or "" if w is valid.
+func (w Webhook) Validate() string {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "url"
+	}
+	if len(w.Events) == 0 {
+		return "events"
+	}
+	for _, e := range w.Events {
+		if !slices.Contains(EventTypes, e) {
+			return "events"
+		}
+	}
+	return ""
+}
+
+// Event is the payload delivered to webhooks.
+type Event struct {
+	// ID identifies the event; every delivery of the event carries it.
+	ID        string    `json:"id"`
+	Type      string    `json:"event" example:"key.rate_limited"`
+	OrgID     string    `json:"org_id"`
+	KeyID     string    `json:"key_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// Data holds event-specific details.
+	Data map[string]any `json:"data,omitempty"`
+}
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Delivery records the delivery of an event to a webhook and its attempts.
+type Delivery struct {
+	ID        string `json:"id" gorm:"primaryKey;size:64"`
+	WebhookID string `json:"webhook_id" gorm:"size:255;not null;index"`
+	OrgID     string `json:"org_id" gorm:"size:255;not null;index"`
+	EventID   string `json:"event_id" gorm:"size:64;not null"`
+	Event     string `json:"event" gorm:"size:64;not null"`
+	// Payload is the JSON body sent to the webhook.
+	Payload string `json:"payload" gorm:"type:text;not null"`
+	// Status is pending until the webhook accepts the delivery or it runs
+	// out of attempts.
+	Status string `json:"status" gorm:"size:16;not null;index"`
+	// Attempts is how many times delivery was tried.
+	Attempts int `json:"attempts" gorm:"not null;default:0"`
+	// StatusCode is the webhook's response to the last attempt, if any.
+	StatusCode int `json:"status_code,omitempty" gorm:"not null;default:0"`
+	// Error describes why the last attempt failed.
+	Error string `json:"error,omitempty" gorm:"size:1024;not null;default:''"`
+	// RedeliveryOf is the delivery this one repeats, if it was redelivered.
+	RedeliveryOf  string     `json:"redelivery_of,omitempty" gorm:"size:64;not null;default:''"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"not null;index"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"not null;index"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+func (Delivery) TableName() string { return "webhook_deliveries" }
+
+// DeliveryQuery selects deliveries. Empty fields match everything.
+type DeliveryQuery struct {
+	WebhookID string
+	Status    string
+	// Limit caps the number of deliveries returned, newest first. Zero
+	// means 100.
+	Limit int
+}
@@ -0,0 +1,230 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/farovictor/bifrost/pkg/anomaly"
+	"github.com/farovictor/bifrost/pkg/events"
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/orgs"
+)
+
+// ListAnomalies handles GET /v1/anomalies. Callers only see the flags of
+// the org in their token.
+//
+// @Summary      List anomaly flags
+// @Description  Anomalies flagged on virtual keys by the usage anomaly detector, newest first.
+// @Tags         anomalies
+// @Produce      json
+// @Param        key     query     string  false  "Only flags of this virtual key"
+// @Param        org     query     string  false  "Only flags of this organization; must be the caller's"
+// @Param        status  query     string  false  "open (default), resolved or all"
+// @Param        limit   query     int     false  "Maximum flags returned (default 100)"
+// @Success      200  {array}   anomaly.Flag
+// @Failure      400  {object}  ErrorResponse  "invalid status or limit"
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/anomalies [get]
+func (s *Server) ListAnomalies(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := anomaly.FlagQuery{
+		KeyID:  params.Get("key"),
+		OrgID:  params.Get("org"),
+		Status: params.Get("status"),
+	}
+	switch q.Status {
+	case "":
+		q.Status = anomaly.StatusOpen
+	case "all":
+		q.Status = ""
+	case anomaly.StatusOpen, anomaly.StatusResolved:
+	default:
+		writeError(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		q.Limit = n
+	}
+	org, ok := callerOrg(r)
+	if !ok {
+		writeNoOrg(w)
+		return
+	}
+	if org != "" {
+		if q.OrgID != "" && q.OrgID != org {
+			writeError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		q.OrgID = org
+	}
+
+	flags, err := s.AnomalyStore.ListFlags(q)
+	if err != nil {
+		writeError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flags)
+}
+
+// ResolveAnomaly handles POST /v1/anomalies/{id}/resolve. A key suspended
+// because of the flag is reinstated.
+//
+// @Summary      Resolve anomaly flag
+// @Description  Mark an anomaly flag as handled. If the flag suspended its key and the key is still suspended for that reason, the key is reinstated.
+// @Tags         anomalies
+// @Produce      json
+// @Param        id   path      string  true  "Flag ID"
+// @Success      200  {object}  anomaly.Flag
+// @Failure      403  {object}  ErrorResponse  "missing permission"
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/anomalies/{id}/resolve [post]
+func (s *Server) ResolveAnomaly(w http.ResponseWriter, r *http.Request) {
+	f, err := s.AnomalyStore.GetFlag(chi.URLParam(r, "id"))
+	if err != nil {
+		switch err {
+		case anomaly.ErrFlagNotFound:
+			writeError(w, "not found", http.StatusNotFound)
+		default:
+			writeError(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+	if !owns(r, f.OrgID) {
+		writeError(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	before := f
+	now := time.Now()
+	resolved := f
+	if f.Open() {
+		resolved.ResolvedAt = &now
+	}
+	// The event goes with the first change made: resolving the flag, or
+	// reinstating the key of a flag already resolved.
+	es := []events.Event{events.AnomalyResolved{FlagID: f.ID, KeyID: f.KeyID, OrgID: f.OrgID, Meta: meta(r, before, resolved)}}
+	if f.Open() {
+		if err := s.AnomalyStore.ResolveFlag(f.ID, now, es...); err != nil {
+			writeError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		f, es = resolved, nil
+	}
+	if k, err := s.KeyStore.Get(f.KeyID); err == nil && k.Suspended && k.SuspendedReason == f.SuspendReason() {
+		k.Suspended = false
+		k.SuspendedReason = ""
+		if err := s.KeyStore.Update(k.ID, k, es...); err != nil {
+			writeError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		logging.Logger.Info().Str("key_id", k.ID).Str("flag_id", f.ID).Msg("reinstated key")
+	}
+	logging.Logger.Info().Str("flag_id", f.ID).Msg("resolved anomaly")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f)
+}
+
+// scopedOrg returns the org in the path of an /orgs/{id} request, writing an
+// error and returning false if it does not exist or is not the caller's.
+func (s *Server) scopedOrg(w http.ResponseWriter, r *http.Request) (string, bool) {
+	orgID := chi.URLParam(r, "id")
+	if org, ok := callerOrg(r); !ok || org != "" && org != orgID {
+		writeError(w, "forbidden", http.StatusForbidden)
+		return "", false
+	}
+	if _, err := s.OrgStore.Get(orgID); err != nil {
+		if err == orgs.ErrOrgNotFound {
+			writeError(w, "not found", http.StatusNotFound)
+			return "", false
+		}
+		writeError(w, "internal error", http.StatusInternalServerError)
+		return "", false
+	}
+	return orgID, true
+}
+
+// GetAnomalyPolicy handles GET /v1/orgs/{id}/anomaly-policy.
+//
+// @Summary      Get anomaly policy
+// @Description  How the organization responds to anomalies on its keys. Without a policy, keys are only flagged.
+// @Tags         anomalies
+// @Produce      json
+// @Param        id   path      string  true  "Organization ID"
+// @Success      200  {object}  anomaly.Policy
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/orgs/{id}/anomaly-policy [get]
+func (s *Server) GetAnomalyPolicy(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := s.scopedOrg(w, r)
+	if !ok {
+		return
+	}
+	p, err := s.AnomalyStore.Policy(orgID)
+	if err != nil {
+		writeError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// PutAnomalyPolicy handles PUT /v1/orgs/{id}/anomaly-policy.
+//
+// @Summary      Set anomaly policy
+// @Description  Replace the organization's anomaly policy. With auto_suspend, a flagged key is suspended at once; suspend_on limits this to some kinds of anomaly (request_spike, token_spike, error_spike, new_ip).
+// @Tags         anomalies
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string          true  "Organization ID"
+// @Param        body  body      anomaly.Policy  true  "Policy"
+// @Success      200   {object}  anomaly.Policy
+// @Failure      400   {object}  ErrorResponse  "invalid suspend_on"
+// @Failure      403   {object}  ErrorResponse  "missing permission, or org is not the caller's"
+// @Failure      404   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/orgs/{id}/anomaly-policy [put]
+func (s *Server) PutAnomalyPolicy(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := s.scopedOrg(w, r)
+	if !ok {
+		return
+	}
+	var p anomaly.Policy
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeError(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if field := p.Validate(); field != "" {
+		writeError(w, "invalid "+field, http.StatusBadRequest)
+		return
+	}
+	p.OrgID = orgID
+	before, _ := s.AnomalyStore.Policy(orgID)
+	if err := s.AnomalyStore.PutPolicy(p, events.AnomalyPolicyUpdated{OrgID: orgID, Meta: meta(r, before, p)}); err != nil {
+		writeError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	logging.Logger.Info().Str("org_id", orgID).Bool("auto_suspend", p.AutoSuspend).Msg("set anomaly policy")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
@@ -1,6 +1,11 @@
 package routes
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+)
 
 // Healthz responds with a simple string to indicate the service is running.
 //
@@ -12,3 +17,25 @@ import "net/http"
 func Healthz(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("ok"))
 }
+
+// RateLimitHealth reports whether the rate limiting backend is reachable.
+// While it is degraded limits follow the configured failure policy, so the
+// endpoint answers 503 to let probes and dashboards flag it.
+//
+// @Summary      Rate limiter health
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  ratelimit.HealthStatus
+// @Failure      503  {object}  ratelimit.HealthStatus  "backend unavailable"
+// @Router       /healthz/ratelimit [get]
+func (s *Server) RateLimitHealth(w http.ResponseWriter, r *http.Request) {
+	st := ratelimit.HealthStatus{Backend: "none"}
+	if s.RateLimitHealthCheck != nil {
+		st = s.RateLimitHealthCheck.Status()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if st.Degraded {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(st)
+}
@@ -8,6 +8,8 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	rl "github.com/farovictor/bifrost/middlewares"
+	"github.com/farovictor/bifrost/pkg/events"
 	"github.com/farovictor/bifrost/pkg/keys"
 	"github.com/farovictor/bifrost/pkg/logging"
 	"github.com/farovictor/bifrost/pkg/services"
@@ -22,7 +24,8 @@ import (
 // @Produce      json
 // @Param        body  body      keys.VirtualKey  true  "Virtual key to create"
 // @Success      201   {object}  keys.VirtualKey
-// @Failure      400   {object}  ErrorResponse  "invalid scope, rate_limit, or expires_at"
+// @Failure      400   {object}  ErrorResponse  "invalid scope, rate_limit, rate_limit_window, rate_limit_burst, tokens_per_minute, max_concurrent, token_budget, budget_usd, labels or expires_at"
+// @Failure      403   {object}  ErrorResponse  "missing permission"
 // @Failure      404   {object}  ErrorResponse  "service not found"
 // @Failure      409   {object}  ErrorResponse  "key already exists"
 // @Failure      500   {object}  ErrorResponse
@@ -35,6 +38,10 @@ func (s *Server) CreateKey(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "invalid request", http.StatusBadRequest)
 		return
 	}
+	// Only the anomaly detector suspends keys, only the proxy marks one-shot
+	// keys used and only /v1/service-token mints keys for service accounts.
+	k.Suspended, k.SuspendedReason = false, ""
+	k.Used, k.ServiceAccountID = false, ""
 	if k.ID == "" || k.Target == "" {
 		writeError(w, "id and target are required", http.StatusBadRequest)
 		return
@@ -47,11 +54,43 @@ func (s *Server) CreateKey(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "invalid rate_limit", http.StatusBadRequest)
 		return
 	}
+	if !keys.ValidateWindow(k.RateLimitWindow) {
+		writeError(w, "invalid rate_limit_window", http.StatusBadRequest)
+		return
+	}
+	if k.RateLimitBurst < 0 {
+		writeError(w, "invalid rate_limit_burst", http.StatusBadRequest)
+		return
+	}
+	if k.TokensPerMinute < 0 {
+		writeError(w, "invalid tokens_per_minute", http.StatusBadRequest)
+		return
+	}
+	if k.MaxConcurrent < 0 {
+		writeError(w, "invalid max_concurrent", http.StatusBadRequest)
+		return
+	}
+	if k.TokenBudget < 0 {
+		writeError(w, "invalid token_budget", http.StatusBadRequest)
+		return
+	}
+	if k.BudgetUSD < 0 {
+		writeError(w, "invalid budget_usd", http.StatusBadRequest)
+		return
+	}
+	if !keys.ValidateLabels(k.Labels) {
+		writeError(w, "invalid labels", http.StatusBadRequest)
+		return
+	}
 	if !k.ExpiresAt.After(time.Now()) {
 		writeError(w, "expires_at must be in the future", http.StatusBadRequest)
 		return
 	}
-	if _, err := s.ServiceStore.Get(k.Target); err != nil {
+	svc, err := s.ServiceStore.Get(k.Target)
+	if err == nil && !owns(r, svc.OrgID) {
+		err = services.ErrServiceNotFound
+	}
+	if err != nil {
 		if err == services.ErrServiceNotFound {
 			writeError(w, "service not found", http.StatusNotFound)
 			return
@@ -59,7 +98,14 @@ func (s *Server) CreateKey(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	if err := s.KeyStore.Create(k); err != nil {
+	// Keys belong to their service's org, the caller's, so org quotas cover
+	// them, and are charged to the caller unless another owner is named.
+	oc := rl.OrgFromContext(r.Context())
+	k.OrgID = svc.OrgID
+	if k.Owner == "" {
+		k.Owner = oc.UserID
+	}
+	if err := s.KeyStore.Create(k, events.KeyCreated{KeyID: k.ID, OrgID: k.OrgID, Target: k.Target, Scope: k.Scope, Owner: k.Owner, ExpiresAt: k.ExpiresAt, Meta: meta(r, nil, k)}); err != nil {
 		switch err {
 		case keys.ErrKeyExists:
 			writeError(w, "key already exists", http.StatusConflict)
@@ -74,19 +120,29 @@ func (s *Server) CreateKey(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(k)
 }
 
-// ListKeys handles GET /keys and returns all VirtualKeys.
+// ListKeys handles GET /keys and returns the VirtualKeys of the caller's org.
 //
 // @Summary      List virtual keys
 // @Tags         virtual-keys
 // @Produce      json
 // @Success      200  {array}   keys.VirtualKey
+// @Failure      403  {object}  ErrorResponse  "missing permission"
 // @Failure      500  {object}  ErrorResponse
 // @Security     ApiKeyAuth
 // @Security     BearerAuth
 // @Router       /v1/keys [get]
 func (s *Server) ListKeys(w http.ResponseWriter, r *http.Request) {
+	list := s.KeyStore.List()
+	org, ok := callerOrg(r)
+	if !ok {
+		writeNoOrg(w)
+		return
+	}
+	if org != "" {
+		list = s.KeyStore.ListByOrg(org)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(s.KeyStore.List())
+	json.NewEncoder(w).Encode(list)
 }
 
 // usageListResponse is the envelope returned by the usage list endpoint.
@@ -107,6 +163,7 @@ type usageListResponse struct {
 // @Param        page     query     int     false "Page number (default 1)"
 // @Param        per_page query     int     false "Page size (default 20)"
 // @Success      200  {object}  usageListResponse
+// @Failure      403  {object}  ErrorResponse  "missing permission"
 // @Failure      404  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Security     ApiKeyAuth
@@ -114,8 +171,8 @@ type usageListResponse struct {
 // @Router       /v1/keys/{id}/usage [get]
 func (s *Server) ListKeyUsage(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	if _, err := s.KeyStore.Get(id); err != nil {
-		if err == keys.ErrKeyNotFound {
+	if k, err := s.KeyStore.Get(id); err != nil || !owns(r, k.OrgID) {
+		if err == nil || err == keys.ErrKeyNotFound {
 			writeError(w, "not found", http.StatusNotFound)
 			return
 		}
@@ -163,6 +220,7 @@ func (s *Server) ListKeyUsage(w http.ResponseWriter, r *http.Request) {
 // @Tags         virtual-keys
 // @Param        id   path      string  true  "Virtual key ID"
 // @Success      204
+// @Failure      403  {object}  ErrorResponse  "missing permission"
 // @Failure      404  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Security     ApiKeyAuth
@@ -170,7 +228,14 @@ func (s *Server) ListKeyUsage(w http.ResponseWriter, r *http.Request) {
 // @Router       /v1/keys/{id} [delete]
 func (s *Server) DeleteKey(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	if err := s.KeyStore.Delete(id); err != nil {
+	k, err := s.KeyStore.Get(id)
+	if err == nil && !owns(r, k.OrgID) {
+		err = keys.ErrKeyNotFound
+	}
+	if err == nil {
+		err = s.KeyStore.Delete(id, events.KeyRevoked{KeyID: k.ID, OrgID: k.OrgID, Meta: meta(r, k, nil)})
+	}
+	if err != nil {
 		switch err {
 		case keys.ErrKeyNotFound:
 			writeError(w, "not found", http.StatusNotFound)
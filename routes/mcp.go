@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/farovictor/bifrost/pkg/audit"
+	"github.com/farovictor/bifrost/pkg/events"
 	"github.com/farovictor/bifrost/pkg/keys"
 	"github.com/farovictor/bifrost/pkg/services"
 	"github.com/farovictor/bifrost/pkg/version"
@@ -113,7 +116,7 @@ func (s *Server) MCP(w http.ResponseWriter, r *http.Request) {
 	case "tools/list":
 		s.mcpToolsList(w, req)
 	case "tools/call":
-		s.mcpToolsCall(w, req)
+		s.mcpToolsCall(w, r, req)
 	default:
 		writeMCPError(w, req.ID, mcpErrNotFound, "method not found: "+req.Method)
 	}
@@ -138,7 +141,7 @@ func (s *Server) mcpToolsList(w http.ResponseWriter, req mcpRequest) {
 	})
 }
 
-func (s *Server) mcpToolsCall(w http.ResponseWriter, req mcpRequest) {
+func (s *Server) mcpToolsCall(w http.ResponseWriter, r *http.Request, req mcpRequest) {
 	var params struct {
 		Name      string          `json:"name"`
 		Arguments json.RawMessage `json:"arguments"`
@@ -150,16 +153,16 @@ func (s *Server) mcpToolsCall(w http.ResponseWriter, req mcpRequest) {
 
 	switch params.Name {
 	case "list_services":
-		s.mcpListServices(w, req.ID)
+		s.mcpListServices(w, r, req.ID)
 	case "request_key":
-		s.mcpRequestKey(w, req.ID, params.Arguments)
+		s.mcpRequestKey(w, r, req.ID, params.Arguments)
 	default:
 		writeMCPError(w, req.ID, mcpErrNotFound, "unknown tool: "+params.Name)
 	}
 }
 
 // mcpRequestKey implements the request_key MCP tool (Story 2.2).
-func (s *Server) mcpRequestKey(w http.ResponseWriter, id any, raw json.RawMessage) {
+func (s *Server) mcpRequestKey(w http.ResponseWriter, r *http.Request, id any, raw json.RawMessage) {
 	var args struct {
 		ServiceName string `json:"service_name"`
 		TTLSeconds  int    `json:"ttl_seconds"`
@@ -181,7 +184,13 @@ func (s *Server) mcpRequestKey(w http.ResponseWriter, id any, raw json.RawMessag
 		args.RateLimit = 60
 	}
 
-	if _, err := s.ServiceStore.Get(args.ServiceName); err != nil {
+	// Keys are only issued for services of the client's orgs (AC4).
+	client := s.mcpClient(r)
+	svc, err := s.ServiceStore.Get(args.ServiceName)
+	if err == nil && !s.mcpCanUse(client, svc) {
+		err = services.ErrServiceNotFound
+	}
+	if err != nil {
 		if err == services.ErrServiceNotFound {
 			writeMCPError(w, id, mcpErrInvalid, "service not found: "+args.ServiceName)
 			return
@@ -199,8 +208,11 @@ func (s *Server) mcpRequestKey(w http.ResponseWriter, id any, raw json.RawMessag
 		RateLimit: args.RateLimit,
 		Source:    keys.SourceMCP,
 		OneShot:   args.OneShot,
+		OrgID:     svc.OrgID,
 	}
-	if err := s.KeyStore.Create(k); err != nil {
+	created := events.KeyCreated{KeyID: k.ID, OrgID: k.OrgID, Target: k.Target, Scope: k.Scope, ExpiresAt: k.ExpiresAt, Meta: meta(r, nil, k)}
+	created.ActorType, created.Actor = audit.ActorMCP, client
+	if err := s.KeyStore.Create(k, created); err != nil {
 		writeMCPError(w, id, mcpErrInternal, "failed to issue key")
 		return
 	}
@@ -211,9 +223,44 @@ func (s *Server) mcpRequestKey(w http.ResponseWriter, id any, raw json.RawMessag
 	})
 }
 
-// mcpListServices implements the list_services MCP tool (Story 2.3).
-func (s *Server) mcpListServices(w http.ResponseWriter, id any) {
-	svcs := s.ServiceStore.List()
+// mcpClient returns the ID of the user whose API key the MCP client
+// presented, or "" when it is not known.
+func (s *Server) mcpClient(r *http.Request) string {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if key == "" {
+		return ""
+	}
+	u, err := s.UserStore.GetByAPIKey(key)
+	if err != nil {
+		return ""
+	}
+	return u.ID
+}
+
+// mcpCanUse reports whether the user with ID client may request keys for
+// svc: it must belong to one of the user's orgs. Clients not known as a
+// user, such as the static API key, may use every service.
+func (s *Server) mcpCanUse(client string, svc services.Service) bool {
+	if client == "" {
+		return true
+	}
+	_, err := s.MembershipStore.Get(client, svc.OrgID)
+	return err == nil
+}
+
+// mcpListServices implements the list_services MCP tool (Story 2.3),
+// listing the services of the client's orgs.
+func (s *Server) mcpListServices(w http.ResponseWriter, r *http.Request, id any) {
+	client := s.mcpClient(r)
+	var svcs []services.Service
+	for _, svc := range s.ServiceStore.List() {
+		if s.mcpCanUse(client, svc) {
+			svcs = append(svcs, svc)
+		}
+	}
 
 	type serviceInfo struct {
 		Name    string `json:"name"`
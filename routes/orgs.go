@@ -6,6 +6,8 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	rl "github.com/farovictor/bifrost/middlewares"
+	"github.com/farovictor/bifrost/pkg/events"
 	"github.com/farovictor/bifrost/pkg/logging"
 	"github.com/farovictor/bifrost/pkg/orgs"
 	"github.com/farovictor/bifrost/pkg/utils"
@@ -20,6 +22,7 @@ import (
 // @Param        body  body      orgs.Organization  true  "Organization to create"
 // @Success      201   {object}  orgs.Organization
 // @Failure      400   {object}  ErrorResponse  "missing name"
+// @Failure      403   {object}  ErrorResponse  "missing permission"
 // @Failure      409   {object}  ErrorResponse  "organization already exists"
 // @Failure      500   {object}  ErrorResponse
 // @Security     ApiKeyAuth
@@ -38,7 +41,7 @@ func (s *Server) CreateOrg(w http.ResponseWriter, r *http.Request) {
 	if o.ID == "" {
 		o.ID = utils.GenerateID()
 	}
-	if err := s.OrgStore.Create(o); err != nil {
+	if err := s.OrgStore.Create(o, events.OrgCreated{OrgID: o.ID, Name: o.Name, Meta: meta(r, nil, o)}); err != nil {
 		switch err {
 		case orgs.ErrOrgExists:
 			writeError(w, "organization already exists", http.StatusConflict)
@@ -53,19 +56,32 @@ func (s *Server) CreateOrg(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(o)
 }
 
-// ListOrgs handles GET /orgs.
+// ListOrgs handles GET /orgs. Org-scoped callers only see their own org.
 //
 // @Summary      List organizations
 // @Tags         organizations
 // @Produce      json
 // @Success      200  {array}   orgs.Organization
+// @Failure      403  {object}  ErrorResponse  "missing permission"
 // @Failure      500  {object}  ErrorResponse
 // @Security     ApiKeyAuth
 // @Security     BearerAuth
 // @Router       /v1/orgs [get]
 func (s *Server) ListOrgs(w http.ResponseWriter, r *http.Request) {
+	list := s.OrgStore.List()
+	org, ok := callerOrg(r)
+	if !ok {
+		writeNoOrg(w)
+		return
+	}
+	if org != "" {
+		list = []orgs.Organization{}
+		if o, err := s.OrgStore.Get(org); err == nil {
+			list = append(list, o)
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(s.OrgStore.List())
+	json.NewEncoder(w).Encode(list)
 }
 
 // GetOrg handles GET /orgs/{id}.
@@ -75,13 +91,17 @@ func (s *Server) ListOrgs(w http.ResponseWriter, r *http.Request) {
 // @Produce      json
 // @Param        id   path      string  true  "Organization ID"
 // @Success      200  {object}  orgs.Organization
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
 // @Failure      404  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Security     ApiKeyAuth
 // @Security     BearerAuth
 // @Router       /v1/orgs/{id} [get]
 func (s *Server) GetOrg(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id, ok := s.scopedOrg(w, r)
+	if !ok {
+		return
+	}
 	o, err := s.OrgStore.Get(id)
 	if err != nil {
 		switch err {
@@ -102,14 +122,19 @@ func (s *Server) GetOrg(w http.ResponseWriter, r *http.Request) {
 // @Tags         organizations
 // @Param        id   path      string  true  "Organization ID"
 // @Success      204
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
 // @Failure      404  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Security     ApiKeyAuth
 // @Security     BearerAuth
 // @Router       /v1/orgs/{id} [delete]
 func (s *Server) DeleteOrg(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	if err := s.OrgStore.Delete(id); err != nil {
+	id, ok := s.scopedOrg(w, r)
+	if !ok {
+		return
+	}
+	before, _ := s.OrgStore.Get(id)
+	if err := s.OrgStore.Delete(id, events.OrgDeleted{OrgID: id, Meta: meta(r, before, nil)}); err != nil {
 		switch err {
 		case orgs.ErrOrgNotFound:
 			writeError(w, "not found", http.StatusNotFound)
@@ -129,19 +154,15 @@ func (s *Server) DeleteOrg(w http.ResponseWriter, r *http.Request) {
 // @Produce      json
 // @Param        id   path      string  true  "Organization ID"
 // @Success      200  {array}   orgs.Membership
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
 // @Failure      404  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Security     ApiKeyAuth
 // @Security     BearerAuth
 // @Router       /v1/orgs/{id}/members [get]
 func (s *Server) ListOrgMembers(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	if _, err := s.OrgStore.Get(id); err != nil {
-		if err == orgs.ErrOrgNotFound {
-			writeError(w, "not found", http.StatusNotFound)
-			return
-		}
-		writeError(w, "internal error", http.StatusInternalServerError)
+	id, ok := s.scopedOrg(w, r)
+	if !ok {
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -158,6 +179,7 @@ func (s *Server) ListOrgMembers(w http.ResponseWriter, r *http.Request) {
 // @Param        body  body      orgs.Membership true  "Membership to create"
 // @Success      201   {object}  orgs.Membership
 // @Failure      400   {object}  ErrorResponse  "missing user_id or invalid role"
+// @Failure      403   {object}  ErrorResponse  "missing permission, or org is not the caller's"
 // @Failure      404   {object}  ErrorResponse  "organization not found"
 // @Failure      409   {object}  ErrorResponse  "membership already exists"
 // @Failure      500   {object}  ErrorResponse
@@ -165,13 +187,8 @@ func (s *Server) ListOrgMembers(w http.ResponseWriter, r *http.Request) {
 // @Security     BearerAuth
 // @Router       /v1/orgs/{id}/members [post]
 func (s *Server) AddOrgMember(w http.ResponseWriter, r *http.Request) {
-	orgID := chi.URLParam(r, "id")
-	if _, err := s.OrgStore.Get(orgID); err != nil {
-		if err == orgs.ErrOrgNotFound {
-			writeError(w, "not found", http.StatusNotFound)
-			return
-		}
-		writeError(w, "internal error", http.StatusInternalServerError)
+	orgID, ok := s.scopedOrg(w, r)
+	if !ok {
 		return
 	}
 
@@ -192,8 +209,13 @@ func (s *Server) AddOrgMember(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "invalid role", http.StatusBadRequest)
 		return
 	}
+	// Only owners may make others owners.
+	if m.Role == orgs.RoleOwner && !rl.HasPermission(r, orgs.PermMembersOwners) {
+		rl.WriteForbidden(w, orgs.PermMembersOwners)
+		return
+	}
 
-	if err := s.MembershipStore.Create(m); err != nil {
+	if err := s.MembershipStore.Create(m, events.MemberAdded{OrgID: orgID, UserID: m.UserID, Role: m.Role, Meta: meta(r, nil, m)}); err != nil {
 		switch err {
 		case orgs.ErrMembershipExists:
 			writeError(w, "membership already exists", http.StatusConflict)
@@ -215,15 +237,24 @@ func (s *Server) AddOrgMember(w http.ResponseWriter, r *http.Request) {
 // @Param        id      path      string  true  "Organization ID"
 // @Param        userID  path      string  true  "User ID"
 // @Success      204
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
 // @Failure      404  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Security     ApiKeyAuth
 // @Security     BearerAuth
 // @Router       /v1/orgs/{id}/members/{userID} [delete]
 func (s *Server) RemoveOrgMember(w http.ResponseWriter, r *http.Request) {
-	orgID := chi.URLParam(r, "id")
+	orgID, ok := s.scopedOrg(w, r)
+	if !ok {
+		return
+	}
 	userID := chi.URLParam(r, "userID")
-	if err := s.MembershipStore.Delete(userID, orgID); err != nil {
+	before, err := s.MembershipStore.Get(userID, orgID)
+	if err == nil && before.Role == orgs.RoleOwner && !rl.HasPermission(r, orgs.PermMembersOwners) {
+		rl.WriteForbidden(w, orgs.PermMembersOwners)
+		return
+	}
+	if err := s.MembershipStore.Delete(userID, orgID, events.MemberRemoved{OrgID: orgID, UserID: userID, Meta: meta(r, before, nil)}); err != nil {
 		switch err {
 		case orgs.ErrMembershipNotFound:
 			writeError(w, "not found", http.StatusNotFound)
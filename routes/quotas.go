@@ -0,0 +1,223 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/farovictor/bifrost/pkg/events"
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/quotas"
+	"github.com/farovictor/bifrost/pkg/utils"
+)
+
+// quotaStatus is a quota together with its current consumption.
+type quotaStatus struct {
+	quotas.Quota
+	// Used is how much of the limit has been consumed over the last period.
+	Used int `json:"used"`
+	// Remaining is how much can be consumed right now.
+	Remaining int `json:"remaining"`
+	// ResetSeconds is how long until the quota is fully available again.
+	ResetSeconds int `json:"reset_seconds"`
+}
+
+// quotaStatusOf reads q's consumption from the rate limiter without
+// consuming anything.
+func (s *Server) quotaStatusOf(r *http.Request, q quotas.Quota) quotaStatus {
+	st := quotaStatus{Quota: q, Remaining: q.Limit}
+	if s.Limiter == nil {
+		return st
+	}
+	bucket, lim := q.Bucket()
+	res, err := s.Limiter.Allow(r.Context(), bucket, lim, 0)
+	if err != nil {
+		return st
+	}
+	st.Remaining = res.Remaining
+	st.Used = q.Limit - res.Remaining
+	st.ResetSeconds = int(res.ResetAfter.Seconds())
+	return st
+}
+
+// quotaOrg returns the org owning what q is attached to, or "" when it has
+// none.
+func (s *Server) quotaOrg(q quotas.Quota) string {
+	switch q.Scope {
+	case quotas.ScopeOrg:
+		return q.ScopeID
+	case quotas.ScopeService:
+		if svc, err := s.ServiceStore.Get(q.ScopeID); err == nil {
+			return svc.OrgID
+		}
+	case quotas.ScopeServiceAccount:
+		if sa, err := s.ServiceAccountStore.Get(q.ScopeID); err == nil {
+			return sa.OrgID
+		}
+	}
+	return ""
+}
+
+// CreateQuota handles POST /v1/quotas.
+//
+// @Summary      Create quota
+// @Description  Attach a request or token limit to an org, service or service account. Quotas are enforced together with each key's own rate limit; the most restrictive wins. Org-scoped callers can only attach quotas to their own org and its services and service accounts.
+// @Tags         quotas
+// @Accept       json
+// @Produce      json
+// @Param        body  body      quotas.Quota   true  "Quota to create"
+// @Success      201   {object}  quotas.Quota
+// @Failure      400   {object}  ErrorResponse  "invalid scope, scope_id, service, metric, period or limit"
+// @Failure      403   {object}  ErrorResponse  "missing permission"
+// @Failure      404   {object}  ErrorResponse  "service or service account not found"
+// @Failure      409   {object}  ErrorResponse  "quota already exists"
+// @Failure      500   {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/quotas [post]
+func (s *Server) CreateQuota(w http.ResponseWriter, r *http.Request) {
+	var q quotas.Quota
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		writeError(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if field := q.Validate(); field != "" {
+		writeError(w, "invalid "+field, http.StatusBadRequest)
+		return
+	}
+	org, ok := callerOrg(r)
+	if !ok {
+		writeNoOrg(w)
+		return
+	}
+	if org != "" {
+		// Org-scoped callers can only limit their own org's traffic.
+		switch q.Scope {
+		case quotas.ScopeOrg:
+			q.ScopeID = org
+		case quotas.ScopeService:
+			if s.quotaOrg(q) != org {
+				writeError(w, "service not found", http.StatusNotFound)
+				return
+			}
+		case quotas.ScopeServiceAccount:
+			if s.quotaOrg(q) != org {
+				writeError(w, "service account not found", http.StatusNotFound)
+				return
+			}
+		}
+		if q.Service != "" {
+			if svc, err := s.ServiceStore.Get(q.Service); err != nil || svc.OrgID != org {
+				writeError(w, "service not found", http.StatusNotFound)
+				return
+			}
+		}
+	}
+	if q.ID == "" {
+		q.ID = utils.GenerateID()
+	}
+	if err := s.QuotaStore.Create(q, events.QuotaCreated{QuotaID: q.ID, OrgID: s.quotaOrg(q), Meta: meta(r, nil, q)}); err != nil {
+		switch err {
+		case quotas.ErrQuotaExists:
+			writeError(w, "quota already exists", http.StatusConflict)
+		default:
+			writeError(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+	logging.Logger.Info().Str("quota_id", q.ID).Str("scope", q.Scope).Str("scope_id", q.ScopeID).Msg("created quota")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(q)
+}
+
+// ListQuotas handles GET /v1/quotas and returns the quotas of the caller's
+// org with their current consumption.
+//
+// @Summary      List quotas
+// @Tags         quotas
+// @Produce      json
+// @Success      200  {array}   quotaStatus
+// @Failure      403  {object}  ErrorResponse  "missing permission"
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/quotas [get]
+func (s *Server) ListQuotas(w http.ResponseWriter, r *http.Request) {
+	list := s.QuotaStore.List()
+	out := make([]quotaStatus, 0, len(list))
+	for _, q := range list {
+		if !owns(r, s.quotaOrg(q)) {
+			continue
+		}
+		out = append(out, s.quotaStatusOf(r, q))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// GetQuota handles GET /v1/quotas/{id}.
+//
+// @Summary      Get quota
+// @Tags         quotas
+// @Produce      json
+// @Param        id   path      string  true  "Quota ID"
+// @Success      200  {object}  quotaStatus
+// @Failure      403  {object}  ErrorResponse  "missing permission"
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/quotas/{id} [get]
+func (s *Server) GetQuota(w http.ResponseWriter, r *http.Request) {
+	q, err := s.QuotaStore.Get(chi.URLParam(r, "id"))
+	if err == nil && !owns(r, s.quotaOrg(q)) {
+		err = quotas.ErrQuotaNotFound
+	}
+	if err != nil {
+		switch err {
+		case quotas.ErrQuotaNotFound:
+			writeError(w, "not found", http.StatusNotFound)
+		default:
+			writeError(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.quotaStatusOf(r, q))
+}
+
+// DeleteQuota handles DELETE /v1/quotas/{id}.
+//
+// @Summary      Delete quota
+// @Tags         quotas
+// @Param        id   path      string  true  "Quota ID"
+// @Success      204
+// @Failure      403  {object}  ErrorResponse  "missing permission"
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/quotas/{id} [delete]
+func (s *Server) DeleteQuota(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	before, err := s.QuotaStore.Get(id)
+	if err == nil && !owns(r, s.quotaOrg(before)) {
+		err = quotas.ErrQuotaNotFound
+	}
+	if err == nil {
+		err = s.QuotaStore.Delete(id, events.QuotaDeleted{QuotaID: id, OrgID: s.quotaOrg(before), Meta: meta(r, before, nil)})
+	}
+	if err != nil {
+		switch err {
+		case quotas.ErrQuotaNotFound:
+			writeError(w, "not found", http.StatusNotFound)
+		default:
+			writeError(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+	logging.Logger.Info().Str("quota_id", id).Msg("deleted quota")
+	w.WriteHeader(http.StatusNoContent)
+}
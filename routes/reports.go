@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/reports"
+)
+
+// GetOrgReport handles GET /v1/orgs/{id}/reports/{period}. Reports of ended
+// periods are stored once generated; the current period is generated on
+// every request.
+//
+// @Summary      Get chargeback report
+// @Description  The organization's usage for a calendar month (UTC), totalled by service, model, key owner, key label and key, with costs from service token prices. Keys are charged to their owner, or their service account, or (unassigned).
+// @Tags         reports
+// @Produce      json
+// @Produce      text/csv
+// @Param        id      path      string  true   "Organization ID"
+// @Param        period  path      string  true   "Billing period (YYYY-MM)"
+// @Param        format  query     string  false  "json (default) or csv"
+// @Success      200  {object}  reports.Report
+// @Failure      400  {object}  ErrorResponse  "invalid period or format, or period not started"
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/orgs/{id}/reports/{period} [get]
+func (s *Server) GetOrgReport(w http.ResponseWriter, r *http.Request) {
+	period := chi.URLParam(r, "period")
+	from, _, err := reports.ParsePeriod(period)
+	if err != nil {
+		writeError(w, "invalid period", http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = "json"
+	case "json", "csv":
+	default:
+		writeError(w, "invalid format", http.StatusBadRequest)
+		return
+	}
+	now := time.Now().UTC()
+	if now.Before(from) {
+		writeError(w, "period not started", http.StatusBadRequest)
+		return
+	}
+	orgID, ok := s.scopedOrg(w, r)
+	if !ok {
+		return
+	}
+
+	rep, err := s.ReportStore.Get(orgID, period)
+	if err != nil && err != reports.ErrReportNotFound {
+		writeError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || !rep.Final {
+		if rep, err = reports.Generate(s.UsageStore, s.KeyStore, orgID, period, now); err != nil {
+			writeError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if rep.Final {
+			if err := s.ReportStore.Put(rep); err != nil {
+				logging.Logger.Error().Err(err).Str("org_id", orgID).Str("period", period).Msg("store report")
+			}
+		}
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="report-%s-%s.csv"`, orgID, period))
+		if err := reports.WriteCSV(w, rep); err != nil {
+			logging.Logger.Error().Err(err).Str("org_id", orgID).Msg("write report")
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
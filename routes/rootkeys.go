@@ -6,6 +6,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/farovictor/bifrost/pkg/events"
 	"github.com/farovictor/bifrost/pkg/logging"
 	"github.com/farovictor/bifrost/pkg/rootkeys"
 )
@@ -19,6 +20,7 @@ import (
 // @Param        body  body      rootkeys.RootKey  true  "Root key to create"
 // @Success      201   {object}  rootkeys.RootKey
 // @Failure      400   {object}  ErrorResponse
+// @Failure      403   {object}  ErrorResponse  "missing permission"
 // @Failure      409   {object}  ErrorResponse  "root key already exists"
 // @Failure      500   {object}  ErrorResponse
 // @Security     ApiKeyAuth
@@ -34,9 +36,19 @@ func (s *Server) CreateRootKey(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "id and api_key are required", http.StatusBadRequest)
 		return
 	}
+	// Root keys belong to the caller's org; callers not scoped to an org may
+	// name one.
+	org, ok := callerOrg(r)
+	if !ok {
+		writeNoOrg(w)
+		return
+	}
+	if org != "" {
+		k.OrgID = org
+	}
 	// Capture hint before the store encrypts and clears APIKey.
 	plaintext := k.APIKey
-	if err := s.RootKeyStore.Create(k); err != nil {
+	if err := s.RootKeyStore.Create(k, events.RootKeyCreated{RootKeyID: k.ID, OrgID: k.OrgID, Meta: meta(r, nil, k)}); err != nil {
 		switch err {
 		case rootkeys.ErrKeyExists:
 			writeError(w, "root key already exists", http.StatusConflict)
@@ -55,19 +67,30 @@ func (s *Server) CreateRootKey(w http.ResponseWriter, r *http.Request) {
 	}{ID: k.ID, APIKey: plaintext})
 }
 
-// ListRootKeys handles GET /rootkeys and returns all root keys.
+// ListRootKeys handles GET /rootkeys and returns the root keys of the
+// caller's org.
 //
 // @Summary      List root keys
 // @Tags         root-keys
 // @Produce      json
 // @Success      200  {array}   rootkeys.RootKey
+// @Failure      403  {object}  ErrorResponse  "missing permission"
 // @Failure      500  {object}  ErrorResponse
 // @Security     ApiKeyAuth
 // @Security     BearerAuth
 // @Router       /v1/rootkeys [get]
 func (s *Server) ListRootKeys(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(s.RootKeyStore.List())
+	list := s.RootKeyStore.List()
+	org, ok := callerOrg(r)
+	if !ok {
+		writeNoOrg(w)
+		return
+	}
+	if org != "" {
+		list = s.RootKeyStore.ListByOrg(org)
+	}
+	json.NewEncoder(w).Encode(list)
 }
 
 // DeleteRootKey handles DELETE /rootkeys/{id} to remove a root key.
@@ -76,6 +99,7 @@ func (s *Server) ListRootKeys(w http.ResponseWriter, r *http.Request) {
 // @Tags         root-keys
 // @Param        id   path      string  true  "Root key ID"
 // @Success      204
+// @Failure      403  {object}  ErrorResponse  "missing permission"
 // @Failure      404  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Security     ApiKeyAuth
@@ -83,7 +107,14 @@ func (s *Server) ListRootKeys(w http.ResponseWriter, r *http.Request) {
 // @Router       /v1/rootkeys/{id} [delete]
 func (s *Server) DeleteRootKey(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	if err := s.RootKeyStore.Delete(id); err != nil {
+	before, err := s.RootKeyStore.Get(id)
+	if err == nil && !owns(r, before.OrgID) {
+		err = rootkeys.ErrKeyNotFound
+	}
+	if err == nil {
+		err = s.RootKeyStore.Delete(id, events.RootKeyDeleted{RootKeyID: id, OrgID: before.OrgID, Meta: meta(r, before, nil)})
+	}
+	if err != nil {
 		switch err {
 		case rootkeys.ErrKeyNotFound:
 			writeError(w, "not found", http.StatusNotFound)
@@ -106,6 +137,7 @@ func (s *Server) DeleteRootKey(w http.ResponseWriter, r *http.Request) {
 // @Param        body  body      rootkeys.RootKey  true  "Updated root key"
 // @Success      200   {object}  rootkeys.RootKey
 // @Failure      400   {object}  ErrorResponse  "invalid request or id mismatch"
+// @Failure      403   {object}  ErrorResponse  "missing permission"
 // @Failure      404   {object}  ErrorResponse
 // @Failure      500   {object}  ErrorResponse
 // @Security     ApiKeyAuth
@@ -124,7 +156,15 @@ func (s *Server) UpdateRootKey(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "id mismatch", http.StatusBadRequest)
 		return
 	}
-	if err := s.RootKeyStore.Update(k); err != nil {
+	before, err := s.RootKeyStore.Get(id)
+	if err == nil && !owns(r, before.OrgID) {
+		err = rootkeys.ErrKeyNotFound
+	}
+	if err == nil {
+		k.OrgID = before.OrgID
+		err = s.RootKeyStore.Update(k, events.RootKeyRotated{RootKeyID: k.ID, OrgID: k.OrgID, Meta: meta(r, before, k)})
+	}
+	if err != nil {
 		switch err {
 		case rootkeys.ErrKeyNotFound:
 			writeError(w, "not found", http.StatusNotFound)
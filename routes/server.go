@@ -4,13 +4,21 @@ import (
 	"encoding/json"
 	"net/http"
 
+	rl "github.com/farovictor/bifrost/middlewares"
+	"github.com/farovictor/bifrost/pkg/anomaly"
+	"github.com/farovictor/bifrost/pkg/audit"
+	"github.com/farovictor/bifrost/pkg/events"
 	"github.com/farovictor/bifrost/pkg/keys"
 	"github.com/farovictor/bifrost/pkg/orgs"
+	"github.com/farovictor/bifrost/pkg/quotas"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+	"github.com/farovictor/bifrost/pkg/reports"
 	"github.com/farovictor/bifrost/pkg/rootkeys"
 	"github.com/farovictor/bifrost/pkg/serviceaccounts"
 	"github.com/farovictor/bifrost/pkg/services"
 	"github.com/farovictor/bifrost/pkg/usage"
 	"github.com/farovictor/bifrost/pkg/users"
+	"github.com/farovictor/bifrost/pkg/webhooks"
 )
 
 // Server holds all store dependencies for HTTP handlers.
@@ -23,6 +31,60 @@ type Server struct {
 	MembershipStore     orgs.MembershipStore
 	UsageStore          usage.Store
 	ServiceAccountStore serviceaccounts.Store
+	QuotaStore          quotas.Store
+	AnomalyStore        anomaly.Store
+	ReportStore         reports.Store
+	// Limiter is the rate limiter backend, used to report quota consumption.
+	Limiter ratelimit.Limiter
+	// RateLimitHealthCheck reports whether Limiter's backend is reachable.
+	RateLimitHealthCheck *ratelimit.Health
+	// Adaptive holds admission state for throttling upstreams, if enabled.
+	Adaptive *ratelimit.Adaptive
+	// UsageStream delivers usage events as they are recorded to live
+	// subscribers. When nil the usage stream is unavailable.
+	UsageStream *usage.Broadcaster
+	// WebhookStore holds org webhooks and their delivery log.
+	WebhookStore webhooks.Store
+	// Webhooks queues events for delivery to WebhookStore's webhooks. When
+	// nil no events are sent.
+	Webhooks *webhooks.Dispatcher
+	// AuditStore records management actions. When nil nothing is recorded.
+	AuditStore audit.Store
+	// Events carries domain events published by the stores to their
+	// subscribers. When nil events are discarded.
+	Events *events.Bus
+}
+
+// AttachEvents makes the stores of s that publish events publish them on
+// s.Events.
+func (s *Server) AttachEvents() {
+	events.Attach(s.Events, s.KeyStore, s.RootKeyStore, s.ServiceStore, s.ServiceAccountStore,
+		s.UserStore, s.OrgStore, s.MembershipStore, s.QuotaStore, s.WebhookStore, s.AnomalyStore)
+}
+
+// callerOrg returns the organization named by the token of the user making
+// r, or "" when the caller sees every org. ok is false for a caller whose
+// token names no org but who may not see every org; such callers are
+// refused.
+func callerOrg(r *http.Request) (org string, ok bool) {
+	oc := rl.OrgFromContext(r.Context())
+	if oc.OrgID == "" && !oc.AllOrgs() {
+		return "", false
+	}
+	return oc.OrgID, true
+}
+
+// owns reports whether the caller making r may see a resource owned by
+// orgID. Resources of other orgs are reported as not found.
+func owns(r *http.Request, orgID string) bool {
+	org, ok := callerOrg(r)
+	return ok && (org == "" || org == orgID)
+}
+
+// writeNoOrg refuses a caller whose token names no org and who may not see
+// every org.
+func writeNoOrg(w http.ResponseWriter) {
+	writeError(w, "forbidden", http.StatusForbidden)
 }
 
 // ErrorResponse is the standard error body returned by all endpoints.
@@ -6,6 +6,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/farovictor/bifrost/pkg/events"
 	"github.com/farovictor/bifrost/pkg/serviceaccounts"
 	"github.com/farovictor/bifrost/pkg/utils"
 )
@@ -19,6 +20,7 @@ import (
 // @Param        body  body      serviceaccounts.ServiceAccount  true  "Service account to create"
 // @Success      201   {object}  serviceaccounts.ServiceAccount
 // @Failure      400   {object}  ErrorResponse
+// @Failure      403   {object}  ErrorResponse  "missing permission"
 // @Failure      409   {object}  ErrorResponse  "service account already exists"
 // @Failure      500   {object}  ErrorResponse
 // @Security     ApiKeyAuth
@@ -40,11 +42,21 @@ func (s *Server) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
 	if sa.APIKey == "" {
 		sa.APIKey = "sa-" + utils.GenerateID()
 	}
+	// Accounts belong to the caller's org; callers not scoped to an org may
+	// name one.
+	org, ok := callerOrg(r)
+	if !ok {
+		writeNoOrg(w)
+		return
+	}
+	if org != "" {
+		sa.OrgID = org
+	}
 	if sa.AllowedServices == nil {
 		sa.AllowedServices = serviceaccounts.StringList{}
 	}
 
-	if err := s.ServiceAccountStore.Create(sa); err != nil {
+	if err := s.ServiceAccountStore.Create(sa, events.ServiceAccountCreated{ServiceAccountID: sa.ID, OrgID: sa.OrgID, Meta: meta(r, nil, sa)}); err != nil {
 		switch err {
 		case serviceaccounts.ErrServiceAccountExists:
 			writeError(w, "service account already exists", http.StatusConflict)
@@ -65,12 +77,21 @@ func (s *Server) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
 // @Tags         service-accounts
 // @Produce      json
 // @Success      200  {array}   serviceaccounts.ServiceAccount
+// @Failure      403  {object}  ErrorResponse  "missing permission"
 // @Failure      500  {object}  ErrorResponse
 // @Security     ApiKeyAuth
 // @Security     BearerAuth
 // @Router       /v1/serviceaccounts [get]
 func (s *Server) ListServiceAccounts(w http.ResponseWriter, r *http.Request) {
 	list := s.ServiceAccountStore.List()
+	org, ok := callerOrg(r)
+	if !ok {
+		writeNoOrg(w)
+		return
+	}
+	if org != "" {
+		list = s.ServiceAccountStore.ListByOrg(org)
+	}
 	if list == nil {
 		list = []serviceaccounts.ServiceAccount{}
 	}
@@ -84,6 +105,7 @@ func (s *Server) ListServiceAccounts(w http.ResponseWriter, r *http.Request) {
 // @Tags         service-accounts
 // @Param        id   path      string  true  "Service account ID"
 // @Success      204
+// @Failure      403  {object}  ErrorResponse  "missing permission"
 // @Failure      404  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Security     ApiKeyAuth
@@ -91,7 +113,14 @@ func (s *Server) ListServiceAccounts(w http.ResponseWriter, r *http.Request) {
 // @Router       /v1/serviceaccounts/{id} [delete]
 func (s *Server) DeleteServiceAccount(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	if err := s.ServiceAccountStore.Delete(id); err != nil {
+	before, err := s.ServiceAccountStore.Get(id)
+	if err == nil && !owns(r, before.OrgID) {
+		err = serviceaccounts.ErrServiceAccountNotFound
+	}
+	if err == nil {
+		err = s.ServiceAccountStore.Delete(id, events.ServiceAccountDeleted{ServiceAccountID: id, OrgID: before.OrgID, Meta: meta(r, before, nil)})
+	}
+	if err != nil {
 		switch err {
 		case serviceaccounts.ErrServiceAccountNotFound:
 			writeError(w, "not found", http.StatusNotFound)
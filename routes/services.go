@@ -6,7 +6,9 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/farovictor/bifrost/pkg/events"
 	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
 	"github.com/farovictor/bifrost/pkg/rootkeys"
 	"github.com/farovictor/bifrost/pkg/services"
 )
@@ -19,7 +21,8 @@ import (
 // @Produce      json
 // @Param        body  body      services.Service  true  "Service to create"
 // @Success      201   {object}  services.Service
-// @Failure      400   {object}  ErrorResponse
+// @Failure      400   {object}  ErrorResponse  "invalid request, tokens_per_minute, max_concurrent, or token price"
+// @Failure      403   {object}  ErrorResponse  "missing permission"
 // @Failure      404   {object}  ErrorResponse  "root key not found"
 // @Failure      409   {object}  ErrorResponse  "service already exists"
 // @Failure      500   {object}  ErrorResponse
@@ -32,7 +35,39 @@ func (s *Server) CreateService(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "invalid request", http.StatusBadRequest)
 		return
 	}
-	if _, err := s.RootKeyStore.Get(svc.RootKeyID); err != nil {
+	if svc.TokensPerMinute < 0 {
+		writeError(w, "invalid tokens_per_minute", http.StatusBadRequest)
+		return
+	}
+	if svc.MaxConcurrent < 0 {
+		writeError(w, "invalid max_concurrent", http.StatusBadRequest)
+		return
+	}
+	if svc.PromptTokenPrice < 0 || svc.CompletionTokenPrice < 0 {
+		writeError(w, "invalid token price", http.StatusBadRequest)
+		return
+	}
+	// Services belong to the caller's org. Callers not scoped to an org may
+	// name one, and otherwise the root key's org is used.
+	org, ok := callerOrg(r)
+	if !ok {
+		writeNoOrg(w)
+		return
+	}
+	if org != "" {
+		svc.OrgID = org
+	}
+	rk, err := s.RootKeyStore.Get(svc.RootKeyID)
+	if err == nil && !owns(r, rk.OrgID) {
+		err = rootkeys.ErrKeyNotFound
+	}
+	if err == nil && svc.OrgID == "" {
+		svc.OrgID = rk.OrgID
+	}
+	if err == nil && rk.OrgID != svc.OrgID {
+		err = rootkeys.ErrKeyNotFound
+	}
+	if err != nil {
 		if err == rootkeys.ErrKeyNotFound {
 			writeError(w, "root key not found", http.StatusNotFound)
 			return
@@ -40,7 +75,7 @@ func (s *Server) CreateService(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	if err := s.ServiceStore.Create(svc); err != nil {
+	if err := s.ServiceStore.Create(svc, events.ServiceCreated{ServiceID: svc.ID, OrgID: svc.OrgID, RootKeyID: svc.RootKeyID, Meta: meta(r, nil, svc)}); err != nil {
 		switch err {
 		case services.ErrServiceExists:
 			writeError(w, "service already exists", http.StatusConflict)
@@ -55,19 +90,30 @@ func (s *Server) CreateService(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(svc)
 }
 
-// ListServices handles GET /services and returns all services.
+// ListServices handles GET /services and returns the services of the
+// caller's org.
 //
 // @Summary      List services
 // @Tags         services
 // @Produce      json
 // @Success      200  {array}   services.Service
+// @Failure      403  {object}  ErrorResponse  "missing permission"
 // @Failure      500  {object}  ErrorResponse
 // @Security     ApiKeyAuth
 // @Security     BearerAuth
 // @Router       /v1/services [get]
 func (s *Server) ListServices(w http.ResponseWriter, r *http.Request) {
+	list := s.ServiceStore.List()
+	org, ok := callerOrg(r)
+	if !ok {
+		writeNoOrg(w)
+		return
+	}
+	if org != "" {
+		list = s.ServiceStore.ListByOrg(org)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(s.ServiceStore.List())
+	json.NewEncoder(w).Encode(list)
 }
 
 // UpdateService handles PUT /services/{id} to replace a service.
@@ -79,7 +125,8 @@ func (s *Server) ListServices(w http.ResponseWriter, r *http.Request) {
 // @Param        id    path      string            true  "Service ID"
 // @Param        body  body      services.Service  true  "Updated service"
 // @Success      200   {object}  services.Service
-// @Failure      400   {object}  ErrorResponse  "invalid request or id mismatch"
+// @Failure      400   {object}  ErrorResponse  "invalid request, id mismatch, tokens_per_minute, max_concurrent, or token price"
+// @Failure      403   {object}  ErrorResponse  "missing permission"
 // @Failure      404   {object}  ErrorResponse  "service or root key not found"
 // @Failure      500   {object}  ErrorResponse
 // @Security     ApiKeyAuth
@@ -96,8 +143,38 @@ func (s *Server) UpdateService(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "id mismatch", http.StatusBadRequest)
 		return
 	}
+	if svc.TokensPerMinute < 0 {
+		writeError(w, "invalid tokens_per_minute", http.StatusBadRequest)
+		return
+	}
+	if svc.MaxConcurrent < 0 {
+		writeError(w, "invalid max_concurrent", http.StatusBadRequest)
+		return
+	}
+	if svc.PromptTokenPrice < 0 || svc.CompletionTokenPrice < 0 {
+		writeError(w, "invalid token price", http.StatusBadRequest)
+		return
+	}
+	before, err := s.ServiceStore.Get(id)
+	if err == nil && !owns(r, before.OrgID) {
+		err = services.ErrServiceNotFound
+	}
+	if err != nil {
+		if err == services.ErrServiceNotFound {
+			writeError(w, "not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	// A service stays in its org; a new root key must belong to it too.
+	svc.OrgID = before.OrgID
 	if svc.RootKeyID != "" {
-		if _, err := s.RootKeyStore.Get(svc.RootKeyID); err != nil {
+		rk, err := s.RootKeyStore.Get(svc.RootKeyID)
+		if err == nil && rk.OrgID != svc.OrgID {
+			err = rootkeys.ErrKeyNotFound
+		}
+		if err != nil {
 			if err == rootkeys.ErrKeyNotFound {
 				writeError(w, "root key not found", http.StatusNotFound)
 				return
@@ -106,7 +183,7 @@ func (s *Server) UpdateService(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	if err := s.ServiceStore.Update(svc); err != nil {
+	if err := s.ServiceStore.Update(svc, events.ServiceUpdated{ServiceID: id, OrgID: svc.OrgID, RootKeyID: svc.RootKeyID, Meta: meta(r, before, svc)}); err != nil {
 		switch err {
 		case services.ErrServiceNotFound:
 			writeError(w, "not found", http.StatusNotFound)
@@ -126,6 +203,7 @@ func (s *Server) UpdateService(w http.ResponseWriter, r *http.Request) {
 // @Tags         services
 // @Param        id   path      string  true  "Service ID"
 // @Success      204
+// @Failure      403  {object}  ErrorResponse  "missing permission"
 // @Failure      404  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Security     ApiKeyAuth
@@ -133,7 +211,14 @@ func (s *Server) UpdateService(w http.ResponseWriter, r *http.Request) {
 // @Router       /v1/services/{id} [delete]
 func (s *Server) DeleteService(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	if err := s.ServiceStore.Delete(id); err != nil {
+	before, err := s.ServiceStore.Get(id)
+	if err == nil && !owns(r, before.OrgID) {
+		err = services.ErrServiceNotFound
+	}
+	if err == nil {
+		err = s.ServiceStore.Delete(id, events.ServiceDeleted{ServiceID: id, OrgID: before.OrgID, Meta: meta(r, before, nil)})
+	}
+	if err != nil {
 		switch err {
 		case services.ErrServiceNotFound:
 			writeError(w, "not found", http.StatusNotFound)
@@ -145,3 +230,37 @@ func (s *Server) DeleteService(w http.ResponseWriter, r *http.Request) {
 	logging.Logger.Info().Str("service_id", id).Msg("deleted service")
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// GetServiceAdaptive handles GET /services/{id}/adaptive and reports how
+// admission to the service is currently reduced because its upstream is
+// returning 429s, per root key. An empty list means no throttling.
+//
+// @Summary      Get adaptive limiting state
+// @Tags         services
+// @Produce      json
+// @Param        id   path      string  true  "Service ID"
+// @Success      200  {array}   ratelimit.AdaptiveState
+// @Failure      403  {object}  ErrorResponse  "missing permission"
+// @Failure      404  {object}  ErrorResponse  "not found"
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/services/{id}/adaptive [get]
+func (s *Server) GetServiceAdaptive(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if svc, err := s.ServiceStore.Get(id); err != nil || !owns(r, svc.OrgID) {
+		switch err {
+		case nil, services.ErrServiceNotFound:
+			writeError(w, "not found", http.StatusNotFound)
+		default:
+			writeError(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+	states := []ratelimit.AdaptiveState{}
+	if s.Adaptive != nil {
+		states = s.Adaptive.States(id)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(states)
+}
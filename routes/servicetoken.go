@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/farovictor/bifrost/pkg/audit"
+	"github.com/farovictor/bifrost/pkg/events"
 	"github.com/farovictor/bifrost/pkg/keys"
 	"github.com/farovictor/bifrost/pkg/serviceaccounts"
 	"github.com/farovictor/bifrost/pkg/services"
@@ -83,8 +85,12 @@ func (s *Server) ServiceToken(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Verify the service exists.
-	if _, err := s.ServiceStore.Get(req.Service); err != nil {
+	// Verify the service exists in the account's org.
+	svc, err := s.ServiceStore.Get(req.Service)
+	if err == nil && svc.OrgID != sa.OrgID {
+		err = services.ErrServiceNotFound
+	}
+	if err != nil {
 		if err == services.ErrServiceNotFound {
 			writeError(w, "service not found", http.StatusNotFound)
 			return
@@ -104,15 +110,19 @@ func (s *Server) ServiceToken(w http.ResponseWriter, r *http.Request) {
 
 	expiresAt := time.Now().Add(time.Duration(ttl) * time.Second)
 	k := keys.VirtualKey{
-		ID:        fmt.Sprintf("vk-sa-%d", time.Now().UnixNano()),
-		Target:    req.Service,
-		Scope:     keys.ScopeWrite,
-		RateLimit: rateLimit,
-		ExpiresAt: expiresAt,
-		Source:    keys.SourceServiceAccount,
+		ID:               fmt.Sprintf("vk-sa-%d", time.Now().UnixNano()),
+		Target:           req.Service,
+		Scope:            keys.ScopeWrite,
+		RateLimit:        rateLimit,
+		ExpiresAt:        expiresAt,
+		Source:           keys.SourceServiceAccount,
+		ServiceAccountID: sa.ID,
+		OrgID:            sa.OrgID,
 	}
 
-	if err := s.KeyStore.Create(k); err != nil {
+	created := events.KeyCreated{KeyID: k.ID, OrgID: k.OrgID, Target: k.Target, Scope: k.Scope, ExpiresAt: k.ExpiresAt, Meta: meta(r, nil, k)}
+	created.ActorType, created.Actor = audit.ActorServiceAccount, sa.ID
+	if err := s.KeyStore.Create(k, created); err != nil {
 		writeError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/farovictor/bifrost/config"
+	"github.com/farovictor/bifrost/pkg/events"
 	"github.com/farovictor/bifrost/pkg/orgs"
 	"github.com/farovictor/bifrost/pkg/users"
 	"github.com/farovictor/bifrost/pkg/utils"
@@ -82,7 +83,12 @@ func (s *Server) Setup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	m := orgs.Membership{UserID: u.ID, OrgID: o.ID, Role: orgs.RoleOwner}
-	if err := s.MembershipStore.Create(m); err != nil {
+	done := events.SetupCompleted{UserID: u.ID, OrgID: o.ID, Meta: meta(r, nil, struct {
+		User users.User        `json:"user"`
+		Org  orgs.Organization `json:"org"`
+	}{u, o})}
+	done.Actor = u.ID
+	if err := s.MembershipStore.Create(m, done); err != nil {
 		writeError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,300 @@
+package routes
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/export"
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+// usageSummaryResponse is the envelope returned by the usage summary endpoint.
+type usageSummaryResponse struct {
+	GroupBy []string           `json:"group_by"`
+	Bucket  string             `json:"bucket,omitempty"`
+	Rows    []usage.SummaryRow `json:"rows"`
+}
+
+// GetUsageSummary handles GET /v1/usage/summary. It aggregates usage events
+// into one row per combination of the requested grouping dimensions.
+//
+// @Summary      Summarise usage
+// @Description  Groups usage events by any of org, service, key, source, model, status_class and time, returning request counts, error rates, latency percentiles and token and cost sums. Setting bucket groups by time. Callers only see events of their own organization.
+// @Tags         usage
+// @Produce      json
+// @Param        group_by  query     string  false  "Comma-separated dimensions: org, service, key, source, model, status_class, time"
+// @Param        bucket    query     string  false  "Time bucket: hour, day or month"
+// @Param        from      query     string  false  "Start time (RFC3339)"
+// @Param        to        query     string  false  "End time (RFC3339)"
+// @Param        org_id    query     string  false  "Only events of this organization; must be the caller's"
+// @Param        service   query     string  false  "Only events of this service"
+// @Param        key_id    query     string  false  "Only events of this virtual key"
+// @Success      200  {object}  usageSummaryResponse
+// @Failure      400  {object}  ErrorResponse  "invalid group_by, bucket, from or to"
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/usage/summary [get]
+func (s *Server) GetUsageSummary(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := usage.SummaryQuery{
+		OrgID:   params.Get("org_id"),
+		Service: params.Get("service"),
+		KeyID:   params.Get("key_id"),
+		Bucket:  params.Get("bucket"),
+	}
+	org, ok := callerOrg(r)
+	if !ok {
+		writeNoOrg(w)
+		return
+	}
+	if org != "" {
+		if q.OrgID != "" && q.OrgID != org {
+			writeError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		q.OrgID = org
+	}
+	if v := params.Get("group_by"); v != "" {
+		for _, g := range strings.Split(v, ",") {
+			q.GroupBy = append(q.GroupBy, strings.TrimSpace(g))
+		}
+	}
+	if q.Bucket != "" && !slices.Contains(q.GroupBy, usage.GroupTime) {
+		q.GroupBy = append(q.GroupBy, usage.GroupTime)
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		if v := params.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, "invalid "+p.name+": use RFC3339", http.StatusBadRequest)
+				return
+			}
+			*p.dst = t
+		}
+	}
+
+	rows, err := s.UsageStore.Summary(q)
+	if err != nil {
+		if errors.Is(err, usage.ErrInvalidGroup) {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if q.GroupBy == nil {
+		q.GroupBy = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usageSummaryResponse{GroupBy: q.GroupBy, Bucket: q.Bucket, Rows: rows})
+}
+
+// ExportUsage handles GET /v1/usage/export. It streams the matching usage
+// events straight from the store, so exports of any size use bounded memory.
+//
+// @Summary      Export usage events
+// @Description  Streams usage events, oldest first, as CSV, JSON lines or Parquet. Every format has the same columns in the same order; see the API documentation for the schema. Callers only receive events of their own organization.
+// @Tags         usage
+// @Produce      text/csv
+// @Produce      application/x-ndjson
+// @Produce      application/vnd.apache.parquet
+// @Param        format   query     string  false  "csv (default), jsonl or parquet"
+// @Param        from     query     string  false  "Start time (RFC3339, inclusive)"
+// @Param        to       query     string  false  "End time (RFC3339, exclusive)"
+// @Param        org      query     string  false  "Only events of this organization; must be the caller's"
+// @Param        service  query     string  false  "Only events of this service"
+// @Success      200  {file}    file
+// @Failure      400  {object}  ErrorResponse  "invalid format, from or to"
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/usage/export [get]
+func (s *Server) ExportUsage(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	format := params.Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if err := export.Check(format); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := usage.ExportQuery{OrgID: params.Get("org"), Service: params.Get("service")}
+	org, ok := callerOrg(r)
+	if !ok {
+		writeNoOrg(w)
+		return
+	}
+	if org != "" {
+		if q.OrgID != "" && q.OrgID != org {
+			writeError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		q.OrgID = org
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		if v := params.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, "invalid "+p.name+": use RFC3339", http.StatusBadRequest)
+				return
+			}
+			*p.dst = t
+		}
+	}
+
+	writeExport(w, "usage", format, func(out io.Writer) error {
+		return usage.Export(s.UsageStore, q, format, out)
+	})
+}
+
+// writeExport sends the export written by fn as an attachment named after
+// name and the time.
+func writeExport(w http.ResponseWriter, name, format string, fn func(io.Writer) error) {
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, name, time.Now().UTC().Format("20060102T150405Z"), format))
+
+	// Output is buffered so a failure before the first flush can still be
+	// reported as an error response.
+	sent := &countingWriter{w: w}
+	bw := bufio.NewWriterSize(sent, 32<<10)
+	err := fn(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		if sent.n == 0 {
+			w.Header().Del("Content-Disposition")
+			writeError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		logging.Logger.Error().Err(err).Str("export", name).Msg("export failed")
+	}
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// Usage stream tuning.
+const (
+	// streamBuffer is how many events may wait for a slow subscriber before
+	// events are dropped.
+	streamBuffer = 256
+	// streamHeartbeat is how often an idle stream sends a comment, keeping
+	// proxies from closing the connection.
+	streamHeartbeat = 15 * time.Second
+)
+
+// StreamUsage handles GET /v1/usage/stream. It sends usage events as
+// Server-Sent Events as they are recorded, on this and, with Redis, every
+// other instance. Callers only see events of the org in their token.
+//
+// @Summary      Stream usage events
+// @Description  Server-Sent Events stream of usage events as they are recorded. Each "usage" event carries one usage event as JSON; a "dropped" event reports how many events were skipped because the client fell behind. Callers only receive events of their own organization.
+// @Tags         usage
+// @Produce      text/event-stream
+// @Param        key      query     string  false  "Only events of this virtual key"
+// @Param        org      query     string  false  "Only events of this organization; must be the caller's"
+// @Param        service  query     string  false  "Only events of this service"
+// @Param        status   query     string  false  "Only this status code (429) or class (5xx)"
+// @Success      200  {object}  usage.Event
+// @Failure      400  {object}  ErrorResponse  "invalid status"
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
+// @Failure      503  {object}  ErrorResponse  "usage stream unavailable"
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/usage/stream [get]
+func (s *Server) StreamUsage(w http.ResponseWriter, r *http.Request) {
+	if s.UsageStream == nil {
+		writeError(w, "usage stream unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	params := r.URL.Query()
+	f := usage.StreamFilter{
+		KeyID:   params.Get("key"),
+		OrgID:   params.Get("org"),
+		Service: params.Get("service"),
+		Status:  params.Get("status"),
+	}
+	if !usage.ValidStatusFilter(f.Status) {
+		writeError(w, "invalid status: use a code such as 429 or a class such as 5xx", http.StatusBadRequest)
+		return
+	}
+	org, ok := callerOrg(r)
+	if !ok {
+		writeNoOrg(w)
+		return
+	}
+	if org != "" {
+		if f.OrgID != "" && f.OrgID != org {
+			writeError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		f.OrgID = org
+	}
+
+	sub := s.UsageStream.Subscribe(f, streamBuffer)
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	var id int64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-sub.C:
+			if n := sub.Dropped(); n > 0 {
+				fmt.Fprintf(w, "event: dropped\ndata: {\"count\":%d}\n\n", n)
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			id++
+			fmt.Fprintf(w, "id: %d\nevent: usage\ndata: %s\n\n", id, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"github.com/farovictor/bifrost/config"
+	rl "github.com/farovictor/bifrost/middlewares"
 	"github.com/farovictor/bifrost/pkg/auth"
+	"github.com/farovictor/bifrost/pkg/events"
 	"github.com/farovictor/bifrost/pkg/logging"
 	"github.com/farovictor/bifrost/pkg/orgs"
 	"github.com/farovictor/bifrost/pkg/users"
@@ -44,6 +46,7 @@ type CreateUserResponse struct {
 // @Param        body  body      CreateUserRequest  true  "User creation request"
 // @Success      201   {object}  CreateUserResponse
 // @Failure      400   {object}  ErrorResponse
+// @Failure      403   {object}  ErrorResponse  "missing permission, or org is not the caller's"
 // @Failure      404   {object}  ErrorResponse  "organization not found"
 // @Failure      409   {object}  ErrorResponse  "user already exists"
 // @Failure      500   {object}  ErrorResponse
@@ -68,6 +71,21 @@ func (s *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "invalid role", http.StatusBadRequest)
 		return
 	}
+	// Org-scoped callers may only add users to their own org.
+	org, ok := callerOrg(r)
+	if !ok {
+		writeNoOrg(w)
+		return
+	}
+	if req.OrgID != "" && org != "" && req.OrgID != org {
+		writeError(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	// Only owners may make others owners of an existing org.
+	if req.OrgID != "" && role == orgs.RoleOwner && !rl.HasPermission(r, orgs.PermMembersOwners) {
+		rl.WriteForbidden(w, orgs.PermMembersOwners)
+		return
+	}
 
 	existing, err := s.UserStore.GetByEmail(req.Email)
 	var u users.User
@@ -75,7 +93,7 @@ func (s *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 		u = existing
 	} else if err == users.ErrUserNotFound {
 		u = users.User{ID: utils.GenerateID(), Name: req.Name, Email: req.Email, APIKey: users.GenerateAPIKey()}
-		if err := s.UserStore.Create(u); err != nil {
+		if err := s.UserStore.Create(u, events.UserCreated{UserID: u.ID, OrgID: org, Meta: meta(r, nil, u)}); err != nil {
 			switch err {
 			case users.ErrUserExists:
 				writeError(w, "user already exists", http.StatusConflict)
@@ -92,7 +110,7 @@ func (s *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var orgID string
 	if req.OrgName != "" && req.OrgID == "" {
 		o := orgs.Organization{ID: utils.GenerateID(), Name: req.OrgName}
-		if err := s.OrgStore.Create(o); err != nil {
+		if err := s.OrgStore.Create(o, events.OrgCreated{OrgID: o.ID, Name: o.Name, Meta: meta(r, nil, o)}); err != nil {
 			writeError(w, "internal error", http.StatusInternalServerError)
 			return
 		}
@@ -123,7 +141,7 @@ func (s *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 		}
 
 		m := orgs.Membership{UserID: u.ID, OrgID: orgID, Role: role}
-		if err := s.MembershipStore.Create(m); err != nil {
+		if err := s.MembershipStore.Create(m, events.MemberAdded{OrgID: orgID, UserID: u.ID, Role: role, Meta: meta(r, nil, m)}); err != nil {
 			writeError(w, "internal error", http.StatusInternalServerError)
 			return
 		}
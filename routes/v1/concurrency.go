@@ -0,0 +1,74 @@
+package v1
+
+import (
+	"context"
+	"errors"
+
+	"github.com/farovictor/bifrost/config"
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/metrics"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+	"github.com/farovictor/bifrost/pkg/services"
+)
+
+// slotLimit is a max_concurrent limit that applies to a proxied request.
+type slotLimit struct {
+	key   string
+	limit int
+	level string
+}
+
+// slotLimits returns the key's and then the service's concurrency limits.
+func slotLimits(k keys.VirtualKey, svc services.Service) []slotLimit {
+	var out []slotLimit
+	if k.MaxConcurrent > 0 {
+		out = append(out, slotLimit{key: "concurrency:key:" + k.ID, limit: k.MaxConcurrent, level: ratelimit.LevelKey})
+	}
+	if svc.MaxConcurrent > 0 {
+		out = append(out, slotLimit{key: "concurrency:svc:" + svc.ID, limit: svc.MaxConcurrent, level: ratelimit.LevelService})
+	}
+	return out
+}
+
+// acquireSlots takes a slot from every limit, queueing if the Concurrency
+// allows it. On success it returns a function releasing them all. When a
+// limit stays full the slots already taken are released and the full limit
+// is returned with ok set to false. Semaphore errors admit the request so an
+// unavailable backend does not take the proxy down with it.
+func (h *Handler) acquireSlots(ctx context.Context, limits []slotLimit) (release func(), full slotLimit, ok bool) {
+	var held []func()
+	release = func() {
+		for _, r := range held {
+			r()
+		}
+	}
+	for _, sl := range limits {
+		var queued func(int)
+		if config.MetricsEnabled() {
+			g := metrics.QueuedRequests.WithLabelValues(sl.level)
+			queued = func(delta int) { g.Add(float64(delta)) }
+		}
+		r, err := h.Concurrency.Acquire(ctx, sl.key, sl.limit, queued)
+		if errors.Is(err, ratelimit.ErrConcurrencyLimited) || err != nil && ctx.Err() != nil {
+			release()
+			if config.MetricsEnabled() {
+				metrics.ConcurrencyRejectedTotal.WithLabelValues(sl.level).Inc()
+			}
+			return nil, sl, false
+		}
+		if err != nil {
+			continue
+		}
+		if config.MetricsEnabled() {
+			g := metrics.InFlightRequests.WithLabelValues(sl.level)
+			g.Inc()
+			inner := r
+			r = func() {
+				inner()
+				g.Dec()
+			}
+		}
+		held = append(held, r)
+	}
+	return release, slotLimit{}, true
+}
@@ -5,6 +5,8 @@ import (
 	"net/http"
 
 	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/quotas"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
 	"github.com/farovictor/bifrost/pkg/rootkeys"
 	"github.com/farovictor/bifrost/pkg/services"
 	"github.com/farovictor/bifrost/pkg/usage"
@@ -31,8 +33,26 @@ type Handler struct {
 	ServiceStore services.Store
 	RootKeyStore rootkeys.Store
 	UsageStore   usage.Store
+	// QuotaStore holds org, service and service account token quotas.
+	QuotaStore quotas.Store
+	// Limiter enforces tokens-per-minute limits and token quotas. When nil
+	// they are not enforced.
+	Limiter ratelimit.Limiter
+	// Concurrency enforces max_concurrent on keys and services. When nil it
+	// is not enforced.
+	Concurrency *ratelimit.Concurrency
+	// Adaptive sheds load to upstreams that are returning 429s. When nil
+	// upstream throttling is passed straight through.
+	Adaptive *ratelimit.Adaptive
+	// MaxBodyBytes caps the request bodies read to estimate their token
+	// cost; larger requests are rejected with 413. When 0,
+	// DefaultMaxBodyBytes applies.
+	MaxBodyBytes int64
 }
 
+// DefaultMaxBodyBytes is the body cap of a Handler without MaxBodyBytes.
+const DefaultMaxBodyBytes = 10 << 20
+
 func writeError(w http.ResponseWriter, message string, code int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
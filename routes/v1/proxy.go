@@ -3,6 +3,8 @@ package v1
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -10,36 +12,82 @@ import (
 	"time"
 
 	"github.com/farovictor/bifrost/config"
+	"github.com/farovictor/bifrost/pkg/events"
 	"github.com/farovictor/bifrost/pkg/keys"
 	"github.com/farovictor/bifrost/pkg/metrics"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
 	"github.com/farovictor/bifrost/pkg/rootkeys"
 	"github.com/farovictor/bifrost/pkg/services"
 	"github.com/farovictor/bifrost/pkg/usage"
 )
 
-// proxyRecorder captures the upstream response status code and optionally
-// buffers the body for token parsing, while still streaming to the client.
+// proxyRecorder captures the upstream response status code, size and time
+// of the first byte, and optionally buffers the body for token parsing, while
+// still streaming to the client.
 type proxyRecorder struct {
 	http.ResponseWriter
 	code      int
 	body      bytes.Buffer
 	trackBody bool
+	bytes     int64
+	firstByte time.Time
 }
 
 func (r *proxyRecorder) WriteHeader(code int) {
+	if r.firstByte.IsZero() {
+		r.firstByte = time.Now()
+	}
 	r.code = code
 	r.ResponseWriter.WriteHeader(code)
 }
 
 func (r *proxyRecorder) Write(b []byte) (int, error) {
+	if r.firstByte.IsZero() {
+		r.firstByte = time.Now()
+	}
 	if r.trackBody {
 		r.body.Write(b)
 	}
-	return r.ResponseWriter.Write(b)
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// maxRequestHead is how much of a request body is kept to find its model.
+const maxRequestHead = 64 << 10
+
+// requestBody counts the bytes of a request body read by the upstream
+// transport and keeps up to maxRequestHead of them.
+type requestBody struct {
+	io.ReadCloser
+	n    int64
+	head bytes.Buffer
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if room := maxRequestHead - b.head.Len(); room > 0 {
+		b.head.Write(p[:min(n, room)])
+	}
+	return n, err
+}
+
+// model returns the model named in a JSON request body, if it was read whole.
+func (b *requestBody) model() string {
+	if b.n == 0 || b.n > maxRequestHead {
+		return ""
+	}
+	var req struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(b.head.Bytes(), &req) //nolint:errcheck
+	return req.Model
 }
 
 // upstreamUsage is the subset of an OpenAI-compatible response body we care about.
 type upstreamUsage struct {
+	Model string `json:"model"`
 	Usage struct {
 		PromptTokens     int `json:"prompt_tokens"`
 		CompletionTokens int `json:"completion_tokens"`
@@ -50,6 +98,7 @@ type upstreamUsage struct {
 // Proxy forwards the request to the target service determined by the provided
 // virtual key. The key should be supplied via the X-Virtual-Key header.
 func (h *Handler) Proxy(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	keyID := r.Header.Get("X-Virtual-Key")
 	r.Header.Del("X-Virtual-Key")
 	if keyID == "" {
@@ -76,18 +125,40 @@ func (h *Handler) Proxy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if time.Now().After(k.ExpiresAt) {
-		writeError(w, "key expired", http.StatusUnauthorized)
+		h.reject(w, r, k, start, "key expired", http.StatusUnauthorized, usage.CategoryExpired)
 		return
 	}
 
 	if k.OneShot && k.Used {
-		writeError(w, "key already used", http.StatusUnauthorized)
+		h.reject(w, r, k, start, "key already used", http.StatusUnauthorized, usage.CategoryKeyUsed)
+		return
+	}
+
+	if k.Suspended {
+		h.reject(w, r, k, start, "key suspended", http.StatusForbidden, usage.CategorySuspended)
 		return
 	}
 
-	if k.TokenBudget > 0 && h.UsageStore != nil {
-		if h.UsageStore.TotalTokens(k.ID) >= k.TokenBudget {
-			writeError(w, "token budget exceeded", http.StatusTooManyRequests)
+	if (k.TokenBudget > 0 || k.BudgetUSD > 0) && h.UsageStore != nil {
+		used, err := h.UsageStore.Totals(k.ID)
+		if k.TokenBudget > 0 {
+			ratelimit.SetBudgetHeaders(w.Header(), k.TokenBudget, int(used.Tokens))
+		}
+		var exceeded string
+		switch {
+		case err != nil:
+			// An unreadable usage store admits the request.
+		case k.TokenBudget > 0 && used.Tokens >= int64(k.TokenBudget):
+			exceeded = "token budget exceeded"
+		case k.BudgetUSD > 0 && used.CostUSD >= k.BudgetUSD:
+			exceeded = "cost budget exceeded"
+		}
+		if exceeded != "" {
+			h.rejectTooMany(w, r, k, start, ratelimit.ErrorResponse{
+				Error:  exceeded,
+				Reason: ratelimit.ReasonBudgetExceeded,
+				Level:  ratelimit.LevelKey,
+			}, 0)
 			return
 		}
 	}
@@ -99,30 +170,38 @@ func (h *Handler) Proxy(w http.ResponseWriter, r *http.Request) {
 	switch k.Scope {
 	case keys.ScopeRead:
 		if r.Method != http.MethodGet && r.Method != http.MethodHead {
-			writeError(w, "insufficient scope", http.StatusForbidden)
+			h.reject(w, r, k, start, "insufficient scope", http.StatusForbidden, usage.CategoryScope)
 			return
 		}
 	case keys.ScopeWrite:
 		// write scope allows all methods
 	default:
-		writeError(w, "insufficient scope", http.StatusForbidden)
+		h.reject(w, r, k, start, "insufficient scope", http.StatusForbidden, usage.CategoryScope)
 		return
 	}
 
 	svc, err := h.ServiceStore.Get(k.Target)
 	if err != nil {
 		if err == services.ErrServiceNotFound {
-			writeError(w, "service not found", http.StatusNotFound)
+			h.reject(w, r, k, start, "service not found", http.StatusNotFound, usage.CategoryMisconfigured)
 			return
 		}
 		writeError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	// Keys only reach services of their own org.
+	if svc.OrgID != k.OrgID {
+		h.reject(w, r, k, start, "service belongs to another org", http.StatusForbidden, usage.CategoryScope)
+		return
+	}
 
 	rk, err := h.RootKeyStore.Get(svc.RootKeyID)
+	if err == nil && rk.OrgID != svc.OrgID {
+		err = rootkeys.ErrKeyNotFound
+	}
 	if err != nil {
 		if err == rootkeys.ErrKeyNotFound {
-			writeError(w, "root key not found", http.StatusInternalServerError)
+			h.reject(w, r, k, start, "root key not found", http.StatusInternalServerError, usage.CategoryMisconfigured)
 			return
 		}
 		writeError(w, "internal error", http.StatusInternalServerError)
@@ -131,10 +210,69 @@ func (h *Handler) Proxy(w http.ResponseWriter, r *http.Request) {
 
 	target, err := url.Parse(svc.Endpoint)
 	if err != nil {
-		writeError(w, "bad service endpoint", http.StatusInternalServerError)
+		h.reject(w, r, k, start, "bad service endpoint", http.StatusInternalServerError, usage.CategoryMisconfigured)
 		return
 	}
 
+	// Reject locally while the upstream is throttling this root key.
+	if h.Adaptive != nil {
+		if ok, wait := h.Adaptive.Admit(svc.ID, rk.ID); !ok {
+			h.rejectTooMany(w, r, k, start, ratelimit.ErrorResponse{
+				Error:  "upstream is throttling requests",
+				Reason: ratelimit.ReasonUpstreamThrottled,
+				Level:  ratelimit.LevelService,
+			}, wait)
+			return
+		}
+	}
+
+	// Hold a slot of every max_concurrent limit for the whole exchange. This
+	// happens before tokens are reserved so queued requests don't hold them.
+	if slots := slotLimits(k, svc); h.Concurrency != nil && len(slots) > 0 {
+		release, full, ok := h.acquireSlots(r.Context(), slots)
+		if !ok {
+			h.rejectTooMany(w, r, k, start, ratelimit.ErrorResponse{
+				Error:  "too many concurrent requests",
+				Reason: ratelimit.ReasonConcurrencyLimited,
+				Level:  full.level,
+			}, time.Second)
+			return
+		}
+		defer release()
+	}
+
+	// Reserve the estimated token cost against tokens-per-minute limits and
+	// token quotas; the reservation is settled against real usage once the
+	// response is in.
+	var limits []tokenLimit
+	var estimate int
+	if h.Limiter != nil {
+		limits = tokenLimits(k, svc, h.QuotaStore)
+	}
+	if len(limits) > 0 {
+		limit := h.MaxBodyBytes
+		if limit <= 0 {
+			limit = DefaultMaxBodyBytes
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, "request body too large", http.StatusRequestEntityTooLarge)
+			h.recordRejection(r, k, start, http.StatusRequestEntityTooLarge, usage.CategoryTooLarge)
+			return
+		}
+		if err != nil {
+			writeError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		estimate = estimateTokens(body)
+		if tl, res, ok := h.reserveTokens(r.Context(), limits, estimate); !ok {
+			h.rejectTooMany(w, r, k, start, tl.rejection, res.RetryAfter)
+			return
+		}
+	}
+
 	// Trim /v1/proxy prefix from the path.
 	prefix := "/v1/proxy"
 	r.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
@@ -151,34 +289,99 @@ func (h *Handler) Proxy(w http.ResponseWriter, r *http.Request) {
 	// the upstream returns an error.
 	if k.OneShot {
 		k.Used = true
-		h.KeyStore.Update(k.ID, k)
+		h.KeyStore.Update(k.ID, k, events.KeyUsed{KeyID: k.ID, OrgID: k.OrgID, Service: k.Target})
 	}
 
-	trackTokens := config.TrackTokens()
+	trackTokens := config.TrackTokens() || len(limits) > 0
 	rec := &proxyRecorder{ResponseWriter: w, code: http.StatusOK, trackBody: trackTokens}
+	ev := usage.FromRequest(r, k)
+	var reqBody *requestBody
+	if r.Body != nil && r.Body != http.NoBody {
+		reqBody = &requestBody{ReadCloser: r.Body}
+		r.Body = reqBody
+	}
 
-	start := time.Now()
+	forwarded := time.Now()
 	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		ev.Category = usage.CategoryUpstreamUnreachable
+		if r.Context().Err() != nil {
+			ev.Category = usage.CategoryCanceled
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
 	r.Host = target.Host
 	proxy.ServeHTTP(rec, r)
-	latency := time.Since(start).Milliseconds()
+	latency := time.Since(forwarded).Milliseconds()
+
+	if h.Adaptive != nil {
+		h.Adaptive.Observe(svc.ID, rk.ID, rec.code, rec.Header())
+	}
+
+	var used upstreamUsage
+	parsed := false
+	if trackTokens && rec.code == http.StatusOK {
+		parsed = json.Unmarshal(rec.body.Bytes(), &used) == nil
+	}
+
+	if len(limits) > 0 {
+		// Failed upstream calls are refunded; successful ones without a usage
+		// block (e.g. streams) keep the estimate.
+		actual := estimate
+		switch {
+		case rec.code >= http.StatusBadRequest:
+			actual = 0
+		case parsed && used.Usage.TotalTokens > 0:
+			actual = used.Usage.TotalTokens
+		}
+		h.settleTokens(r.Context(), limits, estimate, actual)
+	}
 
 	if h.UsageStore != nil {
-		ev := usage.Event{
-			KeyID:      k.ID,
-			Timestamp:  time.Now(),
-			StatusCode: rec.code,
-			Service:    k.Target,
-			LatencyMS:  latency,
-		}
-		if trackTokens && rec.code == http.StatusOK {
-			var body upstreamUsage
-			if err := json.Unmarshal(rec.body.Bytes(), &body); err == nil {
-				ev.PromptTokens = body.Usage.PromptTokens
-				ev.CompletionTokens = body.Usage.CompletionTokens
-				ev.TotalTokens = body.Usage.TotalTokens
+		ev.Timestamp = time.Now()
+		ev.StatusCode = rec.code
+		ev.LatencyMS = latency
+		ev.ResponseBytes = rec.bytes
+		if !rec.firstByte.IsZero() {
+			ev.TTFBMS = rec.firstByte.Sub(forwarded).Milliseconds()
+		}
+		ev.SetEndpoint(target.JoinPath(r.URL.Path))
+		if ev.Category == "" {
+			ev.Category = usage.UpstreamCategory(rec.code)
+		}
+		if reqBody != nil {
+			ev.RequestBytes = reqBody.n
+			ev.Model = reqBody.model()
+		}
+		if parsed {
+			if used.Model != "" {
+				ev.Model = used.Model
 			}
+			ev.PromptTokens = used.Usage.PromptTokens
+			ev.CompletionTokens = used.Usage.CompletionTokens
+			ev.TotalTokens = used.Usage.TotalTokens
+			ev.CostUSD = svc.Cost(ev.PromptTokens, ev.CompletionTokens)
 		}
 		h.UsageStore.Record(ev) //nolint:errcheck
 	}
 }
+
+// reject writes an error for a request refused before being forwarded and
+// records its usage event.
+func (h *Handler) reject(w http.ResponseWriter, r *http.Request, k keys.VirtualKey, start time.Time, message string, code int, category string) {
+	writeError(w, message, code)
+	h.recordRejection(r, k, start, code, category)
+}
+
+// rejectTooMany writes a 429 for a request refused before being forwarded
+// and records its usage event, categorised by the rejection reason.
+func (h *Handler) rejectTooMany(w http.ResponseWriter, r *http.Request, k keys.VirtualKey, start time.Time, body ratelimit.ErrorResponse, retryAfter time.Duration) {
+	ratelimit.WriteTooManyRequests(w, body, retryAfter)
+	h.recordRejection(r, k, start, http.StatusTooManyRequests, body.Reason)
+}
+
+func (h *Handler) recordRejection(r *http.Request, k keys.VirtualKey, start time.Time, code int, category string) {
+	if h.UsageStore != nil {
+		h.UsageStore.Record(usage.Rejected(r, k, start, code, category)) //nolint:errcheck
+	}
+}
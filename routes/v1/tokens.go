@@ -0,0 +1,126 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/quotas"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+	"github.com/farovictor/bifrost/pkg/services"
+)
+
+// tokenLimit is a token bucket that applies to a proxied request.
+type tokenLimit struct {
+	key string
+	lim ratelimit.Limit
+	// rejection is the 429 body written when the bucket has no room.
+	rejection ratelimit.ErrorResponse
+}
+
+// reserved returns how many tokens are taken up front for a request estimated
+// at estimate tokens. Requests larger than the bucket only need a full bucket,
+// otherwise they could never be admitted.
+func (t tokenLimit) reserved(estimate int) int {
+	return min(estimate, t.lim.Rate)
+}
+
+// tokenLimits returns the token buckets for a key: its own and its service's
+// tokens-per-minute limits, then every token quota from qs (which may be nil)
+// covering the key's org, service and service account.
+func tokenLimits(k keys.VirtualKey, svc services.Service, qs quotas.Store) []tokenLimit {
+	var out []tokenLimit
+	if k.TokensPerMinute > 0 {
+		out = append(out, tokenLimit{
+			key: "tpm:key:" + k.ID,
+			lim: ratelimit.Limit{Rate: k.TokensPerMinute, Per: time.Minute},
+			rejection: ratelimit.ErrorResponse{
+				Error:  "token rate limit exceeded",
+				Reason: ratelimit.ReasonRateLimited,
+				Level:  ratelimit.LevelKey,
+			},
+		})
+	}
+	if svc.TokensPerMinute > 0 {
+		out = append(out, tokenLimit{
+			key: "tpm:svc:" + svc.ID,
+			lim: ratelimit.Limit{Rate: svc.TokensPerMinute, Per: time.Minute},
+			rejection: ratelimit.ErrorResponse{
+				Error:  "token rate limit exceeded",
+				Reason: ratelimit.ReasonRateLimited,
+				Level:  ratelimit.LevelService,
+			},
+		})
+	}
+	if qs == nil {
+		return out
+	}
+	applicable, err := qs.Applicable(quotas.Subject{
+		OrgID:            k.OrgID,
+		ServiceID:        svc.ID,
+		ServiceAccountID: k.ServiceAccountID,
+	}, quotas.MetricTokens)
+	if err != nil {
+		return out
+	}
+	for _, q := range applicable {
+		bucket, lim := q.Bucket()
+		out = append(out, tokenLimit{
+			key: bucket,
+			lim: lim,
+			rejection: ratelimit.ErrorResponse{
+				Error:   q.Scope + " token quota exceeded",
+				Reason:  ratelimit.ReasonQuotaExceeded,
+				Level:   q.Scope,
+				QuotaID: q.ID,
+			},
+		})
+	}
+	return out
+}
+
+// estimateTokens guesses the token cost of an OpenAI-compatible request before
+// it is sent: roughly four bytes per prompt token plus the completion budget
+// the caller asked for.
+func estimateTokens(body []byte) int {
+	var req struct {
+		MaxTokens           int `json:"max_tokens"`
+		MaxCompletionTokens int `json:"max_completion_tokens"`
+	}
+	json.Unmarshal(body, &req) //nolint:errcheck
+	completion := req.MaxCompletionTokens
+	if completion == 0 {
+		completion = req.MaxTokens
+	}
+	return (len(body)+3)/4 + completion
+}
+
+// reserveTokens takes the estimated cost from every bucket. When a bucket
+// rejects the request the tokens already taken from the others are refunded
+// and the rejecting bucket is returned with its result and ok set to false.
+func (h *Handler) reserveTokens(ctx context.Context, limits []tokenLimit, estimate int) (tl tokenLimit, res ratelimit.Result, ok bool) {
+	for i, tl := range limits {
+		res, err := h.Limiter.Allow(ctx, tl.key, tl.lim, tl.reserved(estimate))
+		if err != nil {
+			continue
+		}
+		if !res.Allowed {
+			for _, prev := range limits[:i] {
+				h.Limiter.Debit(ctx, prev.key, prev.lim, -prev.reserved(estimate)) //nolint:errcheck
+			}
+			return tl, res, false
+		}
+	}
+	return tokenLimit{}, ratelimit.Result{}, true
+}
+
+// settleTokens debits the difference between the tokens a request actually
+// used and what was reserved for it, refunding over-estimates.
+func (h *Handler) settleTokens(ctx context.Context, limits []tokenLimit, estimate, actual int) {
+	for _, tl := range limits {
+		if d := actual - tl.reserved(estimate); d != 0 {
+			h.Limiter.Debit(ctx, tl.key, tl.lim, d) //nolint:errcheck
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/farovictor/bifrost/pkg/events"
+	"github.com/farovictor/bifrost/pkg/logging"
+	"github.com/farovictor/bifrost/pkg/webhooks"
+)
+
+// webhookRequest is the body of the webhook create and update endpoints.
+type webhookRequest struct {
+	URL    string   `json:"url" example:"https://hooks.example.com/bifrost"`
+	Events []string `json:"events" example:"key.created,key.rate_limited"`
+	// Active defaults to true.
+	Active *bool `json:"active,omitempty"`
+	// Secret replaces the signing secret. A new webhook without one gets a
+	// random secret.
+	Secret string `json:"secret,omitempty"`
+}
+
+// orgWebhook returns the webhook in the path, writing an error and returning
+// false if it does not exist or does not belong to orgID.
+func (s *Server) orgWebhook(w http.ResponseWriter, r *http.Request, orgID string) (webhooks.Webhook, bool) {
+	hook, err := s.WebhookStore.GetWebhook(chi.URLParam(r, "webhookID"))
+	if err == nil && hook.OrgID != orgID {
+		err = webhooks.ErrWebhookNotFound
+	}
+	if err != nil {
+		if err == webhooks.ErrWebhookNotFound {
+			writeError(w, "not found", http.StatusNotFound)
+		} else {
+			writeError(w, "internal error", http.StatusInternalServerError)
+		}
+		return webhooks.Webhook{}, false
+	}
+	return hook, true
+}
+
+// ListWebhooks handles GET /v1/orgs/{id}/webhooks.
+//
+// @Summary      List webhooks
+// @Description  The organization's webhooks. Secrets are not returned.
+// @Tags         webhooks
+// @Produce      json
+// @Param        id   path      string  true  "Organization ID"
+// @Success      200  {array}   webhooks.Webhook
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/orgs/{id}/webhooks [get]
+func (s *Server) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := s.scopedOrg(w, r)
+	if !ok {
+		return
+	}
+	hooks, err := s.WebhookStore.ListWebhooks(orgID)
+	if err != nil {
+		writeError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+// CreateWebhook handles POST /v1/orgs/{id}/webhooks.
+//
+// @Summary      Create webhook
+// @Description  Subscribe a URL to events of the organization's keys: key.created, key.revoked, key.expired, key.rate_limited, key.budget_exceeded and key.used. Deliveries are signed with the returned secret; it is not shown again.
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string          true  "Organization ID"
+// @Param        body  body      webhookRequest  true  "Webhook"
+// @Success      201   {object}  webhooks.Webhook
+// @Failure      400   {object}  ErrorResponse  "invalid url or events"
+// @Failure      403   {object}  ErrorResponse  "missing permission, or org is not the caller's"
+// @Failure      404   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/orgs/{id}/webhooks [post]
+func (s *Server) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := s.scopedOrg(w, r)
+	if !ok {
+		return
+	}
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	hook := webhooks.Webhook{
+		ID:        uuid.NewString(),
+		OrgID:     orgID,
+		URL:       req.URL,
+		Events:    req.Events,
+		Secret:    req.Secret,
+		Active:    req.Active == nil || *req.Active,
+		CreatedAt: time.Now().UTC(),
+	}
+	if field := hook.Validate(); field != "" {
+		writeError(w, "invalid "+field, http.StatusBadRequest)
+		return
+	}
+	if hook.Secret == "" {
+		hook.Secret = webhooks.NewSecret()
+	}
+	if err := s.WebhookStore.CreateWebhook(hook, events.WebhookCreated{WebhookID: hook.ID, OrgID: orgID, Meta: meta(r, nil, hook)}); err != nil {
+		writeError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	logging.Logger.Info().Str("org_id", orgID).Str("webhook_id", hook.ID).Msg("created webhook")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// GetWebhook handles GET /v1/orgs/{id}/webhooks/{webhookID}.
+//
+// @Summary      Get webhook
+// @Tags         webhooks
+// @Produce      json
+// @Param        id         path      string  true  "Organization ID"
+// @Param        webhookID  path      string  true  "Webhook ID"
+// @Success      200  {object}  webhooks.Webhook
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/orgs/{id}/webhooks/{webhookID} [get]
+func (s *Server) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := s.scopedOrg(w, r)
+	if !ok {
+		return
+	}
+	hook, ok := s.orgWebhook(w, r, orgID)
+	if !ok {
+		return
+	}
+	hook.Secret = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+// UpdateWebhook handles PUT /v1/orgs/{id}/webhooks/{webhookID}.
+//
+// @Summary      Update webhook
+// @Description  Replace the webhook's URL, events and active flag. The secret is kept unless a new one is given, in which case it is returned.
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Param        id         path      string          true  "Organization ID"
+// @Param        webhookID  path      string          true  "Webhook ID"
+// @Param        body       body      webhookRequest  true  "Webhook"
+// @Success      200  {object}  webhooks.Webhook
+// @Failure      400  {object}  ErrorResponse  "invalid url or events"
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/orgs/{id}/webhooks/{webhookID} [put]
+func (s *Server) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := s.scopedOrg(w, r)
+	if !ok {
+		return
+	}
+	hook, ok := s.orgWebhook(w, r, orgID)
+	if !ok {
+		return
+	}
+	before := hook
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	hook.URL, hook.Events = req.URL, req.Events
+	hook.Active = req.Active == nil || *req.Active
+	if field := hook.Validate(); field != "" {
+		writeError(w, "invalid "+field, http.StatusBadRequest)
+		return
+	}
+	if req.Secret != "" {
+		hook.Secret = req.Secret
+	}
+	if err := s.WebhookStore.UpdateWebhook(hook, events.WebhookUpdated{WebhookID: hook.ID, OrgID: orgID, Meta: meta(r, before, hook)}); err != nil {
+		writeError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	logging.Logger.Info().Str("org_id", orgID).Str("webhook_id", hook.ID).Msg("updated webhook")
+	if req.Secret == "" {
+		hook.Secret = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+// DeleteWebhook handles DELETE /v1/orgs/{id}/webhooks/{webhookID}. Pending
+// deliveries to it are abandoned.
+//
+// @Summary      Delete webhook
+// @Tags         webhooks
+// @Param        id         path  string  true  "Organization ID"
+// @Param        webhookID  path  string  true  "Webhook ID"
+// @Success      204
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/orgs/{id}/webhooks/{webhookID} [delete]
+func (s *Server) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := s.scopedOrg(w, r)
+	if !ok {
+		return
+	}
+	hook, ok := s.orgWebhook(w, r, orgID)
+	if !ok {
+		return
+	}
+	if err := s.WebhookStore.DeleteWebhook(hook.ID, events.WebhookDeleted{WebhookID: hook.ID, OrgID: orgID, Meta: meta(r, hook, nil)}); err != nil {
+		writeError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	logging.Logger.Info().Str("org_id", orgID).Str("webhook_id", hook.ID).Msg("deleted webhook")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries handles GET /v1/orgs/{id}/webhooks/{webhookID}/deliveries.
+//
+// @Summary      List webhook deliveries
+// @Description  Deliveries to the webhook, newest first, with their payload, attempts and last response. Deliveries are kept for BIFROST_WEBHOOK_RETENTION_DAYS.
+// @Tags         webhooks
+// @Produce      json
+// @Param        id         path      string  true   "Organization ID"
+// @Param        webhookID  path      string  true   "Webhook ID"
+// @Param        status     query     string  false  "pending, delivered or failed"
+// @Param        limit      query     int     false  "Maximum deliveries returned (default 100)"
+// @Success      200  {array}   webhooks.Delivery
+// @Failure      400  {object}  ErrorResponse  "invalid status or limit"
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/orgs/{id}/webhooks/{webhookID}/deliveries [get]
+func (s *Server) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := s.scopedOrg(w, r)
+	if !ok {
+		return
+	}
+	hook, ok := s.orgWebhook(w, r, orgID)
+	if !ok {
+		return
+	}
+	params := r.URL.Query()
+	q := webhooks.DeliveryQuery{WebhookID: hook.ID, Status: params.Get("status")}
+	switch q.Status {
+	case "", webhooks.StatusPending, webhooks.StatusDelivered, webhooks.StatusFailed:
+	default:
+		writeError(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		q.Limit = n
+	}
+	deliveries, err := s.WebhookStore.ListDeliveries(q)
+	if err != nil {
+		writeError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// RedeliverWebhook handles
+// POST /v1/orgs/{id}/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver.
+//
+// @Summary      Redeliver webhook event
+// @Description  Send the delivery's event again, as a new delivery with its own attempts. The original delivery is left as it is.
+// @Tags         webhooks
+// @Produce      json
+// @Param        id          path      string  true  "Organization ID"
+// @Param        webhookID   path      string  true  "Webhook ID"
+// @Param        deliveryID  path      string  true  "Delivery ID"
+// @Success      202  {object}  webhooks.Delivery
+// @Failure      403  {object}  ErrorResponse  "missing permission, or org is not the caller's"
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Failure      503  {object}  ErrorResponse  "webhook delivery disabled"
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /v1/orgs/{id}/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver [post]
+func (s *Server) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := s.scopedOrg(w, r)
+	if !ok {
+		return
+	}
+	hook, ok := s.orgWebhook(w, r, orgID)
+	if !ok {
+		return
+	}
+	if s.Webhooks == nil {
+		writeError(w, "webhook delivery disabled", http.StatusServiceUnavailable)
+		return
+	}
+	del, err := s.WebhookStore.GetDelivery(chi.URLParam(r, "deliveryID"))
+	if err == nil && del.WebhookID != hook.ID {
+		err = webhooks.ErrDeliveryNotFound
+	}
+	if err != nil {
+		if err == webhooks.ErrDeliveryNotFound {
+			writeError(w, "not found", http.StatusNotFound)
+		} else {
+			writeError(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+	red, err := s.Webhooks.Redeliver(del.ID, events.WebhookRedelivered{DeliveryID: del.ID, WebhookID: hook.ID, OrgID: orgID, Meta: meta(r, nil, nil)})
+	if err != nil {
+		writeError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	logging.Logger.Info().Str("delivery_id", del.ID).Str("redelivery_id", red.ID).Msg("redelivering webhook event")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(red)
+}
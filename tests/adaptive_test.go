@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+	"github.com/farovictor/bifrost/pkg/rootkeys"
+	"github.com/farovictor/bifrost/pkg/services"
+)
+
+func TestUpstream429ShedsLoadLocally(t *testing.T) {
+	env := newTestEnv(t)
+	calls := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer backend.Close()
+
+	env.Server.RootKeyStore.Create(rootkeys.RootKey{ID: "rk", APIKey: "real"})
+	env.Server.ServiceStore.Create(services.Service{ID: "svc", Endpoint: backend.URL, RootKeyID: "rk"})
+	env.Server.KeyStore.Create(keys.VirtualKey{ID: "vk", Target: "svc", Scope: keys.ScopeRead, ExpiresAt: time.Now().Add(time.Hour), RateLimit: 100})
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/proxy/models", nil)
+		req.Header.Set("X-Virtual-Key", "vk")
+		rr := httptest.NewRecorder()
+		env.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send(); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the upstream 429 to pass through, got %d", rr.Code)
+	}
+	rr := send()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected local 429, got %d", rr.Code)
+	}
+	if calls != 1 {
+		t.Fatalf("expected the second request to stay local, upstream saw %d", calls)
+	}
+	var body ratelimit.ErrorResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.Reason != ratelimit.ReasonUpstreamThrottled || body.Level != ratelimit.LevelService {
+		t.Fatalf("unexpected 429 body: %+v", body)
+	}
+	if ra := rr.Header().Get(ratelimit.HeaderRetryAfter); ra != "30" {
+		t.Fatalf("expected Retry-After 30, got %q", ra)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/services/svc/adaptive", nil)
+	env.Authorize(req)
+	rr = httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	var states []ratelimit.AdaptiveState
+	if err := json.Unmarshal(rr.Body.Bytes(), &states); err != nil {
+		t.Fatalf("decode: %v (%s)", err, rr.Body.String())
+	}
+	if len(states) != 1 || states[0].RootKeyID != "rk" || states[0].Admission != 0.5 || states[0].BlockedUntil == nil {
+		t.Fatalf("unexpected adaptive state: %+v", states)
+	}
+}
+
+func TestServiceAdaptiveNotFound(t *testing.T) {
+	env := newTestEnv(t)
+	req := httptest.NewRequest(http.MethodGet, "/v1/services/missing/adaptive", nil)
+	env.Authorize(req)
+	rr := httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/anomaly"
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/orgs"
+	"github.com/farovictor/bifrost/pkg/rootkeys"
+	"github.com/farovictor/bifrost/pkg/services"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+func TestListAnomaliesScopedToOrg(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+	for _, f := range []anomaly.Flag{
+		{ID: "f1", KeyID: "k1", OrgID: "o1", Kind: anomaly.KindRequestSpike, Action: anomaly.ActionFlagged, CreatedAt: now},
+		{ID: "f2", KeyID: "k2", OrgID: "o1", Kind: anomaly.KindNewIP, Action: anomaly.ActionFlagged, CreatedAt: now.Add(time.Second), ResolvedAt: &now},
+		{ID: "f3", KeyID: "k3", OrgID: "o2", Kind: anomaly.KindErrorSpike, Action: anomaly.ActionFlagged, CreatedAt: now},
+	} {
+		env.Server.AnomalyStore.CreateFlag(f)
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"f1"}},
+		{"?status=all", []string{"f2", "f1"}},
+		{"?status=resolved", []string{"f2"}},
+		{"?status=all&key=k1", []string{"f1"}},
+	} {
+		rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/anomalies"+tc.query, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tc.query, rr.Code, rr.Body.String())
+		}
+		var flags []anomaly.Flag
+		json.Unmarshal(rr.Body.Bytes(), &flags)
+		var got []string
+		for _, f := range flags {
+			got = append(got, f.ID)
+		}
+		if len(got) != len(tc.want) || (len(got) > 0 && got[0] != tc.want[0]) {
+			t.Fatalf("%s: expected %v, got %v", tc.query, tc.want, got)
+		}
+	}
+
+	if rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/anomalies?org=o2", nil); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another org, got %d", rr.Code)
+	}
+	if rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/anomalies?status=bogus", nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid status, got %d", rr.Code)
+	}
+}
+
+func TestResolveAnomalyReinstatesKey(t *testing.T) {
+	env := newTestEnv(t)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	env.Server.RootKeyStore.Create(rootkeys.RootKey{ID: "rk", APIKey: "real", OrgID: "o1"})
+	env.Server.ServiceStore.Create(services.Service{ID: "svc", Endpoint: backend.URL, RootKeyID: "rk", OrgID: "o1"})
+
+	f := anomaly.Flag{ID: "f1", KeyID: "vk", OrgID: "o1", Kind: anomaly.KindRequestSpike, Detail: "spike", Action: anomaly.ActionSuspended, CreatedAt: time.Now()}
+	env.Server.AnomalyStore.CreateFlag(f)
+	env.Server.KeyStore.Create(keys.VirtualKey{
+		ID: "vk", Target: "svc", Scope: keys.ScopeWrite, RateLimit: 100, OrgID: "o1", ExpiresAt: time.Now().Add(time.Hour),
+		Suspended: true, SuspendedReason: f.SuspendReason(),
+	})
+
+	proxy := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/proxy/anything", nil)
+		req.Header.Set("X-Virtual-Key", "vk")
+		rr := httptest.NewRecorder()
+		env.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := proxy(); rr.Code != http.StatusForbidden || errorBody(t, rr) != "key suspended" {
+		t.Fatalf("expected suspended key refused, got %d: %s", rr.Code, rr.Body.String())
+	}
+	events, _, _ := env.Server.UsageStore.List("vk", time.Time{}, time.Time{}, 1, 10)
+	if len(events) != 1 || events[0].Category != usage.CategorySuspended {
+		t.Fatalf("expected a suspended usage event, got %+v", events)
+	}
+
+	if rr := env.Do(orgToken(t, env, "o2"), http.MethodPost, "/v1/anomalies/f1/resolve", nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another org's flag, got %d", rr.Code)
+	}
+	rr := env.Do(orgToken(t, env, "o1"), http.MethodPost, "/v1/anomalies/f1/resolve", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resolved anomaly.Flag
+	json.Unmarshal(rr.Body.Bytes(), &resolved)
+	if resolved.Open() {
+		t.Fatal("flag not resolved")
+	}
+	if k, _ := env.Server.KeyStore.Get("vk"); k.Suspended || k.SuspendedReason != "" {
+		t.Fatalf("key not reinstated: %+v", k)
+	}
+	if rr := proxy(); rr.Code != http.StatusOK {
+		t.Fatalf("expected reinstated key forwarded, got %d", rr.Code)
+	}
+}
+
+func TestAnomalyPolicy(t *testing.T) {
+	env := newTestEnv(t)
+	env.Server.OrgStore.Create(orgs.Organization{ID: "o1", Name: "Acme"})
+
+	rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/orgs/o1/anomaly-policy", nil)
+	var p anomaly.Policy
+	json.Unmarshal(rr.Body.Bytes(), &p)
+	if rr.Code != http.StatusOK || p.OrgID != "o1" || p.AutoSuspend {
+		t.Fatalf("expected default policy, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = env.Do(orgToken(t, env, "o1"), http.MethodPut, "/v1/orgs/o1/anomaly-policy", map[string]any{"auto_suspend": true, "suspend_on": []string{"request_spike", "error_spike"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	stored, _ := env.Server.AnomalyStore.Policy("o1")
+	if !stored.Suspends(anomaly.KindErrorSpike) || stored.Suspends(anomaly.KindNewIP) {
+		t.Fatalf("unexpected stored policy %+v", stored)
+	}
+
+	for _, tc := range []struct {
+		name string
+		org  string
+		path string
+		body any
+		code int
+	}{
+		{"invalid kind", "o1", "/v1/orgs/o1/anomaly-policy", map[string]any{"suspend_on": []string{"bogus"}}, http.StatusBadRequest},
+		{"other org", "o2", "/v1/orgs/o1/anomaly-policy", map[string]any{"auto_suspend": false}, http.StatusForbidden},
+		{"unknown org", "o9", "/v1/orgs/o9/anomaly-policy", map[string]any{"auto_suspend": false}, http.StatusNotFound},
+	} {
+		if rr := env.Do(orgToken(t, env, tc.org), http.MethodPut, tc.path, tc.body); rr.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.code, rr.Code)
+		}
+	}
+}
+
+func TestAnomalyDetectorSuspendsKeyFromProxyTraffic(t *testing.T) {
+	env := newTestEnv(t)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	env.Server.RootKeyStore.Create(rootkeys.RootKey{ID: "rk", APIKey: "real", OrgID: "o1"})
+	env.Server.ServiceStore.Create(services.Service{ID: "svc", Endpoint: backend.URL, RootKeyID: "rk", OrgID: "o1"})
+	env.Server.KeyStore.Create(keys.VirtualKey{ID: "vk", Target: "svc", Scope: keys.ScopeWrite, RateLimit: 1000, OrgID: "o1", ExpiresAt: time.Now().Add(time.Hour)})
+	env.Server.AnomalyStore.PutPolicy(anomaly.Policy{OrgID: "o1", AutoSuspend: true})
+
+	// A one-request warmup learns the client address; the next address is new.
+	detector := anomaly.NewDetector(env.Server.AnomalyStore, env.Server.KeyStore, anomaly.DetectorOptions{Window: time.Nanosecond, Warmup: 1})
+	sub := env.Server.UsageStream.Subscribe(usage.StreamFilter{}, 16)
+	defer sub.Close()
+
+	for i, ip := range []string{"192.0.2.1:1000", "192.0.2.1:1000", "198.51.100.7:1000"} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/proxy/anything", nil)
+		req.Header.Set("X-Virtual-Key", "vk")
+		req.RemoteAddr = ip
+		rr := httptest.NewRecorder()
+		env.Router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, rr.Code)
+		}
+		detector.Observe(<-sub.C)
+	}
+
+	k, _ := env.Server.KeyStore.Get("vk")
+	if !k.Suspended {
+		t.Fatal("expected key suspended")
+	}
+	flags, _ := env.Server.AnomalyStore.ListFlags(anomaly.FlagQuery{KeyID: "vk"})
+	if len(flags) != 1 || flags[0].Kind != anomaly.KindNewIP || flags[0].Action != anomaly.ActionSuspended {
+		t.Fatalf("unexpected flags %+v", flags)
+	}
+}
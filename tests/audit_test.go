@@ -0,0 +1,260 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/farovictor/bifrost/pkg/audit"
+	"github.com/farovictor/bifrost/pkg/export"
+	"github.com/farovictor/bifrost/pkg/serviceaccounts"
+)
+
+// listAudit calls GET /v1/audit as org and decodes the entries.
+func listAudit(t *testing.T, env *TestEnv, org, query string) []audit.Entry {
+	t.Helper()
+	rr := env.Do(orgToken(t, env, org), http.MethodGet, "/v1/audit?"+query, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("list audit: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var entries []audit.Entry
+	if err := json.Unmarshal(rr.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("decode entries: %v", err)
+	}
+	return entries
+}
+
+func TestManagementActionsAudited(t *testing.T) {
+	env := newTestEnv(t)
+
+	// The first request carries a request ID and source address, as the
+	// server's middleware would set them.
+	body, _ := json.Marshal(map[string]string{"id": "rk1", "api_key": "sk-first"})
+	req := httptest.NewRequest(http.MethodPost, "/v1/rootkeys", bytes.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.RequestIDKey, "req-1"))
+	req.Header.Set("X-API-Key", env.User.APIKey)
+	req.Header.Set("Authorization", "Bearer "+orgToken(t, env, "o1"))
+	req.RemoteAddr = "203.0.113.7:51234"
+	rr := httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create root key: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	for _, step := range []struct {
+		method, path string
+		body         any
+		want         int
+	}{
+		{http.MethodPut, "/v1/rootkeys/rk1", map[string]string{"api_key": "sk-second"}, http.StatusNoContent},
+		{http.MethodPost, "/v1/services", map[string]string{"id": "svc1", "endpoint": "http://upstream", "root_key_id": "rk1"}, http.StatusCreated},
+		{http.MethodPut, "/v1/services/svc1", map[string]string{"id": "svc1", "endpoint": "http://upstream2", "root_key_id": "rk1"}, http.StatusOK},
+		{http.MethodDelete, "/v1/services/svc1", nil, http.StatusNoContent},
+		// Failed actions are not audited.
+		{http.MethodDelete, "/v1/services/svc1", nil, http.StatusNotFound},
+	} {
+		if rr := env.Do(orgToken(t, env, "o1"), step.method, step.path, step.body); rr.Code != step.want {
+			t.Fatalf("%s %s: expected %d, got %d: %s", step.method, step.path, step.want, rr.Code, rr.Body.String())
+		}
+	}
+
+	entries := listAudit(t, env, "o1", "")
+	want := []string{"service.delete", "service.update", "service.create", "root_key.update", "root_key.create"}
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %d: %+v", len(want), len(entries), entries)
+	}
+	for i, e := range entries {
+		if e.Action != want[i] {
+			t.Fatalf("entry %d: expected %s, got %s", i, want[i], e.Action)
+		}
+		if e.ActorType != audit.ActorUser || e.ActorID != env.User.ID || e.OrgID != "o1" || e.Hash == "" {
+			t.Fatalf("entry %d: unexpected %+v", i, e)
+		}
+	}
+
+	created := entries[4]
+	if created.RequestID != "req-1" || created.SourceIP != "203.0.113.7" || created.TargetID != "rk1" {
+		t.Fatalf("unexpected root key entry %+v", created)
+	}
+	if c := created.Changes["api_key"]; c.After != audit.Redacted {
+		t.Fatalf("expected redacted api_key, got %+v", c)
+	}
+	if c := entries[3].Changes["api_key"]; c.Before != audit.Redacted || c.After != audit.Redacted {
+		t.Fatalf("expected redacted api_key change, got %+v", c)
+	}
+	if c := entries[1].Changes["endpoint"]; c.Before != "http://upstream" || c.After != "http://upstream2" {
+		t.Fatalf("unexpected endpoint change %+v", c)
+	}
+	if c, ok := entries[0].Changes["id"]; !ok || c.Before != "svc1" || c.After != nil {
+		t.Fatalf("expected deleted service recorded, got %+v", entries[0].Changes)
+	}
+
+	raw := env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/audit", nil).Body.String()
+	if strings.Contains(raw, "sk-first") || strings.Contains(raw, "sk-second") {
+		t.Fatalf("secret leaked into audit log: %s", raw)
+	}
+	if n, err := audit.VerifyStore(env.Server.AuditStore); err != nil || n != len(want) {
+		t.Fatalf("verify: n=%d err=%v", n, err)
+	}
+}
+
+func TestServiceTokenAndMCPAudited(t *testing.T) {
+	env := newTestEnv(t)
+	svcID := seedServiceForToken(t, env)
+	env.Server.ServiceAccountStore.Create(serviceaccounts.ServiceAccount{ID: "sa-1", Name: "ci", APIKey: "sa-key-1"})
+
+	body, _ := json.Marshal(map[string]any{"service": svcID, "ttl_seconds": 60})
+	req := httptest.NewRequest(http.MethodPost, "/v1/service-token", bytes.NewReader(body))
+	req.Header.Set("X-Service-Key", "sa-key-1")
+	rr := httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("service token: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	mcpCall(t, env, map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params":  map[string]any{"name": "request_key", "arguments": map[string]any{"service_name": svcID}},
+	})
+
+	entries, _ := env.Server.AuditStore.List(audit.Query{Action: "key.create"})
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	if e := entries[0]; e.ActorType != audit.ActorMCP || e.ActorID != env.User.ID {
+		t.Fatalf("unexpected MCP entry %+v", e)
+	}
+	if e := entries[1]; e.ActorType != audit.ActorServiceAccount || e.ActorID != "sa-1" {
+		t.Fatalf("unexpected service account entry %+v", e)
+	}
+}
+
+func TestListAuditFilters(t *testing.T) {
+	env := newTestEnv(t)
+	start := time.Now().UTC().Add(-time.Hour)
+	for i, e := range []audit.Entry{
+		{OrgID: "o1", ActorType: audit.ActorUser, ActorID: "u1", Action: "service.create", TargetType: "service", TargetID: "s1"},
+		{OrgID: "o1", ActorType: audit.ActorUser, ActorID: "u2", Action: "service.update", TargetType: "service", TargetID: "s1"},
+		{OrgID: "o1", ActorType: audit.ActorUser, ActorID: "u1", Action: "key.create", TargetType: "key", TargetID: "k1"},
+		{OrgID: "o2", ActorType: audit.ActorUser, ActorID: "u3", Action: "service.create", TargetType: "service", TargetID: "s2"},
+	} {
+		e.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		if _, err := env.Server.AuditStore.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"k1", "s1", "s1"}},
+		{"actor=u1", []string{"k1", "s1"}},
+		{"action=service.update", []string{"s1"}},
+		{"target_type=service&target_id=s1", []string{"s1", "s1"}},
+		{"since=" + start.Add(time.Minute).Format(time.RFC3339) + "&until=" + start.Add(2*time.Minute).Format(time.RFC3339), []string{"s1"}},
+		{"limit=1", []string{"k1"}},
+		{"org=o1", []string{"k1", "s1", "s1"}},
+	} {
+		entries := listAudit(t, env, "o1", tc.query)
+		var got []string
+		for _, e := range entries {
+			if e.OrgID != "o1" {
+				t.Fatalf("%q: entry of another org %+v", tc.query, e)
+			}
+			got = append(got, e.TargetID)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Fatalf("%q: expected %v, got %v", tc.query, tc.want, got)
+		}
+	}
+
+	for query, want := range map[string]string{
+		"since=yesterday": "invalid since",
+		"until=1":         "invalid until",
+		"limit=0":         "invalid limit",
+		"limit=1001":      "invalid limit",
+	} {
+		rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/audit?"+query, nil)
+		if rr.Code != http.StatusBadRequest || errorBody(t, rr) != want {
+			t.Fatalf("%q: expected 400 %q, got %d: %s", query, want, rr.Code, rr.Body.String())
+		}
+	}
+	rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/audit?org=o2", nil)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("other org: expected 403, got %d", rr.Code)
+	}
+}
+
+func TestExportAudit(t *testing.T) {
+	env := newTestEnv(t)
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Millisecond)
+	for i, e := range []audit.Entry{
+		{OrgID: "o1", ActorType: audit.ActorUser, ActorID: "u1", Action: "service.create", TargetType: "service", TargetID: "s1",
+			Changes: audit.Diff(nil, map[string]string{"id": "s1"})},
+		{OrgID: "o2", ActorType: audit.ActorUser, ActorID: "u3", Action: "service.create", TargetType: "service", TargetID: "s2"},
+		{OrgID: "o1", ActorType: audit.ActorMCP, ActorID: "c1", Action: "key.create", TargetType: "key", TargetID: "k1"},
+	} {
+		e.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		if _, err := env.Server.AuditStore.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/audit/export", nil)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("csv: expected 200 text/csv, got %d %q: %s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0][1] != "seq" || records[1][8] != "s1" || records[2][8] != "k1" {
+		t.Fatalf("expected the caller's entries oldest first, got %v", records)
+	}
+	if records[1][9] != `{"id":{"after":"s1"}}` || records[2][9] != "" {
+		t.Fatalf("unexpected changes %q, %q", records[1][9], records[2][9])
+	}
+
+	rr = env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/audit/export?format=parquet&actor=c1", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("parquet: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rows := readParquet(t, rr.Body.Bytes())
+	if len(rows) != 1 || rows[0]["target_id"] != "k1" || rows[0]["actor_type"] != audit.ActorMCP || rows[0]["seq"] != int64(3) ||
+		rows[0]["created_at"] != start.Add(2*time.Minute).UnixMilli() || rows[0]["hash"] == "" {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+
+	for query, want := range map[string]int{"format=xml": http.StatusBadRequest, "since=yesterday": http.StatusBadRequest, "org=o2": http.StatusForbidden} {
+		if rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/audit/export?"+query, nil); rr.Code != want {
+			t.Fatalf("%q: expected %d, got %d", query, want, rr.Code)
+		}
+	}
+}
+
+func TestSQLAuditStoreExport(t *testing.T) {
+	store := audit.NewSQLStore(sqliteDB(t))
+	for _, id := range []string{"s1", "s2", "s3"} {
+		if _, err := store.Append(audit.Entry{OrgID: "o1", ActorType: audit.ActorUser, Action: "service.create", TargetType: "service", TargetID: id, CreatedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := audit.Export(store, audit.Query{OrgID: "o1", Limit: 1}, export.FormatJSONL, &buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], `{"id":`) || !strings.Contains(lines[2], `"target_id":"s3"`) {
+		t.Fatalf("expected every entry oldest first, got %q", buf.String())
+	}
+}
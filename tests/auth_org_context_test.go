@@ -62,6 +62,8 @@ func TestUserCreationOrgContext(t *testing.T) {
 
 			admin := users.User{ID: "admin", Name: "Admin", Email: "admin@example.com", APIKey: "admink"}
 			s.UserStore.Create(admin)
+			// The token names no org, so the admin owns the empty org.
+			s.MembershipStore.Create(orgs.Membership{UserID: admin.ID, Role: orgs.RoleOwner})
 
 			if tc.orgID != "" {
 				s.OrgStore.Create(orgs.Organization{ID: tc.orgID, Name: "Existing Org", Domain: "example.com", Email: "org@example.com"})
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+	"github.com/farovictor/bifrost/pkg/rootkeys"
+	"github.com/farovictor/bifrost/pkg/services"
+	v1 "github.com/farovictor/bifrost/routes/v1"
+)
+
+// setupConcurrencyEnv returns a proxy handler for a service whose backend
+// blocks every request until unblock is closed, and a channel receiving a
+// value each time a request reaches the backend.
+func setupConcurrencyEnv(t *testing.T, svcMax, queue int, maxWait time.Duration, ks ...keys.VirtualKey) (h *v1.Handler, arrived chan struct{}, unblock chan struct{}) {
+	t.Helper()
+	arrived = make(chan struct{}, 10)
+	unblock = make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-unblock
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(backend.Close)
+
+	s := newTestServer(t)
+	rk := rootkeys.RootKey{ID: "rk", APIKey: "real"}
+	s.RootKeyStore.Create(rk)
+	s.ServiceStore.Create(services.Service{ID: "svc", Endpoint: backend.URL, RootKeyID: rk.ID, MaxConcurrent: svcMax})
+	for _, k := range ks {
+		k.Scope = keys.ScopeWrite
+		k.Target = "svc"
+		k.RateLimit = 100
+		k.ExpiresAt = time.Now().Add(time.Hour)
+		s.KeyStore.Create(k)
+	}
+	h = &v1.Handler{
+		KeyStore:     s.KeyStore,
+		ServiceStore: s.ServiceStore,
+		RootKeyStore: s.RootKeyStore,
+		Concurrency:  ratelimit.NewConcurrency(ratelimit.NewLocalSemaphore(), queue, maxWait, 0),
+	}
+	return h, arrived, unblock
+}
+
+// startProxy sends a request with keyID in the background and returns a
+// channel delivering its response.
+func startProxy(h *v1.Handler, keyID string) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, "/v1/proxy/run", nil)
+		req.Header.Set("X-Virtual-Key", keyID)
+		rr := httptest.NewRecorder()
+		h.Proxy(rr, req)
+		done <- rr
+	}()
+	return done
+}
+
+func assertConcurrencyLimited(t *testing.T, rr *httptest.ResponseRecorder, level string) {
+	t.Helper()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rr.Code)
+	}
+	var body ratelimit.ErrorResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.Reason != ratelimit.ReasonConcurrencyLimited || body.Level != level {
+		t.Fatalf("unexpected 429 body: %+v", body)
+	}
+	if rr.Header().Get(ratelimit.HeaderRetryAfter) == "" {
+		t.Fatalf("missing Retry-After")
+	}
+}
+
+func TestKeyMaxConcurrentRejects(t *testing.T) {
+	h, arrived, unblock := setupConcurrencyEnv(t, 0, 0, 0, keys.VirtualKey{ID: "vk", MaxConcurrent: 1})
+
+	first := startProxy(h, "vk")
+	<-arrived
+	assertConcurrencyLimited(t, <-startProxy(h, "vk"), ratelimit.LevelKey)
+
+	close(unblock)
+	if rr := <-first; rr.Code != http.StatusOK {
+		t.Fatalf("first request: expected 200, got %d", rr.Code)
+	}
+	// The slot is free again once the first request finishes.
+	if rr := <-startProxy(h, "vk"); rr.Code != http.StatusOK {
+		t.Fatalf("request after release: expected 200, got %d", rr.Code)
+	}
+}
+
+func TestServiceMaxConcurrentSpansKeys(t *testing.T) {
+	h, arrived, unblock := setupConcurrencyEnv(t, 1, 0, 0, keys.VirtualKey{ID: "vk-a"}, keys.VirtualKey{ID: "vk-b"})
+	defer close(unblock)
+
+	startProxy(h, "vk-a")
+	<-arrived
+	assertConcurrencyLimited(t, <-startProxy(h, "vk-b"), ratelimit.LevelService)
+}
+
+func TestMaxConcurrentQueue(t *testing.T) {
+	h, arrived, unblock := setupConcurrencyEnv(t, 0, 1, 5*time.Second, keys.VirtualKey{ID: "vk", MaxConcurrent: 1})
+
+	first := startProxy(h, "vk")
+	<-arrived
+	queued := startProxy(h, "vk")
+	for h.Concurrency.Waiting("concurrency:key:vk") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// The queue only has room for one waiter.
+	assertConcurrencyLimited(t, <-startProxy(h, "vk"), ratelimit.LevelKey)
+
+	close(unblock)
+	for i, done := range []<-chan *httptest.ResponseRecorder{first, queued} {
+		if rr := <-done; rr.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i+1, rr.Code)
+		}
+	}
+}
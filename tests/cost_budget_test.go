@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+	"github.com/farovictor/bifrost/pkg/services"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+func TestCostBudget(t *testing.T) {
+	s, router, keyID, _ := setupBudgetEnv(t, 0)
+	k, _ := s.KeyStore.Get(keyID)
+	k.BudgetUSD = 5
+	s.KeyStore.Update(k.ID, k)
+
+	proxy := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/proxy/chat", nil)
+		req.Header.Set("X-Virtual-Key", keyID)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	s.UsageStore.Record(usage.Event{KeyID: keyID, Timestamp: time.Now(), StatusCode: 200, CostUSD: 4.99})
+	if rr := proxy(); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 under budget, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	s.UsageStore.Record(usage.Event{KeyID: keyID, Timestamp: time.Now(), StatusCode: 200, CostUSD: 0.01})
+	rr := proxy()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once spent, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if msg := errorBody(t, rr); msg != "cost budget exceeded" {
+		t.Fatalf("unexpected error: %s", msg)
+	}
+	var resp ratelimit.ErrorResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Reason != ratelimit.ReasonBudgetExceeded {
+		t.Fatalf("unexpected reason %q", resp.Reason)
+	}
+}
+
+// The cost budget keeps refusing requests once the spend behind it has aged
+// out of raw events and rollups.
+func TestCostBudgetOutlivesUsageRetention(t *testing.T) {
+	s := newTestServer(t)
+	store := usage.NewSQLStore(sqliteDB(t))
+	s.UsageStore = store
+	s.ServiceStore.Create(services.Service{ID: "svc", Endpoint: "http://example.com", RootKeyID: "rk"})
+	s.KeyStore.Create(keys.VirtualKey{ID: "vk", Target: "svc", Scope: keys.ScopeWrite, RateLimit: 100,
+		ExpiresAt: time.Now().Add(time.Hour), BudgetUSD: 5})
+	router := setupRouter(s)
+
+	store.Record(usage.Event{KeyID: "vk", StatusCode: 200, CostUSD: 5, Timestamp: time.Now().AddDate(0, 0, -10)})
+	r := &usage.Retention{Store: store, Lock: &database.LocalLock{}, Days: 1, RollupDays: 5, RollupDelay: time.Hour}
+	if _, _, err := r.RunOnce(context.Background()); err != nil {
+		t.Fatalf("retention: %v", err)
+	}
+	if rows, _ := store.Summary(usage.SummaryQuery{}); len(rows) != 0 {
+		t.Fatalf("expected the spend to be pruned, got %+v", rows)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/proxy/chat", nil)
+	req.Header.Set("X-Virtual-Key", "vk")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTooManyRequests || errorBody(t, rr) != "cost budget exceeded" {
+		t.Fatalf("expected 429 cost budget exceeded, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestCreateKeyInvalidBudgets(t *testing.T) {
+	env := newTestEnv(t)
+	env.Server.ServiceStore.Create(services.Service{ID: "svc", Endpoint: "http://example.com", RootKeyID: "rk"})
+
+	for field, msg := range map[string]string{"token_budget": "invalid token_budget", "budget_usd": "invalid budget_usd"} {
+		body := map[string]any{"id": "bk", "scope": "read", "target": "svc", "rate_limit": 1,
+			"expires_at": time.Now().Add(time.Hour), field: -1}
+		rr := env.Do(orgToken(t, env, "o1"), http.MethodPost, "/v1/keys", body)
+		if rr.Code != http.StatusBadRequest || errorBody(t, rr) != msg {
+			t.Fatalf("%s: expected 400 %s, got %d: %s", field, msg, rr.Code, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/farovictor/bifrost/pkg/events"
+)
+
+// recordEvents subscribes to every event published on env's bus.
+func recordEvents(env *TestEnv) *[]events.Event {
+	var got []events.Event
+	env.Server.Events.Subscribe(func(_ context.Context, m events.Message) error {
+		got = append(got, m.Event)
+		return nil
+	})
+	return &got
+}
+
+func TestHandlersPublishEvents(t *testing.T) {
+	env := newTestEnv(t)
+	got := recordEvents(env)
+
+	for _, step := range []struct {
+		method, path string
+		body         any
+		want         int
+	}{
+		{http.MethodPost, "/v1/rootkeys", map[string]string{"id": "rk1", "api_key": "sk-1"}, http.StatusCreated},
+		{http.MethodPut, "/v1/rootkeys/rk1", map[string]string{"api_key": "sk-2"}, http.StatusNoContent},
+		{http.MethodPost, "/v1/services", map[string]string{"id": "svc1", "endpoint": "http://upstream", "root_key_id": "rk1"}, http.StatusCreated},
+		{http.MethodPut, "/v1/services/svc1", map[string]string{"id": "svc1", "endpoint": "http://upstream2", "root_key_id": "rk1"}, http.StatusOK},
+		{http.MethodDelete, "/v1/services/svc1", nil, http.StatusNoContent},
+		{http.MethodPost, "/v1/orgs", map[string]string{"id": "o1", "name": "Acme"}, http.StatusCreated},
+		{http.MethodPost, "/v1/orgs/o1/members", map[string]string{"user_id": "u2", "role": "admin"}, http.StatusCreated},
+		{http.MethodDelete, "/v1/orgs/o1/members/u2", nil, http.StatusNoContent},
+		{http.MethodDelete, "/v1/rootkeys/rk1", nil, http.StatusNoContent},
+	} {
+		if rr := env.Do(orgToken(t, env, "o1"), step.method, step.path, step.body); rr.Code != step.want {
+			t.Fatalf("%s %s: expected %d, got %d: %s", step.method, step.path, step.want, rr.Code, rr.Body.String())
+		}
+	}
+
+	actor := env.User.ID
+	want := []events.Event{
+		events.RootKeyCreated{RootKeyID: "rk1", OrgID: "o1", Meta: events.Meta{Actor: actor}},
+		events.RootKeyRotated{RootKeyID: "rk1", OrgID: "o1", Meta: events.Meta{Actor: actor}},
+		events.ServiceCreated{ServiceID: "svc1", RootKeyID: "rk1", OrgID: "o1", Meta: events.Meta{Actor: actor}},
+		events.ServiceUpdated{ServiceID: "svc1", RootKeyID: "rk1", OrgID: "o1", Meta: events.Meta{Actor: actor}},
+		events.ServiceDeleted{ServiceID: "svc1", OrgID: "o1", Meta: events.Meta{Actor: actor}},
+		events.OrgCreated{OrgID: "o1", Name: "Acme", Meta: events.Meta{Actor: actor}},
+		events.MemberAdded{OrgID: "o1", UserID: "u2", Role: "admin", Meta: events.Meta{Actor: actor}},
+		events.MemberRemoved{OrgID: "o1", UserID: "u2", Meta: events.Meta{Actor: actor}},
+		events.RootKeyDeleted{RootKeyID: "rk1", OrgID: "o1", Meta: events.Meta{Actor: actor}},
+	}
+	if len(*got) != len(want) {
+		t.Fatalf("expected %d events, got %d: %+v", len(want), len(*got), *got)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(actorOnly((*got)[i]), want[i]) {
+			t.Fatalf("event %d: expected %+v, got %+v", i, want[i], (*got)[i])
+		}
+	}
+}
+
+func TestFailedRequestPublishesNoEvent(t *testing.T) {
+	env := newTestEnv(t)
+	got := recordEvents(env)
+
+	if rr := env.Do(orgToken(t, env, "o1"), http.MethodDelete, "/v1/services/missing", nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	if rr := env.Do(orgToken(t, env, "o1"), http.MethodPost, "/v1/services", map[string]string{"id": "s", "endpoint": "http://x", "root_key_id": "missing"}); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	if len(*got) != 0 {
+		t.Fatalf("expected no events, got %+v", *got)
+	}
+}
+
+// actorOnly returns e with every field of its Meta but the actor cleared, so
+// that request details do not need to be predicted.
+func actorOnly(e events.Event) events.Event {
+	v := reflect.New(reflect.TypeOf(e)).Elem()
+	v.Set(reflect.ValueOf(e))
+	if m := v.FieldByName("Meta"); m.IsValid() {
+		m.Set(reflect.ValueOf(events.Meta{Actor: m.Interface().(events.Meta).Actor}))
+	}
+	return v.Interface().(events.Event)
+}
@@ -1,25 +1,36 @@
 package tests
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/farovictor/bifrost/pkg/anomaly"
+	"github.com/farovictor/bifrost/pkg/audit"
+	"github.com/farovictor/bifrost/pkg/auth"
+	"github.com/farovictor/bifrost/pkg/events"
 	"github.com/farovictor/bifrost/pkg/keys"
 	"github.com/farovictor/bifrost/pkg/orgs"
+	"github.com/farovictor/bifrost/pkg/quotas"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+	"github.com/farovictor/bifrost/pkg/reports"
 	"github.com/farovictor/bifrost/pkg/rootkeys"
 	"github.com/farovictor/bifrost/pkg/serviceaccounts"
 	"github.com/farovictor/bifrost/pkg/services"
 	"github.com/farovictor/bifrost/pkg/usage"
 	"github.com/farovictor/bifrost/pkg/users"
+	"github.com/farovictor/bifrost/pkg/webhooks"
 	routes "github.com/farovictor/bifrost/routes"
 )
 
 // newTestServer returns a Server wired with empty in-memory stores.
 func newTestServer(t *testing.T) *routes.Server {
 	t.Helper()
-	return &routes.Server{
+	hooks := webhooks.NewMemoryStore()
+	s := &routes.Server{
 		UserStore:           users.NewMemoryStore(),
 		KeyStore:            keys.NewMemoryStore(),
 		RootKeyStore:        rootkeys.NewMemoryStore(),
@@ -27,8 +38,23 @@ func newTestServer(t *testing.T) *routes.Server {
 		OrgStore:            orgs.NewMemoryStore(),
 		MembershipStore:     orgs.NewMemoryMembershipStore(),
 		UsageStore:          usage.NewMemoryStore(),
+		UsageStream:         usage.NewBroadcaster(),
 		ServiceAccountStore: serviceaccounts.NewMemoryStore(),
+		QuotaStore:          quotas.NewMemoryStore(),
+		AnomalyStore:        anomaly.NewMemoryStore(),
+		ReportStore:         reports.NewMemoryStore(),
+		WebhookStore:        hooks,
+		AuditStore:          audit.NewMemoryStore(),
+		Webhooks:            webhooks.NewDispatcher(hooks, webhooks.DispatcherOptions{Backoff: time.Millisecond}),
+		Limiter:             ratelimit.NewLocal(),
+		Adaptive:            ratelimit.NewAdaptive(time.Minute),
+		Events:              events.New(events.Options{}),
 	}
+	s.AttachEvents()
+	s.Webhooks.Subscribe(s.Events)
+	audit.Subscribe(s.Events, s.AuditStore)
+	s.Adaptive.Subscribe(s.Events)
+	return s
 }
 
 // TestEnv bundles everything a management-endpoint test needs: a server with
@@ -46,6 +72,33 @@ func (e *TestEnv) Authorize(req *http.Request) {
 	req.Header.Set("Authorization", "Bearer "+e.Token)
 }
 
+// Do serves a management request made with token, encoding body, if any,
+// as JSON.
+func (e *TestEnv) Do(token, method, path string, body any) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("X-API-Key", e.User.APIKey)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	e.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+// orgToken returns a token for the env's user acting in org, as its owner
+// unless the test seeded another role.
+func orgToken(t *testing.T, env *TestEnv, org string) string {
+	t.Helper()
+	env.Server.MembershipStore.Create(orgs.Membership{UserID: env.User.ID, OrgID: org, Role: orgs.RoleOwner})
+	tok, err := auth.Sign(auth.AuthToken{UserID: env.User.ID, OrgID: org, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
 // errorBody decodes a JSON {"error":"..."} response body and returns the message.
 func errorBody(t *testing.T, rr *httptest.ResponseRecorder) string {
 	t.Helper()
@@ -58,6 +111,16 @@ func errorBody(t *testing.T, rr *httptest.ResponseRecorder) string {
 	return resp.Error
 }
 
+// totalTokens returns the lifetime tokens store holds for keyID.
+func totalTokens(t *testing.T, store usage.Store, keyID string) int64 {
+	t.Helper()
+	totals, err := store.Totals(keyID)
+	if err != nil {
+		t.Fatalf("totals of %s: %v", keyID, err)
+	}
+	return totals.Tokens
+}
+
 // newTestEnv creates a TestEnv with a default user already seeded.
 // Use this for tests that call management endpoints requiring auth.
 func newTestEnv(t *testing.T) *TestEnv {
@@ -67,6 +130,11 @@ func newTestEnv(t *testing.T) *TestEnv {
 	if err := s.UserStore.Create(u); err != nil {
 		t.Fatalf("seed user: %v", err)
 	}
+	// The token carries no org, so the user owns the empty org to pass
+	// permission checks like a single-tenant admin.
+	if err := s.MembershipStore.Create(orgs.Membership{UserID: u.ID, Role: orgs.RoleOwner}); err != nil {
+		t.Fatalf("seed membership: %v", err)
+	}
 	return &TestEnv{
 		Server: s,
 		Router: setupRouter(s),
@@ -45,6 +45,33 @@ func TestCreateKey(t *testing.T) {
 	}
 }
 
+func TestCreateKeyIgnoresServerFields(t *testing.T) {
+	env := newTestEnv(t)
+	svc := services.Service{ID: "svc", Endpoint: "http://example.com", RootKeyID: "rk"}
+	if err := env.Server.ServiceStore.Create(svc); err != nil {
+		t.Fatalf("seed service: %v", err)
+	}
+
+	k := keys.VirtualKey{ID: "abc", Scope: "read", Target: svc.ID, ExpiresAt: time.Now().Add(time.Hour), RateLimit: 1,
+		OneShot: true, Used: true, ServiceAccountID: "sa1", Suspended: true}
+	body, _ := json.Marshal(k)
+	req := httptest.NewRequest(http.MethodPost, "/v1/keys", bytes.NewReader(body))
+	env.Authorize(req)
+	rr := httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	got, err := env.Server.KeyStore.Get(k.ID)
+	if err != nil {
+		t.Fatalf("get key: %v", err)
+	}
+	if got.Used || got.ServiceAccountID != "" || got.Suspended {
+		t.Fatalf("expected server-set fields to be cleared, got %+v", got)
+	}
+}
+
 func TestDeleteKey(t *testing.T) {
 	env := newTestEnv(t)
 	k := keys.VirtualKey{ID: "dead", Scope: "x", Target: "svc", ExpiresAt: time.Now(), RateLimit: 1}
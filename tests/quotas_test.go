@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/quotas"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+	"github.com/farovictor/bifrost/pkg/rootkeys"
+	"github.com/farovictor/bifrost/pkg/services"
+)
+
+// seedQuotaProxy registers a service backed by a server reporting
+// totalTokens of usage and a key targeting it with the given attribution.
+func seedQuotaProxy(t *testing.T, env *TestEnv, k keys.VirtualKey, totalTokens int) {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"usage": map[string]int{"total_tokens": totalTokens},
+		})
+	}))
+	t.Cleanup(backend.Close)
+
+	rk := rootkeys.RootKey{ID: "rk-quota", APIKey: "real", OrgID: k.OrgID}
+	env.Server.RootKeyStore.Create(rk)
+	env.Server.ServiceStore.Create(services.Service{ID: k.Target, Endpoint: backend.URL, RootKeyID: rk.ID, OrgID: k.OrgID})
+	k.Scope = keys.ScopeWrite
+	k.RateLimit = 100
+	k.ExpiresAt = time.Now().Add(time.Hour)
+	if err := env.Server.KeyStore.Create(k); err != nil {
+		t.Fatalf("seed key: %v", err)
+	}
+}
+
+func createQuota(t *testing.T, env *TestEnv, q quotas.Quota) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(q)
+	req := httptest.NewRequest(http.MethodPost, "/v1/quotas", bytes.NewReader(body))
+	env.Authorize(req)
+	rr := httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+func proxyWithKey(env *TestEnv, keyID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/proxy/chat", strings.NewReader(body))
+	req.Header.Set("X-Virtual-Key", keyID)
+	rr := httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestQuotaCRUD(t *testing.T) {
+	env := newTestEnv(t)
+
+	rr := createQuota(t, env, quotas.Quota{Scope: "team", ScopeID: "x", Metric: quotas.MetricRequests, Period: quotas.PeriodDay, Limit: 1})
+	if rr.Code != http.StatusBadRequest || errorBody(t, rr) != "invalid scope" {
+		t.Fatalf("expected 400 invalid scope, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = createQuota(t, env, quotas.Quota{Scope: quotas.ScopeOrg, ScopeID: "o", Metric: quotas.MetricRequests, Period: "week", Limit: 1})
+	if rr.Code != http.StatusBadRequest || errorBody(t, rr) != "invalid period" {
+		t.Fatalf("expected 400 invalid period, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = createQuota(t, env, quotas.Quota{ID: "q1", Scope: quotas.ScopeOrg, ScopeID: "o", Metric: quotas.MetricRequests, Period: quotas.PeriodDay, Limit: 10})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := createQuota(t, env, quotas.Quota{ID: "q1", Scope: quotas.ScopeOrg, ScopeID: "o", Metric: quotas.MetricRequests, Period: quotas.PeriodDay, Limit: 10}); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/quotas", nil)
+	env.Authorize(req)
+	rr = httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	var list []map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list) != 1 {
+		t.Fatalf("unexpected list: %s", rr.Body.String())
+	}
+	if list[0]["remaining"] != float64(10) || list[0]["used"] != float64(0) {
+		t.Fatalf("unexpected consumption: %v", list[0])
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/v1/quotas/q1", nil)
+	env.Authorize(req)
+	rr = httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/quotas/q1", nil)
+	env.Authorize(req)
+	rr = httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+}
+
+func TestOrgRequestQuotaTrips(t *testing.T) {
+	env := newTestEnv(t)
+	keyID, quotaID := "vk-org", "q-org"
+	seedQuotaProxy(t, env, keys.VirtualKey{ID: keyID, Target: "svc-quota", OrgID: "org-1"}, 0)
+
+	if rr := createQuota(t, env, quotas.Quota{ID: quotaID, Scope: quotas.ScopeOrg, ScopeID: "org-1", Metric: quotas.MetricRequests, Period: quotas.PeriodDay, Limit: 2}); rr.Code != http.StatusCreated {
+		t.Fatalf("create quota: %d", rr.Code)
+	}
+
+	for i := 1; i <= 2; i++ {
+		rr := proxyWithKey(env, keyID, `{}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, rr.Code)
+		}
+		// The org quota is tighter than the key's own limit of 100.
+		if got, want := rr.Header().Get(ratelimit.HeaderRemaining), fmt.Sprint(2-i); got != want {
+			t.Fatalf("request %d: expected RateLimit-Remaining %s, got %s", i, want, got)
+		}
+	}
+
+	rr := proxyWithKey(env, keyID, `{}`)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rr.Code)
+	}
+	var body ratelimit.ErrorResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.Reason != ratelimit.ReasonQuotaExceeded || body.Level != quotas.ScopeOrg || body.QuotaID != quotaID {
+		t.Fatalf("unexpected 429 body: %+v", body)
+	}
+}
+
+func TestServiceAccountTokenQuota(t *testing.T) {
+	env := newTestEnv(t)
+	seedQuotaProxy(t, env, keys.VirtualKey{ID: "vk-sa-quota", Target: "svc-quota", ServiceAccountID: "sa-1"}, 80)
+
+	if rr := createQuota(t, env, quotas.Quota{ID: "q-sa", Scope: quotas.ScopeServiceAccount, ScopeID: "sa-1", Metric: quotas.MetricTokens, Period: quotas.PeriodMonth, Limit: 100}); rr.Code != http.StatusCreated {
+		t.Fatalf("create quota: %d", rr.Code)
+	}
+
+	if rr := proxyWithKey(env, "vk-sa-quota", `{}`); rr.Code != http.StatusOK {
+		t.Fatalf("first request: expected 200, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/quotas/q-sa", nil)
+	env.Authorize(req)
+	rr := httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	var st map[string]any
+	json.Unmarshal(rr.Body.Bytes(), &st)
+	if st["used"] != float64(80) || st["remaining"] != float64(20) {
+		t.Fatalf("unexpected consumption: %s", rr.Body.String())
+	}
+
+	rr = proxyWithKey(env, "vk-sa-quota", `{"max_tokens":50}`)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: expected 429, got %d", rr.Code)
+	}
+	var body ratelimit.ErrorResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.Reason != ratelimit.ReasonQuotaExceeded || body.Level != quotas.ScopeServiceAccount {
+		t.Fatalf("unexpected 429 body: %+v", body)
+	}
+}
@@ -1,16 +1,20 @@
 package tests
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	rl "github.com/farovictor/bifrost/middlewares"
 	"github.com/go-chi/chi/v5"
+	redis "github.com/redis/go-redis/v9"
 
 	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
 	"github.com/farovictor/bifrost/pkg/rootkeys"
 	"github.com/farovictor/bifrost/pkg/services"
 	routes "github.com/farovictor/bifrost/routes"
@@ -22,10 +26,12 @@ func setupRouterRL(s *routes.Server) http.Handler {
 		KeyStore:     s.KeyStore,
 		ServiceStore: s.ServiceStore,
 		RootKeyStore: s.RootKeyStore,
+		QuotaStore:   s.QuotaStore,
+		Limiter:      s.Limiter,
 	}
 	r := chi.NewRouter()
 	r.Route("/v1", func(r chi.Router) {
-		r.With(rl.RateLimitMiddleware(s.KeyStore)).Handle("/proxy/{rest:.*}", http.HandlerFunc(v1h.Proxy))
+		r.With(rl.RateLimitMiddleware(s.Limiter, s.KeyStore, s.QuotaStore, nil)).Handle("/proxy/{rest:.*}", http.HandlerFunc(v1h.Proxy))
 	})
 	return r
 }
@@ -71,3 +77,150 @@ func TestRateLimitExceeded(t *testing.T) {
 		t.Fatalf("expected 429, got %d", rr2.Code)
 	}
 }
+
+func TestRateLimitHeaders(t *testing.T) {
+	s := newTestServer(t)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	rk := rootkeys.RootKey{ID: "rk", APIKey: "real"}
+	s.RootKeyStore.Create(rk)
+	svc := services.Service{ID: "svc", Endpoint: backend.URL, RootKeyID: rk.ID}
+	s.ServiceStore.Create(svc)
+	keyID := fmt.Sprintf("hdr-%d", time.Now().UnixNano())
+	k := keys.VirtualKey{ID: keyID, Target: svc.ID, Scope: keys.ScopeRead, ExpiresAt: time.Now().Add(time.Hour), RateLimit: 2}
+	s.KeyStore.Create(k)
+
+	router := setupRouterRL(s)
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/proxy/test", nil)
+		req.Header.Set("X-Virtual-Key", keyID)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if got := rr.Header().Get(ratelimit.HeaderLimit); got != "2" {
+		t.Fatalf("expected RateLimit-Limit 2, got %q", got)
+	}
+	if got := rr.Header().Get(ratelimit.HeaderRemaining); got != "1" {
+		t.Fatalf("expected RateLimit-Remaining 1, got %q", got)
+	}
+	if got := rr.Header().Get(ratelimit.HeaderReset); got == "" || got == "0" {
+		t.Fatalf("expected positive RateLimit-Reset, got %q", got)
+	}
+
+	send()
+	rr = send()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rr.Code)
+	}
+	if got := rr.Header().Get(ratelimit.HeaderRetryAfter); got == "" {
+		t.Fatalf("expected Retry-After on 429")
+	}
+	var body ratelimit.ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode 429 body: %v (raw: %s)", err, rr.Body.String())
+	}
+	if body.Reason != ratelimit.ReasonRateLimited || body.Error != "rate limit exceeded" {
+		t.Fatalf("unexpected 429 body: %+v", body)
+	}
+}
+
+func TestRateLimitBurst(t *testing.T) {
+	s := newTestServer(t)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	rk := rootkeys.RootKey{ID: "rk", APIKey: "real"}
+	if err := s.RootKeyStore.Create(rk); err != nil {
+		t.Fatalf("seed rootkey: %v", err)
+	}
+	svc := services.Service{ID: "svc", Endpoint: backend.URL, RootKeyID: rk.ID}
+	if err := s.ServiceStore.Create(svc); err != nil {
+		t.Fatalf("seed service: %v", err)
+	}
+	keyID := fmt.Sprintf("burst-%d", time.Now().UnixNano())
+	k := keys.VirtualKey{
+		ID:              keyID,
+		Target:          svc.ID,
+		Scope:           keys.ScopeRead,
+		ExpiresAt:       time.Now().Add(time.Hour),
+		RateLimit:       100,
+		RateLimitWindow: keys.WindowDay,
+		RateLimitBurst:  3,
+	}
+	if err := s.KeyStore.Create(k); err != nil {
+		t.Fatalf("seed key: %v", err)
+	}
+
+	router := setupRouterRL(s)
+
+	for i := 1; i <= 4; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/v1/proxy/test", nil)
+		req.Header.Set("X-Virtual-Key", keyID)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		want := http.StatusOK
+		if i == 4 {
+			want = http.StatusTooManyRequests
+		}
+		if rr.Code != want {
+			t.Fatalf("request %d: expected %d, got %d", i, want, rr.Code)
+		}
+	}
+}
+
+func TestRateLimitFailClosedReportsDegraded(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+	health := ratelimit.NewHealth("redis", ratelimit.FailClosed)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	s := newTestServer(t)
+	s.Limiter = ratelimit.NewGuard(ratelimit.NewRedis(client), ratelimit.FailClosed, health)
+	s.RateLimitHealthCheck = health
+	rk := rootkeys.RootKey{ID: "rk", APIKey: "real"}
+	s.RootKeyStore.Create(rk)
+	s.ServiceStore.Create(services.Service{ID: "svc", Endpoint: "http://127.0.0.1:1", RootKeyID: rk.ID})
+	s.KeyStore.Create(keys.VirtualKey{ID: "vk", Target: "svc", Scope: keys.ScopeRead, ExpiresAt: time.Now().Add(time.Hour), RateLimit: 100})
+	router := setupRouter(s)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/proxy/test", nil)
+	req.Header.Set("X-Virtual-Key", "vk")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 while redis is down, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz/ratelimit", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rr.Code)
+	}
+	var st ratelimit.HealthStatus
+	json.Unmarshal(rr.Body.Bytes(), &st)
+	if !st.Degraded || st.Policy != ratelimit.FailClosed || st.LastError == "" {
+		t.Fatalf("unexpected health: %+v", st)
+	}
+
+	mr.SetError("")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req.Clone(req.Context()))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz/ratelimit", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 after recovery, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,237 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/auth"
+	"github.com/farovictor/bifrost/pkg/orgs"
+	"github.com/farovictor/bifrost/pkg/users"
+)
+
+// roleToken returns a token for a user holding role in org o1, or no
+// membership at all when role is empty.
+func roleToken(t *testing.T, env *TestEnv, role string) string {
+	t.Helper()
+	u := users.User{ID: "user-" + role, Name: role, Email: role + "@example.com", APIKey: "key-" + role}
+	if _, err := env.Server.UserStore.Get(u.ID); err != nil {
+		env.Server.UserStore.Create(u)
+		if role != "" {
+			env.Server.MembershipStore.Create(orgs.Membership{UserID: u.ID, OrgID: "o1", Role: role})
+		}
+	}
+	tok, err := auth.Sign(auth.AuthToken{UserID: u.ID, OrgID: "o1", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+func TestRolePermissionsOnEndpoints(t *testing.T) {
+	endpoints := []struct {
+		method, path string
+		perm         string
+	}{
+		{http.MethodPost, "/v1/users", orgs.PermMembersWrite},
+		{http.MethodPost, "/v1/user/rootkeys", orgs.PermRootKeysWrite},
+		{http.MethodGet, "/v1/keys", orgs.PermKeysRead},
+		{http.MethodPost, "/v1/keys", orgs.PermKeysWrite},
+		{http.MethodDelete, "/v1/keys/k1", orgs.PermKeysWrite},
+		{http.MethodGet, "/v1/keys/k1/usage", orgs.PermUsageRead},
+		{http.MethodGet, "/v1/usage/summary", orgs.PermUsageRead},
+		{http.MethodGet, "/v1/usage/export", orgs.PermUsageRead},
+		{http.MethodGet, "/v1/usage/stream", orgs.PermUsageRead},
+		{http.MethodGet, "/v1/anomalies", orgs.PermAnomaliesRead},
+		{http.MethodPost, "/v1/anomalies/f1/resolve", orgs.PermAnomaliesWrite},
+		{http.MethodGet, "/v1/audit", orgs.PermAuditRead},
+		{http.MethodGet, "/v1/rootkeys", orgs.PermRootKeysRead},
+		{http.MethodPost, "/v1/rootkeys", orgs.PermRootKeysWrite},
+		{http.MethodPut, "/v1/rootkeys/rk1", orgs.PermRootKeysWrite},
+		{http.MethodDelete, "/v1/rootkeys/rk1", orgs.PermRootKeysWrite},
+		{http.MethodGet, "/v1/services", orgs.PermServicesRead},
+		{http.MethodPost, "/v1/services", orgs.PermServicesWrite},
+		{http.MethodPut, "/v1/services/svc1", orgs.PermServicesWrite},
+		{http.MethodDelete, "/v1/services/svc1", orgs.PermServicesWrite},
+		{http.MethodGet, "/v1/services/svc1/adaptive", orgs.PermServicesRead},
+		{http.MethodGet, "/v1/quotas", orgs.PermQuotasRead},
+		{http.MethodPost, "/v1/quotas", orgs.PermQuotasWrite},
+		{http.MethodGet, "/v1/quotas/q1", orgs.PermQuotasRead},
+		{http.MethodDelete, "/v1/quotas/q1", orgs.PermQuotasWrite},
+		{http.MethodGet, "/v1/serviceaccounts", orgs.PermServiceAccountsRead},
+		{http.MethodPost, "/v1/serviceaccounts", orgs.PermServiceAccountsWrite},
+		{http.MethodDelete, "/v1/serviceaccounts/sa1", orgs.PermServiceAccountsWrite},
+		{http.MethodGet, "/v1/orgs", orgs.PermOrgsRead},
+		{http.MethodPost, "/v1/orgs", orgs.PermOrgsWrite},
+		{http.MethodGet, "/v1/orgs/o1", orgs.PermOrgsRead},
+		{http.MethodDelete, "/v1/orgs/o1", orgs.PermOrgsDelete},
+		{http.MethodGet, "/v1/orgs/o1/anomaly-policy", orgs.PermAnomaliesRead},
+		{http.MethodPut, "/v1/orgs/o1/anomaly-policy", orgs.PermAnomaliesWrite},
+		{http.MethodGet, "/v1/orgs/o1/reports/2026-01", orgs.PermUsageRead},
+		{http.MethodGet, "/v1/orgs/o1/webhooks", orgs.PermWebhooksRead},
+		{http.MethodPost, "/v1/orgs/o1/webhooks", orgs.PermWebhooksWrite},
+		{http.MethodGet, "/v1/orgs/o1/webhooks/w1", orgs.PermWebhooksRead},
+		{http.MethodPut, "/v1/orgs/o1/webhooks/w1", orgs.PermWebhooksWrite},
+		{http.MethodDelete, "/v1/orgs/o1/webhooks/w1", orgs.PermWebhooksWrite},
+		{http.MethodGet, "/v1/orgs/o1/webhooks/w1/deliveries", orgs.PermWebhooksRead},
+		{http.MethodPost, "/v1/orgs/o1/webhooks/w1/deliveries/d1/redeliver", orgs.PermWebhooksWrite},
+		{http.MethodGet, "/v1/orgs/o1/members", orgs.PermMembersRead},
+		{http.MethodPost, "/v1/orgs/o1/members", orgs.PermMembersWrite},
+		{http.MethodDelete, "/v1/orgs/o1/members/u2", orgs.PermMembersWrite},
+	}
+	memberAllowed := map[string]bool{
+		orgs.PermKeysRead:      true,
+		orgs.PermKeysWrite:     true,
+		orgs.PermServicesRead:  true,
+		orgs.PermQuotasRead:    true,
+		orgs.PermUsageRead:     true,
+		orgs.PermAnomaliesRead: true,
+		orgs.PermOrgsRead:      true,
+		orgs.PermMembersRead:   true,
+	}
+	roles := []struct {
+		role    string
+		allowed func(perm string) bool
+	}{
+		{orgs.RoleOwner, func(string) bool { return true }},
+		{orgs.RoleAdmin, func(perm string) bool { return perm != orgs.PermOrgsDelete }},
+		{orgs.RoleMember, func(perm string) bool { return memberAllowed[perm] }},
+		{"", func(string) bool { return false }},
+	}
+
+	for _, ep := range endpoints {
+		for _, rc := range roles {
+			name := rc.role
+			if name == "" {
+				name = "non-member"
+			}
+			t.Run(ep.method+" "+ep.path+" as "+name, func(t *testing.T) {
+				env := newTestEnv(t)
+				// Without a stream the stream endpoint answers at once.
+				env.Server.UsageStream = nil
+				env.Server.OrgStore.Create(orgs.Organization{ID: "o1", Name: "O1"})
+
+				rr := env.Do(roleToken(t, env, rc.role), ep.method, ep.path, map[string]string{})
+				if rc.allowed(ep.perm) {
+					if rr.Code == http.StatusForbidden {
+						t.Fatalf("expected access, got 403: %s", rr.Body.String())
+					}
+					return
+				}
+				if rr.Code != http.StatusForbidden {
+					t.Fatalf("expected 403, got %d: %s", rr.Code, rr.Body.String())
+				}
+				if msg := errorBody(t, rr); msg != "missing permission: "+ep.perm {
+					t.Fatalf("unexpected error %q", msg)
+				}
+			})
+		}
+	}
+}
+
+func TestAdminCannotManageOwners(t *testing.T) {
+	env := newTestEnv(t)
+	env.Server.OrgStore.Create(orgs.Organization{ID: "o1", Name: "O1"})
+	env.Server.MembershipStore.Create(orgs.Membership{UserID: "boss", OrgID: "o1", Role: orgs.RoleOwner})
+
+	rr := env.Do(roleToken(t, env, orgs.RoleAdmin), http.MethodPost, "/v1/orgs/o1/members", map[string]string{"user_id": "u2", "role": orgs.RoleOwner})
+	if rr.Code != http.StatusForbidden || errorBody(t, rr) != "missing permission: "+orgs.PermMembersOwners {
+		t.Fatalf("admin adding owner: got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = env.Do(roleToken(t, env, orgs.RoleAdmin), http.MethodDelete, "/v1/orgs/o1/members/boss", nil)
+	if rr.Code != http.StatusForbidden || errorBody(t, rr) != "missing permission: "+orgs.PermMembersOwners {
+		t.Fatalf("admin removing owner: got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = env.Do(roleToken(t, env, orgs.RoleAdmin), http.MethodPost, "/v1/users", map[string]string{"name": "N", "email": "n@example.com", "org_id": "o1", "role": orgs.RoleOwner})
+	if rr.Code != http.StatusForbidden || errorBody(t, rr) != "missing permission: "+orgs.PermMembersOwners {
+		t.Fatalf("admin creating owner: got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = env.Do(roleToken(t, env, orgs.RoleAdmin), http.MethodPost, "/v1/orgs/o1/members", map[string]string{"user_id": "u2", "role": orgs.RoleAdmin})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("admin adding admin: got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = env.Do(roleToken(t, env, orgs.RoleOwner), http.MethodPost, "/v1/orgs/o1/members", map[string]string{"user_id": "u3", "role": orgs.RoleOwner})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("owner adding owner: got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = env.Do(roleToken(t, env, orgs.RoleOwner), http.MethodDelete, "/v1/orgs/o1/members/boss", nil)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("owner removing owner: got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRemovedMemberDeniedOnSQLite(t *testing.T) {
+	// SQLite deployments skip verification only for tokens that fail it; a
+	// verified user without a membership gets nothing.
+	t.Setenv("BIFROST_DB", "sqlite")
+	env := newTestEnv(t)
+	env.Server.OrgStore.Create(orgs.Organization{ID: "o1", Name: "O1"})
+	tok := roleToken(t, env, orgs.RoleMember)
+	if rr := env.Do(tok, http.MethodGet, "/v1/keys", nil); rr.Code != http.StatusOK {
+		t.Fatalf("member listing keys: got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr := env.Do(roleToken(t, env, orgs.RoleOwner), http.MethodDelete, "/v1/orgs/o1/members/user-"+orgs.RoleMember, nil)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("removing member: got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = env.Do(tok, http.MethodGet, "/v1/keys", nil)
+	if rr.Code != http.StatusForbidden || errorBody(t, rr) != "missing permission: "+orgs.PermKeysRead {
+		t.Fatalf("removed member listing keys: got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestMemberRoutesScopedToCallerOrg(t *testing.T) {
+	env := newTestEnv(t)
+	env.Server.OrgStore.Create(orgs.Organization{ID: "o2", Name: "O2"})
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/v1/orgs/o2/members"},
+		{http.MethodPost, "/v1/orgs/o2/members"},
+		{http.MethodDelete, "/v1/orgs/o2/members/u2"},
+		{http.MethodDelete, "/v1/orgs/o2"},
+		{http.MethodGet, "/v1/orgs/o2"},
+	} {
+		rr := env.Do(roleToken(t, env, orgs.RoleOwner), tc.method, tc.path, map[string]string{"user_id": "u2"})
+		if rr.Code != http.StatusForbidden {
+			t.Fatalf("%s %s: expected 403, got %d", tc.method, tc.path, rr.Code)
+		}
+	}
+	if _, err := env.Server.OrgStore.Get("o2"); err != nil {
+		t.Fatalf("org o2 deleted: %v", err)
+	}
+}
+
+func TestCreateUserScopedToCallerOrg(t *testing.T) {
+	env := newTestEnv(t)
+	env.Server.OrgStore.Create(orgs.Organization{ID: "o1", Name: "O1"})
+	env.Server.OrgStore.Create(orgs.Organization{ID: "o2", Name: "O2"})
+
+	for _, role := range []string{orgs.RoleAdmin, orgs.RoleOwner} {
+		rr := env.Do(roleToken(t, env, orgs.RoleOwner), http.MethodPost, "/v1/users", map[string]string{"name": "N", "email": role + "@o2.example.com", "org_id": "o2", "role": role})
+		if rr.Code != http.StatusForbidden {
+			t.Fatalf("%s of o2 created by o1: got %d: %s", role, rr.Code, rr.Body.String())
+		}
+	}
+	if mems := env.Server.MembershipStore.ListByOrg("o2"); len(mems) != 0 {
+		t.Fatalf("members added to o2: %+v", mems)
+	}
+
+	rr := env.Do(roleToken(t, env, orgs.RoleAdmin), http.MethodPost, "/v1/users", map[string]string{"name": "N", "email": "n@o1.example.com", "org_id": "o1", "role": orgs.RoleAdmin})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("admin of o1 created by o1: got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRoleMatrix(t *testing.T) {
+	if !orgs.Can(orgs.RoleOwner, orgs.PermOrgsDelete) || orgs.Can(orgs.RoleAdmin, orgs.PermOrgsDelete) {
+		t.Fatal("only owners may delete orgs")
+	}
+	if orgs.Can(orgs.RoleMember, orgs.PermRootKeysWrite) || !orgs.Can(orgs.RoleAdmin, orgs.PermRootKeysWrite) {
+		t.Fatal("root keys are managed by admins")
+	}
+	if orgs.Can("", orgs.PermKeysRead) || orgs.Can("guest", orgs.PermKeysRead) {
+		t.Fatal("unknown roles grant nothing")
+	}
+}
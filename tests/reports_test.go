@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/orgs"
+	"github.com/farovictor/bifrost/pkg/reports"
+	"github.com/farovictor/bifrost/pkg/services"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+// seedReport creates org o1 and o2 and records March 2025 usage for both.
+func seedReport(t *testing.T, env *TestEnv) {
+	t.Helper()
+	for _, o := range []orgs.Organization{{ID: "o1", Name: "one"}, {ID: "o2", Name: "two"}} {
+		if err := env.Server.OrgStore.Create(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env.Server.KeyStore.Create(keys.VirtualKey{ID: "k1", OrgID: "o1", Owner: "alice", Labels: map[string]string{"team": "search"}})
+	env.Server.KeyStore.Create(keys.VirtualKey{ID: "k2", OrgID: "o1"})
+	march := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	for _, e := range []usage.Event{
+		{KeyID: "k1", OrgID: "o1", Service: "openai", Model: "gpt-4o", Timestamp: march, TotalTokens: 100, CostUSD: 1},
+		{KeyID: "k1", OrgID: "o1", Service: "openai", Model: "gpt-4o", Timestamp: march, TotalTokens: 100, CostUSD: 1},
+		{KeyID: "k2", OrgID: "o1", Service: "anthropic", Model: "claude", Timestamp: march, TotalTokens: 50, CostUSD: 0.5},
+		{KeyID: "k3", OrgID: "o2", Service: "openai", Model: "gpt-4o", Timestamp: march, CostUSD: 7},
+		{KeyID: "k1", OrgID: "o1", Service: "openai", Model: "gpt-4o", Timestamp: march.AddDate(0, 1, 0), CostUSD: 7},
+	} {
+		env.Server.UsageStore.Record(e)
+	}
+}
+
+func TestGetOrgReport(t *testing.T) {
+	env := newTestEnv(t)
+	seedReport(t, env)
+
+	rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/orgs/o1/reports/2025-03", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var rep reports.Report
+	if err := json.Unmarshal(rr.Body.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+	if !rep.Final || rep.OrgID != "o1" || rep.Total.Requests != 3 || rep.Total.CostUSD != 2.5 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+	if len(rep.Owners) != 2 || rep.Owners[0].Name != "alice" || rep.Owners[1].Name != reports.Unassigned {
+		t.Fatalf("unexpected owners %+v", rep.Owners)
+	}
+	if len(rep.Labels) != 1 || rep.Labels[0].Name != "team=search" || rep.Labels[0].CostUSD != 2 {
+		t.Fatalf("unexpected labels %+v", rep.Labels)
+	}
+
+	// The final report was stored and is served as generated.
+	stored, err := env.Server.ReportStore.Get("o1", "2025-03")
+	if err != nil || !stored.GeneratedAt.Equal(rep.GeneratedAt) {
+		t.Fatalf("report not stored: %+v, %v", stored, err)
+	}
+	env.Server.UsageStore.Record(usage.Event{KeyID: "k1", OrgID: "o1", Service: "openai", Timestamp: time.Date(2025, 3, 20, 0, 0, 0, 0, time.UTC), CostUSD: 100})
+	rr = env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/orgs/o1/reports/2025-03", nil)
+	json.Unmarshal(rr.Body.Bytes(), &rep)
+	if rep.Total.CostUSD != 2.5 {
+		t.Fatalf("stored report regenerated: %+v", rep.Total)
+	}
+}
+
+func TestGetOrgReportCSV(t *testing.T) {
+	env := newTestEnv(t)
+	seedReport(t, env)
+
+	rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/orgs/o1/reports/2025-03?format=csv", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); !strings.Contains(cd, "report-o1-2025-03.csv") {
+		t.Fatalf("unexpected content disposition %q", cd)
+	}
+	rows, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows[0][0] != "section" || rows[1][0] != reports.SectionTotal || rows[1][6] != "2.5" {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+}
+
+func TestGetOrgReportErrors(t *testing.T) {
+	env := newTestEnv(t)
+	seedReport(t, env)
+
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{"/v1/orgs/o2/reports/2025-03", http.StatusForbidden},
+		{"/v1/orgs/o1/reports/2025-3", http.StatusBadRequest},
+		{"/v1/orgs/o1/reports/2999-01", http.StatusBadRequest},
+		{"/v1/orgs/o1/reports/2025-03?format=xml", http.StatusBadRequest},
+	} {
+		if rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, tc.path, nil); rr.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.path, tc.code, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := env.Do(orgToken(t, env, "o9"), http.MethodGet, "/v1/orgs/o9/reports/2025-03", nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing org, got %d", rr.Code)
+	}
+}
+
+func TestCreateKeyOwnerAndLabels(t *testing.T) {
+	env := newTestEnv(t)
+	env.Server.ServiceStore.Create(services.Service{ID: "svc", Endpoint: "http://example.com", RootKeyID: "rk", OrgID: "o1"})
+
+	body := map[string]any{"id": "lk", "scope": "read", "target": "svc", "rate_limit": 1,
+		"expires_at": time.Now().Add(time.Hour), "labels": map[string]string{"team": "search"}}
+	rr := env.Do(orgToken(t, env, "o1"), http.MethodPost, "/v1/keys", body)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	k, _ := env.Server.KeyStore.Get("lk")
+	if k.Owner != env.User.ID || k.Labels["team"] != "search" {
+		t.Fatalf("unexpected key %+v", k)
+	}
+
+	body["id"] = "bad"
+	body["labels"] = map[string]string{"team=x": "search"}
+	rr = env.Do(orgToken(t, env, "o1"), http.MethodPost, "/v1/keys", body)
+	if rr.Code != http.StatusBadRequest || errorBody(t, rr) != "invalid labels" {
+		t.Fatalf("expected 400 invalid labels, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
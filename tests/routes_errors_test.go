@@ -198,3 +198,25 @@ func TestCreateKeyPastExpiration(t *testing.T) {
 		t.Fatalf("unexpected error: %s", msg)
 	}
 }
+
+func TestCreateKeyInvalidWindow(t *testing.T) {
+	env := newTestEnv(t)
+	svc := services.Service{ID: "svc-window", Endpoint: "http://example.com", RootKeyID: "rk"}
+	if err := env.Server.ServiceStore.Create(svc); err != nil {
+		t.Fatalf("failed to seed service: %v", err)
+	}
+
+	k := keys.VirtualKey{ID: "badwindow", Scope: keys.ScopeRead, Target: svc.ID, ExpiresAt: time.Now().Add(time.Hour), RateLimit: 1, RateLimitWindow: "fortnight"}
+	body, _ := json.Marshal(k)
+	req := httptest.NewRequest(http.MethodPost, "/v1/keys", bytes.NewReader(body))
+	env.Authorize(req)
+	rr := httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rr.Code)
+	}
+	if msg := errorBody(t, rr); msg != "invalid rate_limit_window" {
+		t.Fatalf("unexpected error: %s", msg)
+	}
+}
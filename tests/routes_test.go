@@ -7,59 +7,107 @@ import (
 	"testing"
 
 	rl "github.com/farovictor/bifrost/middlewares"
+	"github.com/farovictor/bifrost/pkg/events"
+	"github.com/farovictor/bifrost/pkg/orgs"
+	"github.com/farovictor/bifrost/pkg/usage"
 	"github.com/go-chi/chi/v5"
 
 	routes "github.com/farovictor/bifrost/routes"
 	v1 "github.com/farovictor/bifrost/routes/v1"
 )
 
+// flushEvents delivers the events published while handling each request to
+// the asynchronous subscribers of b before the response is checked, since no
+// bus worker runs in tests.
+func flushEvents(b *events.Bus) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			b.Flush(r.Context())
+		})
+	}
+}
+
 func setupRouter(s *routes.Server) http.Handler {
+	var us usage.Store = s.UsageStore
+	if s.UsageStream != nil {
+		us = &usage.PublishingStore{Store: s.UsageStore, Publisher: s.UsageStream}
+	}
 	v1h := &v1.Handler{
 		KeyStore:     s.KeyStore,
 		ServiceStore: s.ServiceStore,
 		RootKeyStore: s.RootKeyStore,
-		UsageStore:   s.UsageStore,
+		UsageStore:   us,
+		QuotaStore:   s.QuotaStore,
+		Limiter:      s.Limiter,
+		Adaptive:     s.Adaptive,
 	}
 	r := chi.NewRouter()
+	r.Use(flushEvents(s.Events))
 	r.Get("/healthz", routes.Healthz)
+	r.Get("/healthz/ratelimit", s.RateLimitHealth)
 	r.Get("/version", routes.Version)
 	r.With(rl.AuthMiddleware(s.UserStore)).Post("/mcp", s.MCP)
 	r.Route("/v1", func(r chi.Router) {
-		r.With(rl.OrgCtxMiddleware(s.MembershipStore)).Post("/users", s.CreateUser)
+		r.With(rl.OrgCtxMiddleware(s.MembershipStore), rl.RequirePermission(orgs.PermMembersWrite)).Post("/users", s.CreateUser)
 		r.With(rl.OrgCtxMiddleware(s.MembershipStore)).Get("/user", s.GetUserInfo)
-		r.With(rl.OrgCtxMiddleware(s.MembershipStore)).Post("/user/rootkeys", s.CreateRootKey)
+		r.With(rl.OrgCtxMiddleware(s.MembershipStore), rl.RequirePermission(orgs.PermRootKeysWrite)).Post("/user/rootkeys", s.CreateRootKey)
 
 		r.Post("/token/refresh", s.RefreshToken)
 		r.Post("/service-token", s.ServiceToken)
-		r.With(rl.RateLimitMiddleware(s.KeyStore)).Handle("/proxy/*", http.HandlerFunc(v1h.Proxy))
+		r.With(rl.RateLimitMiddleware(s.Limiter, s.KeyStore, s.QuotaStore, us)).Handle("/proxy/*", http.HandlerFunc(v1h.Proxy))
 
 		r.Group(func(r chi.Router) {
 			r.Use(rl.AuthMiddleware(s.UserStore))
 			r.Use(rl.OrgCtxMiddleware(s.MembershipStore))
 			r.Get("/hello", v1.SayHello)
-			r.Get("/keys", s.ListKeys)
-			r.Post("/keys", s.CreateKey)
-			r.Delete("/keys/{id}", s.DeleteKey)
-			r.Get("/keys/{id}/usage", s.ListKeyUsage)
-			r.Get("/rootkeys", s.ListRootKeys)
-			r.Post("/rootkeys", s.CreateRootKey)
-			r.Put("/rootkeys/{id}", s.UpdateRootKey)
-			r.Delete("/rootkeys/{id}", s.DeleteRootKey)
-			r.Get("/services", s.ListServices)
-			r.Post("/services", s.CreateService)
-			r.Delete("/services/{id}", s.DeleteService)
-
-			r.Get("/serviceaccounts", s.ListServiceAccounts)
-			r.Post("/serviceaccounts", s.CreateServiceAccount)
-			r.Delete("/serviceaccounts/{id}", s.DeleteServiceAccount)
-
-			r.Get("/orgs", s.ListOrgs)
-			r.Post("/orgs", s.CreateOrg)
-			r.Get("/orgs/{id}", s.GetOrg)
-			r.Delete("/orgs/{id}", s.DeleteOrg)
-			r.Get("/orgs/{id}/members", s.ListOrgMembers)
-			r.Post("/orgs/{id}/members", s.AddOrgMember)
-			r.Delete("/orgs/{id}/members/{userID}", s.RemoveOrgMember)
+			r.With(rl.RequirePermission(orgs.PermKeysRead)).Get("/keys", s.ListKeys)
+			r.With(rl.RequirePermission(orgs.PermKeysWrite)).Post("/keys", s.CreateKey)
+			r.With(rl.RequirePermission(orgs.PermKeysWrite)).Delete("/keys/{id}", s.DeleteKey)
+			r.With(rl.RequirePermission(orgs.PermUsageRead)).Get("/keys/{id}/usage", s.ListKeyUsage)
+			r.With(rl.RequirePermission(orgs.PermUsageRead)).Get("/usage/summary", s.GetUsageSummary)
+			r.With(rl.RequirePermission(orgs.PermUsageRead)).Get("/usage/export", s.ExportUsage)
+			r.With(rl.RequirePermission(orgs.PermUsageRead)).Get("/usage/stream", s.StreamUsage)
+			r.With(rl.RequirePermission(orgs.PermAnomaliesRead)).Get("/anomalies", s.ListAnomalies)
+			r.With(rl.RequirePermission(orgs.PermAnomaliesWrite)).Post("/anomalies/{id}/resolve", s.ResolveAnomaly)
+			r.With(rl.RequirePermission(orgs.PermAuditRead)).Get("/audit", s.ListAudit)
+			r.With(rl.RequirePermission(orgs.PermAuditRead)).Get("/audit/export", s.ExportAudit)
+			r.With(rl.RequirePermission(orgs.PermRootKeysRead)).Get("/rootkeys", s.ListRootKeys)
+			r.With(rl.RequirePermission(orgs.PermRootKeysWrite)).Post("/rootkeys", s.CreateRootKey)
+			r.With(rl.RequirePermission(orgs.PermRootKeysWrite)).Put("/rootkeys/{id}", s.UpdateRootKey)
+			r.With(rl.RequirePermission(orgs.PermRootKeysWrite)).Delete("/rootkeys/{id}", s.DeleteRootKey)
+			r.With(rl.RequirePermission(orgs.PermServicesRead)).Get("/services", s.ListServices)
+			r.With(rl.RequirePermission(orgs.PermServicesWrite)).Post("/services", s.CreateService)
+			r.With(rl.RequirePermission(orgs.PermServicesWrite)).Put("/services/{id}", s.UpdateService)
+			r.With(rl.RequirePermission(orgs.PermServicesWrite)).Delete("/services/{id}", s.DeleteService)
+			r.With(rl.RequirePermission(orgs.PermServicesRead)).Get("/services/{id}/adaptive", s.GetServiceAdaptive)
+
+			r.With(rl.RequirePermission(orgs.PermQuotasRead)).Get("/quotas", s.ListQuotas)
+			r.With(rl.RequirePermission(orgs.PermQuotasWrite)).Post("/quotas", s.CreateQuota)
+			r.With(rl.RequirePermission(orgs.PermQuotasRead)).Get("/quotas/{id}", s.GetQuota)
+			r.With(rl.RequirePermission(orgs.PermQuotasWrite)).Delete("/quotas/{id}", s.DeleteQuota)
+
+			r.With(rl.RequirePermission(orgs.PermServiceAccountsRead)).Get("/serviceaccounts", s.ListServiceAccounts)
+			r.With(rl.RequirePermission(orgs.PermServiceAccountsWrite)).Post("/serviceaccounts", s.CreateServiceAccount)
+			r.With(rl.RequirePermission(orgs.PermServiceAccountsWrite)).Delete("/serviceaccounts/{id}", s.DeleteServiceAccount)
+
+			r.With(rl.RequirePermission(orgs.PermOrgsRead)).Get("/orgs", s.ListOrgs)
+			r.With(rl.RequirePermission(orgs.PermOrgsWrite)).Post("/orgs", s.CreateOrg)
+			r.With(rl.RequirePermission(orgs.PermOrgsRead)).Get("/orgs/{id}", s.GetOrg)
+			r.With(rl.RequirePermission(orgs.PermAnomaliesRead)).Get("/orgs/{id}/anomaly-policy", s.GetAnomalyPolicy)
+			r.With(rl.RequirePermission(orgs.PermAnomaliesWrite)).Put("/orgs/{id}/anomaly-policy", s.PutAnomalyPolicy)
+			r.With(rl.RequirePermission(orgs.PermUsageRead)).Get("/orgs/{id}/reports/{period}", s.GetOrgReport)
+			r.With(rl.RequirePermission(orgs.PermWebhooksRead)).Get("/orgs/{id}/webhooks", s.ListWebhooks)
+			r.With(rl.RequirePermission(orgs.PermWebhooksWrite)).Post("/orgs/{id}/webhooks", s.CreateWebhook)
+			r.With(rl.RequirePermission(orgs.PermWebhooksRead)).Get("/orgs/{id}/webhooks/{webhookID}", s.GetWebhook)
+			r.With(rl.RequirePermission(orgs.PermWebhooksWrite)).Put("/orgs/{id}/webhooks/{webhookID}", s.UpdateWebhook)
+			r.With(rl.RequirePermission(orgs.PermWebhooksWrite)).Delete("/orgs/{id}/webhooks/{webhookID}", s.DeleteWebhook)
+			r.With(rl.RequirePermission(orgs.PermWebhooksRead)).Get("/orgs/{id}/webhooks/{webhookID}/deliveries", s.ListWebhookDeliveries)
+			r.With(rl.RequirePermission(orgs.PermWebhooksWrite)).Post("/orgs/{id}/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", s.RedeliverWebhook)
+			r.With(rl.RequirePermission(orgs.PermOrgsDelete)).Delete("/orgs/{id}", s.DeleteOrg)
+			r.With(rl.RequirePermission(orgs.PermMembersRead)).Get("/orgs/{id}/members", s.ListOrgMembers)
+			r.With(rl.RequirePermission(orgs.PermMembersWrite)).Post("/orgs/{id}/members", s.AddOrgMember)
+			r.With(rl.RequirePermission(orgs.PermMembersWrite)).Delete("/orgs/{id}/members/{userID}", s.RemoveOrgMember)
 		})
 	})
 	return r
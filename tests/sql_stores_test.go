@@ -4,17 +4,27 @@ package tests
 // These exercise the SQLStore implementations that in-memory store tests skip.
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"gorm.io/gorm"
 
+	"github.com/farovictor/bifrost/pkg/anomaly"
+	"github.com/farovictor/bifrost/pkg/audit"
 	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/events"
 	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/notify"
 	"github.com/farovictor/bifrost/pkg/orgs"
+	"github.com/farovictor/bifrost/pkg/reports"
 	"github.com/farovictor/bifrost/pkg/rootkeys"
+	"github.com/farovictor/bifrost/pkg/serviceaccounts"
 	"github.com/farovictor/bifrost/pkg/services"
+	"github.com/farovictor/bifrost/pkg/usage"
 	"github.com/farovictor/bifrost/pkg/users"
+	"github.com/farovictor/bifrost/pkg/webhooks"
 )
 
 func sqliteDB(t *testing.T) *gorm.DB {
@@ -31,7 +41,8 @@ func sqliteDB(t *testing.T) *gorm.DB {
 func TestSQLKeyStore(t *testing.T) {
 	store := keys.NewSQLStore(sqliteDB(t))
 
-	k := keys.VirtualKey{ID: "k1", Scope: keys.ScopeRead, Target: "svc", ExpiresAt: time.Now().Add(time.Hour), RateLimit: 10}
+	k := keys.VirtualKey{ID: "k1", Scope: keys.ScopeRead, Target: "svc", ExpiresAt: time.Now().Add(time.Hour), RateLimit: 10,
+		Owner: "alice", Labels: map[string]string{"team": "search"}}
 
 	if err := store.Create(k); err != nil {
 		t.Fatalf("create: %v", err)
@@ -41,7 +52,7 @@ func TestSQLKeyStore(t *testing.T) {
 	if err != nil {
 		t.Fatalf("get: %v", err)
 	}
-	if got.ID != k.ID || got.Scope != k.Scope {
+	if got.ID != k.ID || got.Scope != k.Scope || got.Owner != "alice" || got.Labels["team"] != "search" {
 		t.Fatalf("unexpected key: %#v", got)
 	}
 
@@ -54,6 +65,17 @@ func TestSQLKeyStore(t *testing.T) {
 		t.Fatalf("update not persisted")
 	}
 
+	// Fields reset to their zero value are written too.
+	k.Suspended, k.SuspendedReason = true, "anomaly"
+	store.Update(k.ID, k)
+	k.Suspended, k.SuspendedReason = false, ""
+	if err := store.Update(k.ID, k); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got3, _ := store.Get(k.ID); got3.Suspended || got3.SuspendedReason != "" {
+		t.Fatalf("reinstatement not persisted: %#v", got3)
+	}
+
 	list := store.List()
 	if len(list) != 1 {
 		t.Fatalf("expected 1 key, got %d", len(list))
@@ -89,6 +111,30 @@ func TestSQLKeyStoreNotFound(t *testing.T) {
 	}
 }
 
+func TestSQLKeyStorePublishesInTransaction(t *testing.T) {
+	db := sqliteDB(t)
+	outbox := events.NewOutbox(db)
+	store := keys.NewSQLStore(db)
+	store.SetBus(events.New(events.Options{Outbox: outbox}))
+
+	k := keys.VirtualKey{ID: "k1", Scope: keys.ScopeRead, Target: "svc", ExpiresAt: time.Now().Add(time.Hour), RateLimit: 1}
+	if err := store.Create(k, events.KeyCreated{KeyID: k.ID}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// Failed changes roll their events back with them.
+	if err := store.Create(k, events.KeyCreated{KeyID: k.ID}); err != keys.ErrKeyExists {
+		t.Fatalf("expected ErrKeyExists, got %v", err)
+	}
+	if err := store.Delete("nope", events.KeyRevoked{KeyID: "nope"}); err != keys.ErrKeyNotFound {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+	var entries []events.OutboxEntry
+	db.Find(&entries)
+	if len(entries) != 1 || entries[0].Name != events.NameKeyCreated {
+		t.Fatalf("expected one key.created outbox entry, got %+v", entries)
+	}
+}
+
 // ── rootkeys SQL store ────────────────────────────────────────────────────────
 
 func TestSQLRootKeyStore(t *testing.T) {
@@ -391,3 +437,423 @@ func TestSQLMembershipStoreNotFound(t *testing.T) {
 		t.Fatalf("expected ErrMembershipNotFound on delete")
 	}
 }
+
+// ── usage SQL store ───────────────────────────────────────────────────────────
+
+func TestSQLUsageStoreRecordBatch(t *testing.T) {
+	store := usage.NewSQLStore(sqliteDB(t))
+
+	var batch []usage.Event
+	for i := 0; i < 5; i++ {
+		batch = append(batch, usage.Event{KeyID: "k1", StatusCode: 200, Service: "svc", TotalTokens: 10})
+	}
+	if err := store.RecordBatch(batch); err != nil {
+		t.Fatalf("record batch: %v", err)
+	}
+	events, total, err := store.List("k1", time.Time{}, time.Time{}, 1, 10)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if total != 5 || len(events) != 5 || events[0].Timestamp.IsZero() {
+		t.Fatalf("unexpected events: total=%d %+v", total, events)
+	}
+	if got := totalTokens(t, store, "k1"); got != 50 {
+		t.Fatalf("expected 50 tokens, got %d", got)
+	}
+}
+
+func TestSQLUsageStoreDeleteBefore(t *testing.T) {
+	store := usage.NewSQLStore(sqliteDB(t))
+
+	old := time.Now().AddDate(0, 0, -40)
+	var batch []usage.Event
+	for i := 0; i < 5; i++ {
+		batch = append(batch, usage.Event{KeyID: "k1", StatusCode: 200, Timestamp: old})
+	}
+	batch = append(batch, usage.Event{KeyID: "k1", StatusCode: 200, Timestamp: time.Now()})
+	if err := store.RecordBatch(batch); err != nil {
+		t.Fatalf("record batch: %v", err)
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -30)
+	if n, err := store.DeleteBefore(cutoff, 2); err != nil || n != 2 {
+		t.Fatalf("expected 2 deleted, got %d (%v)", n, err)
+	}
+	if n, err := usage.Prune(context.Background(), store, cutoff, 2); err != nil || n != 3 {
+		t.Fatalf("expected prune to delete 3, got %d (%v)", n, err)
+	}
+	_, total, _ := store.List("k1", time.Time{}, time.Time{}, 1, 10)
+	if total != 1 {
+		t.Fatalf("expected 1 event left, got %d", total)
+	}
+}
+
+// ── anomaly SQL store ─────────────────────────────────────────────────────────
+
+func TestSQLAnomalyStore(t *testing.T) {
+	store := anomaly.NewSQLStore(sqliteDB(t))
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, f := range []anomaly.Flag{
+		{ID: "f1", KeyID: "k1", OrgID: "o1", Kind: anomaly.KindRequestSpike, Action: anomaly.ActionFlagged},
+		{ID: "f2", KeyID: "k2", OrgID: "o1", Kind: anomaly.KindNewIP, Action: anomaly.ActionSuspended},
+		{ID: "f3", KeyID: "k3", OrgID: "o2", Kind: anomaly.KindErrorSpike, Action: anomaly.ActionFlagged},
+	} {
+		f.WindowStart = now
+		f.CreatedAt = now.Add(time.Duration(i) * time.Second)
+		if err := store.CreateFlag(f); err != nil {
+			t.Fatalf("create flag: %v", err)
+		}
+	}
+	if err := store.CreateFlag(anomaly.Flag{ID: "f1", KeyID: "k1", Kind: anomaly.KindRequestSpike, Action: anomaly.ActionFlagged, WindowStart: now, CreatedAt: now}); err != anomaly.ErrFlagExists {
+		t.Fatalf("expected ErrFlagExists, got %v", err)
+	}
+	if err := store.ResolveFlag("f1", now); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if err := store.ResolveFlag("missing", now); err != anomaly.ErrFlagNotFound {
+		t.Fatalf("expected ErrFlagNotFound, got %v", err)
+	}
+	open, err := store.ListFlags(anomaly.FlagQuery{OrgID: "o1", Status: anomaly.StatusOpen})
+	if err != nil || len(open) != 1 || open[0].ID != "f2" {
+		t.Fatalf("unexpected open flags %+v (%v)", open, err)
+	}
+	all, _ := store.ListFlags(anomaly.FlagQuery{})
+	if len(all) != 3 || all[0].ID != "f3" {
+		t.Fatalf("expected all flags newest first, got %+v", all)
+	}
+	if f, _ := store.GetFlag("f1"); f.Open() {
+		t.Fatal("resolution not persisted")
+	}
+
+	if p, err := store.Policy("o1"); err != nil || p.OrgID != "o1" || p.AutoSuspend {
+		t.Fatalf("expected default policy, got %+v (%v)", p, err)
+	}
+	for _, p := range []anomaly.Policy{
+		{OrgID: "o1", AutoSuspend: true},
+		{OrgID: "o1", AutoSuspend: true, SuspendOn: []string{anomaly.KindNewIP}},
+	} {
+		if err := store.PutPolicy(p); err != nil {
+			t.Fatalf("put policy: %v", err)
+		}
+	}
+	p, _ := store.Policy("o1")
+	if !p.Suspends(anomaly.KindNewIP) || p.Suspends(anomaly.KindRequestSpike) {
+		t.Fatalf("unexpected policy %+v", p)
+	}
+}
+
+func TestSQLReportStore(t *testing.T) {
+	store := reports.NewSQLStore(sqliteDB(t))
+
+	if _, err := store.Get("o1", "2025-03"); err != reports.ErrReportNotFound {
+		t.Fatalf("expected ErrReportNotFound, got %v", err)
+	}
+	r := reports.Report{OrgID: "o1", Period: "2025-03", GeneratedAt: time.Now().UTC(),
+		Total:  reports.Line{Name: "total", Requests: 3, CostUSD: 1.5},
+		Labels: []reports.Line{{Name: "team=search", Requests: 3, CostUSD: 1.5}}}
+	if err := store.Put(r); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	r.Final = true
+	r.Total.Requests = 4
+	if err := store.Put(r); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	got, err := store.Get("o1", "2025-03")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !got.Final || got.Total.Requests != 4 || len(got.Labels) != 1 || got.Labels[0].Name != "team=search" {
+		t.Fatalf("unexpected report %+v", got)
+	}
+	if _, err := store.Get("o1", "2025-04"); err != reports.ErrReportNotFound {
+		t.Fatalf("expected ErrReportNotFound for another period, got %v", err)
+	}
+}
+
+// ── webhooks SQL store ────────────────────────────────────────────────────────
+
+func TestSQLWebhookStore(t *testing.T) {
+	store := webhooks.NewSQLStore(sqliteDB(t))
+	now := time.Now().UTC()
+
+	w := webhooks.Webhook{ID: "wh1", OrgID: "o1", URL: "https://example.com", Events: []string{webhooks.EventKeyCreated}, Secret: "s", Active: true, CreatedAt: now}
+	if err := store.CreateWebhook(w); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := store.CreateWebhook(w); err != webhooks.ErrWebhookExists {
+		t.Fatalf("expected ErrWebhookExists, got %v", err)
+	}
+	w.Active = false
+	if err := store.UpdateWebhook(w); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got, _ := store.GetWebhook("wh1"); got.Active || got.Events[0] != webhooks.EventKeyCreated {
+		t.Fatalf("unexpected webhook %+v", got)
+	}
+	if list, _ := store.ListWebhooks("o1"); len(list) != 1 {
+		t.Fatalf("expected 1 webhook, got %d", len(list))
+	}
+
+	d := webhooks.Delivery{ID: "d1", WebhookID: "wh1", OrgID: "o1", EventID: "e1", Event: webhooks.EventKeyCreated,
+		Payload: "{}", Status: webhooks.StatusPending, NextAttemptAt: now, CreatedAt: now}
+	if err := store.CreateDelivery(d); err != nil {
+		t.Fatalf("create delivery: %v", err)
+	}
+	if err := store.CreateDelivery(d); err != webhooks.ErrDeliveryExists {
+		t.Fatalf("expected ErrDeliveryExists, got %v", err)
+	}
+	claimed, err := store.ClaimDue(now, now.Add(time.Minute), 10)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("claim: %+v, %v", claimed, err)
+	}
+	if again, _ := store.ClaimDue(now, now.Add(time.Minute), 10); len(again) != 0 {
+		t.Fatalf("claimed d1 twice: %+v", again)
+	}
+
+	d = claimed[0]
+	d.Attempts, d.StatusCode, d.Error = 1, 500, "webhook responded 500"
+	if err := store.UpdateDelivery(d); err != nil {
+		t.Fatalf("update delivery: %v", err)
+	}
+	// Zero values are written too.
+	d.Status, d.StatusCode, d.Error, d.DeliveredAt = webhooks.StatusDelivered, 0, "", &now
+	store.UpdateDelivery(d)
+	got, _ := store.GetDelivery("d1")
+	if got.Status != webhooks.StatusDelivered || got.Error != "" || got.StatusCode != 0 || got.Attempts != 1 || got.DeliveredAt == nil {
+		t.Fatalf("unexpected delivery %+v", got)
+	}
+	if list, _ := store.ListDeliveries(webhooks.DeliveryQuery{WebhookID: "wh1", Status: webhooks.StatusPending}); len(list) != 0 {
+		t.Fatalf("expected no pending deliveries, got %d", len(list))
+	}
+	if n, err := store.DeleteDeliveriesBefore(now.Add(time.Second)); err != nil || n != 1 {
+		t.Fatalf("expected 1 delivery deleted, got %d, %v", n, err)
+	}
+	if err := store.DeleteWebhook("wh1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := store.GetWebhook("wh1"); err != webhooks.ErrWebhookNotFound {
+		t.Fatalf("expected ErrWebhookNotFound, got %v", err)
+	}
+}
+
+// ── notifications SQL store ───────────────────────────────────────────────────
+
+func TestSQLNotificationStore(t *testing.T) {
+	store := notify.NewSQLStore(sqliteDB(t))
+	now := time.Now().UTC()
+
+	n := notify.Notification{ID: "n1", Channel: "slack", KeyID: "k1", Kind: notify.KindTokenBudget, Threshold: "80%",
+		Subject: "s", Message: "m", Status: notify.StatusPending, CreatedAt: now}
+	if err := store.Create(n); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := store.Create(n); err != notify.ErrNotificationExists {
+		t.Fatalf("expected ErrNotificationExists, got %v", err)
+	}
+	skipped := n
+	skipped.ID, skipped.Threshold, skipped.Status = "n0", "50%", notify.StatusSkipped
+	store.Create(skipped)
+	if pending, _ := store.ListPending(10); len(pending) != 1 || pending[0].ID != "n1" {
+		t.Fatalf("unexpected pending %+v", pending)
+	}
+
+	n.Attempts, n.Error = 1, "down"
+	store.Update(n)
+	// Zero values are written too.
+	n.Status, n.Error, n.SentAt = notify.StatusSent, "", &now
+	if err := store.Update(n); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	got, err := store.Get("n1")
+	if err != nil || got.Status != notify.StatusSent || got.Error != "" || got.Attempts != 1 || got.SentAt == nil {
+		t.Fatalf("unexpected notification %+v, %v", got, err)
+	}
+	if pending, _ := store.ListPending(10); len(pending) != 0 {
+		t.Fatalf("expected no pending notifications, got %+v", pending)
+	}
+	if err := store.Update(notify.Notification{ID: "missing"}); err != notify.ErrNotificationNotFound {
+		t.Fatalf("expected ErrNotificationNotFound, got %v", err)
+	}
+}
+
+// ── audit SQL store ───────────────────────────────────────────────────────────
+
+func TestSQLAuditEntryCommitsWithChange(t *testing.T) {
+	db := sqliteDB(t)
+	ks := keys.NewSQLStore(db)
+	as := audit.NewSQLStore(db)
+	bus := events.New(events.Options{})
+	events.Attach(bus, ks)
+	audit.Subscribe(bus, as)
+
+	k := keys.VirtualKey{ID: "k1", Scope: keys.ScopeRead, Target: "svc", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := ks.Create(k, events.KeyCreated{KeyID: k.ID, Target: k.Target}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// Recorded with the change, without running or flushing the bus.
+	if got, _ := as.List(audit.Query{}); len(got) != 1 || got[0].TargetID != "k1" {
+		t.Fatalf("expected the key.create entry, got %+v", got)
+	}
+
+	// An entry that cannot be appended rolls the change back.
+	if err := db.Migrator().DropTable(&audit.Entry{}); err != nil {
+		t.Fatal(err)
+	}
+	k.ID = "k2"
+	if err := ks.Create(k, events.KeyCreated{KeyID: k.ID, Target: k.Target}); err == nil {
+		t.Fatal("expected create to fail without the audit log")
+	}
+	if _, err := ks.Get("k2"); err == nil {
+		t.Fatal("key created without its audit entry")
+	}
+}
+
+func TestSQLAuditStore(t *testing.T) {
+	store := audit.NewSQLStore(sqliteDB(t))
+	start := time.Now().UTC().Add(-48 * time.Hour)
+
+	for i, e := range []audit.Entry{
+		{OrgID: "o1", ActorType: audit.ActorUser, ActorID: "u1", Action: "service.create", TargetType: "service", TargetID: "s1",
+			Changes: audit.Diff(nil, map[string]string{"id": "s1", "endpoint": "http://a"})},
+		{OrgID: "o1", ActorType: audit.ActorUser, ActorID: "u2", Action: "service.update", TargetType: "service", TargetID: "s1"},
+		{OrgID: "o2", ActorType: audit.ActorMCP, Action: "key.create", TargetType: "key", TargetID: "k1"},
+	} {
+		e.CreatedAt = start.Add(time.Duration(i) * 24 * time.Hour)
+		got, err := store.Append(e)
+		if err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		if got.Seq != int64(i+1) || got.ID == "" || got.Hash == "" {
+			t.Fatalf("unexpected entry %+v", got)
+		}
+	}
+
+	list, err := store.List(audit.Query{OrgID: "o1"})
+	if err != nil || len(list) != 2 || list[0].Action != "service.update" {
+		t.Fatalf("unexpected entries %+v, %v", list, err)
+	}
+	if c := list[1].Changes["endpoint"]; c.After != "http://a" {
+		t.Fatalf("changes not stored: %+v", list[1].Changes)
+	}
+	if list, _ := store.List(audit.Query{Since: start.Add(time.Hour), ActorID: "u2"}); len(list) != 1 {
+		t.Fatalf("expected 1 entry, got %+v", list)
+	}
+	// Entries read back must still hash to the stored value.
+	if n, err := audit.VerifyStore(store); err != nil || n != 3 {
+		t.Fatalf("verify: n=%d err=%v", n, err)
+	}
+
+	if n, err := store.DeleteBefore(start.Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("delete: n=%d err=%v", n, err)
+	}
+	if n, err := audit.VerifyStore(store); err != nil || n != 2 {
+		t.Fatalf("verify after retention: n=%d err=%v", n, err)
+	}
+	if a, err := store.Anchor(); err != nil || a.Seq != 1 {
+		t.Fatalf("expected the anchor at 1, got %+v, %v", a, err)
+	}
+	if e, _ := store.Append(audit.Entry{ActorType: audit.ActorUser, Action: "org.delete", TargetType: "org", CreatedAt: time.Now()}); e.Seq != 4 {
+		t.Fatalf("expected chain to continue at 4, got %+v", e)
+	}
+
+	// A redelivered event appends the entry it already recorded.
+	dup := audit.Entry{ID: "e1", ActorType: audit.ActorUser, Action: "org.create", TargetType: "org", CreatedAt: time.Now()}
+	if _, err := store.Append(dup); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if _, err := store.Append(dup); !errors.Is(err, audit.ErrEntryExists) {
+		t.Fatalf("expected ErrEntryExists, got %v", err)
+	}
+	if n, err := audit.VerifyStore(store); err != nil || n != 4 {
+		t.Fatalf("verify after duplicate: n=%d err=%v", n, err)
+	}
+}
+
+// ── org ownership ─────────────────────────────────────────────────────────────
+
+func TestSQLStoresListByOrg(t *testing.T) {
+	db := sqliteDB(t)
+	ks := keys.NewSQLStore(db)
+	ss := services.NewSQLStore(db)
+	rs := rootkeys.NewSQLStore(db)
+	as := serviceaccounts.NewSQLStore(db)
+
+	for _, org := range []string{"o1", "o2"} {
+		ks.Create(keys.VirtualKey{ID: "k-" + org, Scope: keys.ScopeRead, Target: "svc-" + org, ExpiresAt: time.Now().Add(time.Hour), RateLimit: 1, OrgID: org})
+		ss.Create(services.Service{ID: "svc-" + org, Endpoint: "http://x.com", RootKeyID: "rk-" + org, OrgID: org})
+		rs.Create(rootkeys.RootKey{ID: "rk-" + org, APIKey: "secret-" + org, OrgID: org})
+		as.Create(serviceaccounts.ServiceAccount{ID: "sa-" + org, Name: org, APIKey: "sa-" + org, OrgID: org})
+	}
+
+	if l := ks.ListByOrg("o1"); len(l) != 1 || l[0].ID != "k-o1" {
+		t.Fatalf("keys: %+v", l)
+	}
+	if l := ss.ListByOrg("o1"); len(l) != 1 || l[0].ID != "svc-o1" {
+		t.Fatalf("services: %+v", l)
+	}
+	if l := rs.ListByOrg("o1"); len(l) != 1 || l[0].ID != "rk-o1" || l[0].APIKey != "" {
+		t.Fatalf("root keys: %+v", l)
+	}
+	if l := as.ListByOrg("o1"); len(l) != 1 || l[0].ID != "sa-o1" {
+		t.Fatalf("service accounts: %+v", l)
+	}
+	if l := ss.ListByOrg("o3"); len(l) != 0 {
+		t.Fatalf("unknown org: %+v", l)
+	}
+}
+
+func TestAssignUnowned(t *testing.T) {
+	db := sqliteDB(t)
+	orgStore := orgs.NewSQLStore(db)
+	ks := keys.NewSQLStore(db)
+	ss := services.NewSQLStore(db)
+	rs := rootkeys.NewSQLStore(db)
+	serviceaccounts.NewSQLStore(db)
+
+	if n, err := orgs.AssignUnowned(db, ""); err != nil || n != 0 {
+		t.Fatalf("nothing to assign: n=%d err=%v", n, err)
+	}
+
+	ks.Create(keys.VirtualKey{ID: "k1", Scope: keys.ScopeRead, Target: "svc1", ExpiresAt: time.Now().Add(time.Hour), RateLimit: 1})
+	ss.Create(services.Service{ID: "svc1", Endpoint: "http://x.com", RootKeyID: "rk1"})
+	rs.Create(rootkeys.RootKey{ID: "rk1", APIKey: "secret"})
+	ss.Create(services.Service{ID: "svc2", Endpoint: "http://x.com", RootKeyID: "rk1", OrgID: "other"})
+
+	orgStore.Create(orgs.Organization{ID: "o1", Name: "One"})
+	orgStore.Create(orgs.Organization{ID: "o2", Name: "Two"})
+	if _, err := orgs.AssignUnowned(db, ""); err != orgs.ErrNoDefaultOrg {
+		t.Fatalf("expected ErrNoDefaultOrg, got %v", err)
+	}
+
+	n, err := orgs.AssignUnowned(db, "o2")
+	if err != nil || n != 3 {
+		t.Fatalf("assign: n=%d err=%v", n, err)
+	}
+	if l := ss.ListByOrg("o2"); len(l) != 1 || l[0].ID != "svc1" {
+		t.Fatalf("services of o2: %+v", l)
+	}
+	if svc, _ := ss.Get("svc2"); svc.OrgID != "other" {
+		t.Fatalf("owned service reassigned to %q", svc.OrgID)
+	}
+}
+
+func TestAssignUnownedSingleOrg(t *testing.T) {
+	db := sqliteDB(t)
+	orgStore := orgs.NewSQLStore(db)
+	rs := rootkeys.NewSQLStore(db)
+	keys.NewSQLStore(db)
+	services.NewSQLStore(db)
+	serviceaccounts.NewSQLStore(db)
+
+	orgStore.Create(orgs.Organization{ID: "only", Name: "Only"})
+	rs.Create(rootkeys.RootKey{ID: "rk1", APIKey: "secret"})
+
+	if n, err := orgs.AssignUnowned(db, ""); err != nil || n != 1 {
+		t.Fatalf("assign: n=%d err=%v", n, err)
+	}
+	if rk, _ := rs.Get("rk1"); rk.OrgID != "only" {
+		t.Fatalf("root key org: got %q", rk.OrgID)
+	}
+}
@@ -0,0 +1,410 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/orgs"
+	"github.com/farovictor/bifrost/pkg/quotas"
+	"github.com/farovictor/bifrost/pkg/rootkeys"
+	"github.com/farovictor/bifrost/pkg/serviceaccounts"
+	"github.com/farovictor/bifrost/pkg/services"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+// seedTenants creates one root key, service, virtual key and service
+// account in each of orgs o1 and o2.
+func seedTenants(t *testing.T, s *TestEnv) {
+	t.Helper()
+	for _, org := range []string{"o1", "o2"} {
+		s.Server.OrgStore.Create(orgs.Organization{ID: org, Name: org})
+		if err := s.Server.RootKeyStore.Create(rootkeys.RootKey{ID: "rk-" + org, APIKey: "real-" + org, OrgID: org}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Server.ServiceStore.Create(services.Service{ID: "svc-" + org, Endpoint: "http://" + org + ".example.com", RootKeyID: "rk-" + org, OrgID: org}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Server.KeyStore.Create(keys.VirtualKey{ID: "vk-" + org, Scope: keys.ScopeRead, Target: "svc-" + org, ExpiresAt: time.Now().Add(time.Hour), RateLimit: 10, OrgID: org}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Server.ServiceAccountStore.Create(serviceaccounts.ServiceAccount{ID: "sa-" + org, Name: org, APIKey: "sa-key-" + org, OrgID: org}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTenantListsScopedToOrg(t *testing.T) {
+	env := newTestEnv(t)
+	seedTenants(t, env)
+	tok := orgToken(t, env, "o1")
+
+	for _, path := range []string{"/v1/keys", "/v1/services", "/v1/rootkeys", "/v1/serviceaccounts"} {
+		rr := env.Do(tok, http.MethodGet, path, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+		var items []struct {
+			ID    string `json:"id"`
+			OrgID string `json:"org_id"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &items); err != nil {
+			t.Fatalf("%s: decode: %v", path, err)
+		}
+		if len(items) != 1 || items[0].OrgID != "o1" {
+			t.Fatalf("%s: expected only the o1 item, got %+v", path, items)
+		}
+	}
+
+	// An unscoped token still sees every org.
+	rr := env.Do(env.Token, http.MethodGet, "/v1/services", nil)
+	var all []services.Service
+	json.Unmarshal(rr.Body.Bytes(), &all)
+	if len(all) != 2 {
+		t.Fatalf("unscoped list: expected 2 services, got %d", len(all))
+	}
+}
+
+func TestTenantCannotTouchOtherOrg(t *testing.T) {
+	env := newTestEnv(t)
+	seedTenants(t, env)
+	tok := orgToken(t, env, "o1")
+
+	for _, tc := range []struct{ method, path, id string }{
+		{http.MethodGet, "/v1/keys/vk-o2/usage", ""},
+		{http.MethodDelete, "/v1/keys/vk-o2", ""},
+		{http.MethodGet, "/v1/services/svc-o2/adaptive", ""},
+		{http.MethodPut, "/v1/services/svc-o2", "svc-o2"},
+		{http.MethodDelete, "/v1/services/svc-o2", ""},
+		{http.MethodPut, "/v1/rootkeys/rk-o2", "rk-o2"},
+		{http.MethodDelete, "/v1/rootkeys/rk-o2", ""},
+		{http.MethodDelete, "/v1/serviceaccounts/sa-o2", ""},
+	} {
+		body := map[string]string{"id": tc.id, "endpoint": "http://evil.example.com", "root_key_id": "rk-o1", "api_key": "stolen"}
+		rr := env.Do(tok, tc.method, tc.path, body)
+		if rr.Code != http.StatusNotFound {
+			t.Fatalf("%s %s: expected 404, got %d: %s", tc.method, tc.path, rr.Code, rr.Body.String())
+		}
+	}
+
+	if _, err := env.Server.KeyStore.Get("vk-o2"); err != nil {
+		t.Fatalf("key of o2 deleted: %v", err)
+	}
+	if svc, err := env.Server.ServiceStore.Get("svc-o2"); err != nil || svc.Endpoint != "http://o2.example.com" {
+		t.Fatalf("service of o2 changed: %+v %v", svc, err)
+	}
+	if rk, err := env.Server.RootKeyStore.Get("rk-o2"); err != nil || rk.APIKey != "real-o2" {
+		t.Fatalf("root key of o2 changed: %+v %v", rk, err)
+	}
+	if _, err := env.Server.ServiceAccountStore.Get("sa-o2"); err != nil {
+		t.Fatalf("service account of o2 deleted: %v", err)
+	}
+}
+
+func TestTenantCreateStampsOrg(t *testing.T) {
+	env := newTestEnv(t)
+	seedTenants(t, env)
+	tok := orgToken(t, env, "o1")
+
+	rr := env.Do(tok, http.MethodPost, "/v1/rootkeys", map[string]string{"id": "rk-new", "api_key": "sk"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("root key: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rk, _ := env.Server.RootKeyStore.Get("rk-new"); rk.OrgID != "o1" {
+		t.Fatalf("root key org: got %q", rk.OrgID)
+	}
+
+	// A body naming another org is overridden by the caller's org.
+	rr = env.Do(tok, http.MethodPost, "/v1/services", map[string]string{"id": "svc-new", "endpoint": "http://new.example.com", "root_key_id": "rk-new", "org_id": "o2"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("service: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if svc, _ := env.Server.ServiceStore.Get("svc-new"); svc.OrgID != "o1" {
+		t.Fatalf("service org: got %q", svc.OrgID)
+	}
+
+	rr = env.Do(tok, http.MethodPost, "/v1/keys", map[string]any{"id": "vk-new", "scope": "read", "target": "svc-new", "expires_at": time.Now().Add(time.Hour), "rate_limit": 1})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("key: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if k, _ := env.Server.KeyStore.Get("vk-new"); k.OrgID != "o1" {
+		t.Fatalf("key org: got %q", k.OrgID)
+	}
+
+	rr = env.Do(tok, http.MethodPost, "/v1/serviceaccounts", map[string]string{"name": "ci"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("service account: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var sa serviceaccounts.ServiceAccount
+	json.Unmarshal(rr.Body.Bytes(), &sa)
+	if sa.OrgID != "o1" {
+		t.Fatalf("service account org: got %q", sa.OrgID)
+	}
+}
+
+func TestTenantCannotBorrowOtherOrgResources(t *testing.T) {
+	env := newTestEnv(t)
+	seedTenants(t, env)
+	tok := orgToken(t, env, "o1")
+
+	rr := env.Do(tok, http.MethodPost, "/v1/services", map[string]string{"id": "svc-x", "endpoint": "http://x.example.com", "root_key_id": "rk-o2"})
+	if rr.Code != http.StatusNotFound || errorBody(t, rr) != "root key not found" {
+		t.Fatalf("service with foreign root key: got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = env.Do(tok, http.MethodPut, "/v1/services/svc-o1", map[string]string{"id": "svc-o1", "endpoint": "http://o1.example.com", "root_key_id": "rk-o2"})
+	if rr.Code != http.StatusNotFound || errorBody(t, rr) != "root key not found" {
+		t.Fatalf("update with foreign root key: got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = env.Do(tok, http.MethodPost, "/v1/keys", map[string]any{"id": "vk-x", "scope": "read", "target": "svc-o2", "expires_at": time.Now().Add(time.Hour), "rate_limit": 1})
+	if rr.Code != http.StatusNotFound || errorBody(t, rr) != "service not found" {
+		t.Fatalf("key for foreign service: got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestProxyRejectsKeyForOtherOrgService(t *testing.T) {
+	env := newTestEnv(t)
+	svcID, _ := seedProxyBackend(t, env.Server)
+	svc, _ := env.Server.ServiceStore.Get(svcID)
+	svc.OrgID = "o2"
+	env.Server.ServiceStore.Update(svc)
+	rk, _ := env.Server.RootKeyStore.Get(svc.RootKeyID)
+	rk.OrgID = "o2"
+	env.Server.RootKeyStore.Update(rk)
+
+	k := keys.VirtualKey{ID: "vk-o1", Target: svcID, Scope: keys.ScopeRead, ExpiresAt: time.Now().Add(time.Hour), RateLimit: 10, OrgID: "o1"}
+	env.Server.KeyStore.Create(k)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/proxy/path", nil)
+	req.Header.Set("X-Virtual-Key", k.ID)
+	rr := httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden || errorBody(t, rr) != "service belongs to another org" {
+		t.Fatalf("expected 403, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	k2 := keys.VirtualKey{ID: "vk-o2", Target: svcID, Scope: keys.ScopeRead, ExpiresAt: time.Now().Add(time.Hour), RateLimit: 10, OrgID: "o2"}
+	env.Server.KeyStore.Create(k2)
+	req = httptest.NewRequest(http.MethodGet, "/v1/proxy/path", nil)
+	req.Header.Set("X-Virtual-Key", k2.ID)
+	rr = httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("same-org key: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestServiceTokenScopedToAccountOrg(t *testing.T) {
+	env := newTestEnv(t)
+	seedTenants(t, env)
+
+	for _, tc := range []struct {
+		service string
+		code    int
+	}{
+		{"svc-o2", http.StatusNotFound},
+		{"svc-o1", http.StatusOK},
+	} {
+		body, _ := json.Marshal(map[string]any{"service": tc.service, "ttl_seconds": 60})
+		req := httptest.NewRequest(http.MethodPost, "/v1/service-token", bytes.NewReader(body))
+		req.Header.Set("X-Service-Key", "sa-key-o1")
+		rr := httptest.NewRecorder()
+		env.Router.ServeHTTP(rr, req)
+		if rr.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.service, tc.code, rr.Code, rr.Body.String())
+		}
+	}
+
+	var minted []keys.VirtualKey
+	for _, k := range env.Server.KeyStore.ListByOrg("o1") {
+		if k.Target == "svc-o1" && k.ID != "vk-o1" {
+			minted = append(minted, k)
+		}
+	}
+	if len(minted) != 1 {
+		t.Fatalf("expected 1 key minted in o1, got %+v", minted)
+	}
+}
+
+func TestMCPScopedToClientOrgs(t *testing.T) {
+	env := newTestEnv(t)
+	seedTenants(t, env)
+	env.Server.MembershipStore.Create(orgs.Membership{UserID: env.User.ID, OrgID: "o1", Role: orgs.RoleMember})
+
+	resp := mcpCall(t, env, map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params":  map[string]any{"name": "list_services", "arguments": map[string]any{}},
+	})
+	svcs := resp["result"].(map[string]any)["services"].([]any)
+	if len(svcs) != 1 || svcs[0].(map[string]any)["name"] != "svc-o1" {
+		t.Fatalf("expected only svc-o1, got %v", svcs)
+	}
+
+	resp = mcpCall(t, env, map[string]any{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  "tools/call",
+		"params":  map[string]any{"name": "request_key", "arguments": map[string]any{"service_name": "svc-o2"}},
+	})
+	errObj, ok := resp["error"].(map[string]any)
+	if !ok || errObj["message"] != "service not found: svc-o2" {
+		t.Fatalf("expected service not found, got %v", resp)
+	}
+	if n := len(env.Server.KeyStore.ListByOrg("o2")); n != 1 {
+		t.Fatalf("key minted in o2: %d keys", n)
+	}
+
+	resp = mcpCall(t, env, map[string]any{
+		"jsonrpc": "2.0",
+		"id":      3,
+		"method":  "tools/call",
+		"params":  map[string]any{"name": "request_key", "arguments": map[string]any{"service_name": "svc-o1"}},
+	})
+	if _, ok := resp["result"]; !ok {
+		t.Fatalf("expected result, got %v", resp)
+	}
+	if n := len(env.Server.KeyStore.ListByOrg("o1")); n != 2 {
+		t.Fatalf("expected the minted key in o1, got %d keys", n)
+	}
+}
+
+func TestQuotasScopedToOrg(t *testing.T) {
+	env := newTestEnv(t)
+	seedTenants(t, env)
+	for _, q := range []quotas.Quota{
+		{ID: "q-o2-org", Scope: quotas.ScopeOrg, ScopeID: "o2", Metric: quotas.MetricRequests, Period: quotas.PeriodHour, Limit: 100},
+		{ID: "q-o2-svc", Scope: quotas.ScopeService, ScopeID: "svc-o2", Metric: quotas.MetricRequests, Period: quotas.PeriodHour, Limit: 100},
+		{ID: "q-o1-sa", Scope: quotas.ScopeServiceAccount, ScopeID: "sa-o1", Metric: quotas.MetricRequests, Period: quotas.PeriodHour, Limit: 100},
+	} {
+		env.Server.QuotaStore.Create(q)
+	}
+	tok := orgToken(t, env, "o1")
+
+	rr := env.Do(tok, http.MethodGet, "/v1/quotas", nil)
+	var list []quotas.Quota
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].ID != "q-o1-sa" {
+		t.Fatalf("expected only q-o1-sa, got %+v", list)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		for _, id := range []string{"q-o2-org", "q-o2-svc"} {
+			if rr := env.Do(tok, method, "/v1/quotas/"+id, nil); rr.Code != http.StatusNotFound {
+				t.Fatalf("%s %s: expected 404, got %d", method, id, rr.Code)
+			}
+		}
+	}
+	if _, err := env.Server.QuotaStore.Get("q-o2-org"); err != nil {
+		t.Fatalf("quota of o2 deleted: %v", err)
+	}
+
+	// An org quota names the caller's org whatever scope_id says.
+	rr = env.Do(tok, http.MethodPost, "/v1/quotas", map[string]any{"id": "q-new", "scope": "org", "scope_id": "o2", "metric": "requests", "period": "hour", "limit": 1})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("org quota: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if q, _ := env.Server.QuotaStore.Get("q-new"); q.ScopeID != "o1" {
+		t.Fatalf("org quota attached to %q", q.ScopeID)
+	}
+
+	for _, tc := range []struct {
+		body map[string]any
+		msg  string
+	}{
+		{map[string]any{"scope": "service", "scope_id": "svc-o2"}, "service not found"},
+		{map[string]any{"scope": "service_account", "scope_id": "sa-o2"}, "service account not found"},
+		{map[string]any{"scope": "org", "scope_id": "o1", "service": "svc-o2"}, "service not found"},
+	} {
+		tc.body["metric"], tc.body["period"], tc.body["limit"] = "requests", "hour", 1
+		rr := env.Do(tok, http.MethodPost, "/v1/quotas", tc.body)
+		if rr.Code != http.StatusNotFound || errorBody(t, rr) != tc.msg {
+			t.Fatalf("%v: got %d: %s", tc.body, rr.Code, rr.Body.String())
+		}
+	}
+	rr = env.Do(tok, http.MethodPost, "/v1/quotas", map[string]any{"scope": "service", "scope_id": "svc-o1", "metric": "requests", "period": "hour", "limit": 1})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("own service quota: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestUsageSummaryAndExportScopedToOrg(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now().UTC()
+	for _, org := range []string{"o1", "o2", "o2"} {
+		env.Server.UsageStore.Record(usage.Event{KeyID: "vk-" + org, OrgID: org, Service: "svc-" + org, Timestamp: now, StatusCode: 200, ClientIP: "10.0.0.1"})
+	}
+	tok := orgToken(t, env, "o1")
+
+	for _, path := range []string{"/v1/usage/summary?org_id=o2", "/v1/usage/export?org=o2"} {
+		if rr := env.Do(tok, http.MethodGet, path, nil); rr.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected 403, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := env.Do(tok, http.MethodGet, "/v1/usage/summary?group_by=org", nil)
+	var resp struct {
+		Rows []usage.SummaryRow `json:"rows"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if len(resp.Rows) != 1 || resp.Rows[0].Group["org"] != "o1" || resp.Rows[0].Requests != 1 {
+		t.Fatalf("expected only o1 usage, got %+v", resp.Rows)
+	}
+
+	rr = env.Do(tok, http.MethodGet, "/v1/usage/export?format=jsonl", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("export: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"org_id":"o1"`) {
+		t.Fatalf("expected only the o1 event, got %q", rr.Body.String())
+	}
+}
+
+func TestListOrgsScopedToOrg(t *testing.T) {
+	env := newTestEnv(t)
+	seedTenants(t, env)
+
+	rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/orgs", nil)
+	var list []orgs.Organization
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].ID != "o1" {
+		t.Fatalf("expected only o1, got %+v", list)
+	}
+
+	rr = env.Do(env.Token, http.MethodGet, "/v1/orgs", nil)
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list) != 2 {
+		t.Fatalf("unscoped list: expected 2 orgs, got %+v", list)
+	}
+}
+
+// A token naming no org sees every org only when its user owns or
+// administers the empty org.
+func TestOrgLessMemberSeesNoOrg(t *testing.T) {
+	env := newTestEnv(t)
+	seedTenants(t, env)
+	env.Server.MembershipStore.Create(orgs.Membership{UserID: "m", Role: orgs.RoleMember})
+	tok := makeToken("m")
+
+	for _, path := range []string{"/v1/keys", "/v1/services", "/v1/orgs", "/v1/orgs/o1", "/v1/usage/summary"} {
+		if rr := env.Do(tok, http.MethodGet, path, nil); rr.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected 403, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := env.Do(tok, http.MethodGet, "/v1/keys/vk-o1/usage", nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another org's key, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The owner of the empty org still sees both orgs.
+	rr := env.Do(env.Token, http.MethodGet, "/v1/keys", nil)
+	var items []keys.VirtualKey
+	json.Unmarshal(rr.Body.Bytes(), &items)
+	if rr.Code != http.StatusOK || len(items) != 2 {
+		t.Fatalf("expected both keys, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -1,12 +1,14 @@
 package tests
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
 	"github.com/farovictor/bifrost/pkg/rootkeys"
 	routes "github.com/farovictor/bifrost/routes"
 	"github.com/farovictor/bifrost/pkg/services"
@@ -64,6 +66,9 @@ func TestTokenBudget_AllowedWhenUnderBudget(t *testing.T) {
 	if rr.Code != http.StatusOK {
 		t.Fatalf("expected 200 under budget, got %d: %s", rr.Code, rr.Body.String())
 	}
+	if got := rr.Header().Get(ratelimit.HeaderTokenBudgetRemaining); got != "500" {
+		t.Errorf("expected budget remaining 500, got %q", got)
+	}
 }
 
 func TestTokenBudget_BlockedWhenExceeded(t *testing.T) {
@@ -90,6 +95,13 @@ func TestTokenBudget_BlockedWhenExceeded(t *testing.T) {
 	if msg := errorBody(t, rr); msg != "token budget exceeded" {
 		t.Errorf("unexpected error message: %s", msg)
 	}
+	var body ratelimit.ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.Reason != ratelimit.ReasonBudgetExceeded {
+		t.Errorf("expected reason %q, got %q", ratelimit.ReasonBudgetExceeded, body.Reason)
+	}
+	if got := rr.Header().Get(ratelimit.HeaderTokenBudgetRemaining); got != "0" {
+		t.Errorf("expected budget remaining 0, got %q", got)
+	}
 }
 
 func TestTokenBudget_ZeroMeansUnlimited(t *testing.T) {
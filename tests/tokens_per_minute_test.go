@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
+	"github.com/farovictor/bifrost/pkg/rootkeys"
+	"github.com/farovictor/bifrost/pkg/services"
+	"github.com/farovictor/bifrost/pkg/usage"
+	routes "github.com/farovictor/bifrost/routes"
+	v1 "github.com/farovictor/bifrost/routes/v1"
+)
+
+// setupTPMEnv seeds a service whose backend reports totalTokens of usage per
+// call and a key targeting it with the given tokens-per-minute limits.
+func setupTPMEnv(t *testing.T, keyTPM, svcTPM, totalTokens int) (s *routes.Server, router http.Handler, keyID string) {
+	t.Helper()
+	s = newTestServer(t)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"usage": map[string]int{"total_tokens": totalTokens},
+		})
+	}))
+	t.Cleanup(backend.Close)
+
+	rk := rootkeys.RootKey{ID: "rk-tpm", APIKey: "real"}
+	s.RootKeyStore.Create(rk)
+	svc := services.Service{ID: "svc-tpm", Endpoint: backend.URL, RootKeyID: rk.ID, TokensPerMinute: svcTPM}
+	s.ServiceStore.Create(svc)
+
+	keyID = "vk-tpm"
+	s.KeyStore.Create(keys.VirtualKey{
+		ID:              keyID,
+		Target:          svc.ID,
+		Scope:           keys.ScopeWrite,
+		RateLimit:       100,
+		ExpiresAt:       time.Now().Add(time.Hour),
+		TokensPerMinute: keyTPM,
+	})
+	return s, setupRouter(s), keyID
+}
+
+func sendTPM(router http.Handler, keyID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/proxy/chat", strings.NewReader(body))
+	req.Header.Set("X-Virtual-Key", keyID)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestTokensPerMinute_DebitsActualUsage(t *testing.T) {
+	_, router, keyID := setupTPMEnv(t, 1000, 0, 600)
+
+	if rr := sendTPM(router, keyID, `{"prompt":"hi"}`); rr.Code != http.StatusOK {
+		t.Fatalf("first request: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	// 600 of 1000 tokens are spent; a request reserving 500 must wait.
+	rr := sendTPM(router, keyID, `{"prompt":"hi","max_tokens":500}`)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: expected 429, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var body ratelimit.ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.Reason != ratelimit.ReasonRateLimited {
+		t.Fatalf("unexpected 429 body: %s", rr.Body.String())
+	}
+	if rr.Header().Get(ratelimit.HeaderRetryAfter) == "" {
+		t.Fatalf("expected Retry-After on token limit 429")
+	}
+	// A small request still fits in the remaining 400 tokens.
+	if rr := sendTPM(router, keyID, `{"prompt":"hi"}`); rr.Code != http.StatusOK {
+		t.Fatalf("third request: expected 200, got %d", rr.Code)
+	}
+}
+
+func TestTokensPerMinute_OverEstimateIsRefunded(t *testing.T) {
+	_, router, keyID := setupTPMEnv(t, 100, 0, 1)
+
+	// The estimate exceeds the whole limit, so the request reserves a full
+	// bucket rather than being rejected forever.
+	if rr := sendTPM(router, keyID, `{"prompt":"hi","max_tokens":5000}`); rr.Code != http.StatusOK {
+		t.Fatalf("first request: expected 200, got %d", rr.Code)
+	}
+	// Only 1 token was really used, so the reservation was refunded.
+	if rr := sendTPM(router, keyID, `{}`); rr.Code != http.StatusOK {
+		t.Fatalf("second request: expected 200 after refund, got %d", rr.Code)
+	}
+}
+
+func TestTokensPerMinute_ServiceLimit(t *testing.T) {
+	_, router, keyID := setupTPMEnv(t, 0, 500, 500)
+
+	if rr := sendTPM(router, keyID, `{}`); rr.Code != http.StatusOK {
+		t.Fatalf("first request: expected 200, got %d", rr.Code)
+	}
+	if rr := sendTPM(router, keyID, `{}`); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: expected 429 from service limit, got %d", rr.Code)
+	}
+}
+
+func TestTokensPerMinute_RejectsOversizedBody(t *testing.T) {
+	s, router, keyID := setupTPMEnv(t, 1000, 0, 1)
+
+	body := `{"prompt":"` + strings.Repeat("x", v1.DefaultMaxBodyBytes) + `"}`
+	rr := sendTPM(router, keyID, body)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", rr.Code, rr.Body.String())
+	}
+	events, _, err := s.UsageStore.List(keyID, time.Time{}, time.Time{}, 1, 10)
+	if err != nil || len(events) != 1 || events[0].Category != usage.CategoryTooLarge {
+		t.Fatalf("expected a too_large usage event, got %+v, %v", events, err)
+	}
+	// The rejected request reserved no tokens.
+	if rr := sendTPM(router, keyID, `{"prompt":"hi","max_tokens":900}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 after the rejection, got %d", rr.Code)
+	}
+}
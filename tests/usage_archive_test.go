@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/config"
+	"github.com/farovictor/bifrost/pkg/sink"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+func TestArchivingStoreWritesToFilesystemSink(t *testing.T) {
+	dir := t.TempDir()
+	archiver := sink.NewArchiver(sink.NewFilesystem(dir), sink.ArchiverOptions{FlushInterval: time.Hour})
+	db := usage.NewSQLStore(sqliteDB(t))
+	recorder := usage.NewRecorder(&usage.ArchivingStore{Store: db, Archive: archiver}, usage.RecorderOptions{})
+
+	at := time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC)
+	recorder.Record(usage.Event{KeyID: "k1", OrgID: "o1", Service: "svc", StatusCode: 200, Timestamp: at})
+	recorder.Record(usage.Event{KeyID: "k2", OrgID: "o1", Service: "svc", StatusCode: 429, Category: "rate_limited", Timestamp: at})
+	if err := recorder.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := archiver.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if len(files) != 1 || !strings.Contains(files[0], filepath.Join("usage", "year=2025", "month=03", "day=14", "hour=09")) {
+		t.Fatalf("unexpected archive files %v", files)
+	}
+	f, _ := os.Open(files[0])
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(zr)
+	var archived []usage.Event
+	for dec.More() {
+		var e usage.Event
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		archived = append(archived, e)
+	}
+	if len(archived) != 2 || archived[0].ID == 0 || archived[1].Category != "rate_limited" {
+		t.Fatalf("unexpected archived events %+v", archived)
+	}
+
+	// The database has the same events.
+	if _, total, _ := db.List("k1", time.Time{}, time.Time{}, 1, 10); total != 1 {
+		t.Fatalf("expected the event in the database, got %d", total)
+	}
+}
+
+func TestUsageDBRetentionDays(t *testing.T) {
+	t.Setenv("BIFROST_USAGE_RETENTION_DAYS", "90")
+	t.Setenv("BIFROST_USAGE_DB_RETENTION_DAYS", "7")
+	t.Setenv("BIFROST_LOG_SINK", "")
+	if got := config.UsageDBRetentionDays(); got != 90 {
+		t.Fatalf("without a sink expected 90, got %d", got)
+	}
+	t.Setenv("BIFROST_LOG_SINK", "bucket")
+	if got := config.UsageDBRetentionDays(); got != 7 {
+		t.Fatalf("with a sink expected 7, got %d", got)
+	}
+}
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/farovictor/bifrost/pkg/export"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+func exportUsage(t *testing.T, s *TestEnv, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/v1/usage/export?"+query, nil)
+	s.Authorize(req)
+	rr := httptest.NewRecorder()
+	s.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestExportUsageCSV(t *testing.T) {
+	env := newTestEnv(t)
+	day := seedSummaryEvents(t, env.Server.UsageStore)
+
+	rr := exportUsage(t, env, "org=o1&service=openai&from="+day.Add(9*time.Hour+time.Minute).Format(time.RFC3339))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); !strings.HasSuffix(cd, `.csv"`) {
+		t.Fatalf("unexpected content disposition %q", cd)
+	}
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected header and 2 rows, got %v", records)
+	}
+	if records[0][0] != "id" || records[0][1] != "timestamp" || records[0][7] != "status_code" {
+		t.Fatalf("unexpected header %v", records[0])
+	}
+	if records[1][7] != "200" || records[2][7] != "502" {
+		t.Fatalf("expected rows oldest first, got %v", records[1:])
+	}
+	if records[1][1] != day.Add(9*time.Hour+time.Minute).Format(time.RFC3339Nano) || records[1][14] != "0.25" {
+		t.Fatalf("unexpected row %v", records[1])
+	}
+}
+
+func TestExportUsageJSONL(t *testing.T) {
+	env := newTestEnv(t)
+	seedSummaryEvents(t, env.Server.UsageStore)
+
+	rr := exportUsage(t, env, "format=jsonl&org=o2")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	body := rr.Body.String()
+	if !strings.HasPrefix(body, `{"id":`) {
+		t.Fatalf("expected columns in schema order, got %s", body)
+	}
+	sc := bufio.NewScanner(strings.NewReader(body))
+	var lines []map[string]any
+	for sc.Scan() {
+		var m map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatalf("decode %q: %v", sc.Text(), err)
+		}
+		lines = append(lines, m)
+	}
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(lines))
+	}
+	if lines[0]["key_id"] != "k3" || lines[0]["total_tokens"] != 7.0 || lines[0]["model"] != "" {
+		t.Fatalf("unexpected line %v", lines[0])
+	}
+}
+
+func TestExportUsageParquet(t *testing.T) {
+	env := newTestEnv(t)
+	seedSummaryEvents(t, env.Server.UsageStore)
+
+	rr := exportUsage(t, env, "format=parquet")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rows := readParquet(t, rr.Body.Bytes())
+	if len(rows) != 5 {
+		t.Fatalf("expected 5 rows, got %d", len(rows))
+	}
+	first, last := rows[0], rows[4]
+	if first["key_id"] != "k1" || first["model"] != "gpt-4o" || first["status_code"] != int32(200) ||
+		first["total_tokens"] != int64(15) || first["cost_usd"] != 0.5 ||
+		first["timestamp"] != time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC).UnixMilli() {
+		t.Fatalf("unexpected first row %v", first)
+	}
+	if last["key_id"] != "k3" || last["org_id"] != "o2" || last["upstream_endpoint"] != "" {
+		t.Fatalf("unexpected last row %v", last)
+	}
+}
+
+// readParquet decodes a Parquet file with an independent reader, returning
+// each row as its values by column name. Timestamps are UTC milliseconds.
+func readParquet(t *testing.T, b []byte) []map[string]any {
+	t.Helper()
+	f, err := parquet.OpenFile(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("open parquet: %v", err)
+	}
+	fields := f.Schema().Fields()
+	var out []map[string]any
+	for _, rg := range f.RowGroups() {
+		rows := rg.Rows()
+		batch := make([]parquet.Row, rg.NumRows())
+		n, err := rows.ReadRows(batch)
+		rows.Close()
+		if err != nil && err != io.EOF {
+			t.Fatalf("read parquet: %v", err)
+		}
+		for _, row := range batch[:n] {
+			m := make(map[string]any, len(row))
+			for _, v := range row {
+				name := fields[v.Column()].Name()
+				switch v.Kind() {
+				case parquet.Int32:
+					m[name] = v.Int32()
+				case parquet.Int64:
+					m[name] = v.Int64()
+				case parquet.Double:
+					m[name] = v.Double()
+				case parquet.ByteArray:
+					m[name] = string(v.ByteArray())
+				}
+			}
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func TestExportUsageInvalid(t *testing.T) {
+	env := newTestEnv(t)
+	for _, q := range []string{"format=xml", "from=yesterday"} {
+		if rr := exportUsage(t, env, q); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", q, rr.Code)
+		}
+	}
+}
+
+func TestSQLUsageStoreExport(t *testing.T) {
+	store := usage.NewSQLStore(sqliteDB(t))
+	day := seedSummaryEvents(t, store)
+
+	var keys []string
+	err := store.Export(usage.ExportQuery{To: day.Add(11 * time.Hour), Service: "openai"}, func(e usage.Event) error {
+		keys = append(keys, e.KeyID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(keys, ",") != "k1,k1,k1" {
+		t.Fatalf("unexpected export %v", keys)
+	}
+
+	var buf bytes.Buffer
+	if err := usage.Export(store, usage.ExportQuery{OrgID: "o2"}, export.FormatCSV, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Fatalf("expected header and 1 row, got %q", buf.String())
+	}
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/farovictor/bifrost/pkg/metrics"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+// batchStore records the size of every batch written to it. When gate is
+// set, each batch waits for a value on it before being stored.
+type batchStore struct {
+	*usage.MemoryStore
+	mu      sync.Mutex
+	batches []int
+	gate    chan struct{}
+}
+
+func (s *batchStore) RecordBatch(events []usage.Event) error {
+	if s.gate != nil {
+		<-s.gate
+	}
+	s.mu.Lock()
+	s.batches = append(s.batches, len(events))
+	s.mu.Unlock()
+	return s.MemoryStore.RecordBatch(events)
+}
+
+func (s *batchStore) sizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.batches...)
+}
+
+func TestRecorderWritesInBatches(t *testing.T) {
+	store := &batchStore{MemoryStore: usage.NewMemoryStore()}
+	rec := usage.NewRecorder(store, usage.RecorderOptions{BatchSize: 3, FlushInterval: time.Hour})
+
+	for i := 0; i < 7; i++ {
+		rec.Record(usage.Event{KeyID: "k", TotalTokens: 1})
+	}
+	// Two full batches are written straight away; the rest waits for the
+	// flush on close.
+	if err := rec.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if got := store.sizes(); len(got) != 3 || got[0] != 3 || got[1] != 3 || got[2] != 1 {
+		t.Fatalf("unexpected batch sizes: %v", got)
+	}
+	if got := totalTokens(t, store, "k"); got != 7 {
+		t.Fatalf("expected 7 events stored, got %d", got)
+	}
+
+	// Events recorded after Close are written synchronously.
+	rec.Record(usage.Event{KeyID: "k", TotalTokens: 1})
+	if got := totalTokens(t, store, "k"); got != 8 {
+		t.Fatalf("expected late event to be stored, got %d", got)
+	}
+}
+
+func TestRecorderFlushesOnInterval(t *testing.T) {
+	store := &batchStore{MemoryStore: usage.NewMemoryStore()}
+	rec := usage.NewRecorder(store, usage.RecorderOptions{BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+	defer rec.Close(context.Background())
+
+	rec.Record(usage.Event{KeyID: "k", TotalTokens: 1})
+	deadline := time.Now().Add(time.Second)
+	for totalTokens(t, store, "k") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("event not flushed within a second")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRecorderDropsOldestWhenFull(t *testing.T) {
+	store := &batchStore{MemoryStore: usage.NewMemoryStore(), gate: make(chan struct{})}
+	rec := usage.NewRecorder(store, usage.RecorderOptions{BufferSize: 2, BatchSize: 1, FlushInterval: time.Hour})
+	before := testutil.ToFloat64(metrics.UsageEventsDroppedTotal)
+
+	// The worker blocks writing whatever it picks up first, so at most three
+	// of the five events fit: one in flight and two in the buffer.
+	for i := 1; i <= 5; i++ {
+		rec.Record(usage.Event{KeyID: "k", StatusCode: i})
+	}
+	if dropped := testutil.ToFloat64(metrics.UsageEventsDroppedTotal) - before; dropped < 2 {
+		t.Fatalf("expected at least 2 dropped events to be counted, got %v", dropped)
+	}
+
+	close(store.gate)
+	rec.Close(context.Background())
+	events, _, _ := store.List("k", time.Time{}, time.Time{}, 1, 10)
+	last := events[len(events)-1]
+	if last.StatusCode != 5 {
+		t.Fatalf("expected the newest event to be kept, got %+v", events)
+	}
+}
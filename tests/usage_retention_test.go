@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/metrics"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+func TestRetentionPrunesOldEvents(t *testing.T) {
+	store := usage.NewMemoryStore()
+	for i := 0; i < 7; i++ {
+		store.Record(usage.Event{KeyID: "k", StatusCode: 200, TotalTokens: 1, Timestamp: time.Now().AddDate(0, 0, -31)})
+	}
+	store.Record(usage.Event{KeyID: "k", StatusCode: 200, Timestamp: time.Now()})
+
+	before := testutil.ToFloat64(metrics.UsagePrunedTotal)
+	r := &usage.Retention{Store: store, Lock: &database.LocalLock{}, Days: 30, BatchSize: 3, Interval: time.Hour}
+	deleted, ran, err := r.RunOnce(context.Background())
+	if err != nil || !ran || deleted != 7 {
+		t.Fatalf("expected 7 deleted, got %d ran=%v err=%v", deleted, ran, err)
+	}
+	if got := testutil.ToFloat64(metrics.UsagePrunedTotal) - before; got != 7 {
+		t.Fatalf("expected pruned metric +7, got %v", got)
+	}
+	if testutil.ToFloat64(metrics.UsageRetentionLastSuccess) == 0 {
+		t.Fatalf("expected last success timestamp to be set")
+	}
+	if _, total, _ := store.List("k", time.Time{}, time.Time{}, 1, 10); total != 1 {
+		t.Fatalf("expected 1 event left, got %d", total)
+	}
+	if got := totalTokens(t, store, "k"); got != 7 {
+		t.Fatalf("expected budget to still count 7 tokens, got %d", got)
+	}
+}
+
+func TestRetentionSkipsWhenLocked(t *testing.T) {
+	store := usage.NewMemoryStore()
+	store.Record(usage.Event{KeyID: "k", StatusCode: 200, Timestamp: time.Now().AddDate(0, 0, -31)})
+
+	lock := &database.LocalLock{}
+	release, ok, _ := lock.TryLock(context.Background())
+	if !ok {
+		t.Fatalf("expected to take the lock")
+	}
+	defer release()
+
+	r := &usage.Retention{Store: store, Lock: lock, Days: 30, Interval: time.Hour}
+	if deleted, ran, err := r.RunOnce(context.Background()); ran || deleted != 0 || err != nil {
+		t.Fatalf("expected no run while locked, got deleted=%d ran=%v err=%v", deleted, ran, err)
+	}
+}
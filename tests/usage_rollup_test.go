@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+// rollupEvents spreads events over three days, several per hour.
+func rollupEvents(start time.Time) []usage.Event {
+	var events []usage.Event
+	for h := 0; h < 72; h += 5 {
+		for i := 0; i < 3; i++ {
+			events = append(events, usage.Event{
+				KeyID:       []string{"k1", "k2"}[i%2],
+				OrgID:       []string{"o1", "o2"}[i%2],
+				Service:     "openai",
+				Model:       []string{"gpt-4o", "gpt-4o-mini", ""}[i],
+				StatusCode:  []int{200, 200, 500}[(h+i)%3],
+				LatencyMS:   int64(20 * (h + i + 1)),
+				TotalTokens: 10 * (i + 1),
+				CostUSD:     0.25,
+				Timestamp:   start.Add(time.Duration(h)*time.Hour + time.Duration(i*17)*time.Minute),
+			})
+		}
+	}
+	return events
+}
+
+func TestSQLUsageRollupsMatchRawSummaries(t *testing.T) {
+	start := time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)
+	events := rollupEvents(start)
+	mem := usage.NewMemoryStore()
+	mem.RecordBatch(events)
+	store := usage.NewSQLStore(sqliteDB(t))
+	store.RecordBatch(events)
+
+	// Roll up the first two and a half days; the rest stays raw.
+	if err := store.Compact(context.Background(), start.Add(60*time.Hour+30*time.Minute)); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if until, _ := store.RolledUntil(); !until.Equal(start.Add(60 * time.Hour)) {
+		t.Fatalf("expected hourly rollups until hour 60, got %v", until)
+	}
+
+	queries := []usage.SummaryQuery{
+		{},
+		{GroupBy: []string{usage.GroupOrg, usage.GroupModel}},
+		{GroupBy: []string{usage.GroupTime}, Bucket: usage.BucketHour},
+		{GroupBy: []string{usage.GroupTime, usage.GroupStatusClass}, Bucket: usage.BucketDay},
+		{GroupBy: []string{usage.GroupTime}, Bucket: usage.BucketMonth, KeyID: "k1"},
+		{From: start.Add(3*time.Hour + 10*time.Minute), To: start.Add(50*time.Hour + 20*time.Minute), GroupBy: []string{usage.GroupKey}},
+		{From: start.Add(30 * time.Hour), GroupBy: []string{usage.GroupTime}, Bucket: usage.BucketDay},
+	}
+	for _, q := range queries {
+		want, _ := mem.Summary(q)
+		got, err := store.Summary(q)
+		if err != nil {
+			t.Fatalf("%+v: %v", q, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%+v:\n got %+v\nwant %+v", q, got, want)
+		}
+	}
+
+	// Raw events already rolled up can go; summaries and budgets keep them.
+	if _, err := store.DeleteBefore(start.Add(60*time.Hour), 1000); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	want, _ := mem.Summary(usage.SummaryQuery{GroupBy: []string{usage.GroupKey}})
+	got, _ := store.Summary(usage.SummaryQuery{GroupBy: []string{usage.GroupKey}})
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("after pruning raw events:\n got %+v\nwant %+v", got, want)
+	}
+	gotTotals, err := store.Totals("k1")
+	if err != nil {
+		t.Fatalf("totals: %v", err)
+	}
+	wantTotals, _ := mem.Totals("k1")
+	if gotTotals.Tokens != wantTotals.Tokens || math.Abs(gotTotals.CostUSD-wantTotals.CostUSD) > 1e-9 {
+		t.Fatalf("expected totals %+v for k1, got %+v", wantTotals, gotTotals)
+	}
+}
+
+func TestRetentionKeepsEventsNotRolledUp(t *testing.T) {
+	db := sqliteDB(t)
+	store := usage.NewSQLStore(db)
+	old := time.Now().UTC().AddDate(0, 0, -10).Truncate(time.Hour)
+	store.RecordBatch([]usage.Event{
+		{KeyID: "k", StatusCode: 200, TotalTokens: 5, Timestamp: old},
+		{KeyID: "k", StatusCode: 200, TotalTokens: 7, Timestamp: time.Now()},
+	})
+
+	// SQLite has no partitions, so rows are deleted instead.
+	parts := usage.NewPartitions(db, usage.PartitionMonth, 3)
+	r := &usage.Retention{Store: store, Lock: &database.LocalLock{}, Days: 1, RollupDays: 30, RollupDelay: time.Hour, Partitions: parts}
+	deleted, ran, err := r.RunOnce(context.Background())
+	if err != nil || !ran || deleted != 1 {
+		t.Fatalf("expected the old event to be pruned, got deleted=%d ran=%v err=%v", deleted, ran, err)
+	}
+	if got := totalTokens(t, store, "k"); got != 12 {
+		t.Fatalf("expected budget to still count 12 tokens, got %d", got)
+	}
+
+	// Rollups past their own retention are pruned too, but budgets keep
+	// counting what they held.
+	r.RollupDays = 5
+	if _, _, err := r.RunOnce(context.Background()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	rows, _ := store.Summary(usage.SummaryQuery{})
+	if len(rows) != 1 || rows[0].TotalTokens != 7 {
+		t.Fatalf("expected summaries to keep 7 tokens after rollup retention, got %+v", rows)
+	}
+	if got := totalTokens(t, store, "k"); got != 12 {
+		t.Fatalf("expected budget to still count 12 tokens, got %d", got)
+	}
+}
+
+func TestLateEventsFoldIntoRollups(t *testing.T) {
+	start := time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)
+	events := rollupEvents(start)
+	mem := usage.NewMemoryStore()
+	mem.RecordBatch(events)
+	store := usage.NewSQLStore(sqliteDB(t))
+	store.RecordBatch(events)
+	if err := store.Compact(context.Background(), start.Add(60*time.Hour)); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+
+	// Events arriving after their hour and day were rolled up.
+	late := []usage.Event{
+		{KeyID: "k1", OrgID: "o1", Service: "openai", Model: "gpt-4o", StatusCode: 200, LatencyMS: 20, TotalTokens: 10, CostUSD: 0.25, Timestamp: start.Add(10 * time.Minute)},
+		{KeyID: "k3", OrgID: "o1", Service: "openai", StatusCode: 200, LatencyMS: 30, TotalTokens: 4, CostUSD: 0.5, Timestamp: start.Add(49 * time.Hour)},
+	}
+	mem.RecordBatch(late)
+	store.RecordBatch(late)
+	if _, err := store.DeleteBefore(start.Add(60*time.Hour), 1000); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	for _, q := range []usage.SummaryQuery{
+		{GroupBy: []string{usage.GroupKey}},
+		{GroupBy: []string{usage.GroupTime}, Bucket: usage.BucketHour},
+		{GroupBy: []string{usage.GroupTime, usage.GroupKey}, Bucket: usage.BucketDay},
+	} {
+		want, _ := mem.Summary(q)
+		got, err := store.Summary(q)
+		if err != nil {
+			t.Fatalf("%+v: %v", q, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%+v:\n got %+v\nwant %+v", q, got, want)
+		}
+	}
+	for _, key := range []string{"k1", "k3"} {
+		want, _ := mem.Totals(key)
+		got, err := store.Totals(key)
+		if err != nil || got.Tokens != want.Tokens || math.Abs(got.CostUSD-want.CostUSD) > 1e-9 {
+			t.Fatalf("expected totals %+v for %s, got %+v, %v", want, key, got, err)
+		}
+	}
+}
+
+func TestMigrateFillsKeyTotals(t *testing.T) {
+	db := sqliteDB(t)
+	start := time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)
+	store := usage.NewSQLStore(db)
+	store.RecordBatch(rollupEvents(start))
+	if err := store.Compact(context.Background(), start.Add(24*time.Hour)); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	want, _ := store.Totals("k1")
+
+	// A database from before usage_key_totals is filled from the rollups
+	// and the raw events not rolled up yet.
+	if err := db.Migrator().DropTable(&usage.KeyTotal{}); err != nil {
+		t.Fatalf("drop: %v", err)
+	}
+	if err := usage.Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	got, err := store.Totals("k1")
+	if err != nil || got.Tokens != want.Tokens || math.Abs(got.CostUSD-want.CostUSD) > 1e-9 {
+		t.Fatalf("expected totals %+v, got %+v, %v", want, got, err)
+	}
+}
@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+// openUsageStream connects to the usage stream of a live server and waits
+// until the subscription is registered.
+func openUsageStream(t *testing.T, env *TestEnv, token, query string) *bufio.Reader {
+	t.Helper()
+	ts := httptest.NewServer(env.Router)
+	t.Cleanup(ts.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/v1/usage/stream?"+query, nil)
+	req.Header.Set("X-API-Key", env.User.APIKey)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	waitFor(t, func() bool { return env.Server.UsageStream.Subscribers() == 1 })
+	return bufio.NewReader(resp.Body)
+}
+
+// nextStreamEvent reads the next server-sent event, skipping comments.
+func nextStreamEvent(t *testing.T, r *bufio.Reader) (string, string) {
+	t.Helper()
+	var name, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStreamUsageFiltersByOrgAndStatus(t *testing.T) {
+	env := newTestEnv(t)
+	stream := openUsageStream(t, env, orgToken(t, env, "o1"), "status=5xx")
+
+	env.Server.UsageStream.Publish(usage.Event{KeyID: "k3", OrgID: "o2", StatusCode: 500})
+	env.Server.UsageStream.Publish(usage.Event{KeyID: "k1", OrgID: "o1", StatusCode: 200})
+	env.Server.UsageStream.Publish(usage.Event{KeyID: "k1", OrgID: "o1", Service: "openai", StatusCode: 502})
+
+	name, data := nextStreamEvent(t, stream)
+	if name != "usage" {
+		t.Fatalf("expected usage event, got %q", name)
+	}
+	var e usage.Event
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.OrgID != "o1" || e.StatusCode != 502 || e.Service != "openai" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
+
+func TestStreamUsageFromProxy(t *testing.T) {
+	env := newTestEnv(t)
+	env.Server.KeyStore.Create(keys.VirtualKey{ID: "vk", Target: "svc", Scope: keys.ScopeWrite, RateLimit: 100, OrgID: "o1", ExpiresAt: time.Now().Add(-time.Minute)})
+	stream := openUsageStream(t, env, orgToken(t, env, "o1"), "key=vk")
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/proxy/anything", nil)
+	req.Header.Set("X-Virtual-Key", "vk")
+	env.Router.ServeHTTP(httptest.NewRecorder(), req)
+
+	_, data := nextStreamEvent(t, stream)
+	var e usage.Event
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.KeyID != "vk" || e.StatusCode != http.StatusUnauthorized || e.Category != usage.CategoryExpired {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
+
+func TestStreamUsageErrors(t *testing.T) {
+	env := newTestEnv(t)
+	for _, tc := range []struct {
+		name  string
+		query string
+		code  int
+	}{
+		{"other org", "org=o2", http.StatusForbidden},
+		{"invalid status", "status=abc", http.StatusBadRequest},
+		{"invalid status class", "status=6xx", http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/usage/stream?"+tc.query, nil)
+			req.Header.Set("X-API-Key", env.User.APIKey)
+			req.Header.Set("Authorization", "Bearer "+orgToken(t, env, "o1"))
+			rr := httptest.NewRecorder()
+			env.Router.ServeHTTP(rr, req)
+			if rr.Code != tc.code {
+				t.Fatalf("expected %d, got %d: %s", tc.code, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	env.Server.UsageStream = nil
+	req := httptest.NewRequest(http.MethodGet, "/v1/usage/stream", nil)
+	env.Authorize(req)
+	rr := httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without a stream, got %d", rr.Code)
+	}
+}
+
+func TestUsageRedisRelay(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newInstance := func() (*usage.Broadcaster, *usage.RedisRelay) {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		b := usage.NewBroadcaster()
+		relay := usage.NewRedisRelay(client, b)
+		go relay.Run(ctx)
+		return b, relay
+	}
+	localB, local := newInstance()
+	remoteB, _ := newInstance()
+	waitFor(t, func() bool { return mr.PubSubNumSub(usage.StreamChannel)[usage.StreamChannel] == 2 })
+
+	mine := localB.Subscribe(usage.StreamFilter{}, 8)
+	defer mine.Close()
+	theirs := remoteB.Subscribe(usage.StreamFilter{OrgID: "o1"}, 8)
+	defer theirs.Close()
+
+	local.Publish(usage.Event{KeyID: "k2", OrgID: "o2", StatusCode: 200})
+	local.Publish(usage.Event{KeyID: "k1", OrgID: "o1", StatusCode: 200})
+
+	select {
+	case e := <-theirs.C:
+		if e.KeyID != "k1" {
+			t.Fatalf("unexpected relayed event %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event not relayed")
+	}
+	for _, want := range []string{"k2", "k1"} {
+		if e := <-mine.C; e.KeyID != want {
+			t.Fatalf("expected local %s, got %+v", want, e)
+		}
+	}
+	// The relay must not deliver its own events a second time.
+	select {
+	case e := <-mine.C:
+		t.Fatalf("event delivered twice: %+v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
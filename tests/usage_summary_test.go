@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/usage"
+)
+
+// seedSummaryEvents records events across two orgs, two services and two
+// hours of the same day.
+func seedSummaryEvents(t *testing.T, store usage.Store) time.Time {
+	t.Helper()
+	day := time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)
+	events := []usage.Event{
+		{KeyID: "k1", OrgID: "o1", Service: "openai", Source: "sa", Model: "gpt-4o", StatusCode: 200, LatencyMS: 80, PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, CostUSD: 0.5, Timestamp: day.Add(9 * time.Hour)},
+		{KeyID: "k1", OrgID: "o1", Service: "openai", Source: "sa", Model: "gpt-4o", StatusCode: 200, LatencyMS: 120, TotalTokens: 20, CostUSD: 0.25, Timestamp: day.Add(9*time.Hour + time.Minute)},
+		{KeyID: "k1", OrgID: "o1", Service: "openai", Source: "sa", Model: "gpt-4o", StatusCode: 502, LatencyMS: 3000, Timestamp: day.Add(10 * time.Hour)},
+		{KeyID: "k2", OrgID: "o1", Service: "anthropic", StatusCode: 429, LatencyMS: 2, Timestamp: day.Add(10 * time.Hour)},
+		{KeyID: "k3", OrgID: "o2", Service: "openai", StatusCode: 200, LatencyMS: 40, TotalTokens: 7, Timestamp: day.Add(11 * time.Hour)},
+	}
+	if err := store.RecordBatch(events); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return day
+}
+
+func checkSummary(t *testing.T, store usage.Store) {
+	t.Helper()
+	day := seedSummaryEvents(t, store)
+
+	rows, err := store.Summary(usage.SummaryQuery{GroupBy: []string{usage.GroupOrg, usage.GroupService}})
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %+v", rows)
+	}
+	r := rows[1] // o1/openai sorts after o1/anthropic
+	if r.Group["org"] != "o1" || r.Group["service"] != "openai" {
+		t.Fatalf("unexpected row order: %+v", rows)
+	}
+	if r.Requests != 3 || r.Errors != 1 || r.TotalTokens != 35 || r.PromptTokens != 10 || r.CostUSD != 0.75 {
+		t.Fatalf("unexpected o1/openai row: %+v", r)
+	}
+	if r.ErrorRate < 0.33 || r.ErrorRate > 0.34 {
+		t.Fatalf("expected error rate 1/3, got %v", r.ErrorRate)
+	}
+	if r.LatencyP50MS <= 50 || r.LatencyP50MS > 250 || r.LatencyP99MS <= 2500 || r.LatencyP99MS > 5000 {
+		t.Fatalf("unexpected latency percentiles: %+v", r)
+	}
+
+	rows, err = store.Summary(usage.SummaryQuery{
+		OrgID:   "o1",
+		GroupBy: []string{usage.GroupTime, usage.GroupStatusClass},
+		Bucket:  usage.BucketHour,
+		From:    day.Add(10 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Group["time"] != "2025-03-14T10:00:00Z" ||
+		rows[0].Group["status_class"] != "4xx" || rows[1].Group["status_class"] != "5xx" {
+		t.Fatalf("unexpected hourly rows: %+v", rows)
+	}
+
+	rows, _ = store.Summary(usage.SummaryQuery{GroupBy: []string{usage.GroupTime, usage.GroupModel}, Bucket: usage.BucketMonth})
+	if len(rows) != 2 || rows[0].Group["time"] != "2025-03-01T00:00:00Z" || rows[0].Group["model"] != "" || rows[1].Requests != 3 {
+		t.Fatalf("unexpected monthly rows: %+v", rows)
+	}
+
+	rows, _ = store.Summary(usage.SummaryQuery{})
+	if len(rows) != 1 || rows[0].Requests != 5 || len(rows[0].Group) != 0 {
+		t.Fatalf("unexpected ungrouped summary: %+v", rows)
+	}
+
+	if _, err := store.Summary(usage.SummaryQuery{GroupBy: []string{"colour"}}); err == nil {
+		t.Fatalf("expected error for unknown dimension")
+	}
+}
+
+func TestMemoryUsageSummary(t *testing.T) {
+	checkSummary(t, usage.NewMemoryStore())
+}
+
+func TestSQLUsageSummary(t *testing.T) {
+	checkSummary(t, usage.NewSQLStore(sqliteDB(t)))
+}
+
+func TestUsageSummaryEndpoint(t *testing.T) {
+	env := newTestEnv(t)
+	seedSummaryEvents(t, env.Server.UsageStore)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/usage/summary?group_by=service&bucket=day&org_id=o1", nil)
+	env.Authorize(req)
+	rr := httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		GroupBy []string           `json:"group_by"`
+		Rows    []usage.SummaryRow `json:"rows"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.GroupBy) != 2 || resp.GroupBy[1] != "time" {
+		t.Fatalf("expected bucket to add time grouping, got %v", resp.GroupBy)
+	}
+	if len(resp.Rows) != 2 || resp.Rows[1].Group["service"] != "openai" || resp.Rows[1].Requests != 3 {
+		t.Fatalf("unexpected rows: %+v", resp.Rows)
+	}
+
+	for _, q := range []string{"group_by=colour", "group_by=time", "bucket=week", "from=yesterday"} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/usage/summary?"+q, nil)
+		env.Authorize(req)
+		rr := httptest.NewRecorder()
+		env.Router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", q, rr.Code)
+		}
+	}
+}
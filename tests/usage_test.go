@@ -1,13 +1,19 @@
 package tests
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
+
 	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/ratelimit"
 	"github.com/farovictor/bifrost/pkg/rootkeys"
 	"github.com/farovictor/bifrost/pkg/services"
 	"github.com/farovictor/bifrost/pkg/usage"
@@ -176,3 +182,180 @@ func TestProxyRecordsUsageEvent(t *testing.T) {
 		t.Errorf("unexpected service: %s", events[0].Service)
 	}
 }
+
+func TestProxyRecordsUsageModelAndCost(t *testing.T) {
+	t.Setenv("BIFROST_TRACK_TOKENS", "true")
+	s := newTestServer(t)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"model":"gpt-4o","usage":{"prompt_tokens":1000,"completion_tokens":500,"total_tokens":1500}}`))
+	}))
+	defer backend.Close()
+
+	s.RootKeyStore.Create(rootkeys.RootKey{ID: "rk", APIKey: "real", OrgID: "org-1"})
+	s.ServiceStore.Create(services.Service{ID: "svc", Endpoint: backend.URL, RootKeyID: "rk", OrgID: "org-1", PromptTokenPrice: 2.5, CompletionTokenPrice: 10})
+	s.KeyStore.Create(keys.VirtualKey{ID: "vk", Target: "svc", Scope: keys.ScopeWrite, RateLimit: 100, OrgID: "org-1", Source: keys.SourceServiceAccount, ExpiresAt: time.Now().Add(time.Hour)})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/proxy/chat", nil)
+	req.Header.Set("X-Virtual-Key", "vk")
+	rr := httptest.NewRecorder()
+	setupRouter(s).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	events, _, _ := s.UsageStore.List("vk", time.Time{}, time.Time{}, 1, 10)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.Model != "gpt-4o" || ev.OrgID != "org-1" || ev.Source != keys.SourceServiceAccount {
+		t.Fatalf("unexpected event dimensions: %+v", ev)
+	}
+	if ev.CostUSD != 0.0075 {
+		t.Fatalf("expected cost 0.0075, got %v", ev.CostUSD)
+	}
+}
+
+func TestProxyRecordsUsageEventDetails(t *testing.T) {
+	s := newTestServer(t)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+	defer backend.Close()
+
+	s.RootKeyStore.Create(rootkeys.RootKey{ID: "rk", APIKey: "real"})
+	s.ServiceStore.Create(services.Service{ID: "svc", Endpoint: backend.URL, RootKeyID: "rk"})
+	s.KeyStore.Create(keys.VirtualKey{ID: "vk", Target: "svc", Scope: keys.ScopeWrite, RateLimit: 100, ExpiresAt: time.Now().Add(time.Hour)})
+
+	body := `{"model":"gpt-4o-mini","stream":true}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/proxy/chat?stream=1", strings.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.RequestIDKey, "req-1"))
+	req.Header.Set("X-Virtual-Key", "vk")
+	req.Header.Set("User-Agent", "bifrost-test/1.0")
+	req.RemoteAddr = "203.0.113.7:51234"
+	rr := httptest.NewRecorder()
+	setupRouter(s).ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	events, _, _ := s.UsageStore.List("vk", time.Time{}, time.Time{}, 1, 10)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.RequestBytes != int64(len(body)) || ev.ResponseBytes != 5 {
+		t.Errorf("expected %d/5 bytes, got %d/%d", len(body), ev.RequestBytes, ev.ResponseBytes)
+	}
+	if ev.ClientIP != "203.0.113.7" || ev.UserAgent != "bifrost-test/1.0" || ev.RequestID != "req-1" {
+		t.Errorf("unexpected client details: %+v", ev)
+	}
+	if ev.UpstreamEndpoint != backend.URL+"/chat" {
+		t.Errorf("expected endpoint %s/chat, got %q", backend.URL, ev.UpstreamEndpoint)
+	}
+	if ev.Model != "gpt-4o-mini" {
+		t.Errorf("expected model from request body, got %q", ev.Model)
+	}
+	if ev.Category != "" || ev.TTFBMS < 0 || ev.TTFBMS > ev.LatencyMS {
+		t.Errorf("unexpected category or ttfb: %+v", ev)
+	}
+}
+
+func TestProxyRecordsUpstreamFailureCategory(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	for _, tc := range []struct {
+		endpoint string
+		code     int
+		category string
+	}{
+		{backend.URL, http.StatusServiceUnavailable, usage.CategoryUpstreamError},
+		{dead.URL, http.StatusBadGateway, usage.CategoryUpstreamUnreachable},
+	} {
+		s := newTestServer(t)
+		s.RootKeyStore.Create(rootkeys.RootKey{ID: "rk", APIKey: "real"})
+		s.ServiceStore.Create(services.Service{ID: "svc", Endpoint: tc.endpoint, RootKeyID: "rk"})
+		s.KeyStore.Create(keys.VirtualKey{ID: "vk", Target: "svc", Scope: keys.ScopeWrite, RateLimit: 100, ExpiresAt: time.Now().Add(time.Hour)})
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/proxy/chat", nil)
+		req.Header.Set("X-Virtual-Key", "vk")
+		rr := httptest.NewRecorder()
+		setupRouter(s).ServeHTTP(rr, req)
+		if rr.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d", tc.category, tc.code, rr.Code)
+		}
+		events, _, _ := s.UsageStore.List("vk", time.Time{}, time.Time{}, 1, 10)
+		if len(events) != 1 || events[0].Category != tc.category || events[0].StatusCode != tc.code {
+			t.Fatalf("%s: unexpected events %+v", tc.category, events)
+		}
+	}
+}
+
+func TestProxyRecordsRejectedRequests(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		key      keys.VirtualKey
+		method   string
+		seed     int
+		requests int
+		code     int
+		category string
+	}{
+		{"expired", keys.VirtualKey{Scope: keys.ScopeWrite, RateLimit: 100, ExpiresAt: time.Now().Add(-time.Minute)}, http.MethodGet, 0, 1, http.StatusUnauthorized, usage.CategoryExpired},
+		{"scope", keys.VirtualKey{Scope: keys.ScopeRead, RateLimit: 100, ExpiresAt: time.Now().Add(time.Hour)}, http.MethodPost, 0, 1, http.StatusForbidden, usage.CategoryScope},
+		{"budget", keys.VirtualKey{Scope: keys.ScopeWrite, RateLimit: 100, TokenBudget: 10, ExpiresAt: time.Now().Add(time.Hour)}, http.MethodGet, 10, 1, http.StatusTooManyRequests, ratelimit.ReasonBudgetExceeded},
+		{"rate limit", keys.VirtualKey{Scope: keys.ScopeWrite, RateLimit: 1, ExpiresAt: time.Now().Add(time.Hour)}, http.MethodGet, 0, 2, http.StatusTooManyRequests, ratelimit.ReasonRateLimited},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			}))
+			defer backend.Close()
+			s.RootKeyStore.Create(rootkeys.RootKey{ID: "rk", APIKey: "real", OrgID: "org-1"})
+			s.ServiceStore.Create(services.Service{ID: "svc", Endpoint: backend.URL, RootKeyID: "rk", OrgID: "org-1"})
+			k := tc.key
+			k.ID, k.Target, k.OrgID = "vk", "svc", "org-1"
+			s.KeyStore.Create(k)
+			if tc.seed > 0 {
+				s.UsageStore.Record(usage.Event{KeyID: "vk", Timestamp: time.Now(), StatusCode: 200, Service: "svc", TotalTokens: tc.seed})
+			}
+
+			var rr *httptest.ResponseRecorder
+			for i := 0; i < tc.requests; i++ {
+				req := httptest.NewRequest(tc.method, "/v1/proxy/chat", nil)
+				req.Header.Set("X-Virtual-Key", "vk")
+				rr = httptest.NewRecorder()
+				setupRouter(s).ServeHTTP(rr, req)
+			}
+			if rr.Code != tc.code {
+				t.Fatalf("expected %d, got %d: %s", tc.code, rr.Code, rr.Body.String())
+			}
+
+			events, _, _ := s.UsageStore.List("vk", time.Time{}, time.Time{}, 1, 10)
+			var rejected []usage.Event
+			for _, ev := range events {
+				if ev.Category != "" {
+					rejected = append(rejected, ev)
+				}
+			}
+			if len(rejected) != 1 {
+				t.Fatalf("expected 1 rejected event, got %+v", events)
+			}
+			ev := rejected[0]
+			if ev.Category != tc.category || ev.StatusCode != tc.code || ev.OrgID != "org-1" || ev.Service != "svc" {
+				t.Fatalf("unexpected rejected event: %+v", ev)
+			}
+			if ev.UpstreamEndpoint != "" {
+				t.Errorf("rejected request should have no upstream endpoint, got %q", ev.UpstreamEndpoint)
+			}
+		})
+	}
+}
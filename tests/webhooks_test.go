@@ -0,0 +1,258 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/farovictor/bifrost/pkg/database"
+	"github.com/farovictor/bifrost/pkg/keys"
+	"github.com/farovictor/bifrost/pkg/notify"
+	"github.com/farovictor/bifrost/pkg/orgs"
+	"github.com/farovictor/bifrost/pkg/services"
+	"github.com/farovictor/bifrost/pkg/webhooks"
+)
+
+// hookReceiver is an httptest webhook receiver recording what it is sent.
+type hookReceiver struct {
+	*httptest.Server
+	mu      sync.Mutex
+	headers []http.Header
+	bodies  [][]byte
+}
+
+func newHookReceiver(t *testing.T) *hookReceiver {
+	hr := &hookReceiver{}
+	hr.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		hr.mu.Lock()
+		defer hr.mu.Unlock()
+		hr.headers = append(hr.headers, r.Header.Clone())
+		hr.bodies = append(hr.bodies, body)
+	}))
+	t.Cleanup(hr.Close)
+	return hr
+}
+
+// events returns the events received so far, checking each signature
+// against secret.
+func (hr *hookReceiver) events(t *testing.T, secret string) []webhooks.Event {
+	t.Helper()
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	var out []webhooks.Event
+	for i, body := range hr.bodies {
+		if err := webhooks.Verify(secret, hr.headers[i].Get(webhooks.SignatureHeader), body, time.Minute, time.Now()); err != nil {
+			t.Fatalf("delivery %d: %v", i, err)
+		}
+		var e webhooks.Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// seedWebhookOrgs creates orgs o1 and o2 and subscribes a receiver to the
+// key events of o1, returning the receiver and the webhook.
+func seedWebhookOrgs(t *testing.T, env *TestEnv, events ...string) (*hookReceiver, webhooks.Webhook) {
+	t.Helper()
+	for _, o := range []orgs.Organization{{ID: "o1", Name: "one"}, {ID: "o2", Name: "two"}} {
+		if err := env.Server.OrgStore.Create(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hr := newHookReceiver(t)
+	rr := env.Do(orgToken(t, env, "o1"), http.MethodPost, "/v1/orgs/o1/webhooks", map[string]any{"url": hr.URL, "events": events})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var hook webhooks.Webhook
+	json.Unmarshal(rr.Body.Bytes(), &hook)
+	return hr, hook
+}
+
+func deliverWebhooks(t *testing.T, env *TestEnv) {
+	t.Helper()
+	if _, err := env.Server.Webhooks.DeliverDue(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebhookCRUD(t *testing.T) {
+	env := newTestEnv(t)
+	_, hook := seedWebhookOrgs(t, env, webhooks.EventKeyCreated)
+	if hook.ID == "" || hook.OrgID != "o1" || !hook.Active || len(hook.Secret) < 10 {
+		t.Fatalf("unexpected webhook %+v", hook)
+	}
+
+	rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/orgs/o1/webhooks", nil)
+	var list []webhooks.Webhook
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if rr.Code != http.StatusOK || len(list) != 1 || list[0].ID != hook.ID || list[0].Secret != "" {
+		t.Fatalf("unexpected list %d: %s", rr.Code, rr.Body.String())
+	}
+
+	path := "/v1/orgs/o1/webhooks/" + hook.ID
+	active := false
+	rr = env.Do(orgToken(t, env, "o1"), http.MethodPut, path, map[string]any{"url": "https://example.com/h", "events": []string{webhooks.EventKeyRevoked}, "active": active})
+	var got webhooks.Webhook
+	json.Unmarshal(rr.Body.Bytes(), &got)
+	if rr.Code != http.StatusOK || got.Active || got.URL != "https://example.com/h" || got.Secret != "" {
+		t.Fatalf("unexpected update %d: %s", rr.Code, rr.Body.String())
+	}
+	stored, _ := env.Server.WebhookStore.GetWebhook(hook.ID)
+	if stored.Secret != hook.Secret {
+		t.Fatal("secret changed by update without one")
+	}
+	rr = env.Do(orgToken(t, env, "o1"), http.MethodPut, path, map[string]any{"url": "https://example.com/h", "events": []string{webhooks.EventKeyRevoked}, "secret": "new-secret"})
+	json.Unmarshal(rr.Body.Bytes(), &got)
+	if rr.Code != http.StatusOK || got.Secret != "new-secret" || !got.Active {
+		t.Fatalf("unexpected secret update %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = env.Do(orgToken(t, env, "o1"), http.MethodGet, path, nil)
+	got = webhooks.Webhook{}
+	json.Unmarshal(rr.Body.Bytes(), &got)
+	if rr.Code != http.StatusOK || got.Secret != "" || got.Events[0] != webhooks.EventKeyRevoked {
+		t.Fatalf("unexpected get %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := env.Do(orgToken(t, env, "o1"), http.MethodDelete, path, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	if rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, path, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", rr.Code)
+	}
+}
+
+func TestWebhookErrors(t *testing.T) {
+	env := newTestEnv(t)
+	_, hook := seedWebhookOrgs(t, env, webhooks.EventKeyCreated)
+	other := webhooks.Webhook{ID: "wh-o2", OrgID: "o2", URL: "https://example.com", Events: []string{webhooks.EventKeyCreated}, Active: true}
+	env.Server.WebhookStore.CreateWebhook(other)
+
+	for _, tc := range []struct {
+		method, path string
+		body         any
+		code         int
+		msg          string
+	}{
+		{http.MethodPost, "/v1/orgs/o1/webhooks", map[string]any{"url": "ftp://example.com", "events": []string{"key.created"}}, http.StatusBadRequest, "invalid url"},
+		{http.MethodPost, "/v1/orgs/o1/webhooks", map[string]any{"url": "https://example.com"}, http.StatusBadRequest, "invalid events"},
+		{http.MethodPost, "/v1/orgs/o1/webhooks", map[string]any{"url": "https://example.com", "events": []string{"key.bogus"}}, http.StatusBadRequest, "invalid events"},
+		{http.MethodGet, "/v1/orgs/o2/webhooks", nil, http.StatusForbidden, ""},
+		{http.MethodGet, "/v1/orgs/o1/webhooks/wh-o2", nil, http.StatusNotFound, "not found"},
+		{http.MethodDelete, "/v1/orgs/o1/webhooks/wh-o2", nil, http.StatusNotFound, "not found"},
+		{http.MethodGet, "/v1/orgs/o1/webhooks/" + hook.ID + "/deliveries?status=bogus", nil, http.StatusBadRequest, "invalid status"},
+		{http.MethodGet, "/v1/orgs/o1/webhooks/" + hook.ID + "/deliveries?limit=0", nil, http.StatusBadRequest, "invalid limit"},
+		{http.MethodPost, "/v1/orgs/o1/webhooks/" + hook.ID + "/deliveries/missing/redeliver", nil, http.StatusNotFound, "not found"},
+	} {
+		rr := env.Do(orgToken(t, env, "o1"), tc.method, tc.path, tc.body)
+		if rr.Code != tc.code || (tc.msg != "" && errorBody(t, rr) != tc.msg) {
+			t.Fatalf("%s %s: expected %d %q, got %d: %s", tc.method, tc.path, tc.code, tc.msg, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestWebhookKeyEventsDelivered(t *testing.T) {
+	env := newTestEnv(t)
+	hr, hook := seedWebhookOrgs(t, env, webhooks.EventKeyCreated, webhooks.EventKeyRevoked)
+	env.Server.ServiceStore.Create(services.Service{ID: "svc", Endpoint: "http://example.com", RootKeyID: "rk", OrgID: "o1"})
+
+	body := map[string]any{"id": "wk", "scope": "read", "target": "svc", "rate_limit": 1, "expires_at": time.Now().Add(time.Hour)}
+	if rr := env.Do(orgToken(t, env, "o1"), http.MethodPost, "/v1/keys", body); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	// Keys of other orgs are not delivered.
+	body["id"] = "wk2"
+	env.Do(orgToken(t, env, "o2"), http.MethodPost, "/v1/keys", body)
+	if rr := env.Do(orgToken(t, env, "o1"), http.MethodDelete, "/v1/keys/wk", nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	deliverWebhooks(t, env)
+
+	events := hr.events(t, hook.Secret)
+	if len(events) != 2 || events[0].Type != webhooks.EventKeyCreated || events[1].Type != webhooks.EventKeyRevoked {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if e := events[0]; e.KeyID != "wk" || e.OrgID != "o1" || e.Data["target"] != "svc" {
+		t.Fatalf("unexpected key.created event %+v", e)
+	}
+
+	rr := env.Do(orgToken(t, env, "o1"), http.MethodGet, "/v1/orgs/o1/webhooks/"+hook.ID+"/deliveries?status=delivered", nil)
+	var dels []webhooks.Delivery
+	json.Unmarshal(rr.Body.Bytes(), &dels)
+	if rr.Code != http.StatusOK || len(dels) != 2 || dels[0].Attempts != 1 || dels[0].StatusCode != http.StatusOK {
+		t.Fatalf("unexpected deliveries %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = env.Do(orgToken(t, env, "o1"), http.MethodPost, "/v1/orgs/o1/webhooks/"+hook.ID+"/deliveries/"+dels[0].ID+"/redeliver", nil)
+	var red webhooks.Delivery
+	json.Unmarshal(rr.Body.Bytes(), &red)
+	if rr.Code != http.StatusAccepted || red.RedeliveryOf != dels[0].ID || red.Status != webhooks.StatusPending {
+		t.Fatalf("unexpected redeliver %d: %s", rr.Code, rr.Body.String())
+	}
+	deliverWebhooks(t, env)
+	events = hr.events(t, hook.Secret)
+	if len(events) != 3 || events[2].ID != events[1].ID {
+		t.Fatalf("expected the event sent again, got %+v", events)
+	}
+}
+
+func TestWebhookOneShotKeyUsed(t *testing.T) {
+	env := newTestEnv(t)
+	hr, hook := seedWebhookOrgs(t, env, webhooks.EventKeyUsed)
+	svcID, _ := seedProxyBackend(t, env.Server)
+	svc, _ := env.Server.ServiceStore.Get(svcID)
+	rk, _ := env.Server.RootKeyStore.Get(svc.RootKeyID)
+	svc.OrgID, rk.OrgID = "o1", "o1"
+	env.Server.ServiceStore.Update(svc)
+	env.Server.RootKeyStore.Update(rk)
+	k := keys.VirtualKey{ID: "vk-hook", OrgID: "o1", Target: svcID, Scope: keys.ScopeRead, ExpiresAt: time.Now().Add(time.Hour), RateLimit: 10, OneShot: true}
+	env.Server.KeyStore.Create(k)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/proxy/path", nil)
+	req.Header.Set("X-Virtual-Key", k.ID)
+	rr := httptest.NewRecorder()
+	env.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	deliverWebhooks(t, env)
+
+	events := hr.events(t, hook.Secret)
+	if len(events) != 1 || events[0].Type != webhooks.EventKeyUsed || events[0].KeyID != k.ID {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestWebhookKeyExpired(t *testing.T) {
+	env := newTestEnv(t)
+	hr, hook := seedWebhookOrgs(t, env, webhooks.EventKeyExpired)
+	now := time.Now().UTC()
+	env.Server.KeyStore.Create(keys.VirtualKey{ID: "vk-exp", OrgID: "o1", Scope: keys.ScopeRead, RateLimit: 1, ExpiresAt: now.Add(-time.Minute)})
+
+	// The key is never used; the checker's scan announces its expiry.
+	store := notify.NewMemoryStore()
+	store.SetBus(env.Server.Events)
+	c := &notify.Checker{Keys: env.Server.KeyStore, Usage: env.Server.UsageStore, Store: store, Lock: &database.LocalLock{}}
+	for i := 0; i < 2; i++ {
+		if _, err := c.RunOnce(context.Background(), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env.Server.Events.Flush(context.Background())
+	deliverWebhooks(t, env)
+
+	events := hr.events(t, hook.Secret)
+	if len(events) != 1 || events[0].Type != webhooks.EventKeyExpired || events[0].KeyID != "vk-exp" || events[0].Data["expires_at"] == nil {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}